@@ -0,0 +1,320 @@
+// Package asg implements Auto Scaling Group utils.
+package asg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_asg_v2 "github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	aws_asg_v2_types "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+)
+
+type Op struct {
+	autoRollback          bool
+	honorCooldown         bool
+	instanceWarmup        int32
+	interval              time.Duration
+	launchTemplateID      string
+	launchTemplateVersion string
+	lifecycleStates       map[string]struct{}
+	maxActivities         int
+	minHealthyPercentage  int32
+	progressFunc          func(RefreshStatus)
+	skipMatching          bool
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Set true to roll back the instance refresh to the previous configuration on failure.
+func WithAutoRollback(b bool) OpOption {
+	return func(op *Op) {
+		op.autoRollback = b
+	}
+}
+
+// Set true to fail the desired capacity change while the group is in the cooldown period.
+func WithHonorCooldown(b bool) OpOption {
+	return func(op *Op) {
+		op.honorCooldown = b
+	}
+}
+
+// Sets the seconds for the new instance to warm up before the instance refresh moves on
+// (0 to use the health check grace period of the group).
+func WithInstanceWarmup(seconds int32) OpOption {
+	return func(op *Op) {
+		op.instanceWarmup = seconds
+	}
+}
+
+// Sets the poll (or heartbeat) interval.
+func WithInterval(v time.Duration) OpOption {
+	return func(op *Op) {
+		op.interval = v
+	}
+}
+
+// Sets the launch template to refresh the instances to (e.g., the new image).
+// The version is "$Latest", "$Default", or the version number.
+// If empty, the instances are refreshed to the current launch template of the group.
+func WithLaunchTemplate(id string, version string) OpOption {
+	return func(op *Op) {
+		op.launchTemplateID = id
+		op.launchTemplateVersion = version
+	}
+}
+
+// Sets the lifecycle states to list the instances in (e.g., "InService").
+// If empty, all the instances are listed.
+func WithLifecycleStates(states ...string) OpOption {
+	return func(op *Op) {
+		if op.lifecycleStates == nil {
+			op.lifecycleStates = make(map[string]struct{}, len(states))
+		}
+		for _, s := range states {
+			op.lifecycleStates[s] = struct{}{}
+		}
+	}
+}
+
+// Sets the maximum number of scaling activities to describe (default 100).
+func WithMaxActivities(v int) OpOption {
+	return func(op *Op) {
+		op.maxActivities = v
+	}
+}
+
+// Sets the minimum percentage of the healthy instances during the instance refresh
+// (0 for the default 90 percent).
+func WithMinHealthyPercentage(v int32) OpOption {
+	return func(op *Op) {
+		op.minHealthyPercentage = v
+	}
+}
+
+// Sets the function to report the instance refresh status on each poll.
+func WithProgressFunc(f func(RefreshStatus)) OpOption {
+	return func(op *Op) {
+		op.progressFunc = f
+	}
+}
+
+// Set true to skip replacing the instances that already match the desired configuration.
+func WithSkipMatching(b bool) OpOption {
+	return func(op *Op) {
+		op.skipMatching = b
+	}
+}
+
+// Represents the Auto Scaling Group.
+type ASG struct {
+	Name              string            `json:"name"`
+	ARN               string            `json:"arn"`
+	MinSize           int32             `json:"min_size"`
+	MaxSize           int32             `json:"max_size"`
+	DesiredCapacity   int32             `json:"desired_capacity"`
+	AvailabilityZones []string          `json:"availability_zones"`
+	Status            string            `json:"status,omitempty"`
+	Instances         []Instance        `json:"instances"`
+	Tags              map[string]string `json:"tags,omitempty"`
+}
+
+// Represents the instance in the Auto Scaling Group.
+type Instance struct {
+	ID                   string `json:"id"`
+	AvailabilityZone     string `json:"availability_zone"`
+	InstanceType         string `json:"instance_type"`
+	HealthStatus         string `json:"health_status"`
+	LifecycleState       string `json:"lifecycle_state"`
+	ProtectedFromScaleIn bool   `json:"protected_from_scale_in"`
+}
+
+// Represents the scaling activity of the Auto Scaling Group.
+type Activity struct {
+	ID            string    `json:"id"`
+	Description   string    `json:"description"`
+	Cause         string    `json:"cause"`
+	StatusCode    string    `json:"status_code"`
+	StatusMessage string    `json:"status_message,omitempty"`
+	Progress      int32     `json:"progress"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time,omitempty"`
+}
+
+// Returned when the Auto Scaling Group does not exist.
+var ErrASGNotFound = errors.New("auto scaling group not found")
+
+// Fetches the Auto Scaling Group by name.
+func GetASG(ctx context.Context, cfg aws.Config, name string) (ASG, error) {
+	cli := aws_asg_v2.NewFromConfig(cfg)
+	out, err := cli.DescribeAutoScalingGroups(ctx, &aws_asg_v2.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []string{name},
+	})
+	if err != nil {
+		return ASG{}, err
+	}
+	switch len(out.AutoScalingGroups) {
+	case 0:
+		return ASG{}, ErrASGNotFound
+	case 1:
+		return convertASG(out.AutoScalingGroups[0]), nil
+	default:
+		return ASG{}, fmt.Errorf("expected 1 auto scaling group, got %d", len(out.AutoScalingGroups))
+	}
+}
+
+// Sets the desired capacity of the Auto Scaling Group.
+// Use "WithHonorCooldown" to fail during the cooldown period.
+func SetDesiredCapacity(ctx context.Context, cfg aws.Config, name string, desired int32, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("setting desired capacity", "asg", name, "desired", desired, "honorCooldown", ret.honorCooldown)
+	cli := aws_asg_v2.NewFromConfig(cfg)
+	_, err := cli.SetDesiredCapacity(ctx, &aws_asg_v2.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String(name),
+		DesiredCapacity:      aws.Int32(desired),
+		HonorCooldown:        aws.Bool(ret.honorCooldown),
+	})
+	if err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully set desired capacity", "asg", name, "desired", desired)
+	return nil
+}
+
+// Describes the scaling activities of the Auto Scaling Group, the most recent first.
+// Use "WithMaxActivities" to limit the number of activities.
+func DescribeScalingActivities(ctx context.Context, cfg aws.Config, name string, opts ...OpOption) ([]Activity, error) {
+	ret := &Op{maxActivities: 100}
+	ret.applyOpts(opts)
+
+	cli := aws_asg_v2.NewFromConfig(cfg)
+	pg := aws_asg_v2.NewDescribeScalingActivitiesPaginator(cli, &aws_asg_v2.DescribeScalingActivitiesInput{
+		AutoScalingGroupName: aws.String(name),
+	})
+	acts := make([]Activity, 0)
+	for pg.HasMorePages() && len(acts) < ret.maxActivities {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range out.Activities {
+			acts = append(acts, convertActivity(raw))
+		}
+	}
+	if len(acts) > ret.maxActivities {
+		acts = acts[:ret.maxActivities]
+	}
+	return acts, nil
+}
+
+// Lists the instances in the Auto Scaling Group, sorted by the instance ID.
+// Use "WithLifecycleStates" to only list the instances in the states (e.g., "InService").
+func ListInstancesInASG(ctx context.Context, cfg aws.Config, name string, opts ...OpOption) ([]Instance, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	a, err := GetASG(ctx, cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	instances := filterInstances(a.Instances, ret.lifecycleStates)
+	logutil.S().Infow("listed instances", "asg", name, "instances", len(instances))
+	return instances, nil
+}
+
+// Sets (or clears) the scale-in protection of the instances in the Auto Scaling Group,
+// so the group does not terminate them when scaling in.
+// ref. https://docs.aws.amazon.com/autoscaling/ec2/userguide/ec2-auto-scaling-instance-protection.html
+func SetInstanceProtection(ctx context.Context, cfg aws.Config, name string, instanceIDs []string, protected bool) error {
+	logutil.S().Infow("setting instance protection", "asg", name, "instanceIDs", instanceIDs, "protected", protected)
+	cli := aws_asg_v2.NewFromConfig(cfg)
+
+	// ref. https://docs.aws.amazon.com/autoscaling/ec2/APIReference/API_SetInstanceProtection.html
+	for ids := instanceIDs; len(ids) > 0; {
+		n := min(len(ids), 50)
+		_, err := cli.SetInstanceProtection(ctx, &aws_asg_v2.SetInstanceProtectionInput{
+			AutoScalingGroupName: aws.String(name),
+			InstanceIds:          ids[:n],
+			ProtectedFromScaleIn: aws.Bool(protected),
+		})
+		if err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+
+	logutil.S().Infow("successfully set instance protection", "asg", name, "instances", len(instanceIDs), "protected", protected)
+	return nil
+}
+
+func filterInstances(instances []Instance, states map[string]struct{}) []Instance {
+	filtered := make([]Instance, 0, len(instances))
+	for _, inst := range instances {
+		if len(states) > 0 {
+			if _, ok := states[inst.LifecycleState]; !ok {
+				continue
+			}
+		}
+		filtered = append(filtered, inst)
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].ID < filtered[j].ID
+	})
+	return filtered
+}
+
+func convertASG(raw aws_asg_v2_types.AutoScalingGroup) ASG {
+	a := ASG{
+		Name:              aws.ToString(raw.AutoScalingGroupName),
+		ARN:               aws.ToString(raw.AutoScalingGroupARN),
+		MinSize:           aws.ToInt32(raw.MinSize),
+		MaxSize:           aws.ToInt32(raw.MaxSize),
+		DesiredCapacity:   aws.ToInt32(raw.DesiredCapacity),
+		AvailabilityZones: raw.AvailabilityZones,
+		Status:            aws.ToString(raw.Status),
+		Instances:         make([]Instance, 0, len(raw.Instances)),
+		Tags:              make(map[string]string, len(raw.Tags)),
+	}
+	for _, inst := range raw.Instances {
+		a.Instances = append(a.Instances, Instance{
+			ID:                   aws.ToString(inst.InstanceId),
+			AvailabilityZone:     aws.ToString(inst.AvailabilityZone),
+			InstanceType:         aws.ToString(inst.InstanceType),
+			HealthStatus:         aws.ToString(inst.HealthStatus),
+			LifecycleState:       string(inst.LifecycleState),
+			ProtectedFromScaleIn: aws.ToBool(inst.ProtectedFromScaleIn),
+		})
+	}
+	for _, tg := range raw.Tags {
+		a.Tags[aws.ToString(tg.Key)] = aws.ToString(tg.Value)
+	}
+	return a
+}
+
+func convertActivity(raw aws_asg_v2_types.Activity) Activity {
+	return Activity{
+		ID:            aws.ToString(raw.ActivityId),
+		Description:   aws.ToString(raw.Description),
+		Cause:         aws.ToString(raw.Cause),
+		StatusCode:    string(raw.StatusCode),
+		StatusMessage: aws.ToString(raw.StatusMessage),
+		Progress:      aws.ToInt32(raw.Progress),
+		StartTime:     aws.ToTime(raw.StartTime),
+		EndTime:       aws.ToTime(raw.EndTime),
+	}
+}
@@ -0,0 +1,50 @@
+package asg
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_asg_v2_types "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+)
+
+func TestConvertASG(t *testing.T) {
+	a := convertASG(aws_asg_v2_types.AutoScalingGroup{
+		AutoScalingGroupName: aws.String("my-asg"),
+		MinSize:              aws.Int32(1),
+		MaxSize:              aws.Int32(3),
+		DesiredCapacity:      aws.Int32(2),
+		Instances: []aws_asg_v2_types.Instance{
+			{InstanceId: aws.String("i-1"), LifecycleState: aws_asg_v2_types.LifecycleStateInService, ProtectedFromScaleIn: aws.Bool(true)},
+			{InstanceId: aws.String("i-0"), LifecycleState: aws_asg_v2_types.LifecycleStatePending},
+		},
+		Tags: []aws_asg_v2_types.TagDescription{
+			{Key: aws.String("Name"), Value: aws.String("my-asg")},
+		},
+	})
+	if a.Name != "my-asg" || a.DesiredCapacity != 2 || len(a.Instances) != 2 || a.Tags["Name"] != "my-asg" {
+		t.Fatalf("unexpected asg %+v", a)
+	}
+	if !a.Instances[0].ProtectedFromScaleIn || a.Instances[1].ProtectedFromScaleIn {
+		t.Fatalf("unexpected instances %+v", a.Instances)
+	}
+}
+
+func TestFilterInstances(t *testing.T) {
+	instances := []Instance{
+		{ID: "i-2", LifecycleState: "InService"},
+		{ID: "i-0", LifecycleState: "Pending"},
+		{ID: "i-1", LifecycleState: "InService"},
+	}
+
+	all := filterInstances(instances, nil)
+	if len(all) != 3 || all[0].ID != "i-0" || all[2].ID != "i-2" {
+		t.Fatalf("unexpected instances %+v", all)
+	}
+
+	op := &Op{}
+	WithLifecycleStates("InService")(op)
+	inService := filterInstances(instances, op.lifecycleStates)
+	if len(inService) != 2 || inService[0].ID != "i-1" || inService[1].ID != "i-2" {
+		t.Fatalf("unexpected instances %+v", inService)
+	}
+}
@@ -0,0 +1,120 @@
+package asg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_asg_v2 "github.com/aws/aws-sdk-go-v2/service/autoscaling"
+)
+
+// Lifecycle action results.
+// ref. https://docs.aws.amazon.com/autoscaling/ec2/APIReference/API_CompleteLifecycleAction.html
+const (
+	LifecycleActionContinue = "CONTINUE"
+	LifecycleActionAbandon  = "ABANDON"
+)
+
+const defaultHeartbeatInterval = time.Minute
+
+// Returned when the instance is not in any Auto Scaling Group.
+var ErrInstanceNotInASG = errors.New("instance not in any auto scaling group")
+
+// Finds the name of the Auto Scaling Group that the instance belongs to.
+func FindASGName(ctx context.Context, cfg aws.Config, instanceID string) (string, error) {
+	cli := aws_asg_v2.NewFromConfig(cfg)
+	out, err := cli.DescribeAutoScalingInstances(ctx, &aws_asg_v2.DescribeAutoScalingInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(out.AutoScalingInstances) == 0 {
+		return "", ErrInstanceNotInASG
+	}
+	return aws.ToString(out.AutoScalingInstances[0].AutoScalingGroupName), nil
+}
+
+// Completes the lifecycle action of the instance with the result ("CONTINUE" or "ABANDON"),
+// so the Auto Scaling Group proceeds without waiting for the hook timeout.
+func CompleteLifecycleAction(ctx context.Context, cfg aws.Config, asgName string, hookName string, instanceID string, result string) error {
+	switch result {
+	case LifecycleActionContinue, LifecycleActionAbandon:
+	default:
+		return fmt.Errorf("invalid lifecycle action result %q", result)
+	}
+
+	logutil.S().Infow("completing lifecycle action", "asg", asgName, "hook", hookName, "instanceID", instanceID, "result", result)
+	cli := aws_asg_v2.NewFromConfig(cfg)
+	_, err := cli.CompleteLifecycleAction(ctx, &aws_asg_v2.CompleteLifecycleActionInput{
+		AutoScalingGroupName:  aws.String(asgName),
+		LifecycleHookName:     aws.String(hookName),
+		InstanceId:            aws.String(instanceID),
+		LifecycleActionResult: aws.String(result),
+	})
+	if err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully completed lifecycle action", "asg", asgName, "hook", hookName, "instanceID", instanceID)
+	return nil
+}
+
+// Records the heartbeat of the lifecycle action of the instance,
+// to extend the hook timeout by its heartbeat timeout.
+func RecordLifecycleHeartbeat(ctx context.Context, cfg aws.Config, asgName string, hookName string, instanceID string) error {
+	cli := aws_asg_v2.NewFromConfig(cfg)
+	_, err := cli.RecordLifecycleActionHeartbeat(ctx, &aws_asg_v2.RecordLifecycleActionHeartbeatInput{
+		AutoScalingGroupName: aws.String(asgName),
+		LifecycleHookName:    aws.String(hookName),
+		InstanceId:           aws.String(instanceID),
+	})
+	return err
+}
+
+// Records the lifecycle heartbeats in the background while the long-running routine
+// (e.g., snapshot and detach on termination) executes, until the returned stop function
+// is called or the context is done. Use "WithInterval" for the heartbeat interval
+// (default 1 minute), which must be shorter than the hook heartbeat timeout.
+// Failed heartbeats are logged and retried on the next interval.
+func StartLifecycleHeartbeat(ctx context.Context, cfg aws.Config, asgName string, hookName string, instanceID string, opts ...OpOption) (stop func()) {
+	ret := &Op{interval: defaultHeartbeatInterval}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("starting lifecycle heartbeat", "asg", asgName, "hook", hookName, "instanceID", instanceID, "interval", ret.interval)
+	ctx, cancel := context.WithCancel(ctx)
+	donec := make(chan struct{})
+	go func() {
+		defer close(donec)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ret.interval):
+			}
+
+			hctx, hcancel := context.WithTimeout(ctx, 30*time.Second)
+			err := RecordLifecycleHeartbeat(hctx, cfg, asgName, hookName, instanceID)
+			hcancel()
+			if err != nil {
+				logutil.S().Warnw("failed to record lifecycle heartbeat", "asg", asgName, "hook", hookName, "error", err)
+				continue
+			}
+			logutil.S().Infow("recorded lifecycle heartbeat", "asg", asgName, "hook", hookName)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-donec
+			logutil.S().Infow("stopped lifecycle heartbeat", "asg", asgName, "hook", hookName)
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package asg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestCompleteLifecycleActionInvalidResult(t *testing.T) {
+	if err := CompleteLifecycleAction(context.Background(), aws.Config{}, "my-asg", "my-hook", "i-0", "RETRY"); err == nil {
+		t.Fatal("expected error for invalid result")
+	}
+}
@@ -0,0 +1,182 @@
+package asg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Represents the ordinal claimed by the instance with the instance tag.
+type OrdinalClaim struct {
+	InstanceID string    `json:"instance_id"`
+	LaunchTime time.Time `json:"launch_time"`
+	Ordinal    int       `json:"ordinal"`
+}
+
+// Returned when all the ordinals are claimed by the other instances
+// (e.g., the replaced instance is still shutting down).
+var ErrNoFreeOrdinal = errors.New("no free ordinal")
+
+const defaultOrdinalInterval = 10 * time.Second
+
+// Claims the stable ordinal (0 to size-1) for the instance in the ASG, with the instance tag
+// as the lease. The instance keeps its ordinal if already claimed (e.g., on reboot),
+// otherwise claims the lowest ordinal not held by the other running instances
+// (e.g., the ordinal freed by the terminated instance it replaces).
+// After writing the tag, it waits for the interval and re-lists the instances,
+// and retries with another ordinal if the concurrent claim by another instance wins.
+// If the size is 0, the ASG desired capacity is used.
+// Use "WithInterval" for the settle and retry interval (default 10 seconds).
+func ClaimOrdinal(ctx context.Context, cfg aws.Config, asgName string, instanceID string, tagKey string, size int, opts ...OpOption) (int, error) {
+	ret := &Op{interval: defaultOrdinalInterval}
+	ret.applyOpts(opts)
+
+	if size == 0 {
+		a, err := GetASG(ctx, cfg, asgName)
+		if err != nil {
+			return -1, err
+		}
+		size = int(a.DesiredCapacity)
+	}
+	if size <= 0 {
+		return -1, fmt.Errorf("invalid ordinal size %d", size)
+	}
+	logutil.S().Infow("claiming ordinal", "asg", asgName, "instanceID", instanceID, "tagKey", tagKey, "size", size)
+
+	ordinal := -1
+	err := ec2.WaitUntil(ctx, fmt.Sprintf("ordinal for %s in %s", instanceID, asgName), func(ctx context.Context) (bool, string, error) {
+		claims, err := ListOrdinalClaims(ctx, cfg, asgName, tagKey)
+		if err != nil {
+			return false, "", err
+		}
+		if cur, ok := findOrdinal(claims, instanceID); ok && cur < size && ownsOrdinal(claims, instanceID, cur) {
+			ordinal = cur
+			return true, fmt.Sprintf("holding ordinal %d", cur), nil
+		}
+
+		next, ok := freeOrdinal(claims, instanceID, size)
+		if !ok {
+			return false, "", ErrNoFreeOrdinal
+		}
+		if err = ec2.CreateTags(ctx, cfg, []string{instanceID}, map[string]string{tagKey: strconv.Itoa(next)}); err != nil {
+			return false, "", err
+		}
+
+		// let the concurrent claims land, before checking the winner
+		select {
+		case <-ctx.Done():
+			return false, "", ctx.Err()
+		case <-time.After(ret.interval):
+		}
+		claims, err = ListOrdinalClaims(ctx, cfg, asgName, tagKey)
+		if err != nil {
+			return false, "", err
+		}
+		if !ownsOrdinal(claims, instanceID, next) {
+			return false, fmt.Sprintf("lost ordinal %d to another instance", next), nil
+		}
+		ordinal = next
+		return true, fmt.Sprintf("claimed ordinal %d", next), nil
+	}, ec2.WithInterval(ret.interval))
+	if err != nil {
+		return -1, err
+	}
+
+	logutil.S().Infow("successfully claimed ordinal", "asg", asgName, "instanceID", instanceID, "ordinal", ordinal)
+	return ordinal, nil
+}
+
+// Lists the ordinals claimed by the running (or pending) instances in the ASG,
+// sorted by the ordinal with the winner first.
+// The instances without the tag or with the malformed tag value are skipped.
+func ListOrdinalClaims(ctx context.Context, cfg aws.Config, asgName string, tagKey string) ([]OrdinalClaim, error) {
+	instances, err := ec2.ListInstancesByASG(ctx, cfg, asgName, ec2.WithFilters(map[string][]string{
+		"instance-state-name": {
+			string(aws_ec2_v2_types.InstanceStateNamePending),
+			string(aws_ec2_v2_types.InstanceStateNameRunning),
+		},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	claims := make([]OrdinalClaim, 0, len(instances))
+	for _, inst := range instances {
+		for _, tg := range inst.Tags {
+			if aws.ToString(tg.Key) != tagKey {
+				continue
+			}
+			n, err := strconv.Atoi(aws.ToString(tg.Value))
+			if err != nil || n < 0 {
+				logutil.S().Warnw("skipping malformed ordinal tag", "instanceID", aws.ToString(inst.InstanceId), "value", aws.ToString(tg.Value))
+				break
+			}
+			claims = append(claims, OrdinalClaim{
+				InstanceID: aws.ToString(inst.InstanceId),
+				LaunchTime: aws.ToTime(inst.LaunchTime),
+				Ordinal:    n,
+			})
+			break
+		}
+	}
+	sortOrdinalClaims(claims)
+	return claims, nil
+}
+
+// Sorts the claims by the ordinal, and the winner first for the same ordinal:
+// the instance launched earlier, then the lower instance ID.
+func sortOrdinalClaims(claims []OrdinalClaim) {
+	sort.SliceStable(claims, func(i, j int) bool {
+		if claims[i].Ordinal != claims[j].Ordinal {
+			return claims[i].Ordinal < claims[j].Ordinal
+		}
+		if !claims[i].LaunchTime.Equal(claims[j].LaunchTime) {
+			return claims[i].LaunchTime.Before(claims[j].LaunchTime)
+		}
+		return claims[i].InstanceID < claims[j].InstanceID
+	})
+}
+
+func findOrdinal(claims []OrdinalClaim, instanceID string) (int, bool) {
+	for _, c := range claims {
+		if c.InstanceID == instanceID {
+			return c.Ordinal, true
+		}
+	}
+	return -1, false
+}
+
+// Returns true if the instance wins the ordinal among the sorted claims.
+func ownsOrdinal(claims []OrdinalClaim, instanceID string, ordinal int) bool {
+	for _, c := range claims {
+		if c.Ordinal == ordinal {
+			return c.InstanceID == instanceID
+		}
+	}
+	return false
+}
+
+// Returns the lowest ordinal not claimed by the other instances.
+func freeOrdinal(claims []OrdinalClaim, instanceID string, size int) (int, bool) {
+	taken := make(map[int]struct{}, len(claims))
+	for _, c := range claims {
+		if c.InstanceID != instanceID {
+			taken[c.Ordinal] = struct{}{}
+		}
+	}
+	for i := 0; i < size; i++ {
+		if _, ok := taken[i]; !ok {
+			return i, true
+		}
+	}
+	return -1, false
+}
@@ -0,0 +1,46 @@
+package asg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOrdinalClaims(t *testing.T) {
+	now := time.Now()
+	claims := []OrdinalClaim{
+		{InstanceID: "i-2", LaunchTime: now, Ordinal: 1},
+		{InstanceID: "i-3", LaunchTime: now.Add(time.Minute), Ordinal: 0},
+		{InstanceID: "i-1", LaunchTime: now, Ordinal: 0},
+		{InstanceID: "i-0", LaunchTime: now.Add(time.Minute), Ordinal: 1},
+	}
+	sortOrdinalClaims(claims)
+
+	// earlier launch wins, then the lower instance ID
+	if !ownsOrdinal(claims, "i-1", 0) || ownsOrdinal(claims, "i-3", 0) {
+		t.Fatalf("unexpected owner of ordinal 0 %+v", claims)
+	}
+	if !ownsOrdinal(claims, "i-2", 1) || ownsOrdinal(claims, "i-0", 1) {
+		t.Fatalf("unexpected owner of ordinal 1 %+v", claims)
+	}
+	if ownsOrdinal(claims, "i-1", 2) {
+		t.Fatal("unexpected owner of unclaimed ordinal 2")
+	}
+
+	if n, ok := findOrdinal(claims, "i-3"); !ok || n != 0 {
+		t.Fatalf("unexpected ordinal %d, %v", n, ok)
+	}
+	if _, ok := findOrdinal(claims, "i-9"); ok {
+		t.Fatal("unexpected ordinal for unknown instance")
+	}
+
+	// the lost claim of the instance itself is not taken
+	if n, ok := freeOrdinal(claims, "i-3", 3); !ok || n != 2 {
+		t.Fatalf("unexpected free ordinal %d, %v", n, ok)
+	}
+	if _, ok := freeOrdinal(claims, "i-3", 2); ok {
+		t.Fatal("expected no free ordinal")
+	}
+	if n, ok := freeOrdinal(claims[2:], "i-9", 3); !ok || n != 0 {
+		t.Fatalf("unexpected free ordinal %d, %v", n, ok)
+	}
+}
@@ -0,0 +1,187 @@
+package asg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_asg_v2 "github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	aws_asg_v2_types "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+)
+
+// Represents the status of the instance refresh.
+type RefreshStatus struct {
+	ID                 string    `json:"id"`
+	ASGName            string    `json:"asg_name"`
+	Status             string    `json:"status"`
+	StatusReason       string    `json:"status_reason,omitempty"`
+	PercentageComplete int32     `json:"percentage_complete"`
+	InstancesToUpdate  int32     `json:"instances_to_update"`
+	StartTime          time.Time `json:"start_time"`
+	EndTime            time.Time `json:"end_time,omitempty"`
+}
+
+// Returns true if the instance refresh is no longer in progress.
+func (s RefreshStatus) Done() bool {
+	switch aws_asg_v2_types.InstanceRefreshStatus(s.Status) {
+	case aws_asg_v2_types.InstanceRefreshStatusSuccessful,
+		aws_asg_v2_types.InstanceRefreshStatusFailed,
+		aws_asg_v2_types.InstanceRefreshStatusCancelled,
+		aws_asg_v2_types.InstanceRefreshStatusRollbackFailed,
+		aws_asg_v2_types.InstanceRefreshStatusRollbackSuccessful:
+		return true
+	}
+	return false
+}
+
+// Returned when the instance refresh does not exist.
+var ErrRefreshNotFound = errors.New("instance refresh not found")
+
+// Returned when the instance refresh ends without success (e.g., failed, cancelled, or rolled back).
+var ErrRefreshFailed = errors.New("instance refresh failed")
+
+const defaultRefreshInterval = 30 * time.Second
+
+// Starts the rolling instance refresh of the Auto Scaling Group, and returns the refresh ID.
+// Use "WithLaunchTemplate" to roll out the new launch template (e.g., the new image),
+// and "WithMinHealthyPercentage", "WithInstanceWarmup", "WithSkipMatching", and "WithAutoRollback"
+// for the refresh preferences.
+// ref. https://docs.aws.amazon.com/autoscaling/ec2/userguide/asg-instance-refresh.html
+func StartInstanceRefresh(ctx context.Context, cfg aws.Config, asgName string, opts ...OpOption) (string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	input, err := buildStartInstanceRefreshInput(asgName, ret)
+	if err != nil {
+		return "", err
+	}
+
+	logutil.S().Infow("starting instance refresh",
+		"asg", asgName,
+		"launchTemplateID", ret.launchTemplateID,
+		"launchTemplateVersion", ret.launchTemplateVersion,
+		"minHealthyPercentage", ret.minHealthyPercentage,
+		"skipMatching", ret.skipMatching,
+	)
+	cli := aws_asg_v2.NewFromConfig(cfg)
+	out, err := cli.StartInstanceRefresh(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	id := aws.ToString(out.InstanceRefreshId)
+	logutil.S().Infow("successfully started instance refresh", "asg", asgName, "refreshID", id)
+	return id, nil
+}
+
+// Describes the status of the instance refresh.
+// If the refresh ID is empty, the most recent instance refresh of the group is described.
+func DescribeInstanceRefreshStatus(ctx context.Context, cfg aws.Config, asgName string, refreshID string) (RefreshStatus, error) {
+	input := &aws_asg_v2.DescribeInstanceRefreshesInput{
+		AutoScalingGroupName: aws.String(asgName),
+		MaxRecords:           aws.Int32(1),
+	}
+	if refreshID != "" {
+		input.InstanceRefreshIds = []string{refreshID}
+	}
+
+	cli := aws_asg_v2.NewFromConfig(cfg)
+	out, err := cli.DescribeInstanceRefreshes(ctx, input)
+	if err != nil {
+		return RefreshStatus{}, err
+	}
+	if len(out.InstanceRefreshes) == 0 {
+		return RefreshStatus{}, ErrRefreshNotFound
+	}
+	return convertRefresh(out.InstanceRefreshes[0]), nil
+}
+
+// Waits until the instance refresh completes, polling its status with the interval
+// set by "WithInterval" (default 30 seconds), and reports each status to "WithProgressFunc".
+// Returns the last status, with "ErrRefreshFailed" if the refresh ends without success.
+func WaitForRefreshComplete(ctx context.Context, cfg aws.Config, asgName string, refreshID string, opts ...OpOption) (RefreshStatus, error) {
+	ret := &Op{interval: defaultRefreshInterval}
+	ret.applyOpts(opts)
+
+	var last RefreshStatus
+	err := ec2.WaitUntil(ctx, fmt.Sprintf("instance refresh %s in %s", refreshID, asgName), func(ctx context.Context) (bool, string, error) {
+		st, err := DescribeInstanceRefreshStatus(ctx, cfg, asgName, refreshID)
+		if err != nil {
+			if errors.Is(err, ErrRefreshNotFound) {
+				return false, "", fmt.Errorf("%w: %w", ec2.ErrStopWait, err)
+			}
+			return false, "", err
+		}
+		last = st
+		if ret.progressFunc != nil {
+			ret.progressFunc(st)
+		}
+
+		progress := fmt.Sprintf("%s (%d%% complete)", st.Status, st.PercentageComplete)
+		if !st.Done() {
+			return false, progress, nil
+		}
+		if st.Status != string(aws_asg_v2_types.InstanceRefreshStatusSuccessful) {
+			return false, progress, fmt.Errorf("%w: %w (%s %q)", ec2.ErrStopWait, ErrRefreshFailed, st.Status, st.StatusReason)
+		}
+		return true, progress, nil
+	}, ec2.WithInterval(ret.interval))
+	return last, err
+}
+
+func buildStartInstanceRefreshInput(asgName string, op *Op) (*aws_asg_v2.StartInstanceRefreshInput, error) {
+	if op.minHealthyPercentage < 0 || op.minHealthyPercentage > 100 {
+		return nil, fmt.Errorf("invalid min healthy percentage %d", op.minHealthyPercentage)
+	}
+	if op.launchTemplateID == "" && op.launchTemplateVersion != "" {
+		return nil, errors.New("launch template version requires the launch template ID")
+	}
+
+	prefs := &aws_asg_v2_types.RefreshPreferences{
+		AutoRollback: aws.Bool(op.autoRollback),
+		SkipMatching: aws.Bool(op.skipMatching),
+	}
+	if op.minHealthyPercentage > 0 {
+		prefs.MinHealthyPercentage = aws.Int32(op.minHealthyPercentage)
+	}
+	if op.instanceWarmup > 0 {
+		prefs.InstanceWarmup = aws.Int32(op.instanceWarmup)
+	}
+
+	input := &aws_asg_v2.StartInstanceRefreshInput{
+		AutoScalingGroupName: aws.String(asgName),
+		Strategy:             aws_asg_v2_types.RefreshStrategyRolling,
+		Preferences:          prefs,
+	}
+	if op.launchTemplateID != "" {
+		version := op.launchTemplateVersion
+		if version == "" {
+			version = "$Latest"
+		}
+		input.DesiredConfiguration = &aws_asg_v2_types.DesiredConfiguration{
+			LaunchTemplate: &aws_asg_v2_types.LaunchTemplateSpecification{
+				LaunchTemplateId: aws.String(op.launchTemplateID),
+				Version:          aws.String(version),
+			},
+		}
+	}
+	return input, nil
+}
+
+func convertRefresh(raw aws_asg_v2_types.InstanceRefresh) RefreshStatus {
+	return RefreshStatus{
+		ID:                 aws.ToString(raw.InstanceRefreshId),
+		ASGName:            aws.ToString(raw.AutoScalingGroupName),
+		Status:             string(raw.Status),
+		StatusReason:       aws.ToString(raw.StatusReason),
+		PercentageComplete: aws.ToInt32(raw.PercentageComplete),
+		InstancesToUpdate:  aws.ToInt32(raw.InstancesToUpdate),
+		StartTime:          aws.ToTime(raw.StartTime),
+		EndTime:            aws.ToTime(raw.EndTime),
+	}
+}
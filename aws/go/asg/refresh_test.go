@@ -0,0 +1,65 @@
+package asg
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_asg_v2_types "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+)
+
+func TestRefreshStatusDone(t *testing.T) {
+	tt := []struct {
+		status string
+		done   bool
+	}{
+		{status: "Pending", done: false},
+		{status: "InProgress", done: false},
+		{status: "Baking", done: false},
+		{status: "RollbackInProgress", done: false},
+		{status: "Successful", done: true},
+		{status: "Failed", done: true},
+		{status: "Cancelled", done: true},
+		{status: "RollbackSuccessful", done: true},
+	}
+	for i, tv := range tt {
+		if (RefreshStatus{Status: tv.status}).Done() != tv.done {
+			t.Fatalf("#%d: expected done %v for %q", i, tv.done, tv.status)
+		}
+	}
+}
+
+func TestBuildStartInstanceRefreshInput(t *testing.T) {
+	op := &Op{}
+	WithLaunchTemplate("lt-123", "")(op)
+	WithMinHealthyPercentage(50)(op)
+	WithSkipMatching(true)(op)
+	input, err := buildStartInstanceRefreshInput("my-asg", op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt := input.DesiredConfiguration.LaunchTemplate
+	if aws.ToString(lt.LaunchTemplateId) != "lt-123" || aws.ToString(lt.Version) != "$Latest" {
+		t.Fatalf("unexpected launch template %+v", lt)
+	}
+	if aws.ToInt32(input.Preferences.MinHealthyPercentage) != 50 || !aws.ToBool(input.Preferences.SkipMatching) {
+		t.Fatalf("unexpected preferences %+v", input.Preferences)
+	}
+	if input.Preferences.InstanceWarmup != nil {
+		t.Fatalf("unexpected instance warmup %d", aws.ToInt32(input.Preferences.InstanceWarmup))
+	}
+
+	input, err = buildStartInstanceRefreshInput("my-asg", &Op{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.DesiredConfiguration != nil || input.Strategy != aws_asg_v2_types.RefreshStrategyRolling {
+		t.Fatalf("unexpected input %+v", input)
+	}
+
+	if _, err = buildStartInstanceRefreshInput("my-asg", &Op{launchTemplateVersion: "3"}); err == nil {
+		t.Fatal("expected error for the version without the launch template ID")
+	}
+	if _, err = buildStartInstanceRefreshInput("my-asg", &Op{minHealthyPercentage: 101}); err == nil {
+		t.Fatal("expected error for the invalid min healthy percentage")
+	}
+}
@@ -0,0 +1,40 @@
+package asg
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Returns true if the lifecycle state is in the warm pool (e.g., "Warmed:Stopped").
+// ref. https://docs.aws.amazon.com/autoscaling/ec2/userguide/warm-pool-instance-lifecycle.html
+func IsWarmedState(state string) bool {
+	return strings.HasPrefix(state, "Warmed:")
+}
+
+// Returns true if the warmed instance is to be stopped or hibernated in the warm pool,
+// so the resources provisioned now are idle (and may be charged) until it enters service.
+func IsWarmedIdleState(state string) bool {
+	return state == "Warmed:Stopped" || state == "Warmed:Hibernated"
+}
+
+// Returns true if the instance was moved from the warm pool into the Auto Scaling Group
+// (e.g., stopped and then started), in the recent scaling activities.
+func LaunchedFromWarmPool(ctx context.Context, cfg aws.Config, asgName string, instanceID string) (bool, error) {
+	acts, err := DescribeScalingActivities(ctx, cfg, asgName)
+	if err != nil {
+		return false, err
+	}
+	return hasWarmPoolLaunch(acts, instanceID), nil
+}
+
+// e.g., "Launching a new EC2 instance from warm pool: i-0123"
+func hasWarmPoolLaunch(acts []Activity, instanceID string) bool {
+	for _, act := range acts {
+		if strings.Contains(act.Description, "from warm pool") && strings.HasSuffix(act.Description, instanceID) {
+			return true
+		}
+	}
+	return false
+}
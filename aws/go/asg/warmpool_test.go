@@ -0,0 +1,40 @@
+package asg
+
+import "testing"
+
+func TestWarmedState(t *testing.T) {
+	tt := []struct {
+		state  string
+		warmed bool
+		idle   bool
+	}{
+		{state: "InService", warmed: false, idle: false},
+		{state: "Pending:Wait", warmed: false, idle: false},
+		{state: "Warmed:Running", warmed: true, idle: false},
+		{state: "Warmed:Stopped", warmed: true, idle: true},
+		{state: "Warmed:Hibernated", warmed: true, idle: true},
+		{state: "", warmed: false, idle: false},
+	}
+	for i, tv := range tt {
+		if IsWarmedState(tv.state) != tv.warmed || IsWarmedIdleState(tv.state) != tv.idle {
+			t.Fatalf("#%d: unexpected result for %q", i, tv.state)
+		}
+	}
+}
+
+func TestHasWarmPoolLaunch(t *testing.T) {
+	acts := []Activity{
+		{Description: "Launching a new EC2 instance into warm pool: i-0"},
+		{Description: "Launching a new EC2 instance from warm pool: i-1"},
+		{Description: "Launching a new EC2 instance: i-2"},
+	}
+	if hasWarmPoolLaunch(acts, "i-0") {
+		t.Fatal("unexpected warm pool launch for the instance launched into the warm pool")
+	}
+	if !hasWarmPoolLaunch(acts, "i-1") {
+		t.Fatal("expected warm pool launch")
+	}
+	if hasWarmPoolLaunch(acts, "i-2") {
+		t.Fatal("unexpected warm pool launch")
+	}
+}
@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	smithy_middleware "github.com/aws/smithy-go/middleware"
+)
+
+// Sets the deadline on each attempt of the API calls, inside the SDK retry middleware.
+func limitAttemptTimeout(awsCfg *aws_v2.Config, timeout time.Duration) {
+	awsCfg.APIOptions = append(awsCfg.APIOptions, func(stack *smithy_middleware.Stack) error {
+		return stack.Finalize.Insert(
+			smithy_middleware.FinalizeMiddlewareFunc("AttemptTimeout", func(ctx context.Context, in smithy_middleware.FinalizeInput, next smithy_middleware.FinalizeHandler) (smithy_middleware.FinalizeOutput, smithy_middleware.Metadata, error) {
+				actx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				out, md, err := next.HandleFinalize(actx, in)
+				if err != nil && errors.Is(actx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+					err = &attemptTimeoutError{Timeout: timeout, Err: err}
+				}
+				return out, md, err
+			}),
+			// per attempt, after the retry middleware
+			"Retry",
+			smithy_middleware.After,
+		)
+	})
+}
+
+// Returned when the API call attempt times out with "Config.AttemptTimeout".
+// Retried by the SDK retryer, unlike the canceled (or timed out) context of the call,
+// so it does not unwrap to the context error.
+type attemptTimeoutError struct {
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *attemptTimeoutError) Error() string {
+	return fmt.Sprintf("API call attempt timed out after %v (%v)", e.Timeout, e.Err)
+}
+
+func (e *attemptTimeoutError) RetryableError() bool { return true }
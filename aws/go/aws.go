@@ -4,17 +4,85 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_retry_v2 "github.com/aws/aws-sdk-go-v2/aws/retry"
 	config_v2 "github.com/aws/aws-sdk-go-v2/config"
+	stscreds_v2 "github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	aws_sts_v2 "github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
 type Config struct {
 	DebugAPICalls bool
 	Region        string
 
-	// TODO: support profile name
+	// Shared config profile to load the source credentials from (e.g., "network-admin"),
+	// before assuming the roles (leave empty for the default credential chain).
+	Profile string
+
+	// Role to assume with the source credentials via STS AssumeRole
+	// (e.g., to manage the EIPs in the shared network account).
+	// The session name is ignored without the role ARN.
+	RoleARN     string
+	ExternalID  string
+	SessionName string
+
+	// Roles to assume in order after "RoleARN", each with the credentials of the previous role.
+	RoleChain []AssumeRole
+
+	// Web identity token file and role to load the source credentials via STS AssumeRoleWithWebIdentity
+	// (e.g., the projected service account token on EKS with IRSA).
+	// If empty, "AWS_WEB_IDENTITY_TOKEN_FILE" and "AWS_ROLE_ARN" are used if both set.
+	WebIdentityTokenFile string
+	WebIdentityRoleARN   string
+
+	// Set true to log every API call with its duration, retries, and request ID.
+	// The retried (or throttled) API calls are always logged.
+	LogAPICalls bool
+	// Called with each API call made with the config (e.g., "APICallMetrics.Observe").
+	APICallHooks []APICallHook
+
+	// PEM file of the CA certificates to trust in addition to the system roots
+	// (e.g., the TLS-inspecting proxy CA in the regulated environments).
+	CABundle string
+	// Proxy URL to send the API calls via (e.g., "http://proxy.internal:3128").
+	// If empty, "HTTPS_PROXY" and "NO_PROXY" are used.
+	HTTPSProxy string
+
+	// Set true to use the FIPS 140-2 validated endpoints (e.g., "ec2-fips.us-east-1.amazonaws.com").
+	UseFIPSEndpoint bool
+	// Set true to use the dual-stack (IPv4 and IPv6) endpoints (e.g., "ec2.us-west-2.api.aws").
+	UseDualStackEndpoint bool
+
+	// Maximum number of attempts of each API call, including the first one,
+	// with the SDK standard retryer (if zero, the SDK default of 3 attempts).
+	RetryMaxAttempts int
+	// Maximum backoff between the retry attempts (if zero, the SDK default of 20 seconds).
+	RetryMaxBackoff time.Duration
+	// Timeout for each attempt of the API call (if zero, only bounded by the call context),
+	// so that a hung attempt is retried instead of taking the whole call deadline.
+	// Not for the streaming outputs (e.g., S3 GetObject body read after the call returns).
+	AttemptTimeout time.Duration
+}
+
+// Environment variables set by the EKS pod identity webhook for IRSA.
+// ref. https://docs.aws.amazon.com/eks/latest/userguide/iam-roles-for-service-accounts.html
+const (
+	EnvWebIdentityTokenFile = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	EnvRoleARN              = "AWS_ROLE_ARN"
+	EnvRoleSessionName      = "AWS_ROLE_SESSION_NAME"
+)
+
+// Represents the role to assume via STS AssumeRole.
+type AssumeRole struct {
+	RoleARN    string
+	ExternalID string
+	// Leave empty to use the SDK default session name.
+	SessionName string
+	// Leave zero to use the SDK default duration (15 minutes).
+	Duration time.Duration
 }
 
 func New(cfg *Config) (awsCfg aws_v2.Config, err error) {
@@ -28,6 +96,9 @@ func New(cfg *Config) (awsCfg aws_v2.Config, err error) {
 	optFns := []func(*config_v2.LoadOptions) error{
 		(func(*config_v2.LoadOptions) error)(config_v2.WithRegion(cfg.Region)),
 	}
+	if cfg.Profile != "" {
+		optFns = append(optFns, (func(*config_v2.LoadOptions) error)(config_v2.WithSharedConfigProfile(cfg.Profile)))
+	}
 	if cfg.DebugAPICalls {
 		lvl := aws_v2.LogSigning |
 			aws_v2.LogRetries |
@@ -38,12 +109,123 @@ func New(cfg *Config) (awsCfg aws_v2.Config, err error) {
 		optFns = append(optFns, (func(*config_v2.LoadOptions) error)(config_v2.WithClientLogMode(lvl)))
 	}
 
+	if cfg.UseFIPSEndpoint {
+		optFns = append(optFns, (func(*config_v2.LoadOptions) error)(config_v2.WithUseFIPSEndpoint(aws_v2.FIPSEndpointStateEnabled)))
+	}
+	if cfg.UseDualStackEndpoint {
+		optFns = append(optFns, (func(*config_v2.LoadOptions) error)(config_v2.WithUseDualStackEndpoint(aws_v2.DualStackEndpointStateEnabled)))
+	}
+	if cfg.RetryMaxAttempts > 0 || cfg.RetryMaxBackoff > 0 {
+		optFns = append(optFns, (func(*config_v2.LoadOptions) error)(config_v2.WithRetryer(func() aws_v2.Retryer {
+			return aws_retry_v2.NewStandard(func(o *aws_retry_v2.StandardOptions) {
+				if cfg.RetryMaxAttempts > 0 {
+					o.MaxAttempts = cfg.RetryMaxAttempts
+				}
+				if cfg.RetryMaxBackoff > 0 {
+					o.MaxBackoff = cfg.RetryMaxBackoff
+				}
+			})
+		})))
+	}
+	if cfg.CABundle != "" || cfg.HTTPSProxy != "" {
+		httpClient, err := newHTTPClient(cfg.CABundle, cfg.HTTPSProxy)
+		if err != nil {
+			return aws_v2.Config{}, err
+		}
+		optFns = append(optFns, (func(*config_v2.LoadOptions) error)(config_v2.WithHTTPClient(httpClient)))
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	awsCfg, err = config_v2.LoadDefaultConfig(ctx, optFns...)
 	cancel()
 	if err != nil {
 		return aws_v2.Config{}, fmt.Errorf("failed to load config %v", err)
 	}
+	instrumentAPICalls(&awsCfg, cfg.LogAPICalls, cfg.APICallHooks)
+	if cfg.AttemptTimeout > 0 {
+		limitAttemptTimeout(&awsCfg, cfg.AttemptTimeout)
+	}
 
+	tokenFile, roleARN, sessionName, err := cfg.webIdentity()
+	if err != nil {
+		return aws_v2.Config{}, err
+	}
+	if tokenFile != "" {
+		awsCfg.Credentials = webIdentityCredentials(awsCfg, tokenFile, roleARN, sessionName)
+	}
+
+	chain, err := cfg.roleChain()
+	if err != nil {
+		return aws_v2.Config{}, err
+	}
+	for _, role := range chain {
+		awsCfg.Credentials = assumeRoleCredentials(awsCfg, role)
+	}
 	return awsCfg, nil
 }
+
+// Returns the web identity token file, role ARN, and session name from the config,
+// or from the environment variables. Returns the empty token file if not configured.
+func (cfg *Config) webIdentity() (tokenFile string, roleARN string, sessionName string, err error) {
+	tokenFile, roleARN = cfg.WebIdentityTokenFile, cfg.WebIdentityRoleARN
+	if tokenFile == "" && roleARN == "" {
+		tokenFile, roleARN = os.Getenv(EnvWebIdentityTokenFile), os.Getenv(EnvRoleARN)
+		if tokenFile == "" || roleARN == "" {
+			return "", "", "", nil
+		}
+	}
+	if tokenFile == "" || roleARN == "" {
+		return "", "", "", errors.New("web identity requires both the token file and the role ARN")
+	}
+	return tokenFile, roleARN, os.Getenv(EnvRoleSessionName), nil
+}
+
+// Returns the roles to assume in order, with "RoleARN" first.
+func (cfg *Config) roleChain() ([]AssumeRole, error) {
+	chain := make([]AssumeRole, 0, len(cfg.RoleChain)+1)
+	if cfg.RoleARN != "" {
+		chain = append(chain, AssumeRole{
+			RoleARN:     cfg.RoleARN,
+			ExternalID:  cfg.ExternalID,
+			SessionName: cfg.SessionName,
+		})
+	} else if cfg.ExternalID != "" {
+		return nil, errors.New("external ID requires the role ARN")
+	}
+	for _, role := range cfg.RoleChain {
+		if role.RoleARN == "" {
+			return nil, errors.New("missing role ARN in the role chain")
+		}
+		chain = append(chain, role)
+	}
+	return chain, nil
+}
+
+// Returns the credentials of the role assumed with the web identity token, which is re-read
+// from the file on each refresh (e.g., the projected token rotated by the kubelet).
+// The credentials are cached and refreshed automatically before they expire.
+func webIdentityCredentials(awsCfg aws_v2.Config, tokenFile string, roleARN string, sessionName string) aws_v2.CredentialsProvider {
+	provider := stscreds_v2.NewWebIdentityRoleProvider(aws_sts_v2.NewFromConfig(awsCfg), roleARN, stscreds_v2.IdentityTokenFile(tokenFile), func(o *stscreds_v2.WebIdentityRoleOptions) {
+		if sessionName != "" {
+			o.RoleSessionName = sessionName
+		}
+	})
+	return aws_v2.NewCredentialsCache(provider)
+}
+
+// Returns the credentials of the assumed role, with the STS client signed by the current credentials.
+// The credentials are cached and refreshed automatically before they expire.
+func assumeRoleCredentials(awsCfg aws_v2.Config, role AssumeRole) aws_v2.CredentialsProvider {
+	provider := stscreds_v2.NewAssumeRoleProvider(aws_sts_v2.NewFromConfig(awsCfg), role.RoleARN, func(o *stscreds_v2.AssumeRoleOptions) {
+		if role.ExternalID != "" {
+			o.ExternalID = aws_v2.String(role.ExternalID)
+		}
+		if role.SessionName != "" {
+			o.RoleSessionName = role.SessionName
+		}
+		if role.Duration > 0 {
+			o.Duration = role.Duration
+		}
+	})
+	return aws_v2.NewCredentialsCache(provider)
+}
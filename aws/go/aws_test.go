@@ -2,9 +2,15 @@ package aws
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"os"
 	"testing"
 	"time"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	credentials_v2 "github.com/aws/aws-sdk-go-v2/credentials"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
 )
 
 func TestCreds(t *testing.T) {
@@ -34,3 +40,135 @@ func TestCreds(t *testing.T) {
 	t.Logf("access key: %d bytes", len(creds.AccessKeyID))
 	t.Logf("secret key: %d bytes", len(creds.SecretAccessKey))
 }
+
+func TestRoleChain(t *testing.T) {
+	cfg := &Config{
+		Region:     "us-east-1",
+		RoleARN:    "arn:aws:iam::111111111111:role/network",
+		ExternalID: "ext",
+		RoleChain: []AssumeRole{
+			{RoleARN: "arn:aws:iam::222222222222:role/eip-admin", SessionName: "eip"},
+		},
+	}
+	chain, err := cfg.roleChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 || chain[0].ExternalID != "ext" || chain[1].SessionName != "eip" {
+		t.Fatalf("unexpected chain %+v", chain)
+	}
+
+	if _, err = (&Config{Region: "us-east-1", ExternalID: "ext"}).roleChain(); err == nil {
+		t.Fatal("expected error for the external ID without the role ARN")
+	}
+	if _, err = (&Config{Region: "us-east-1", RoleChain: []AssumeRole{{}}}).roleChain(); err == nil {
+		t.Fatal("expected error for the empty role ARN")
+	}
+}
+
+func TestWebIdentity(t *testing.T) {
+	t.Setenv(EnvWebIdentityTokenFile, "")
+	t.Setenv(EnvRoleARN, "")
+	tokenFile, _, _, err := (&Config{Region: "us-east-1"}).webIdentity()
+	if err != nil || tokenFile != "" {
+		t.Fatalf("unexpected web identity %q (%v)", tokenFile, err)
+	}
+
+	t.Setenv(EnvWebIdentityTokenFile, "/var/run/secrets/eks.amazonaws.com/serviceaccount/token")
+	t.Setenv(EnvRoleARN, "arn:aws:iam::111111111111:role/irsa")
+	t.Setenv(EnvRoleSessionName, "my-pod")
+	tokenFile, roleARN, sessionName, err := (&Config{Region: "us-east-1"}).webIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenFile != "/var/run/secrets/eks.amazonaws.com/serviceaccount/token" || roleARN != "arn:aws:iam::111111111111:role/irsa" || sessionName != "my-pod" {
+		t.Fatalf("unexpected web identity %q %q %q", tokenFile, roleARN, sessionName)
+	}
+
+	if _, _, _, err = (&Config{Region: "us-east-1", WebIdentityRoleARN: "arn:aws:iam::111111111111:role/irsa"}).webIdentity(); err == nil {
+		t.Fatal("expected error for the role ARN without the token file")
+	}
+}
+
+type hostRecorder struct {
+	host string
+}
+
+var errRecorded = errors.New("recorded")
+
+func (r *hostRecorder) Do(req *http.Request) (*http.Response, error) {
+	r.host = req.URL.Host
+	return nil, errRecorded
+}
+
+func TestEndpointToggles(t *testing.T) {
+	for _, tv := range []struct {
+		cfg  Config
+		host string
+	}{
+		{Config{Region: "us-west-2"}, "ec2.us-west-2.amazonaws.com"},
+		{Config{Region: "us-gov-west-1", UseFIPSEndpoint: true}, "ec2.us-gov-west-1.amazonaws.com"},
+		{Config{Region: "us-east-1", UseFIPSEndpoint: true}, "ec2-fips.us-east-1.amazonaws.com"},
+		{Config{Region: "us-west-2", UseDualStackEndpoint: true}, "ec2.us-west-2.api.aws"},
+		{Config{Region: "us-west-2", UseFIPSEndpoint: true, UseDualStackEndpoint: true}, "ec2-fips.us-west-2.api.aws"},
+	} {
+		awsCfg, err := New(&tv.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := &hostRecorder{}
+		awsCfg.HTTPClient = rec
+		awsCfg.Credentials = credentials_v2.NewStaticCredentialsProvider("AKID", "SECRET", "")
+		awsCfg.RetryMaxAttempts = 1
+
+		_, err = aws_ec2_v2.NewFromConfig(awsCfg).DescribeRegions(context.Background(), &aws_ec2_v2.DescribeRegionsInput{AllRegions: aws_v2.Bool(true)})
+		if !errors.Is(err, errRecorded) {
+			t.Fatalf("expected the recorded error, got %v", err)
+		}
+		if rec.host != tv.host {
+			t.Fatalf("%+v: expected host %q, got %q", tv.cfg, tv.host, rec.host)
+		}
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	awsCfg, err := New(&Config{Region: "us-west-2", RetryMaxAttempts: 6, RetryMaxBackoff: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := awsCfg.Retryer().MaxAttempts(); v != 6 {
+		t.Fatalf("expected 6 max attempts, got %d", v)
+	}
+}
+
+// Blocks each request until the attempt context is done.
+type hangingClient struct {
+	attempts int
+}
+
+func (c *hangingClient) Do(req *http.Request) (*http.Response, error) {
+	c.attempts++
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestAttemptTimeout(t *testing.T) {
+	awsCfg, err := New(&Config{Region: "us-west-2", RetryMaxAttempts: 3, RetryMaxBackoff: 10 * time.Millisecond, AttemptTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := &hangingClient{}
+	awsCfg.HTTPClient = cli
+	awsCfg.Credentials = credentials_v2.NewStaticCredentialsProvider("AKID", "SECRET", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = aws_ec2_v2.NewFromConfig(awsCfg).DescribeRegions(ctx, &aws_ec2_v2.DescribeRegionsInput{})
+	var terr *attemptTimeoutError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected the attempt timeout error, got %v", err)
+	}
+	if cli.attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", cli.attempts)
+	}
+}
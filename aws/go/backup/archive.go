@@ -0,0 +1,316 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms of the archive.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Represents the created archive file.
+type ArchiveInfo struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Files  int    `json:"files"`
+}
+
+// Returns the archive file name for the compression (e.g., "data.tar.zst").
+func ArchiveName(compression string) (string, error) {
+	switch compression {
+	case CompressionGzip:
+		return "data.tar.gz", nil
+	case CompressionZstd:
+		return "data.tar.zst", nil
+	default:
+		return "", fmt.Errorf("unknown compression %q", compression)
+	}
+}
+
+// Archives the directory into the compressed tar file, with the paths relative to the directory.
+// The regular files, directories, and symlinks are archived, and the others (e.g., sockets) are skipped.
+// The size and the SHA256 checksum of the archive file are returned.
+func CreateArchive(dir string, dst string, compression string) (ArchiveInfo, error) {
+	logutil.S().Infow("creating archive", "dir", dir, "dst", dst, "compression", compression)
+
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(f, h)}
+	zw, err := newCompressWriter(cw, compression)
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+	tw := tar.NewWriter(zw)
+
+	files := 0
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		switch {
+		case fi.Mode().IsRegular(), fi.IsDir():
+		case fi.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		default:
+			logutil.S().Warnw("skipping non-regular file", "path", p, "mode", fi.Mode())
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, src)
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("failed to archive %q (%w)", p, err)
+		}
+		files++
+		return nil
+	})
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+	if err = tw.Close(); err != nil {
+		return ArchiveInfo{}, err
+	}
+	if err = zw.Close(); err != nil {
+		return ArchiveInfo{}, err
+	}
+	if err = f.Sync(); err != nil {
+		return ArchiveInfo{}, err
+	}
+
+	info := ArchiveInfo{Size: cw.n, SHA256: hex.EncodeToString(h.Sum(nil)), Files: files}
+	logutil.S().Infow("created archive", "dst", dst, "size", info.Size, "sha256", info.SHA256, "files", info.Files)
+	return info, nil
+}
+
+// Extracts the compressed tar file into the directory.
+// The entries escaping the directory (e.g., "../x"), the symlinks to the absolute paths
+// or outside the directory, and the entries under the symlinks are rejected.
+// Returns the number of the extracted regular files.
+func ExtractArchive(src string, dir string, compression string) (int, error) {
+	logutil.S().Infow("extracting archive", "src", src, "dir", dir, "compression", compression)
+
+	f, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	zr, err := newDecompressReader(f, compression)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	root := filepath.Clean(dir)
+
+	files := 0
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return files, err
+		}
+
+		p := filepath.Join(root, filepath.FromSlash(hdr.Name))
+		if p != root && !strings.HasPrefix(p, root+string(filepath.Separator)) {
+			return files, fmt.Errorf("archive entry %q escapes the directory %q", hdr.Name, dir)
+		}
+		if err = checkNoSymlinkParents(root, p); err != nil {
+			return files, fmt.Errorf("archive entry %q (%w)", hdr.Name, err)
+		}
+		mode := fs.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(p, mode|0700); err != nil {
+				return files, err
+			}
+
+		case tar.TypeReg:
+			if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				return files, err
+			}
+			// replace the existing symlink instead of writing through it
+			if fi, err := os.Lstat(p); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+				if err = os.Remove(p); err != nil {
+					return files, err
+				}
+			}
+			dst, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return files, err
+			}
+			_, err = io.Copy(dst, tr)
+			if cerr := dst.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return files, fmt.Errorf("failed to extract %q (%w)", hdr.Name, err)
+			}
+			if err = os.Chtimes(p, hdr.ModTime, hdr.ModTime); err != nil {
+				return files, err
+			}
+			files++
+
+		case tar.TypeSymlink:
+			if filepath.IsAbs(hdr.Linkname) {
+				return files, fmt.Errorf("archive entry %q links to the absolute path %q", hdr.Name, hdr.Linkname)
+			}
+			target := filepath.Join(filepath.Dir(p), filepath.FromSlash(hdr.Linkname))
+			if target != root && !strings.HasPrefix(target, root+string(filepath.Separator)) {
+				return files, fmt.Errorf("archive entry %q links to %q escaping the directory %q", hdr.Name, hdr.Linkname, dir)
+			}
+			if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				return files, err
+			}
+			os.Remove(p)
+			if err = os.Symlink(hdr.Linkname, p); err != nil {
+				return files, err
+			}
+
+		default:
+			logutil.S().Warnw("skipping unsupported archive entry", "name", hdr.Name, "type", hdr.Typeflag)
+		}
+	}
+
+	logutil.S().Infow("extracted archive", "src", src, "dir", dir, "files", files)
+	return files, nil
+}
+
+// Returns an error if any existing parent of the path under the root is a symlink,
+// so that the entries are never written through the symlinks (e.g., "x -> ../.." and "x/passwd").
+func checkNoSymlinkParents(root string, p string) error {
+	rel, err := filepath.Rel(root, filepath.Dir(p))
+	if err != nil || rel == "." {
+		return err
+	}
+	cur := root
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, elem)
+		fi, err := os.Lstat(cur)
+		if errors.Is(err, fs.ErrNotExist) {
+			// created as the directories by "os.MkdirAll"
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("parent %q is a symlink", cur)
+		}
+	}
+	return nil
+}
+
+// Returns the SHA256 checksum of the file.
+func FileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func newCompressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+}
+
+func newDecompressReader(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
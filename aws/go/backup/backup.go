@@ -0,0 +1,207 @@
+// Package backup implements the node data directory backups in S3.
+// Each backup is stored under "<asg>/<node>/<timestamp>/" with the compressed archive
+// and its manifest, which is uploaded last to mark the backup complete.
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/s3"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	ManifestName = "manifest.json"
+
+	// UTC timestamp in the backup prefix, sorted lexicographically.
+	TimestampFormat = "20060102T150405Z"
+)
+
+// Represents the backup manifest.
+type Manifest struct {
+	ASG         string      `json:"asg"`
+	Node        string      `json:"node"`
+	InstanceID  string      `json:"instance_id"`
+	DataDir     string      `json:"data_dir"`
+	Timestamp   time.Time   `json:"timestamp"`
+	Compression string      `json:"compression"`
+	ArchiveKey  string      `json:"archive_key"`
+	Archive     ArchiveInfo `json:"archive"`
+}
+
+// Represents the backup in S3.
+type Backup struct {
+	Prefix    string
+	Timestamp time.Time
+	// True if the manifest exists.
+	Complete bool
+}
+
+// Returns the prefix of the backups of the node (e.g., "my-asg/0/").
+func NodePrefix(asgName string, node string) string {
+	return path.Join(asgName, node) + "/"
+}
+
+// Returns the prefix of the backup (e.g., "my-asg/0/20240102T030405Z/").
+func BackupPrefix(asgName string, node string, ts time.Time) string {
+	return NodePrefix(asgName, node) + ts.UTC().Format(TimestampFormat) + "/"
+}
+
+// Archives the data directory and uploads it with the manifest, under the backup prefix
+// of the manifest ASG, node, and timestamp (the current time if zero).
+// The s3 options are applied to the uploads (e.g., "s3.WithSSEKMS").
+func Upload(ctx context.Context, cfg aws.Config, bucketName string, m Manifest, opts ...s3.OpOption) (Manifest, error) {
+	if m.ASG == "" || m.Node == "" {
+		return Manifest{}, fmt.Errorf("missing ASG %q or node %q", m.ASG, m.Node)
+	}
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+	m.Timestamp = m.Timestamp.UTC().Truncate(time.Second)
+	name, err := ArchiveName(m.Compression)
+	if err != nil {
+		return Manifest{}, err
+	}
+	pfx := BackupPrefix(m.ASG, m.Node, m.Timestamp)
+	m.ArchiveKey = pfx + name
+
+	tmpDir, err := os.MkdirTemp("", "backup")
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archivePath := filepath.Join(tmpDir, name)
+	m.Archive, err = CreateArchive(m.DataDir, archivePath, m.Compression)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err = s3.UploadFile(ctx, cfg, archivePath, bucketName, m.ArchiveKey, opts...); err != nil {
+		return Manifest{}, err
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+	manifestPath := filepath.Join(tmpDir, ManifestName)
+	if err = os.WriteFile(manifestPath, b, 0600); err != nil {
+		return Manifest{}, err
+	}
+	if err = s3.UploadFile(ctx, cfg, manifestPath, bucketName, pfx+ManifestName, opts...); err != nil {
+		return Manifest{}, err
+	}
+
+	logutil.S().Infow("uploaded backup", "bucket", bucketName, "prefix", pfx, "size", m.Archive.Size, "files", m.Archive.Files)
+	return m, nil
+}
+
+// Lists the backups of the node, the newest first.
+func ListBackups(ctx context.Context, cfg aws.Config, bucketName string, asgName string, node string) ([]Backup, error) {
+	pfx := NodePrefix(asgName, node)
+	objects, err := s3.ListObjects(ctx, cfg, bucketName, s3.WithPrefix(pfx))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(objects.Objects))
+	for _, obj := range objects.Objects {
+		keys = append(keys, aws.ToString(obj.Key))
+	}
+	return groupBackups(pfx, keys), nil
+}
+
+// Deletes the backups of the node beyond the newest "keep" complete backups (0 to keep all),
+// or older than "maxAge" (0 to disable), and the incomplete backups older than
+// the newest complete backup (e.g., the failed uploads). The newest complete backup is never deleted.
+// Returns the deleted backup prefixes.
+func Prune(ctx context.Context, cfg aws.Config, bucketName string, asgName string, node string, keep int, maxAge time.Duration) ([]string, error) {
+	backups, err := ListBackups(ctx, cfg, bucketName, asgName, node)
+	if err != nil {
+		return nil, err
+	}
+	prunable := selectPrunable(backups, keep, maxAge, time.Now())
+	logutil.S().Infow("pruning backups", "bucket", bucketName, "asg", asgName, "node", node, "backups", len(backups), "prunable", len(prunable))
+
+	pruned := make([]string, 0, len(prunable))
+	for _, pfx := range prunable {
+		if err = s3.DeleteObjects(ctx, cfg, bucketName, pfx); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, pfx)
+	}
+	return pruned, nil
+}
+
+// Groups the keys under the node prefix by the timestamp, the newest first.
+// The keys not under the timestamp prefix are ignored.
+func groupBackups(nodePrefix string, keys []string) []Backup {
+	byPrefix := make(map[string]*Backup)
+	for _, k := range keys {
+		ts, rest, ok := strings.Cut(strings.TrimPrefix(k, nodePrefix), "/")
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(TimestampFormat, ts)
+		if err != nil {
+			continue
+		}
+		pfx := nodePrefix + ts + "/"
+		b, ok := byPrefix[pfx]
+		if !ok {
+			b = &Backup{Prefix: pfx, Timestamp: t}
+			byPrefix[pfx] = b
+		}
+		if rest == ManifestName {
+			b.Complete = true
+		}
+	}
+
+	backups := make([]Backup, 0, len(byPrefix))
+	for _, b := range byPrefix {
+		backups = append(backups, *b)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
+	return backups
+}
+
+// Returns the prefixes of the backups to prune, from the backups sorted the newest first.
+func selectPrunable(backups []Backup, keep int, maxAge time.Duration, now time.Time) []string {
+	var newestComplete time.Time
+	for _, b := range backups {
+		if b.Complete {
+			newestComplete = b.Timestamp
+			break
+		}
+	}
+
+	prunable := make([]string, 0)
+	complete := 0
+	for _, b := range backups {
+		if !b.Complete {
+			if b.Timestamp.Before(newestComplete) {
+				prunable = append(prunable, b.Prefix)
+			}
+			continue
+		}
+		complete++
+		if complete == 1 {
+			continue
+		}
+		if (keep > 0 && complete > keep) || (maxAge > 0 && now.Sub(b.Timestamp) > maxAge) {
+			prunable = append(prunable, b.Prefix)
+		}
+	}
+	return prunable
+}
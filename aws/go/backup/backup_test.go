@@ -0,0 +1,222 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	src := t.TempDir()
+	for p, data := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/deep/c.txt": "c"} {
+		fp := filepath.Join(src, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(data), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("sub/b.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compression := range []string{CompressionGzip, CompressionZstd} {
+		name, err := ArchiveName(compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive := filepath.Join(t.TempDir(), name)
+		info, err := CreateArchive(src, archive, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checksum, err := FileSHA256(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Files != 3 || info.SHA256 != checksum || info.Size != fi.Size() {
+			t.Fatalf("unexpected archive info %+v (sha256 %s, size %d)", info, checksum, fi.Size())
+		}
+
+		dst := t.TempDir()
+		files, err := ExtractArchive(archive, dst, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files != 3 {
+			t.Fatalf("expected 3 files, got %d", files)
+		}
+		b, err := os.ReadFile(filepath.Join(dst, "link"))
+		if err != nil || string(b) != "b" {
+			t.Fatalf("unexpected symlink target %q (%v)", b, err)
+		}
+		fi, err = os.Stat(filepath.Join(dst, "sub", "deep", "c.txt"))
+		if err != nil || fi.Mode().Perm() != 0640 {
+			t.Fatalf("unexpected file %v (%v)", fi, err)
+		}
+	}
+
+	if _, err := ArchiveName("lz4"); err == nil {
+		t.Fatal("expected error for unknown compression")
+	}
+}
+
+func TestExtractArchiveSymlinks(t *testing.T) {
+	type entry struct {
+		name string
+		link string // symlink target, or the regular file if empty
+	}
+	for _, tv := range []struct {
+		name    string
+		entries []entry
+	}{
+		{"absolute link", []entry{{name: "x", link: "/etc"}}},
+		{"link escaping the directory", []entry{{name: "sub/x", link: "../../etc"}}},
+		{"write through the link", []entry{{name: "sub/", link: ""}, {name: "x", link: "sub"}, {name: "x/passwd"}}},
+		{"write through the nested link", []entry{{name: "sub/", link: ""}, {name: "a/x", link: "../sub"}, {name: "a/x/y/passwd"}}},
+	} {
+		t.Run(tv.name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+			f, err := os.Create(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			zw := gzip.NewWriter(f)
+			tw := tar.NewWriter(zw)
+			for _, e := range tv.entries {
+				hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: 1}
+				switch {
+				case strings.HasSuffix(e.name, "/"):
+					hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+				case e.link != "":
+					hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+				}
+				if err = tw.WriteHeader(hdr); err != nil {
+					t.Fatal(err)
+				}
+				if hdr.Size > 0 {
+					if _, err = tw.Write([]byte("x")); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err = tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err = zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err = f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := t.TempDir()
+			if _, err = ExtractArchive(archive, dst, CompressionGzip); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if _, err = os.Stat(filepath.Join(dst, "sub", "passwd")); err == nil {
+				t.Fatal("unexpected file written through the symlink")
+			}
+			if _, err = os.Stat(filepath.Join(dst, "sub", "y", "passwd")); err == nil {
+				t.Fatal("unexpected file written through the symlink")
+			}
+		})
+	}
+}
+
+func TestGroupBackups(t *testing.T) {
+	backups := groupBackups("my-asg/0/", []string{
+		"my-asg/0/20240101T000000Z/data.tar.zst",
+		"my-asg/0/20240101T000000Z/manifest.json",
+		"my-asg/0/20240103T000000Z/data.tar.zst",
+		"my-asg/0/20240102T000000Z/data.tar.zst",
+		"my-asg/0/20240102T000000Z/manifest.json",
+		"my-asg/0/unknown.txt",
+		"my-asg/0/not-a-timestamp/manifest.json",
+	})
+	if len(backups) != 3 {
+		t.Fatalf("unexpected backups %+v", backups)
+	}
+	if backups[0].Prefix != "my-asg/0/20240103T000000Z/" || backups[0].Complete || !backups[1].Complete || !backups[2].Complete {
+		t.Fatalf("unexpected backups %+v", backups)
+	}
+	if BackupPrefix("my-asg", "0", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) != "my-asg/0/20240102T030405Z/" {
+		t.Fatal("unexpected backup prefix")
+	}
+}
+
+func TestSelectPrunable(t *testing.T) {
+	now := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	backups := []Backup{
+		{Prefix: "9", Timestamp: day(9)}, // in progress
+		{Prefix: "8", Timestamp: day(8), Complete: true},
+		{Prefix: "7", Timestamp: day(7)}, // failed
+		{Prefix: "6", Timestamp: day(6), Complete: true},
+		{Prefix: "5", Timestamp: day(5), Complete: true},
+		{Prefix: "1", Timestamp: day(1), Complete: true},
+	}
+
+	for _, tv := range []struct {
+		keep   int
+		maxAge time.Duration
+		exp    string
+	}{
+		{0, 0, "7"},
+		{2, 0, "7,5,1"},
+		{0, 97 * time.Hour, "7,5,1"},
+		{1, 24 * time.Hour, "7,6,5,1"},
+	} {
+		got := strings.Join(selectPrunable(backups, tv.keep, tv.maxAge, now), ",")
+		if got != tv.exp {
+			t.Fatalf("keep %d, max age %v: expected %q, got %q", tv.keep, tv.maxAge, tv.exp, got)
+		}
+	}
+
+	// never prune the newest complete backup
+	if got := selectPrunable(backups[:2], 1, time.Hour, now); len(got) != 0 {
+		t.Fatalf("unexpected prunable %v", got)
+	}
+}
+
+func TestIsEmptyDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, tv := range []struct {
+		setup func()
+		empty bool
+	}{
+		{func() {}, true},
+		{func() { os.Mkdir(filepath.Join(dir, "lost+found"), 0700) }, true},
+		{func() { os.WriteFile(filepath.Join(dir, ".state"), nil, 0600) }, false},
+	} {
+		tv.setup()
+		empty, err := IsEmptyDir(dir)
+		if err != nil || empty != tv.empty {
+			t.Fatalf("expected empty %v, got %v (%v)", tv.empty, empty, err)
+		}
+	}
+	if empty, err := IsEmptyDir(filepath.Join(dir, "missing")); err != nil || !empty {
+		t.Fatalf("expected empty for the missing dir, got %v (%v)", empty, err)
+	}
+}
+
+func TestManifestValidate(t *testing.T) {
+	pfx := "my-asg/0/20240102T030405Z/"
+	m := Manifest{Compression: CompressionZstd, ArchiveKey: pfx + "data.tar.zst", Archive: ArchiveInfo{SHA256: "abc"}}
+	if err := m.validate(pfx); err != nil {
+		t.Fatal(err)
+	}
+	m.ArchiveKey = "other/0/20240102T030405Z/data.tar.zst"
+	if err := m.validate(pfx); err == nil {
+		t.Fatal("expected error for the archive key outside the prefix")
+	}
+}
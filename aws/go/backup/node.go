@@ -0,0 +1,42 @@
+package backup
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Instance tag key of the Auto Scaling Group name, set by the group.
+const asgNameTagKey = "aws:autoscaling:groupName"
+
+// Resolves the ASG name and the node of the instance for the backup prefix.
+// The node is the ordinal in the instance tag (e.g., claimed by "asg.ClaimOrdinal"),
+// so the replaced instance restores the backups of the instance it replaces,
+// or the instance ID if the ordinal tag key is empty or the tag is not found.
+// If the ASG name is not empty, it is returned as is.
+func ResolveNode(ctx context.Context, cfg aws.Config, instanceID string, asgName string, ordinalTagKey string) (string, string, error) {
+	inst, err := ec2.GetInstance(ctx, cfg, instanceID)
+	if err != nil {
+		return "", "", err
+	}
+	node := instanceID
+	for _, tg := range inst.Tags {
+		switch k := aws.ToString(tg.Key); {
+		case k == asgNameTagKey && asgName == "":
+			asgName = aws.ToString(tg.Value)
+		case k == ordinalTagKey && ordinalTagKey != "":
+			node = aws.ToString(tg.Value)
+		}
+	}
+	if asgName == "" {
+		return "", "", errors.New("instance not in any auto scaling group")
+	}
+	if node == instanceID && ordinalTagKey != "" {
+		logutil.S().Warnw("ordinal tag not found, using instance ID as node", "instanceID", instanceID, "tagKey", ordinalTagKey)
+	}
+	return asgName, node, nil
+}
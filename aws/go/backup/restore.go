@@ -0,0 +1,135 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gyuho/infra/aws/go/s3"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Returned when the node has no complete backup with the valid manifest.
+var ErrNoBackup = errors.New("no backup found")
+
+// Downloads and validates the manifest of the backup prefix.
+func ReadManifest(ctx context.Context, cfg aws.Config, bucketName string, pfx string) (Manifest, error) {
+	tmpDir, err := os.MkdirTemp("", "backup")
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	p := filepath.Join(tmpDir, ManifestName)
+	if err = s3.DownloadFile(ctx, cfg, bucketName, pfx+ManifestName, p); err != nil {
+		return Manifest{}, err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	if err = json.Unmarshal(b, &m); err != nil {
+		return Manifest{}, fmt.Errorf("failed to parse manifest %q (%w)", pfx+ManifestName, err)
+	}
+	if err = m.validate(pfx); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+func (m Manifest) validate(pfx string) error {
+	name, err := ArchiveName(m.Compression)
+	if err != nil {
+		return err
+	}
+	if m.ArchiveKey != pfx+name {
+		return fmt.Errorf("unexpected archive key %q in manifest (expected %q)", m.ArchiveKey, pfx+name)
+	}
+	if m.Archive.SHA256 == "" {
+		return errors.New("missing archive checksum in manifest")
+	}
+	return nil
+}
+
+// Returns the manifest of the newest complete backup of the node,
+// skipping the backups with the invalid manifests (e.g., corrupted, or written by the newer version).
+// Returns "ErrNoBackup" if none.
+func LatestManifest(ctx context.Context, cfg aws.Config, bucketName string, asgName string, node string) (Manifest, error) {
+	backups, err := ListBackups(ctx, cfg, bucketName, asgName, node)
+	if err != nil {
+		return Manifest{}, err
+	}
+	for _, b := range backups {
+		if !b.Complete {
+			logutil.S().Infow("skipping incomplete backup", "prefix", b.Prefix)
+			continue
+		}
+		m, err := ReadManifest(ctx, cfg, bucketName, b.Prefix)
+		if err != nil {
+			logutil.S().Warnw("skipping backup with invalid manifest", "prefix", b.Prefix, "error", err)
+			continue
+		}
+		logutil.S().Infow("found latest backup", "prefix", b.Prefix, "timestamp", m.Timestamp, "size", m.Archive.Size)
+		return m, nil
+	}
+	return Manifest{}, fmt.Errorf("%w for %s", ErrNoBackup, NodePrefix(asgName, node))
+}
+
+// Downloads the archive of the backup, validates its checksum against the manifest,
+// and extracts it into the data directory. The existing files in the data directory
+// are overwritten, and the others are kept. Returns the number of the restored files.
+// The s3 options are applied to the download (e.g., "s3.WithProgressFunc").
+func Restore(ctx context.Context, cfg aws.Config, bucketName string, m Manifest, dataDir string, opts ...s3.OpOption) (int, error) {
+	tmpDir, err := os.MkdirTemp("", "backup")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archivePath := filepath.Join(tmpDir, filepath.Base(m.ArchiveKey))
+	if err = s3.DownloadFile(ctx, cfg, bucketName, m.ArchiveKey, archivePath, opts...); err != nil {
+		return 0, err
+	}
+	checksum, err := FileSHA256(archivePath)
+	if err != nil {
+		return 0, err
+	}
+	if checksum != m.Archive.SHA256 {
+		return 0, fmt.Errorf("%w for %s (expected sha256 %s, got %s)", s3.ErrChecksumMismatch, m.ArchiveKey, m.Archive.SHA256, checksum)
+	}
+
+	files, err := ExtractArchive(archivePath, dataDir, m.Compression)
+	if err != nil {
+		return files, err
+	}
+	if m.Archive.Files > 0 && files != m.Archive.Files {
+		return files, fmt.Errorf("restored %d files, expected %d in manifest", files, m.Archive.Files)
+	}
+
+	logutil.S().Infow("restored backup", "archiveKey", m.ArchiveKey, "dataDir", dataDir, "files", files)
+	return files, nil
+}
+
+// Returns true if the directory does not exist, or has no entries other than
+// "lost+found" (e.g., the newly formatted volume).
+func IsEmptyDir(dir string) (bool, error) {
+	des, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, de := range des {
+		if de.Name() != "lost+found" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
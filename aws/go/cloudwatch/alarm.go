@@ -0,0 +1,198 @@
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	pkg_aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_cw_v2 "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	aws_cw_v2_types "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Represents the metric alarm to ensure.
+type Alarm struct {
+	Name        string
+	Description string
+
+	Namespace  string
+	MetricName string
+	Dimensions map[string]string
+	Statistic  aws_cw_v2_types.Statistic
+
+	Period             time.Duration
+	EvaluationPeriods  int32
+	Threshold          float64
+	ComparisonOperator aws_cw_v2_types.ComparisonOperator
+
+	// One of "breaching", "notBreaching", "ignore", or "missing" (default).
+	TreatMissingData string
+
+	// ARNs of the actions on the ALARM state (e.g., SNS topic, EC2 recover action).
+	AlarmActions []string
+	// ARNs of the actions on the OK state.
+	OKActions []string
+
+	// Only applied when the alarm is created.
+	Tags map[string]string
+}
+
+// Returns the EC2 recover action ARN in the region (e.g., "arn:aws:automate:us-west-2:ec2:recover").
+// The recover action is only supported on the "StatusCheckFailed_System" metric,
+// and not for the instances in the ASG (the ASG replaces the unhealthy instances instead).
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/ec2-instance-recover.html
+func RecoverActionARN(region string) string {
+	return fmt.Sprintf("arn:%s:automate:%s:ec2:recover", pkg_aws.PartitionForRegion(region), region)
+}
+
+// Returns the alarm on the instance status check failures, for two consecutive minutes.
+// If "recoverInstance" is true, the alarm is on the system status check failures
+// with the EC2 recover action. The SNS topics are notified on both the ALARM and OK states.
+func StatusCheckAlarm(name string, region string, instanceID string, recoverInstance bool, snsTopicARNs ...string) Alarm {
+	alarm := Alarm{
+		Name:               name,
+		Description:        fmt.Sprintf("status check failed for %s", instanceID),
+		Namespace:          "AWS/EC2",
+		MetricName:         "StatusCheckFailed",
+		Dimensions:         map[string]string{"InstanceId": instanceID},
+		Statistic:          aws_cw_v2_types.StatisticMaximum,
+		Period:             time.Minute,
+		EvaluationPeriods:  2,
+		Threshold:          1,
+		ComparisonOperator: aws_cw_v2_types.ComparisonOperatorGreaterThanOrEqualToThreshold,
+		AlarmActions:       slices.Clone(snsTopicARNs),
+		OKActions:          slices.Clone(snsTopicARNs),
+	}
+	if recoverInstance {
+		alarm.MetricName = "StatusCheckFailed_System"
+		alarm.AlarmActions = append(alarm.AlarmActions, RecoverActionARN(region))
+	}
+	return alarm
+}
+
+// Creates the metric alarm, or updates the existing alarm if its configuration differs.
+// Returns true if the alarm was created or updated.
+// ref. https://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/API_PutMetricAlarm.html
+func EnsureAlarm(ctx context.Context, cfg aws.Config, alarm Alarm) (bool, error) {
+	cli := aws_cw_v2.NewFromConfig(cfg)
+	out, err := cli.DescribeAlarms(ctx, &aws_cw_v2.DescribeAlarmsInput{
+		AlarmNames: []string{alarm.Name},
+		AlarmTypes: []aws_cw_v2_types.AlarmType{aws_cw_v2_types.AlarmTypeMetricAlarm},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	input := toPutMetricAlarmInput(alarm)
+	if len(out.MetricAlarms) > 0 && alarmInSync(out.MetricAlarms[0], input) {
+		logutil.S().Infow("alarm already in sync", "name", alarm.Name)
+		return false, nil
+	}
+	if len(out.MetricAlarms) > 0 {
+		// the tags can only be set on creation
+		input.Tags = nil
+	}
+
+	logutil.S().Infow("putting metric alarm", "name", alarm.Name, "metric", alarm.MetricName, "exists", len(out.MetricAlarms) > 0)
+	if _, err = cli.PutMetricAlarm(ctx, input); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Deletes the alarms, ignoring the ones that do not exist.
+func DeleteAlarms(ctx context.Context, cfg aws.Config, names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	logutil.S().Infow("deleting alarms", "names", names)
+	cli := aws_cw_v2.NewFromConfig(cfg)
+	_, err := cli.DeleteAlarms(ctx, &aws_cw_v2.DeleteAlarmsInput{AlarmNames: names})
+	var notFound *aws_cw_v2_types.ResourceNotFound
+	if errors.As(err, &notFound) {
+		logutil.S().Infow("alarms not found", "names", names)
+		return nil
+	}
+	return err
+}
+
+func toPutMetricAlarmInput(alarm Alarm) *aws_cw_v2.PutMetricAlarmInput {
+	input := &aws_cw_v2.PutMetricAlarmInput{
+		AlarmName:          aws.String(alarm.Name),
+		Namespace:          aws.String(alarm.Namespace),
+		MetricName:         aws.String(alarm.MetricName),
+		Dimensions:         toDimensions(nil, alarm.Dimensions),
+		Statistic:          alarm.Statistic,
+		Period:             aws.Int32(int32(alarm.Period / time.Second)),
+		EvaluationPeriods:  aws.Int32(alarm.EvaluationPeriods),
+		Threshold:          aws.Float64(alarm.Threshold),
+		ComparisonOperator: alarm.ComparisonOperator,
+		ActionsEnabled:     aws.Bool(true),
+		AlarmActions:       alarm.AlarmActions,
+		OKActions:          alarm.OKActions,
+	}
+	if alarm.Description != "" {
+		input.AlarmDescription = aws.String(alarm.Description)
+	}
+	if alarm.TreatMissingData != "" {
+		input.TreatMissingData = aws.String(alarm.TreatMissingData)
+	}
+	for _, k := range slices.Sorted(maps.Keys(alarm.Tags)) {
+		input.Tags = append(input.Tags, aws_cw_v2_types.Tag{Key: aws.String(k), Value: aws.String(alarm.Tags[k])})
+	}
+	return input
+}
+
+// Returns true if the existing alarm matches the input, ignoring the order of the actions.
+func alarmInSync(cur aws_cw_v2_types.MetricAlarm, input *aws_cw_v2.PutMetricAlarmInput) bool {
+	treatMissing := aws.ToString(input.TreatMissingData)
+	if treatMissing == "" {
+		treatMissing = "missing"
+	}
+	curTreatMissing := aws.ToString(cur.TreatMissingData)
+	if curTreatMissing == "" {
+		curTreatMissing = "missing"
+	}
+	return aws.ToString(cur.Namespace) == aws.ToString(input.Namespace) &&
+		aws.ToString(cur.MetricName) == aws.ToString(input.MetricName) &&
+		aws.ToString(cur.AlarmDescription) == aws.ToString(input.AlarmDescription) &&
+		cur.Statistic == input.Statistic &&
+		aws.ToInt32(cur.Period) == aws.ToInt32(input.Period) &&
+		aws.ToInt32(cur.EvaluationPeriods) == aws.ToInt32(input.EvaluationPeriods) &&
+		aws.ToFloat64(cur.Threshold) == aws.ToFloat64(input.Threshold) &&
+		cur.ComparisonOperator == input.ComparisonOperator &&
+		curTreatMissing == treatMissing &&
+		aws.ToBool(cur.ActionsEnabled) &&
+		sameDimensions(cur.Dimensions, input.Dimensions) &&
+		sameSet(cur.AlarmActions, input.AlarmActions) &&
+		sameSet(cur.OKActions, input.OKActions)
+}
+
+func sameDimensions(a []aws_cw_v2_types.Dimension, b []aws_cw_v2_types.Dimension) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	m := make(map[string]string, len(a))
+	for _, d := range a {
+		m[aws.ToString(d.Name)] = aws.ToString(d.Value)
+	}
+	for _, d := range b {
+		if v, ok := m[aws.ToString(d.Name)]; !ok || v != aws.ToString(d.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameSet(a []string, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
@@ -0,0 +1,45 @@
+package cloudwatch
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_cw_v2_types "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+func TestStatusCheckAlarm(t *testing.T) {
+	alarm := StatusCheckAlarm("a", "us-gov-west-1", "i-1", true, "arn:topic")
+	if alarm.MetricName != "StatusCheckFailed_System" || len(alarm.AlarmActions) != 2 || alarm.AlarmActions[1] != "arn:aws-us-gov:automate:us-gov-west-1:ec2:recover" || len(alarm.OKActions) != 1 {
+		t.Fatalf("unexpected alarm %+v", alarm)
+	}
+	alarm = StatusCheckAlarm("a", "us-west-2", "i-1", false)
+	if alarm.MetricName != "StatusCheckFailed" || len(alarm.AlarmActions) != 0 {
+		t.Fatalf("unexpected alarm %+v", alarm)
+	}
+
+	input := toPutMetricAlarmInput(StatusCheckAlarm("a", "us-west-2", "i-1", true, "arn:topic"))
+	if aws.ToInt32(input.Period) != 60 || aws.ToString(input.Dimensions[0].Value) != "i-1" {
+		t.Fatalf("unexpected input %+v", input)
+	}
+	cur := aws_cw_v2_types.MetricAlarm{
+		Namespace:          input.Namespace,
+		MetricName:         input.MetricName,
+		AlarmDescription:   input.AlarmDescription,
+		Statistic:          input.Statistic,
+		Period:             input.Period,
+		EvaluationPeriods:  input.EvaluationPeriods,
+		Threshold:          input.Threshold,
+		ComparisonOperator: input.ComparisonOperator,
+		ActionsEnabled:     aws.Bool(true),
+		Dimensions:         input.Dimensions,
+		AlarmActions:       []string{input.AlarmActions[1], input.AlarmActions[0]},
+		OKActions:          input.OKActions,
+	}
+	if !alarmInSync(cur, input) {
+		t.Fatal("expected alarm in sync")
+	}
+	cur.EvaluationPeriods = aws.Int32(3)
+	if alarmInSync(cur, input) {
+		t.Fatal("expected alarm out of sync")
+	}
+}
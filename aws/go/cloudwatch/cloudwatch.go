@@ -0,0 +1,176 @@
+// Package cloudwatch implements CloudWatch utils.
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_cw_v2 "github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	aws_cw_v2_types "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// The number of the metric data to put in a single call.
+const maxDatumsPerCall = 20
+
+type Op struct {
+	dimensions    map[string]string
+	interval      time.Duration
+	maxBuffered   int
+	retentionDays int32
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Sets the dimensions to add to all the metric data (e.g., "InstanceDimensions").
+// The dimensions set in the metric datum take precedence.
+func WithDimensions(m map[string]string) OpOption {
+	return func(op *Op) {
+		op.dimensions = m
+	}
+}
+
+// Sets the flush interval of the publisher or the log sink
+// (default 1 minute for the publisher, and 5 seconds for the log sink).
+func WithInterval(d time.Duration) OpOption {
+	return func(op *Op) {
+		op.interval = d
+	}
+}
+
+// Sets the maximum number of the buffered metric data (or log events) (default 10,000),
+// where the oldest are dropped when the API calls keep failing.
+func WithMaxBuffered(n int) OpOption {
+	return func(op *Op) {
+		op.maxBuffered = n
+	}
+}
+
+// Sets the retention days of the log group (0 to keep the current, or never expire).
+// ref. https://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutRetentionPolicy.html
+func WithRetentionDays(days int32) OpOption {
+	return func(op *Op) {
+		op.retentionDays = days
+	}
+}
+
+// Represents the metric datum to publish.
+type Datum struct {
+	Name       string
+	Value      float64
+	Unit       aws_cw_v2_types.StandardUnit
+	Dimensions map[string]string
+
+	// If zero, the time of the "Add" (or "PutMetricData") is used.
+	Timestamp time.Time
+}
+
+// Puts the metric data in the namespace, 20 at a time.
+// Use "WithDimensions" to add the dimensions to all the metric data.
+// ref. https://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/API_PutMetricData.html
+func PutMetricData(ctx context.Context, cfg aws.Config, namespace string, data []Datum, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cli := aws_cw_v2.NewFromConfig(cfg)
+	now := time.Now()
+	for _, batch := range toMetricData(data, ret.dimensions, now) {
+		_, err := cli.PutMetricData(ctx, &aws_cw_v2.PutMetricDataInput{
+			Namespace:  aws.String(namespace),
+			MetricData: batch,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	logutil.S().Debugw("put metric data", "namespace", namespace, "data", len(data))
+	return nil
+}
+
+// Converts the metric data in the batches of "maxDatumsPerCall".
+func toMetricData(data []Datum, dims map[string]string, now time.Time) [][]aws_cw_v2_types.MetricDatum {
+	batches := make([][]aws_cw_v2_types.MetricDatum, 0, (len(data)+maxDatumsPerCall-1)/maxDatumsPerCall)
+	for len(data) > 0 {
+		n := min(len(data), maxDatumsPerCall)
+		batch := make([]aws_cw_v2_types.MetricDatum, 0, n)
+		for _, d := range data[:n] {
+			ts := d.Timestamp
+			if ts.IsZero() {
+				ts = now
+			}
+			unit := d.Unit
+			if unit == "" {
+				unit = aws_cw_v2_types.StandardUnitNone
+			}
+			batch = append(batch, aws_cw_v2_types.MetricDatum{
+				MetricName: aws.String(d.Name),
+				Value:      aws.Float64(d.Value),
+				Unit:       unit,
+				Timestamp:  aws.Time(ts),
+				Dimensions: toDimensions(dims, d.Dimensions),
+			})
+		}
+		batches = append(batches, batch)
+		data = data[n:]
+	}
+	return batches
+}
+
+// Merges the datum dimensions over the common dimensions, sorted by the name.
+func toDimensions(common map[string]string, dims map[string]string) []aws_cw_v2_types.Dimension {
+	merged := make(map[string]string, len(common)+len(dims))
+	for k, v := range common {
+		merged[k] = v
+	}
+	for k, v := range dims {
+		merged[k] = v
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(merged))
+	for k := range merged {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	ds := make([]aws_cw_v2_types.Dimension, 0, len(names))
+	for _, k := range names {
+		ds = append(ds, aws_cw_v2_types.Dimension{Name: aws.String(k), Value: aws.String(merged[k])})
+	}
+	return ds
+}
+
+// Returns the dimensions of the local instance from the instance identity document,
+// in the same names as the "AWS/EC2" namespace: "InstanceId", "InstanceType",
+// and "AutoScalingGroupName" if the ASG name is not empty.
+// Each unique set of the dimensions is a separate metric, so only the stable ones are included.
+func InstanceDimensions(ctx context.Context, asgName string) (map[string]string, error) {
+	doc, err := metadata.New().InstanceIdentityDocument(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if doc.InstanceID == "" {
+		return nil, fmt.Errorf("empty instance ID in the instance identity document")
+	}
+	dims := map[string]string{
+		"InstanceId":   doc.InstanceID,
+		"InstanceType": doc.InstanceType,
+	}
+	if asgName != "" {
+		dims["AutoScalingGroupName"] = asgName
+	}
+	return dims, nil
+}
@@ -0,0 +1,74 @@
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_cw_v2_types "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+func TestToMetricData(t *testing.T) {
+	data := make([]Datum, 45)
+	for i := range data {
+		data[i] = Datum{Name: "m", Value: float64(i)}
+	}
+	data[0].Dimensions = map[string]string{"InstanceId": "i-override", "Role": "db"}
+	data[0].Unit = aws_cw_v2_types.StandardUnitCount
+
+	now := time.Now()
+	batches := toMetricData(data, map[string]string{"InstanceId": "i-1"}, now)
+	if len(batches) != 3 || len(batches[0]) != 20 || len(batches[2]) != 5 {
+		t.Fatalf("unexpected batches %d", len(batches))
+	}
+
+	d0 := batches[0][0]
+	if len(d0.Dimensions) != 2 || aws.ToString(d0.Dimensions[0].Name) != "InstanceId" || aws.ToString(d0.Dimensions[0].Value) != "i-override" || d0.Unit != aws_cw_v2_types.StandardUnitCount {
+		t.Fatalf("unexpected datum %+v", d0)
+	}
+	d1 := batches[0][1]
+	if len(d1.Dimensions) != 1 || aws.ToString(d1.Dimensions[0].Value) != "i-1" || d1.Unit != aws_cw_v2_types.StandardUnitNone || !aws.ToTime(d1.Timestamp).Equal(now) {
+		t.Fatalf("unexpected datum %+v", d1)
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	var mu sync.Mutex
+	var got []Datum
+	fail := true
+	put := func(_ context.Context, data []Datum) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return errors.New("throttled")
+		}
+		got = append(got, data...)
+		return nil
+	}
+
+	p := startPublisher("test", &Op{interval: time.Hour, maxBuffered: 3}, put)
+	for i := 0; i < 5; i++ {
+		p.Add(Datum{Name: "m", Value: float64(i)})
+	}
+	if err := p.Flush(context.Background()); err == nil {
+		t.Fatal("expected flush error")
+	}
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// oldest dropped over the buffer limit, and the failed data kept for the next flush
+	if len(got) != 3 || got[0].Value != 2 || got[2].Value != 4 {
+		t.Fatalf("unexpected published data %+v", got)
+	}
+	if p.dropped != 2 {
+		t.Fatalf("expected 2 dropped, got %d", p.dropped)
+	}
+}
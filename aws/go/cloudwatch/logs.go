@@ -0,0 +1,313 @@
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_cwlogs_v2 "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	aws_cwlogs_v2_types "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"go.uber.org/zap/zapcore"
+)
+
+// PutLogEvents limits.
+// ref. https://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutLogEvents.html
+const (
+	maxLogEventsPerCall = 10000
+	maxLogBatchBytes    = 1048576
+	logEventOverhead    = 26
+	maxLogEventBytes    = 256*1024 - logEventOverhead
+)
+
+const defaultLogInterval = 5 * time.Second
+
+// Ships the log events to the CloudWatch Logs stream, buffered and flushed on the interval,
+// so the logs are centrally searchable without installing the CloudWatch agent.
+type LogSink struct {
+	group       string
+	stream      string
+	maxBuffered int
+	put         func(ctx context.Context, events []aws_cwlogs_v2_types.InputLogEvent) error
+
+	mu      sync.Mutex
+	buf     []aws_cwlogs_v2_types.InputLogEvent
+	dropped int
+
+	// serializes the flushes, and detects the re-entrant flush
+	// (e.g., the warning logged by the flush itself)
+	flushMu sync.Mutex
+
+	cancel   func()
+	donec    chan struct{}
+	stopOnce sync.Once
+}
+
+// Creates the log group and stream (if not exist), applies the retention with "WithRetentionDays",
+// and starts the sink that flushes the log events on the interval (default 5 seconds) until "Stop".
+func StartLogSink(ctx context.Context, cfg aws.Config, group string, stream string, opts ...OpOption) (*LogSink, error) {
+	ret := &Op{interval: defaultLogInterval, maxBuffered: defaultMaxBuffered}
+	ret.applyOpts(opts)
+
+	cli := aws_cwlogs_v2.NewFromConfig(cfg)
+	_, err := cli.CreateLogGroup(ctx, &aws_cwlogs_v2.CreateLogGroupInput{LogGroupName: aws.String(group)})
+	if err != nil && !isAlreadyExists(err) {
+		return nil, err
+	}
+	if ret.retentionDays > 0 {
+		_, err = cli.PutRetentionPolicy(ctx, &aws_cwlogs_v2.PutRetentionPolicyInput{
+			LogGroupName:    aws.String(group),
+			RetentionInDays: aws.Int32(ret.retentionDays),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = cli.CreateLogStream(ctx, &aws_cwlogs_v2.CreateLogStreamInput{
+		LogGroupName:  aws.String(group),
+		LogStreamName: aws.String(stream),
+	})
+	if err != nil && !isAlreadyExists(err) {
+		return nil, err
+	}
+
+	// the sequence token is no longer required, but still honored when returned
+	// ref. https://aws.amazon.com/about-aws/whats-new/2023/01/amazon-cloudwatch-logs-log-stream-transaction-quota-sequencetoken-requirement/
+	var seqToken *string
+	put := func(ctx context.Context, events []aws_cwlogs_v2_types.InputLogEvent) error {
+		for i := 0; ; i++ {
+			out, err := cli.PutLogEvents(ctx, &aws_cwlogs_v2.PutLogEventsInput{
+				LogGroupName:  aws.String(group),
+				LogStreamName: aws.String(stream),
+				LogEvents:     events,
+				SequenceToken: seqToken,
+			})
+			if err == nil {
+				seqToken = out.NextSequenceToken
+				if out.RejectedLogEventsInfo != nil {
+					logutil.S().Warnw("log events rejected", "group", group, "stream", stream, "info", out.RejectedLogEventsInfo)
+				}
+				return nil
+			}
+
+			var invalid *aws_cwlogs_v2_types.InvalidSequenceTokenException
+			if errors.As(err, &invalid) && i == 0 {
+				seqToken = invalid.ExpectedSequenceToken
+				continue
+			}
+			var accepted *aws_cwlogs_v2_types.DataAlreadyAcceptedException
+			if errors.As(err, &accepted) {
+				seqToken = accepted.ExpectedSequenceToken
+				return nil
+			}
+			return err
+		}
+	}
+
+	logutil.S().Infow("starting log sink", "group", group, "stream", stream, "interval", ret.interval, "retentionDays", ret.retentionDays)
+	return startLogSink(group, stream, ret, put), nil
+}
+
+func startLogSink(group string, stream string, ret *Op, put func(ctx context.Context, events []aws_cwlogs_v2_types.InputLogEvent) error) *LogSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &LogSink{
+		group:       group,
+		stream:      stream,
+		maxBuffered: ret.maxBuffered,
+		put:         put,
+		cancel:      cancel,
+		donec:       make(chan struct{}),
+	}
+	go func() {
+		defer close(s.donec)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ret.interval):
+			}
+
+			fctx, fcancel := context.WithTimeout(ctx, 30*time.Second)
+			err := s.Flush(fctx)
+			fcancel()
+			if err != nil {
+				logutil.S().Warnw("failed to flush log events -- retrying in next interval", "group", group, "stream", stream, "error", err)
+			}
+		}
+	}()
+	return s
+}
+
+// Creates the log sink with the stream named after the local instance and the app
+// (e.g., "i-1234/aws-ip-provisioner"), or the hostname outside EC2,
+// and tees the default logger to the sink.
+// Exit with "logutil.Exit" instead of "os.Exit", to flush the buffered events.
+func EnableLogSink(ctx context.Context, cfg aws.Config, group string, appName string, opts ...OpOption) (*LogSink, error) {
+	host, err := metadata.FetchInstanceID(ctx)
+	if err != nil {
+		if host, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+	s, err := StartLogSink(ctx, cfg, group, host+"/"+appName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	logutil.AddCore(s.Core(logutil.GetDefaultZapLoggerConfig().Level))
+	return s, nil
+}
+
+// Buffers the log event.
+func (s *LogSink) add(ts time.Time, msg string) {
+	if len(msg) > maxLogEventBytes {
+		msg = msg[:maxLogEventBytes]
+	}
+	s.mu.Lock()
+	s.buf = append(s.buf, aws_cwlogs_v2_types.InputLogEvent{
+		Message:   aws.String(msg),
+		Timestamp: aws.Int64(ts.UnixMilli()),
+	})
+	if s.maxBuffered > 0 && len(s.buf) > s.maxBuffered {
+		n := len(s.buf) - s.maxBuffered
+		s.buf = append([]aws_cwlogs_v2_types.InputLogEvent(nil), s.buf[n:]...)
+		s.dropped += n
+	}
+	s.mu.Unlock()
+}
+
+// Puts all the buffered log events. On failure, the events are kept to retry on the next flush.
+func (s *LogSink) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	return s.flushLocked(ctx)
+}
+
+func (s *LogSink) flushLocked(ctx context.Context) error {
+	s.mu.Lock()
+	events := s.buf
+	s.buf = nil
+	s.mu.Unlock()
+	if len(events) == 0 {
+		return nil
+	}
+
+	batches := batchLogEvents(events)
+	for i, batch := range batches {
+		if err := s.put(ctx, batch); err != nil {
+			var rest []aws_cwlogs_v2_types.InputLogEvent
+			for _, b := range batches[i:] {
+				rest = append(rest, b...)
+			}
+			s.mu.Lock()
+			s.buf = append(rest, s.buf...)
+			s.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// Stops the flush loop, and flushes the remaining log events (e.g., on exit).
+func (s *LogSink) Stop(ctx context.Context) error {
+	var err error
+	s.stopOnce.Do(func() {
+		s.cancel()
+		<-s.donec
+		err = s.Flush(ctx)
+	})
+	return err
+}
+
+// Sorts the log events chronologically (required by the API),
+// and splits them within the count and size limits.
+func batchLogEvents(events []aws_cwlogs_v2_types.InputLogEvent) [][]aws_cwlogs_v2_types.InputLogEvent {
+	sort.SliceStable(events, func(i, j int) bool {
+		return aws.ToInt64(events[i].Timestamp) < aws.ToInt64(events[j].Timestamp)
+	})
+
+	batches := make([][]aws_cwlogs_v2_types.InputLogEvent, 0, 1)
+	start, size := 0, 0
+	for i, ev := range events {
+		sz := len(aws.ToString(ev.Message)) + logEventOverhead
+		if i > start && (i-start >= maxLogEventsPerCall || size+sz > maxLogBatchBytes) {
+			batches = append(batches, events[start:i])
+			start, size = i, 0
+		}
+		size += sz
+	}
+	if start < len(events) {
+		batches = append(batches, events[start:])
+	}
+	return batches
+}
+
+// Returns the zap core that encodes the entries in JSON to the sink.
+// The entries at the warning level or above are flushed right away,
+// so the reason is shipped even if the process exits right after.
+func (s *LogSink) Core(lvl zapcore.LevelEnabler) zapcore.Core {
+	return &sinkCore{
+		LevelEnabler: lvl,
+		enc:          zapcore.NewJSONEncoder(logutil.GetDefaultZapLoggerConfig().EncoderConfig),
+		sink:         s,
+	}
+}
+
+type sinkCore struct {
+	zapcore.LevelEnabler
+	enc  zapcore.Encoder
+	sink *LogSink
+}
+
+func (c *sinkCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &sinkCore{LevelEnabler: c.LevelEnabler, enc: enc, sink: c.sink}
+}
+
+func (c *sinkCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *sinkCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	c.sink.add(ent.Time, buf.String())
+	buf.Free()
+
+	if ent.Level >= zapcore.WarnLevel && c.sink.flushMu.TryLock() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = c.sink.flushLocked(ctx)
+		cancel()
+		c.sink.flushMu.Unlock()
+	}
+	// do not fail the other cores on the remote failure, the events are retried
+	return nil
+}
+
+// Flushes the buffered events, waiting for the in-flight flush if any
+// (e.g., "logutil.Exit" before the process exits).
+func (c *sinkCore) Sync() error {
+	c.sink.flushMu.Lock()
+	defer c.sink.flushMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return c.sink.flushLocked(ctx)
+}
+
+func isAlreadyExists(err error) bool {
+	var exists *aws_cwlogs_v2_types.ResourceAlreadyExistsException
+	return errors.As(err, &exists)
+}
@@ -0,0 +1,76 @@
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_cwlogs_v2_types "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"go.uber.org/zap"
+)
+
+func TestBatchLogEvents(t *testing.T) {
+	events := make([]aws_cwlogs_v2_types.InputLogEvent, 0, maxLogEventsPerCall+10)
+	for i := 0; i < maxLogEventsPerCall+10; i++ {
+		events = append(events, aws_cwlogs_v2_types.InputLogEvent{
+			Message:   aws.String("m"),
+			Timestamp: aws.Int64(int64(maxLogEventsPerCall + 10 - i)),
+		})
+	}
+	batches := batchLogEvents(events)
+	if len(batches) != 2 || len(batches[0]) != maxLogEventsPerCall || len(batches[1]) != 10 {
+		t.Fatalf("unexpected batches %d", len(batches))
+	}
+	if aws.ToInt64(batches[0][0].Timestamp) != 1 {
+		t.Fatalf("events not sorted %d", aws.ToInt64(batches[0][0].Timestamp))
+	}
+
+	big := strings.Repeat("x", maxLogEventBytes)
+	events = make([]aws_cwlogs_v2_types.InputLogEvent, 5)
+	for i := range events {
+		events[i] = aws_cwlogs_v2_types.InputLogEvent{Message: aws.String(big), Timestamp: aws.Int64(0)}
+	}
+	batches = batchLogEvents(events)
+	if len(batches) != 2 || len(batches[0]) != 4 || len(batches[1]) != 1 {
+		t.Fatalf("unexpected batches by size %d", len(batches))
+	}
+}
+
+func TestLogSink(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	fail := true
+	put := func(ctx context.Context, events []aws_cwlogs_v2_types.InputLogEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return errors.New("throttled")
+		}
+		for _, ev := range events {
+			got = append(got, aws.ToString(ev.Message))
+		}
+		return nil
+	}
+	s := startLogSink("g", "s", &Op{interval: time.Hour, maxBuffered: 2}, put)
+
+	lg := zap.New(s.Core(zap.InfoLevel))
+	lg.Info("first")
+	lg.Debug("ignored")
+	lg.Info("second", zap.String("k", "v"))
+	lg.Warn("third")
+
+	// warn flush failed, so the oldest is dropped to the buffer limit
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !strings.Contains(got[0], `"second"`) || !strings.Contains(got[0], `"k":"v"`) || !strings.Contains(got[1], `"third"`) {
+		t.Fatalf("unexpected events %q", got)
+	}
+}
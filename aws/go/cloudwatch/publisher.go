@@ -0,0 +1,130 @@
+package cloudwatch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	defaultPublishInterval = time.Minute
+	defaultMaxBuffered     = 10000
+)
+
+// Buffers the metric data, and puts them on the interval and on "Stop",
+// so the daemons record the metrics without calling the API on every event.
+type Publisher struct {
+	namespace   string
+	maxBuffered int
+	put         func(ctx context.Context, data []Datum) error
+
+	mu      sync.Mutex
+	buf     []Datum
+	dropped int
+
+	cancel   func()
+	donec    chan struct{}
+	stopOnce sync.Once
+}
+
+// Starts the publisher that flushes the buffered metric data to the namespace
+// on the interval (default 1 minute), until "Stop" is called.
+// Use "WithDimensions" to add the dimensions to all the metric data (e.g., "InstanceDimensions").
+func StartPublisher(cfg aws.Config, namespace string, opts ...OpOption) *Publisher {
+	ret := &Op{interval: defaultPublishInterval, maxBuffered: defaultMaxBuffered}
+	ret.applyOpts(opts)
+
+	return startPublisher(namespace, ret, func(ctx context.Context, data []Datum) error {
+		return PutMetricData(ctx, cfg, namespace, data, WithDimensions(ret.dimensions))
+	})
+}
+
+func startPublisher(namespace string, ret *Op, put func(ctx context.Context, data []Datum) error) *Publisher {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Publisher{
+		namespace:   namespace,
+		maxBuffered: ret.maxBuffered,
+		put:         put,
+		cancel:      cancel,
+		donec:       make(chan struct{}),
+	}
+
+	logutil.S().Infow("starting metric publisher", "namespace", namespace, "interval", ret.interval)
+	go func() {
+		defer close(p.donec)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ret.interval):
+			}
+
+			fctx, fcancel := context.WithTimeout(ctx, 30*time.Second)
+			err := p.Flush(fctx)
+			fcancel()
+			if err != nil {
+				logutil.S().Warnw("failed to flush metrics -- retrying in next interval", "namespace", namespace, "error", err)
+			}
+		}
+	}()
+	return p
+}
+
+// Buffers the metric datum.
+func (p *Publisher) Add(d Datum) {
+	if d.Timestamp.IsZero() {
+		d.Timestamp = time.Now()
+	}
+	p.mu.Lock()
+	p.buf = append(p.buf, d)
+	p.trimLocked()
+	p.mu.Unlock()
+}
+
+// Puts all the buffered metric data. On failure, the data are kept to retry on the next flush.
+func (p *Publisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	data := p.buf
+	p.buf = nil
+	p.mu.Unlock()
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := p.put(ctx, data); err != nil {
+		p.mu.Lock()
+		// keep the order, with the failed (older) data first
+		p.buf = append(data, p.buf...)
+		p.trimLocked()
+		p.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Drops the oldest data over the maximum, to bound the memory on the persistent failures.
+func (p *Publisher) trimLocked() {
+	if p.maxBuffered <= 0 || len(p.buf) <= p.maxBuffered {
+		return
+	}
+	n := len(p.buf) - p.maxBuffered
+	p.buf = append([]Datum(nil), p.buf[n:]...)
+	p.dropped += n
+	logutil.S().Warnw("dropped oldest metric data over the buffer limit", "namespace", p.namespace, "dropped", n, "totalDropped", p.dropped)
+}
+
+// Stops the flush loop, and flushes the remaining metric data (e.g., on shutdown).
+func (p *Publisher) Stop(ctx context.Context) error {
+	var err error
+	p.stopOnce.Do(func() {
+		p.cancel()
+		<-p.donec
+		err = p.Flush(ctx)
+		logutil.S().Infow("stopped metric publisher", "namespace", p.namespace, "error", err)
+	})
+	return err
+}
@@ -0,0 +1,192 @@
+// ASG coordinator for AWS, to assign each instance in the ASG a stable ordinal (e.g., node-0, node-1).
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/asg"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
+	"github.com/gyuho/infra/aws/go/cmd/version"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/spf13/cobra"
+)
+
+const appName = "aws-asg-coordinator"
+
+var cmd = &cobra.Command{
+	Use:        appName,
+	Short:      appName,
+	Aliases:    []string{"asg-coordinator"},
+	SuggestFor: []string{"asg-coordinator"},
+	Run:        cmdFunc,
+}
+
+var (
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+	initialWaitRandomSeconds   int
+
+	asgName       string
+	ordinalTagKey string
+	size          int
+	claimInterval time.Duration
+	claimTimeout  time.Duration
+
+	namePrefix string
+	outputFile string
+)
+
+func init() {
+	cobra.EnablePrefixMatching = true
+	cmd.AddCommand(version.NewCommand(), newRefreshCommand())
+
+	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region of the local instance")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
+	cmd.PersistentFlags().IntVar(&initialWaitRandomSeconds, "initial-wait-random-seconds", 10, "maximum number of seconds to wait (value chosen at random with the range)")
+
+	cmd.PersistentFlags().StringVar(&asgName, "asg-name", "", "ASG name of the local instance (if empty, the 'aws:autoscaling:groupName' tag of the local instance is used)")
+	cmd.PersistentFlags().StringVar(&ordinalTagKey, "ordinal-tag-key", "AWS_ASG_COORDINATOR_ORDINAL", "tag key to claim the ordinal with on the local EC2 instance")
+	cmd.PersistentFlags().IntVar(&size, "size", 0, "number of ordinals to assign (0 to use the ASG desired capacity)")
+	cmd.PersistentFlags().DurationVar(&claimInterval, "claim-interval", 10*time.Second, "interval to settle the concurrent claims, and to retry when all ordinals are taken")
+	cmd.PersistentFlags().DurationVar(&claimTimeout, "claim-timeout", 30*time.Minute, "maximum duration to claim the ordinal (e.g., waiting for the replaced instance to terminate)")
+
+	cmd.PersistentFlags().StringVar(&namePrefix, "name-prefix", "", "prefix to set the 'Name' tag of the local instance with the ordinal (e.g., 'node' for 'node-0', if empty, skip)")
+	cmd.PersistentFlags().StringVar(&outputFile, "output-file", "", "file to write the claimed ordinal as JSON (if empty, skip)")
+}
+
+func main() {
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
+		logutil.Exit(1)
+	}
+	logutil.Exit(0)
+}
+
+type output struct {
+	InstanceID string `json:"instance_id"`
+	ASGName    string `json:"asg_name"`
+	Ordinal    int    `json:"ordinal"`
+	Name       string `json:"name,omitempty"`
+}
+
+func cmdFunc(cmd *cobra.Command, args []string) {
+	initialWait := time.Duration(rand.Intn(initialWaitRandomSeconds+1)) * time.Second
+	logutil.S().Infow("starting 'aws-asg-coordinator'", "initialWait", initialWait)
+	time.Sleep(initialWait)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	localInstanceID, err := metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(1)
+	}
+
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
+	}
+
+	if asgName == "" {
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
+		asgName, err = ec2.WaitTagValue(ctx, cfg, localInstanceID, "aws:autoscaling:groupName")
+		cancel()
+		if err != nil || asgName == "" {
+			logutil.S().Warnw("failed to get asg tag value in time", "error", err)
+			logutil.Exit(1)
+		}
+	}
+	logutil.S().Infow("found asg", "asgName", asgName)
+
+	ctx, cancel = context.WithTimeout(context.Background(), claimTimeout)
+	ordinal, err := asg.ClaimOrdinal(ctx, cfg, asgName, localInstanceID, ordinalTagKey, size, asg.WithInterval(claimInterval))
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to claim ordinal", "error", err)
+		logutil.Exit(1)
+	}
+
+	out := output{
+		InstanceID: localInstanceID,
+		ASGName:    asgName,
+		Ordinal:    ordinal,
+	}
+	if namePrefix != "" {
+		out.Name = fmt.Sprintf("%s-%d", namePrefix, ordinal)
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		err = ec2.CreateTags(ctx, cfg, []string{localInstanceID}, map[string]string{"Name": out.Name})
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to create tags", "error", err)
+			logutil.Exit(1)
+		}
+	}
+
+	if outputFile != "" {
+		b, err := json.Marshal(out)
+		if err != nil {
+			logutil.S().Warnw("failed to marshal output", "error", err)
+			logutil.Exit(1)
+		}
+		if err = os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+			logutil.S().Warnw("failed to create output directory", "error", err)
+			logutil.Exit(1)
+		}
+		if err = os.WriteFile(outputFile, b, 0644); err != nil {
+			logutil.S().Warnw("failed to write output file", "error", err)
+			logutil.Exit(1)
+		}
+	}
+
+	logutil.S().Infow("successfully claimed ordinal", "asgName", asgName, "ordinal", ordinal, "name", out.Name)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/asg"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	refreshID             string
+	launchTemplateID      string
+	launchTemplateVersion string
+	minHealthyPercentage  int32
+	instanceWarmup        int32
+	skipMatching          bool
+	autoRollback          bool
+
+	refreshWait         bool
+	refreshWaitTimeout  time.Duration
+	refreshPollInterval time.Duration
+)
+
+func newRefreshCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "refresh",
+		Short: "Starts the rolling instance refresh of the ASG (e.g., to roll out the new image), and waits for it to complete.",
+		Args:  cobra.NoArgs,
+		Run:   refreshFunc,
+	}
+	cmd.PersistentFlags().StringVar(&refreshID, "refresh-id", "", "ID of the existing instance refresh to wait for, instead of starting a new one")
+	cmd.PersistentFlags().StringVar(&launchTemplateID, "launch-template-id", "", "launch template ID to refresh the instances to (if empty, refresh to the current launch template of the ASG)")
+	cmd.PersistentFlags().StringVar(&launchTemplateVersion, "launch-template-version", "$Latest", "launch template version to refresh the instances to ($Latest, $Default, or the version number)")
+	cmd.PersistentFlags().Int32Var(&minHealthyPercentage, "min-healthy-percentage", 90, "minimum percentage of the healthy instances during the refresh")
+	cmd.PersistentFlags().Int32Var(&instanceWarmup, "instance-warmup", 0, "seconds for the new instance to warm up before the refresh moves on (0 to use the health check grace period)")
+	cmd.PersistentFlags().BoolVar(&skipMatching, "skip-matching", true, "true to skip replacing the instances that already match the launch template")
+	cmd.PersistentFlags().BoolVar(&autoRollback, "auto-rollback", false, "true to roll back to the previous configuration when the refresh fails")
+
+	cmd.PersistentFlags().BoolVar(&refreshWait, "wait", true, "true to wait for the refresh to complete, and to exit with the non-zero code if the refresh fails")
+	cmd.PersistentFlags().DurationVar(&refreshWaitTimeout, "wait-timeout", 2*time.Hour, "maximum duration to wait for the refresh to complete")
+	cmd.PersistentFlags().DurationVar(&refreshPollInterval, "poll-interval", 30*time.Second, "interval to poll the refresh status")
+	return cmd
+}
+
+func refreshFunc(cmd *cobra.Command, args []string) {
+	if asgName == "" {
+		logutil.S().Warnw("--asg-name is required for the refresh")
+		logutil.Exit(1)
+	}
+
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(1)
+	}
+
+	if refreshID == "" {
+		opts := []asg.OpOption{
+			asg.WithMinHealthyPercentage(minHealthyPercentage),
+			asg.WithInstanceWarmup(instanceWarmup),
+			asg.WithSkipMatching(skipMatching),
+			asg.WithAutoRollback(autoRollback),
+		}
+		if launchTemplateID != "" {
+			opts = append(opts, asg.WithLaunchTemplate(launchTemplateID, launchTemplateVersion))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		refreshID, err = asg.StartInstanceRefresh(ctx, cfg, asgName, opts...)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to start instance refresh", "error", err)
+			logutil.Exit(1)
+		}
+	}
+
+	if !refreshWait {
+		fmt.Println(refreshID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), refreshWaitTimeout)
+	st, err := asg.WaitForRefreshComplete(ctx, cfg, asgName, refreshID,
+		asg.WithInterval(refreshPollInterval),
+		asg.WithProgressFunc(func(st asg.RefreshStatus) {
+			logutil.S().Infow("instance refresh progress", "refreshID", st.ID, "status", st.Status, "percentageComplete", st.PercentageComplete, "instancesToUpdate", st.InstancesToUpdate)
+		}),
+	)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("instance refresh did not complete", "refreshID", refreshID, "status", st.Status, "statusReason", st.StatusReason, "error", err)
+		logutil.Exit(1)
+	}
+
+	logutil.S().Infow("successfully completed instance refresh", "asgName", asgName, "refreshID", refreshID, "took", st.EndTime.Sub(st.StartTime))
+}
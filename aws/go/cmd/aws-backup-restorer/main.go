@@ -0,0 +1,179 @@
+// Data directory backup restorer for AWS.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/backup"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
+	"github.com/gyuho/infra/aws/go/cmd/version"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/spf13/cobra"
+)
+
+const appName = "aws-backup-restorer"
+
+var cmd = &cobra.Command{
+	Use:        appName,
+	Short:      appName,
+	Aliases:    []string{"backup-restorer"},
+	SuggestFor: []string{"backup-restorer"},
+	Run:        cmdFunc,
+}
+
+var (
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+
+	bucket        string
+	dataDir       string
+	asgName       string
+	node          string
+	ordinalTagKey string
+
+	ifEmptyOnly     bool
+	failIfNoBackup  bool
+	downloadTimeout time.Duration
+)
+
+func init() {
+	cobra.EnablePrefixMatching = true
+	cmd.AddCommand(version.NewCommand())
+
+	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region of the backup bucket")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
+
+	cmd.PersistentFlags().StringVar(&bucket, "bucket", "", "S3 bucket to restore the backups from")
+	cmd.PersistentFlags().StringVar(&dataDir, "data-dir", "/data", "data directory to restore into")
+	cmd.PersistentFlags().StringVar(&asgName, "asg-name", "", "ASG name of the backup prefix (leave empty to use the ASG of the local instance)")
+	cmd.PersistentFlags().StringVar(&node, "node", "", "node name of the backup prefix (leave empty to use the ordinal tag, or the instance ID)")
+	cmd.PersistentFlags().StringVar(&ordinalTagKey, "ordinal-tag-key", "AWS_ASG_COORDINATOR_ORDINAL", "instance tag key of the ordinal for the backup prefix, to restore the backups of the replaced instance (leave empty to use the instance ID)")
+
+	cmd.PersistentFlags().BoolVar(&ifEmptyOnly, "if-empty-only", true, "true to only restore when the data directory is empty (except 'lost+found'), to not clobber the existing state")
+	cmd.PersistentFlags().BoolVar(&failIfNoBackup, "fail-if-no-backup", false, "true to exit with the non-zero code when no backup is found (otherwise, the node starts with the empty data directory)")
+	cmd.PersistentFlags().DurationVar(&downloadTimeout, "download-timeout", time.Hour, "timeout to download and extract the backup")
+}
+
+func main() {
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
+		logutil.Exit(1)
+	}
+	logutil.Exit(0)
+}
+
+func cmdFunc(cmd *cobra.Command, args []string) {
+	if bucket == "" {
+		logutil.S().Warnw("empty --bucket")
+		logutil.Exit(1)
+	}
+	logutil.S().Infow("starting 'aws-backup-restorer'", "bucket", bucket, "dataDir", dataDir, "ifEmptyOnly", ifEmptyOnly)
+
+	if ifEmptyOnly {
+		empty, err := backup.IsEmptyDir(dataDir)
+		if err != nil {
+			logutil.S().Warnw("failed to check data directory", "error", err)
+			logutil.Exit(1)
+		}
+		if !empty {
+			logutil.S().Infow("data directory is not empty -- skipping restore", "dataDir", dataDir)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	localInstanceID, err := metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(1)
+	}
+
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
+	}
+
+	if asgName == "" || node == "" {
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		resolvedASG, resolvedNode, err := backup.ResolveNode(ctx, cfg, localInstanceID, asgName, ordinalTagKey)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to resolve backup node", "error", err)
+			logutil.Exit(1)
+		}
+		asgName = resolvedASG
+		if node == "" {
+			node = resolvedNode
+		}
+	}
+	logutil.S().Infow("resolved backup node", "asg", asgName, "node", node)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+	m, err := backup.LatestManifest(ctx, cfg, bucket, asgName, node)
+	cancel()
+	if errors.Is(err, backup.ErrNoBackup) && !failIfNoBackup {
+		logutil.S().Infow("no backup found -- starting with the empty data directory", "asg", asgName, "node", node)
+		return
+	}
+	if err != nil {
+		logutil.S().Warnw("failed to find latest backup", "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), downloadTimeout)
+	files, err := backup.Restore(ctx, cfg, bucket, m, dataDir)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to restore backup", "error", err)
+		logutil.Exit(1)
+	}
+	logutil.S().Infow("successfully restored backup", "archiveKey", m.ArchiveKey, "timestamp", m.Timestamp, "sourceInstanceID", m.InstanceID, "files", files)
+}
@@ -0,0 +1,218 @@
+// Data directory backup uploader for AWS.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/backup"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
+	"github.com/gyuho/infra/aws/go/cmd/version"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/aws/go/notify"
+	"github.com/gyuho/infra/aws/go/s3"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/spf13/cobra"
+)
+
+const appName = "aws-backup-uploader"
+
+var cmd = &cobra.Command{
+	Use:        appName,
+	Short:      appName,
+	Aliases:    []string{"backup-uploader"},
+	SuggestFor: []string{"backup-uploader"},
+	Run:        cmdFunc,
+}
+
+var (
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+
+	bucket        string
+	dataDir       string
+	asgName       string
+	node          string
+	ordinalTagKey string
+
+	compression   string
+	kmsKeyID      string
+	uploadTimeout time.Duration
+
+	retentionCount  int
+	retentionMaxAge time.Duration
+
+	notifyTarget string
+)
+
+func init() {
+	cobra.EnablePrefixMatching = true
+	cmd.AddCommand(version.NewCommand())
+
+	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region of the backup bucket")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
+
+	cmd.PersistentFlags().StringVar(&bucket, "bucket", "", "S3 bucket to upload the backups to")
+	cmd.PersistentFlags().StringVar(&dataDir, "data-dir", "/data", "data directory to back up")
+	cmd.PersistentFlags().StringVar(&asgName, "asg-name", "", "ASG name for the backup prefix (leave empty to use the ASG of the local instance)")
+	cmd.PersistentFlags().StringVar(&node, "node", "", "node name for the backup prefix (leave empty to use the ordinal tag, or the instance ID)")
+	cmd.PersistentFlags().StringVar(&ordinalTagKey, "ordinal-tag-key", "AWS_ASG_COORDINATOR_ORDINAL", "instance tag key of the ordinal for the backup prefix, so the replacement instance finds the backups (leave empty to use the instance ID)")
+
+	cmd.PersistentFlags().StringVar(&compression, "compression", backup.CompressionZstd, "compression of the archive (zstd or gzip)")
+	cmd.PersistentFlags().StringVar(&kmsKeyID, "kms-key-id", "", "KMS key ID, ARN, or alias to encrypt the backups with (SSE-KMS, leave empty to use the bucket default encryption)")
+	cmd.PersistentFlags().DurationVar(&uploadTimeout, "upload-timeout", time.Hour, "timeout to archive and upload the backup")
+
+	cmd.PersistentFlags().IntVar(&retentionCount, "retention-count", 7, "number of the newest backups of the node to keep (0 to keep all)")
+	cmd.PersistentFlags().DurationVar(&retentionMaxAge, "retention-max-age", 0, "maximum age of the backups of the node to keep, except the newest (0 to disable)")
+
+	cmd.PersistentFlags().StringVar(&notifyTarget, "notify-target", "", "SNS topic ARN or SQS queue URL to publish the 'backup-completed' events to as JSON, for the downstream automation (leave empty to skip)")
+}
+
+func main() {
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
+		logutil.Exit(1)
+	}
+	logutil.Exit(0)
+}
+
+func cmdFunc(cmd *cobra.Command, args []string) {
+	if bucket == "" {
+		logutil.S().Warnw("empty --bucket")
+		logutil.Exit(1)
+	}
+	if _, err := backup.ArchiveName(compression); err != nil {
+		logutil.S().Warnw("invalid --compression", "error", err)
+		logutil.Exit(1)
+	}
+	if notifyTarget != "" {
+		if err := notify.ValidateTarget(notifyTarget); err != nil {
+			logutil.S().Warnw("invalid --notify-target", "error", err)
+			logutil.Exit(1)
+		}
+	}
+	logutil.S().Infow("starting 'aws-backup-uploader'", "bucket", bucket, "dataDir", dataDir, "compression", compression)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	localInstanceID, err := metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(1)
+	}
+
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
+	}
+
+	if asgName == "" || node == "" {
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		resolvedASG, resolvedNode, err := backup.ResolveNode(ctx, cfg, localInstanceID, asgName, ordinalTagKey)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to resolve backup node", "error", err)
+			logutil.Exit(1)
+		}
+		asgName = resolvedASG
+		if node == "" {
+			node = resolvedNode
+		}
+	}
+	logutil.S().Infow("resolved backup node", "asg", asgName, "node", node)
+
+	opts := []s3.OpOption{}
+	if kmsKeyID != "" {
+		opts = append(opts, s3.WithSSEKMS(kmsKeyID))
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), uploadTimeout)
+	m, err := backup.Upload(ctx, cfg, bucket, backup.Manifest{
+		ASG:         asgName,
+		Node:        node,
+		InstanceID:  localInstanceID,
+		DataDir:     dataDir,
+		Compression: compression,
+	}, opts...)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to upload backup", "error", err)
+		logutil.Exit(1)
+	}
+	logutil.S().Infow("successfully uploaded backup", "archiveKey", m.ArchiveKey, "size", m.Archive.Size, "sha256", m.Archive.SHA256, "files", m.Archive.Files)
+
+	if notifyTarget != "" {
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		err = notify.Publish(ctx, cfg, notifyTarget, notify.Event{
+			Type:       notify.EventBackupCompleted,
+			Source:     appName,
+			InstanceID: localInstanceID,
+			ASGName:    asgName,
+			Details: map[string]string{
+				"bucket":      bucket,
+				"node":        node,
+				"archive_key": m.ArchiveKey,
+				"size":        fmt.Sprint(m.Archive.Size),
+				"sha256":      m.Archive.SHA256,
+			},
+		})
+		cancel()
+		if err != nil {
+			// the backup is already uploaded
+			logutil.S().Warnw("failed to publish event -- ignoring", "error", err)
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+	pruned, err := backup.Prune(ctx, cfg, bucket, asgName, node, retentionCount, retentionMaxAge)
+	cancel()
+	if err != nil {
+		// the backup is already uploaded, retry on the next run
+		logutil.S().Warnw("failed to prune backups", "error", err)
+		return
+	}
+	logutil.S().Infow("pruned backups", "pruned", pruned)
+}
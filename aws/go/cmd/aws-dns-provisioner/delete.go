@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/route53"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/spf13/cobra"
+)
+
+func newDeleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete",
+		Short: "Deletes the record (and the health check) of the local instance (e.g., on ASG termination lifecycle hook).",
+		Args:  cobra.NoArgs,
+		Run:   deleteFunc,
+	}
+}
+
+func deleteFunc(cmd *cobra.Command, args []string) {
+	logutil.S().Infow("starting 'aws-dns-provisioner delete'")
+
+	cfg, zone, name, opts := discover()
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitInSync+time.Minute)
+	_, err := route53.DeleteRecord(ctx, cfg, zone.ID, name, recordType, opts...)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to delete record", "error", err)
+		logutil.Exit(1)
+	}
+
+	// the health check can only be deleted after the record is deleted
+	if healthCheckPort > 0 {
+		deleteHealthCheck(cfg, name)
+	}
+
+	if localInstancePublishTagKey != "" {
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		err = ec2.DeleteTags(ctx, cfg, []string{localInstanceID}, []string{localInstancePublishTagKey})
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to delete tags", "error", err)
+		}
+	}
+
+	logutil.S().Infow("successfully deleted record", "zoneID", zone.ID, "name", name, "type", recordType)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/route53"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	healthCheckTagKeyRecordName    = "AWS_DNS_PROVISIONER_RECORD_NAME"
+	healthCheckTagKeySetIdentifier = "AWS_DNS_PROVISIONER_SET_IDENTIFIER"
+)
+
+// Returns the tags to find the health check of the record, since the health check
+// has no name and the same record name is shared by the routing policy set members.
+func healthCheckTags(name string) map[string]string {
+	return map[string]string{
+		healthCheckTagKeyRecordName:    name,
+		healthCheckTagKeySetIdentifier: localSetIdentifier,
+	}
+}
+
+// Creates the health check on the IP if not found, or updates the existing one
+// if the IP or port changed (e.g., EIP re-associated). Returns the health check ID.
+func ensureHealthCheck(cfg aws_v2.Config, name string, ip string) string {
+	tags := healthCheckTags(name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	hc, err := route53.FindHealthCheckByTags(ctx, cfg, tags)
+	cancel()
+	switch {
+	case errors.Is(err, route53.ErrHealthCheckNotFound):
+		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+		hc, err = route53.CreateHealthCheck(ctx, cfg, ip, healthCheckPort,
+			route53.WithHealthCheckType(healthCheckType),
+			route53.WithResourcePath(healthCheckPath),
+			route53.WithTags(tags),
+		)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to create health check", "error", err)
+			logutil.Exit(1)
+		}
+
+	case err != nil:
+		logutil.S().Warnw("failed to find health check", "error", err)
+		logutil.Exit(1)
+
+	case hc.IPAddress != ip || hc.Port != healthCheckPort:
+		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+		hc, err = route53.UpdateHealthCheck(ctx, cfg, hc.ID, ip, healthCheckPort, route53.WithResourcePath(healthCheckPath))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to update health check", "error", err)
+			logutil.Exit(1)
+		}
+
+	default:
+		logutil.S().Infow("health check already exists", "id", hc.ID, "ip", hc.IPAddress, "port", hc.Port)
+	}
+	return hc.ID
+}
+
+// Deletes the health check of the record, if any.
+func deleteHealthCheck(cfg aws_v2.Config, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	hc, err := route53.FindHealthCheckByTags(ctx, cfg, healthCheckTags(name))
+	cancel()
+	if errors.Is(err, route53.ErrHealthCheckNotFound) {
+		logutil.S().Infow("health check not found, skipping delete")
+		return
+	}
+	if err != nil {
+		logutil.S().Warnw("failed to find health check", "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	err = route53.DeleteHealthCheck(ctx, cfg, hc.ID)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to delete health check", "error", err)
+		logutil.Exit(1)
+	}
+}
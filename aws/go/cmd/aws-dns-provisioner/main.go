@@ -0,0 +1,305 @@
+// DNS provisioner for AWS, to publish the local instance IPs to the Route 53 hosted zone.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
+	"github.com/gyuho/infra/aws/go/cmd/version"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/aws/go/route53"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+)
+
+const appName = "aws-dns-provisioner"
+
+var cmd = &cobra.Command{
+	Use:        appName,
+	Short:      appName,
+	Aliases:    []string{"dns-provisioner"},
+	SuggestFor: []string{"dns-provisioner"},
+	Run:        cmdFunc,
+}
+
+const (
+	routingPolicySimple   = "simple"
+	routingPolicyWeighted = "weighted"
+	routingPolicyLatency  = "latency"
+	routingPolicyFailover = "failover"
+)
+
+var (
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+	initialWaitRandomSeconds   int
+
+	hostedZoneID   string
+	hostedZoneTags map[string]string
+
+	recordName    string
+	recordType    string
+	ttl           int64
+	routingPolicy string
+	setIdentifier string
+	weight        int64
+	failoverRole  string
+
+	healthCheckPort int32
+	healthCheckType string
+	healthCheckPath string
+
+	eipsFile     string
+	usePrivateIP bool
+	waitInSync   time.Duration
+
+	localInstancePublishTagKey string
+
+	// set by "discover"
+	localInstanceID    string
+	localSetIdentifier string
+)
+
+func init() {
+	cobra.EnablePrefixMatching = true
+	cmd.AddCommand(version.NewCommand(), newDeleteCommand())
+
+	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region of the local instance (for the EC2 API)")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
+	cmd.PersistentFlags().IntVar(&initialWaitRandomSeconds, "initial-wait-random-seconds", 10, "maximum number of seconds to wait (value chosen at random with the range)")
+
+	cmd.PersistentFlags().StringVar(&hostedZoneID, "hosted-zone-id", "", "Route 53 hosted zone ID (if empty, --hosted-zone-tags is used)")
+	cmd.PersistentFlags().StringToStringVar(&hostedZoneTags, "hosted-zone-tags", nil, "tags to find the hosted zone (e.g., Kind=my-zone)")
+
+	cmd.PersistentFlags().StringVar(&recordName, "record-name", "", "record name (if empty, <instance-id>.<zone>)")
+	cmd.PersistentFlags().StringVar(&recordType, "record-type", "A", "record type (A or AAAA)")
+	cmd.PersistentFlags().Int64Var(&ttl, "ttl", 60, "record TTL in seconds")
+	cmd.PersistentFlags().StringVar(&routingPolicy, "routing-policy", routingPolicySimple, "routing policy (simple, weighted, latency, or failover)")
+	cmd.PersistentFlags().StringVar(&setIdentifier, "set-identifier", "", "set identifier for the weighted, latency, or failover routing policy (if empty, the instance ID)")
+	cmd.PersistentFlags().Int64Var(&weight, "weight", 1, "weight for the weighted routing policy (0 to 255)")
+	cmd.PersistentFlags().StringVar(&failoverRole, "failover-role", "primary", "role for the failover routing policy (primary or secondary)")
+
+	cmd.PersistentFlags().Int32Var(&healthCheckPort, "health-check-port", 0, "port to create the Route 53 health check on the published IP with, and to associate with the record (0 to skip)")
+	cmd.PersistentFlags().StringVar(&healthCheckType, "health-check-type", "TCP", "health check type (TCP, HTTP, or HTTPS)")
+	cmd.PersistentFlags().StringVar(&healthCheckPath, "health-check-path", "", "path for the HTTP or HTTPS health check (if empty, \"/\")")
+
+	cmd.PersistentFlags().StringVar(&eipsFile, "eips-file", "", "EIPs file written by the aws-ip-provisioner (e.g., /data/current-eips.json), to publish the associated EIPs (if empty, the instance metadata is used)")
+	cmd.PersistentFlags().BoolVar(&usePrivateIP, "use-private-ip", false, "true to publish the private IPv4 (e.g., for the private hosted zone)")
+	cmd.PersistentFlags().DurationVar(&waitInSync, "wait-in-sync", 2*time.Minute, "duration to wait for the change to propagate to all Route 53 servers (0 to skip)")
+
+	cmd.PersistentFlags().StringVar(&localInstancePublishTagKey, "local-instance-publish-tag-key", "AWS_DNS_PROVISIONER_RECORD_NAME", "tag key to create with the record name to the local EC2 instance")
+}
+
+func main() {
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
+		logutil.Exit(1)
+	}
+	logutil.Exit(0)
+}
+
+func cmdFunc(cmd *cobra.Command, args []string) {
+	initialWait := time.Duration(rand.Intn(initialWaitRandomSeconds+1)) * time.Second
+	logutil.S().Infow("starting 'aws-dns-provisioner'", "initialWait", initialWait)
+	time.Sleep(initialWait)
+
+	cfg, zone, name, opts := discover()
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
+	}
+
+	values, err := recordValues()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch the record values", "error", err)
+		logutil.Exit(1)
+	}
+
+	opts = append(opts, route53.WithTTL(ttl))
+	if healthCheckPort > 0 {
+		// the health check is bound to the first published IP (e.g., the EIP)
+		hcID := ensureHealthCheck(cfg, name, values[0])
+		opts = append(opts, route53.WithHealthCheckID(hcID))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitInSync+time.Minute)
+	_, err = route53.UpsertRecord(ctx, cfg, zone.ID, name, recordType, values, opts...)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to upsert record", "error", err)
+		logutil.Exit(1)
+	}
+
+	if localInstancePublishTagKey != "" {
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		err = ec2.CreateTags(ctx, cfg, []string{localInstanceID}, map[string]string{localInstancePublishTagKey: name})
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to create tags", "error", err)
+			logutil.Exit(1)
+		}
+	}
+
+	logutil.S().Infow("successfully upserted record", "zoneID", zone.ID, "name", name, "type", recordType, "values", values)
+}
+
+// Discovers the local instance and the hosted zone, and returns the record name
+// and the routing policy options.
+func discover() (aws_v2.Config, route53.HostedZone, string, []route53.OpOption) {
+	switch recordType {
+	case "A", "AAAA":
+	default:
+		logutil.S().Warnw("invalid --record-type", "recordType", recordType)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	var err error
+	localInstanceID, err = metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(1)
+	}
+
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	var zone route53.HostedZone
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	switch {
+	case hostedZoneID != "":
+		zone, err = route53.GetHostedZone(ctx, cfg, hostedZoneID)
+	case len(hostedZoneTags) > 0:
+		zone, err = route53.FindHostedZoneByTags(ctx, cfg, hostedZoneTags)
+	default:
+		err = errors.New("empty --hosted-zone-id and --hosted-zone-tags")
+	}
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to find hosted zone", "error", err)
+		logutil.Exit(1)
+	}
+	logutil.S().Infow("found hosted zone", "id", zone.ID, "name", zone.Name, "private", zone.Private)
+
+	name := recordName
+	if name == "" {
+		name = route53.RecordName(localInstanceID, zone.Name)
+	}
+
+	localSetIdentifier = setIdentifier
+	if localSetIdentifier == "" {
+		localSetIdentifier = localInstanceID
+	}
+	opts := []route53.OpOption{route53.WithWait(waitInSync)}
+	switch routingPolicy {
+	case routingPolicySimple:
+	case routingPolicyWeighted:
+		opts = append(opts, route53.WithWeight(localSetIdentifier, weight))
+	case routingPolicyLatency:
+		opts = append(opts, route53.WithLatency(localSetIdentifier, region))
+	case routingPolicyFailover:
+		switch failoverRole {
+		case "primary", "secondary":
+		default:
+			logutil.S().Warnw("invalid --failover-role", "failoverRole", failoverRole)
+			logutil.Exit(1)
+		}
+		opts = append(opts, route53.WithFailover(localSetIdentifier, strings.ToUpper(failoverRole)))
+	default:
+		logutil.S().Warnw("invalid --routing-policy", "routingPolicy", routingPolicy)
+		logutil.Exit(1)
+	}
+	return cfg, zone, name, opts
+}
+
+// Returns the IPs of the local instance to publish.
+func recordValues() ([]string, error) {
+	if recordType == "AAAA" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ip, err := metadata.FetchIPV6(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		return []string{ip}, nil
+	}
+
+	if eipsFile != "" {
+		eips, err := ec2.LoadEIPs(eipsFile)
+		if err != nil {
+			return nil, err
+		}
+		ips := make([]string, 0, len(eips))
+		for _, eip := range eips {
+			ips = append(ips, eip.PublicIP)
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("no EIP found in %q", eipsFile)
+		}
+		return ips, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if usePrivateIP {
+		ip, err := metadata.FetchLocalIPV4(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []string{ip}, nil
+	}
+	ip, err := metadata.FetchPublicIPV4(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []string{ip}, nil
+}
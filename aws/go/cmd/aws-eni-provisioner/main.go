@@ -10,6 +10,7 @@ import (
 	"time"
 
 	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
 	"github.com/gyuho/infra/aws/go/cmd/version"
 	"github.com/gyuho/infra/aws/go/ec2"
 	"github.com/gyuho/infra/aws/go/ec2/metadata"
@@ -30,8 +31,14 @@ var cmd = &cobra.Command{
 }
 
 var (
-	region                   string
-	initialWaitRandomSeconds int
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+	initialWaitRandomSeconds   int
 
 	idTagKey   string
 	idTagValue string
@@ -56,6 +63,12 @@ func init() {
 	cmd.AddCommand(version.NewCommand())
 
 	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region to provision the ENI in")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
 	cmd.PersistentFlags().IntVar(&initialWaitRandomSeconds, "initial-wait-random-seconds", 20, "maximum number of seconds to wait (value chosen at random with the range, highly recommend setting value >=60 because EC2 tags take awhile to pupulate)")
 
 	cmd.PersistentFlags().StringVar(&idTagKey, "id-tag-key", "Id", "key for the ENI 'Id' tag")
@@ -74,9 +87,9 @@ func init() {
 func main() {
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
-	os.Exit(0)
+	logutil.Exit(0)
 }
 
 func cmdFunc(cmd *cobra.Command, args []string) {
@@ -89,15 +102,42 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 
 	cfg, err := aws.New(&aws.Config{
-		Region: region,
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
 	})
 	if err != nil {
 		logutil.S().Warnw("failed to create aws config", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
 	}
 
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
@@ -105,11 +145,11 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to get asg tag value in time", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	if asgNameTagValue == "" {
 		logutil.S().Warnw("failed to get asg tag value in time")
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	logutil.S().Infow("found asg tag", "key", asgNameTagKey, "value", asgNameTagValue)
 
@@ -135,7 +175,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to list ENIs by instance ID", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	if len(curAttached1) > 0 {
 		for _, eni := range curAttached1 {
@@ -163,7 +203,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to list ENIs by tags", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	if len(curAttached2) > 0 {
 		for _, eni := range curAttached2 {
@@ -183,18 +223,18 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	exists, err := fileutil.FileExists(curENIsFile)
 	if err != nil {
 		logutil.S().Warnw("failed to check if ENIs file exists locally", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	if exists {
 		logutil.S().Infow("found ENIs file locally", "file", curENIsFile)
 		b, err := os.ReadFile(curENIsFile)
 		if err != nil {
 			logutil.S().Warnw("failed to read ENIs file", "error", err)
-			os.Exit(1)
+			logutil.Exit(1)
 		}
 		if err := json.Unmarshal(b, &enisToAttach); err != nil {
 			logutil.S().Warnw("failed to load ENIs file", "error", err)
-			os.Exit(1)
+			logutil.Exit(1)
 		}
 	} else {
 		logutil.S().Infow("no ENIs file found locally", "file", curENIsFile)
@@ -214,7 +254,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 		cancel()
 		if err != nil {
 			logutil.S().Warnw("failed to create ENI", "error", err)
-			os.Exit(1)
+			logutil.Exit(1)
 		}
 		enisToAttach = append(enisToAttach, created.ID)
 	}
@@ -223,11 +263,11 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	enisFileContents, err := json.Marshal(enisToAttach)
 	if err != nil {
 		logutil.S().Warnw("failed to marshal ENIs", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	if err := os.WriteFile(curENIsFile, enisFileContents, 0644); err != nil {
 		logutil.S().Warnw("failed to write ENIs file", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	logutil.S().Infow("successfully synced ENIs", "enis", enisToAttach)
 
@@ -247,7 +287,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 		cancel()
 		if err != nil {
 			logutil.S().Warnw("failed to attach ENI", "error", err)
-			os.Exit(1)
+			logutil.Exit(1)
 		}
 	}
 
@@ -262,7 +302,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to create tags", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 
 	logutil.S().Infow("checking after ENIs are attached", "localInstanceID", localInstanceID)
@@ -275,7 +315,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to list ENIs by instance ID", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	if len(curAttached) > 0 {
 		for _, eni := range curAttached {
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
 	"github.com/gyuho/infra/aws/go/cmd/version"
 	"github.com/gyuho/infra/aws/go/ec2"
 	"github.com/gyuho/infra/aws/go/ec2/metadata"
@@ -29,8 +30,14 @@ var cmd = &cobra.Command{
 }
 
 var (
-	region                   string
-	initialWaitRandomSeconds int
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+	initialWaitRandomSeconds   int
 
 	routeTableIDs         []string
 	useLocalSubnetCIDR    bool
@@ -51,6 +58,12 @@ func init() {
 	cmd.AddCommand(version.NewCommand())
 
 	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region to provision the ENI in")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
 	cmd.PersistentFlags().IntVar(&initialWaitRandomSeconds, "initial-wait-random-seconds", 10, "maximum number of seconds to wait (value chosen at random with the range, highly recommend setting value >=60 because EC2 tags take awhile to pupulate)")
 
 	cmd.PersistentFlags().StringSliceVar(&routeTableIDs, "route-table-ids", nil, "route table IDs to create routes")
@@ -65,9 +78,9 @@ func init() {
 func main() {
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
-	os.Exit(0)
+	logutil.Exit(0)
 }
 
 func cmdFunc(cmd *cobra.Command, args []string) {
@@ -77,7 +90,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 
 	if len(routeTableIDs) == 0 {
 		logutil.S().Warnw("empty route table ID")
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -85,15 +98,42 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 
 	cfg, err := aws.New(&aws.Config{
-		Region: region,
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
 	})
 	if err != nil {
 		logutil.S().Warnw("failed to create aws config", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
 	}
 
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
@@ -101,18 +141,18 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to get asg tag value in time", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	if asgNameTagValue == "" {
 		logutil.S().Warnw("failed to get asg tag value in time")
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	logutil.S().Infow("found asg tag", "key", asgNameTagKey, "value", asgNameTagValue)
 
 	if destinationCIDR == "" {
 		if !useLocalSubnetCIDR {
 			logutil.S().Warnw("destination CIDR block not provided, and --use-local-subnet-cidr is false")
-			os.Exit(1)
+			logutil.Exit(1)
 		}
 
 		logutil.S().Infow("destination CIDR block not provided, so fetching the local subnet's CIDR block")
@@ -121,7 +161,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 		cancel()
 		if err != nil {
 			logutil.S().Warnw("failed to get subnet", "error", err)
-			os.Exit(1)
+			logutil.Exit(1)
 		}
 		destinationCIDR = subnet.CIDRBlock
 		logutil.S().Infow("using the local subnet CIDR", "subnetID", subnet.ID, "destinationCIDR", destinationCIDR)
@@ -140,7 +180,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 			cancel()
 			if derr != nil {
 				logutil.S().Warnw("failed to delete blackhole routes", "error", derr)
-				os.Exit(1)
+				logutil.Exit(1)
 			}
 		}
 
@@ -149,7 +189,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 		cancel()
 		if cerr != nil {
 			logutil.S().Warnw("failed to create route", "error", cerr)
-			os.Exit(1)
+			logutil.Exit(1)
 		}
 
 		logutil.S().Infow("created route",
@@ -168,7 +208,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 		cancel()
 		if err != nil {
 			logutil.S().Warnw("failed to get route table", "error", err)
-			os.Exit(1)
+			logutil.Exit(1)
 		}
 
 		instanceRouteFound := false
@@ -187,14 +227,14 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 		}
 		if !instanceRouteFound {
 			logutil.S().Warnw("route not found", "routeTableID", rtbID, "expectedDestinationCIDR", destinationCIDR, "instanceID", localInstanceID)
-			os.Exit(1)
+			logutil.Exit(1)
 		}
 	}
 
 	routesContents, err := json.Marshal(routes)
 	if err != nil {
 		logutil.S().Warnw("failed to marshal routes", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	// ref. https://docs.aws.amazon.com/config/latest/APIReference/API_Tag.html
 	if len(routesContents) > 256 {
@@ -212,7 +252,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to create tags", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 }
 
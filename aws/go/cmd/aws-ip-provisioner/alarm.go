@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gyuho/infra/aws/go/cloudwatch"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var (
+	statusCheckAlarm             bool
+	statusCheckAlarmRecover      bool
+	statusCheckAlarmSNSTopicARNs []string
+)
+
+// Returns the name of the status check alarm of the instance, unique per instance
+// so that the terminated instance's alarm can be deleted without affecting the others.
+func statusCheckAlarmName(instanceID string) string {
+	return fmt.Sprintf("%s-%s-status-check", appName, instanceID)
+}
+
+// Creates (or updates) the status check alarm of the local instance with "--status-check-alarm",
+// notifying "--status-check-alarm-sns-topic-arns" and recovering the instance with "--status-check-alarm-recover".
+func ensureStatusCheckAlarm(cfg aws_v2.Config, instanceID string) error {
+	alarm := cloudwatch.StatusCheckAlarm(statusCheckAlarmName(instanceID), cfg.Region, instanceID, statusCheckAlarmRecover, statusCheckAlarmSNSTopicARNs...)
+	alarm.Tags = map[string]string{kindTagKey: kindTagValue}
+	if dryRun {
+		logutil.S().Infow("[dry-run] would ensure status check alarm", "name", alarm.Name, "metric", alarm.MetricName, "actions", alarm.AlarmActions)
+		return nil
+	}
+
+	var updated bool
+	err := callAWSAudited("PutMetricAlarm", instanceID, map[string]string{"alarmName": alarm.Name}, func(ctx context.Context) (err error) {
+		updated, err = cloudwatch.EnsureAlarm(ctx, cfg, alarm)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	logutil.S().Infow("ensured status check alarm", "name", alarm.Name, "updated", updated)
+	return nil
+}
+
+// Deletes the status check alarm of the local instance (e.g., on termination),
+// so the alarms of the replaced instances do not pile up.
+func deleteStatusCheckAlarm(cfg aws_v2.Config, instanceID string) error {
+	name := statusCheckAlarmName(instanceID)
+	if dryRun {
+		logutil.S().Infow("[dry-run] would delete status check alarm", "name", name)
+		return nil
+	}
+	return callAWSAudited("DeleteAlarms", instanceID, map[string]string{"alarmName": name}, func(ctx context.Context) error {
+		return cloudwatch.DeleteAlarms(ctx, cfg, name)
+	})
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_middleware_v2 "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	smithy_middleware "github.com/aws/smithy-go/middleware"
+)
+
+// Represents a mutating action appended to "--audit-log" as a JSON line,
+// so that the EIP churn can be reconciled without CloudTrail access.
+type auditEvent struct {
+	Time       time.Time         `json:"time"`
+	Action     string            `json:"action"`
+	InstanceID string            `json:"instance_id,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+	RequestIDs []string          `json:"request_ids,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+var auditMu sync.Mutex
+
+// Appends the event to "--audit-log", if enabled.
+// Failing to write the audit log does not fail the provisioner.
+func writeAuditEvent(ev auditEvent) {
+	if auditLog == "" {
+		return
+	}
+	ev.Time = time.Now().UTC()
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		logutil.S().Warnw("failed to marshal audit event", "error", err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(auditLog), 0755); err != nil {
+		logutil.S().Warnw("failed to create audit log directory", "error", err)
+		return
+	}
+	f, err := os.OpenFile(auditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		logutil.S().Warnw("failed to open audit log", "error", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		logutil.S().Warnw("failed to write audit log", "error", err)
+	}
+}
+
+type requestIDsKey struct{}
+
+// Collects the request IDs of the AWS API calls made with the context.
+type requestIDs struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+// Returns the config that records the AWS request IDs
+// to the collector in the request context (see "callAWSAudited").
+func withRequestIDRecorder(cfg aws_v2.Config) aws_v2.Config {
+	cfg = cfg.Copy()
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *smithy_middleware.Stack) error {
+		return stack.Deserialize.Add(
+			smithy_middleware.DeserializeMiddlewareFunc("AuditRequestIDRecorder", func(ctx context.Context, in smithy_middleware.DeserializeInput, next smithy_middleware.DeserializeHandler) (smithy_middleware.DeserializeOutput, smithy_middleware.Metadata, error) {
+				out, md, err := next.HandleDeserialize(ctx, in)
+				if rs, ok := ctx.Value(requestIDsKey{}).(*requestIDs); ok {
+					if id, ok := aws_middleware_v2.GetRequestIDMetadata(md); ok {
+						rs.mu.Lock()
+						rs.ids = append(rs.ids, id)
+						rs.mu.Unlock()
+					}
+				}
+				return out, md, err
+			}),
+			smithy_middleware.Before,
+		)
+	})
+	return cfg
+}
+
+// Same as "callAWS", but also writes the audit event with the request IDs.
+// Use for the mutating calls (e.g., allocate, associate, tag).
+func callAWSAudited(name string, instanceID string, details map[string]string, f func(ctx context.Context) error) error {
+	rs := &requestIDs{}
+	err := callAWS(func(ctx context.Context) error {
+		return f(context.WithValue(ctx, requestIDsKey{}, rs))
+	})
+
+	ev := auditEvent{
+		Action:     name,
+		InstanceID: instanceID,
+		Details:    details,
+		RequestIDs: rs.ids,
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	writeAuditEvent(ev)
+	return err
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+// Environment variable prefix to override the flags
+// (e.g., AWS_IP_PROVISIONER_REGION for "--region").
+const envPrefix = "AWS_IP_PROVISIONER_"
+
+var (
+	configFile         string
+	configFromUserData bool
+)
+
+// Loads the flag values from the environment variables, "--config" file, and the user data.
+// The precedence is: command-line flags > environment variables > config file > user data > defaults.
+//
+// The config file (YAML, JSON, or TOML by the extension) is keyed by the flag names, for example:
+//
+//	region: us-west-2
+//	id-tag-value: my-fleet
+//	eni-device-indexes: [0, 1]
+//	daemon: true
+//
+// Or in TOML:
+//
+//	region = "us-west-2"
+//	id-tag-value = "my-fleet"
+//	eni-device-indexes = [0, 1]
+//	daemon = true
+func loadConfig(c *cobra.Command, args []string) error {
+	vals := make(map[string]interface{})
+	if configFromUserData {
+		uvals, err := loadUserDataConfig(c)
+		if err != nil {
+			return err
+		}
+		for k, v := range uvals {
+			vals[k] = v
+		}
+	}
+	if configFile != "" {
+		b, err := os.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+		fvals := make(map[string]interface{})
+		switch ext := strings.ToLower(filepath.Ext(configFile)); ext {
+		case ".yaml", ".yml", ".json":
+			err = yaml.UnmarshalStrict(b, &fvals)
+		case ".toml":
+			err = toml.Unmarshal(b, &fvals)
+		default:
+			return fmt.Errorf("unsupported config file extension %q (only yaml, json, and toml)", ext)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse config file %q (%w)", configFile, err)
+		}
+		logutil.S().Infow("loaded config file", "file", configFile, "keys", len(fvals))
+
+		flags := c.Flags()
+		for k, v := range fvals {
+			if flags.Lookup(k) == nil {
+				return fmt.Errorf("unknown key %q in config file %q", k, configFile)
+			}
+			vals[k] = v
+		}
+	}
+
+	flags := c.Flags()
+
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "config" || f.Name == "config-from-user-data" {
+			return
+		}
+
+		envKey := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if ev, ok := os.LookupEnv(envKey); ok {
+			if serr := flags.Set(f.Name, ev); serr != nil {
+				err = fmt.Errorf("invalid environment variable %q (%w)", envKey, serr)
+			}
+			return
+		}
+
+		v, ok := vals[f.Name]
+		if !ok {
+			return
+		}
+		if serr := flags.Set(f.Name, configValueString(v)); serr != nil {
+			err = fmt.Errorf("invalid config value for %q (%w)", f.Name, serr)
+		}
+	})
+	return err
+}
+
+// Loads the flag values from the user data, with "{instance-id}" replaced by the local instance ID.
+// The keys are the flag names or the environment variable names (e.g., AWS_IP_PROVISIONER_REGION),
+// and the YAML user data may nest them under the command name (e.g., in "#cloud-config").
+// Unknown keys are ignored, as the user data is shared with the other bootstrap scripts.
+func loadUserDataConfig(c *cobra.Command) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	defer cancel()
+	b, err := metadata.FetchUserData(ctx)
+	if err != nil {
+		if errors.Is(err, metadata.ErrNotFound) {
+			logutil.S().Infow("no user data found -- skipping")
+			return nil, nil
+		}
+		return nil, err
+	}
+	instanceID, err := metadata.FetchInstanceID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]interface{})
+	if err := metadata.ParseUserData(b, &raw, metadata.WithVars(map[string]string{"instance-id": instanceID})); err != nil {
+		return nil, fmt.Errorf("failed to parse user data (%w)", err)
+	}
+	if nested, ok := raw[appName].(map[string]interface{}); ok {
+		raw = nested
+	}
+
+	vals := make(map[string]interface{})
+	flags := c.Flags()
+	for k, v := range raw {
+		name := k
+		if strings.HasPrefix(k, envPrefix) {
+			name = strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(k, envPrefix)), "_", "-")
+		}
+		if name == "config" || name == "config-from-user-data" || flags.Lookup(name) == nil {
+			continue
+		}
+		vals[name] = v
+	}
+	logutil.S().Infow("loaded config from user data", "keys", len(vals))
+	return vals, nil
+}
+
+// Converts the parsed config value to the flag string value.
+// Lists are joined with commas for slice flags.
+func configValueString(v interface{}) string {
+	switch tv := v.(type) {
+	case []interface{}:
+		ss := make([]string, 0, len(tv))
+		for _, e := range tv {
+			ss = append(ss, configValueString(e))
+		}
+		return strings.Join(ss, ",")
+	case map[string]interface{}:
+		// for the map flags (e.g., "--tags")
+		kvs := make([]string, 0, len(tv))
+		for k, e := range tv {
+			kvs = append(kvs, k+"="+configValueString(e))
+		}
+		sort.Strings(kvs)
+		return strings.Join(kvs, ",")
+	case float64:
+		// yaml numbers are decoded as float64
+		if tv == float64(int64(tv)) {
+			return fmt.Sprintf("%d", int64(tv))
+		}
+		return fmt.Sprintf("%v", tv)
+	default:
+		return fmt.Sprintf("%v", tv)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestLoadConfig(t *testing.T) {
+	orig := configFile
+	defer func() { configFile = orig }()
+
+	for _, tv := range []struct {
+		name     string
+		file     string
+		contents string
+		err      bool
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			contents: `region: us-west-2
+eni-device-indexes: [0, 1]
+daemon: true
+max-eips: 3
+tags:
+  team: infra
+`,
+		},
+		{
+			name: "json",
+			file: "config.json",
+			contents: `{"region": "us-west-2", "eni-device-indexes": [0, 1], "daemon": true, "max-eips": 3, "tags": {"team": "infra"}}
+`,
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			contents: `region = "us-west-2"
+eni-device-indexes = [0, 1]
+daemon = true
+max-eips = 3
+
+[tags]
+team = "infra"
+`,
+		},
+		{
+			name:     "toml unknown key",
+			file:     "config.toml",
+			contents: `unknown-key = "x"` + "\n",
+			err:      true,
+		},
+		{
+			name:     "toml invalid",
+			file:     "config.toml",
+			contents: `region = us-west-2` + "\n",
+			err:      true,
+		},
+		{
+			name:     "unsupported extension",
+			file:     "config.ini",
+			contents: "region=us-west-2\n",
+			err:      true,
+		},
+	} {
+		t.Run(tv.name, func(t *testing.T) {
+			var (
+				region  string
+				indexes []int
+				daemon  bool
+				maxEIPs int
+				tags    map[string]string
+			)
+			c := &cobra.Command{}
+			c.Flags().StringVar(&region, "region", "", "")
+			c.Flags().IntSliceVar(&indexes, "eni-device-indexes", nil, "")
+			c.Flags().BoolVar(&daemon, "daemon", false, "")
+			c.Flags().IntVar(&maxEIPs, "max-eips", 1, "")
+			c.Flags().StringToStringVar(&tags, "tags", nil, "")
+
+			configFile = filepath.Join(t.TempDir(), tv.file)
+			if err := os.WriteFile(configFile, []byte(tv.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := loadConfig(c, nil)
+			if tv.err {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if region != "us-west-2" || !reflect.DeepEqual(indexes, []int{0, 1}) || !daemon || maxEIPs != 3 || !reflect.DeepEqual(tags, map[string]string{"team": "infra"}) {
+				t.Fatalf("unexpected values region %q, indexes %v, daemon %v, max-eips %d, tags %v", region, indexes, daemon, maxEIPs, tags)
+			}
+		})
+	}
+}
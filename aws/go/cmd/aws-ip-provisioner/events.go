@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/sqs"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var reconcileQueueURL string
+
+// EventBridge event envelope, as delivered to the SQS target.
+// ref. https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-events-structure.html
+type eventEnvelope struct {
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+const (
+	eventDetailTypeTagChange  = "Tag Change on Resource"
+	eventDetailTypeCloudTrail = "AWS API Call via CloudTrail"
+)
+
+// Detail of the "Tag Change on Resource" event, with all the current tags of the resource.
+// ref. https://docs.aws.amazon.com/tag-editor/latest/userguide/monitor-tag-changes-eventbridge.html
+type tagChangeDetail struct {
+	ChangedTagKeys []string          `json:"changed-tag-keys"`
+	Tags           map[string]string `json:"tags"`
+}
+
+// Detail of the "AWS API Call via CloudTrail" event, only with the tag set of CreateTags/DeleteTags.
+type cloudTrailDetail struct {
+	EventName         string `json:"eventName"`
+	RequestParameters struct {
+		TagSet struct {
+			Items []struct {
+				Key   string  `json:"key"`
+				Value *string `json:"value"`
+			} `json:"items"`
+		} `json:"tagSet"`
+	} `json:"requestParameters"`
+}
+
+// Values of the provisioner tags last written to the local instance (e.g., the lock refresh),
+// to tell its own tag changes from the others (e.g., the manual deletion of the publish tag).
+var selfTags = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// Records the tag value before writing it to the local instance.
+func recordSelfTag(key string, value string) {
+	selfTags.Lock()
+	selfTags.m[key] = value
+	selfTags.Unlock()
+}
+
+func wroteSelfTag(key string, value string) bool {
+	selfTags.Lock()
+	defer selfTags.Unlock()
+	v, ok := selfTags.m[key]
+	return ok && v == value
+}
+
+// Watches "--reconcile-queue-url" for the EC2 address and tag change events
+// routed by the EventBridge rules (e.g., "AWS API Call via CloudTrail" for
+// AssociateAddress/DisassociateAddress/CreateTags, or "Tag Change on Resource"),
+// to trigger the reconcile right away instead of waiting for "--reconcile-interval".
+//
+// Only the events referring to the local instance or its EIPs trigger, except the tag
+// changes made by the provisioner itself (e.g., the lock refresh on every reconcile).
+// The others are deleted right away (so do not share the queue among the instances).
+// The triggering events are deleted once the reconcile succeeds (see "take" and "done"),
+// and left in the queue to be redelivered after the visibility timeout if it fails.
+type eventWatcher struct {
+	cfg      aws_v2.Config
+	queueURL string
+	triggerc chan struct{}
+
+	// tag keys written by the provisioner, to not trigger on its own changes
+	selfTagKeys []string
+
+	mu  sync.Mutex
+	ids []string
+	// triggering events not yet taken by the reconcile
+	pending []sqs.Message
+}
+
+func newEventWatcher(cfg aws_v2.Config, queueURL string, instanceID string, eips ec2.EIPs) *eventWatcher {
+	w := &eventWatcher{
+		cfg:      cfg,
+		queueURL: queueURL,
+		triggerc: make(chan struct{}, 1),
+	}
+	for _, k := range []string{lockTagKey, localInstancePublishTagKey, localInstancePublishIPv6TagKey} {
+		if k != "" {
+			w.selfTagKeys = append(w.selfTagKeys, k)
+		}
+	}
+	w.update(instanceID, eips)
+	return w
+}
+
+// Updates the IDs to match the events with (e.g., the new association IDs after the reconcile).
+func (w *eventWatcher) update(instanceID string, eips ec2.EIPs) {
+	ids := []string{instanceID}
+	for _, eip := range eips {
+		for _, id := range []string{eip.AllocationID, eip.AssociationID, eip.PublicIP} {
+			if id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	w.mu.Lock()
+	w.ids = ids
+	w.mu.Unlock()
+}
+
+// Returns true if the event body refers to the local instance or its EIPs,
+// either as a JSON string value (e.g., "requestParameters.associationId")
+// or at the end of the resource ARN (e.g., "arn:aws:ec2:us-west-2:123456789012:instance/i-1234").
+func (w *eventWatcher) related(body string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, id := range w.ids {
+		if strings.Contains(body, `"`+id+`"`) || strings.Contains(body, `/`+id+`"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the event is the tag change by the provisioner itself, that is,
+// every changed tag is the provisioner tag with the value it last wrote.
+// The deletions and the other events are never self-induced.
+func (w *eventWatcher) selfInduced(ev eventEnvelope) bool {
+	changed := make(map[string]*string)
+	switch ev.DetailType {
+	case eventDetailTypeTagChange:
+		var d tagChangeDetail
+		if err := json.Unmarshal(ev.Detail, &d); err != nil {
+			return false
+		}
+		for _, k := range d.ChangedTagKeys {
+			if v, ok := d.Tags[k]; ok {
+				changed[k] = &v
+			} else {
+				changed[k] = nil
+			}
+		}
+
+	case eventDetailTypeCloudTrail:
+		var d cloudTrailDetail
+		if err := json.Unmarshal(ev.Detail, &d); err != nil || d.EventName != "CreateTags" {
+			return false
+		}
+		for _, item := range d.RequestParameters.TagSet.Items {
+			changed[item.Key] = item.Value
+		}
+
+	default:
+		return false
+	}
+	if len(changed) == 0 {
+		return false
+	}
+
+	for k, v := range changed {
+		if v == nil || !w.isSelfTagKey(k) || !wroteSelfTag(k, *v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *eventWatcher) isSelfTagKey(key string) bool {
+	for _, k := range w.selfTagKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the channel that receives when the reconcile is triggered,
+// coalescing the events received before the reconcile.
+func (w *eventWatcher) triggered() <-chan struct{} {
+	return w.triggerc
+}
+
+// Receives the events with the long polling until the root context is canceled.
+func (w *eventWatcher) run() {
+	logutil.S().Infow("watching reconcile events", "queueURL", w.queueURL)
+	for rootCtx.Err() == nil {
+		ctx, cancel := context.WithTimeout(rootCtx, apiTimeout+20*time.Second)
+		msgs, err := sqs.Receive(ctx, w.cfg, w.queueURL, sqs.WithWaitTime(20*time.Second))
+		cancel()
+		if err != nil {
+			if rootCtx.Err() != nil {
+				return
+			}
+			logutil.S().Warnw("failed to receive reconcile events -- retrying", "error", err)
+			sleepCtx(10 * time.Second)
+			continue
+		}
+
+		for _, msg := range msgs {
+			var ev eventEnvelope
+			if err := json.Unmarshal([]byte(msg.Body), &ev); err != nil {
+				// never matches, so drop instead of redelivering forever
+				logutil.S().Warnw("failed to parse reconcile event -- deleting", "messageID", msg.ID, "error", err)
+				w.delete(msg)
+				continue
+			}
+			if !w.related(msg.Body) {
+				// not for the local instance, so drop instead of redelivering until the retention (or to the DLQ)
+				logutil.S().Debugw("skipping unrelated event -- deleting", "eventID", ev.ID, "detailType", ev.DetailType)
+				w.delete(msg)
+				continue
+			}
+
+			if w.selfInduced(ev) {
+				logutil.S().Debugw("skipping self-induced event", "eventID", ev.ID, "detailType", ev.DetailType)
+				w.delete(msg)
+				continue
+			}
+
+			logutil.S().Infow("received reconcile event", "eventID", ev.ID, "detailType", ev.DetailType, "source", ev.Source)
+			w.mu.Lock()
+			w.pending = append(w.pending, msg)
+			w.mu.Unlock()
+			select {
+			case w.triggerc <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Takes the triggering events received so far, to be passed to "done" after the reconcile.
+func (w *eventWatcher) take() []sqs.Message {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	msgs := w.pending
+	w.pending = nil
+	return msgs
+}
+
+// Deletes the taken events if the reconcile succeeded.
+// Otherwise, leaves them in the queue to trigger again after the visibility timeout.
+func (w *eventWatcher) done(msgs []sqs.Message, reconcileErr error) {
+	if reconcileErr != nil {
+		if len(msgs) > 0 {
+			logutil.S().Warnw("leaving reconcile events in the queue to retry", "events", len(msgs), "error", reconcileErr)
+		}
+		return
+	}
+	for _, msg := range msgs {
+		w.delete(msg)
+	}
+}
+
+func (w *eventWatcher) delete(msg sqs.Message) {
+	ctx, cancel := context.WithTimeout(rootCtx, apiTimeout)
+	err := sqs.Delete(ctx, w.cfg, w.queueURL, msg.ReceiptHandle)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to delete reconcile event", "messageID", msg.ID, "error", err)
+	}
+}
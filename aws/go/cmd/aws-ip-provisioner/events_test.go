@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// "Tag Change on Resource" event, as sent by the tag service to the EventBridge.
+const tagChangeEvent = `{
+  "version": "0",
+  "id": "bddcf1d6-0251-35a1-aab0-adc1fb47c11c",
+  "detail-type": "Tag Change on Resource",
+  "source": "aws.tag",
+  "account": "123456789012",
+  "time": "2018-09-18T20:41:38Z",
+  "region": "us-east-1",
+  "resources": [
+    "arn:aws:ec2:us-east-1:123456789012:instance/i-0000000aaaaaaaaaa"
+  ],
+  "detail": {
+    "changed-tag-keys": [%s],
+    "service": "ec2",
+    "resource-type": "instance",
+    "version": 3,
+    "tags": {
+      "AWS_IP_PROVISIONER_LOCK": "abcdefghij012345_1537303298",
+      "AWS_IP_PROVISIONER_EIPS": "eipalloc-0:1.2.3.4",
+      "aws:autoscaling:groupName": "my-asg",
+      "Name": "my-instance"
+    }
+  }
+}`
+
+// "AWS API Call via CloudTrail" event of CreateTags (or DeleteTags) on the instance.
+const cloudTrailTagsEvent = `{
+  "version": "0",
+  "id": "6a7e8feb-b491-4cf7-a9f1-bf3703467718",
+  "detail-type": "AWS API Call via CloudTrail",
+  "source": "aws.ec2",
+  "account": "123456789012",
+  "time": "2018-09-18T20:41:38Z",
+  "region": "us-east-1",
+  "resources": [],
+  "detail": {
+    "eventVersion": "1.08",
+    "userIdentity": {
+      "type": "AssumedRole",
+      "principalId": "AROAEXAMPLE:i-0000000aaaaaaaaaa",
+      "arn": "arn:aws:sts::123456789012:assumed-role/my-role/i-0000000aaaaaaaaaa",
+      "accountId": "123456789012"
+    },
+    "eventTime": "2018-09-18T20:41:38Z",
+    "eventSource": "ec2.amazonaws.com",
+    "eventName": "%s",
+    "awsRegion": "us-east-1",
+    "sourceIPAddress": "10.0.0.1",
+    "userAgent": "aws-sdk-go-v2/1.32.6",
+    "requestParameters": {
+      "resourcesSet": {
+        "items": [{"resourceId": "i-0000000aaaaaaaaaa"}]
+      },
+      "tagSet": {
+        "items": [%s]
+      }
+    },
+    "responseElements": {
+      "requestId": "1e1a2a3f-4b5c-6d7e-8f90-a1b2c3d4e5f6",
+      "_return": true
+    },
+    "requestID": "1e1a2a3f-4b5c-6d7e-8f90-a1b2c3d4e5f6",
+    "eventID": "0a1b2c3d-4e5f-6789-0abc-def012345678",
+    "readOnly": false,
+    "eventType": "AwsApiCall",
+    "managementEvent": true,
+    "recipientAccountId": "123456789012",
+    "eventCategory": "Management"
+  }
+}`
+
+func TestEventWatcherSelfInduced(t *testing.T) {
+	w := &eventWatcher{selfTagKeys: []string{"AWS_IP_PROVISIONER_LOCK", "AWS_IP_PROVISIONER_EIPS", "AWS_IP_PROVISIONER_IPV6"}}
+	recordSelfTag("AWS_IP_PROVISIONER_LOCK", "abcdefghij012345_1537303298")
+	recordSelfTag("AWS_IP_PROVISIONER_EIPS", "eipalloc-0:1.2.3.4")
+
+	tests := []struct {
+		name        string
+		body        string
+		selfInduced bool
+	}{
+		{
+			name:        "lock refresh",
+			body:        fmt.Sprintf(tagChangeEvent, `"AWS_IP_PROVISIONER_LOCK"`),
+			selfInduced: true,
+		},
+		{
+			name:        "lock refresh and publish",
+			body:        fmt.Sprintf(tagChangeEvent, `"AWS_IP_PROVISIONER_LOCK", "AWS_IP_PROVISIONER_EIPS"`),
+			selfInduced: true,
+		},
+		{
+			name: "publish tag deleted",
+			body: fmt.Sprintf(tagChangeEvent, `"AWS_IP_PROVISIONER_IPV6"`),
+		},
+		{
+			name: "other tag changed with the lock tag present",
+			body: fmt.Sprintf(tagChangeEvent, `"Name"`),
+		},
+		{
+			name: "lock refresh with other tag",
+			body: fmt.Sprintf(tagChangeEvent, `"AWS_IP_PROVISIONER_LOCK", "Name"`),
+		},
+		{
+			name:        "CreateTags of lock",
+			body:        fmt.Sprintf(cloudTrailTagsEvent, "CreateTags", `{"key": "AWS_IP_PROVISIONER_LOCK", "value": "abcdefghij012345_1537303298"}`),
+			selfInduced: true,
+		},
+		{
+			name: "CreateTags of publish with another value",
+			body: fmt.Sprintf(cloudTrailTagsEvent, "CreateTags", `{"key": "AWS_IP_PROVISIONER_EIPS", "value": "eipalloc-1:5.6.7.8"}`),
+		},
+		{
+			name: "DeleteTags of publish",
+			body: fmt.Sprintf(cloudTrailTagsEvent, "DeleteTags", `{"key": "AWS_IP_PROVISIONER_EIPS"}`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ev eventEnvelope
+			if err := json.Unmarshal([]byte(tt.body), &ev); err != nil {
+				t.Fatal(err)
+			}
+			if v := w.selfInduced(ev); v != tt.selfInduced {
+				t.Fatalf("expected self-induced %v, got %v", tt.selfInduced, v)
+			}
+		})
+	}
+}
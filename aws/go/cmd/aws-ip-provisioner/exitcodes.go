@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+)
+
+// Exit codes per failure class, so that systemd "RestartPreventExitStatus=" or
+// the wrapper scripts can act differently per failure (e.g., do not restart on credentials failure).
+const (
+	exitCodeGeneric     = 1
+	exitCodeMetadata    = 10
+	exitCodeCredentials = 11
+	exitCodeAllocation  = 12
+	exitCodeAssociation = 13
+	exitCodeTag         = 14
+	exitCodeLocked      = 15
+	exitCodeHook        = 16
+)
+
+var credentialsErrors = []string{
+	"AuthFailure",
+	"UnauthorizedOperation",
+	"AccessDenied",
+	"ExpiredToken",
+	"InvalidClientTokenId",
+	"SignatureDoesNotMatch",
+	"failed to retrieve credentials",
+	"failed to refresh cached credentials",
+	"no EC2 IMDS role found",
+}
+
+// Returns the exit code for the error,
+// where the credentials errors take precedence over the failure class.
+func exitCode(err error, code int) int {
+	if err == nil {
+		return code
+	}
+	if ec2.IsUnauthorized(err) {
+		return exitCodeCredentials
+	}
+	msg := err.Error()
+	for _, s := range credentialsErrors {
+		if strings.Contains(msg, s) {
+			return exitCodeCredentials
+		}
+	}
+	return code
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/sts"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Runs "--post-associate-exec" with "/bin/sh -c" after the EIPs are successfully associated
+// (e.g., to update the local nginx/keepalived config, or to notify the control plane).
+// The EIPs are passed as the environment variables (e.g., EIP_PUBLIC_IP, see "toEnvVars"),
+// along with the instance ID (EIP_INSTANCE_ID).
+// With "--post-associate-exec-credentials", the credentials of the provisioner
+// are passed as well (e.g., AWS_ACCESS_KEY_ID, AWS_REGION).
+func runPostAssociateExec(cfg aws_v2.Config, instanceID string, eips ec2.EIPs) error {
+	curAssociated, err := listAssociatedEIPs(cfg, instanceID)
+	if err != nil {
+		return err
+	}
+	env := append(os.Environ(), "EIP_INSTANCE_ID="+instanceID)
+	env = append(env, toEnvVars(toEIPOutputs(eips, curAssociated))...)
+	if postAssociateExecCreds {
+		ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+		creds, err := sts.RetrieveCredentials(ctx, cfg)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve credentials for post-associate command %w", err)
+		}
+		env = append(env, creds.EnvVars()...)
+		env = append(env, "AWS_REGION="+cfg.Region)
+	}
+
+	if dryRun {
+		logutil.S().Infow("[dry-run] would run post-associate command", "command", postAssociateExec)
+		return nil
+	}
+
+	for i := 0; i <= postAssociateExecRetries; i++ {
+		if i > 0 {
+			backoff := retryBackoff(i)
+			logutil.S().Warnw("retrying post-associate command", "attempt", i, "backoff", backoff, "error", err)
+			if !sleepCtx(backoff) {
+				return rootCtx.Err()
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(rootCtx, postAssociateExecTimeout)
+		c := exec.CommandContext(ctx, "/bin/sh", "-c", postAssociateExec)
+		c.Env = env
+		var out []byte
+		out, err = c.CombinedOutput()
+		cancel()
+		if err == nil {
+			logutil.S().Infow("successfully ran post-associate command", "command", postAssociateExec, "output", string(out))
+			return nil
+		}
+		err = fmt.Errorf("%w (output %q)", err, string(out))
+	}
+	return err
+}
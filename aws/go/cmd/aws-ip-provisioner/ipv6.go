@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	addressFamilyIPv4 = "ipv4"
+	addressFamilyIPv6 = "ipv6"
+	addressFamilyDual = "dual"
+)
+
+func validateAddressFamily(v string) error {
+	switch v {
+	case addressFamilyIPv4, addressFamilyIPv6, addressFamilyDual:
+		return nil
+	default:
+		return fmt.Errorf("unknown address family %q", v)
+	}
+}
+
+// Represents the IPv6 address written to "--current-ipv6-file".
+type ipv6Address struct {
+	ENIID   string `json:"eni_id"`
+	Address string `json:"address"`
+}
+
+// Assigns an IPv6 address from the subnet's IPv6 CIDR to the primary ENI,
+// or returns the one already assigned (e.g., on reboot).
+// Unlike EIPs, the IPv6 address stays with the ENI across instance stop/start,
+// so there is no need to re-associate.
+func provisionIPv6(cfg aws_v2.Config, instanceID string) (ipv6Address, error) {
+	var enis ec2.ENIs
+	err := callAWS(func(ctx context.Context) (err error) {
+		enis, err = ec2.GetENIsByInstanceID(ctx, cfg, instanceID)
+		return err
+	})
+	if err != nil {
+		return ipv6Address{}, err
+	}
+
+	var primary ec2.ENI
+	found := false
+	for _, eni := range enis {
+		if eni.AttachmentDeviceIndex == 0 {
+			primary = eni
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ipv6Address{}, errors.New("primary ENI not found")
+	}
+
+	if len(primary.IPv6Addresses) > 0 {
+		logutil.S().Infow("IPv6 address already assigned to the primary ENI", "eniID", primary.ID, "address", primary.IPv6Addresses[0])
+		return ipv6Address{ENIID: primary.ID, Address: primary.IPv6Addresses[0]}, nil
+	}
+	if dryRun {
+		logutil.S().Infow("[dry-run] would assign IPv6 address to the primary ENI", "eniID", primary.ID)
+		return ipv6Address{ENIID: primary.ID}, nil
+	}
+
+	var addrs []string
+	details := map[string]string{"eniID": primary.ID}
+	err = callAWSAudited("AssignIpv6Addresses", instanceID, details, func(ctx context.Context) (err error) {
+		addrs, err = ec2.AssignIPv6Addresses(ctx, cfg, primary.ID, 1)
+		if len(addrs) > 0 {
+			details["address"] = addrs[0]
+		}
+		return err
+	})
+	if err != nil {
+		return ipv6Address{}, err
+	}
+	if len(addrs) == 0 {
+		return ipv6Address{}, errors.New("no IPv6 address assigned (subnet may not have IPv6 CIDR)")
+	}
+	return ipv6Address{ENIID: primary.ID, Address: addrs[0]}, nil
+}
+
+// Publishes the IPv6 address to the local file and the local instance tag,
+// same as the EIPs.
+func publishIPv6(cfg aws_v2.Config, instanceID string, addr ipv6Address) error {
+	b, err := json.Marshal(addr)
+	if err != nil {
+		return err
+	}
+	s := string(b)
+
+	if dryRun {
+		logutil.S().Infow("[dry-run] would write IPv6 file and create tags", "file", curIPv6File, "key", localInstancePublishIPv6TagKey, "value", s)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(curIPv6File), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(curIPv6File, b, 0644); err != nil {
+		return err
+	}
+	recordSelfTag(localInstancePublishIPv6TagKey, s)
+	return callAWSAudited("CreateTags", instanceID, map[string]string{localInstancePublishIPv6TagKey: s}, func(ctx context.Context) error {
+		return ec2.CreateTags(ctx, cfg, []string{instanceID}, map[string]string{localInstancePublishIPv6TagKey: s})
+	})
+}
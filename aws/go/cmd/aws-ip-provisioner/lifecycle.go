@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/asg"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var (
+	lifecycleHookName          string
+	lifecycleHeartbeatInterval time.Duration
+)
+
+// Starts the lifecycle heartbeat if "--lifecycle-hook-name" is set, so the hook does not
+// time out while the EIPs are released. Returns the function to stop the heartbeat and
+// to complete the lifecycle action, to be called once the release succeeds.
+// On failure, the process exits without completing, and the hook times out with its default result.
+func startLifecycleAction(cfg aws_v2.Config, instanceID string) (complete func()) {
+	if lifecycleHookName == "" {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	asgName, err := asg.FindASGName(ctx, cfg, instanceID)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to find the auto scaling group of the local instance", "error", err)
+		logutil.Exit(exitCode(err, exitCodeGeneric))
+	}
+
+	stop := func() {}
+	if dryRun {
+		logutil.S().Infow("[dry-run] would record lifecycle heartbeats", "asg", asgName, "hook", lifecycleHookName, "interval", lifecycleHeartbeatInterval)
+	} else {
+		stop = asg.StartLifecycleHeartbeat(rootCtx, cfg, asgName, lifecycleHookName, instanceID, asg.WithInterval(lifecycleHeartbeatInterval))
+	}
+	return func() {
+		stop()
+
+		if dryRun {
+			logutil.S().Infow("[dry-run] would complete lifecycle action", "asg", asgName, "hook", lifecycleHookName)
+			return
+		}
+		ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+		err := asg.CompleteLifecycleAction(ctx, cfg, asgName, lifecycleHookName, instanceID, asg.LifecycleActionContinue)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to complete lifecycle action", "error", err)
+			logutil.Exit(exitCode(err, exitCodeGeneric))
+		}
+	}
+}
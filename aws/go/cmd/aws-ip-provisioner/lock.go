@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+	"github.com/gyuho/infra/go/randutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Instance lock claim older than this is considered abandoned (e.g., the holder crashed).
+// The daemon refreshes its claim every reconcile interval, so the interval must be shorter.
+const instanceLockExpiry = 15 * time.Minute
+
+const instanceLockNonceLen = 16
+
+var errLocked = errors.New("another provisioner is running")
+
+// Acquires the exclusive flock on "--lock-file", so that only one provisioner
+// runs on the host (e.g., systemd restart races).
+// The lock is released when the process exits, so the file is never removed.
+func acquireFileLock() (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(lockFile), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%w (lock file %q)", errLocked, lockFile)
+		}
+		return nil, err
+	}
+	logutil.S().Infow("acquired lock file", "file", lockFile)
+	return f, nil
+}
+
+// Returns the instance lock nonce persisted in the flocked lock file, or writes a new one,
+// so the restarted provisioner (e.g., systemd restart after a failure) reuses its own claim
+// left in the tag, instead of being locked out until the claim expires.
+// Without the lock file (nil), a new nonce is used for every run.
+func loadOrCreateNonce(f *os.File) (string, error) {
+	if f == nil {
+		return randutil.StringAlphabetsLowerCaseNumeric(instanceLockNonceLen), nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	if nonce := strings.TrimSpace(string(b)); isValidNonce(nonce) {
+		logutil.S().Infow("reusing instance lock nonce", "file", f.Name())
+		return nonce, nil
+	}
+
+	nonce := randutil.StringAlphabetsLowerCaseNumeric(instanceLockNonceLen)
+	if err := f.Truncate(0); err != nil {
+		return "", err
+	}
+	if _, err := f.WriteAt([]byte(nonce), 0); err != nil {
+		return "", err
+	}
+	return nonce, f.Sync()
+}
+
+// Returns true if the nonce is lower-case alphanumeric,
+// as the lock tag value is "<nonce>_<unix timestamp>".
+func isValidNonce(nonce string) bool {
+	if len(nonce) != instanceLockNonceLen {
+		return false
+	}
+	for _, c := range nonce {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Claims the local instance with the "--lock-tag-key" tag of the random nonce,
+// so that only one provisioner makes the mutating calls for the instance,
+// even across the hosts that do not share the lock file (e.g., containers).
+// EC2 does not support conditional tagging, so it writes the nonce,
+// waits for the racing provisioners to overwrite, and checks that the nonce is still ours.
+type instanceLock struct {
+	cfg        aws_v2.Config
+	instanceID string
+	nonce      string
+}
+
+func newInstanceLock(cfg aws_v2.Config, instanceID string, nonce string) *instanceLock {
+	return &instanceLock{
+		cfg:        cfg,
+		instanceID: instanceID,
+		nonce:      nonce,
+	}
+}
+
+// Acquires the claim, or refreshes the claim timestamp if already held.
+func (l *instanceLock) acquire() error {
+	var cur string
+	err := callAWS(func(ctx context.Context) (err error) {
+		cur, _, err = ec2.GetTagValue(ctx, l.cfg, l.instanceID, lockTagKey)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if cur == "" {
+		// not claimed yet
+	} else if holder, claimedAt, ok := parseLeaseValue(cur); ok && holder != l.nonce && time.Since(claimedAt) < instanceLockExpiry {
+		logutil.S().Warnw("instance claimed by another provisioner", "tagKey", lockTagKey, "holder", holder, "claimedAt", claimedAt)
+		return errLocked
+	}
+	if dryRun {
+		logutil.S().Infow("[dry-run] would claim instance", "tagKey", lockTagKey, "nonce", l.nonce)
+		return nil
+	}
+
+	v := fmt.Sprintf("%s_%d", l.nonce, time.Now().UTC().Unix())
+	recordSelfTag(lockTagKey, v)
+	err = callAWSAudited("CreateTags", l.instanceID, map[string]string{lockTagKey: v}, func(ctx context.Context) error {
+		return ec2.CreateTags(ctx, l.cfg, []string{l.instanceID}, map[string]string{lockTagKey: v})
+	})
+	if err != nil {
+		return err
+	}
+
+	// wait for the other racing provisioners to overwrite the claim, if any
+	if !sleepCtx(5 * time.Second) {
+		return rootCtx.Err()
+	}
+
+	err = callAWS(func(ctx context.Context) (err error) {
+		cur, _, err = ec2.GetTagValue(ctx, l.cfg, l.instanceID, lockTagKey)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if cur != v {
+		logutil.S().Warnw("instance claimed by another provisioner after claim", "tagKey", lockTagKey, "expected", v, "current", cur)
+		return errLocked
+	}
+	logutil.S().Infow("claimed instance", "tagKey", lockTagKey, "value", v)
+	return nil
+}
+
+// Releases the claim, only if it's still ours.
+func (l *instanceLock) release() {
+	if dryRun {
+		logutil.S().Infow("[dry-run] would release instance claim", "tagKey", lockTagKey)
+		return
+	}
+
+	// root context may have been canceled, so use a new context
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+	cur, _, err := ec2.GetTagValue(ctx, l.cfg, l.instanceID, lockTagKey)
+	if err != nil {
+		logutil.S().Warnw("failed to get instance claim", "error", err)
+		return
+	}
+	if cur == "" {
+		return
+	}
+	if holder, _, ok := parseLeaseValue(cur); !ok || holder != l.nonce {
+		return
+	}
+	if err := ec2.DeleteTags(ctx, l.cfg, []string{l.instanceID}, []string{lockTagKey}); err != nil {
+		logutil.S().Warnw("failed to release instance claim", "error", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateNonce(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "aws-ip-provisioner.lock")
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := loadOrCreateNonce(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if !isValidNonce(nonce) {
+		t.Fatalf("invalid nonce %q", nonce)
+	}
+
+	// restarted process reuses the nonce
+	f, err = os.OpenFile(p, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reused, err := loadOrCreateNonce(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused != nonce {
+		t.Fatalf("expected nonce %q, got %q", nonce, reused)
+	}
+
+	// corrupted nonce is replaced
+	if err := os.WriteFile(p, []byte("bad_nonce"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := loadOrCreateNonce(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isValidNonce(replaced) || replaced == nonce {
+		t.Fatalf("unexpected replaced nonce %q", replaced)
+	}
+	if b, err := os.ReadFile(p); err != nil || string(b) != replaced {
+		t.Fatalf("unexpected lock file %q (%v)", b, err)
+	}
+
+	if n, err := loadOrCreateNonce(nil); err != nil || !isValidNonce(n) {
+		t.Fatalf("unexpected nonce %q (%v)", n, err)
+	}
+}
@@ -4,18 +4,28 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
 	"github.com/gyuho/infra/aws/go/cmd/version"
 	"github.com/gyuho/infra/aws/go/ec2"
 	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/aws/go/notify"
+	"github.com/gyuho/infra/aws/go/sqs"
+	"github.com/gyuho/infra/aws/go/ssm"
 	"github.com/gyuho/infra/go/fileutil"
 	"github.com/gyuho/infra/go/logutil"
 
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/spf13/cobra"
 )
 
@@ -27,11 +37,24 @@ var cmd = &cobra.Command{
 	Aliases:    []string{"ip-provisioner"},
 	SuggestFor: []string{"ip-provisioner"},
 	Run:        cmdFunc,
+
+	PersistentPreRunE: loadConfig,
 }
 
 var (
-	region                   string
-	initialWaitRandomSeconds int
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+	initialWaitRandomSeconds   int
+	tagPollInterval            time.Duration
+
+	assumeRoleARN         string
+	assumeRoleExternalID  string
+	assumeRoleSessionName string
 
 	idTagKey   string
 	idTagValue string
@@ -39,8 +62,59 @@ var (
 	kindTagKey   string
 	kindTagValue string
 
+	extraTags map[string]string
+
 	curEIPsFile                string
 	localInstancePublishTagKey string
+
+	addressFamily                  string
+	curIPv6File                    string
+	localInstancePublishIPv6TagKey string
+
+	daemon               bool
+	reconcileInterval    time.Duration
+	metricsListenAddress string
+	logAPICalls          bool
+
+	dryRun bool
+	strict bool
+
+	lockFile      string
+	lockTagKey    string
+	releasingFile string
+
+	reusePoolTagKey        string
+	reusePoolTagValue      string
+	reusePoolLeaseHoldKey  string
+	reusePoolAllowAllocate bool
+
+	eniDeviceIndexes []int
+	privateIP        string
+
+	maxEIPsPerInstance int
+	evictExtraEIPs     bool
+
+	publicIPv4Pool        string
+	customerOwnedIPv4Pool string
+
+	apiTimeout    time.Duration
+	apiMaxRetries int
+	ec2Endpoint   string
+
+	outputFormat string
+	outputFile   string
+
+	publishSSMParameter string
+
+	reverseDNSDomainName string
+
+	auditLog       string
+	waitReportFile string
+
+	postAssociateExec        string
+	postAssociateExecTimeout time.Duration
+	postAssociateExecRetries int
+	postAssociateExecCreds   bool
 )
 
 // Do not use "aws:" for custom tag creation, as it's not allowed.
@@ -50,10 +124,20 @@ const asgNameTagKey = "autoscaling:groupName"
 
 func init() {
 	cobra.EnablePrefixMatching = true
-	cmd.AddCommand(version.NewCommand())
+	cmd.AddCommand(version.NewCommand(), newReleaseCommand(), newStatusCommand(), newPeersCommand())
+
+	cmd.PersistentFlags().StringVar(&configFile, "config", "", "YAML, JSON, or TOML config file by the extension, keyed by the flag names (e.g., /etc/aws-ip-provisioner.yaml), overridden by "+envPrefix+"* environment variables and command-line flags")
+	cmd.PersistentFlags().BoolVar(&configFromUserData, "config-from-user-data", false, "true to also load the flag values from the instance user data (key=value lines such as "+envPrefix+"REGION=us-west-2, or YAML keyed by the flag names optionally under the '"+appName+"' key), overridden by the config file")
 
-	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region to provision the EIP in")
+	cmd.PersistentFlags().StringVar(&region, "region", "", "region to provision the EIP in (leave empty to use AWS_REGION, or to auto-detect from the instance metadata)")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
 	cmd.PersistentFlags().IntVar(&initialWaitRandomSeconds, "initial-wait-random-seconds", 30, "maximum number of seconds to wait (value chosen at random with the range, highly recommend setting value >=60 because EC2 tags take awhile to pupulate)")
+	cmd.PersistentFlags().DurationVar(&tagPollInterval, "tag-poll-interval", 10*time.Second, "initial interval to poll the ASG name tag of the local instance (backs off exponentially up to a minute)")
 
 	cmd.PersistentFlags().StringVar(&idTagKey, "id-tag-key", "Id", "key for the EIP 'Id' tag")
 	cmd.PersistentFlags().StringVar(&idTagValue, "id-tag-value", "", "value for the EIP 'Id' tag key")
@@ -61,69 +145,301 @@ func init() {
 	cmd.PersistentFlags().StringVar(&kindTagKey, "kind-tag-key", "Kind", "key for the EIP 'Kind' tag")
 	cmd.PersistentFlags().StringVar(&kindTagValue, "kind-tag-value", "aws-ip-provisioner", "value for the EIP 'Kind' tag key")
 
+	cmd.PersistentFlags().StringToStringVar(&extraTags, "tags", nil, "extra tags for the allocated EIPs (e.g., Team=infra,Env=prod for cost allocation)")
+
 	cmd.PersistentFlags().StringVar(&curEIPsFile, "current-eips-file", "/data/current-eips.json", "file path to write the current EIP (useful for paused instances)")
 	cmd.PersistentFlags().StringVar(&localInstancePublishTagKey, "local-instance-publish-tag-key", "AWS_IP_PROVISIONER_EIPS", "tag key to create with the resource value to the local EC2 instance")
+
+	cmd.PersistentFlags().StringVar(&addressFamily, "address-family", addressFamilyIPv4, "address family to provision (ipv4 for EIPs, ipv6 to assign an IPv6 address from the subnet to the primary ENI, dual for both)")
+	cmd.PersistentFlags().StringVar(&curIPv6File, "current-ipv6-file", "/data/current-ipv6.json", "file path to write the current IPv6 address (only used with --address-family ipv6 or dual)")
+	cmd.PersistentFlags().StringVar(&localInstancePublishIPv6TagKey, "local-instance-publish-ipv6-tag-key", "AWS_IP_PROVISIONER_IPV6", "tag key to create with the IPv6 address to the local EC2 instance")
+
+	cmd.PersistentFlags().BoolVar(&daemon, "daemon", false, "true to keep running after provisioning, and periodically re-associate the EIP if the association was lost (e.g., instance stop/start)")
+	cmd.PersistentFlags().DurationVar(&reconcileInterval, "reconcile-interval", 5*time.Minute, "interval to check whether the EIP is still associated with the local instance (only used with --daemon, must be shorter than 15 minutes with --lock-tag-key to refresh the claim)")
+	cmd.PersistentFlags().StringVar(&reconcileQueueURL, "reconcile-queue-url", "", "SQS queue URL bound to the EventBridge rules on the EC2 address and tag changes, to reconcile right away on the events of the local instance or its EIPs (the other events are deleted, so use a queue per instance; only used with --daemon, leave empty to only reconcile on the interval)")
+	cmd.PersistentFlags().StringVar(&metricsListenAddress, "metrics-listen-address", "", "address to serve the Prometheus metrics on '/metrics' (e.g., :9100, only used with --daemon, leave empty to disable)")
+	cmd.PersistentFlags().BoolVar(&logAPICalls, "log-api-calls", false, "true to log every AWS API call with its duration, retries, and request ID (the retried or throttled calls are always logged)")
+
+	cmd.PersistentFlags().BoolVar(&skipInWarmPool, "skip-in-warm-pool", true, "true to skip provisioning while the instance is being warmed to be stopped (or hibernated) in the ASG warm pool, and to reuse the recorded EIPs when started from the warm pool")
+
+	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "true to only log the EIP allocation/association and tag creation calls, without executing them")
+	cmd.PersistentFlags().BoolVar(&strict, "strict", false, "true to exit with the non-zero code when the EIPs are associated but failed to be published (e.g., instance tag, output file)")
+
+	cmd.PersistentFlags().StringVar(&lockFile, "lock-file", "/var/run/aws-ip-provisioner.lock", "file path to flock, so that only one provisioner runs on the host (leave empty to disable)")
+	cmd.PersistentFlags().StringVar(&lockTagKey, "lock-tag-key", "AWS_IP_PROVISIONER_LOCK", "tag key to claim the local instance with a nonce (persisted in --lock-file to reuse across restarts), so that only one provisioner makes mutating calls for the instance (leave empty to disable)")
+	cmd.PersistentFlags().StringVar(&releasingFile, "releasing-file", "/var/run/aws-ip-provisioner.releasing", "file path written by 'release', so that the provisioner (and the running --daemon) does not associate the EIPs again until the file is removed (e.g., on reboot) (leave empty to disable)")
+
+	cmd.PersistentFlags().StringVar(&reusePoolTagKey, "reuse-pool-tag-key", "", "tag key of the pre-allocated EIP pool to claim an unassociated EIP from (leave empty to always allocate)")
+	cmd.PersistentFlags().StringVar(&reusePoolTagValue, "reuse-pool-tag-value", "", "tag value of the pre-allocated EIP pool")
+	cmd.PersistentFlags().StringVar(&reusePoolLeaseHoldKey, "reuse-pool-lease-hold-key", "LeaseHold", "key for the EIP lease holder (e.g., i-12345678_1662596730 means i-12345678 claimed the EIP at the unix timestamp 1662596730)")
+	cmd.PersistentFlags().BoolVar(&reusePoolAllowAllocate, "reuse-pool-allow-allocate", true, "true to allocate a new EIP when the pool is exhausted (false to never go beyond the pool)")
+
+	cmd.PersistentFlags().IntSliceVar(&eniDeviceIndexes, "eni-device-indexes", nil, "ENI device indexes to allocate and associate one EIP per ENI (leave empty to associate a single EIP by instance ID)")
+
+	cmd.PersistentFlags().StringVar(&privateIP, "private-ip", "", "private IP on the ENI to associate the EIP with (e.g., a secondary private IP for multi-IP NAT setups, leave empty for the primary private IP)")
+
+	cmd.PersistentFlags().IntVar(&maxEIPsPerInstance, "max-eips-per-instance", 1, "maximum number of EIPs associated to the local instance, including the ones not managed by the provisioner (must be >= the number of --eni-device-indexes)")
+	cmd.PersistentFlags().BoolVar(&evictExtraEIPs, "evict-extra-eips", false, "true to disassociate the EIPs not managed by the provisioner when exceeding --max-eips-per-instance (otherwise, refuses to allocate/associate)")
+
+	cmd.PersistentFlags().StringVar(&publicIPv4Pool, "public-ipv4-pool", "", "BYOIP address pool ID to allocate the EIPs from (leave empty to use the Amazon pool)")
+	cmd.PersistentFlags().StringVar(&customerOwnedIPv4Pool, "customer-owned-ipv4-pool", "", "customer-owned IP (CoIP) pool ID on Outposts to allocate the EIPs from")
+
+	cmd.PersistentFlags().StringVar(&assumeRoleARN, "assume-role-arn", "", "IAM role ARN to assume with the instance credentials (e.g., to manage the resources in the shared network account, leave empty to use the instance credentials)")
+	cmd.PersistentFlags().StringVar(&assumeRoleExternalID, "assume-role-external-id", "", "external ID to assume the role with (only used with --assume-role-arn)")
+	cmd.PersistentFlags().StringVar(&assumeRoleSessionName, "assume-role-session-name", appName, "session name to assume the role with, recorded in CloudTrail (only used with --assume-role-arn)")
+
+	cmd.PersistentFlags().DurationVar(&apiTimeout, "api-timeout", 30*time.Second, "timeout for each AWS API call attempt, retried as the transient error up to --api-max-retries")
+	cmd.PersistentFlags().IntVar(&apiMaxRetries, "api-max-retries", 5, "maximum number of retries for each AWS API call on transient errors (e.g., RequestLimitExceeded) by the SDK retryer, with exponential backoff (AllocateAddress is only retried when throttled)")
+	cmd.PersistentFlags().StringVar(&ec2Endpoint, "ec2-endpoint", "", "EC2 API endpoint URL (e.g., the interface VPC endpoint for the subnets without internet access, leave empty for the default)")
+
+	cmd.PersistentFlags().StringVar(&outputFormat, "output-format", outputFormatJSON, "format of the output file (json, yaml, env)")
+	cmd.PersistentFlags().StringVar(&outputFile, "output-file", "", "file path to write the associated EIPs in the output format (e.g., /etc/eip.env for systemd EnvironmentFile=, leave empty to skip)")
+
+	cmd.PersistentFlags().StringVar(&auditLog, "audit-log", "", "file path to append each mutating AWS call (e.g., allocate, associate, tag) as a JSON line with the AWS request IDs (leave empty to disable)")
+	cmd.PersistentFlags().StringVar(&waitReportFile, "wait-report-file", "", "file path to write how long the instance waited for the ASG tag, IAM credentials, and EIP association (leave empty to skip)")
+
+	cmd.PersistentFlags().StringVar(&postAssociateExec, "post-associate-exec", "", "command to run with '/bin/sh -c' after the EIPs are associated, with the EIPs in the environment variables (e.g., EIP_PUBLIC_IP, leave empty to skip)")
+	cmd.PersistentFlags().DurationVar(&postAssociateExecTimeout, "post-associate-exec-timeout", time.Minute, "timeout for each run of the post-associate command")
+	cmd.PersistentFlags().IntVar(&postAssociateExecRetries, "post-associate-exec-retries", 2, "maximum number of retries when the post-associate command fails")
+	cmd.PersistentFlags().BoolVar(&postAssociateExecCreds, "post-associate-exec-credentials", false, "true to pass the temporary AWS credentials of the provisioner (e.g., the assumed role) to the post-associate command as the AWS_* environment variables")
+
+	cmd.PersistentFlags().StringVar(&publishSSMParameter, "publish-ssm-parameter", "", "SSM Parameter Store path to also publish the EIPs JSON (e.g., /fleet/{asg}/{instance-id}/eip, leave empty to skip)")
+	cmd.PersistentFlags().StringVar(&reverseDNSDomainName, "reverse-dns-domain-name", "", "domain name to set as the reverse DNS (PTR record) of the EIPs, with '{device-index}' replaced by the ENI device index (e.g., mail{device-index}.example.com, requires the A record to the EIP, leave empty to skip)")
+
+	cmd.PersistentFlags().StringVar(&notifyTarget, "notify-target", "", "SNS topic ARN or SQS queue URL to publish the 'eip-associated' events to as JSON, for the downstream automation (leave empty to skip)")
+
+	cmd.PersistentFlags().BoolVar(&statusCheckAlarm, "status-check-alarm", false, "true to create the CloudWatch alarm on the status check failures of the local instance at bootstrap, and to delete it on 'release'")
+	cmd.PersistentFlags().BoolVar(&statusCheckAlarmRecover, "status-check-alarm-recover", false, "true to recover the instance on the system status check failures (not supported for the ASG instances with the EC2 health check, which are replaced instead)")
+	cmd.PersistentFlags().StringSliceVar(&statusCheckAlarmSNSTopicARNs, "status-check-alarm-sns-topic-arns", nil, "SNS topic ARNs to notify on the status check alarm state changes (e.g., to page the on-call)")
 }
 
 func main() {
+	var stop context.CancelFunc
+	rootCtx, stop = signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
-		os.Exit(1)
+		stop()
+		logutil.Exit(1)
 	}
-	os.Exit(0)
 }
 
 func cmdFunc(cmd *cobra.Command, args []string) {
 	initialWait := time.Duration(rand.Intn(initialWaitRandomSeconds)) * time.Second
-	logutil.S().Infow("starting 'aws-ip-provisioner'", "initialWait", initialWait)
-	time.Sleep(initialWait)
+	logutil.S().Infow("starting 'aws-ip-provisioner'", "initialWait", initialWait, "dryRun", dryRun, "strict", strict)
+	if !sleepCtx(initialWait) {
+		logutil.S().Warnw("received signal during initial wait -- exiting")
+		logutil.Exit(1)
+	}
+	provisionStart := time.Now()
+
+	var lockFileHandle *os.File
+	if lockFile != "" {
+		f, err := acquireFileLock()
+		if err != nil {
+			logutil.S().Warnw("failed to acquire lock file", "error", err)
+			logutil.Exit(exitCodeLocked)
+		}
+		defer f.Close()
+		lockFileHandle = f
+	}
+	if daemon && lockTagKey != "" && reconcileInterval >= instanceLockExpiry {
+		logutil.S().Warnw("--reconcile-interval must be shorter than the instance lock expiry to refresh the claim in time", "reconcileInterval", reconcileInterval, "instanceLockExpiry", instanceLockExpiry)
+		logutil.Exit(1)
+	}
+
+	if n := len(targetDeviceIndexes()); maxEIPsPerInstance < n {
+		logutil.S().Warnw("--max-eips-per-instance must be >= the number of ENI device indexes", "maxEIPsPerInstance", maxEIPsPerInstance, "deviceIndexes", n)
+		logutil.Exit(1)
+	}
+	if privateIP != "" && len(targetDeviceIndexes()) > 1 {
+		logutil.S().Warnw("--private-ip cannot be used with multiple ENI device indexes", "deviceIndexes", eniDeviceIndexes)
+		logutil.Exit(1)
+	}
+	if err := ec2.ValidateTags(allocationTags("")); err != nil {
+		logutil.S().Warnw("invalid tags", "error", err)
+		logutil.Exit(1)
+	}
+	if err := validateAddressFamily(addressFamily); err != nil {
+		logutil.S().Warnw("invalid address family", "error", err)
+		logutil.Exit(1)
+	}
+	if reconcileQueueURL != "" && !daemon {
+		logutil.S().Warnw("--reconcile-queue-url is only used with --daemon -- ignoring", "reconcileQueueURL", reconcileQueueURL)
+	}
+	if notifyTarget != "" {
+		if err := notify.ValidateTarget(notifyTarget); err != nil {
+			logutil.S().Warnw("invalid --notify-target", "error", err)
+			logutil.Exit(1)
+		}
+	}
+	if outputFile != "" {
+		if _, err := encodeEIPOutputs(outputFormat, nil); err != nil {
+			logutil.S().Warnw("invalid output format", "error", err)
+			logutil.Exit(1)
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
 	localInstanceID, err := metadata.FetchInstanceID(ctx)
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
-		os.Exit(1)
+		logutil.Exit(exitCodeMetadata)
+	}
+	if privateIP != "" {
+		if err := validatePrivateIP(); err != nil {
+			logutil.S().Warnw("invalid --private-ip", "error", err)
+			logutil.Exit(1)
+		}
+	}
+	if warmingToIdle() {
+		logutil.S().Infow("instance is warming to be stopped in the warm pool -- skipping provisioning until it starts into service", "instanceID", localInstanceID)
+		return
+	}
+	if releasing() {
+		logutil.S().Infow("EIPs released by 'release' -- skipping provisioning", "instanceID", localInstanceID, "releasingFile", releasingFile)
+		return
 	}
 
+	region, err := resolveRegion()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch region", "error", err)
+		logutil.Exit(exitCodeMetadata)
+	}
 	cfg, err := aws.New(&aws.Config{
-		Region: region,
+		Region:               region,
+		RoleARN:              assumeRoleARN,
+		ExternalID:           assumeRoleExternalID,
+		SessionName:          assumeRoleSessionName,
+		LogAPICalls:          logAPICalls,
+		APICallHooks:         []aws.APICallHook{apiCallMetrics.Observe},
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+		RetryMaxAttempts:     apiMaxRetries + 1,
+		RetryMaxBackoff:      retryMaxBackoff,
+		AttemptTimeout:       apiTimeout,
 	})
 	if err != nil {
 		logutil.S().Warnw("failed to create aws config", "error", err)
-		os.Exit(1)
+		logutil.Exit(exitCodeCredentials)
+	}
+	if auditLog != "" {
+		cfg = withRequestIDRecorder(cfg)
+	}
+	if ec2Endpoint != "" {
+		ec2.SetClientOptions(ec2.WithBaseEndpoint(ec2Endpoint))
+	}
+
+	waitReport.InstanceID = localInstanceID
+
+	start := time.Now()
+	err = waitForCredentials(cfg, 5*time.Minute)
+	observeWait(ec2.WaitPhaseCredentials, start, err)
+	if err != nil {
+		logutil.S().Warnw("failed to retrieve credentials in time", "error", err)
+		logutil.Exit(exitCodeCredentials)
+	}
+	ctx, cancel = context.WithTimeout(rootCtx, apiTimeout)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(exitCodeCredentials)
+	}
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
-	_, asgNameTagValue, err := ec2.WaitInstanceTagValue(ctx, cfg, localInstanceID, "aws:autoscaling:groupName")
+	start = time.Now()
+	ctx, cancel = context.WithTimeout(rootCtx, 10*time.Minute)
+	asgNameTagValue, err := ec2.WaitTagValue(ctx, cfg, localInstanceID, "aws:autoscaling:groupName", ec2.WithInterval(tagPollInterval))
 	cancel()
+	observeWait(ec2.WaitPhaseASGTag, start, err)
 	if err != nil {
 		logutil.S().Warnw("failed to get asg tag value in time", "error", err)
-		os.Exit(1)
+		logutil.Exit(exitCode(err, exitCodeTag))
 	}
 	if asgNameTagValue == "" {
 		logutil.S().Warnw("failed to get asg tag value in time")
-		os.Exit(1)
+		logutil.Exit(exitCodeTag)
 	}
 	logutil.S().Infow("found asg tag", "key", asgNameTagKey, "value", asgNameTagValue)
 
+	var lock *instanceLock
+	if lockTagKey != "" {
+		nonce, err := loadOrCreateNonce(lockFileHandle)
+		if err != nil {
+			logutil.S().Warnw("failed to load instance lock nonce", "error", err)
+			logutil.Exit(1)
+		}
+		lock = newInstanceLock(cfg, localInstanceID, nonce)
+		if err := lock.acquire(); err != nil {
+			logutil.S().Warnw("failed to claim instance", "error", err)
+			if errors.Is(err, errLocked) {
+				logutil.Exit(exitCodeLocked)
+			}
+			logutil.Exit(exitCode(err, exitCodeTag))
+		}
+	}
+
+	if statusCheckAlarm {
+		if err := ensureStatusCheckAlarm(cfg, localInstanceID); err != nil {
+			if strict {
+				logutil.S().Warnw("failed to ensure status check alarm", "error", err)
+				logutil.Exit(exitCode(err, exitCodeGeneric))
+			}
+			logutil.S().Warnw("failed to ensure status check alarm -- ignoring without --strict", "error", err)
+		}
+	}
+
+	if addressFamily == addressFamilyIPv6 || addressFamily == addressFamilyDual {
+		addr, err := provisionIPv6(cfg, localInstanceID)
+		if err != nil {
+			logutil.S().Warnw("failed to provision IPv6 address", "error", err)
+			logutil.Exit(exitCode(err, exitCodeAllocation))
+		}
+		if err := publishIPv6(cfg, localInstanceID, addr); err != nil {
+			if strict {
+				logutil.S().Warnw("failed to publish IPv6 address", "error", err)
+				logutil.Exit(exitCode(err, exitCodeTag))
+			}
+			logutil.S().Warnw("failed to publish IPv6 address -- ignoring without --strict", "error", err)
+		}
+		logutil.S().Infow("successfully provisioned IPv6 address", "eniID", addr.ENIID, "address", addr.Address)
+	}
+	if addressFamily == addressFamilyIPv6 {
+		if lock != nil {
+			lock.release()
+		}
+		return
+	}
+
+	eipStart := time.Now()
+
 	// a single EC2 instance can have multiple EIPs
 	// ref. https://repost.aws/knowledge-center/secondary-private-ip-address
 	logutil.S().Infow("checking if EIP is already associated", "localInstanceID", localInstanceID)
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	curAssociated, err := ec2.ListEIPs(
-		ctx,
-		cfg,
-		ec2.WithFilters(map[string][]string{
-			"instance-id": {localInstanceID},
-		}),
-	)
-	cancel()
+	curAssociated, err := listAssociatedEIPs(cfg, localInstanceID)
 	if err != nil {
 		logutil.S().Warnw("failed to list EIPs", "error", err)
-		os.Exit(1)
+		logutil.Exit(exitCode(err, exitCodeGeneric))
 	}
-	// TODO: limit a single EIP per instance?
 	if len(curAssociated) > 0 {
 		logutil.S().Warnw("EIP already associated to this instance -- may get charged extra", "eips", len(curAssociated))
 	}
@@ -133,100 +449,591 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	exists, err := fileutil.FileExists(curEIPsFile)
 	if err != nil {
 		logutil.S().Warnw("failed to check if EIPs file exists locally", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	if exists {
 		logutil.S().Infow("found EIPs file locally", "file", curEIPsFile)
 		eipsToAssociate, err = ec2.LoadEIPs(curEIPsFile)
 		if err != nil {
 			logutil.S().Warnw("failed to load EIPs", "error", err)
-			os.Exit(1)
+			logutil.Exit(1)
+		}
+
+		// the instance started from the warm pool keeps its EIPs associated across the stop,
+		// so skip the per-EIP verification if all the recorded EIPs are still associated
+		if skipInWarmPool && recordedEIPsAssociated(eipsToAssociate, curAssociated) && startedFromWarmPool(cfg, asgNameTagValue, localInstanceID) {
+			logutil.S().Infow("started from warm pool with the recorded EIPs still associated -- skipping verification", "eips", len(eipsToAssociate))
+		} else if valid, err := verifyEIPs(cfg, eipsToAssociate); err != nil {
+			// the EIP may have been released, or may belong to another account/region
+			logutil.S().Warnw("failed to verify EIPs", "error", err)
+			logutil.Exit(exitCode(err, exitCodeAllocation))
+		} else if len(valid) != len(eipsToAssociate) {
+			logutil.S().Warnw("found stale EIPs file -- removing and falling back to allocation", "file", curEIPsFile, "loaded", len(eipsToAssociate), "valid", len(valid))
+			if dryRun {
+				logutil.S().Infow("[dry-run] would remove stale EIPs file", "file", curEIPsFile)
+			} else if err = os.RemoveAll(curEIPsFile); err != nil {
+				logutil.S().Warnw("failed to remove stale EIPs file", "error", err)
+				logutil.Exit(1)
+			}
+			eipsToAssociate = valid
 		}
 	} else {
 		logutil.S().Infow("no EIP file found locally", "file", curEIPsFile)
-		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-		eip, err := ec2.AllocateEIP(ctx, cfg, asgNameTagValue, ec2.WithTags(map[string]string{
-			idTagKey:      idTagValue,
-			kindTagKey:    kindTagValue,
-			asgNameTagKey: asgNameTagValue,
-		}))
-		cancel()
+	}
+
+	// EIPs associated but not managed by this provisioner (e.g., manually associated, or lost EIPs file)
+	extras := findExtraEIPs(curAssociated, eipsToAssociate)
+	if len(extras)+len(targetDeviceIndexes()) > maxEIPsPerInstance {
+		if !evictExtraEIPs {
+			logutil.S().Warnw("too many EIPs for this instance -- refusing to allocate/associate (use --evict-extra-eips to disassociate extras)", "extras", len(extras), "maxEIPsPerInstance", maxEIPsPerInstance)
+			logutil.Exit(exitCodeAllocation)
+		}
+		if err := disassociateEIPs(cfg, localInstanceID, extras); err != nil {
+			logutil.S().Warnw("failed to evict extra EIPs", "error", err)
+			logutil.Exit(exitCode(err, exitCodeAssociation))
+		}
+	}
+
+	// one EIP per ENI device index (only the primary ENI by default)
+	for _, idx := range targetDeviceIndexes() {
+		if _, ok := eipsToAssociate.FindByDeviceIndex(idx); ok {
+			continue
+		}
+		eip, ok, err := provisionEIP(cfg, localInstanceID, asgNameTagValue, idx, eipsToAssociate)
 		if err != nil {
-			logutil.S().Warnw("failed to allocate EIP", "error", err)
-			os.Exit(1)
+			logutil.S().Warnw("failed to provision EIP", "deviceIndex", idx, "error", err)
+			releaseAllocatedEIPs(cfg, eipsToAssociate)
+			logutil.Exit(exitCode(err, exitCodeAllocation))
+		}
+		if ok {
+			eipsToAssociate = append(eipsToAssociate, eip)
+		}
+	}
+	if dryRun {
+		logutil.S().Infow("[dry-run] would sync EIP", "file", curEIPsFile, "eips", eipsToAssociate)
+	} else {
+		if err := eipsToAssociate.Sync(curEIPsFile); err != nil {
+			logutil.S().Warnw("failed to sync EIP", "error", err)
+			releaseAllocatedEIPs(cfg, eipsToAssociate)
+			logutil.Exit(1)
 		}
-		eipsToAssociate = append(eipsToAssociate, eip)
+		logutil.S().Infow("successfully synced EIP", "eips", eipsToAssociate)
 	}
-	if err := eipsToAssociate.Sync(curEIPsFile); err != nil {
-		logutil.S().Warnw("failed to sync EIP", "error", err)
-		os.Exit(1)
+
+	_, err = associateEIPs(cfg, localInstanceID, eipsToAssociate, curAssociated)
+	observeWait(ec2.WaitPhaseEIP, eipStart, err)
+	if err != nil {
+		metrics.incAssociationFailures()
+		logutil.S().Warnw("failed to associate EIPs", "error", err)
+		releaseAllocatedEIPs(cfg, eipsToAssociate)
+		logutil.Exit(exitCode(err, exitCodeAssociation))
 	}
-	logutil.S().Infow("successfully synced EIP", "eips", eipsToAssociate)
+	allocatedEIPs = nil
 
-	needsAssociate := make(map[ec2.EIP]struct{})
-	for _, eip := range eipsToAssociate {
-		alreadyAssociated := false
-		for _, addr := range curAssociated {
-			allocationID := *addr.AllocationId
-			publicIP := *addr.PublicIp
-			logutil.S().Infow("found EIP associated to this instance", "allocationID", allocationID, "publicIP", publicIP)
+	if err := recordAssociations(cfg, localInstanceID, eipsToAssociate); err != nil {
+		logutil.S().Warnw("failed to record EIP associations -- ignoring", "error", err)
+	}
+
+	s := eipsToAssociate.String()
+	logutil.S().Infow("successfully associated or loaded EIP", "eip", s)
+
+	// the EIPs are already associated, so only fail on the publish failures with "--strict"
+	if err := publishEIPs(cfg, asgNameTagValue, localInstanceID, eipsToAssociate); err != nil {
+		if strict {
+			logutil.S().Warnw("failed to publish EIPs", "error", err)
+			logutil.Exit(exitCode(err, exitCodeTag))
+		}
+		logutil.S().Warnw("failed to publish EIPs -- ignoring without --strict", "error", err)
+	}
+
+	if postAssociateExec != "" {
+		if err := runPostAssociateExec(cfg, localInstanceID, eipsToAssociate); err != nil {
+			if strict {
+				logutil.S().Warnw("failed to run post-associate command", "error", err)
+				logutil.Exit(exitCodeHook)
+			}
+			logutil.S().Warnw("failed to run post-associate command -- ignoring without --strict", "error", err)
+		}
+	}
 
-			if eip.AllocationID == allocationID && eip.PublicIP == publicIP {
-				logutil.S().Infow("EIP already associated to this instance -- no need to re-associate", "eip", eipsToAssociate)
-				alreadyAssociated = true
+	if notifyTarget != "" {
+		if err := notifyEIPsAssociated(cfg, localInstanceID, asgNameTagValue, eipsToAssociate, false); err != nil {
+			if strict {
+				logutil.S().Warnw("failed to publish event", "error", err)
+				logutil.Exit(exitCode(err, exitCodeHook))
+			}
+			logutil.S().Warnw("failed to publish event -- ignoring without --strict", "error", err)
+		}
+	}
+
+	if !daemon {
+		if lock != nil {
+			lock.release()
+		}
+		return
+	}
+
+	logutil.S().Infow("running in daemon mode", "reconcileInterval", reconcileInterval, "reconcileQueueURL", reconcileQueueURL)
+	metrics.observeReconcile(time.Since(provisionStart), nil)
+	if metricsListenAddress != "" {
+		serveMetrics()
+	}
+	var watcher *eventWatcher
+	var triggered <-chan struct{}
+	if reconcileQueueURL != "" {
+		watcher = newEventWatcher(cfg, reconcileQueueURL, localInstanceID, eipsToAssociate)
+		triggered = watcher.triggered()
+		go watcher.run()
+	}
+	for {
+		select {
+		case <-rootCtx.Done():
+			logutil.S().Infow("received signal -- exiting daemon", "error", rootCtx.Err())
+			if lock != nil {
+				lock.release()
+			}
+			return
+		case <-time.After(reconcileInterval):
+		case <-triggered:
+			logutil.S().Infow("reconciling on event")
+		}
+
+		if lock != nil {
+			// refresh the claim before it expires
+			if err := lock.acquire(); err != nil {
+				logutil.S().Warnw("failed to refresh instance claim -- retrying in next interval", "error", err)
+				continue
+			}
+		}
+
+		var events []sqs.Message
+		if watcher != nil {
+			events = watcher.take()
+		}
+		start := time.Now()
+		err := reconcileEIPs(cfg, localInstanceID, eipsToAssociate)
+		metrics.observeReconcile(time.Since(start), err)
+		if err != nil {
+			logutil.S().Warnw("failed to reconcile EIPs -- retrying in next interval", "error", err)
+		}
+		if watcher != nil {
+			watcher.done(events, err)
+			watcher.update(localInstanceID, eipsToAssociate)
+		}
+	}
+}
+
+// Re-associates the EIPs if the association was lost (e.g., instance stop/start).
+func reconcileEIPs(cfg aws_v2.Config, instanceID string, eips ec2.EIPs) error {
+	if releasing() {
+		// e.g., triggered by the DisassociateAddress event of "release" on termination
+		logutil.S().Infow("EIPs released by 'release' -- skipping reconcile", "releasingFile", releasingFile)
+		return nil
+	}
+	curAssociated, err := listAssociatedEIPs(cfg, instanceID)
+	if err != nil {
+		return err
+	}
+	n, err := associateEIPs(cfg, instanceID, eips, curAssociated)
+	if err != nil {
+		metrics.incAssociationFailures()
+		return err
+	}
+	if n > 0 {
+		logutil.S().Infow("re-associated EIPs that were lost (e.g., instance stop/start)", "reassociated", n)
+		if err := recordAssociations(cfg, instanceID, eips); err != nil {
+			logutil.S().Warnw("failed to record EIP associations", "error", err)
+		}
+		if postAssociateExec != "" {
+			if err := runPostAssociateExec(cfg, instanceID, eips); err != nil {
+				logutil.S().Warnw("failed to run post-associate command", "error", err)
+			}
+		}
+		if notifyTarget != "" {
+			if err := notifyEIPsAssociated(cfg, instanceID, "", eips, true); err != nil {
+				logutil.S().Warnw("failed to publish event", "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Updates the EIPs with the association metadata (e.g., association ID, ENI, timestamp),
+// and syncs them to the EIPs file.
+func recordAssociations(cfg aws_v2.Config, instanceID string, eips ec2.EIPs) error {
+	if dryRun {
+		logutil.S().Infow("[dry-run] would record EIP associations", "file", curEIPsFile)
+		return nil
+	}
+	curAssociated, err := listAssociatedEIPs(cfg, instanceID)
+	if err != nil {
+		return err
+	}
+	eips.UpdateAssociations(curAssociated, time.Now())
+	return eips.Sync(curEIPsFile)
+}
+
+// Returns the associated addresses that are not in the EIPs.
+func findExtraEIPs(curAssociated []aws_ec2_v2_types.Address, eips ec2.EIPs) []aws_ec2_v2_types.Address {
+	extras := make([]aws_ec2_v2_types.Address, 0)
+	for _, addr := range curAssociated {
+		found := false
+		for _, eip := range eips {
+			if addr.AllocationId != nil && *addr.AllocationId == eip.AllocationID {
+				found = true
 				break
 			}
 		}
-		if !alreadyAssociated {
-			needsAssociate[eip] = struct{}{}
+		if !found {
+			extras = append(extras, addr)
+		}
+	}
+	return extras
+}
+
+// Disassociates the addresses from the instance, without releasing.
+func disassociateEIPs(cfg aws_v2.Config, instanceID string, addrs []aws_ec2_v2_types.Address) error {
+	for _, addr := range addrs {
+		if addr.AssociationId == nil {
+			continue
+		}
+		allocationID := aws_v2.ToString(addr.AllocationId)
+		associationID := *addr.AssociationId
+		if dryRun {
+			logutil.S().Infow("[dry-run] would disassociate extra EIP", "allocationID", allocationID, "associationID", associationID)
+			continue
+		}
+		logutil.S().Infow("disassociating extra EIP", "allocationID", allocationID, "associationID", associationID)
+		err := callAWSAudited("DisassociateAddress", instanceID, map[string]string{"allocationID": allocationID, "associationID": associationID}, func(ctx context.Context) error {
+			return ec2.DisassociateEIP(ctx, cfg, associationID)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the "--region" value, "AWS_REGION", or the region of the local instance from the instance metadata.
+func resolveRegion() (string, error) {
+	if region != "" {
+		return region, nil
+	}
+	// e.g., injected by the EKS pod identity webhook with IRSA
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		logutil.S().Infow("found region from AWS_REGION", "region", r)
+		return r, nil
+	}
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	defer cancel()
+	r, err := metadata.FetchRegion(ctx)
+	if err != nil {
+		return "", err
+	}
+	logutil.S().Infow("auto-detected region from instance metadata", "region", r)
+	return r, nil
+}
+
+// Lists the EIPs currently associated with the instance.
+func listAssociatedEIPs(cfg aws_v2.Config, instanceID string) ([]aws_ec2_v2_types.Address, error) {
+	return listEIPs(cfg, map[string][]string{
+		"instance-id": {instanceID},
+	})
+}
+
+func listEIPs(cfg aws_v2.Config, filters map[string][]string) ([]aws_ec2_v2_types.Address, error) {
+	var addrs []aws_ec2_v2_types.Address
+	err := callAWS(func(ctx context.Context) (err error) {
+		addrs, err = ec2.ListEIPs(ctx, cfg, ec2.WithFilters(filters))
+		return err
+	})
+	return addrs, err
+}
+
+// Returns the EIPs that still exist in the account and region, with the same public IP.
+func verifyEIPs(cfg aws_v2.Config, eips ec2.EIPs) (ec2.EIPs, error) {
+	valid := make(ec2.EIPs, 0, len(eips))
+	for _, eip := range eips {
+		addrs, err := listEIPs(cfg, map[string][]string{
+			"allocation-id": {eip.AllocationID},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			logutil.S().Warnw("EIP not found (released or in another account/region)", "allocationID", eip.AllocationID, "publicIP", eip.PublicIP)
+			continue
+		}
+		if addressIP(addrs[0]) != eip.PublicIP {
+			logutil.S().Warnw("EIP public IP mismatch", "allocationID", eip.AllocationID, "expected", eip.PublicIP)
+			continue
+		}
+		valid = append(valid, eip)
+	}
+	return valid, nil
+}
+
+// Publishes the associated EIPs to the output file, the local instance tag, and the SSM parameter.
+func publishEIPs(cfg aws_v2.Config, asgName string, instanceID string, eips ec2.EIPs) error {
+	if outputFile != "" {
+		// re-list to get the association IDs
+		curAssociated, err := listAssociatedEIPs(cfg, instanceID)
+		if err != nil {
+			return err
+		}
+		if err := writeEIPOutputs(toEIPOutputs(eips, curAssociated)); err != nil {
+			return err
+		}
+	}
+
+	// EC2 tag values are limited to 256 characters, so only publish the summary
+	s := eips.Summary().String()
+	if dryRun {
+		logutil.S().Infow("[dry-run] would create tags", "resourceIDs", []string{instanceID}, "key", localInstancePublishTagKey, "value", s)
+	} else {
+		recordSelfTag(localInstancePublishTagKey, s)
+		err := callAWSAudited("CreateTags", instanceID, map[string]string{localInstancePublishTagKey: s}, func(ctx context.Context) error {
+			return ec2.CreateTags(
+				ctx,
+				cfg,
+				[]string{instanceID},
+				map[string]string{
+					localInstancePublishTagKey: s,
+				})
+		})
+		if err != nil {
+			return err
 		}
 	}
-	if len(needsAssociate) > 0 {
-		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-		curAttached, err := ec2.GetENIsByInstanceID(
+
+	if publishSSMParameter != "" {
+		if err := publishEIPsToSSM(cfg, asgName, instanceID, s); err != nil {
+			return err
+		}
+	}
+
+	if reverseDNSDomainName != "" {
+		if err := setReverseDNS(cfg, instanceID, eips); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes the EIPs JSON to the SSM Parameter Store,
+// for the consumers that cannot read EC2 tags.
+// "{asg}" and "{instance-id}" in the parameter path are replaced with the ASG name and the instance ID.
+func publishEIPsToSSM(cfg aws_v2.Config, asgName string, instanceID string, eips string) error {
+	name := strings.NewReplacer("{asg}", asgName, "{instance-id}", instanceID).Replace(publishSSMParameter)
+	if dryRun {
+		logutil.S().Infow("[dry-run] would put SSM parameter", "name", name, "value", eips)
+		return nil
+	}
+	return callAWSAudited("PutParameter", instanceID, map[string]string{"name": name, "value": eips}, func(ctx context.Context) error {
+		_, err := ssm.PutParameter(ctx, cfg, name, eips)
+		return err
+	})
+}
+
+// Returns the public IP of the address, or the customer-owned IP for the CoIP pool.
+func addressIP(addr aws_ec2_v2_types.Address) string {
+	if addr.PublicIp != nil {
+		return *addr.PublicIp
+	}
+	if addr.CustomerOwnedIp != nil {
+		return *addr.CustomerOwnedIp
+	}
+	return ""
+}
+
+// Returns the ENI device indexes to associate EIPs with.
+func targetDeviceIndexes() []int32 {
+	if len(eniDeviceIndexes) == 0 {
+		return []int32{0}
+	}
+	idxs := make([]int32, 0, len(eniDeviceIndexes))
+	for _, idx := range eniDeviceIndexes {
+		idxs = append(idxs, int32(idx))
+	}
+	return idxs
+}
+
+// Checks that "--private-ip" is on the target ENI (e.g., the secondary private IP assigned
+// by the ENI provisioner), so the EIP association does not fail after the allocation.
+func validatePrivateIP() error {
+	idx := targetDeviceIndexes()[0]
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	iface, err := metadata.GetInterfaceByDeviceIndex(ctx, idx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if !iface.HasPrivateIP(privateIP) {
+		return fmt.Errorf("private IP %q not found on the ENI %q (device index %d, private IPs %v)", privateIP, iface.InterfaceID, idx, iface.PrivateIPs)
+	}
+	logutil.S().Infow("found private IP on the ENI", "privateIP", privateIP, "eniID", iface.InterfaceID, "deviceIndex", idx)
+	return nil
+}
+
+// Returns the tags for the EIPs to allocate, including the "Name" tag.
+// The provisioner-managed tags take precedence over "--tags".
+func allocationTags(asgName string) map[string]string {
+	tags := make(map[string]string, len(extraTags)+4)
+	for k, v := range extraTags {
+		tags[k] = v
+	}
+	tags["Name"] = asgName
+	tags[idTagKey] = idTagValue
+	tags[kindTagKey] = kindTagValue
+	tags[asgNameTagKey] = asgName
+	return tags
+}
+
+// Claims an EIP from the pool (other than the chosen ones) or allocates a new one for the ENI device index.
+// Returns false if nothing was provisioned (e.g., dry-run).
+func provisionEIP(cfg aws_v2.Config, instanceID string, asgName string, deviceIndex int32, chosen ec2.EIPs) (ec2.EIP, bool, error) {
+	if reusePoolTagKey != "" {
+		eip, claimed, err := claimPoolEIP(cfg, instanceID, deviceIndex, chosen)
+		if err != nil {
+			return ec2.EIP{}, false, err
+		}
+		if claimed {
+			eip.DeviceIndex = deviceIndex
+			return eip, true, nil
+		}
+		if !reusePoolAllowAllocate {
+			logutil.S().Warnw("no EIP available in the pool, and allocation is disabled", "tagKey", reusePoolTagKey, "tagValue", reusePoolTagValue)
+			return ec2.EIP{}, false, errors.New("EIP pool exhausted")
+		}
+		logutil.S().Infow("no EIP available in the pool -- allocating a new one", "tagKey", reusePoolTagKey, "tagValue", reusePoolTagValue)
+	}
+
+	eipTags := allocationTags(asgName)
+	if err := ec2.ValidateTags(eipTags); err != nil {
+		return ec2.EIP{}, false, err
+	}
+	if dryRun {
+		logutil.S().Infow("[dry-run] would allocate EIP", "name", asgName, "tags", eipTags, "deviceIndex", deviceIndex, "publicIPv4Pool", publicIPv4Pool, "customerOwnedIPv4Pool", customerOwnedIPv4Pool)
+		return ec2.EIP{}, false, nil
+	}
+
+	var eip ec2.EIP
+	metrics.incAllocationAttempts()
+	details := map[string]string{"name": asgName, "deviceIndex": fmt.Sprint(deviceIndex)}
+	err := callAWSAudited("AllocateAddress", instanceID, details, func(ctx context.Context) (err error) {
+		eip, err = ec2.AllocateEIP(
 			ctx,
 			cfg,
-			localInstanceID,
+			asgName,
+			ec2.WithTags(eipTags),
+			ec2.WithPublicIPv4Pool(publicIPv4Pool),
+			ec2.WithCustomerOwnedIPv4Pool(customerOwnedIPv4Pool),
+			// retries after a timeout resolve to the same allocation, instead of leaking EIPs
+			ec2.WithIdempotencyToken(fmt.Sprintf("%s-%d", instanceID, deviceIndex)),
 		)
-		cancel()
-		if err != nil {
-			logutil.S().Warnw("failed to list ENIs by instance ID", "error", err)
-			os.Exit(1)
+		if err == nil {
+			details["allocationID"] = eip.AllocationID
+			details["publicIP"] = eip.PublicIP
 		}
-		if len(curAttached) > 1 {
-			logutil.S().Infow("multiple interfaces attached to this instance -- attach EIP to instance will fail, need to attach to ENI instead", "enis", len(curAttached))
-			os.Exit(1)
+		return err
+	})
+	if err != nil {
+		metrics.incAllocationFailures()
+		return ec2.EIP{}, false, err
+	}
+	eip.DeviceIndex = deviceIndex
+	allocatedEIPs = append(allocatedEIPs, eip)
+	return eip, true, nil
+}
+
+// Associates the EIPs that are not yet associated with the instance,
+// and returns the number of newly associated EIPs.
+// With "--eni-device-indexes", each EIP is associated with the ENI of its device index.
+func associateEIPs(cfg aws_v2.Config, instanceID string, eips ec2.EIPs, curAssociated []aws_ec2_v2_types.Address) (int, error) {
+	var curAttached ec2.ENIs
+	err := callAWS(func(ctx context.Context) (err error) {
+		curAttached, err = ec2.GetENIsByInstanceID(ctx, cfg, instanceID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	eniIDs := make(map[int32]string, len(curAttached))
+	for _, eni := range curAttached {
+		eniIDs[eni.AttachmentDeviceIndex] = eni.ID
+	}
+
+	needsAssociate := make(ec2.EIPs, 0, len(eips))
+	for _, eip := range eips {
+		alreadyAssociated := false
+		for _, addr := range curAssociated {
+			allocationID := *addr.AllocationId
+			publicIP := addressIP(addr)
+			logutil.S().Infow("found EIP associated to this instance", "allocationID", allocationID, "publicIP", publicIP)
+
+			if eip.AllocationID != allocationID || eip.PublicIP != publicIP {
+				continue
+			}
+			if len(eniDeviceIndexes) > 0 && (addr.NetworkInterfaceId == nil || *addr.NetworkInterfaceId != eniIDs[eip.DeviceIndex]) {
+				logutil.S().Infow("EIP associated to a different ENI -- need to re-associate", "eip", eip)
+				break
+			}
+			if privateIP != "" && (addr.PrivateIpAddress == nil || *addr.PrivateIpAddress != privateIP) {
+				logutil.S().Infow("EIP associated to a different private IP -- need to re-associate", "eip", eip, "privateIP", privateIP)
+				break
+			}
+			logutil.S().Infow("EIP already associated to this instance -- no need to re-associate", "eip", eip)
+			alreadyAssociated = true
+			break
+		}
+		if !alreadyAssociated {
+			needsAssociate = append(needsAssociate, eip)
 		}
+	}
+	if len(needsAssociate) == 0 {
+		logutil.S().Infow("no EIPs to associate (already associated)")
+		return 0, nil
+	}
+
+	if len(eniDeviceIndexes) == 0 && len(curAttached) > 1 {
+		logutil.S().Infow("multiple interfaces attached to this instance -- attach EIP to instance will fail, need to attach to ENI instead (use --eni-device-indexes)", "enis", len(curAttached))
+		return 0, errors.New("multiple interfaces attached to the instance")
+	}
+
+	for _, eip := range needsAssociate {
+		if len(eniDeviceIndexes) == 0 {
+			if dryRun {
+				logutil.S().Infow("[dry-run] would associate EIP to this instance", "eip", eip.AllocationID, "instanceID", instanceID, "privateIP", privateIP)
+				continue
+			}
 
-		for eip := range needsAssociate {
 			// re-association wouldn't fail when "AllowReassociation" is set to true
-			logutil.S().Infow("associating EIP to this instance", "eip", eip.AllocationID, "localInstanceID", localInstanceID)
-			ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-			err = ec2.AssociateEIPByInstanceID(ctx, cfg, eip.AllocationID, localInstanceID)
-			cancel()
+			logutil.S().Infow("associating EIP to this instance", "eip", eip.AllocationID, "instanceID", instanceID)
+			err = callAWSAudited("AssociateAddress", instanceID, map[string]string{"allocationID": eip.AllocationID, "publicIP": eip.PublicIP, "privateIP": privateIP}, func(ctx context.Context) error {
+				return ec2.AssociateEIPByInstanceID(ctx, cfg, eip.AllocationID, instanceID, ec2.WithPrivateIP(privateIP))
+			})
 			if err != nil {
-				logutil.S().Warnw("failed to associate EIP", "error", err)
-				os.Exit(1)
+				return 0, err
 			}
+			continue
 		}
-	} else {
-		logutil.S().Infow("no EIPs to associate (already associated)")
-	}
 
-	s := eipsToAssociate.String()
-	logutil.S().Infow("successfully associated or loaded EIP", "eip", s)
+		eniID, ok := eniIDs[eip.DeviceIndex]
+		if !ok {
+			return 0, fmt.Errorf("no ENI attached at device index %d", eip.DeviceIndex)
+		}
+		if dryRun {
+			logutil.S().Infow("[dry-run] would associate EIP to the ENI", "eip", eip.AllocationID, "eniID", eniID, "deviceIndex", eip.DeviceIndex, "privateIP", privateIP)
+			continue
+		}
 
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	err = ec2.CreateTags(
-		ctx,
-		cfg,
-		[]string{localInstanceID},
-		map[string]string{
-			localInstancePublishTagKey: s,
+		logutil.S().Infow("associating EIP to the ENI", "eip", eip.AllocationID, "eniID", eniID, "deviceIndex", eip.DeviceIndex)
+		err = callAWSAudited("AssociateAddress", instanceID, map[string]string{"allocationID": eip.AllocationID, "publicIP": eip.PublicIP, "eniID": eniID, "privateIP": privateIP}, func(ctx context.Context) error {
+			return ec2.AssociateEIPByENIID(ctx, cfg, eip.AllocationID, eniID, ec2.WithPrivateIP(privateIP))
 		})
-	cancel()
-	if err != nil {
-		logutil.S().Warnw("failed to create tags", "error", err)
-		os.Exit(1)
+		if err != nil {
+			return 0, err
+		}
 	}
+	return len(needsAssociate), nil
 }
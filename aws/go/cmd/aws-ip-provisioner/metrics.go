@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/go/logutil"
+)
+
+// Provisioner metrics exposed in the Prometheus text format on "/metrics" in daemon mode,
+// so that the fleet monitoring can alert on the nodes that failed to obtain their EIPs.
+// ref. https://prometheus.io/docs/instrumenting/exposition_formats/
+type provisionerMetrics struct {
+	mu sync.Mutex
+
+	allocationAttempts  int64
+	allocationFailures  int64
+	associationFailures int64
+
+	reconcileTotal           int64
+	reconcileFailures        int64
+	reconcileDurationSeconds float64
+	lastSuccess              time.Time
+}
+
+var metrics = &provisionerMetrics{}
+
+// AWS API call metrics (e.g., throttles), exposed along with the provisioner metrics.
+var apiCallMetrics = aws.NewAPICallMetrics()
+
+func (m *provisionerMetrics) incAllocationAttempts() {
+	m.mu.Lock()
+	m.allocationAttempts++
+	m.mu.Unlock()
+}
+
+func (m *provisionerMetrics) incAllocationFailures() {
+	m.mu.Lock()
+	m.allocationFailures++
+	m.mu.Unlock()
+}
+
+func (m *provisionerMetrics) incAssociationFailures() {
+	m.mu.Lock()
+	m.associationFailures++
+	m.mu.Unlock()
+}
+
+// Records the provisioning or reconcile result.
+func (m *provisionerMetrics) observeReconcile(took time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reconcileTotal++
+	m.reconcileDurationSeconds = took.Seconds()
+	if err != nil {
+		m.reconcileFailures++
+		return
+	}
+	m.lastSuccess = time.Now()
+}
+
+// Writes the metrics in the Prometheus text format.
+func (m *provisionerMetrics) writeText(buf *bytes.Buffer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeMetric(buf, "aws_ip_provisioner_allocation_attempts_total", "counter", "Total number of EIP allocation attempts.", float64(m.allocationAttempts))
+	writeMetric(buf, "aws_ip_provisioner_allocation_failures_total", "counter", "Total number of EIP allocation failures.", float64(m.allocationFailures))
+	writeMetric(buf, "aws_ip_provisioner_association_failures_total", "counter", "Total number of EIP association failures.", float64(m.associationFailures))
+	writeMetric(buf, "aws_ip_provisioner_reconcile_total", "counter", "Total number of provisioning and reconcile runs.", float64(m.reconcileTotal))
+	writeMetric(buf, "aws_ip_provisioner_reconcile_failures_total", "counter", "Total number of failed provisioning and reconcile runs.", float64(m.reconcileFailures))
+	writeMetric(buf, "aws_ip_provisioner_reconcile_duration_seconds", "gauge", "Duration of the last provisioning or reconcile run.", m.reconcileDurationSeconds)
+
+	lastSuccess := math.NaN()
+	if !m.lastSuccess.IsZero() {
+		lastSuccess = float64(m.lastSuccess.Unix())
+	}
+	writeMetric(buf, "aws_ip_provisioner_last_success_timestamp_seconds", "gauge", "Unix timestamp of the last successful provisioning or reconcile run.", lastSuccess)
+}
+
+func writeMetric(buf *bytes.Buffer, name string, typ string, help string, v float64) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+	fmt.Fprintf(buf, "%s %v\n", name, v)
+}
+
+func (m *provisionerMetrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	buf := bytes.NewBuffer(nil)
+	m.writeText(buf)
+	apiCallMetrics.WriteText(buf)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// Serves "/metrics" on "--metrics-listen-address" in the background.
+func serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	srv := &http.Server{
+		Addr:              metricsListenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-rootCtx.Done()
+		srv.Close()
+	}()
+	go func() {
+		logutil.S().Infow("serving metrics", "address", metricsListenAddress)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logutil.S().Warnw("failed to serve metrics", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/notify"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var notifyTarget string
+
+// Publishes the "eip-associated" event to "--notify-target" (SNS topic or SQS queue),
+// with the public IPs and allocation IDs in the event details.
+func notifyEIPsAssociated(cfg aws_v2.Config, instanceID string, asgName string, eips ec2.EIPs, reassociated bool) error {
+	publicIPs := make([]string, 0, len(eips))
+	allocationIDs := make([]string, 0, len(eips))
+	for _, eip := range eips {
+		publicIPs = append(publicIPs, eip.PublicIP)
+		allocationIDs = append(allocationIDs, eip.AllocationID)
+	}
+	ev := notify.Event{
+		Type:       notify.EventEIPAssociated,
+		Source:     appName,
+		InstanceID: instanceID,
+		ASGName:    asgName,
+		Time:       time.Now().UTC(),
+		Details: map[string]string{
+			"public_ips":     strings.Join(publicIPs, ","),
+			"allocation_ids": strings.Join(allocationIDs, ","),
+		},
+	}
+	if reassociated {
+		ev.Details["reassociated"] = "true"
+	}
+	if dryRun {
+		logutil.S().Infow("[dry-run] would publish event", "target", notifyTarget, "event", ev)
+		return nil
+	}
+	return callAWS(func(ctx context.Context) error {
+		return notify.Publish(ctx, cfg, notifyTarget, ev)
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	outputFormatJSON = "json"
+	outputFormatYAML = "yaml"
+	outputFormatEnv  = "env"
+)
+
+// Represents the associated EIP written to "--output-file".
+type eipOutput struct {
+	PublicIP      string `json:"public_ip"`
+	AllocationID  string `json:"allocation_id"`
+	AssociationID string `json:"association_id"`
+	DeviceIndex   int32  `json:"device_index"`
+}
+
+func toEIPOutputs(eips ec2.EIPs, curAssociated []aws_ec2_v2_types.Address) []eipOutput {
+	outs := make([]eipOutput, 0, len(eips))
+	for _, eip := range eips {
+		out := eipOutput{
+			PublicIP:     eip.PublicIP,
+			AllocationID: eip.AllocationID,
+			DeviceIndex:  eip.DeviceIndex,
+		}
+		for _, addr := range curAssociated {
+			if addr.AllocationId != nil && *addr.AllocationId == eip.AllocationID && addr.AssociationId != nil {
+				out.AssociationID = *addr.AssociationId
+				break
+			}
+		}
+		outs = append(outs, out)
+	}
+	return outs
+}
+
+// Encodes the EIPs in the output format.
+// The "env" format can be used for systemd "EnvironmentFile=".
+func encodeEIPOutputs(format string, outs []eipOutput) ([]byte, error) {
+	switch format {
+	case outputFormatJSON:
+		return json.Marshal(outs)
+
+	case outputFormatYAML:
+		return yaml.Marshal(outs)
+
+	case outputFormatEnv:
+		buf := bytes.NewBuffer(nil)
+		for _, kv := range toEnvVars(outs) {
+			fmt.Fprintln(buf, kv)
+		}
+		return buf.Bytes(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// Returns the EIPs as the "KEY=VALUE" environment variables (e.g., EIP_PUBLIC_IP=1.2.3.4),
+// where the EIPs of the non-primary ENIs are suffixed with the device index (e.g., EIP_PUBLIC_IP_1).
+func toEnvVars(outs []eipOutput) []string {
+	kvs := make([]string, 0, 3*len(outs))
+	for _, out := range outs {
+		sfx := ""
+		if out.DeviceIndex > 0 {
+			sfx = fmt.Sprintf("_%d", out.DeviceIndex)
+		}
+		kvs = append(kvs,
+			fmt.Sprintf("EIP_PUBLIC_IP%s=%s", sfx, out.PublicIP),
+			fmt.Sprintf("EIP_ALLOCATION_ID%s=%s", sfx, out.AllocationID),
+			fmt.Sprintf("EIP_ASSOCIATION_ID%s=%s", sfx, out.AssociationID),
+		)
+	}
+	return kvs
+}
+
+// Writes the EIPs to "--output-file" in "--output-format".
+func writeEIPOutputs(outs []eipOutput) error {
+	b, err := encodeEIPOutputs(outputFormat, outs)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		logutil.S().Infow("[dry-run] would write output file", "file", outputFile, "format", outputFormat, "output", string(b))
+		return nil
+	}
+
+	parentDir := filepath.Dir(outputFile)
+	if parentDir != "" && parentDir != "/" {
+		if err := os.MkdirAll(parentDir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(outputFile, b, 0644); err != nil {
+		return err
+	}
+	logutil.S().Infow("successfully wrote output file", "file", outputFile, "format", outputFormat)
+	return nil
+}
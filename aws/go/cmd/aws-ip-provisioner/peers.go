@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	waitForPeers        int
+	waitForPeersTimeout time.Duration
+	peersPollInterval   time.Duration
+)
+
+func newPeersCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "peers",
+		Short: "Prints the EIPs published by the instances in the same ASG as JSON (e.g., to build the bootstrap peer list).",
+		Args:  cobra.NoArgs,
+		Run:   peersFunc,
+	}
+	cmd.PersistentFlags().IntVar(&waitForPeers, "wait-for-peers", 0, "number of peers (including the local instance) to wait for before printing (0 to print the current peers)")
+	cmd.PersistentFlags().DurationVar(&waitForPeersTimeout, "wait-for-peers-timeout", 30*time.Minute, "maximum duration to wait for the peers")
+	cmd.PersistentFlags().DurationVar(&peersPollInterval, "peers-poll-interval", 30*time.Second, "interval to poll the peers")
+	return cmd
+}
+
+func peersFunc(cmd *cobra.Command, args []string) {
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	localInstanceID, err := metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(exitCodeMetadata)
+	}
+
+	region, err := resolveRegion()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch region", "error", err)
+		logutil.Exit(exitCodeMetadata)
+	}
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		RoleARN:              assumeRoleARN,
+		ExternalID:           assumeRoleExternalID,
+		SessionName:          assumeRoleSessionName,
+		LogAPICalls:          logAPICalls,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+		RetryMaxAttempts:     apiMaxRetries + 1,
+		RetryMaxBackoff:      retryMaxBackoff,
+		AttemptTimeout:       apiTimeout,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(exitCodeCredentials)
+	}
+
+	ctx, cancel = context.WithTimeout(rootCtx, 10*time.Minute)
+	asgName, err := ec2.WaitTagValue(ctx, cfg, localInstanceID, "aws:autoscaling:groupName", ec2.WithInterval(tagPollInterval))
+	cancel()
+	if err != nil || asgName == "" {
+		logutil.S().Warnw("failed to get asg tag value in time", "error", err)
+		logutil.Exit(exitCode(err, exitCodeTag))
+	}
+
+	var peers ec2.Peers
+	if waitForPeers > 0 {
+		ctx, cancel = context.WithTimeout(rootCtx, waitForPeersTimeout)
+		peers, err = ec2.WaitForASGPeerEIPs(ctx, cfg, asgName, localInstancePublishTagKey, waitForPeers, ec2.WithInterval(peersPollInterval))
+		cancel()
+	} else {
+		ctx, cancel = context.WithTimeout(rootCtx, time.Minute)
+		peers, err = ec2.ListASGPeerEIPs(ctx, cfg, asgName, localInstancePublishTagKey)
+		cancel()
+	}
+	if err != nil {
+		logutil.S().Warnw("failed to list peers", "asg", asgName, "error", err)
+		logutil.Exit(exitCode(err, exitCodeGeneric))
+	}
+	fmt.Println(peers.String())
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Lease older than this can be taken over by another instance.
+const poolLeaseExpiry = 10 * time.Minute
+
+// Claims an unassociated EIP from the pre-allocated pool for the ENI device index,
+// skipping the EIPs already chosen in this run (e.g., for the other device indexes).
+// Returns false if no EIP is available in the pool.
+//
+// The claim is done by tagging the EIP with the lease hold key and
+// reading it back after a short wait, so two instances racing for
+// the same EIP would not both proceed to associate it.
+func claimPoolEIP(cfg aws_v2.Config, instanceID string, deviceIndex int32, chosen ec2.EIPs) (ec2.EIP, bool, error) {
+	logutil.S().Infow("claiming EIP from the pool", "tagKey", reusePoolTagKey, "tagValue", reusePoolTagValue, "deviceIndex", deviceIndex)
+
+	addrs, err := listEIPs(cfg, map[string][]string{
+		"tag:" + reusePoolTagKey: {reusePoolTagValue},
+	})
+	if err != nil {
+		return ec2.EIP{}, false, err
+	}
+
+	var curAttached ec2.ENIs
+	err = callAWS(func(ctx context.Context) (err error) {
+		curAttached, err = ec2.GetENIsByInstanceID(ctx, cfg, instanceID)
+		return err
+	})
+	if err != nil {
+		return ec2.EIP{}, false, err
+	}
+	eniID := ""
+	for _, eni := range curAttached {
+		if eni.AttachmentDeviceIndex == deviceIndex {
+			eniID = eni.ID
+		}
+	}
+
+	now := time.Now()
+	for _, addr := range addrs {
+		allocationID := *addr.AllocationId
+		eip := ec2.EIP{
+			AllocationID: allocationID,
+			PublicIP:     addressIP(addr),
+		}
+
+		readopt, reason := checkPoolEIP(addr, instanceID, eniID, chosen, now)
+		if reason != "" {
+			logutil.S().Infow("skipping EIP in the pool", "allocationID", allocationID, "reason", reason)
+			continue
+		}
+		if readopt {
+			logutil.S().Infow("re-adopting EIP in the pool leased and associated to this ENI", "eip", eip, "eniID", eniID)
+			return eip, true, nil
+		}
+		if dryRun {
+			logutil.S().Infow("[dry-run] would claim EIP from the pool", "eip", eip)
+			return eip, true, nil
+		}
+
+		leaseValue := fmt.Sprintf("%s_%d", instanceID, time.Now().UTC().Unix())
+		err = callAWSAudited("CreateTags", instanceID, map[string]string{"allocationID": allocationID, reusePoolLeaseHoldKey: leaseValue}, func(ctx context.Context) error {
+			return ec2.CreateTags(ctx, cfg, []string{allocationID}, map[string]string{reusePoolLeaseHoldKey: leaseValue})
+		})
+		if err != nil {
+			return ec2.EIP{}, false, err
+		}
+
+		// wait for the other racing instances to overwrite the lease, if any
+		if !sleepCtx(5 * time.Second) {
+			return ec2.EIP{}, false, rootCtx.Err()
+		}
+
+		cur, err := listEIPs(cfg, map[string][]string{
+			"allocation-id": {allocationID},
+		})
+		if err != nil {
+			return ec2.EIP{}, false, err
+		}
+		if len(cur) != 1 {
+			logutil.S().Warnw("EIP in the pool not found after claim -- skipping", "allocationID", allocationID)
+			continue
+		}
+		if cur[0].AssociationId != nil {
+			logutil.S().Warnw("EIP in the pool got associated after claim -- skipping", "allocationID", allocationID)
+			continue
+		}
+		if holder, _, ok := parseLease(cur[0].Tags); !ok || holder != instanceID {
+			logutil.S().Warnw("EIP in the pool claimed by another instance -- skipping", "allocationID", allocationID, "leaseHolder", holder)
+			continue
+		}
+
+		logutil.S().Infow("successfully claimed EIP from the pool", "eip", eip)
+		return eip, true, nil
+	}
+	return ec2.EIP{}, false, nil
+}
+
+// Checks whether the EIP in the pool can be claimed for the ENI, and returns the reason if not.
+// Returns true if the EIP is already leased by and associated to the ENI of this instance,
+// to re-adopt without claiming again. The EIPs chosen in this run are never claimed again,
+// as the unassociated lease of this instance would otherwise be claimed for another device index
+// and moved between the ENIs on association, while the unassociated lease of this instance
+// from the previous run can be claimed again.
+func checkPoolEIP(addr aws_ec2_v2_types.Address, instanceID string, eniID string, chosen ec2.EIPs, now time.Time) (readopt bool, reason string) {
+	allocationID := aws_v2.ToString(addr.AllocationId)
+	for _, eip := range chosen {
+		if eip.AllocationID == allocationID {
+			return false, "already chosen in this run"
+		}
+	}
+
+	holder, leasedAt, leased := parseLease(addr.Tags)
+	if addr.AssociationId != nil {
+		if leased && holder == instanceID && eniID != "" && aws_v2.ToString(addr.NetworkInterfaceId) == eniID {
+			return true, ""
+		}
+		return false, "already associated"
+	}
+	// the own unassociated lease is claimed again (e.g., restarted after the failed association),
+	// since the pool EIPs leased by this instance are not released on the failure
+	if leased && holder != instanceID && now.Sub(leasedAt) < poolLeaseExpiry {
+		return false, fmt.Sprintf("leased by %q at %s", holder, leasedAt)
+	}
+	return false, ""
+}
+
+// Parses the lease hold tag value (e.g., "i-12345678_1662596730").
+func parseLease(tags []aws_ec2_v2_types.Tag) (string, time.Time, bool) {
+	for _, tag := range tags {
+		if *tag.Key != reusePoolLeaseHoldKey {
+			continue
+		}
+		return parseLeaseValue(*tag.Value)
+	}
+	return "", time.Time{}, false
+}
+
+// Parses the lease value in the format of "<holder>_<unix timestamp>".
+func parseLeaseValue(v string) (string, time.Time, bool) {
+	ss := strings.Split(v, "_")
+	if len(ss) != 2 {
+		logutil.S().Warnw("unexpected lease hold key value", "value", v)
+		return "", time.Time{}, false
+	}
+	unixTS, err := strconv.ParseInt(ss[1], 10, 64)
+	if err != nil {
+		logutil.S().Warnw("failed to parse lease hold key value", "value", v, "error", err)
+		return "", time.Time{}, false
+	}
+	return ss[0], time.Unix(unixTS, 0), true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestCheckPoolEIP(t *testing.T) {
+	reusePoolLeaseHoldKey = "LeaseHold"
+	now := time.Now()
+	lease := func(holder string, at time.Time) []aws_ec2_v2_types.Tag {
+		return []aws_ec2_v2_types.Tag{{Key: aws_v2.String("LeaseHold"), Value: aws_v2.String(fmt.Sprintf("%s_%d", holder, at.Unix()))}}
+	}
+
+	tests := []struct {
+		name      string
+		addr      aws_ec2_v2_types.Address
+		chosen    ec2.EIPs
+		readopt   bool
+		claimable bool
+	}{
+		{
+			name:      "free",
+			addr:      aws_ec2_v2_types.Address{AllocationId: aws_v2.String("eipalloc-0")},
+			claimable: true,
+		},
+		{
+			name:   "own fresh lease chosen for another device index",
+			addr:   aws_ec2_v2_types.Address{AllocationId: aws_v2.String("eipalloc-0"), Tags: lease("i-1", now)},
+			chosen: ec2.EIPs{{AllocationID: "eipalloc-0", DeviceIndex: 0}},
+		},
+		{
+			name:      "own fresh lease not yet associated",
+			addr:      aws_ec2_v2_types.Address{AllocationId: aws_v2.String("eipalloc-0"), Tags: lease("i-1", now)},
+			claimable: true,
+		},
+		{
+			name: "leased by another instance",
+			addr: aws_ec2_v2_types.Address{AllocationId: aws_v2.String("eipalloc-0"), Tags: lease("i-2", now)},
+		},
+		{
+			name:      "expired lease",
+			addr:      aws_ec2_v2_types.Address{AllocationId: aws_v2.String("eipalloc-0"), Tags: lease("i-2", now.Add(-time.Hour))},
+			claimable: true,
+		},
+		{
+			name:      "own lease associated to the same ENI",
+			addr:      aws_ec2_v2_types.Address{AllocationId: aws_v2.String("eipalloc-0"), AssociationId: aws_v2.String("eipassoc-0"), NetworkInterfaceId: aws_v2.String("eni-1"), Tags: lease("i-1", now)},
+			readopt:   true,
+			claimable: true,
+		},
+		{
+			name: "own lease associated to another ENI",
+			addr: aws_ec2_v2_types.Address{AllocationId: aws_v2.String("eipalloc-0"), AssociationId: aws_v2.String("eipassoc-0"), NetworkInterfaceId: aws_v2.String("eni-0"), Tags: lease("i-1", now)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readopt, reason := checkPoolEIP(tt.addr, "i-1", "eni-1", tt.chosen, now)
+			if readopt != tt.readopt || (reason == "") != tt.claimable {
+				t.Fatalf("unexpected readopt %v, reason %q", readopt, reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/fileutil"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+)
+
+var releaseOnTerminate bool
+
+func newReleaseCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "release",
+		Short: "Disassociates (and optionally releases) the EIPs of the local instance (e.g., on ASG termination lifecycle hook).",
+		Args:  cobra.NoArgs,
+		Run:   releaseFunc,
+	}
+	cmd.PersistentFlags().BoolVar(&releaseOnTerminate, "release-on-terminate", false, "true to release the EIPs after disassociation (otherwise, only disassociates), except the EIPs from --reuse-pool-tag-key that are returned to the pool by deleting the lease")
+	cmd.PersistentFlags().StringVar(&lifecycleHookName, "lifecycle-hook-name", "", "ASG lifecycle hook name to record heartbeats for during release, and to complete once released (if empty, skip)")
+	cmd.PersistentFlags().DurationVar(&lifecycleHeartbeatInterval, "lifecycle-heartbeat-interval", time.Minute, "interval to record the lifecycle heartbeats (must be shorter than the hook heartbeat timeout)")
+	return cmd
+}
+
+func releaseFunc(cmd *cobra.Command, args []string) {
+	logutil.S().Infow("starting 'aws-ip-provisioner release'", "releaseOnTerminate", releaseOnTerminate, "dryRun", dryRun)
+
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	localInstanceID, err := metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(exitCodeMetadata)
+	}
+
+	region, err := resolveRegion()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch region", "error", err)
+		logutil.Exit(exitCodeMetadata)
+	}
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		RoleARN:              assumeRoleARN,
+		ExternalID:           assumeRoleExternalID,
+		SessionName:          assumeRoleSessionName,
+		LogAPICalls:          logAPICalls,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+		RetryMaxAttempts:     apiMaxRetries + 1,
+		RetryMaxBackoff:      retryMaxBackoff,
+		AttemptTimeout:       apiTimeout,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(exitCodeCredentials)
+	}
+	if auditLog != "" {
+		cfg = withRequestIDRecorder(cfg)
+	}
+	ctx, cancel = context.WithTimeout(rootCtx, apiTimeout)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(exitCodeCredentials)
+	}
+
+	// mark before disassociating, so that the running daemon does not associate again
+	if dryRun {
+		logutil.S().Infow("[dry-run] would write releasing file", "releasingFile", releasingFile)
+	} else if err := markReleasing(); err != nil {
+		logutil.S().Warnw("failed to write releasing file", "releasingFile", releasingFile, "error", err)
+		logutil.Exit(1)
+	}
+
+	completeLifecycleAction := startLifecycleAction(cfg, localInstanceID)
+
+	// the alarm is deleted even if no EIP is released, and does not block the termination
+	if statusCheckAlarm {
+		if err := deleteStatusCheckAlarm(cfg, localInstanceID); err != nil {
+			logutil.S().Warnw("failed to delete status check alarm -- ignoring", "error", err)
+		}
+	}
+
+	// only touch the EIPs created by this provisioner
+	addrs, err := listEIPs(cfg, map[string][]string{
+		"instance-id":       {localInstanceID},
+		"tag:" + kindTagKey: {kindTagValue},
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to list EIPs", "error", err)
+		logutil.Exit(exitCode(err, exitCodeGeneric))
+	}
+
+	exists, err := fileutil.FileExists(curEIPsFile)
+	if err != nil {
+		logutil.S().Warnw("failed to check if EIPs file exists locally", "error", err)
+		logutil.Exit(1)
+	}
+	if exists {
+		logutil.S().Infow("found EIPs file locally", "file", curEIPsFile)
+		eips, err := ec2.LoadEIPs(curEIPsFile)
+		if err != nil {
+			logutil.S().Warnw("failed to load EIPs", "error", err)
+			logutil.Exit(1)
+		}
+		for _, eip := range eips {
+			if containsAllocationID(addrs, eip.AllocationID) {
+				continue
+			}
+			found, err := listEIPs(cfg, map[string][]string{
+				"allocation-id": {eip.AllocationID},
+			})
+			if err != nil {
+				logutil.S().Warnw("failed to list EIPs", "error", err)
+				logutil.Exit(exitCode(err, exitCodeGeneric))
+			}
+			addrs = append(addrs, found...)
+		}
+	}
+	if len(addrs) == 0 {
+		logutil.S().Infow("no EIP to release")
+		completeLifecycleAction()
+		return
+	}
+
+	for _, addr := range addrs {
+		allocationID := *addr.AllocationId
+
+		// do not disassociate the EIP that has been taken over by another instance
+		if addr.AssociationId != nil && addr.InstanceId != nil && *addr.InstanceId == localInstanceID {
+			if dryRun {
+				logutil.S().Infow("[dry-run] would disassociate EIP", "allocationID", allocationID, "associationID", *addr.AssociationId)
+			} else {
+				err = callAWSAudited("DisassociateAddress", localInstanceID, map[string]string{"allocationID": allocationID, "associationID": *addr.AssociationId}, func(ctx context.Context) error {
+					return ec2.DisassociateEIP(ctx, cfg, *addr.AssociationId)
+				})
+				if err != nil {
+					logutil.S().Warnw("failed to disassociate EIP", "error", err)
+					logutil.Exit(exitCode(err, exitCodeAssociation))
+				}
+			}
+		}
+
+		if !releaseOnTerminate {
+			continue
+		}
+		if addr.InstanceId != nil && *addr.InstanceId != localInstanceID {
+			logutil.S().Warnw("EIP associated to another instance -- skipping release", "allocationID", allocationID, "instanceID", *addr.InstanceId)
+			continue
+		}
+		if isPoolEIP(addr.Tags) {
+			// the pool EIPs (e.g., whitelisted downstream) are returned to the pool, never released
+			if dryRun {
+				logutil.S().Infow("[dry-run] would return EIP to the pool", "allocationID", allocationID)
+				continue
+			}
+			err = callAWSAudited("DeleteTags", localInstanceID, map[string]string{"allocationID": allocationID, "tagKey": reusePoolLeaseHoldKey}, func(ctx context.Context) error {
+				return ec2.DeleteTags(ctx, cfg, []string{allocationID}, []string{reusePoolLeaseHoldKey})
+			})
+			if err != nil {
+				logutil.S().Warnw("failed to delete EIP pool lease", "error", err)
+				logutil.Exit(exitCode(err, exitCodeTag))
+			}
+			logutil.S().Infow("returned EIP to the pool", "allocationID", allocationID)
+			continue
+		}
+		if dryRun {
+			logutil.S().Infow("[dry-run] would release EIP", "allocationID", allocationID)
+			continue
+		}
+		err = callAWSAudited("ReleaseAddress", localInstanceID, map[string]string{"allocationID": allocationID}, func(ctx context.Context) error {
+			return ec2.ReleaseEIP(ctx, cfg, allocationID)
+		})
+		if err != nil {
+			logutil.S().Warnw("failed to release EIP", "error", err)
+			logutil.Exit(exitCode(err, exitCodeAllocation))
+		}
+	}
+
+	// released (or returned to the pool) EIPs must not be loaded again from the local file
+	if releaseOnTerminate && exists && !dryRun {
+		logutil.S().Infow("removing EIPs file", "file", curEIPsFile)
+		if err := os.RemoveAll(curEIPsFile); err != nil {
+			logutil.S().Warnw("failed to remove EIPs file", "error", err)
+			logutil.Exit(1)
+		}
+	}
+	completeLifecycleAction()
+	logutil.S().Infow("successfully released EIPs", "eips", len(addrs))
+}
+
+// Returns true if the EIP is from the pre-allocated pool ("--reuse-pool-tag-key").
+func isPoolEIP(tags []aws_ec2_v2_types.Tag) bool {
+	if reusePoolTagKey == "" {
+		return false
+	}
+	for _, tg := range tags {
+		if aws_v2.ToString(tg.Key) == reusePoolTagKey && aws_v2.ToString(tg.Value) == reusePoolTagValue {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAllocationID(addrs []aws_ec2_v2_types.Address, allocationID string) bool {
+	for _, addr := range addrs {
+		if addr.AllocationId != nil && *addr.AllocationId == allocationID {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if "release" has run on the host (see "--releasing-file"),
+// so that the EIPs are not associated again (e.g., by the daemon reconcile on the DisassociateAddress event).
+func releasing() bool {
+	if releasingFile == "" {
+		return false
+	}
+	_, err := os.Stat(releasingFile)
+	return err == nil
+}
+
+func markReleasing() error {
+	if releasingFile == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(releasingFile), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(releasingFile, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestIsPoolEIP(t *testing.T) {
+	pool := []aws_ec2_v2_types.Tag{
+		{Key: aws_v2.String("Pool"), Value: aws_v2.String("whitelisted")},
+		{Key: aws_v2.String("LeaseHold"), Value: aws_v2.String("i-1_1662596730")},
+	}
+	allocated := []aws_ec2_v2_types.Tag{
+		{Key: aws_v2.String("Kind"), Value: aws_v2.String("aws-ip-provisioner")},
+	}
+	other := []aws_ec2_v2_types.Tag{
+		{Key: aws_v2.String("Pool"), Value: aws_v2.String("other")},
+	}
+
+	reusePoolTagKey, reusePoolTagValue = "", ""
+	if isPoolEIP(pool) {
+		t.Fatal("expected no pool EIP without --reuse-pool-tag-key")
+	}
+
+	reusePoolTagKey, reusePoolTagValue = "Pool", "whitelisted"
+	defer func() { reusePoolTagKey, reusePoolTagValue = "", "" }()
+	if !isPoolEIP(pool) {
+		t.Fatal("expected the pool EIP to be returned to the pool, not released")
+	}
+	if isPoolEIP(allocated) || isPoolEIP(other) {
+		t.Fatal("expected the allocated EIPs to be released")
+	}
+}
+
+func TestMarkReleasing(t *testing.T) {
+	orig := releasingFile
+	defer func() { releasingFile = orig }()
+
+	releasingFile = ""
+	if err := markReleasing(); err != nil || releasing() {
+		t.Fatalf("unexpected releasing with the disabled file (%v)", err)
+	}
+
+	releasingFile = filepath.Join(t.TempDir(), "run", "aws-ip-provisioner.releasing")
+	if releasing() {
+		t.Fatal("unexpected releasing before release")
+	}
+	if err := markReleasing(); err != nil {
+		t.Fatal(err)
+	}
+	if !releasing() {
+		t.Fatal("expected releasing after release")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	retryInitialBackoff = time.Second
+	retryMaxBackoff     = 30 * time.Second
+)
+
+// Calls the AWS API function with the deadline of all its attempts and backoffs.
+// Each attempt times out after "--api-timeout" (see "aws.Config.AttemptTimeout"),
+// and the transient errors (e.g., RequestLimitExceeded) are retried up to "--api-max-retries"
+// times by the SDK retryer (see "aws.Config.RetryMaxAttempts"), not here, so the timed
+// out non-idempotent calls (e.g., AllocateAddress) are never re-issued.
+func callAWS(f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(rootCtx, time.Duration(apiMaxRetries+1)*(apiTimeout+retryMaxBackoff))
+	defer cancel()
+	return f(ctx)
+}
+
+// Returns the exponential backoff for the retry attempt (starting at 1),
+// with the random jitter in [backoff/2, backoff).
+func retryBackoff(attempt int) time.Duration {
+	backoff := retryMaxBackoff
+	if attempt < 16 {
+		backoff = retryInitialBackoff << (attempt - 1)
+		if backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Sets the reverse DNS (PTR record) of each EIP to "--reverse-dns-domain-name",
+// where "{device-index}" is replaced with the ENI device index of the EIP.
+// Skips the EIPs already recorded with the same domain name, and syncs the EIPs file.
+func setReverseDNS(cfg aws_v2.Config, instanceID string, eips ec2.EIPs) error {
+	updated := false
+	for i := range eips {
+		domainName := strings.ReplaceAll(reverseDNSDomainName, "{device-index}", fmt.Sprint(eips[i].DeviceIndex))
+		if eips[i].DomainName == domainName {
+			logutil.S().Infow("EIP reverse DNS already set", "allocationID", eips[i].AllocationID, "domainName", domainName)
+			continue
+		}
+		if dryRun {
+			logutil.S().Infow("[dry-run] would set EIP reverse DNS", "allocationID", eips[i].AllocationID, "domainName", domainName)
+			continue
+		}
+
+		err := callAWSAudited("ModifyAddressAttribute", instanceID, map[string]string{"allocationID": eips[i].AllocationID, "domainName": domainName}, func(ctx context.Context) error {
+			return ec2.SetAddressAttribute(ctx, cfg, eips[i].AllocationID, domainName)
+		})
+		if err != nil {
+			return err
+		}
+		eips[i].DomainName = domainName
+		updated = true
+	}
+
+	if !updated {
+		return nil
+	}
+	return eips.Sync(curEIPsFile)
+}
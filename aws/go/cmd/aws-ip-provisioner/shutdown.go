@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Root context that is canceled on SIGTERM/SIGINT.
+// All AWS API calls derive from this context, so the provisioner stops mid-flow on signals.
+var rootCtx = context.Background()
+
+// EIPs allocated during this run that are not yet associated.
+// Released on failure (including signals), to not leak the EIPs.
+var allocatedEIPs ec2.EIPs
+
+// Sleeps for the duration, or returns false if the root context is canceled.
+func sleepCtx(d time.Duration) bool {
+	select {
+	case <-rootCtx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// Releases the EIPs that were allocated during this run but never associated,
+// and removes them from the EIPs file.
+func releaseAllocatedEIPs(cfg aws_v2.Config, eips ec2.EIPs) {
+	if len(allocatedEIPs) == 0 {
+		return
+	}
+	if dryRun {
+		logutil.S().Infow("[dry-run] would release unassociated EIPs", "eips", allocatedEIPs)
+		return
+	}
+
+	released := make(map[string]struct{})
+	for _, eip := range allocatedEIPs {
+		logutil.S().Infow("releasing EIP allocated but not associated", "allocationID", eip.AllocationID, "publicIP", eip.PublicIP)
+
+		// root context may have been canceled, so use a new context
+		rs := &requestIDs{}
+		ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), requestIDsKey{}, rs), apiTimeout)
+		err := ec2.ReleaseEIP(ctx, cfg, eip.AllocationID)
+		cancel()
+
+		ev := auditEvent{
+			Action:     "ReleaseAddress",
+			Details:    map[string]string{"allocationID": eip.AllocationID, "publicIP": eip.PublicIP},
+			RequestIDs: rs.ids,
+		}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		writeAuditEvent(ev)
+		if err != nil {
+			logutil.S().Warnw("failed to release EIP", "allocationID", eip.AllocationID, "error", err)
+			continue
+		}
+		released[eip.AllocationID] = struct{}{}
+	}
+	allocatedEIPs = nil
+
+	remaining := make(ec2.EIPs, 0, len(eips))
+	for _, eip := range eips {
+		if _, ok := released[eip.AllocationID]; !ok {
+			remaining = append(remaining, eip)
+		}
+	}
+	if len(remaining) == len(eips) {
+		return
+	}
+	if err := remaining.Sync(curEIPsFile); err != nil {
+		logutil.S().Warnw("failed to sync EIPs file after release", "error", err)
+	}
+}
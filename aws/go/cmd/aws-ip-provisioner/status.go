@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/fileutil"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+)
+
+func newStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Prints the status of the EIPs in the local EIPs file as JSON (exits non-zero if unhealthy, e.g., for readiness probes).",
+		Args:  cobra.NoArgs,
+		Run:   statusFunc,
+	}
+}
+
+type statusReport struct {
+	InstanceID string `json:"instance_id"`
+	EIPsFile   string `json:"eips_file"`
+	FileExists bool   `json:"file_exists"`
+
+	// true if the local instance tag matches the EIPs in the file
+	InstanceTagMatch bool `json:"instance_tag_match"`
+
+	EIPs    []eipStatus `json:"eips"`
+	Healthy bool        `json:"healthy"`
+}
+
+type eipStatus struct {
+	AllocationID string `json:"allocation_id"`
+	PublicIP     string `json:"public_ip"`
+	DeviceIndex  int32  `json:"device_index"`
+
+	// false if the EIP was released or belongs to another account/region
+	Exists bool `json:"exists"`
+
+	Associated           bool   `json:"associated"`
+	AssociationID        string `json:"association_id,omitempty"`
+	AssociatedInstanceID string `json:"associated_instance_id,omitempty"`
+	InstanceMatch        bool   `json:"instance_match"`
+
+	// tags with the unexpected values (expected value, empty if missing)
+	TagDrift map[string]string `json:"tag_drift,omitempty"`
+}
+
+func statusFunc(cmd *cobra.Command, args []string) {
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	localInstanceID, err := metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(exitCodeMetadata)
+	}
+
+	region, err := resolveRegion()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch region", "error", err)
+		logutil.Exit(exitCodeMetadata)
+	}
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		RoleARN:              assumeRoleARN,
+		ExternalID:           assumeRoleExternalID,
+		SessionName:          assumeRoleSessionName,
+		LogAPICalls:          logAPICalls,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+		RetryMaxAttempts:     apiMaxRetries + 1,
+		RetryMaxBackoff:      retryMaxBackoff,
+		AttemptTimeout:       apiTimeout,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(exitCodeCredentials)
+	}
+
+	report := statusReport{
+		InstanceID: localInstanceID,
+		EIPsFile:   curEIPsFile,
+		EIPs:       make([]eipStatus, 0),
+	}
+	report.FileExists, err = fileutil.FileExists(curEIPsFile)
+	if err != nil {
+		logutil.S().Warnw("failed to check if EIPs file exists locally", "error", err)
+		logutil.Exit(1)
+	}
+
+	eips := make(ec2.EIPs, 0)
+	if report.FileExists {
+		eips, err = ec2.LoadEIPs(curEIPsFile)
+		if err != nil {
+			logutil.S().Warnw("failed to load EIPs", "error", err)
+			logutil.Exit(1)
+		}
+	}
+	for _, eip := range eips {
+		addrs, err := listEIPs(cfg, map[string][]string{
+			"allocation-id": {eip.AllocationID},
+		})
+		if err != nil {
+			logutil.S().Warnw("failed to list EIPs", "error", err)
+			logutil.Exit(exitCode(err, exitCodeGeneric))
+		}
+		report.EIPs = append(report.EIPs, toEIPStatus(eip, addrs, localInstanceID))
+	}
+
+	var inst aws_ec2_v2_types.Instance
+	err = callAWS(func(ctx context.Context) (err error) {
+		inst, err = ec2.GetInstance(ctx, cfg, localInstanceID)
+		return err
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to get instance", "error", err)
+		logutil.Exit(exitCode(err, exitCodeGeneric))
+	}
+	report.InstanceTagMatch = instanceTagMatches(inst.Tags, localInstancePublishTagKey, eips)
+
+	report.Healthy = report.FileExists && len(report.EIPs) > 0 && report.InstanceTagMatch
+	for _, st := range report.EIPs {
+		if !st.Exists || !st.InstanceMatch || len(st.TagDrift) > 0 {
+			report.Healthy = false
+		}
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		logutil.S().Warnw("failed to marshal status", "error", err)
+		logutil.Exit(1)
+	}
+	fmt.Println(string(b))
+
+	if !report.Healthy {
+		logutil.Exit(1)
+	}
+}
+
+// Returns true if the published instance tag matches the EIPs.
+// The tag only has the summary (see "publishEIPs"), while the EIPs file
+// has the association metadata and tags as well.
+func instanceTagMatches(tags []aws_ec2_v2_types.Tag, key string, eips ec2.EIPs) bool {
+	for _, tg := range tags {
+		if aws_v2.ToString(tg.Key) == key && tg.Value != nil {
+			return *tg.Value == eips.Summary().String()
+		}
+	}
+	return false
+}
+
+func toEIPStatus(eip ec2.EIP, addrs []aws_ec2_v2_types.Address, instanceID string) eipStatus {
+	st := eipStatus{
+		AllocationID: eip.AllocationID,
+		PublicIP:     eip.PublicIP,
+		DeviceIndex:  eip.DeviceIndex,
+	}
+	if len(addrs) == 0 || addressIP(addrs[0]) != eip.PublicIP {
+		return st
+	}
+	addr := addrs[0]
+	st.Exists = true
+
+	if addr.AssociationId != nil {
+		st.Associated = true
+		st.AssociationID = *addr.AssociationId
+	}
+	if addr.InstanceId != nil {
+		st.AssociatedInstanceID = *addr.InstanceId
+		st.InstanceMatch = *addr.InstanceId == instanceID
+	}
+
+	st.TagDrift = checkTagDrift(addr.Tags, expectedEIPTags())
+	if st.TagDrift != nil && reusePoolTagKey != "" {
+		// claimed from the pool, rather than allocated
+		if checkTagDrift(addr.Tags, map[string]string{reusePoolTagKey: reusePoolTagValue}) == nil {
+			st.TagDrift = nil
+		}
+	}
+	return st
+}
+
+// Returns the tags that the provisioner sets on the EIPs it allocates.
+func expectedEIPTags() map[string]string {
+	tags := map[string]string{
+		kindTagKey: kindTagValue,
+	}
+	if idTagValue != "" {
+		tags[idTagKey] = idTagValue
+	}
+	return tags
+}
+
+// Returns the expected tags whose values are missing or different.
+func checkTagDrift(tags []aws_ec2_v2_types.Tag, expected map[string]string) map[string]string {
+	cur := make(map[string]string, len(tags))
+	for _, tg := range tags {
+		if tg.Key != nil && tg.Value != nil {
+			cur[*tg.Key] = *tg.Value
+		}
+	}
+	drift := make(map[string]string)
+	for k, v := range expected {
+		if cur[k] != v {
+			drift[k] = v
+		}
+	}
+	if len(drift) == 0 {
+		return nil
+	}
+	return drift
+}
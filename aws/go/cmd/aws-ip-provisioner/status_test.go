@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestInstanceTagMatches(t *testing.T) {
+	now := time.Now().UTC()
+	p := filepath.Join(t.TempDir(), "current-eips.json")
+	err := ec2.EIPs{{
+		AllocationID:       "eipalloc-0",
+		PublicIP:           "1.2.3.4",
+		AssociationID:      "eipassoc-0",
+		NetworkInterfaceID: "eni-0",
+		Tags:               map[string]string{"Kind": "aws-ip-provisioner"},
+		AssociatedAt:       &now,
+	}}.Sync(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eips, err := ec2.LoadEIPs(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "AWS_IP_PROVISIONER_EIPS"
+	published := []aws_ec2_v2_types.Tag{{Key: aws_v2.String(key), Value: aws_v2.String(eips.Summary().String())}}
+	if !instanceTagMatches(published, key, eips) {
+		t.Fatalf("expected the published summary to match %s", eips)
+	}
+	full := []aws_ec2_v2_types.Tag{{Key: aws_v2.String(key), Value: aws_v2.String(eips.String())}}
+	if instanceTagMatches(full, key, eips) {
+		t.Fatal("expected the full EIPs not to match the summary")
+	}
+	if instanceTagMatches(nil, key, eips) {
+		t.Fatal("expected no tag not to match")
+	}
+}
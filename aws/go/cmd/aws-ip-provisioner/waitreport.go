@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Records how long the instance waited for each boot-time dependency,
+// written to "--wait-report-file".
+var waitReport ec2.WaitReport
+
+// Observes the wait phase, and syncs the report to "--wait-report-file".
+func observeWait(name string, start time.Time, err error) {
+	ph := waitReport.Observe(name, start, err)
+	logutil.S().Infow("observed wait phase", "name", ph.Name, "tookSeconds", ph.TookSeconds, "error", ph.Error)
+
+	if waitReportFile == "" || dryRun {
+		return
+	}
+	if err := waitReport.Sync(waitReportFile); err != nil {
+		logutil.S().Warnw("failed to sync wait report", "file", waitReportFile, "error", err)
+	}
+}
+
+// Waits until the IAM credentials become usable
+// (e.g., the instance profile may not be available right after boot).
+func waitForCredentials(cfg aws_v2.Config, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(rootCtx, timeout)
+	defer cancel()
+	for i := 0; ; i++ {
+		cctx, ccancel := context.WithTimeout(ctx, apiTimeout)
+		_, err := cfg.Credentials.Retrieve(cctx)
+		ccancel()
+		if err == nil {
+			return nil
+		}
+
+		backoff := retryBackoff(i + 1)
+		logutil.S().Warnw("failed to retrieve credentials -- retrying", "attempt", i, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
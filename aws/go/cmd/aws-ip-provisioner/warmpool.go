@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/asg"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+var skipInWarmPool bool
+
+// Returns true if the local instance is being warmed to be stopped (or hibernated)
+// in the ASG warm pool, so the EIPs are not allocated for the idle instance.
+// The provisioner runs again when the instance starts from the warm pool into service.
+// ref. https://docs.aws.amazon.com/autoscaling/ec2/userguide/warm-pool-instance-lifecycle.html
+func warmingToIdle() bool {
+	if !skipInWarmPool {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	state, err := metadata.FetchTargetLifecycleState(ctx)
+	cancel()
+	if err != nil {
+		if !errors.Is(err, metadata.ErrNotFound) {
+			logutil.S().Warnw("failed to fetch target lifecycle state -- assuming not in warm pool", "error", err)
+		}
+		return false
+	}
+	logutil.S().Infow("fetched target lifecycle state", "state", state)
+	return asg.IsWarmedIdleState(state)
+}
+
+// Returns true if the local instance was started from the ASG warm pool,
+// where the EIPs associated before the stop are kept with the instance.
+// Errors are logged and treated as the regular launch (full discovery).
+func startedFromWarmPool(cfg aws_v2.Config, asgName string, instanceID string) bool {
+	var ok bool
+	err := callAWS(func(ctx context.Context) (err error) {
+		ok, err = asg.LaunchedFromWarmPool(ctx, cfg, asgName, instanceID)
+		return err
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to check warm pool launch -- falling back to full discovery", "error", err)
+		return false
+	}
+	return ok
+}
+
+// Returns true if all the recorded EIPs are still associated with the local instance
+// with the same public IPs, so they can be reused without the per-EIP verification.
+func recordedEIPsAssociated(eips ec2.EIPs, associated []aws_ec2_v2_types.Address) bool {
+	if len(eips) == 0 {
+		return false
+	}
+	cur := make(map[string]string, len(associated))
+	for _, addr := range associated {
+		cur[aws_v2.ToString(addr.AllocationId)] = addressIP(addr)
+	}
+	for _, eip := range eips {
+		if ip, ok := cur[eip.AllocationID]; !ok || ip != eip.PublicIP {
+			return false
+		}
+	}
+	return true
+}
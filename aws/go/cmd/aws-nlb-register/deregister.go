@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/elbv2"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/spf13/cobra"
+)
+
+var waitDeregistered time.Duration
+
+func newDeregisterCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deregister",
+		Short: "Deregisters the local instance from the target group (e.g., on ASG termination lifecycle hook).",
+		Args:  cobra.NoArgs,
+		Run:   deregisterFunc,
+	}
+	cmd.PersistentFlags().DurationVar(&waitDeregistered, "wait-deregistered", 5*time.Minute, "duration to wait for the connection draining to complete (0 to skip)")
+	return cmd
+}
+
+func deregisterFunc(cmd *cobra.Command, args []string) {
+	logutil.S().Infow("starting 'aws-nlb-register deregister'", "waitDeregistered", waitDeregistered)
+
+	cfg, tg, targetID := discover()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err := elbv2.DeregisterTargets(ctx, cfg, tg.ARN, []string{targetID}, elbv2.WithPort(port))
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to deregister target", "error", err)
+		logutil.Exit(1)
+	}
+
+	if waitDeregistered > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), waitDeregistered+time.Minute)
+		err = elbv2.WaitForTargetDeregistered(ctx, cfg, tg.ARN, targetID, waitDeregistered, elbv2.WithPort(port))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("target not deregistered in time", "error", err)
+			logutil.Exit(1)
+		}
+	}
+
+	if localInstancePublishTagKey != "" {
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		err = ec2.DeleteTags(ctx, cfg, []string{localInstanceID}, []string{localInstancePublishTagKey})
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to delete tags", "error", err)
+		}
+	}
+
+	logutil.S().Infow("successfully deregistered the local instance", "targetGroupARN", tg.ARN, "targetID", targetID)
+}
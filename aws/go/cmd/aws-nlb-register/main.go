@@ -0,0 +1,215 @@
+// Registers the local instance into the ELBv2 (NLB/ALB) target group.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
+	"github.com/gyuho/infra/aws/go/cmd/version"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/aws/go/elbv2"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+)
+
+const appName = "aws-nlb-register"
+
+var cmd = &cobra.Command{
+	Use:        appName,
+	Short:      appName,
+	Aliases:    []string{"nlb-register"},
+	SuggestFor: []string{"nlb-register"},
+	Run:        cmdFunc,
+}
+
+var (
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+	initialWaitRandomSeconds   int
+
+	targetGroupARN  string
+	targetGroupTags map[string]string
+	port            int32
+
+	waitInService time.Duration
+
+	localInstancePublishTagKey string
+
+	// set by "discover"
+	localInstanceID string
+)
+
+func init() {
+	cobra.EnablePrefixMatching = true
+	cmd.AddCommand(version.NewCommand(), newDeregisterCommand())
+
+	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region of the target group")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
+	cmd.PersistentFlags().IntVar(&initialWaitRandomSeconds, "initial-wait-random-seconds", 10, "maximum number of seconds to wait (value chosen at random with the range)")
+
+	cmd.PersistentFlags().StringVar(&targetGroupARN, "target-group-arn", "", "target group ARN to register the local instance (if empty, --target-group-tags is used)")
+	cmd.PersistentFlags().StringToStringVar(&targetGroupTags, "target-group-tags", nil, "tags to find the target group (e.g., Kind=my-nlb,Id=abc)")
+	cmd.PersistentFlags().Int32Var(&port, "port", 0, "target port (0 to use the target group port)")
+
+	cmd.PersistentFlags().DurationVar(&waitInService, "wait-in-service", 0, "duration to wait for the target to be healthy after registration (0 to skip)")
+
+	cmd.PersistentFlags().StringVar(&localInstancePublishTagKey, "local-instance-publish-tag-key", "AWS_NLB_REGISTER_TARGET_GROUP_ARN", "tag key to create with the target group ARN to the local EC2 instance")
+}
+
+func main() {
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
+		logutil.Exit(1)
+	}
+	logutil.Exit(0)
+}
+
+func cmdFunc(cmd *cobra.Command, args []string) {
+	initialWait := time.Duration(rand.Intn(initialWaitRandomSeconds+1)) * time.Second
+	logutil.S().Infow("starting 'aws-nlb-register'", "initialWait", initialWait)
+	time.Sleep(initialWait)
+
+	cfg, tg, targetID := discover()
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err := elbv2.RegisterTargets(ctx, cfg, tg.ARN, []string{targetID}, elbv2.WithPort(port))
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to register target", "error", err)
+		logutil.Exit(1)
+	}
+
+	if waitInService > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), waitInService)
+		_, err = elbv2.WaitForTargetHealthy(ctx, cfg, tg.ARN, targetID, elbv2.WithPort(port), elbv2.WithInterval(10*time.Second))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("target not in service in time", "error", err)
+			logutil.Exit(1)
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	hs, err := elbv2.DescribeTargetHealth(ctx, cfg, tg.ARN, []string{targetID}, elbv2.WithPort(port))
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to describe target health", "error", err)
+		logutil.Exit(1)
+	}
+	for _, h := range hs {
+		logutil.S().Infow("target health", "targetID", h.TargetID, "port", h.Port, "state", h.State, "reason", h.Reason)
+	}
+
+	if localInstancePublishTagKey != "" {
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		err = ec2.CreateTags(ctx, cfg, []string{localInstanceID}, map[string]string{localInstancePublishTagKey: tg.ARN})
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to create tags", "error", err)
+			logutil.Exit(1)
+		}
+	}
+
+	logutil.S().Infow("successfully registered the local instance", "targetGroupARN", tg.ARN, "targetID", targetID)
+}
+
+// Discovers the local instance and the target group, and returns the target ID to register
+// (the instance ID for the "instance" target type, the private IPv4 for the "ip" target type).
+func discover() (aws_v2.Config, elbv2.TargetGroup, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	var err error
+	localInstanceID, err = metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(1)
+	}
+
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	var tg elbv2.TargetGroup
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	switch {
+	case targetGroupARN != "":
+		tg, err = elbv2.GetTargetGroup(ctx, cfg, targetGroupARN)
+	case len(targetGroupTags) > 0:
+		tg, err = elbv2.FindTargetGroupByTags(ctx, cfg, targetGroupTags)
+	default:
+		err = errors.New("empty --target-group-arn and --target-group-tags")
+	}
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to find target group", "error", err)
+		logutil.Exit(1)
+	}
+	logutil.S().Infow("found target group", "arn", tg.ARN, "name", tg.Name, "targetType", tg.TargetType)
+
+	targetID := localInstanceID
+	switch tg.TargetType {
+	case "instance":
+	case "ip":
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		targetID, err = metadata.FetchLocalIPV4(ctx)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to fetch local IPv4", "error", err)
+			logutil.Exit(1)
+		}
+	default:
+		logutil.S().Warnw("unsupported target type", "targetType", tg.TargetType)
+		logutil.Exit(1)
+	}
+	return cfg, tg, targetID
+}
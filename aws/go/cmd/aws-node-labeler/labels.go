@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gyuho/infra/aws/go/asg"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const asgNameTagKey = "aws:autoscaling:groupName"
+
+// Represents the tags of the local instance written to "--json-file".
+type nodeTags struct {
+	InstanceID string            `json:"instance_id"`
+	ASGName    string            `json:"asg_name,omitempty"`
+	Tags       map[string]string `json:"tags"`
+}
+
+// Fetches the tags of the instance, merged over the tags of its ASG.
+func fetchNodeTags(ctx context.Context, cfg aws_v2.Config, instanceID string) (nodeTags, error) {
+	inst, err := ec2.GetInstance(ctx, cfg, instanceID)
+	if err != nil {
+		return nodeTags{}, err
+	}
+	instTags := make(map[string]string, len(inst.Tags))
+	for _, tg := range inst.Tags {
+		instTags[aws_v2.ToString(tg.Key)] = aws_v2.ToString(tg.Value)
+	}
+
+	nt := nodeTags{InstanceID: instanceID, ASGName: instTags[asgNameTagKey]}
+	var asgTags map[string]string
+	if includeASGTags && nt.ASGName != "" {
+		a, err := asg.GetASG(ctx, cfg, nt.ASGName)
+		if err != nil {
+			return nodeTags{}, err
+		}
+		asgTags = a.Tags
+	}
+	nt.Tags = filterTags(asgTags, instTags, tagKeys, includeAWSTags)
+	return nt, nil
+}
+
+// Merges the instance tags over the ASG tags, and filters them by the keys (if any).
+func filterTags(asgTags map[string]string, instTags map[string]string, keys []string, includeAWS bool) map[string]string {
+	want := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		want[k] = struct{}{}
+	}
+	tags := make(map[string]string)
+	for _, src := range []map[string]string{asgTags, instTags} {
+		for k, v := range src {
+			if !includeAWS && strings.HasPrefix(k, "aws:") {
+				continue
+			}
+			if len(want) > 0 {
+				if _, ok := want[k]; !ok {
+					continue
+				}
+			}
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+// Writes the tags to the configured files, and returns the paths of the changed files.
+func writeOutputs(nt nodeTags) ([]string, error) {
+	outs := make(map[string][]byte)
+	if labelFile != "" {
+		outs[labelFile] = encodeLabels(labelPrefix, nt.Tags)
+	}
+	if envFile != "" {
+		outs[envFile] = encodeEnv(envPrefix, nt.Tags)
+	}
+	if jsonFile != "" {
+		b, err := json.MarshalIndent(nt, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		outs[jsonFile] = append(b, '\n')
+	}
+
+	paths := make([]string, 0, len(outs))
+	for p := range outs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	changed := make([]string, 0)
+	for _, p := range paths {
+		ok, err := writeIfChanged(p, outs[p])
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed = append(changed, p)
+		}
+	}
+	return changed, nil
+}
+
+// Encodes the tags as the "key=value,..." node labels, with the keys and values
+// sanitized to the label syntax. The tags that sanitize to the same key keep the last.
+// ref. https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#syntax-and-character-set
+func encodeLabels(prefix string, tags map[string]string) []byte {
+	labels := make(map[string]string, len(tags))
+	for k, v := range tags {
+		name := sanitizeLabel(k)
+		if name == "" {
+			logutil.S().Warnw("skipping tag with invalid label key", "key", k)
+			continue
+		}
+		labels[prefix+name] = sanitizeLabel(v)
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, k+"="+labels[k])
+	}
+	return []byte(strings.Join(kvs, ",") + "\n")
+}
+
+// Returns the label name (or value) with the invalid characters replaced with "_",
+// truncated to 63 characters, and trimmed to start and end with an alphanumeric character.
+func sanitizeLabel(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !isAlnum(c) && c != '-' && c != '_' && c != '.' {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 63 {
+		b = b[:63]
+	}
+	return strings.TrimFunc(string(b), func(r rune) bool {
+		return r > 0x7f || !isAlnum(byte(r))
+	})
+}
+
+func isAlnum(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// Encodes the tags as the "PREFIX_KEY=\"value\"" lines, with the keys upper-cased
+// and the invalid characters replaced with "_" (e.g., "Name" to "AWS_TAG_NAME").
+func encodeEnv(prefix string, tags map[string]string) []byte {
+	envs := make(map[string]string, len(tags))
+	for k, v := range tags {
+		envs[prefix+envName(k)] = v
+	}
+	keys := make([]string, 0, len(envs))
+	for k := range envs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.NewBuffer(nil)
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`", "\n", " ", "\r", " ")
+	for _, k := range keys {
+		fmt.Fprintf(buf, "%s=\"%s\"\n", k, r.Replace(envs[k]))
+	}
+	return buf.Bytes()
+}
+
+func envName(k string) string {
+	b := []byte(strings.ToUpper(k))
+	for i, c := range b {
+		if !isAlnum(c) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// Writes the file atomically only if the content differs, and returns true if written.
+func writeIfChanged(p string, b []byte) (bool, error) {
+	if cur, err := os.ReadFile(p); err == nil && bytes.Equal(cur, b) {
+		return false, nil
+	}
+
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	tmp := filepath.Join(dir, "."+filepath.Base(p)+".tmp")
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
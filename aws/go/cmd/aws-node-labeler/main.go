@@ -0,0 +1,170 @@
+// Instance tags to node labels for AWS.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
+	"github.com/gyuho/infra/aws/go/cmd/version"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/spf13/cobra"
+)
+
+const appName = "aws-node-labeler"
+
+var cmd = &cobra.Command{
+	Use:        appName,
+	Short:      appName,
+	Aliases:    []string{"node-labeler"},
+	SuggestFor: []string{"node-labeler", "node-labeller"},
+	Run:        cmdFunc,
+}
+
+var (
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+
+	includeASGTags bool
+	includeAWSTags bool
+	tagKeys        []string
+
+	labelFile   string
+	labelPrefix string
+	envFile     string
+	envPrefix   string
+	jsonFile    string
+
+	interval time.Duration
+)
+
+func init() {
+	cobra.EnablePrefixMatching = true
+	cmd.AddCommand(version.NewCommand())
+
+	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region of the local instance")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
+
+	cmd.PersistentFlags().BoolVar(&includeASGTags, "include-asg-tags", true, "true to include the tags of the ASG of the local instance (the instance tags take precedence)")
+	cmd.PersistentFlags().BoolVar(&includeAWSTags, "include-aws-tags", false, "true to include the tags with the reserved 'aws:' prefix (e.g., 'aws:autoscaling:groupName')")
+	cmd.PersistentFlags().StringSliceVar(&tagKeys, "tag-keys", nil, "tag keys to include (leave empty to include all)")
+
+	cmd.PersistentFlags().StringVar(&labelFile, "label-file", "", "file path to write the tags as the comma-separated Kubernetes node labels (e.g., for kubelet --node-labels, leave empty to skip)")
+	cmd.PersistentFlags().StringVar(&labelPrefix, "label-prefix", "", "prefix of the node label keys (e.g., 'aws.example.com/')")
+	cmd.PersistentFlags().StringVar(&envFile, "env-file", "", "file path to write the tags as the environment variables (e.g., for systemd EnvironmentFile=, leave empty to skip)")
+	cmd.PersistentFlags().StringVar(&envPrefix, "env-prefix", "AWS_TAG_", "prefix of the environment variable names")
+	cmd.PersistentFlags().StringVar(&jsonFile, "json-file", "", "file path to write the tags as the JSON document (leave empty to skip)")
+
+	cmd.PersistentFlags().DurationVar(&interval, "interval", 0, "interval to re-read the tags and re-write the changed files (0 to run once and exit)")
+}
+
+func main() {
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
+		logutil.Exit(1)
+	}
+	logutil.Exit(0)
+}
+
+func cmdFunc(cmd *cobra.Command, args []string) {
+	if labelFile == "" && envFile == "" && jsonFile == "" {
+		logutil.S().Warnw("no --label-file, --env-file, or --json-file")
+		logutil.Exit(1)
+	}
+	logutil.S().Infow("starting 'aws-node-labeler'", "labelFile", labelFile, "envFile", envFile, "jsonFile", jsonFile, "interval", interval)
+
+	rootCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	localInstanceID, err := metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(1)
+	}
+
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(rootCtx, 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
+	}
+
+	for {
+		ctx, cancel = context.WithTimeout(rootCtx, time.Minute)
+		nt, err := fetchNodeTags(ctx, cfg, localInstanceID)
+		cancel()
+		if err == nil {
+			var changed []string
+			changed, err = writeOutputs(nt)
+			if len(changed) > 0 {
+				logutil.S().Infow("wrote changed tags", "files", changed, "tags", len(nt.Tags))
+			} else if err == nil {
+				logutil.S().Infow("tags unchanged", "tags", len(nt.Tags))
+			}
+		}
+		if err != nil {
+			if interval == 0 {
+				logutil.S().Warnw("failed to write tags", "error", err)
+				logutil.Exit(1)
+			}
+			logutil.S().Warnw("failed to write tags -- retrying in next interval", "error", err)
+		}
+
+		if interval == 0 {
+			return
+		}
+		select {
+		case <-rootCtx.Done():
+			logutil.S().Infow("received signal -- exiting", "error", rootCtx.Err())
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Secrets Manager secret fetcher for AWS.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
+	"github.com/gyuho/infra/aws/go/cmd/version"
+	"github.com/gyuho/infra/aws/go/secrets"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/spf13/cobra"
+)
+
+const appName = "aws-secret-fetcher"
+
+var cmd = &cobra.Command{
+	Use:        appName,
+	Short:      appName,
+	Aliases:    []string{"secret-fetcher"},
+	SuggestFor: []string{"secret-fetcher", "secrets-fetcher"},
+	Run:        cmdFunc,
+}
+
+var (
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+
+	files        []string
+	templates    []string
+	envVars      []string
+	envFile      string
+	versionStage string
+	fileMode     string
+	fileOwner    string
+
+	interval time.Duration
+	cacheTTL time.Duration
+
+	reloadUnit   string
+	reloadAction string
+)
+
+func init() {
+	cobra.EnablePrefixMatching = true
+	cmd.AddCommand(version.NewCommand())
+
+	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region of the secrets")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
+
+	cmd.PersistentFlags().StringArrayVar(&files, "file", nil, "'SECRET_ID=PATH' to write the secret value (string or binary) as is (repeatable)")
+	cmd.PersistentFlags().StringArrayVar(&templates, "template", nil, "'TEMPLATE_PATH=PATH' to render the Go template with the 'secret', 'secretJSON', and 'secretBase64' functions (e.g., {{ secretJSON \"db\" \"password\" }}) (repeatable)")
+	cmd.PersistentFlags().StringArrayVar(&envVars, "env", nil, "'NAME=SECRET_ID' or 'NAME=SECRET_ID#JSON_KEY' to write to --env-file (repeatable)")
+	cmd.PersistentFlags().StringVar(&envFile, "env-file", "", "file path to write the --env variables (e.g., for systemd EnvironmentFile=)")
+	cmd.PersistentFlags().StringVar(&versionStage, "version-stage", secrets.VersionStageCurrent, "version stage of the secrets to fetch")
+	cmd.PersistentFlags().StringVar(&fileMode, "file-mode", "0600", "octal file mode of the written files")
+	cmd.PersistentFlags().StringVar(&fileOwner, "file-owner", "", "'USER' or 'USER:GROUP' to own the written files (leave empty to keep the current user)")
+
+	cmd.PersistentFlags().DurationVar(&interval, "interval", 0, "interval to re-fetch the secrets and re-render the changed files (0 to run once and exit)")
+	cmd.PersistentFlags().DurationVar(&cacheTTL, "cache-ttl", 30*time.Second, "duration to cache the fetched secrets (the changes are picked up within --interval plus the TTL)")
+
+	cmd.PersistentFlags().StringVar(&reloadUnit, "reload-unit", "", "systemd unit to signal when any file changes (leave empty to skip)")
+	cmd.PersistentFlags().StringVar(&reloadAction, "reload-action", "try-reload-or-restart", "systemctl action for --reload-unit (e.g., 'try-restart', 'kill --signal=SIGHUP')")
+}
+
+func main() {
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
+		logutil.Exit(1)
+	}
+	logutil.Exit(0)
+}
+
+func cmdFunc(cmd *cobra.Command, args []string) {
+	targets, err := parseTargets(files, templates, envVars, envFile)
+	if err != nil {
+		logutil.S().Warnw("invalid targets", "error", err)
+		logutil.Exit(1)
+	}
+	perm, err := parseFilePerm(fileMode, fileOwner)
+	if err != nil {
+		logutil.S().Warnw("invalid file permissions", "error", err)
+		logutil.Exit(1)
+	}
+	logutil.S().Infow("starting 'aws-secret-fetcher'", "targets", len(targets), "versionStage", versionStage, "interval", interval, "reloadUnit", reloadUnit)
+
+	rootCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
+	}
+
+	cache := secrets.NewCache(cfg, cacheTTL)
+
+	// set until the unit reloads successfully, so that the files written before the failed write
+	// (or the failed reload) are reloaded in the next interval, although unchanged by then
+	reloadPending := false
+	for {
+		ctx, cancel = context.WithTimeout(rootCtx, 2*time.Minute)
+		changed, err := renderTargets(ctx, cache, targets, perm)
+		cancel()
+		if len(changed) > 0 {
+			logutil.S().Infow("rendered changed secrets", "files", changed)
+			reloadPending = reloadUnit != ""
+		}
+		switch {
+		case err != nil && interval == 0:
+			logutil.S().Warnw("failed to render secrets", "error", err)
+		case err != nil:
+			logutil.S().Warnw("failed to render secrets -- retrying in next interval", "error", err)
+		case len(changed) == 0 && !reloadPending:
+			logutil.S().Infow("secrets unchanged")
+		}
+
+		if reloadPending {
+			ctx, cancel = context.WithTimeout(rootCtx, time.Minute)
+			rerr := reload(ctx, reloadUnit, reloadAction)
+			cancel()
+			if rerr != nil {
+				logutil.S().Warnw("failed to reload unit", "unit", reloadUnit, "error", rerr)
+				if interval == 0 {
+					logutil.Exit(1)
+				}
+			} else {
+				reloadPending = false
+			}
+		}
+		if err != nil && interval == 0 {
+			logutil.Exit(1)
+		}
+
+		if interval == 0 {
+			return
+		}
+		select {
+		case <-rootCtx.Done():
+			logutil.S().Infow("received signal -- exiting", "error", rootCtx.Err())
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+
+	"github.com/gyuho/infra/aws/go/secrets"
+	"github.com/gyuho/infra/go/logutil"
+)
+
+const (
+	targetKindFile     = "file"
+	targetKindTemplate = "template"
+	targetKindEnv      = "env"
+)
+
+// Represents the file to render from the secrets.
+type target struct {
+	kind string
+	path string
+
+	// for "file"
+	secretID string
+	// for "template"
+	templatePath string
+	// for "env"
+	envs []envVar
+}
+
+// Represents the "--env" variable from the secret (or the key of the JSON secret).
+type envVar struct {
+	name     string
+	secretID string
+	jsonKey  string
+}
+
+// Represents the mode and owner of the rendered files (-1 to keep the current user or group).
+type filePerm struct {
+	mode os.FileMode
+	uid  int
+	gid  int
+}
+
+func parseTargets(files []string, templates []string, envs []string, envFile string) ([]target, error) {
+	targets := make([]target, 0, len(files)+len(templates)+1)
+	for _, s := range files {
+		secretID, p, err := splitPair(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --file (%w)", err)
+		}
+		targets = append(targets, target{kind: targetKindFile, path: p, secretID: secretID})
+	}
+	for _, s := range templates {
+		src, p, err := splitPair(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --template (%w)", err)
+		}
+		targets = append(targets, target{kind: targetKindTemplate, path: p, templatePath: src})
+	}
+
+	if len(envs) > 0 && envFile == "" {
+		return nil, errors.New("--env requires --env-file")
+	}
+	if envFile != "" {
+		t := target{kind: targetKindEnv, path: envFile}
+		for _, s := range envs {
+			name, ref, err := splitPair(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --env (%w)", err)
+			}
+			secretID, jsonKey, _ := strings.Cut(ref, "#")
+			t.envs = append(t.envs, envVar{name: name, secretID: secretID, jsonKey: jsonKey})
+		}
+		if len(t.envs) == 0 {
+			return nil, errors.New("--env-file requires --env")
+		}
+		targets = append(targets, t)
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("no --file, --template, or --env-file")
+	}
+	seen := make(map[string]struct{}, len(targets))
+	for _, t := range targets {
+		if _, ok := seen[t.path]; ok {
+			return nil, fmt.Errorf("duplicate output path %q", t.path)
+		}
+		seen[t.path] = struct{}{}
+	}
+	return targets, nil
+}
+
+func splitPair(s string) (string, string, error) {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" || v == "" {
+		return "", "", fmt.Errorf("expected 'KEY=VALUE', got %q", s)
+	}
+	return k, v, nil
+}
+
+func parseFilePerm(mode string, owner string) (filePerm, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return filePerm{}, fmt.Errorf("invalid file mode %q (%w)", mode, err)
+	}
+	perm := filePerm{mode: os.FileMode(m).Perm(), uid: -1, gid: -1}
+	if owner == "" {
+		return perm, nil
+	}
+
+	userName, groupName, _ := strings.Cut(owner, ":")
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return filePerm{}, err
+	}
+	if perm.uid, err = strconv.Atoi(u.Uid); err != nil {
+		return filePerm{}, err
+	}
+	if groupName == "" {
+		return perm, nil
+	}
+	g, err := user.LookupGroup(groupName)
+	if err != nil {
+		return filePerm{}, err
+	}
+	if perm.gid, err = strconv.Atoi(g.Gid); err != nil {
+		return filePerm{}, err
+	}
+	return perm, nil
+}
+
+// Renders all the targets, and returns the paths of the changed files.
+// All the targets are rendered before any write, so the failed fetch
+// does not leave the partially updated files. On the failed write, returns
+// the files written before the failure with the error, to be reloaded.
+func renderTargets(ctx context.Context, cache *secrets.Cache, targets []target, perm filePerm) ([]string, error) {
+	get := func(secretID string) (secrets.Secret, error) {
+		return cache.Get(ctx, secretID, secrets.WithVersionStage(versionStage))
+	}
+
+	rendered := make([][]byte, len(targets))
+	for i, t := range targets {
+		b, err := renderTarget(t, get)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %q (%w)", t.path, err)
+		}
+		rendered[i] = b
+	}
+
+	changed := make([]string, 0)
+	for i, t := range targets {
+		ok, err := writeIfChanged(t.path, rendered[i], perm)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed = append(changed, t.path)
+		}
+	}
+	return changed, nil
+}
+
+func renderTarget(t target, get func(string) (secrets.Secret, error)) ([]byte, error) {
+	switch t.kind {
+	case targetKindFile:
+		s, err := get(t.secretID)
+		if err != nil {
+			return nil, err
+		}
+		return s.Bytes(), nil
+
+	case targetKindTemplate:
+		b, err := os.ReadFile(t.templatePath)
+		if err != nil {
+			return nil, err
+		}
+		return renderTemplate(filepath.Base(t.templatePath), string(b), get)
+
+	case targetKindEnv:
+		return renderEnvFile(t.envs, get)
+
+	default:
+		return nil, fmt.Errorf("unknown target kind %q", t.kind)
+	}
+}
+
+func renderTemplate(name string, text string, get func(string) (secrets.Secret, error)) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"secret": func(secretID string) (string, error) {
+			s, err := get(secretID)
+			if err != nil {
+				return "", err
+			}
+			return string(s.Bytes()), nil
+		},
+		"secretJSON": func(secretID string, key string) (string, error) {
+			s, err := get(secretID)
+			if err != nil {
+				return "", err
+			}
+			return s.JSONValue(key)
+		},
+		"secretBase64": func(secretID string) (string, error) {
+			s, err := get(secretID)
+			if err != nil {
+				return "", err
+			}
+			return base64.StdEncoding.EncodeToString(s.Bytes()), nil
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err = tmpl.Execute(buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Renders the "NAME=\"VALUE\"" lines sorted by the name, for systemd "EnvironmentFile=" and shells.
+func renderEnvFile(envs []envVar, get func(string) (secrets.Secret, error)) ([]byte, error) {
+	sorted := append([]envVar(nil), envs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+
+	buf := bytes.NewBuffer(nil)
+	for _, ev := range sorted {
+		s, err := get(ev.secretID)
+		if err != nil {
+			return nil, err
+		}
+		v := string(s.Bytes())
+		if ev.jsonKey != "" {
+			if v, err = s.JSONValue(ev.jsonKey); err != nil {
+				return nil, err
+			}
+		}
+		if strings.ContainsAny(v, "\r\n\x00") {
+			return nil, fmt.Errorf("env %q has the multi-line value (use --file or --template instead)", ev.name)
+		}
+		fmt.Fprintf(buf, "%s=%s\n", ev.name, quoteEnvValue(v))
+	}
+	return buf.Bytes(), nil
+}
+
+func quoteEnvValue(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(v) + `"`
+}
+
+// Writes the file atomically only if the content or the permissions differ,
+// and returns true if written.
+func writeIfChanged(p string, b []byte, perm filePerm) (bool, error) {
+	if fi, err := os.Stat(p); err == nil && fi.Mode().Perm() == perm.mode && ownedBy(fi, perm) {
+		cur, err := os.ReadFile(p)
+		if err == nil && sha256.Sum256(cur) == sha256.Sum256(b) {
+			return false, nil
+		}
+	}
+
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(p)+".tmp-")
+	if err != nil {
+		return false, err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err = f.Chmod(perm.mode); err == nil && (perm.uid >= 0 || perm.gid >= 0) {
+		err = f.Chown(perm.uid, perm.gid)
+	}
+	if err == nil {
+		_, err = f.Write(b)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, err
+	}
+	if err = os.Rename(tmp, p); err != nil {
+		return false, err
+	}
+
+	logutil.S().Infow("wrote file", "path", p, "mode", perm.mode)
+	return true, nil
+}
+
+func ownedBy(fi os.FileInfo, perm filePerm) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+	return (perm.uid < 0 || int(st.Uid) == perm.uid) && (perm.gid < 0 || int(st.Gid) == perm.gid)
+}
+
+// Signals the systemd unit to pick up the changed files.
+func reload(ctx context.Context, unit string, action string) error {
+	args := append([]string{"systemctl"}, strings.Fields(action)...)
+	args = append(args, unit)
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%q failed %q (%w)", strings.Join(args, " "), string(out), err)
+	}
+	logutil.S().Infow("reloaded unit", "unit", unit, "action", action)
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/asg"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/aws/go/elbv2"
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Runs the configured drain actions concurrently within the context deadline,
+// and completes the lifecycle hook last, since the completion lets the ASG terminate the instance.
+func drain(ctx context.Context, cfg aws_v2.Config, instanceID string, ev metadata.SpotEvent) error {
+	deadline, _ := ctx.Deadline()
+	logutil.S().Infow("draining", "type", ev.Type, "action", ev.Action, "time", ev.Time, "deadline", deadline)
+
+	actions := make(map[string]func(context.Context) error)
+	if len(targetGroupARNs) > 0 {
+		actions["deregister-targets"] = func(ctx context.Context) error {
+			return deregisterTargets(ctx, cfg, instanceID)
+		}
+	}
+	if disassociateEIPs {
+		actions["disassociate-eips"] = func(ctx context.Context) error {
+			return disassociateLocalEIPs(ctx, cfg, instanceID)
+		}
+	}
+	if snapshotVolumes {
+		actions["snapshot-volumes"] = func(ctx context.Context) error {
+			return snapshotLocalVolumes(ctx, cfg, instanceID)
+		}
+	}
+	if execHook != "" {
+		actions["exec-hook"] = func(ctx context.Context) error {
+			return runExecHook(ctx, instanceID, ev)
+		}
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for name, f := range actions {
+		wg.Add(1)
+		go func(name string, f func(context.Context) error) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := f(ctx)
+			if err != nil {
+				logutil.S().Warnw("drain action failed", "action", name, "took", time.Since(start), "error", err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				mu.Unlock()
+				return
+			}
+			logutil.S().Infow("drain action done", "action", name, "took", time.Since(start))
+		}(name, f)
+	}
+	wg.Wait()
+
+	// complete the hook even if the other actions failed, since the instance is interrupted anyway
+	if lifecycleHookName != "" {
+		if err := completeLifecycleAction(ctx, cfg, instanceID); err != nil {
+			errs = append(errs, fmt.Errorf("complete-lifecycle-action: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func deregisterTargets(ctx context.Context, cfg aws_v2.Config, instanceID string) error {
+	for _, arn := range targetGroupARNs {
+		if err := elbv2.DeregisterTargets(ctx, cfg, arn, []string{instanceID}, elbv2.WithPort(targetPort)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func disassociateLocalEIPs(ctx context.Context, cfg aws_v2.Config, instanceID string) error {
+	addrs, err := ec2.ListEIPs(ctx, cfg, ec2.WithFilters(map[string][]string{
+		"instance-id": {instanceID},
+	}))
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if addr.AssociationId == nil {
+			continue
+		}
+		if err = ec2.DisassociateEIP(ctx, cfg, *addr.AssociationId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshots the non-root EBS volumes, without waiting for the snapshots to complete,
+// since the snapshot is point-in-time as of the request.
+func snapshotLocalVolumes(ctx context.Context, cfg aws_v2.Config, instanceID string) error {
+	inst, err := ec2.GetInstance(ctx, cfg, instanceID)
+	if err != nil {
+		return err
+	}
+	rootDevice := aws_v2.ToString(inst.RootDeviceName)
+
+	now := time.Now().UTC()
+	for _, bdm := range inst.BlockDeviceMappings {
+		if bdm.Ebs == nil || aws_v2.ToString(bdm.DeviceName) == rootDevice {
+			continue
+		}
+		volumeID := aws_v2.ToString(bdm.Ebs.VolumeId)
+		snapshotID, err := ec2.CreateSnapshot(
+			ctx,
+			cfg,
+			volumeID,
+			ec2.WithDescription(fmt.Sprintf("%s snapshot of %s from %s", appName, volumeID, instanceID)),
+			ec2.WithTags(map[string]string{
+				"Name":             fmt.Sprintf("%s-%s", volumeID, now.Format("20060102-150405")),
+				"SourceInstanceID": instanceID,
+				"SourceVolumeID":   volumeID,
+			}),
+		)
+		if err != nil {
+			return err
+		}
+		logutil.S().Infow("created snapshot", "volumeID", volumeID, "snapshotID", snapshotID)
+	}
+	return nil
+}
+
+func runExecHook(ctx context.Context, instanceID string, ev metadata.SpotEvent) error {
+	c := exec.CommandContext(ctx, "/bin/sh", "-c", execHook)
+	c.Env = append(os.Environ(),
+		"SPOT_EVENT_TYPE="+string(ev.Type),
+		"SPOT_ACTION="+ev.Action,
+		"SPOT_TIME="+ev.Time.Format(time.RFC3339),
+		"INSTANCE_ID="+instanceID,
+	)
+	out, err := c.CombinedOutput()
+	logutil.S().Infow("ran exec hook", "command", execHook, "output", string(out))
+	return err
+}
+
+func completeLifecycleAction(ctx context.Context, cfg aws_v2.Config, instanceID string) error {
+	asgName, err := asg.FindASGName(ctx, cfg, instanceID)
+	if err != nil {
+		return err
+	}
+	return asg.CompleteLifecycleAction(ctx, cfg, asgName, lifecycleHookName, instanceID, asg.LifecycleActionContinue)
+}
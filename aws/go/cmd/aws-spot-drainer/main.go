@@ -0,0 +1,161 @@
+// Spot drainer for AWS, to drain the local instance on the spot interruption (or rebalance) notices.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
+	"github.com/gyuho/infra/aws/go/cmd/version"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/spf13/cobra"
+)
+
+const appName = "aws-spot-drainer"
+
+var cmd = &cobra.Command{
+	Use:        appName,
+	Short:      appName,
+	Aliases:    []string{"spot-drainer"},
+	SuggestFor: []string{"spot-drainer"},
+	Run:        cmdFunc,
+}
+
+var (
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+	pollInterval               time.Duration
+	drainOnRebalance           bool
+	drainMargin                time.Duration
+
+	lifecycleHookName string
+	targetGroupARNs   []string
+	targetPort        int32
+	disassociateEIPs  bool
+	snapshotVolumes   bool
+	execHook          string
+)
+
+func init() {
+	cobra.EnablePrefixMatching = true
+	cmd.AddCommand(version.NewCommand())
+
+	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region of the local instance")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
+	cmd.PersistentFlags().DurationVar(&pollInterval, "poll-interval", 5*time.Second, "interval to poll the instance metadata for the spot notices")
+	cmd.PersistentFlags().BoolVar(&drainOnRebalance, "drain-on-rebalance", false, "true to drain on the rebalance recommendation (otherwise, only on the interruption notice)")
+	cmd.PersistentFlags().DurationVar(&drainMargin, "drain-margin", 10*time.Second, "duration before the interruption action time to finish the drain actions by")
+
+	cmd.PersistentFlags().StringVar(&lifecycleHookName, "lifecycle-hook-name", "", "ASG lifecycle hook name to complete after the other drain actions (if empty, skip)")
+	cmd.PersistentFlags().StringSliceVar(&targetGroupARNs, "target-group-arns", nil, "target group ARNs to deregister the local instance from (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&targetPort, "target-port", 0, "target port the local instance is registered with (0 to use the target group port)")
+	cmd.PersistentFlags().BoolVar(&disassociateEIPs, "disassociate-eips", false, "true to disassociate the EIPs of the local instance, for the replacement to claim")
+	cmd.PersistentFlags().BoolVar(&snapshotVolumes, "snapshot-volumes", false, "true to snapshot the non-root EBS volumes of the local instance")
+	cmd.PersistentFlags().StringVar(&execHook, "exec-hook", "", "command to run with '/bin/sh -c' on drain, with the SPOT_EVENT_TYPE, SPOT_ACTION, SPOT_TIME, and INSTANCE_ID environment variables (if empty, skip)")
+}
+
+func main() {
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
+		logutil.Exit(1)
+	}
+	logutil.Exit(0)
+}
+
+func cmdFunc(cmd *cobra.Command, args []string) {
+	logutil.S().Infow("starting 'aws-spot-drainer'", "pollInterval", pollInterval, "drainOnRebalance", drainOnRebalance)
+
+	rootCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(rootCtx, 30*time.Second)
+	localInstanceID, err := metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(1)
+	}
+
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(rootCtx, 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
+	}
+
+	drained := false
+	for ev := range metadata.WatchSpotEvents(rootCtx, pollInterval) {
+		if drained {
+			logutil.S().Infow("already drained, ignoring spot event", "type", ev.Type, "action", ev.Action)
+			continue
+		}
+		if ev.Type == metadata.SpotEventTypeRebalanceRecommendation && !drainOnRebalance {
+			logutil.S().Infow("received rebalance recommendation, not draining", "noticeTime", ev.Time)
+			continue
+		}
+
+		// the interruption notice is sent 2 minutes before the action time,
+		// and the rebalance recommendation time is when the notice was sent
+		deadline := ev.Time.Add(-drainMargin)
+		if ev.Type == metadata.SpotEventTypeRebalanceRecommendation || time.Until(deadline) <= 0 {
+			deadline = time.Now().Add(2*time.Minute - drainMargin)
+		}
+		ctx, cancel := context.WithDeadline(rootCtx, deadline)
+		err := drain(ctx, cfg, localInstanceID, ev)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to drain", "error", err)
+			logutil.Exit(1)
+		}
+
+		// keep running until the instance is interrupted, so the process manager does not restart and drain again
+		drained = true
+		logutil.S().Infow("successfully drained", "type", ev.Type, "action", ev.Action)
+	}
+	logutil.S().Infow("stopped watching spot events", "error", rootCtx.Err())
+}
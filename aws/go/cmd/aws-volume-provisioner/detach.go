@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/fileutil"
+	"github.com/gyuho/infra/go/logutil"
+	"github.com/gyuho/infra/linux/go/disk"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/spf13/cobra"
+)
+
+var (
+	detachSnapshot bool
+	detachForce    bool
+)
+
+// Tags the snapshots taken by the "detach" command.
+const (
+	snapshotSourceInstanceTagKey = "SourceInstanceID"
+	snapshotSourceVolumeTagKey   = "SourceVolumeID"
+	snapshotDateTagKey           = "SnapshotDate"
+)
+
+func newDetachCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "detach",
+		Short: "Unmounts and detaches the provisioned volumes of the local instance, for the next instance to reuse (e.g., on ASG termination lifecycle hook).",
+		Args:  cobra.NoArgs,
+		Run:   detachFunc,
+	}
+	cmd.PersistentFlags().BoolVar(&detachSnapshot, "snapshot", false, "true to snapshot the volumes after unmount, before detach")
+	cmd.PersistentFlags().BoolVar(&detachForce, "force", false, "true to force detach the volumes (may lose the unflushed writes)")
+	cmd.PersistentFlags().StringVar(&lifecycleHookName, "lifecycle-hook-name", "", "ASG lifecycle hook name to record heartbeats for during detach, and to complete once detached (if empty, skip)")
+	cmd.PersistentFlags().DurationVar(&lifecycleHeartbeatInterval, "lifecycle-heartbeat-interval", time.Minute, "interval to record the lifecycle heartbeats (must be shorter than the hook heartbeat timeout)")
+	return cmd
+}
+
+func detachFunc(cmd *cobra.Command, args []string) {
+	logutil.S().Infow("starting 'aws-volume-provisioner detach'", "snapshot", detachSnapshot, "force", detachForce)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	localInstanceID, err := metadata.FetchInstanceID(ctx)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
+		logutil.Exit(1)
+	}
+
+	cfg, err := aws.New(&aws.Config{
+		Region:               region,
+		RoleARN:              assumeRoleARN,
+		ExternalID:           assumeRoleExternalID,
+		SessionName:          assumeRoleSessionName,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
+	})
+	if err != nil {
+		logutil.S().Warnw("failed to create aws config", "error", err)
+		logutil.Exit(1)
+	}
+
+	completeLifecycleAction := startLifecycleAction(cfg, localInstanceID)
+
+	vols, err := loadAttachedVolumes(cfg, localInstanceID)
+	if err != nil {
+		logutil.S().Warnw("failed to load attached volumes", "error", err)
+		logutil.Exit(1)
+	}
+	if len(vols) == 0 {
+		logutil.S().Infow("no provisioned volume attached to the local instance")
+		completeLifecycleAction()
+		return
+	}
+
+	for _, vol := range vols {
+		if vol.MountDirectory != "" {
+			ctx, cancel = context.WithTimeout(context.Background(), 2*time.Minute)
+			err = disk.Unmount(ctx, vol.MountDirectory, disk.WithRetries(5, 5*time.Second))
+			cancel()
+			if err != nil {
+				logutil.S().Warnw("failed to unmount", "mountDir", vol.MountDirectory, "error", err)
+				if !detachForce {
+					logutil.Exit(1)
+				}
+			}
+		}
+
+		// the snapshot is point-in-time as of the request, so the volume can be detached
+		// without waiting for the snapshot to complete
+		if detachSnapshot {
+			now := time.Now().UTC()
+			ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+			snapshotID, err := ec2.CreateSnapshot(
+				ctx,
+				cfg,
+				vol.VolumeID,
+				ec2.WithDescription(fmt.Sprintf("%s detach snapshot of %s from %s", appName, vol.VolumeID, localInstanceID)),
+				ec2.WithTags(map[string]string{
+					"Name":                       fmt.Sprintf("%s-%s", vol.VolumeID, now.Format("20060102-150405")),
+					idTagKey:                     idTagValue,
+					kindTagKey:                   kindTagValue,
+					asgNameTagKey:                vol.Tags[asgNameTagKey],
+					snapshotSourceInstanceTagKey: localInstanceID,
+					snapshotSourceVolumeTagKey:   vol.VolumeID,
+					snapshotDateTagKey:           now.Format("2006-01-02"),
+				}),
+			)
+			cancel()
+			if err != nil {
+				logutil.S().Warnw("failed to create snapshot", "volumeID", vol.VolumeID, "error", err)
+				logutil.Exit(1)
+			}
+			logutil.S().Infow("created snapshot", "volumeID", vol.VolumeID, "snapshotID", snapshotID)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+		err = ec2.DetachVolume(ctx, cfg, vol.VolumeID, localInstanceID,
+			ec2.WithForce(detachForce),
+			ec2.WithWait(true),
+			ec2.WithInterval(5*time.Second),
+		)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to detach volume", "volumeID", vol.VolumeID, "error", err)
+			logutil.Exit(1)
+		}
+
+		// release the lease, so that the next instance reuses the volume without waiting for the lease expiry
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		err = ec2.DeleteTags(ctx, cfg, []string{vol.VolumeID}, []string{volLeaseHoldKey})
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to delete the lease tag", "volumeID", vol.VolumeID, "error", err)
+			logutil.Exit(1)
+		}
+		logutil.S().Infow("successfully detached volume", "volumeID", vol.VolumeID)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	err = ec2.DeleteTags(ctx, cfg, []string{localInstanceID}, []string{localInstancePublishTagKey})
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to delete the local instance tag", "error", err)
+	}
+
+	completeLifecycleAction()
+	logutil.S().Infow("successfully detached the volumes!", "volumes", len(vols))
+}
+
+// Loads the provisioned volumes from the "--state-file" if any,
+// otherwise describes the tagged volumes attached to the local instance.
+func loadAttachedVolumes(cfg aws_v2.Config, localInstanceID string) (ec2.Volumes, error) {
+	if stateFile != "" {
+		exists, err := fileutil.FileExists(stateFile)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			logutil.S().Infow("loading volumes from state file", "stateFile", stateFile)
+			return ec2.LoadVolumes(stateFile)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	described, err := ec2.DescribeVolumes(ctx, cfg, map[string]string{
+		"attachment.instance-id": localInstanceID,
+		"tag:" + idTagKey:        idTagValue,
+		"tag:" + kindTagKey:      kindTagValue,
+	})
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	// the mount directories are not in the volume tags, so derive them from the flags by the EBS device
+	specs, err := volumeSpecs()
+	if err != nil {
+		return nil, err
+	}
+	vols := make(ec2.Volumes, 0, len(described))
+	for _, v := range described {
+		vol := ec2.ConvertVolume(v)
+		for _, spec := range specs {
+			if spec.ebsDevice == vol.EBSDevice {
+				vol.Index = spec.index
+				vol.MountDirectory = spec.mountDir
+			}
+		}
+		vols = append(vols, vol)
+	}
+	return vols, nil
+}
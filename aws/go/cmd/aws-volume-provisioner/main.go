@@ -4,22 +4,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/aws/go/cloudwatch"
 	"github.com/gyuho/infra/aws/go/cmd/version"
 	"github.com/gyuho/infra/aws/go/ec2"
 	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/aws/go/notify"
 	"github.com/gyuho/infra/go/logutil"
 	"github.com/gyuho/infra/linux/go/disk"
 
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
 	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/spf13/cobra"
 )
@@ -35,8 +38,18 @@ var cmd = &cobra.Command{
 }
 
 var (
-	region                   string
-	initialWaitRandomSeconds int
+	region                     string
+	caBundle                   string
+	httpsProxy                 string
+	useFIPSEndpoint            bool
+	useDualStackEndpoint       bool
+	cloudwatchLogGroup         string
+	cloudwatchLogRetentionDays int32
+	initialWaitRandomSeconds   int
+
+	assumeRoleARN         string
+	assumeRoleExternalID  string
+	assumeRoleSessionName string
 
 	idTagKey   string
 	idTagValue string
@@ -45,20 +58,37 @@ var (
 	kindTagValue string
 
 	volLeaseHoldKey string
+	volLeaseTTL     time.Duration
+
+	volCount       int
+	volIndexTagKey string
 
 	volType       string
 	volEncrypted  bool
+	volKMSKeyID   string
 	volSizeInGB   int32
 	volIOPS       int32
 	volThroughput int32
 
+	desiredSizeGB int32
+
 	ebsDevice   string
 	blockDevice string
 	fsName      string
 	mountDir    string
 
+	fsLabel          string
+	mkfsExtraArgs    []string
+	mountOptions     string
+	mountPersistence string
+
+	crossAZRestore bool
+
 	curEBSVolIDFile            string
+	stateFile                  string
 	localInstancePublishTagKey string
+
+	notifyTarget string
 )
 
 // Do not use "aws:" for custom tag creation, as it's not allowed.
@@ -66,11 +96,27 @@ var (
 // Only use "aws:autoscaling:groupName" for querying.
 const asgNameTagKey = "autoscaling:groupName"
 
+// Tags the volumes restored across AZs by "--cross-az-restore".
+const (
+	restoredFromTagKey = "RestoredFrom"
+	restoredToTagKey   = "RestoredTo"
+)
+
 func init() {
 	cobra.EnablePrefixMatching = true
-	cmd.AddCommand(version.NewCommand())
+	cmd.AddCommand(version.NewCommand(), newDetachCommand())
 
 	cmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "region to provision the volume in")
+	cmd.PersistentFlags().StringVar(&caBundle, "ca-bundle", "", "PEM file of the CA certificates to trust for the AWS API calls in addition to the system roots (e.g., the TLS-inspecting proxy CA)")
+	cmd.PersistentFlags().StringVar(&httpsProxy, "https-proxy", "", "proxy URL for the AWS API calls (leave empty to use HTTPS_PROXY and NO_PROXY)")
+	cmd.PersistentFlags().BoolVar(&useFIPSEndpoint, "use-fips-endpoint", false, "true to use the FIPS endpoints for the AWS API calls (e.g., GovCloud)")
+	cmd.PersistentFlags().BoolVar(&useDualStackEndpoint, "use-dual-stack-endpoint", false, "true to use the dual-stack (IPv4 and IPv6) endpoints for the AWS API calls")
+	cmd.PersistentFlags().StringVar(&cloudwatchLogGroup, "cloudwatch-log-group", "", "CloudWatch Logs group to ship the logs to, with the stream named after the local instance and the command (if empty, skip)")
+	cmd.PersistentFlags().Int32Var(&cloudwatchLogRetentionDays, "cloudwatch-log-retention-days", 30, "retention days of the CloudWatch Logs group (0 to keep the current)")
+	cmd.PersistentFlags().StringVar(&assumeRoleARN, "assume-role-arn", "", "IAM role ARN to assume with the instance credentials (e.g., to manage the resources in the shared network account, leave empty to use the instance credentials)")
+	cmd.PersistentFlags().StringVar(&assumeRoleExternalID, "assume-role-external-id", "", "external ID to assume the role with (only used with --assume-role-arn)")
+	cmd.PersistentFlags().StringVar(&assumeRoleSessionName, "assume-role-session-name", appName, "session name to assume the role with, recorded in CloudTrail (only used with --assume-role-arn)")
+
 	cmd.PersistentFlags().IntVar(&initialWaitRandomSeconds, "initial-wait-random-seconds", 60, "maximum number of seconds to wait (value chosen at random with the range, highly recommend setting value >=60 because EC2 tags take awhile to pupulate)")
 
 	cmd.PersistentFlags().StringVar(&idTagKey, "id-tag-key", "Id", "key for the EBS volume 'Id' tag")
@@ -80,31 +126,61 @@ func init() {
 	cmd.PersistentFlags().StringVar(&kindTagValue, "kind-tag-value", "aws-volume-provisioner", "value for the EBS volume 'Kind' tag key")
 
 	cmd.PersistentFlags().StringVar(&volLeaseHoldKey, "volume-lease-hold-key", "LeaseHold", "key for the EBS volume lease holder (e.g., i-12345678_1662596730 means i-12345678 acquired the lease for this volume at the unix timestamp 1662596730)")
+	cmd.PersistentFlags().DurationVar(&volLeaseTTL, "volume-lease-ttl", 10*time.Minute, "duration after which the volume lease by the other instance expires and can be taken over")
+
+	cmd.PersistentFlags().IntVar(&volCount, "volume-count", 1, "number of data volumes to provision to the instance (>1 to attach the volumes to /dev/xvdb, /dev/xvdc, ..., with the index tag)")
+	cmd.PersistentFlags().StringVar(&volIndexTagKey, "volume-index-tag-key", "VolumeIndex", "key for the EBS volume index tag, used only with --volume-count > 1")
 
 	cmd.PersistentFlags().StringVar(&volType, "volume-type", "gp3", "EBS volume type")
 	cmd.PersistentFlags().BoolVar(&volEncrypted, "volume-encrypted", true, "whether to encrypt volume or not")
+	cmd.PersistentFlags().StringVar(&volKMSKeyID, "volume-kms-key-id", "", "KMS key ID, ARN, or alias to encrypt the volume with (leave empty for the account default EBS key)")
 	cmd.PersistentFlags().Int32Var(&volSizeInGB, "volume-size-in-gb", 300, "EBS volume size in GB")
 	cmd.PersistentFlags().Int32Var(&volIOPS, "volume-iops", 3000, "EBS volume IOPS")
 	cmd.PersistentFlags().Int32Var(&volThroughput, "volume-throughput", 500, "EBS volume throughput")
+	cmd.PersistentFlags().Int32Var(&desiredSizeGB, "desired-size-gb", 0, "desired EBS volume size in GB, to grow the existing smaller volume and its filesystem (0 to skip)")
+
+	cmd.PersistentFlags().StringVar(&ebsDevice, "ebs-device", "", "EBS device name (e.g., /dev/xvdb, leave empty to use /dev/xvdb, /dev/xvdc, ... by the volume index)")
+	cmd.PersistentFlags().StringVar(&blockDevice, "block-device", "", "OS-level block device name (e.g., /dev/nvme1n1, leave empty to resolve by the volume ID via /dev/disk/by-id)")
+	cmd.PersistentFlags().StringVar(&fsName, "filesystem", "", "filesystem name to create (e.g., ext4, leave empty with --mount-directory to skip mkfs and mount)")
+	cmd.PersistentFlags().StringVar(&mountDir, "mount-directory", "", "directory path to mount onto the device (e.g., /data, leave empty to only attach the volume, use {index} with --volume-count > 1 such as /data{index})")
+	cmd.PersistentFlags().StringVar(&fsLabel, "filesystem-label", "", "label of the filesystem to create (leave empty for no label)")
+	cmd.PersistentFlags().StringSliceVar(&mkfsExtraArgs, "mkfs-extra-args", nil, "extra arguments to mkfs (e.g., -E,lazy_itable_init=1 for ext4)")
+	cmd.PersistentFlags().StringVar(&mountOptions, "mount-options", "defaults,nofail", "mount options for the mount command and the fstab entry")
+	cmd.PersistentFlags().StringVar(&mountPersistence, "mount-persistence", mountPersistenceFstab, "how to remount on reboot (fstab to manage the /etc/fstab entry, systemd to manage the mount unit, both by the filesystem UUID; none to skip)")
+
+	cmd.PersistentFlags().BoolVar(&crossAZRestore, "cross-az-restore", false, "true to restore the available tagged volume in the other AZ to the local AZ via a snapshot, when no reusable volume is found in the local AZ (the source volume is untagged from the 'Id' tag)")
 
-	cmd.PersistentFlags().StringVar(&ebsDevice, "ebs-device", "", "EBS device name (e.g., /dev/xvdb)")
-	cmd.PersistentFlags().StringVar(&blockDevice, "block-device", "", "OS-level block device name (e.g., /dev/nvme1n1)")
-	cmd.PersistentFlags().StringVar(&fsName, "filesystem", "", "filesystem name to create (e.g., ext4)")
-	cmd.PersistentFlags().StringVar(&mountDir, "mount-directory", "", "directory path to mount onto the device (e.g., /data)")
+	cmd.PersistentFlags().BoolVar(&skipInWarmPool, "skip-in-warm-pool", true, "true to skip provisioning while the instance is being warmed to be stopped (or hibernated) in the ASG warm pool, and to revalidate the volumes in --state-file when started from the warm pool")
 
-	cmd.PersistentFlags().StringVar(&curEBSVolIDFile, "current-ebs-volume-id-file", "/data/current-ebs-volume-id", "file path to write the current EBS volume ID (useful for paused instances)")
+	cmd.PersistentFlags().StringVar(&curEBSVolIDFile, "current-ebs-volume-id-file", "/data/current-ebs-volume-id", "file path to write the current EBS volume ID, one per line with --volume-count > 1 (useful for paused instances)")
+	cmd.PersistentFlags().StringVar(&stateFile, "state-file", "", "file path to write the provisioned volume state in JSON (e.g., /data/aws-volume-provisioner.json, leave empty to skip)")
 	cmd.PersistentFlags().StringVar(&localInstancePublishTagKey, "local-instance-publish-tag-key", "AWS_VOLUME_PROVISIONER_ATTACHED_VOLUME_ID", "tag key to create with the resource value to the local EC2 instance")
+
+	cmd.PersistentFlags().StringVar(&notifyTarget, "notify-target", "", "SNS topic ARN or SQS queue URL to publish the 'volume-attached' events to as JSON, for the downstream automation (leave empty to skip)")
 }
 
 func main() {
 	if err := cmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "%q failed %v\n", appName, err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
-	os.Exit(0)
+	logutil.Exit(0)
 }
 
 func cmdFunc(cmd *cobra.Command, args []string) {
+	switch mountPersistence {
+	case mountPersistenceFstab, mountPersistenceSystemd, mountPersistenceNone:
+	default:
+		logutil.S().Warnw("invalid --mount-persistence", "mountPersistence", mountPersistence)
+		logutil.Exit(1)
+	}
+	if notifyTarget != "" {
+		if err := notify.ValidateTarget(notifyTarget); err != nil {
+			logutil.S().Warnw("invalid --notify-target", "error", err)
+			logutil.Exit(1)
+		}
+	}
+
 	initialWait := time.Duration(rand.Intn(initialWaitRandomSeconds)) * time.Second
 	logutil.S().Infow("starting 'aws-volume-provisioner'", "initialWait", initialWait)
 	time.Sleep(initialWait)
@@ -114,7 +190,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to fetch availability zone", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 
 	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
@@ -122,15 +198,49 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to fetch EC2 instance ID", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
+	}
+	if warmingToIdle() {
+		logutil.S().Infow("instance is warming to be stopped in the warm pool -- skipping provisioning until it starts into service", "instanceID", localInstanceID)
+		return
 	}
 
 	cfg, err := aws.New(&aws.Config{
-		Region: region,
+		Region:               region,
+		RoleARN:              assumeRoleARN,
+		ExternalID:           assumeRoleExternalID,
+		SessionName:          assumeRoleSessionName,
+		CABundle:             caBundle,
+		HTTPSProxy:           httpsProxy,
+		UseFIPSEndpoint:      useFIPSEndpoint,
+		UseDualStackEndpoint: useDualStackEndpoint,
 	})
 	if err != nil {
 		logutil.S().Warnw("failed to create aws config", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	_, err = aws.ValidateCredentials(ctx, cfg)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to validate credentials", "error", err)
+		logutil.Exit(1)
+	}
+
+	if cloudwatchLogGroup != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sink, err := cloudwatch.EnableLogSink(ctx, cfg, cloudwatchLogGroup, appName, cloudwatch.WithRetentionDays(cloudwatchLogRetentionDays))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to enable cloudwatch log sink -- logging locally only", "error", err)
+		} else {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				_ = sink.Stop(ctx)
+				cancel()
+			}()
+		}
 	}
 
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
@@ -138,17 +248,92 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to get asg tag value in time", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	if asgNameTagValue == "" {
 		logutil.S().Warnw("failed to get asg tag value in time")
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	logutil.S().Infow("found asg tag", "key", asgNameTagKey, "value", asgNameTagValue)
 
+	specs, err := volumeSpecs()
+	if err != nil {
+		logutil.S().Warnw("invalid volume flags", "error", err)
+		logutil.Exit(1)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+
+	recorded := loadWarmPoolVolumes(cfg, asgNameTagValue, localInstanceID)
+	vols := make(ec2.Volumes, 0, len(specs))
+	for _, spec := range specs {
+		if v, ok := recorded.FindByIndex(spec.index); ok && revalidateVolume(cfg, localInstanceID, v, spec) {
+			logutil.S().Infow("reusing recorded volume from warm pool", "index", spec.index, "volumeID", v.VolumeID)
+			vols = append(vols, v)
+			continue
+		}
+		vols = append(vols, provisionVolume(cfg, sigs, az, localInstanceID, asgNameTagValue, spec))
+	}
+
+	volIDs := make([]string, 0, len(vols))
+	for _, v := range vols {
+		volIDs = append(volIDs, v.VolumeID)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	err = ec2.CreateTags(
+		ctx,
+		cfg,
+		[]string{localInstanceID},
+		map[string]string{
+			localInstancePublishTagKey: strings.Join(volIDs, ","),
+		})
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to create tags", "error", err)
+		logutil.Exit(1)
+	}
+
+	logutil.S().Infow("writing",
+		"volumeIDs", volIDs,
+		"currentEBSVolumeIDFile", curEBSVolIDFile,
+	)
+	if err := os.WriteFile(curEBSVolIDFile, []byte(strings.Join(volIDs, "\n")), 0644); err != nil {
+		logutil.S().Warnw("failed to write", "error", err)
+		logutil.Exit(1)
+	}
+	writeState(vols)
+
+	if notifyTarget != "" {
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		err = notify.Publish(ctx, cfg, notifyTarget, notify.Event{
+			Type:       notify.EventVolumeAttached,
+			Source:     appName,
+			InstanceID: localInstanceID,
+			ASGName:    asgNameTagValue,
+			Details: map[string]string{
+				"volume_ids":        strings.Join(volIDs, ","),
+				"availability_zone": az,
+			},
+		})
+		cancel()
+		if err != nil {
+			// the volumes are already mounted, so do not fail the provisioning
+			logutil.S().Warnw("failed to publish event -- ignoring", "error", err)
+		}
+	}
+	logutil.S().Infow("successfully  mounted and provisioned the volume!", "volumes", len(vols))
+}
+
+// Provisions the data volume for the spec: reuses the attached or available tagged volume,
+// or creates a new one, then attaches, formats, and mounts it.
+func provisionVolume(cfg aws_v2.Config, sigs chan os.Signal, az string, localInstanceID string, asgNameTagValue string, spec volumeSpec) ec2.Volume {
+	logutil.S().Infow("provisioning volume", "index", spec.index, "ebsDevice", spec.ebsDevice, "mountDir", spec.mountDir)
+
 	// ref. https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_DescribeVolumes.html
 	describeVolTags := map[string]string{
-		"attachment.device": ebsDevice,
+		"attachment.device": spec.ebsDevice,
 
 		// ensures the call only returns the volume that is attached to this local instance
 		"attachment.instance-id": localInstanceID,
@@ -167,18 +352,21 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 
 		"volume-type": volType,
 	}
+	for k, v := range spec.tags {
+		describeVolTags["tag:"+k] = v
+	}
 	logutil.S().Infow(
 		"checking if local instance already has an attached volume",
 		"region", region,
 		"describeVolumeTags", describeVolTags,
 	)
 
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	localAttachedVols, err := ec2.DescribeVolumes(ctx, cfg, describeVolTags)
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to describe volume", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	if len(localAttachedVols) > 0 {
 		logutil.S().Infow("found locally attached volumes to this instance", "volumes", len(localAttachedVols))
@@ -186,8 +374,6 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 		logutil.S().Infow("no locally attached volume found")
 	}
 
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
 	stopc := make(chan struct{})
 
 	// only make filesystem (format) for initial creation
@@ -214,6 +400,9 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 
 			"volume-type": volType,
 		}
+		for k, v := range spec.tags {
+			describeVolTags["tag:"+k] = v
+		}
 
 		logutil.S().Infow("local EC2 instance has no attached volume, querying available volume by AZ",
 			"instanceID", localInstanceID,
@@ -226,7 +415,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 			select {
 			case <-ctx.Done():
 				logutil.S().Warnw("failed to get reusable volumes in time", "error", ctx.Err())
-				os.Exit(1)
+				logutil.Exit(1)
 			case <-time.After(5 * time.Second):
 			}
 
@@ -234,7 +423,7 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 			cancel()
 			if err != nil {
 				logutil.S().Warnw("failed to describe volume", "error", err)
-				os.Exit(1)
+				logutil.Exit(1)
 			}
 
 			logutil.S().Infow("described volumes", "volumes", len(describedVols))
@@ -245,105 +434,63 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 			logutil.S().Infow("no volume found... retrying in case of inconsistent/stale EBS describe_volumes API response")
 		}
 
-		reusableVolFoundInAZ := len(describedVols) > 0
-
-		// if we don't check whether the other instance in the same AZ has "just" created
+		// if we don't check whether the other instance in the same AZ has "just" claimed
 		// this EBS volume or not, this can be racey -- two instances may be trying to attach
 		// the same EBS volume to two different instances at the same time
-		if reusableVolFoundInAZ {
-			logutil.S().Infow("checking volume lease holder", "key", volLeaseHoldKey)
-			for _, tag := range describedVols[0].Tags {
-				if *tag.Key != volLeaseHoldKey {
-					continue
-				}
-
-				ss := strings.Split(*tag.Value, "_")
-				if len(ss) != 2 {
-					logutil.S().Warnw("unexpected lease hold key value", "value", *tag.Value)
-					os.Exit(1)
-				}
+		reusedVolID := claimReusableVolume(cfg, describedVols, localInstanceID)
 
-				leaseHolder := ss[0]
-				lease := ss[1]
-				leasedAt, err := strconv.ParseInt(lease, 10, 64)
-				if err != nil {
-					logutil.S().Warnw("failed to parse lease key value", "error", err)
-					os.Exit(1)
-				}
-
-				// only reuse iff:
-				// (1) leased by the same local EC2 instance (restarted volume provisioner)
-				// (2) leased by the other EC2 instance but >10-minute ago
-
-				// (1) leased by the same local EC2 instance (restarted volume provisioner)
-				if leaseHolder == localInstanceID {
-					logutil.S().Infow("lease holder same as local instance ID", "leaseHolder", leaseHolder)
-					reusableVolFoundInAZ = true
-					break
-				}
-
-				logutil.S().Warnw("was leased by some other instance", "leaseHolder", leaseHolder)
-				leaseDelta := time.Now().UTC().Unix() - leasedAt
-				if leaseDelta > 600 {
-					logutil.S().Infow("lease expired >10 minutes ago, taking over")
-					reusableVolFoundInAZ = true
-				} else {
-					logutil.S().Infow("lease not expired yet, do not take over", "leaseDelta", leaseDelta)
-				}
+		volLeaseHoldValue := ec2.VolumeLease{Holder: localInstanceID, LeasedAt: time.Now().UTC()}.String()
 
-				break
-			}
-		}
-
-		unixTS := time.Now().UTC().Unix()
-		volLeaseHoldValue := localInstanceID + "_" + fmt.Sprintf("%d", unixTS)
-
-		if reusableVolFoundInAZ {
-			reusedVolID := *describedVols[0].VolumeId
-
-			logutil.S().Infow("found reusable volume -- renewing the lease", "volumeID", reusedVolID)
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			err = ec2.CreateTags(
-				ctx,
-				cfg,
-				[]string{reusedVolID},
-				map[string]string{
-					volLeaseHoldKey: volLeaseHoldValue,
-				})
-			cancel()
-			if err != nil {
-				logutil.S().Warnw("failed to create tags", "error", err)
-				os.Exit(1)
-			}
+		if reusedVolID != "" {
+			attachVolumeID = reusedVolID
 			needMkfs = false
 		} else {
-			logutil.S().Infow("no reusable volume found in AZ, creating a new one")
+			createdVolID := ""
+			if crossAZRestore {
+				createdVolID = restoreFromOtherAZ(cfg, az, localInstanceID, asgNameTagValue, volLeaseHoldValue, spec)
+			}
+			if createdVolID != "" {
+				needMkfs = false
+			} else {
+				logutil.S().Infow("no reusable volume found in AZ, creating a new one")
 
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			createdVolID, err := ec2.CreateVolume(
-				ctx,
-				cfg,
-				asgNameTagValue,
-				ec2.WithAvailabilityZone(az),
-				ec2.WithVolumeType(volType),
-				ec2.WithVolumeEncrypted(volEncrypted),
-				ec2.WithVolumeSizeInGB(volSizeInGB),
-				ec2.WithVolumeIOPS(volIOPS),
-				ec2.WithVolumeThroughput(volThroughput),
-				ec2.WithTags(map[string]string{
+				tags := map[string]string{
 					idTagKey:        idTagValue,
 					kindTagKey:      kindTagValue,
 					asgNameTagKey:   asgNameTagValue,
 					volLeaseHoldKey: volLeaseHoldValue,
-				}),
-			)
-			cancel()
-			if err != nil {
-				logutil.S().Warnw("failed to create a volume", "error", err)
-				os.Exit(1)
-			}
+				}
+				for k, v := range spec.tags {
+					tags[k] = v
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				createdVolID, err = ec2.CreateVolume(
+					ctx,
+					cfg,
+					asgNameTagValue,
+					ec2.WithAvailabilityZone(az),
+					ec2.WithVolumeType(volType),
+					ec2.WithVolumeEncrypted(volEncrypted),
+					ec2.WithVolumeKMSKeyID(volKMSKeyID),
+					ec2.WithVolumeSizeInGB(volSizeInGB),
+					ec2.WithVolumeIOPS(volIOPS),
+					ec2.WithVolumeThroughput(volThroughput),
+					ec2.WithTags(tags),
+				)
+				cancel()
+				if errors.Is(err, ec2.ErrVolumeEncryptionMismatch) {
+					// never leave the volume violating the encryption policy for the other instances to reuse
+					logutil.S().Warnw("created volume violates the encryption policy -- deleting", "volumeID", createdVolID, "error", err)
+					deleteVolume(cfg, createdVolID)
+					logutil.Exit(1)
+				}
+				if err != nil {
+					logutil.S().Warnw("failed to create a volume", "error", err)
+					logutil.Exit(1)
+				}
 
-			logutil.S().Infow("successfully created a volume", "volumeID", createdVolID)
+				logutil.S().Infow("successfully created a volume", "volumeID", createdVolID)
+			}
 
 			ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
 			ch := ec2.PollVolume(
@@ -360,11 +507,11 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 				case <-ctx.Done():
 					logutil.S().Warnw("failed to get volume in time", "error", ctx.Err())
 					close(stopc)
-					os.Exit(1)
+					logutil.Exit(1)
 				case sig := <-sigs:
 					logutil.S().Warnw("received signal", "signal", sig)
 					close(stopc)
-					os.Exit(1)
+					logutil.Exit(1)
 				default:
 				}
 				logutil.S().Infow("current volume status",
@@ -376,107 +523,128 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 			cancel()
 			if volStatus.Error != nil || volStatus.Volume.VolumeId == nil {
 				logutil.S().Warnw("failed to poll volume", "error", volStatus.Error)
-				os.Exit(1)
+				logutil.Exit(1)
 			}
 
-			describedVols = []aws_ec2_v2_types.Volume{volStatus.Volume}
+			attachVolumeID = *volStatus.Volume.VolumeId
 		}
 
-		attachVolumeID = *describedVols[0].VolumeId
 		logutil.S().Infow("attaching the volume", "volumeID", attachVolumeID)
 
 		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-		err = ec2.AttachVolume(ctx, cfg, attachVolumeID, localInstanceID, ebsDevice)
+		err = ec2.AttachVolume(ctx, cfg, attachVolumeID, localInstanceID, spec.ebsDevice)
 		cancel()
 		if err != nil {
 			logutil.S().Warnw("failed to attach volume", "error", err)
-			os.Exit(1)
+			logutil.Exit(1)
 		}
 	}
 
 	time.Sleep(2 * time.Second)
 
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
-	ch := ec2.PollVolume(
-		ctx,
-		stopc,
-		cfg,
-		attachVolumeID,
-		ec2.WithInterval(10*time.Second),
-		ec2.WithVolumeState(aws_ec2_v2_types.VolumeStateInUse),
-		ec2.WithVolumeAttachmentState(aws_ec2_v2_types.VolumeAttachmentStateAttached),
-	)
-	var volStatus ec2.VolumeStatus
-	for volStatus = range ch {
+	go func() {
 		select {
 		case <-ctx.Done():
-			logutil.S().Warnw("failed to get volume in time", "error", ctx.Err())
-			close(stopc)
-			os.Exit(1)
 		case sig := <-sigs:
 			logutil.S().Warnw("received signal", "signal", sig)
-			close(stopc)
-			os.Exit(1)
-		default:
+			cancel()
 		}
-		logutil.S().Infow("current volume status",
-			"volumeID", *volStatus.Volume.VolumeId,
-			"state", volStatus.Volume.State,
-			"error", volStatus.Error,
-		)
-	}
+	}()
+	vol, err := ec2.WaitForVolumeAttached(
+		ctx,
+		cfg,
+		attachVolumeID,
+		localInstanceID,
+		ec2.WithInterval(10*time.Second),
+		ec2.WithProgressFunc(func(p ec2.WaitProgress) {
+			logutil.S().Infow("current volume status",
+				"volumeID", attachVolumeID,
+				"attachmentState", p.Status,
+				"attempt", p.Attempt,
+				"error", p.Error,
+			)
+		}),
+	)
 	cancel()
-	if volStatus.Error != nil || volStatus.Volume.VolumeId == nil {
-		logutil.S().Warnw("failed to poll volume", "error", volStatus.Error)
-		os.Exit(1)
+	if err != nil {
+		logutil.S().Warnw("failed to poll volume", "error", err)
+		logutil.Exit(1)
 	}
 
-	attachedVolumeID := *volStatus.Volume.VolumeId
+	attachedVolumeID := *vol.VolumeId
 	logutil.S().Infow("successfully polled volume", "volumeID", attachedVolumeID)
 
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	err = ec2.CreateTags(
-		ctx,
-		cfg,
-		[]string{localInstanceID},
-		map[string]string{
-			localInstancePublishTagKey: attachedVolumeID,
-		})
-	cancel()
-	if err != nil {
-		logutil.S().Warnw("failed to create tags", "error", err)
-		os.Exit(1)
+	if desiredSizeGB > 0 && aws_v2.ToInt32(vol.Size) < desiredSizeGB {
+		logutil.S().Infow("volume smaller than the desired size -- modifying", "volumeID", attachedVolumeID, "sizeInGB", aws_v2.ToInt32(vol.Size), "desiredSizeGB", desiredSizeGB)
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		err = ec2.ModifyVolume(ctx, cfg, attachedVolumeID, ec2.WithVolumeSizeInGB(desiredSizeGB))
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to modify volume", "error", err)
+			logutil.Exit(1)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Minute)
+		_, err = ec2.WaitForVolumeModification(ctx, cfg, attachedVolumeID,
+			ec2.WithInterval(10*time.Second),
+			ec2.WithProgressFunc(func(p ec2.WaitProgress) {
+				logutil.S().Infow("current volume modification", "volumeID", attachedVolumeID, "status", p.Status, "attempt", p.Attempt)
+			}),
+		)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to wait for volume modification", "error", err)
+			logutil.Exit(1)
+		}
 	}
 
-	if needMkfs {
-		logutil.S().Infow("making filesystem", "filesystem", fsName, "blockDevice", blockDevice)
-		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
-		b, err := disk.Mkfs(ctx, fsName, blockDevice)
+	// the NVMe device names on the nitro instances do not follow the attachment order,
+	// so resolve the block device by the volume ID unless specified
+	if spec.blockDevice == "" {
+		ctx, cancel = context.WithTimeout(context.Background(), 2*time.Minute)
+		spec.blockDevice, err = disk.ResolveEBSDevice(ctx, attachedVolumeID, spec.ebsDevice, disk.WithRetries(20, 5*time.Second))
 		cancel()
 		if err != nil {
-			logutil.S().Warnw("failed to make filesystem", "error", err)
-			os.Exit(1)
+			logutil.S().Warnw("failed to resolve block device", "error", err)
+			logutil.Exit(1)
 		}
-		logutil.S().Infow("successfully made filesystem", "output", string(b))
-	} else {
-		logutil.S().Infow("no need to make filesystem")
 	}
 
-	logutil.S().Infow("mkdir", "mountDir", mountDir)
-	if err := os.MkdirAll(mountDir, 0755); err != nil {
-		logutil.S().Warnw("failed to mkdir", "error", err)
-		os.Exit(1)
+	provisionedAt := time.Now().UTC()
+	state := ec2.Volume{
+		Index:            spec.index,
+		VolumeID:         attachedVolumeID,
+		AvailabilityZone: az,
+		InstanceID:       localInstanceID,
+		EBSDevice:        spec.ebsDevice,
+		BlockDevice:      spec.blockDevice,
+		Tags:             ec2.ConvertVolume(vol).Tags,
+		ProvisionedAt:    &provisionedAt,
+	}
+	if spec.mountDir == "" {
+		logutil.S().Infow("no mount directory -- skipping mkfs and mount", "volumeID", attachedVolumeID)
+		return state
 	}
 
-	logutil.S().Infow("wait a bit before mounting the file system")
-	time.Sleep(5 * time.Second)
+	// the filesystem is probed before mkfs, so the reused volume is never reformatted,
+	// and the reused volume without the filesystem (e.g., crashed before mkfs) is formatted
+	logutil.S().Infow("ensuring filesystem", "filesystem", fsName, "blockDevice", spec.blockDevice, "newVolume", needMkfs)
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Minute)
+	formatted, err := disk.Format(ctx, fsName, spec.blockDevice, disk.WithLabel(fsLabel), disk.WithExtraArgs(mkfsExtraArgs...))
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to make filesystem", "error", err)
+		logutil.Exit(1)
+	}
+	logutil.S().Infow("ensured filesystem", "formatted", formatted)
 
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	blkLs, err := disk.Lsblk(ctx)
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to lsblk", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	fmt.Println("'lsblk' output:" + "\n\n" + string(blkLs))
 
@@ -485,43 +653,51 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to df", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	fmt.Println("'df' output:" + "\n\n" + string(dfOut))
 
-	ctx, cancel = context.WithTimeout(context.Background(), 15*time.Second)
-	b, err := disk.Mount(ctx, fsName, blockDevice, mountDir)
+	ctx, cancel = context.WithTimeout(context.Background(), 2*time.Minute)
+	err = disk.MountWithRetries(ctx, fsName, spec.blockDevice, spec.mountDir, disk.WithMountOptions(mountOptions), disk.WithRetries(5, 5*time.Second))
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to mount", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
-	logutil.S().Infow("successfully mounted a filesystem", "output", string(b))
+	logutil.S().Infow("successfully mounted a filesystem", "mountDir", spec.mountDir)
 
-	ctx, cancel = context.WithTimeout(context.Background(), 15*time.Second)
-	b, err = disk.UpdateFstab(ctx, fsName, blockDevice, mountDir)
-	cancel()
-	if err != nil {
-		logutil.S().Warnw("failed to update fstab", "error", err)
-		os.Exit(1)
+	// grow the filesystem if the volume was modified to a larger size (e.g., --desired-size-gb or ModifyVolume out of band)
+	if err := growIfNeeded(spec); err != nil {
+		logutil.S().Warnw("failed to grow filesystem", "error", err)
+		logutil.Exit(1)
 	}
-	logutil.S().Infow("successfully updated fstab", "output", string(b))
 
-	ctx, cancel = context.WithTimeout(context.Background(), 15*time.Second)
-	b, err = disk.MountAll(ctx)
+	// persist by the filesystem UUID, since the NVMe device names (e.g., /dev/nvme1n1)
+	// may be reordered across reboots, mounting the wrong volume on the directory
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	stableDevice, err := disk.FilesystemUUIDPath(ctx, spec.blockDevice)
 	cancel()
 	if err != nil {
-		logutil.S().Warnw("failed to mount all filesystems", "error", err)
-		os.Exit(1)
+		logutil.S().Warnw("failed to find filesystem UUID", "blockDevice", spec.blockDevice, "error", err)
+		logutil.Exit(1)
+	}
+	if err := persistMount(disk.FstabEntry{
+		Device:     stableDevice,
+		MountDir:   spec.mountDir,
+		FSName:     fsName,
+		Options:    mountOptions,
+		PassNumber: 2,
+	}); err != nil {
+		logutil.S().Warnw("failed to persist mount", "mountPersistence", mountPersistence, "error", err)
+		logutil.Exit(1)
 	}
-	logutil.S().Infow("successfully mounted all", "output", string(b))
 
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	blkLs, err = disk.Lsblk(ctx)
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to lsblk", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	fmt.Println("'lsblk' output:" + "\n\n" + string(blkLs))
 
@@ -530,18 +706,178 @@ func cmdFunc(cmd *cobra.Command, args []string) {
 	cancel()
 	if err != nil {
 		logutil.S().Warnw("failed to df", "error", err)
-		os.Exit(1)
+		logutil.Exit(1)
 	}
 	fmt.Println("'df' output:" + "\n\n" + string(dfOut))
 
-	logutil.S().Infow("writing",
-		"volumeID", attachVolumeID,
-		"currentEBSVolumeIDFile", curEBSVolIDFile,
-	)
-	if err := os.WriteFile(curEBSVolIDFile, []byte(attachVolumeID), 0644); err != nil {
-		logutil.S().Warnw("failed to write", "error", err)
-		os.Exit(1)
+	state.Filesystem = fsName
+	state.MountDirectory = spec.mountDir
+	state.Formatted = formatted
+	logutil.S().Infow("successfully mounted and provisioned the volume", "index", spec.index, "volumeID", attachedVolumeID)
+	return state
+}
+
+// Deletes the volume, waiting for the volume creation to complete.
+func deleteVolume(cfg aws_v2.Config, volumeID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	err := ec2.WaitUntil(ctx, fmt.Sprintf("volume %s deleted", volumeID), func(ctx context.Context) (bool, string, error) {
+		err := ec2.DeleteVolume(ctx, cfg, volumeID)
+		if err == nil {
+			return true, "deleted", nil
+		}
+		if ec2.ErrorCode(err) == "IncorrectState" {
+			// still creating
+			return false, "creating", nil
+		}
+		return false, "", fmt.Errorf("%v: %w", err, ec2.ErrStopWait)
+	}, ec2.WithInterval(5*time.Second))
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to delete volume", "volumeID", volumeID, "error", err)
+	}
+}
+
+// Persists the provisioned volumes to the "--state-file", so that the other services on the host
+// can find the provisioned volumes without calling the EC2 API.
+// Writes the single volume object for "--volume-count=1", for backward compatibility.
+func writeState(vols ec2.Volumes) {
+	if stateFile == "" {
+		return
+	}
+	var err error
+	if len(vols) == 1 {
+		err = vols[0].Sync(stateFile)
 	} else {
-		logutil.S().Infow("successfully  mounted and provisioned the volume!")
+		err = vols.Sync(stateFile)
+	}
+	if err != nil {
+		logutil.S().Warnw("failed to write state file", "stateFile", stateFile, "error", err)
+		logutil.Exit(1)
+	}
+	logutil.S().Infow("wrote state file", "stateFile", stateFile, "volumes", vols.String())
+}
+
+// Claims one of the reusable volumes by the lease, in a random order to reduce the contention
+// among the instances booting at the same time. Returns the claimed volume ID, or empty if none claimed.
+func claimReusableVolume(cfg aws_v2.Config, vols []aws_ec2_v2_types.Volume, localInstanceID string) string {
+	candidates := make([]aws_ec2_v2_types.Volume, len(vols))
+	copy(candidates, vols)
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+	for _, vol := range candidates {
+		volID := *vol.VolumeId
+		ok, err := ec2.VolumeLeaseTakeable(vol, volLeaseHoldKey, localInstanceID, time.Now(), volLeaseTTL)
+		if err != nil {
+			logutil.S().Warnw("failed to check the volume lease", "volumeID", volID, "error", err)
+			continue
+		}
+		if !ok {
+			logutil.S().Infow("volume leased by the other instance, skipping", "volumeID", volID)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		ok, err = ec2.ClaimVolume(ctx, cfg, volID, volLeaseHoldKey, localInstanceID, volLeaseTTL)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to claim the volume", "volumeID", volID, "error", err)
+			continue
+		}
+		if ok {
+			logutil.S().Infow("found reusable volume -- claimed the lease", "volumeID", volID)
+			return volID
+		}
+	}
+	return ""
+}
+
+// Finds the available tagged volume in the other AZ, and restores it to the local AZ
+// via a snapshot with the same tags. Returns the new volume ID, or empty if none found.
+// The source volume is untagged from the "Id" tag and tagged with the new volume ID,
+// so that it is not matched again.
+func restoreFromOtherAZ(cfg aws_v2.Config, az string, localInstanceID string, asgNameTagValue string, volLeaseHoldValue string, spec volumeSpec) string {
+	describeVolTags := map[string]string{
+		"status": "available",
+
+		"tag:" + idTagKey:      idTagValue,
+		"tag:" + kindTagKey:    kindTagValue,
+		"tag:" + asgNameTagKey: asgNameTagValue,
+
+		"volume-type": volType,
+	}
+	for k, v := range spec.tags {
+		describeVolTags["tag:"+k] = v
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	vols, err := ec2.DescribeVolumes(ctx, cfg, describeVolTags)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to describe volume", "error", err)
+		logutil.Exit(1)
+	}
+
+	// claim the source volume first, so that the other instances do not restore the same volume
+	var src *aws_ec2_v2_types.Volume
+	for i := range vols {
+		if *vols[i].AvailabilityZone == az {
+			continue
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+		ok, err := ec2.ClaimVolume(ctx, cfg, *vols[i].VolumeId, volLeaseHoldKey, localInstanceID, volLeaseTTL)
+		cancel()
+		if err != nil {
+			logutil.S().Warnw("failed to claim the volume", "volumeID", *vols[i].VolumeId, "error", err)
+			continue
+		}
+		if ok {
+			src = &vols[i]
+			break
+		}
+	}
+	if src == nil {
+		logutil.S().Infow("no reusable volume found in the other AZs")
+		return ""
+	}
+	srcVolID := *src.VolumeId
+	logutil.S().Infow("claimed reusable volume in the other AZ -- restoring to the local AZ", "volumeID", srcVolID, "sourceAZ", *src.AvailabilityZone, "targetAZ", az)
+
+	tags := map[string]string{
+		idTagKey:           idTagValue,
+		kindTagKey:         kindTagValue,
+		asgNameTagKey:      asgNameTagValue,
+		volLeaseHoldKey:    volLeaseHoldValue,
+		restoredFromTagKey: srcVolID,
+	}
+	for k, v := range spec.tags {
+		tags[k] = v
 	}
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Minute)
+	newVolID, snapshotID, err := ec2.RestoreVolumeToAZ(
+		ctx,
+		cfg,
+		srcVolID,
+		az,
+		asgNameTagValue,
+		ec2.WithInterval(15*time.Second),
+		ec2.WithTags(tags),
+	)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to restore volume", "volumeID", srcVolID, "snapshotID", snapshotID, "error", err)
+		logutil.Exit(1)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	err = ec2.DeleteTags(ctx, cfg, []string{srcVolID}, []string{idTagKey})
+	if err == nil {
+		err = ec2.CreateTags(ctx, cfg, []string{srcVolID}, map[string]string{restoredToTagKey: newVolID})
+	}
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to re-tag the source volume", "volumeID", srcVolID, "error", err)
+		logutil.Exit(1)
+	}
+
+	logutil.S().Infow("successfully restored volume", "sourceVolumeID", srcVolID, "snapshotID", snapshotID, "volumeID", newVolID)
+	return newVolID
 }
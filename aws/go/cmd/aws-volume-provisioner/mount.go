@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+	"github.com/gyuho/infra/linux/go/disk"
+)
+
+const (
+	mountPersistenceFstab   = "fstab"
+	mountPersistenceSystemd = "systemd"
+	mountPersistenceNone    = "none"
+
+	systemdUnitDir = "/etc/systemd/system"
+)
+
+// Persists the mount so that the filesystem is remounted on reboot.
+// Idempotent, so re-running the provisioner does not duplicate the entries.
+func persistMount(entry disk.FstabEntry) error {
+	switch mountPersistence {
+	case mountPersistenceFstab:
+		_, err := disk.EnsureFstabEntry(disk.FSTAB_PATH, entry)
+		return err
+
+	case mountPersistenceSystemd:
+		p, changed, err := disk.EnsureSystemdMountUnit(systemdUnitDir, entry)
+		if err != nil {
+			return err
+		}
+		unit := filepath.Base(p)
+		cmds := [][]string{{"systemctl", "enable", unit}}
+		if changed {
+			cmds = append([][]string{{"systemctl", "daemon-reload"}}, cmds...)
+		}
+		for _, args := range cmds {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+			cancel()
+			if err != nil {
+				return fmt.Errorf("%q failed %q (%w)", strings.Join(args, " "), string(out), err)
+			}
+		}
+		logutil.S().Infow("enabled systemd mount unit", "unit", unit)
+		return nil
+
+	case mountPersistenceNone:
+		logutil.S().Infow("skipping mount persistence")
+		return nil
+
+	default:
+		return fmt.Errorf("unknown mount persistence %q", mountPersistence)
+	}
+}
+
+// Grows the mounted filesystem online if the block device is larger than the filesystem.
+func growIfNeeded(spec volumeSpec) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	deviceSize, err := disk.BlockDeviceSize(ctx, spec.blockDevice)
+	cancel()
+	if err != nil {
+		return err
+	}
+	fsSize, err := disk.FilesystemSize(spec.mountDir)
+	if err != nil {
+		return err
+	}
+	if !disk.NeedsGrow(deviceSize, fsSize) {
+		logutil.S().Infow("filesystem fills the block device", "deviceSize", deviceSize, "filesystemSize", fsSize)
+		return nil
+	}
+
+	logutil.S().Infow("block device larger than the filesystem -- growing", "deviceSize", deviceSize, "filesystemSize", fsSize)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
+	out, err := disk.GrowFilesystem(ctx, fsName, spec.blockDevice, spec.mountDir)
+	cancel()
+	if err != nil {
+		return err
+	}
+	logutil.S().Infow("successfully grew filesystem", "output", string(out))
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+)
+
+const mountDirIndexPlaceholder = "{index}"
+
+// Defines the data volume to provision, by the index among the volumes of the instance.
+type volumeSpec struct {
+	index       int
+	ebsDevice   string
+	blockDevice string
+	mountDir    string
+	// extra tags to find and create the volume (e.g., the volume index tag)
+	tags map[string]string
+}
+
+// Returns the volume specs from the flags. The single volume keeps the "--ebs-device"
+// and "--block-device" flags as is, while the multiple volumes are assigned the deterministic
+// EBS device names by the index, and are tagged with the index to be reused by the same index.
+func volumeSpecs() ([]volumeSpec, error) {
+	if volCount < 1 {
+		return nil, fmt.Errorf("invalid --volume-count %d", volCount)
+	}
+	if volCount == 1 {
+		dev := ebsDevice
+		if dev == "" {
+			dev, _ = ec2.EBSDeviceName(0)
+		}
+		return []volumeSpec{{
+			index:       0,
+			ebsDevice:   dev,
+			blockDevice: blockDevice,
+			mountDir:    strings.ReplaceAll(mountDir, mountDirIndexPlaceholder, "0"),
+		}}, nil
+	}
+
+	if ebsDevice != "" || blockDevice != "" {
+		return nil, errors.New("--ebs-device and --block-device are not supported with --volume-count > 1")
+	}
+	if mountDir != "" && !strings.Contains(mountDir, mountDirIndexPlaceholder) {
+		return nil, fmt.Errorf("--mount-directory %q must contain %q with --volume-count > 1", mountDir, mountDirIndexPlaceholder)
+	}
+	if volIndexTagKey == "" {
+		return nil, errors.New("empty --volume-index-tag-key with --volume-count > 1")
+	}
+
+	specs := make([]volumeSpec, 0, volCount)
+	for i := 0; i < volCount; i++ {
+		dev, err := ec2.EBSDeviceName(i)
+		if err != nil {
+			return nil, err
+		}
+		idx := strconv.Itoa(i)
+		specs = append(specs, volumeSpec{
+			index:     i,
+			ebsDevice: dev,
+			mountDir:  strings.ReplaceAll(mountDir, mountDirIndexPlaceholder, idx),
+			tags:      map[string]string{volIndexTagKey: idx},
+		})
+	}
+	return specs, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/asg"
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/aws/go/ec2/metadata"
+	"github.com/gyuho/infra/go/fileutil"
+	"github.com/gyuho/infra/go/logutil"
+	"github.com/gyuho/infra/linux/go/disk"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+var skipInWarmPool bool
+
+// Returns true if the local instance is being warmed to be stopped (or hibernated)
+// in the ASG warm pool, so the volumes are not created for the idle instance.
+// The provisioner runs again when the instance starts from the warm pool into service.
+// ref. https://docs.aws.amazon.com/autoscaling/ec2/userguide/warm-pool-instance-lifecycle.html
+func warmingToIdle() bool {
+	if !skipInWarmPool {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	state, err := metadata.FetchTargetLifecycleState(ctx)
+	cancel()
+	if err != nil {
+		if !errors.Is(err, metadata.ErrNotFound) {
+			logutil.S().Warnw("failed to fetch target lifecycle state -- assuming not in warm pool", "error", err)
+		}
+		return false
+	}
+	logutil.S().Infow("fetched target lifecycle state", "state", state)
+	return asg.IsWarmedIdleState(state)
+}
+
+// Loads the volumes recorded in the state file before the instance was stopped in the warm pool,
+// if the instance was started from the warm pool. Returns nil for the regular launch,
+// or when the state cannot be used (errors are logged and fall back to full discovery).
+func loadWarmPoolVolumes(cfg aws_v2.Config, asgName string, instanceID string) ec2.Volumes {
+	if !skipInWarmPool || stateFile == "" {
+		return nil
+	}
+	exists, err := fileutil.FileExists(stateFile)
+	if err != nil || !exists {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	fromWarmPool, err := asg.LaunchedFromWarmPool(ctx, cfg, asgName, instanceID)
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to check warm pool launch -- falling back to full discovery", "error", err)
+		return nil
+	}
+	if !fromWarmPool {
+		return nil
+	}
+
+	vols, err := ec2.LoadVolumes(stateFile)
+	if err != nil {
+		logutil.S().Warnw("failed to load state file -- falling back to full discovery", "stateFile", stateFile, "error", err)
+		return nil
+	}
+	logutil.S().Infow("started from warm pool -- revalidating recorded volumes", "stateFile", stateFile, "volumes", len(vols))
+	return vols
+}
+
+// Returns true if the recorded volume is still attached to the local instance at the device,
+// and mounted on the directory (if any), so it can be reused without the full discovery.
+func revalidateVolume(cfg aws_v2.Config, instanceID string, recorded ec2.Volume, spec volumeSpec) bool {
+	if recorded.VolumeID == "" || recorded.EBSDevice != spec.ebsDevice || recorded.MountDirectory != spec.mountDir {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	vs, err := ec2.DescribeVolumes(ctx, cfg, map[string]string{
+		"volume-id":              recorded.VolumeID,
+		"attachment.device":      spec.ebsDevice,
+		"attachment.instance-id": instanceID,
+		"attachment.status":      "attached",
+	})
+	cancel()
+	if err != nil {
+		logutil.S().Warnw("failed to describe recorded volume", "volumeID", recorded.VolumeID, "error", err)
+		return false
+	}
+	if len(vs) != 1 {
+		logutil.S().Warnw("recorded volume no longer attached", "volumeID", recorded.VolumeID, "ebsDevice", spec.ebsDevice)
+		return false
+	}
+
+	if spec.mountDir == "" {
+		return true
+	}
+	mounted, err := disk.IsMounted(recorded.BlockDevice, spec.mountDir)
+	if err != nil {
+		logutil.S().Warnw("failed to check mount", "mountDir", spec.mountDir, "error", err)
+		return false
+	}
+	if !mounted {
+		logutil.S().Warnw("recorded volume not mounted", "blockDevice", recorded.BlockDevice, "mountDir", spec.mountDir)
+	}
+	return mounted
+}
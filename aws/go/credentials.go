@@ -0,0 +1,113 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_sts_v2 "github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+)
+
+// Represents the identity of the credentials, from STS GetCallerIdentity.
+type CallerIdentity struct {
+	Account string `json:"account"`
+	ARN     string `json:"arn"`
+	UserID  string `json:"user_id"`
+}
+
+// Returns the partition of the identity ARN (e.g., "aws", "aws-cn").
+func (id CallerIdentity) Partition() string {
+	ss := strings.SplitN(id.ARN, ":", 3)
+	if len(ss) < 3 {
+		return ""
+	}
+	return ss[1]
+}
+
+var (
+	// Returned when no credentials are found in the chain (e.g., no instance profile).
+	ErrNoCredentials = errors.New("no credentials found")
+	// Returned when the credentials (or the session token) are expired.
+	ErrExpiredCredentials = errors.New("credentials expired")
+	// Returned when the credentials are not recognized (e.g., deleted access key).
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// Returned when the credentials belong to another partition than the region
+	// (e.g., the commercial credentials in the China or GovCloud region).
+	ErrWrongPartition = errors.New("credentials for another partition")
+)
+
+// Validates the credentials of the config with STS GetCallerIdentity, and returns the identity.
+// The failures are classified as "ErrNoCredentials", "ErrExpiredCredentials",
+// "ErrInvalidCredentials", or "ErrWrongPartition", with the original error wrapped.
+// Commands call it as the preflight step, so the credential issues are reported clearly
+// before the first mutating call.
+func ValidateCredentials(ctx context.Context, cfg aws_v2.Config) (CallerIdentity, error) {
+	if cfg.Credentials == nil {
+		return CallerIdentity{}, ErrNoCredentials
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return CallerIdentity{}, classifyCredentialsError(err, cfg.Region, true)
+	}
+
+	out, err := aws_sts_v2.NewFromConfig(cfg).GetCallerIdentity(ctx, &aws_sts_v2.GetCallerIdentityInput{})
+	if err != nil {
+		return CallerIdentity{}, classifyCredentialsError(err, cfg.Region, false)
+	}
+	id := CallerIdentity{
+		Account: aws_v2.ToString(out.Account),
+		ARN:     aws_v2.ToString(out.Arn),
+		UserID:  aws_v2.ToString(out.UserId),
+	}
+	if p, expected := id.Partition(), PartitionForRegion(cfg.Region); p != "" && p != expected {
+		return id, fmt.Errorf("%w (identity %q in partition %q, region %q in partition %q)", ErrWrongPartition, id.ARN, p, cfg.Region, expected)
+	}
+
+	logutil.S().Infow("validated credentials", "account", id.Account, "arn", id.ARN, "region", cfg.Region)
+	return id, nil
+}
+
+// Returns the partition of the region (e.g., "aws-cn" for "cn-north-1").
+func PartitionForRegion(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "us-isob-"):
+		return "aws-iso-b"
+	case strings.HasPrefix(region, "us-iso-"):
+		return "aws-iso"
+	default:
+		return "aws"
+	}
+}
+
+// Classifies the credentials error, with the retrieval error (before any API call)
+// treated as no credentials unless expired.
+func classifyCredentialsError(err error, region string, retrieval bool) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ExpiredToken", "ExpiredTokenException", "RequestExpired":
+			return fmt.Errorf("%w (%w)", ErrExpiredCredentials, err)
+		case "InvalidClientTokenId", "UnrecognizedClientException", "SignatureDoesNotMatch", "InvalidAccessKeyId":
+			// the commercial credentials are not recognized by the other partitions
+			if PartitionForRegion(region) != "aws" {
+				return fmt.Errorf("%w (region %q in partition %q) (%w)", ErrWrongPartition, region, PartitionForRegion(region), err)
+			}
+			return fmt.Errorf("%w (%w)", ErrInvalidCredentials, err)
+		}
+	}
+	if retrieval {
+		if strings.Contains(strings.ToLower(err.Error()), "expired") {
+			return fmt.Errorf("%w (%w)", ErrExpiredCredentials, err)
+		}
+		return fmt.Errorf("%w (%w)", ErrNoCredentials, err)
+	}
+	return err
+}
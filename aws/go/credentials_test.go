@@ -0,0 +1,46 @@
+package aws
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestClassifyCredentialsError(t *testing.T) {
+	tt := []struct {
+		err       error
+		region    string
+		retrieval bool
+		expected  error
+	}{
+		{err: errors.New("no EC2 IMDS role found"), region: "us-east-1", retrieval: true, expected: ErrNoCredentials},
+		{err: errors.New("the SSO session has expired"), region: "us-east-1", retrieval: true, expected: ErrExpiredCredentials},
+		{err: &smithy.GenericAPIError{Code: "ExpiredToken"}, region: "us-east-1", expected: ErrExpiredCredentials},
+		{err: &smithy.GenericAPIError{Code: "InvalidClientTokenId"}, region: "us-east-1", expected: ErrInvalidCredentials},
+		{err: &smithy.GenericAPIError{Code: "InvalidClientTokenId"}, region: "cn-north-1", expected: ErrWrongPartition},
+	}
+	for i, tv := range tt {
+		err := classifyCredentialsError(tv.err, tv.region, tv.retrieval)
+		if !errors.Is(err, tv.expected) {
+			t.Fatalf("#%d: expected %v, got %v", i, tv.expected, err)
+		}
+		if !errors.Is(err, tv.err) {
+			t.Fatalf("#%d: expected the original error wrapped, got %v", i, err)
+		}
+	}
+
+	other := &smithy.GenericAPIError{Code: "AccessDenied"}
+	if err := classifyCredentialsError(other, "us-east-1", false); err != other {
+		t.Fatalf("expected the unclassified error as is, got %v", err)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	if p := PartitionForRegion("us-gov-west-1"); p != "aws-us-gov" {
+		t.Fatalf("unexpected partition %q", p)
+	}
+	if p := (CallerIdentity{ARN: "arn:aws-cn:iam::123456789012:role/my-role"}).Partition(); p != "aws-cn" {
+		t.Fatalf("unexpected partition %q", p)
+	}
+}
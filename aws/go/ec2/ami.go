@@ -19,7 +19,7 @@ func CreateImage(ctx context.Context, cfg aws.Config, instanceID string, name st
 	logutil.S().Infow("creating an AMI", "instanceID", instanceID, "name", name)
 
 	ts := ConvertTags(name, tags)
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	out, err := cli.CreateImage(
 		ctx,
 		&aws_ec2_v2.CreateImageInput{
@@ -47,7 +47,7 @@ func CreateImage(ctx context.Context, cfg aws.Config, instanceID string, name st
 
 func PollImageUntilAvailable(ctx context.Context, cfg aws.Config, imageID string, interval time.Duration) (aws_ec2_v2_types.Image, error) {
 	logutil.S().Infow("polling an AMI", "imageID", imageID)
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 
 	start := time.Now()
 	cnt := 0
@@ -118,7 +118,7 @@ func ShareImage(ctx context.Context, cfg aws.Config, imageID string, targets ...
 		"imageID", imageID,
 	)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	imgOut, err := cli.DescribeImages(ctx, &aws_ec2_v2.DescribeImagesInput{
 		ImageIds: []string{imageID},
 	})
@@ -283,3 +283,103 @@ func ShareImage(ctx context.Context, cfg aws.Config, imageID string, targets ...
 
 	return imgs, nil
 }
+
+// Finds the latest available AMI by the owner (e.g., "amazon", "self", or the account ID),
+// the name filter with wildcards (e.g., "al2023-ami-2023.*-x86_64"), and the architecture
+// (e.g., "x86_64", "arm64", leave empty for any).
+func FindLatestAMI(ctx context.Context, cfg aws.Config, ownerAlias string, nameFilter string, architecture string) (aws_ec2_v2_types.Image, error) {
+	logutil.S().Infow("finding the latest AMI", "owner", ownerAlias, "nameFilter", nameFilter, "architecture", architecture)
+
+	filters := map[string][]string{
+		"name":  {nameFilter},
+		"state": {string(aws_ec2_v2_types.ImageStateAvailable)},
+	}
+	if architecture != "" {
+		filters["architecture"] = []string{architecture}
+	}
+
+	cli := newClient(cfg)
+	pg := aws_ec2_v2.NewDescribeImagesPaginator(cli, &aws_ec2_v2.DescribeImagesInput{
+		Owners:  []string{ownerAlias},
+		Filters: convertFilters(filters),
+	})
+
+	var latest aws_ec2_v2_types.Image
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return aws_ec2_v2_types.Image{}, err
+		}
+		for _, img := range out.Images {
+			// creation date is in ISO 8601, so the string comparison works
+			if latest.ImageId == nil || aws.ToString(img.CreationDate) > aws.ToString(latest.CreationDate) {
+				latest = img
+			}
+		}
+	}
+	if latest.ImageId == nil {
+		return aws_ec2_v2_types.Image{}, fmt.Errorf("no AMI found for owner %q, name %q, architecture %q", ownerAlias, nameFilter, architecture)
+	}
+
+	logutil.S().Infow("found the latest AMI", "imageID", *latest.ImageId, "name", aws.ToString(latest.Name), "creationDate", aws.ToString(latest.CreationDate))
+	return latest, nil
+}
+
+// Deregisters the AMI, without deleting its backing snapshots.
+// Use "DeleteSnapshotsForAMI" to delete the snapshots as well.
+func DeregisterAMI(ctx context.Context, cfg aws.Config, imageID string) error {
+	logutil.S().Infow("deregistering an AMI", "imageID", imageID)
+
+	cli := newClient(cfg)
+	_, err := cli.DeregisterImage(ctx, &aws_ec2_v2.DeregisterImageInput{
+		ImageId: &imageID,
+	})
+	if err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully deregistered an AMI", "imageID", imageID)
+	return nil
+}
+
+// Deregisters the AMI and deletes its backing EBS snapshots,
+// since the snapshots cannot be deleted while the AMI is registered.
+// Returns the deleted snapshot IDs.
+func DeleteSnapshotsForAMI(ctx context.Context, cfg aws.Config, imageID string) ([]string, error) {
+	cli := newClient(cfg)
+	out, err := cli.DescribeImages(ctx, &aws_ec2_v2.DescribeImagesInput{
+		ImageIds: []string{imageID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Images) != 1 {
+		return nil, fmt.Errorf("expected 1 image, got %d", len(out.Images))
+	}
+
+	snapshotIDs := make([]string, 0)
+	for _, bdm := range out.Images[0].BlockDeviceMappings {
+		if bdm.Ebs != nil && bdm.Ebs.SnapshotId != nil {
+			snapshotIDs = append(snapshotIDs, *bdm.Ebs.SnapshotId)
+		}
+	}
+	logutil.S().Infow("deleting snapshots for an AMI", "imageID", imageID, "snapshotIDs", snapshotIDs)
+
+	if err := DeregisterAMI(ctx, cfg, imageID); err != nil {
+		return nil, err
+	}
+
+	deleted := make([]string, 0, len(snapshotIDs))
+	for _, id := range snapshotIDs {
+		_, err := cli.DeleteSnapshot(ctx, &aws_ec2_v2.DeleteSnapshotInput{
+			SnapshotId: aws.String(id),
+		})
+		if err != nil && !IsNotFound(err) {
+			return deleted, err
+		}
+		deleted = append(deleted, id)
+	}
+
+	logutil.S().Infow("successfully deleted snapshots for an AMI", "imageID", imageID, "snapshotIDs", deleted)
+	return deleted, nil
+}
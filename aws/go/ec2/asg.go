@@ -3,12 +3,10 @@ package ec2
 import (
 	"context"
 	"sort"
-	"time"
 
 	"github.com/gyuho/infra/go/logutil"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
 	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
@@ -21,53 +19,18 @@ func ListInstancesByASG(ctx context.Context, cfg aws.Config, asg string, opts ..
 
 	logutil.S().Infow("listing instances", "asg", asg)
 
-	filters := []aws_ec2_v2_types.Filter{
-		{
-			Name:   &asgGroupNameTagKey,
-			Values: []string{asg},
-		},
+	filters := make(map[string][]string, len(ret.filters)+1)
+	for k, vs := range ret.filters {
+		filters[k] = vs
 	}
+	filters[asgGroupNameTagKey] = []string{asg}
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
-	instances := make([]aws_ec2_v2_types.Instance, 0)
-	token := ""
-	for {
-		input := &aws_ec2_v2.DescribeInstancesInput{
-			Filters: filters,
-		}
-		if token != "" {
-			input.NextToken = &token
-		}
-		out, err := cli.DescribeInstances(ctx, input)
-		if err != nil {
-			return nil, err
-		}
-		if len(out.Reservations) == 0 {
-			logutil.S().Warnw("no instance found", "asg", asg)
-			break
-		}
-		for _, r := range out.Reservations {
-			for _, inst := range r.Instances {
-				if ret.instanceStates == nil {
-					instances = append(instances, inst)
-					continue
-				}
-				if _, ok := ret.instanceStates[inst.State.Name]; ok {
-					instances = append(instances, inst)
-				}
-			}
-		}
-
-		if out.NextToken == nil {
-			break
-		}
-		token = *out.NextToken
-
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-time.After(time.Second):
-		}
+	instances, err := ListInstances(ctx, cfg, append(opts, WithFilters(filters))...)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		logutil.S().Warnw("no instance found", "asg", asg)
 	}
 
 	sort.SliceStable(instances, func(i, j int) bool {
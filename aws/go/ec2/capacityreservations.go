@@ -0,0 +1,203 @@
+package ec2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Represents the on-demand capacity reservation.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/ec2-capacity-reservations.html
+type CapacityReservation struct {
+	ID                 string            `json:"id"`
+	InstanceType       string            `json:"instance_type"`
+	InstancePlatform   string            `json:"instance_platform"`
+	AvailabilityZone   string            `json:"availability_zone"`
+	Tenancy            string            `json:"tenancy"`
+	MatchCriteria      string            `json:"match_criteria"`
+	State              string            `json:"state"`
+	TotalInstances     int32             `json:"total_instances"`
+	AvailableInstances int32             `json:"available_instances"`
+	EndDate            *time.Time        `json:"end_date,omitempty"`
+	Tags               map[string]string `json:"tags,omitempty"`
+}
+
+// Returns the ratio of the used instances to the total instances (0 to 1).
+func (cr CapacityReservation) Utilization() float64 {
+	if cr.TotalInstances == 0 {
+		return 0
+	}
+	return float64(cr.TotalInstances-cr.AvailableInstances) / float64(cr.TotalInstances)
+}
+
+type CapacityReservations []CapacityReservation
+
+// Renders the utilization report.
+func (crs CapacityReservations) String() string {
+	sort.SliceStable(crs, func(i, j int) bool {
+		if crs[i].InstanceType == crs[j].InstanceType {
+			return crs[i].ID < crs[j].ID
+		}
+		return crs[i].InstanceType < crs[j].InstanceType
+	})
+
+	rows := make([][]string, 0, len(crs))
+	for _, cr := range crs {
+		rows = append(rows, []string{
+			cr.ID,
+			cr.InstanceType,
+			cr.AvailabilityZone,
+			cr.State,
+			cr.MatchCriteria,
+			fmt.Sprintf("%d", cr.TotalInstances-cr.AvailableInstances),
+			fmt.Sprintf("%d", cr.TotalInstances),
+			fmt.Sprintf("%.1f%%", cr.Utilization()*100),
+		})
+	}
+
+	buf := bytes.NewBuffer(nil)
+	tb := tablewriter.NewWriter(buf)
+	tb.SetAutoWrapText(false)
+	tb.SetAlignment(tablewriter.ALIGN_LEFT)
+	tb.SetCenterSeparator("*")
+	tb.SetHeader([]string{"reservation id", "instance type", "az", "state", "match criteria", "used", "total", "utilization"})
+	tb.AppendBulk(rows)
+	tb.Render()
+
+	return buf.String()
+}
+
+func convertCapacityReservation(raw aws_ec2_v2_types.CapacityReservation) CapacityReservation {
+	return CapacityReservation{
+		ID:                 aws.ToString(raw.CapacityReservationId),
+		InstanceType:       aws.ToString(raw.InstanceType),
+		InstancePlatform:   string(raw.InstancePlatform),
+		AvailabilityZone:   aws.ToString(raw.AvailabilityZone),
+		Tenancy:            string(raw.Tenancy),
+		MatchCriteria:      string(raw.InstanceMatchCriteria),
+		State:              string(raw.State),
+		TotalInstances:     aws.ToInt32(raw.TotalInstanceCount),
+		AvailableInstances: aws.ToInt32(raw.AvailableInstanceCount),
+		EndDate:            raw.EndDate,
+		Tags:               convertTagsToMap(raw.Tags),
+	}
+}
+
+// Lists the capacity reservations by filter (e.g., "instance-type", "availability-zone", "state").
+func ListCapacityReservations(ctx context.Context, cfg aws.Config, opts ...OpOption) (CapacityReservations, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cli := newClient(cfg)
+	pg := aws_ec2_v2.NewDescribeCapacityReservationsPaginator(cli, &aws_ec2_v2.DescribeCapacityReservationsInput{
+		Filters: convertFilters(ret.filters),
+	})
+	crs := make(CapacityReservations, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range out.CapacityReservations {
+			crs = append(crs, convertCapacityReservation(raw))
+		}
+	}
+	logutil.S().Infow("listed capacity reservations", "filters", ret.filters, "capacityReservations", len(crs))
+	return crs, nil
+}
+
+// Finds the active "open" capacity reservation with the available instances
+// for the instance type in the availability zone, and returns false if not found.
+// Returns the one with the most available instances if multiple.
+// Use "WithFilters" for the additional filters (e.g., "instance-platform", "tag:Kind").
+func FindOpenCapacityReservation(ctx context.Context, cfg aws.Config, instanceType string, az string, opts ...OpOption) (CapacityReservation, bool, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	filters := map[string][]string{
+		"instance-type":     {instanceType},
+		"availability-zone": {az},
+		"state":             {string(aws_ec2_v2_types.CapacityReservationStateActive)},
+	}
+	for k, v := range ret.filters {
+		filters[k] = v
+	}
+	crs, err := ListCapacityReservations(ctx, cfg, WithFilters(filters))
+	if err != nil {
+		return CapacityReservation{}, false, err
+	}
+
+	cr, found := pickOpenCapacityReservation(crs)
+	if !found {
+		logutil.S().Warnw("no open capacity reservation found", "instanceType", instanceType, "availabilityZone", az)
+		return CapacityReservation{}, false, nil
+	}
+	logutil.S().Infow("found open capacity reservation", "capacityReservationID", cr.ID, "available", cr.AvailableInstances, "total", cr.TotalInstances)
+	return cr, true, nil
+}
+
+func pickOpenCapacityReservation(crs CapacityReservations) (CapacityReservation, bool) {
+	var picked CapacityReservation
+	found := false
+	for _, cr := range crs {
+		if cr.State != string(aws_ec2_v2_types.CapacityReservationStateActive) {
+			continue
+		}
+		if cr.MatchCriteria != string(aws_ec2_v2_types.InstanceMatchCriteriaOpen) {
+			continue
+		}
+		if cr.AvailableInstances <= 0 {
+			continue
+		}
+		if !found || cr.AvailableInstances > picked.AvailableInstances {
+			picked = cr
+			found = true
+		}
+	}
+	return picked, found
+}
+
+// Returned when the instance is not running in the expected capacity reservation.
+var ErrNotInCapacityReservation = errors.New("instance not running in the capacity reservation")
+
+// Returns the capacity reservation ID that the instance is running in,
+// and returns false if the instance is not running in any capacity reservation.
+func GetInstanceCapacityReservation(ctx context.Context, cfg aws.Config, instanceID string) (string, bool, error) {
+	inst, err := GetInstance(ctx, cfg, instanceID)
+	if err != nil {
+		return "", false, err
+	}
+	crID := aws.ToString(inst.CapacityReservationId)
+	return crID, crID != "", nil
+}
+
+// Verifies that the instance is running in a capacity reservation,
+// or the one set by "WithCapacityReservationID".
+// Returns "ErrNotInCapacityReservation" otherwise (e.g., to fail the bootstrap of the reserved-capacity fleets).
+func VerifyInstanceCapacityReservation(ctx context.Context, cfg aws.Config, instanceID string, opts ...OpOption) (string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	crID, found, err := GetInstanceCapacityReservation(ctx, cfg, instanceID)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("%w (instance %s)", ErrNotInCapacityReservation, instanceID)
+	}
+	if ret.capacityReservationID != "" && crID != ret.capacityReservationID {
+		return crID, fmt.Errorf("%w (instance %s in %s, expected %s)", ErrNotInCapacityReservation, instanceID, crID, ret.capacityReservationID)
+	}
+	logutil.S().Infow("verified instance capacity reservation", "instanceID", instanceID, "capacityReservationID", crID)
+	return crID, nil
+}
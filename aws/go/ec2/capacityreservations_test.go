@@ -0,0 +1,26 @@
+package ec2
+
+import (
+	"testing"
+)
+
+func TestPickOpenCapacityReservation(t *testing.T) {
+	crs := CapacityReservations{
+		{ID: "cr-1", State: "active", MatchCriteria: "open", TotalInstances: 10, AvailableInstances: 2},
+		{ID: "cr-2", State: "active", MatchCriteria: "targeted", TotalInstances: 10, AvailableInstances: 9},
+		{ID: "cr-3", State: "expired", MatchCriteria: "open", TotalInstances: 10, AvailableInstances: 10},
+		{ID: "cr-4", State: "active", MatchCriteria: "open", TotalInstances: 10, AvailableInstances: 5},
+		{ID: "cr-5", State: "active", MatchCriteria: "open", TotalInstances: 10, AvailableInstances: 0},
+	}
+	cr, found := pickOpenCapacityReservation(crs)
+	if !found || cr.ID != "cr-4" {
+		t.Fatalf("expected cr-4, got %+v (found %v)", cr, found)
+	}
+	if u := cr.Utilization(); u != 0.5 {
+		t.Fatalf("expected utilization 0.5, got %v", u)
+	}
+
+	if _, found = pickOpenCapacityReservation(crs[4:]); found {
+		t.Fatal("expected no open capacity reservation")
+	}
+}
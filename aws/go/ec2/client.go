@@ -0,0 +1,108 @@
+package ec2
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// Subset of the EC2 API used by the EIP, ENI, instance and tag functions,
+// so that the callers can unit-test without AWS (see "ec2mock" and "SetClientFactory").
+type API interface {
+	AllocateAddress(ctx context.Context, params *aws_ec2_v2.AllocateAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AllocateAddressOutput, error)
+	AssociateAddress(ctx context.Context, params *aws_ec2_v2.AssociateAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AssociateAddressOutput, error)
+	DescribeAddresses(ctx context.Context, params *aws_ec2_v2.DescribeAddressesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeAddressesOutput, error)
+	DescribeAddressesAttribute(ctx context.Context, params *aws_ec2_v2.DescribeAddressesAttributeInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeAddressesAttributeOutput, error)
+	DisassociateAddress(ctx context.Context, params *aws_ec2_v2.DisassociateAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DisassociateAddressOutput, error)
+	ModifyAddressAttribute(ctx context.Context, params *aws_ec2_v2.ModifyAddressAttributeInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.ModifyAddressAttributeOutput, error)
+	ReleaseAddress(ctx context.Context, params *aws_ec2_v2.ReleaseAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.ReleaseAddressOutput, error)
+	ResetAddressAttribute(ctx context.Context, params *aws_ec2_v2.ResetAddressAttributeInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.ResetAddressAttributeOutput, error)
+
+	CreateTags(ctx context.Context, params *aws_ec2_v2.CreateTagsInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.CreateTagsOutput, error)
+	DeleteTags(ctx context.Context, params *aws_ec2_v2.DeleteTagsInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DeleteTagsOutput, error)
+	DescribeTags(ctx context.Context, params *aws_ec2_v2.DescribeTagsInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeTagsOutput, error)
+
+	DescribeInstances(ctx context.Context, params *aws_ec2_v2.DescribeInstancesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeInstancesOutput, error)
+
+	AssignIpv6Addresses(ctx context.Context, params *aws_ec2_v2.AssignIpv6AddressesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AssignIpv6AddressesOutput, error)
+	AttachNetworkInterface(ctx context.Context, params *aws_ec2_v2.AttachNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AttachNetworkInterfaceOutput, error)
+	CreateNetworkInterface(ctx context.Context, params *aws_ec2_v2.CreateNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.CreateNetworkInterfaceOutput, error)
+	DeleteNetworkInterface(ctx context.Context, params *aws_ec2_v2.DeleteNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DeleteNetworkInterfaceOutput, error)
+	DescribeNetworkInterfaces(ctx context.Context, params *aws_ec2_v2.DescribeNetworkInterfacesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeNetworkInterfacesOutput, error)
+	DetachNetworkInterface(ctx context.Context, params *aws_ec2_v2.DetachNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DetachNetworkInterfaceOutput, error)
+}
+
+var _ API = (*aws_ec2_v2.Client)(nil)
+
+// Configures the EC2 clients created by this package.
+type ClientOption func(*aws_ec2_v2.Options)
+
+var (
+	clientOptsMu sync.RWMutex
+	clientOpts   []func(*aws_ec2_v2.Options)
+)
+
+// Sets the options for all EC2 clients created by this package afterwards
+// (e.g., the interface VPC endpoint URL for the instances in the subnets without internet access).
+// Replaces the previously set options, and resets to the defaults if empty.
+func SetClientOptions(opts ...ClientOption) {
+	fns := make([]func(*aws_ec2_v2.Options), 0, len(opts))
+	for _, opt := range opts {
+		fns = append(fns, opt)
+	}
+
+	clientOptsMu.Lock()
+	clientOpts = fns
+	clientOptsMu.Unlock()
+}
+
+// Sets the base endpoint URL of the EC2 API
+// (e.g., "https://vpce-0123-abcd.ec2.us-west-2.vpce.amazonaws.com" or "http://localhost:4566" for LocalStack).
+// Empty to use the default endpoint.
+func WithBaseEndpoint(url string) ClientOption {
+	return func(o *aws_ec2_v2.Options) {
+		if url != "" {
+			o.BaseEndpoint = aws.String(url)
+		}
+	}
+}
+
+// Sets the endpoint resolver of the EC2 API.
+func WithEndpointResolver(r aws_ec2_v2.EndpointResolverV2) ClientOption {
+	return func(o *aws_ec2_v2.Options) {
+		o.EndpointResolverV2 = r
+	}
+}
+
+var (
+	clientFactoryMu sync.RWMutex
+	clientFactory   func(aws.Config) API
+)
+
+// Sets the function to create the API client for the EIP, ENI, instance and tag functions
+// (e.g., to return the "ec2mock" client in tests).
+// Resets to the SDK client if nil.
+func SetClientFactory(f func(aws.Config) API) {
+	clientFactoryMu.Lock()
+	clientFactory = f
+	clientFactoryMu.Unlock()
+}
+
+func newAPI(cfg aws.Config) API {
+	clientFactoryMu.RLock()
+	f := clientFactory
+	clientFactoryMu.RUnlock()
+	if f != nil {
+		return f(cfg)
+	}
+	return newClient(cfg)
+}
+
+func newClient(cfg aws.Config) *aws_ec2_v2.Client {
+	clientOptsMu.RLock()
+	fns := clientOpts
+	clientOptsMu.RUnlock()
+	return aws_ec2_v2.NewFromConfig(cfg, fns...)
+}
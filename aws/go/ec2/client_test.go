@@ -0,0 +1,77 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gyuho/infra/aws/go/ec2/ec2mock"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestSetClientOptions(t *testing.T) {
+	defer SetClientOptions()
+
+	cfg := aws.Config{Region: "us-west-2"}
+	if ep := newClient(cfg).Options().BaseEndpoint; ep != nil {
+		t.Fatalf("expected no base endpoint, got %q", *ep)
+	}
+
+	SetClientOptions(WithBaseEndpoint("http://localhost:4566"))
+	if ep := newClient(cfg).Options().BaseEndpoint; ep == nil || *ep != "http://localhost:4566" {
+		t.Fatalf("unexpected base endpoint %v", ep)
+	}
+
+	SetClientOptions()
+	if ep := newClient(cfg).Options().BaseEndpoint; ep != nil {
+		t.Fatalf("expected no base endpoint after reset, got %q", *ep)
+	}
+}
+
+var _ API = (*ec2mock.Client)(nil)
+
+func TestReleaseEIPWithMock(t *testing.T) {
+	cli := &ec2mock.Client{
+		DescribeAddressesFunc: func(ctx context.Context, in *aws_ec2_v2.DescribeAddressesInput, _ ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeAddressesOutput, error) {
+			return &aws_ec2_v2.DescribeAddressesOutput{
+				Addresses: []aws_ec2_v2_types.Address{
+					{
+						AllocationId:  aws.String("eipalloc-1"),
+						AssociationId: aws.String("eipassoc-1"),
+						InstanceId:    aws.String("i-1"),
+					},
+				},
+			}, nil
+		},
+		DisassociateAddressFunc: func(ctx context.Context, in *aws_ec2_v2.DisassociateAddressInput, _ ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DisassociateAddressOutput, error) {
+			return &aws_ec2_v2.DisassociateAddressOutput{}, nil
+		},
+		ReleaseAddressFunc: func(ctx context.Context, in *aws_ec2_v2.ReleaseAddressInput, _ ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.ReleaseAddressOutput, error) {
+			return &aws_ec2_v2.ReleaseAddressOutput{}, nil
+		},
+	}
+	SetClientFactory(func(aws.Config) API { return cli })
+	defer SetClientFactory(nil)
+
+	err := ReleaseEIP(context.Background(), aws.Config{}, "eipalloc-1")
+	if !errors.Is(err, ErrEIPAssociated) {
+		t.Fatalf("expected ErrEIPAssociated, got %v", err)
+	}
+	if n := len(cli.CallsOf("ReleaseAddress")); n != 0 {
+		t.Fatalf("expected no release, got %d", n)
+	}
+
+	if err := ReleaseEIP(context.Background(), aws.Config{}, "eipalloc-1", WithForce(true)); err != nil {
+		t.Fatal(err)
+	}
+	calls := cli.CallsOf("DisassociateAddress")
+	if len(calls) != 1 || aws.ToString(calls[0].Input.(*aws_ec2_v2.DisassociateAddressInput).AssociationId) != "eipassoc-1" {
+		t.Fatalf("unexpected disassociate calls %+v", calls)
+	}
+	if n := len(cli.CallsOf("ReleaseAddress")); n != 1 {
+		t.Fatalf("expected 1 release, got %d", n)
+	}
+}
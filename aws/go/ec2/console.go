@@ -0,0 +1,54 @@
+package ec2
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// Fetches the decoded console output of the instance, useful for debugging boot failures.
+// If latest is true, fetches the most recent output (only supported on the Nitro instances),
+// otherwise the last 64 KB buffered output.
+// Returns empty if no output is available yet.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_GetConsoleOutput.html
+func GetConsoleOutput(ctx context.Context, cfg aws.Config, instanceID string, latest bool) ([]byte, error) {
+	logutil.S().Infow("getting console output", "instanceID", instanceID, "latest", latest)
+
+	cli := newClient(cfg)
+	out, err := cli.GetConsoleOutput(ctx, &aws_ec2_v2.GetConsoleOutputInput{
+		InstanceId: aws.String(instanceID),
+		Latest:     aws.Bool(latest),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.Output == nil {
+		logutil.S().Warnw("no console output available", "instanceID", instanceID)
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(*out.Output)
+}
+
+// Fetches the decoded JPG screenshot of the instance console.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_GetConsoleScreenshot.html
+func GetConsoleScreenshot(ctx context.Context, cfg aws.Config, instanceID string) ([]byte, error) {
+	logutil.S().Infow("getting console screenshot", "instanceID", instanceID)
+
+	cli := newClient(cfg)
+	out, err := cli.GetConsoleScreenshot(ctx, &aws_ec2_v2.GetConsoleScreenshotInput{
+		InstanceId: aws.String(instanceID),
+		WakeUp:     aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.ImageData == nil {
+		return nil, errors.New("empty console screenshot")
+	}
+	return base64.StdEncoding.DecodeString(*out.ImageData)
+}
@@ -1,9 +1,14 @@
 package ec2
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
@@ -31,7 +36,7 @@ func DescribeVolumes(ctx context.Context, cfg aws.Config, filters map[string]str
 		})
 	}
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	out, err := cli.DescribeVolumes(ctx, &aws_ec2_v2.DescribeVolumesInput{
 		Filters: fts,
 	})
@@ -81,14 +86,19 @@ func CreateVolume(ctx context.Context, cfg aws.Config, name string, opts ...OpOp
 	if ret.volumeThroughput == 0 {
 		return "", errors.New("volumeThroughput must be set")
 	}
+	if ret.volumeKMSKeyID != "" && !ret.volumeEncrypted {
+		return "", errors.New("volumeKMSKeyID requires the encrypted volume")
+	}
 
 	logutil.S().Infow("creating a volume",
 		"name", name,
 		"type", ret.volumeType,
 		"encrypted", ret.volumeEncrypted,
+		"kmsKeyID", ret.volumeKMSKeyID,
 		"sizeInGB", ret.volumeSizeInGB,
 		"iops", ret.volumeIOPS,
 		"throughput", ret.volumeThroughput,
+		"snapshotID", ret.snapshotID,
 	)
 
 	input := aws_ec2_v2.CreateVolumeInput{
@@ -99,6 +109,12 @@ func CreateVolume(ctx context.Context, cfg aws.Config, name string, opts ...OpOp
 		Iops:             &ret.volumeIOPS,
 		Throughput:       &ret.volumeThroughput,
 	}
+	if ret.snapshotID != "" {
+		input.SnapshotId = &ret.snapshotID
+	}
+	if ret.volumeKMSKeyID != "" {
+		input.KmsKeyId = &ret.volumeKMSKeyID
+	}
 
 	tags := make(map[string]string, len(ret.tags))
 	tags["Name"] = name
@@ -123,7 +139,7 @@ func CreateVolume(ctx context.Context, cfg aws.Config, name string, opts ...OpOp
 		},
 	}
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	out, err := cli.CreateVolume(ctx, &input)
 	if err != nil {
 		return "", err
@@ -133,15 +149,204 @@ func CreateVolume(ctx context.Context, cfg aws.Config, name string, opts ...OpOp
 	}
 	volID := *out.VolumeId
 
-	logutil.S().Infow("successfully created a volume", "volumeID", volID)
+	// the account or snapshot defaults may silently override the requested encryption
+	if err := verifyVolumeEncryption(aws.ToBool(out.Encrypted), aws.ToString(out.KmsKeyId), ret.volumeEncrypted, ret.volumeKMSKeyID); err != nil {
+		logutil.S().Warnw("created volume does not match the encryption policy", "volumeID", volID, "error", err)
+		return volID, fmt.Errorf("volume %s: %w", volID, err)
+	}
+
+	logutil.S().Infow("successfully created a volume", "volumeID", volID, "encrypted", aws.ToBool(out.Encrypted), "kmsKeyID", aws.ToString(out.KmsKeyId))
 	return volID, nil
 }
 
+// Returned when the created volume does not match the requested encryption.
+// The volume is created regardless, so the caller should delete the volume.
+var ErrVolumeEncryptionMismatch = errors.New("volume encryption mismatch")
+
+// Verifies the created volume encryption against the requested one.
+// The KMS key in the response is the key ARN, so the key ID or ARN is compared,
+// while the alias cannot be resolved without the KMS API and is not compared.
+func verifyVolumeEncryption(encrypted bool, kmsKeyARN string, wantEncrypted bool, wantKMSKeyID string) error {
+	if wantEncrypted && !encrypted {
+		return fmt.Errorf("%w: expected encrypted, got unencrypted", ErrVolumeEncryptionMismatch)
+	}
+	if wantKMSKeyID == "" || strings.HasPrefix(wantKMSKeyID, "alias/") || strings.Contains(wantKMSKeyID, ":alias/") {
+		return nil
+	}
+	if kmsKeyARN != wantKMSKeyID && !strings.HasSuffix(kmsKeyARN, "key/"+wantKMSKeyID) {
+		return fmt.Errorf("%w: expected KMS key %q, got %q", ErrVolumeEncryptionMismatch, wantKMSKeyID, kmsKeyARN)
+	}
+	return nil
+}
+
+// Restores the volume in the other availability zone, by creating a snapshot of the volume
+// and a new volume from the snapshot in the target availability zone with the same type, size, IOPS, and throughput.
+// Returns the new volume ID and the snapshot ID.
+// Use "WithTags" for the new volume and snapshot tags, and "WithInterval" to poll the snapshot.
+func RestoreVolumeToAZ(ctx context.Context, cfg aws.Config, volumeID string, targetAZ string, name string, opts ...OpOption) (string, string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	vols, err := DescribeVolumes(ctx, cfg, map[string]string{"volume-id": volumeID})
+	if err != nil {
+		return "", "", err
+	}
+	if len(vols) != 1 {
+		return "", "", fmt.Errorf("expected 1 volume, got %d", len(vols))
+	}
+	src := vols[0]
+	if aws.ToString(src.AvailabilityZone) == targetAZ {
+		return "", "", fmt.Errorf("volume %s already in %s", volumeID, targetAZ)
+	}
+	logutil.S().Infow("restoring volume to the other AZ", "volumeID", volumeID, "sourceAZ", aws.ToString(src.AvailabilityZone), "targetAZ", targetAZ)
+
+	snapshotID, err := CreateSnapshot(ctx, cfg, volumeID,
+		WithDescription(fmt.Sprintf("restoring %s to %s", volumeID, targetAZ)),
+		WithTags(ret.tags),
+		WithWait(true),
+		WithInterval(ret.interval),
+	)
+	if err != nil {
+		return "", snapshotID, err
+	}
+
+	createOpts := []OpOption{
+		WithAvailabilityZone(targetAZ),
+		WithVolumeType(string(src.VolumeType)),
+		WithVolumeEncrypted(aws.ToBool(src.Encrypted)),
+		WithVolumeSizeInGB(aws.ToInt32(src.Size)),
+		WithVolumeIOPS(aws.ToInt32(src.Iops)),
+		WithVolumeThroughput(aws.ToInt32(src.Throughput)),
+		WithSnapshotID(snapshotID),
+		WithTags(ret.tags),
+	}
+	newVolumeID, err := CreateVolume(ctx, cfg, name, createOpts...)
+	if err != nil {
+		return "", snapshotID, err
+	}
+
+	logutil.S().Infow("successfully restored volume to the other AZ", "volumeID", volumeID, "snapshotID", snapshotID, "newVolumeID", newVolumeID, "targetAZ", targetAZ)
+	return newVolumeID, snapshotID, nil
+}
+
+// Modifies the volume size, type, IOPS, and throughput
+// (see "WithVolumeSizeInGB", "WithVolumeType", "WithVolumeIOPS", and "WithVolumeThroughput"),
+// where only the set options are modified and the size can only grow.
+// A volume can only be modified once every 6 hours.
+// Use "WaitForVolumeModification" to wait until the modification is usable,
+// and grow the filesystem afterwards if the size was modified.
+// ref. https://docs.aws.amazon.com/ebs/latest/userguide/requesting-ebs-volume-modifications.html
+func ModifyVolume(ctx context.Context, cfg aws.Config, volumeID string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	input := &aws_ec2_v2.ModifyVolumeInput{
+		VolumeId: aws.String(volumeID),
+	}
+	if ret.volumeSizeInGB > 0 {
+		input.Size = aws.Int32(ret.volumeSizeInGB)
+	}
+	if ret.volumeType != "" {
+		input.VolumeType = aws_ec2_v2_types.VolumeType(ret.volumeType)
+	}
+	if ret.volumeIOPS > 0 {
+		input.Iops = aws.Int32(ret.volumeIOPS)
+	}
+	if ret.volumeThroughput > 0 {
+		input.Throughput = aws.Int32(ret.volumeThroughput)
+	}
+	if input.Size == nil && input.VolumeType == "" && input.Iops == nil && input.Throughput == nil {
+		return errors.New("no volume modification set")
+	}
+
+	logutil.S().Infow("modifying volume",
+		"volumeID", volumeID,
+		"sizeInGB", ret.volumeSizeInGB,
+		"type", ret.volumeType,
+		"iops", ret.volumeIOPS,
+		"throughput", ret.volumeThroughput,
+	)
+	cli := newClient(cfg)
+	_, err := cli.ModifyVolume(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully requested to modify volume", "volumeID", volumeID)
+	return nil
+}
+
+// gp3 baseline performance included in the price.
+// ref. https://docs.aws.amazon.com/ebs/latest/userguide/general-purpose.html
+const (
+	gp3BaselineIOPS       = 3000
+	gp3BaselineThroughput = 125
+)
+
+// Returns the gp3 IOPS and throughput (MiB/s) matching the gp2 baseline performance of the size,
+// so that the migration does not degrade the volume performance.
+// gp2 provides 3 IOPS per GiB (100 to 16,000), and up to 250 MiB/s for the volumes larger than 170 GiB.
+func gp3PerformanceForGP2(sizeInGB int32) (int32, int32) {
+	iops := 3 * sizeInGB
+	if iops < gp3BaselineIOPS {
+		iops = gp3BaselineIOPS
+	}
+	if iops > 16000 {
+		iops = 16000
+	}
+	throughput := int32(gp3BaselineThroughput)
+	if sizeInGB > 170 {
+		throughput = 250
+	}
+	return iops, throughput
+}
+
+// Migrates the gp2 volume to gp3 with the matching IOPS and throughput, and returns true if modified.
+// No-op if the volume is already gp3.
+// Use "WithWait" to wait until the modification is usable.
+func MigrateVolumeToGP3(ctx context.Context, cfg aws.Config, volumeID string, opts ...OpOption) (bool, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	vols, err := DescribeVolumes(ctx, cfg, map[string]string{"volume-id": volumeID})
+	if err != nil {
+		return false, err
+	}
+	if len(vols) != 1 {
+		return false, fmt.Errorf("expected 1 volume, got %d", len(vols))
+	}
+	vol := vols[0]
+	switch vol.VolumeType {
+	case aws_ec2_v2_types.VolumeTypeGp3:
+		logutil.S().Infow("volume already gp3", "volumeID", volumeID)
+		return false, nil
+	case aws_ec2_v2_types.VolumeTypeGp2:
+	default:
+		return false, fmt.Errorf("volume %s is %q, only gp2 can be migrated to gp3", volumeID, vol.VolumeType)
+	}
+
+	iops, throughput := gp3PerformanceForGP2(aws.ToInt32(vol.Size))
+	err = ModifyVolume(ctx, cfg, volumeID,
+		WithVolumeType(string(aws_ec2_v2_types.VolumeTypeGp3)),
+		WithVolumeIOPS(iops),
+		WithVolumeThroughput(throughput),
+	)
+	if err != nil {
+		return false, err
+	}
+	if ret.wait {
+		if _, err = WaitForVolumeModification(ctx, cfg, volumeID, opts...); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
 // Deletes the volume.
 func DeleteVolume(ctx context.Context, cfg aws.Config, volumeID string) error {
 	logutil.S().Infow("deleting volume", "volumeID", volumeID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	_, err := cli.DeleteVolume(ctx, &aws_ec2_v2.DeleteVolumeInput{
 		VolumeId: &volumeID,
 	})
@@ -176,7 +381,7 @@ func AttachVolume(ctx context.Context, cfg aws.Config, volumeID string, instance
 		InstanceId: &instanceID,
 		VolumeId:   &volumeID,
 	}
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	out, err := cli.AttachVolume(ctx, &input)
 	if err != nil {
 		return err
@@ -189,6 +394,43 @@ func AttachVolume(ctx context.Context, cfg aws.Config, volumeID string, instance
 	return nil
 }
 
+// Detaches the volume from the instance.
+// Use "WithForce" to force the detachment (e.g., the instance is unresponsive),
+// and "WithWait" to wait until the volume is available.
+func DetachVolume(ctx context.Context, cfg aws.Config, volumeID string, instanceID string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("detaching a volume",
+		"volumeID", volumeID,
+		"instanceID", instanceID,
+		"force", ret.force,
+	)
+
+	cli := newClient(cfg)
+	_, err := cli.DetachVolume(ctx, &aws_ec2_v2.DetachVolumeInput{
+		VolumeId:   aws.String(volumeID),
+		InstanceId: aws.String(instanceID),
+		Force:      aws.Bool(ret.force),
+	})
+	if err != nil {
+		if ErrorCode(err) == "IncorrectState" {
+			// e.g., already detached or detaching
+			logutil.S().Warnw("volume not attached", "volumeID", volumeID, "error", err)
+		} else {
+			return err
+		}
+	}
+
+	if ret.wait {
+		if _, err = WaitForVolumeDetached(ctx, cfg, volumeID, opts...); err != nil {
+			return err
+		}
+	}
+	logutil.S().Infow("successfully detached volume", "volumeID", volumeID)
+	return nil
+}
+
 type VolumeStatus struct {
 	Volume aws_ec2_v2_types.Volume
 	Error  error
@@ -327,3 +569,144 @@ func PollVolume(
 	}()
 	return ch
 }
+
+// Represents the provisioned EBS volume on the local instance,
+// persisted with "Sync" and "LoadVolume" like "EIP".
+type Volume struct {
+	// Index of the volume among the volumes provisioned to the same instance.
+	Index int `json:"index"`
+
+	VolumeID         string `json:"volume_id"`
+	AvailabilityZone string `json:"availability_zone"`
+	InstanceID       string `json:"instance_id,omitempty"`
+
+	// EBS device name (e.g., /dev/xvdb).
+	EBSDevice string `json:"ebs_device"`
+	// OS-level block device name (e.g., /dev/nvme1n1).
+	BlockDevice string `json:"block_device,omitempty"`
+
+	Filesystem     string `json:"filesystem,omitempty"`
+	MountDirectory string `json:"mount_directory,omitempty"`
+	// True if the filesystem was created by the provisioner.
+	Formatted bool `json:"formatted"`
+
+	Tags map[string]string `json:"tags,omitempty"`
+
+	ProvisionedAt *time.Time `json:"provisioned_at,omitempty"`
+}
+
+// Converts the volume, with the first attachment if any.
+func ConvertVolume(vol aws_ec2_v2_types.Volume) Volume {
+	v := Volume{
+		VolumeID:         aws.ToString(vol.VolumeId),
+		AvailabilityZone: aws.ToString(vol.AvailabilityZone),
+		Tags:             convertTagsToMap(vol.Tags),
+	}
+	if len(vol.Attachments) > 0 {
+		v.InstanceID = aws.ToString(vol.Attachments[0].InstanceId)
+		v.EBSDevice = aws.ToString(vol.Attachments[0].Device)
+	}
+	return v
+}
+
+func (v Volume) Sync(p string) error {
+	parentDir := filepath.Dir(p)
+	if parentDir != "" && parentDir != "/" {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (v Volume) String() string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+func LoadVolume(p string) (Volume, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return Volume{}, err
+	}
+	var v Volume
+	if err := json.Unmarshal(b, &v); err != nil {
+		return Volume{}, err
+	}
+	return v, nil
+}
+
+// Represents the data volumes provisioned to the same instance, ordered by index.
+type Volumes []Volume
+
+func (vs Volumes) Sync(p string) error {
+	parentDir := filepath.Dir(p)
+	if parentDir != "" && parentDir != "/" {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(vs)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0644)
+}
+
+func (vs Volumes) String() string {
+	b, err := json.Marshal(vs)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+// Returns the volume for the index.
+func (vs Volumes) FindByIndex(idx int) (Volume, bool) {
+	for _, v := range vs {
+		if v.Index == idx {
+			return v, true
+		}
+	}
+	return Volume{}, false
+}
+
+// Loads the volumes file, or the single volume file written with one volume.
+func LoadVolumes(p string) (Volumes, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '{' {
+		var v Volume
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, err
+		}
+		return Volumes{v}, nil
+	}
+	var vs Volumes
+	if err := json.Unmarshal(b, &vs); err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+// Returns the deterministic EBS device name for the data volume index
+// (e.g., 0 for /dev/xvdb, 1 for /dev/xvdc), where /dev/xvda is reserved for the root volume.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/device_naming.html
+func EBSDeviceName(index int) (string, error) {
+	if index < 0 || index > 'z'-'b' {
+		return "", fmt.Errorf("volume index %d out of range [0, %d]", index, 'z'-'b')
+	}
+	return fmt.Sprintf("/dev/xvd%c", 'b'+index), nil
+}
@@ -2,8 +2,11 @@ package ec2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -66,4 +69,138 @@ func TestEBS(t *testing.T) {
 	for v := range ch {
 		fmt.Println("volume:", v)
 	}
+	cancel()
+}
+
+func TestVolumeSyncLoad(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "volume.json")
+
+	ts := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	vol := Volume{
+		VolumeID:         "vol-0",
+		AvailabilityZone: "us-west-2a",
+		InstanceID:       "i-0",
+		EBSDevice:        "/dev/xvdb",
+		BlockDevice:      "/dev/nvme1n1",
+		Filesystem:       "ext4",
+		MountDirectory:   "/data",
+		Formatted:        true,
+		Tags:             map[string]string{"Kind": "aws-volume-provisioner"},
+		ProvisionedAt:    &ts,
+	}
+	if err := vol.Sync(p); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadVolume(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vol, loaded) {
+		t.Fatalf("expected %v, got %v", vol, loaded)
+	}
+}
+
+func TestGP3PerformanceForGP2(t *testing.T) {
+	tt := []struct {
+		sizeInGB      int32
+		expIOPS       int32
+		expThroughput int32
+	}{
+		{sizeInGB: 100, expIOPS: 3000, expThroughput: 125},
+		{sizeInGB: 500, expIOPS: 3000, expThroughput: 250},
+		{sizeInGB: 2000, expIOPS: 6000, expThroughput: 250},
+		{sizeInGB: 10000, expIOPS: 16000, expThroughput: 250},
+	}
+	for i, tv := range tt {
+		iops, throughput := gp3PerformanceForGP2(tv.sizeInGB)
+		if iops != tv.expIOPS || throughput != tv.expThroughput {
+			t.Fatalf("#%d: expected %d/%d, got %d/%d", i, tv.expIOPS, tv.expThroughput, iops, throughput)
+		}
+	}
+}
+
+func TestVolumesSyncLoad(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "volumes.json")
+
+	vols := Volumes{
+		{Index: 0, VolumeID: "vol-0", EBSDevice: "/dev/xvdb", BlockDevice: "/dev/nvme1n1"},
+		{Index: 1, VolumeID: "vol-1", EBSDevice: "/dev/xvdc", BlockDevice: "/dev/nvme2n1"},
+	}
+	if err := vols.Sync(p); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadVolumes(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vols, loaded) {
+		t.Fatalf("expected %v, got %v", vols, loaded)
+	}
+	if v, ok := loaded.FindByIndex(1); !ok || v.VolumeID != "vol-1" {
+		t.Fatalf("unexpected volume for index 1: %v (found %v)", v, ok)
+	}
+
+	// the single volume state file is loaded as one volume
+	if err := vols[0].Sync(p); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = LoadVolumes(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vols[:1], loaded) {
+		t.Fatalf("expected %v, got %v", vols[:1], loaded)
+	}
+}
+
+func TestEBSDeviceName(t *testing.T) {
+	tt := []struct {
+		index    int
+		expected string
+		err      bool
+	}{
+		{index: 0, expected: "/dev/xvdb"},
+		{index: 1, expected: "/dev/xvdc"},
+		{index: 24, expected: "/dev/xvdz"},
+		{index: 25, err: true},
+		{index: -1, err: true},
+	}
+	for i, tv := range tt {
+		name, err := EBSDeviceName(tv.index)
+		if tv.err != (err != nil) {
+			t.Fatalf("#%d: expected error %v, got %v", i, tv.err, err)
+		}
+		if name != tv.expected {
+			t.Fatalf("#%d: expected %q, got %q", i, tv.expected, name)
+		}
+	}
+}
+
+func TestVerifyVolumeEncryption(t *testing.T) {
+	keyARN := "arn:aws:kms:us-west-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	tt := []struct {
+		encrypted     bool
+		kmsKeyARN     string
+		wantEncrypted bool
+		wantKMSKeyID  string
+		err           bool
+	}{
+		{encrypted: true, kmsKeyARN: keyARN, wantEncrypted: true},
+		{encrypted: false, wantEncrypted: true, err: true},
+		{encrypted: true, kmsKeyARN: keyARN, wantEncrypted: false},
+		{encrypted: false, wantEncrypted: false},
+		{encrypted: true, kmsKeyARN: keyARN, wantEncrypted: true, wantKMSKeyID: keyARN},
+		{encrypted: true, kmsKeyARN: keyARN, wantEncrypted: true, wantKMSKeyID: "1234abcd-12ab-34cd-56ef-1234567890ab"},
+		{encrypted: true, kmsKeyARN: keyARN, wantEncrypted: true, wantKMSKeyID: "alias/ebs"},
+		{encrypted: true, kmsKeyARN: keyARN, wantEncrypted: true, wantKMSKeyID: "0000abcd-12ab-34cd-56ef-1234567890ab", err: true},
+	}
+	for i, tv := range tt {
+		err := verifyVolumeEncryption(tv.encrypted, tv.kmsKeyARN, tv.wantEncrypted, tv.wantKMSKeyID)
+		if tv.err != (err != nil) {
+			t.Fatalf("#%d: expected error %v, got %v", i, tv.err, err)
+		}
+		if err != nil && !errors.Is(err, ErrVolumeEncryptionMismatch) {
+			t.Fatalf("#%d: unexpected error %v", i, err)
+		}
+	}
 }
@@ -4,8 +4,8 @@ package ec2
 import (
 	"context"
 	"errors"
-	"os"
-	"time"
+	"fmt"
+	"sort"
 
 	"github.com/gyuho/infra/go/logutil"
 
@@ -14,10 +14,82 @@ import (
 	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
 
+// Returned by the iterator callback to stop the iteration without an error.
+var ErrStopIteration = errors.New("stop iteration")
+
+// Converts the filters map to the EC2 API filters, sorted by name.
+// Returns nil if empty.
+func convertFilters(m map[string][]string) []aws_ec2_v2_types.Filter {
+	if len(m) == 0 {
+		return nil
+	}
+	filters := make([]aws_ec2_v2_types.Filter, 0, len(m))
+	for k, vs := range m {
+		filters = append(filters, aws_ec2_v2_types.Filter{
+			Name:   aws.String(k),
+			Values: vs,
+		})
+	}
+	sort.SliceStable(filters, func(i, j int) bool {
+		return *filters[i].Name < *filters[j].Name
+	})
+	return filters
+}
+
+// Lists the instances by filter (e.g., "tag:Kind") and instance states.
+func ListInstances(ctx context.Context, cfg aws.Config, opts ...OpOption) ([]aws_ec2_v2_types.Instance, error) {
+	instances := make([]aws_ec2_v2_types.Instance, 0)
+	err := ForEachInstance(ctx, cfg, func(inst aws_ec2_v2_types.Instance) error {
+		instances = append(instances, inst)
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	logutil.S().Infow("listed instances", "instances", len(instances))
+	return instances, nil
+}
+
+// Calls the function for each instance by filter and instance states,
+// paginating through DescribeInstances without loading all instances into memory.
+// Stops when the function returns an error, and returns nil if the error is "ErrStopIteration".
+func ForEachInstance(ctx context.Context, cfg aws.Config, f func(aws_ec2_v2_types.Instance) error, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+	logutil.S().Infow("listing instances", "filter", ret.filters, "instanceStates", len(ret.instanceStates))
+
+	cli := newAPI(cfg)
+	pg := aws_ec2_v2.NewDescribeInstancesPaginator(cli, &aws_ec2_v2.DescribeInstancesInput{
+		Filters: convertFilters(ret.filters),
+	})
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, r := range out.Reservations {
+			for _, inst := range r.Instances {
+				if ret.instanceStates != nil {
+					if _, ok := ret.instanceStates[inst.State.Name]; !ok {
+						continue
+					}
+				}
+				if err := f(inst); err != nil {
+					if errors.Is(err, ErrStopIteration) {
+						return nil
+					}
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // Fetches the instance by ID.
 func GetInstance(ctx context.Context, cfg aws.Config, instanceID string) (aws_ec2_v2_types.Instance, error) {
 	logutil.S().Infow("getting instance", "instanceID", instanceID)
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 	out, err := cli.DescribeInstances(ctx, &aws_ec2_v2.DescribeInstancesInput{
 		InstanceIds: []string{instanceID},
 	})
@@ -37,23 +109,14 @@ func GetInstance(ctx context.Context, cfg aws.Config, instanceID string) (aws_ec
 
 // Waits until the instance has the expected tag key, and returns the value
 func WaitInstanceTagValue(ctx context.Context, cfg aws.Config, instanceID string, tagKey string) (aws_ec2_v2_types.Instance, string, error) {
-	logutil.S().Infow("waiting for instance tag value", "instanceID", instanceID, "tagKey", tagKey)
 	var instance aws_ec2_v2_types.Instance
 	tagValue := ""
-	for ctx.Err() == nil {
-		select {
-		case <-ctx.Done():
-			return aws_ec2_v2_types.Instance{}, "", ctx.Err()
-		case <-time.After(10 * time.Second):
-		}
-
+	err := WaitUntil(ctx, fmt.Sprintf("instance %s tag %q", instanceID, tagKey), func(ctx context.Context) (bool, string, error) {
 		var err error
 		instance, err = GetInstance(ctx, cfg, instanceID)
 		if err != nil {
-			logutil.S().Warnw("failed to get instance", "error", err)
-			os.Exit(1)
+			return false, "", err
 		}
-
 		for _, tag := range instance.Tags {
 			k, v := *tag.Key, *tag.Value
 			logutil.S().Infow("found instance tag", "key", k, "value", v)
@@ -62,13 +125,10 @@ func WaitInstanceTagValue(ctx context.Context, cfg aws.Config, instanceID string
 				break
 			}
 		}
-
-		if tagValue != "" {
-			break
-		}
-	}
-	if tagValue == "" {
-		return instance, "", errors.New("failed to get tag value in time")
+		return tagValue != "", "", nil
+	})
+	if err != nil {
+		return instance, "", fmt.Errorf("failed to get tag value in time: %w", err)
 	}
 	return instance, tagValue, nil
 }
@@ -0,0 +1,26 @@
+package ec2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertFilters(t *testing.T) {
+	if fs := convertFilters(nil); fs != nil {
+		t.Fatalf("expected nil filters, got %v", fs)
+	}
+
+	fs := convertFilters(map[string][]string{
+		"tag:Kind":      {"aws-ip-provisioner"},
+		"allocation-id": {"eipalloc-1", "eipalloc-2"},
+	})
+	if len(fs) != 2 {
+		t.Fatalf("expected 2 filters, got %d", len(fs))
+	}
+	if *fs[0].Name != "allocation-id" || !reflect.DeepEqual(fs[0].Values, []string{"eipalloc-1", "eipalloc-2"}) {
+		t.Fatalf("unexpected filter %q %v", *fs[0].Name, fs[0].Values)
+	}
+	if *fs[1].Name != "tag:Kind" || !reflect.DeepEqual(fs[1].Values, []string{"aws-ip-provisioner"}) {
+		t.Fatalf("unexpected filter %q %v", *fs[1].Name, fs[1].Values)
+	}
+}
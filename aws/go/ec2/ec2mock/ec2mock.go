@@ -0,0 +1,224 @@
+// Package ec2mock implements the fake EC2 API client with programmable responses,
+// so that the callers of the ec2 package can unit-test without AWS.
+//
+//	cli := &ec2mock.Client{
+//		DescribeAddressesFunc: func(ctx context.Context, in *aws_ec2_v2.DescribeAddressesInput, _ ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeAddressesOutput, error) {
+//			return &aws_ec2_v2.DescribeAddressesOutput{}, nil
+//		},
+//	}
+//	ec2.SetClientFactory(func(aws.Config) ec2.API { return cli })
+//	defer ec2.SetClientFactory(nil)
+package ec2mock
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// Returned by the methods without the programmed response.
+var ErrNotImplemented = errors.New("ec2mock: not implemented")
+
+// Records the API call.
+type Call struct {
+	Method string
+	Input  interface{}
+}
+
+// Implements the "ec2.API" interface, where each method calls the corresponding function field,
+// or returns "ErrNotImplemented" if unset.
+type Client struct {
+	AllocateAddressFunc            func(ctx context.Context, params *aws_ec2_v2.AllocateAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AllocateAddressOutput, error)
+	AssociateAddressFunc           func(ctx context.Context, params *aws_ec2_v2.AssociateAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AssociateAddressOutput, error)
+	DescribeAddressesFunc          func(ctx context.Context, params *aws_ec2_v2.DescribeAddressesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeAddressesOutput, error)
+	DescribeAddressesAttributeFunc func(ctx context.Context, params *aws_ec2_v2.DescribeAddressesAttributeInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeAddressesAttributeOutput, error)
+	DisassociateAddressFunc        func(ctx context.Context, params *aws_ec2_v2.DisassociateAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DisassociateAddressOutput, error)
+	ModifyAddressAttributeFunc     func(ctx context.Context, params *aws_ec2_v2.ModifyAddressAttributeInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.ModifyAddressAttributeOutput, error)
+	ReleaseAddressFunc             func(ctx context.Context, params *aws_ec2_v2.ReleaseAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.ReleaseAddressOutput, error)
+	ResetAddressAttributeFunc      func(ctx context.Context, params *aws_ec2_v2.ResetAddressAttributeInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.ResetAddressAttributeOutput, error)
+	CreateTagsFunc                 func(ctx context.Context, params *aws_ec2_v2.CreateTagsInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.CreateTagsOutput, error)
+	DeleteTagsFunc                 func(ctx context.Context, params *aws_ec2_v2.DeleteTagsInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DeleteTagsOutput, error)
+	DescribeTagsFunc               func(ctx context.Context, params *aws_ec2_v2.DescribeTagsInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeTagsOutput, error)
+	DescribeInstancesFunc          func(ctx context.Context, params *aws_ec2_v2.DescribeInstancesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeInstancesOutput, error)
+	AssignIpv6AddressesFunc        func(ctx context.Context, params *aws_ec2_v2.AssignIpv6AddressesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AssignIpv6AddressesOutput, error)
+	AttachNetworkInterfaceFunc     func(ctx context.Context, params *aws_ec2_v2.AttachNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AttachNetworkInterfaceOutput, error)
+	CreateNetworkInterfaceFunc     func(ctx context.Context, params *aws_ec2_v2.CreateNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.CreateNetworkInterfaceOutput, error)
+	DeleteNetworkInterfaceFunc     func(ctx context.Context, params *aws_ec2_v2.DeleteNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DeleteNetworkInterfaceOutput, error)
+	DescribeNetworkInterfacesFunc  func(ctx context.Context, params *aws_ec2_v2.DescribeNetworkInterfacesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeNetworkInterfacesOutput, error)
+	DetachNetworkInterfaceFunc     func(ctx context.Context, params *aws_ec2_v2.DetachNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DetachNetworkInterfaceOutput, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (c *Client) record(method string, input interface{}) {
+	c.mu.Lock()
+	c.calls = append(c.calls, Call{Method: method, Input: input})
+	c.mu.Unlock()
+}
+
+// Returns the recorded calls in order.
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Call(nil), c.calls...)
+}
+
+// Returns the recorded calls of the method in order.
+func (c *Client) CallsOf(method string) []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	calls := make([]Call, 0)
+	for _, call := range c.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (c *Client) AllocateAddress(ctx context.Context, params *aws_ec2_v2.AllocateAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AllocateAddressOutput, error) {
+	c.record("AllocateAddress", params)
+	if c.AllocateAddressFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.AllocateAddressFunc(ctx, params, optFns...)
+}
+
+func (c *Client) AssociateAddress(ctx context.Context, params *aws_ec2_v2.AssociateAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AssociateAddressOutput, error) {
+	c.record("AssociateAddress", params)
+	if c.AssociateAddressFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.AssociateAddressFunc(ctx, params, optFns...)
+}
+
+func (c *Client) DescribeAddresses(ctx context.Context, params *aws_ec2_v2.DescribeAddressesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeAddressesOutput, error) {
+	c.record("DescribeAddresses", params)
+	if c.DescribeAddressesFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.DescribeAddressesFunc(ctx, params, optFns...)
+}
+
+func (c *Client) DescribeAddressesAttribute(ctx context.Context, params *aws_ec2_v2.DescribeAddressesAttributeInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeAddressesAttributeOutput, error) {
+	c.record("DescribeAddressesAttribute", params)
+	if c.DescribeAddressesAttributeFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.DescribeAddressesAttributeFunc(ctx, params, optFns...)
+}
+
+func (c *Client) DisassociateAddress(ctx context.Context, params *aws_ec2_v2.DisassociateAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DisassociateAddressOutput, error) {
+	c.record("DisassociateAddress", params)
+	if c.DisassociateAddressFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.DisassociateAddressFunc(ctx, params, optFns...)
+}
+
+func (c *Client) ModifyAddressAttribute(ctx context.Context, params *aws_ec2_v2.ModifyAddressAttributeInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.ModifyAddressAttributeOutput, error) {
+	c.record("ModifyAddressAttribute", params)
+	if c.ModifyAddressAttributeFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.ModifyAddressAttributeFunc(ctx, params, optFns...)
+}
+
+func (c *Client) ReleaseAddress(ctx context.Context, params *aws_ec2_v2.ReleaseAddressInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.ReleaseAddressOutput, error) {
+	c.record("ReleaseAddress", params)
+	if c.ReleaseAddressFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.ReleaseAddressFunc(ctx, params, optFns...)
+}
+
+func (c *Client) ResetAddressAttribute(ctx context.Context, params *aws_ec2_v2.ResetAddressAttributeInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.ResetAddressAttributeOutput, error) {
+	c.record("ResetAddressAttribute", params)
+	if c.ResetAddressAttributeFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.ResetAddressAttributeFunc(ctx, params, optFns...)
+}
+
+func (c *Client) CreateTags(ctx context.Context, params *aws_ec2_v2.CreateTagsInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.CreateTagsOutput, error) {
+	c.record("CreateTags", params)
+	if c.CreateTagsFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.CreateTagsFunc(ctx, params, optFns...)
+}
+
+func (c *Client) DeleteTags(ctx context.Context, params *aws_ec2_v2.DeleteTagsInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DeleteTagsOutput, error) {
+	c.record("DeleteTags", params)
+	if c.DeleteTagsFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.DeleteTagsFunc(ctx, params, optFns...)
+}
+
+func (c *Client) DescribeTags(ctx context.Context, params *aws_ec2_v2.DescribeTagsInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeTagsOutput, error) {
+	c.record("DescribeTags", params)
+	if c.DescribeTagsFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.DescribeTagsFunc(ctx, params, optFns...)
+}
+
+func (c *Client) DescribeInstances(ctx context.Context, params *aws_ec2_v2.DescribeInstancesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeInstancesOutput, error) {
+	c.record("DescribeInstances", params)
+	if c.DescribeInstancesFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.DescribeInstancesFunc(ctx, params, optFns...)
+}
+
+func (c *Client) AssignIpv6Addresses(ctx context.Context, params *aws_ec2_v2.AssignIpv6AddressesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AssignIpv6AddressesOutput, error) {
+	c.record("AssignIpv6Addresses", params)
+	if c.AssignIpv6AddressesFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.AssignIpv6AddressesFunc(ctx, params, optFns...)
+}
+
+func (c *Client) AttachNetworkInterface(ctx context.Context, params *aws_ec2_v2.AttachNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.AttachNetworkInterfaceOutput, error) {
+	c.record("AttachNetworkInterface", params)
+	if c.AttachNetworkInterfaceFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.AttachNetworkInterfaceFunc(ctx, params, optFns...)
+}
+
+func (c *Client) CreateNetworkInterface(ctx context.Context, params *aws_ec2_v2.CreateNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.CreateNetworkInterfaceOutput, error) {
+	c.record("CreateNetworkInterface", params)
+	if c.CreateNetworkInterfaceFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.CreateNetworkInterfaceFunc(ctx, params, optFns...)
+}
+
+func (c *Client) DeleteNetworkInterface(ctx context.Context, params *aws_ec2_v2.DeleteNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DeleteNetworkInterfaceOutput, error) {
+	c.record("DeleteNetworkInterface", params)
+	if c.DeleteNetworkInterfaceFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.DeleteNetworkInterfaceFunc(ctx, params, optFns...)
+}
+
+func (c *Client) DescribeNetworkInterfaces(ctx context.Context, params *aws_ec2_v2.DescribeNetworkInterfacesInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DescribeNetworkInterfacesOutput, error) {
+	c.record("DescribeNetworkInterfaces", params)
+	if c.DescribeNetworkInterfacesFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.DescribeNetworkInterfacesFunc(ctx, params, optFns...)
+}
+
+func (c *Client) DetachNetworkInterface(ctx context.Context, params *aws_ec2_v2.DetachNetworkInterfaceInput, optFns ...func(*aws_ec2_v2.Options)) (*aws_ec2_v2.DetachNetworkInterfaceOutput, error) {
+	c.record("DetachNetworkInterface", params)
+	if c.DetachNetworkInterfaceFunc == nil {
+		return nil, ErrNotImplemented
+	}
+	return c.DetachNetworkInterfaceFunc(ctx, params, optFns...)
+}
@@ -1,14 +1,19 @@
 package ec2
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gyuho/infra/go/logutil"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_retry_v2 "github.com/aws/aws-sdk-go-v2/aws/retry"
 	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
 	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 )
@@ -16,43 +21,83 @@ import (
 // Lists the EIPs by filter.
 // e.g., "tag:Kind" and "tag:Id".
 func ListEIPs(ctx context.Context, cfg aws.Config, opts ...OpOption) ([]aws_ec2_v2_types.Address, error) {
+	var addrs []aws_ec2_v2_types.Address
+	err := ForEachEIP(ctx, cfg, func(addr aws_ec2_v2_types.Address) error {
+		addrs = append(addrs, addr)
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		logutil.S().Warnw("no eip address found")
+		return nil, nil
+	}
+
+	logutil.S().Infow("listed eips", "eips", len(addrs))
+	return addrs, nil
+}
+
+// Calls the function for each EIP by filter, until the function returns an error.
+// Returns nil if the function returns "ErrStopIteration".
+// Note that DescribeAddresses does not support pagination, and returns all EIPs at once,
+// so use the filters to narrow down the results.
+func ForEachEIP(ctx context.Context, cfg aws.Config, f func(aws_ec2_v2_types.Address) error, opts ...OpOption) error {
 	ret := &Op{}
 	ret.applyOpts(opts)
 	logutil.S().Infow("listing eips", "filter", ret.filters)
 
-	input := aws_ec2_v2.DescribeAddressesInput{}
-	if len(ret.filters) > 0 {
-		input.Filters = make([]aws_ec2_v2_types.Filter, 0, len(ret.filters))
-		for k, vs := range ret.filters {
-			// TODO: remove this in Go 1.22
-			// ref. https://go.dev/blog/loopvar-preview
-			k, vs := k, vs
-			input.Filters = append(input.Filters, aws_ec2_v2_types.Filter{
-				Name:   &k,
-				Values: vs,
-			})
+	cli := newAPI(cfg)
+	out, err := cli.DescribeAddresses(ctx, &aws_ec2_v2.DescribeAddressesInput{
+		Filters: convertFilters(ret.filters),
+	})
+	if err != nil {
+		return err
+	}
+	for _, addr := range out.Addresses {
+		if err := f(addr); err != nil {
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			return err
 		}
 	}
+	return nil
+}
+
+// Returned when releasing the EIP that is still associated, without "WithForce".
+var ErrEIPAssociated = errors.New("EIP still associated")
+
+// Releases the EIP.
+// Refuses to release the EIP that is still associated (e.g., with another instance),
+// unless "WithForce" is set, in which case the EIP is disassociated first.
+func ReleaseEIP(ctx context.Context, cfg aws.Config, allocationID string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("releasing an EIP", "allocationID", allocationID, "force", ret.force)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
-	out, err := cli.DescribeAddresses(ctx, &input)
+	addrs, err := ListEIPs(ctx, cfg, WithFilters(map[string][]string{"allocation-id": {allocationID}}))
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if len(out.Addresses) == 0 {
-		logutil.S().Warnw("no eip address found")
-		return nil, nil
+	if len(addrs) == 0 {
+		logutil.S().Infow("EIP does not exist -- already released", "allocationID", allocationID)
+		return nil
+	}
+	if addrs[0].AssociationId != nil {
+		associationID := *addrs[0].AssociationId
+		if !ret.force {
+			return fmt.Errorf("%w (allocation ID %q, association ID %q, instance ID %q)", ErrEIPAssociated, allocationID, associationID, aws.ToString(addrs[0].InstanceId))
+		}
+		logutil.S().Warnw("EIP still associated -- disassociating before release", "allocationID", allocationID, "associationID", associationID)
+		if err := DisassociateEIP(ctx, cfg, associationID); err != nil {
+			return err
+		}
 	}
 
-	logutil.S().Infow("listed eips", "eips", len(out.Addresses))
-	return out.Addresses, nil
-}
-
-func ReleaseEIP(ctx context.Context, cfg aws.Config, allocationID string) error {
-	logutil.S().Infow("releasing an EIP", "allocationID", allocationID)
-
-	cli := aws_ec2_v2.NewFromConfig(cfg)
-	_, err := cli.ReleaseAddress(ctx, &aws_ec2_v2.ReleaseAddressInput{
+	cli := newAPI(cfg)
+	_, err = cli.ReleaseAddress(ctx, &aws_ec2_v2.ReleaseAddressInput{
 		AllocationId: &allocationID,
 	})
 	if err != nil {
@@ -63,37 +108,239 @@ func ReleaseEIP(ctx context.Context, cfg aws.Config, allocationID string) error
 	return nil
 }
 
+// Overrides the retryer to only retry the throttled API calls (e.g., RequestLimitExceeded),
+// keeping the maximum number of attempts of the configured retryer.
+func retryThrottledOnly(o *aws_ec2_v2.Options) {
+	maxAttempts := aws_retry_v2.DefaultMaxAttempts
+	if o.Retryer != nil {
+		maxAttempts = o.Retryer.MaxAttempts()
+	}
+	o.Retryer = aws_retry_v2.NewStandard(func(so *aws_retry_v2.StandardOptions) {
+		so.MaxAttempts = maxAttempts
+		so.Retryables = []aws_retry_v2.IsErrorRetryable{
+			aws_retry_v2.NoRetryCanceledError{},
+			aws_retry_v2.IsErrorRetryableFunc(func(err error) aws.Ternary {
+				return aws.BoolTernary(IsThrottled(err))
+			}),
+		}
+	})
+}
+
+// Tag key of the caller-supplied idempotency token on the allocated EIP.
+const EIPIdempotencyTokenTagKey = "IdempotencyToken"
+
+// Allocates an EIP.
+// With "WithIdempotencyToken", the new EIP is tagged with the token in the same call,
+// and the EIP already allocated with the same token is returned instead,
+// so retrying after a network timeout does not double-allocate.
+// The SDK retryer only retries the throttled calls that did not allocate,
+// since the timed out (or failed) call may have allocated the EIP on the server side.
 func AllocateEIP(ctx context.Context, cfg aws.Config, name string, opts ...OpOption) (EIP, error) {
 	ret := &Op{}
 	ret.applyOpts(opts)
 
-	logutil.S().Infow("allocating an EIP", "name", name)
+	logutil.S().Infow("allocating an EIP", "name", name, "publicIPv4Pool", ret.publicIPv4Pool, "customerOwnedIPv4Pool", ret.customerOwnedIPv4Pool, "idempotencyToken", ret.idempotencyToken)
 
-	tags := ConvertTags(name, ret.tags)
-	cli := aws_ec2_v2.NewFromConfig(cfg)
-	out, err := cli.AllocateAddress(ctx, &aws_ec2_v2.AllocateAddressInput{
+	if ret.idempotencyToken != "" {
+		eip, found, err := FindEIPByIdempotencyToken(ctx, cfg, ret.idempotencyToken)
+		if err != nil {
+			return EIP{}, err
+		}
+		if found {
+			logutil.S().Infow("found EIP already allocated with the idempotency token", "eip", eip)
+			return eip, nil
+		}
+	}
+
+	m := make(map[string]string, len(ret.tags)+1)
+	for k, v := range ret.tags {
+		m[k] = v
+	}
+	if ret.idempotencyToken != "" {
+		m[EIPIdempotencyTokenTagKey] = ret.idempotencyToken
+	}
+	tags := ConvertTags(name, m)
+	input := &aws_ec2_v2.AllocateAddressInput{
 		TagSpecifications: []aws_ec2_v2_types.TagSpecification{
 			{
 				ResourceType: aws_ec2_v2_types.ResourceTypeElasticIp,
 				Tags:         tags,
 			},
 		},
-	})
+	}
+	if ret.publicIPv4Pool != "" {
+		input.PublicIpv4Pool = &ret.publicIPv4Pool
+	}
+	if ret.customerOwnedIPv4Pool != "" {
+		input.CustomerOwnedIpv4Pool = &ret.customerOwnedIPv4Pool
+	}
+
+	cli := newAPI(cfg)
+	out, err := cli.AllocateAddress(ctx, input, retryThrottledOnly)
 	if err != nil {
 		return EIP{}, err
 	}
 
 	eip := EIP{
 		AllocationID: *out.AllocationId,
-		PublicIP:     *out.PublicIp,
+		Tags:         make(map[string]string, len(tags)),
+	}
+	for _, tg := range tags {
+		eip.Tags[*tg.Key] = *tg.Value
+	}
+	if out.PublicIp != nil {
+		eip.PublicIP = *out.PublicIp
+	} else if out.CustomerOwnedIp != nil {
+		// CoIP pool allocates the customer-owned IP, instead of the public IP
+		eip.PublicIP = *out.CustomerOwnedIp
 	}
 	logutil.S().Infow("successfully allocated an EIP", "eip", eip)
 	return eip, nil
 }
 
+// Sets the domain name for the reverse DNS (PTR record) of the EIP,
+// or resets it if the domain name is empty.
+// The domain name must have the forward DNS record (A record) resolving to the EIP,
+// and the update is processed asynchronously (see "GetAddressDomainName").
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/elastic-ip-addresses-eip.html#Using_Elastic_Addressing_Reverse_DNS
+func SetAddressAttribute(ctx context.Context, cfg aws.Config, allocationID string, domainName string) error {
+	logutil.S().Infow("setting EIP domain name", "allocationID", allocationID, "domainName", domainName)
+
+	cli := newAPI(cfg)
+	var err error
+	if domainName == "" {
+		_, err = cli.ResetAddressAttribute(ctx, &aws_ec2_v2.ResetAddressAttributeInput{
+			AllocationId: &allocationID,
+			Attribute:    aws_ec2_v2_types.AddressAttributeNameDomainName,
+		})
+	} else {
+		_, err = cli.ModifyAddressAttribute(ctx, &aws_ec2_v2.ModifyAddressAttributeInput{
+			AllocationId: &allocationID,
+			DomainName:   &domainName,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully set EIP domain name", "allocationID", allocationID, "domainName", domainName)
+	return nil
+}
+
+// Returns the current reverse DNS (PTR record) domain name of the EIP,
+// and the status of the pending update (e.g., "PENDING"), if any.
+func GetAddressDomainName(ctx context.Context, cfg aws.Config, allocationID string) (string, string, error) {
+	cli := newAPI(cfg)
+	out, err := cli.DescribeAddressesAttribute(ctx, &aws_ec2_v2.DescribeAddressesAttributeInput{
+		AllocationIds: []string{allocationID},
+		Attribute:     aws_ec2_v2_types.AddressAttributeNameDomainName,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if len(out.Addresses) != 1 {
+		return "", "", fmt.Errorf("expected 1 address attribute, got %d", len(out.Addresses))
+	}
+
+	attr := out.Addresses[0]
+	status := ""
+	if attr.PtrRecordUpdate != nil {
+		status = aws.ToString(attr.PtrRecordUpdate.Status)
+	}
+	return aws.ToString(attr.PtrRecord), status, nil
+}
+
+// Finds the EIP allocated with the idempotency token.
+// Returns false if not found.
+func FindEIPByIdempotencyToken(ctx context.Context, cfg aws.Config, token string) (EIP, bool, error) {
+	addrs, err := ListEIPs(ctx, cfg, WithFilters(map[string][]string{
+		"tag:" + EIPIdempotencyTokenTagKey: {token},
+	}))
+	if err != nil {
+		return EIP{}, false, err
+	}
+	if len(addrs) == 0 {
+		return EIP{}, false, nil
+	}
+	if len(addrs) > 1 {
+		return EIP{}, false, fmt.Errorf("found %d EIPs with the idempotency token %q", len(addrs), token)
+	}
+	return ConvertEIP(addrs[0]), true, nil
+}
+
+// Converts the address to the EIP, with the association metadata and tags.
+// The public IP is the customer-owned IP for the CoIP pool.
+func ConvertEIP(addr aws_ec2_v2_types.Address) EIP {
+	eip := EIP{
+		AllocationID: aws.ToString(addr.AllocationId),
+		PublicIP:     aws.ToString(addr.PublicIp),
+	}
+	if eip.PublicIP == "" {
+		eip.PublicIP = aws.ToString(addr.CustomerOwnedIp)
+	}
+	eip.AssociationID = aws.ToString(addr.AssociationId)
+	eip.NetworkInterfaceID = aws.ToString(addr.NetworkInterfaceId)
+	eip.PrivateIP = aws.ToString(addr.PrivateIpAddress)
+	if len(addr.Tags) > 0 {
+		eip.Tags = make(map[string]string, len(addr.Tags))
+		for _, tg := range addr.Tags {
+			eip.Tags[aws.ToString(tg.Key)] = aws.ToString(tg.Value)
+		}
+	}
+	return eip
+}
+
+// Current schema version of the persisted EIPs file.
+// Version 1 is the bare JSON array of EIPs (or a single EIP object),
+// without the association metadata.
+const EIPsSchemaVersion = 2
+
 type EIP struct {
 	AllocationID string `json:"allocation_id"`
 	PublicIP     string `json:"public_ip"`
+
+	// ENI device index that the EIP is associated with (0 for the primary ENI).
+	DeviceIndex int32 `json:"device_index"`
+
+	AssociationID      string            `json:"association_id,omitempty"`
+	NetworkInterfaceID string            `json:"network_interface_id,omitempty"`
+	PrivateIP          string            `json:"private_ip,omitempty"`
+	Tags               map[string]string `json:"tags,omitempty"`
+
+	// Reverse DNS (PTR record) domain name of the EIP, set by "SetAddressAttribute".
+	DomainName string `json:"domain_name,omitempty"`
+
+	// Last time the association ID changed (nil if never associated).
+	AssociatedAt *time.Time `json:"associated_at,omitempty"`
+}
+
+// Returns the EIP without the association metadata and tags,
+// to fit in the size-limited places (e.g., EC2 tag values).
+func (e EIP) Summary() EIP {
+	return EIP{
+		AllocationID: e.AllocationID,
+		PublicIP:     e.PublicIP,
+		DeviceIndex:  e.DeviceIndex,
+	}
+}
+
+// Updates the association metadata from the address.
+// The association timestamp is only updated when the association ID changes.
+func (e *EIP) UpdateAssociation(addr aws_ec2_v2_types.Address, now time.Time) {
+	associationID := aws.ToString(addr.AssociationId)
+	if associationID != "" && associationID != e.AssociationID {
+		ts := now.UTC()
+		e.AssociatedAt = &ts
+	}
+	e.AssociationID = associationID
+	e.NetworkInterfaceID = aws.ToString(addr.NetworkInterfaceId)
+	e.PrivateIP = aws.ToString(addr.PrivateIpAddress)
+	if len(addr.Tags) > 0 {
+		e.Tags = make(map[string]string, len(addr.Tags))
+		for _, tg := range addr.Tags {
+			e.Tags[aws.ToString(tg.Key)] = aws.ToString(tg.Value)
+		}
+	}
 }
 
 func (e EIP) Sync(p string) error {
@@ -135,6 +382,13 @@ func LoadEIP(p string) (EIP, error) {
 
 type EIPs []EIP
 
+// Persisted format of the EIPs file.
+type eipsFile struct {
+	SchemaVersion int  `json:"schema_version"`
+	EIPs          EIPs `json:"eips"`
+}
+
+// Writes the EIPs in the current schema version.
 func (e EIPs) Sync(p string) error {
 	parentDir := filepath.Dir(p)
 	if parentDir != "" && parentDir != "/" {
@@ -142,7 +396,7 @@ func (e EIPs) Sync(p string) error {
 			return err
 		}
 	}
-	b, err := json.Marshal(e)
+	b, err := json.Marshal(eipsFile{SchemaVersion: EIPsSchemaVersion, EIPs: e})
 	if err != nil {
 		return err
 	}
@@ -160,16 +414,83 @@ func (e EIPs) String() string {
 	return string(b)
 }
 
+// Returns the EIPs without the association metadata and tags.
+func (e EIPs) Summary() EIPs {
+	ss := make(EIPs, 0, len(e))
+	for _, eip := range e {
+		ss = append(ss, eip.Summary())
+	}
+	return ss
+}
+
+// Updates the association metadata of each EIP from the addresses with the same allocation ID.
+func (e EIPs) UpdateAssociations(addrs []aws_ec2_v2_types.Address, now time.Time) {
+	for i := range e {
+		for _, addr := range addrs {
+			if aws.ToString(addr.AllocationId) == e[i].AllocationID {
+				e[i].UpdateAssociation(addr, now)
+				break
+			}
+		}
+	}
+}
+
+// Returns the EIP for the ENI device index.
+func (e EIPs) FindByDeviceIndex(idx int32) (EIP, bool) {
+	for _, eip := range e {
+		if eip.DeviceIndex == idx {
+			return eip, true
+		}
+	}
+	return EIP{}, false
+}
+
+// Loads the EIPs file, migrating from the older schema versions
+// (the bare JSON array, or the single EIP object of "current-eip.json").
 func LoadEIPs(p string) (EIPs, error) {
 	b, err := os.ReadFile(p)
 	if err != nil {
 		return nil, err
 	}
-	var e EIPs
-	if err := json.Unmarshal(b, &e); err != nil {
+	return parseEIPs(b)
+}
+
+func parseEIPs(b []byte) (EIPs, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, errors.New("empty EIPs file")
+	}
+
+	// schema version 1
+	if b[0] == '[' {
+		var e EIPs
+		if err := json.Unmarshal(b, &e); err != nil {
+			return nil, err
+		}
+		logutil.S().Infow("migrating EIPs file from schema version 1", "eips", len(e))
+		return e, nil
+	}
+
+	var f eipsFile
+	if err := json.Unmarshal(b, &f); err != nil {
 		return nil, err
 	}
-	return e, nil
+	if f.SchemaVersion == 0 {
+		// single EIP object before the schema version was introduced
+		var eip EIP
+		if err := json.Unmarshal(b, &eip); err != nil {
+			return nil, err
+		}
+		if eip.AllocationID == "" {
+			return nil, errors.New("unknown EIPs file format")
+		}
+		logutil.S().Infow("migrating single EIP file from schema version 1", "eip", eip)
+		return EIPs{eip}, nil
+	}
+	if f.SchemaVersion > EIPsSchemaVersion {
+		return nil, fmt.Errorf("unsupported EIPs file schema version %d (expected <= %d)", f.SchemaVersion, EIPsSchemaVersion)
+	}
+	return f.EIPs, nil
 }
 
 // Associates the EIP to the instance.
@@ -177,15 +498,69 @@ func LoadEIPs(p string) (EIPs, error) {
 // e.g.,
 // "operation error EC2: AssociateAddress, https response error StatusCode: 400, api error InvalidInstanceID:
 // There are multiple interfaces attached to instance 'i-...'. Please specify an interface ID for the operation instead."
-func AssociateEIPByInstanceID(ctx context.Context, cfg aws.Config, allocationID string, instanceID string) error {
-	logutil.S().Infow("associating EIP", "allocationID", allocationID, "instanceID", instanceID)
+func AssociateEIPByInstanceID(ctx context.Context, cfg aws.Config, allocationID string, instanceID string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("associating EIP", "allocationID", allocationID, "instanceID", instanceID, "privateIP", ret.privateIP)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
-	_, err := cli.AssociateAddress(ctx, &aws_ec2_v2.AssociateAddressInput{
+	input := &aws_ec2_v2.AssociateAddressInput{
 		AllocationId:       &allocationID,
 		AllowReassociation: aws.Bool(true),
 		InstanceId:         &instanceID,
+	}
+	if ret.privateIP != "" {
+		input.PrivateIpAddress = &ret.privateIP
+	}
+	cli := newAPI(cfg)
+	_, err := cli.AssociateAddress(ctx, input)
+	if err != nil {
+		return err
+	}
+	logutil.S().Infow("successfully associated EIP")
+	return nil
+}
+
+// Disassociates the EIP by its association ID.
+// Returns nil if the association does not exist (e.g., already disassociated).
+func DisassociateEIP(ctx context.Context, cfg aws.Config, associationID string) error {
+	logutil.S().Infow("disassociating EIP", "associationID", associationID)
+
+	cli := newAPI(cfg)
+	_, err := cli.DisassociateAddress(ctx, &aws_ec2_v2.DisassociateAddressInput{
+		AssociationId: &associationID,
 	})
+	if err != nil {
+		if IsNotFound(err) {
+			logutil.S().Infow("EIP association does not exist -- already disassociated", "associationID", associationID)
+			return nil
+		}
+		return err
+	}
+	logutil.S().Infow("successfully disassociated EIP", "associationID", associationID)
+	return nil
+}
+
+// Associates the EIP to the network interface.
+// Required when the EC2 instance has multiple ENIs.
+// Use "WithPrivateIP" to associate with a secondary private IP of the ENI
+// (otherwise, associates with the primary private IP).
+func AssociateEIPByENIID(ctx context.Context, cfg aws.Config, allocationID string, eniID string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("associating EIP", "allocationID", allocationID, "eniID", eniID, "privateIP", ret.privateIP)
+
+	input := &aws_ec2_v2.AssociateAddressInput{
+		AllocationId:       &allocationID,
+		AllowReassociation: aws.Bool(true),
+		NetworkInterfaceId: &eniID,
+	}
+	if ret.privateIP != "" {
+		input.PrivateIpAddress = &ret.privateIP
+	}
+	cli := newAPI(cfg)
+	_, err := cli.AssociateAddress(ctx, input)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,179 @@
+package ec2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_retry_v2 "github.com/aws/aws-sdk-go-v2/aws/retry"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestEIPsSyncLoad(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "current-eips.json")
+
+	eips := EIPs{
+		{AllocationID: "eipalloc-0", PublicIP: "1.2.3.4", DeviceIndex: 0},
+		{AllocationID: "eipalloc-1", PublicIP: "5.6.7.8", DeviceIndex: 1},
+	}
+	if err := eips.Sync(p); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadEIPs(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(eips, loaded) {
+		t.Fatalf("expected %v, got %v", eips, loaded)
+	}
+
+	eip, ok := loaded.FindByDeviceIndex(1)
+	if !ok || eip.AllocationID != "eipalloc-1" {
+		t.Fatalf("unexpected EIP for device index 1: %v (found %v)", eip, ok)
+	}
+	if _, ok = loaded.FindByDeviceIndex(2); ok {
+		t.Fatal("unexpected EIP for device index 2")
+	}
+}
+
+func TestLoadEIPsWithoutDeviceIndex(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "current-eips.json")
+	if err := os.WriteFile(p, []byte(`[{"allocation_id":"eipalloc-0","public_ip":"1.2.3.4"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadEIPs(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.FindByDeviceIndex(0); !ok {
+		t.Fatal("expected the EIP to default to the primary ENI")
+	}
+}
+
+func TestLoadEIPsMigration(t *testing.T) {
+	tt := []struct {
+		name     string
+		data     string
+		expected EIPs
+		err      bool
+	}{
+		{
+			name:     "single EIP",
+			data:     `{"allocation_id":"eipalloc-0","public_ip":"1.2.3.4"}`,
+			expected: EIPs{{AllocationID: "eipalloc-0", PublicIP: "1.2.3.4"}},
+		},
+		{
+			name:     "array",
+			data:     `[{"allocation_id":"eipalloc-0","public_ip":"1.2.3.4","device_index":1}]`,
+			expected: EIPs{{AllocationID: "eipalloc-0", PublicIP: "1.2.3.4", DeviceIndex: 1}},
+		},
+		{
+			name:     "schema version 2",
+			data:     `{"schema_version":2,"eips":[{"allocation_id":"eipalloc-0","public_ip":"1.2.3.4","association_id":"eipassoc-0"}]}`,
+			expected: EIPs{{AllocationID: "eipalloc-0", PublicIP: "1.2.3.4", AssociationID: "eipassoc-0"}},
+		},
+		{
+			name: "future schema version",
+			data: `{"schema_version":100,"eips":[]}`,
+			err:  true,
+		},
+		{
+			name: "unknown object",
+			data: `{"foo":"bar"}`,
+			err:  true,
+		},
+	}
+	for _, tv := range tt {
+		t.Run(tv.name, func(t *testing.T) {
+			eips, err := parseEIPs([]byte(tv.data))
+			if tv.err != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tv.err, err)
+			}
+			if !reflect.DeepEqual(tv.expected, eips) {
+				t.Fatalf("expected %+v, got %+v", tv.expected, eips)
+			}
+		})
+	}
+}
+
+func TestEIPsUpdateAssociations(t *testing.T) {
+	eips := EIPs{
+		{AllocationID: "eipalloc-0", PublicIP: "1.2.3.4"},
+		{AllocationID: "eipalloc-1", PublicIP: "5.6.7.8", DeviceIndex: 1},
+	}
+	now := time.Now()
+	eips.UpdateAssociations([]aws_ec2_v2_types.Address{
+		{
+			AllocationId:       aws.String("eipalloc-0"),
+			AssociationId:      aws.String("eipassoc-0"),
+			NetworkInterfaceId: aws.String("eni-0"),
+			PrivateIpAddress:   aws.String("10.0.0.1"),
+			Tags:               []aws_ec2_v2_types.Tag{{Key: aws.String("Name"), Value: aws.String("test")}},
+		},
+	}, now)
+	if eips[0].AssociationID != "eipassoc-0" || eips[0].NetworkInterfaceID != "eni-0" || eips[0].PrivateIP != "10.0.0.1" || eips[0].Tags["Name"] != "test" {
+		t.Fatalf("unexpected association %+v", eips[0])
+	}
+	if eips[0].AssociatedAt == nil || !eips[0].AssociatedAt.Equal(now) {
+		t.Fatalf("unexpected associated at %v", eips[0].AssociatedAt)
+	}
+	if eips[1].AssociationID != "" || eips[1].AssociatedAt != nil {
+		t.Fatalf("unexpected association %+v", eips[1])
+	}
+
+	// same association ID should not update the timestamp
+	eips.UpdateAssociations([]aws_ec2_v2_types.Address{
+		{AllocationId: aws.String("eipalloc-0"), AssociationId: aws.String("eipassoc-0")},
+	}, now.Add(time.Hour))
+	if !eips[0].AssociatedAt.Equal(now) {
+		t.Fatalf("unexpected associated at %v", eips[0].AssociatedAt)
+	}
+
+	if s := eips.Summary(); !reflect.DeepEqual(s[0], EIP{AllocationID: "eipalloc-0", PublicIP: "1.2.3.4"}) {
+		t.Fatalf("unexpected summary %+v", s[0])
+	}
+}
+
+func TestConvertEIP(t *testing.T) {
+	eip := ConvertEIP(aws_ec2_v2_types.Address{
+		AllocationId:    aws.String("eipalloc-0"),
+		CustomerOwnedIp: aws.String("10.1.2.3"),
+		Tags:            []aws_ec2_v2_types.Tag{{Key: aws.String(EIPIdempotencyTokenTagKey), Value: aws.String("i-0-0")}},
+	})
+	expected := EIP{
+		AllocationID: "eipalloc-0",
+		PublicIP:     "10.1.2.3",
+		Tags:         map[string]string{EIPIdempotencyTokenTagKey: "i-0-0"},
+	}
+	if !reflect.DeepEqual(expected, eip) {
+		t.Fatalf("expected %+v, got %+v", expected, eip)
+	}
+}
+
+func TestRetryThrottledOnly(t *testing.T) {
+	o := aws_ec2_v2.Options{Retryer: aws_retry_v2.NewStandard(func(so *aws_retry_v2.StandardOptions) { so.MaxAttempts = 6 })}
+	retryThrottledOnly(&o)
+
+	if v := o.Retryer.MaxAttempts(); v != 6 {
+		t.Fatalf("expected 6 max attempts, got %d", v)
+	}
+	for _, tv := range []struct {
+		err       error
+		retryable bool
+	}{
+		{err: &smithy.GenericAPIError{Code: "RequestLimitExceeded"}, retryable: true},
+		{err: &smithy.GenericAPIError{Code: "InternalError", Fault: smithy.FaultServer}},
+		{err: &aws_retry_v2.MaxAttemptsError{}},
+		{err: errors.New("read tcp: i/o timeout")},
+	} {
+		if v := o.Retryer.IsErrorRetryable(tv.err); v != tv.retryable {
+			t.Fatalf("%v: expected retryable %v, got %v", tv.err, tv.retryable, v)
+		}
+	}
+}
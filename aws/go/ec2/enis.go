@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -30,6 +32,7 @@ type ENI struct {
 	AttachmentNetworkCardIndex int32             `json:"attachment_network_card_index,omitempty"`
 	PrivateIP                  string            `json:"private_ip,omitempty"`
 	PrivateDNS                 string            `json:"private_dns,omitempty"`
+	IPv6Addresses              []string          `json:"ipv6_addresses,omitempty"`
 	VPCID                      string            `json:"vpc_id,omitempty"`
 	SubnetID                   string            `json:"subnet_id,omitempty"`
 	AvailabilityZone           string            `json:"availability_zone,omitempty"`
@@ -93,6 +96,12 @@ func ConvertENI(raw aws_ec2_v2_types.NetworkInterface) ENI {
 	}
 	eni.SecurityGroupIDs = sgs
 
+	for _, v := range raw.Ipv6Addresses {
+		if v.Ipv6Address != nil {
+			eni.IPv6Addresses = append(eni.IPv6Addresses, *v.Ipv6Address)
+		}
+	}
+
 	tags := make(map[string]string, len(raw.TagSet))
 	for _, tg := range raw.TagSet {
 		if *tg.Key == "Name" {
@@ -105,8 +114,66 @@ func ConvertENI(raw aws_ec2_v2_types.NetworkInterface) ENI {
 	return eni
 }
 
+func (eni ENI) Sync(p string) error {
+	parentDir := filepath.Dir(p)
+	if parentDir != "" && parentDir != "/" {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(eni)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		return err
+	}
+	return nil
+}
+
+func LoadENI(p string) (ENI, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return ENI{}, err
+	}
+	var eni ENI
+	if err := json.Unmarshal(b, &eni); err != nil {
+		return ENI{}, err
+	}
+	return eni, nil
+}
+
 type ENIs []ENI
 
+func (enis ENIs) Sync(p string) error {
+	parentDir := filepath.Dir(p)
+	if parentDir != "" && parentDir != "/" {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(enis)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		return err
+	}
+	return nil
+}
+
+func LoadENIs(p string) (ENIs, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var enis ENIs
+	if err := json.Unmarshal(b, &enis); err != nil {
+		return nil, err
+	}
+	return enis, nil
+}
+
 func (enis ENIs) ToMap() map[string]ENI {
 	m := make(map[string]ENI, len(enis))
 	for _, eni := range enis {
@@ -181,46 +248,39 @@ func ListENIs(ctx context.Context, cfg aws.Config, opts ...OpOption) (ENIs, erro
 	logutil.S().Infow("listing ENIs",
 		"eniIDs", len(ret.eniIDs),
 		"filters", ret.filters,
+		"subnetID", ret.subnetID,
+		"securityGroupIDs", ret.securityGroupIDs,
 		"tags", ret.tags,
 	)
 
 	// ref. https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/service/ec2#DescribeNetworkInterfacesInput
-	input := aws_ec2_v2.DescribeNetworkInterfacesInput{}
+	input := &aws_ec2_v2.DescribeNetworkInterfacesInput{}
 	if len(ret.eniIDs) > 0 {
 		input.NetworkInterfaceIds = ret.eniIDs
-	} else if len(ret.filters) > 0 {
-		input.Filters = make([]aws_ec2_v2_types.Filter, 0, len(ret.filters))
+	} else {
+		filters := make(map[string][]string, len(ret.filters)+2)
 		for k, vs := range ret.filters {
-			// TODO: remove this in Go 1.22
-			// ref. https://go.dev/blog/loopvar-preview
-			k, vs := k, vs
-			input.Filters = append(input.Filters, aws_ec2_v2_types.Filter{
-				Name:   &k,
-				Values: vs,
-			})
+			filters[k] = vs
+		}
+		if ret.subnetID != "" {
+			filters["subnet-id"] = []string{ret.subnetID}
+		}
+		if len(ret.securityGroupIDs) > 0 {
+			filters["group-id"] = ret.securityGroupIDs
 		}
+		input.Filters = convertFilters(filters)
 	}
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 
 	raw := make([]aws_ec2_v2_types.NetworkInterface, 0, 10)
-	var nextToken *string = nil
-	for i := 0; i < 20; i++ {
-		copied := input
-		copied.NextToken = nextToken
-		out, err := cli.DescribeNetworkInterfaces(ctx, &copied)
+	pg := aws_ec2_v2.NewDescribeNetworkInterfacesPaginator(cli, input)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
 		if err != nil {
 			return nil, err
 		}
-
 		raw = append(raw, out.NetworkInterfaces...)
-
-		if nextToken == nil {
-			// no more resources are available
-			break
-		}
-
-		// TODO: add wait to prevent api throttle (rate limit)?
 	}
 
 	enis := make(ENIs, 0, len(raw))
@@ -264,7 +324,7 @@ func CheckENITags(eni ENI, tags map[string]string) bool {
 func GetPrimaryENIByInstanceID(ctx context.Context, cfg aws.Config, instanceID string) (eni aws_ec2_v2_types.NetworkInterface, err error) {
 	logutil.S().Infow("getting primary ENI", "instanceID", instanceID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 	out, err := cli.DescribeInstances(
 		ctx,
 		&aws_ec2_v2.DescribeInstancesInput{
@@ -317,7 +377,7 @@ func GetPrimaryENIByInstanceID(ctx context.Context, cfg aws.Config, instanceID s
 
 // Returns false if the ENI does not exist.
 func GetENI(ctx context.Context, cfg aws.Config, eniID string) (ENI, bool, error) {
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 
 	out, err := cli.DescribeNetworkInterfaces(ctx,
 		&aws_ec2_v2.DescribeNetworkInterfacesInput{
@@ -340,7 +400,7 @@ func GetENI(ctx context.Context, cfg aws.Config, eniID string) (ENI, bool, error
 }
 
 func GetENIByTagKey(ctx context.Context, cfg aws.Config, tagKey string, tagValue string) (ENI, bool, error) {
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 
 	out, err := cli.DescribeNetworkInterfaces(ctx,
 		&aws_ec2_v2.DescribeNetworkInterfacesInput{
@@ -371,7 +431,7 @@ func GetENIByName(ctx context.Context, cfg aws.Config, name string) (ENI, bool,
 func GetENIsByInstanceID(ctx context.Context, cfg aws.Config, instanceID string) (ENIs, error) {
 	logutil.S().Infow("getting ENIs by instance ID", "instanceID", instanceID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 	out, err := cli.DescribeInstances(
 		ctx,
 		&aws_ec2_v2.DescribeInstancesInput{
@@ -402,14 +462,24 @@ func GetENIsByInstanceID(ctx context.Context, cfg aws.Config, instanceID string)
 }
 
 // Creates an ENI for a given subnet and security groups.
+// If empty, the subnet and security groups are taken from "WithSubnetID" and "WithSecurityGroupIDs".
 func CreateENI(ctx context.Context, cfg aws.Config, name string, subnetID string, sgIDs []string, opts ...OpOption) (ENI, error) {
 	ret := &Op{}
 	ret.applyOpts(opts)
+	if subnetID == "" {
+		subnetID = ret.subnetID
+	}
+	if len(sgIDs) == 0 {
+		sgIDs = ret.securityGroupIDs
+	}
+	if subnetID == "" {
+		return ENI{}, errors.New("empty subnet ID")
+	}
 
 	tags := ConvertTags(name, ret.tags)
 	logutil.S().Infow("creating an ENI", "name", name, "subnetID", subnetID, "securityGroupIDs", sgIDs, "tags", tags)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 	out, err := cli.CreateNetworkInterface(ctx, &aws_ec2_v2.CreateNetworkInterfaceInput{
 		SubnetId:    aws.String(subnetID),
 		Groups:      sgIDs,
@@ -435,7 +505,7 @@ func DeleteENI(ctx context.Context, cfg aws.Config, eniID string, opts ...OpOpti
 
 	logutil.S().Infow("deleting ENI", "eniID", eniID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 	_, err := cli.DeleteNetworkInterface(ctx,
 		&aws_ec2_v2.DeleteNetworkInterfaceInput{
 			NetworkInterfaceId: aws.String(eniID),
@@ -477,7 +547,7 @@ func DeleteENIByName(ctx context.Context, cfg aws.Config, eniName string) (bool,
 func AttachENI(ctx context.Context, cfg aws.Config, eniID string, instanceID string) (string, error) {
 	logutil.S().Infow("attaching ENI", "eniID", eniID, "instanceID", instanceID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 	out, err := cli.DescribeInstances(ctx, &aws_ec2_v2.DescribeInstancesInput{
 		InstanceIds: []string{instanceID},
 	})
@@ -510,6 +580,24 @@ func AttachENI(ctx context.Context, cfg aws.Config, eniID string, instanceID str
 	return attachID, nil
 }
 
+// Assigns the IPv6 addresses from the subnet's IPv6 CIDR to the ENI, and returns the assigned addresses.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_AssignIpv6Addresses.html
+func AssignIPv6Addresses(ctx context.Context, cfg aws.Config, eniID string, count int32) ([]string, error) {
+	logutil.S().Infow("assigning IPv6 addresses", "eniID", eniID, "count", count)
+
+	cli := newAPI(cfg)
+	out, err := cli.AssignIpv6Addresses(ctx, &aws_ec2_v2.AssignIpv6AddressesInput{
+		NetworkInterfaceId: &eniID,
+		Ipv6AddressCount:   &count,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logutil.S().Infow("successfully assigned IPv6 addresses", "eniID", eniID, "addresses", out.AssignedIpv6Addresses)
+	return out.AssignedIpv6Addresses, nil
+}
+
 // Returns true if it's detached. Returns false if it's already detached.
 func DetachENI(ctx context.Context, cfg aws.Config, eniID string, force bool) (bool, error) {
 	eni, exists, err := GetENI(ctx, cfg, eniID)
@@ -522,7 +610,7 @@ func DetachENI(ctx context.Context, cfg aws.Config, eniID string, force bool) (b
 
 	logutil.S().Infow("detaching ENI", "eniID", eniID, "attachmentID", eni.AttachmentID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 	_, err = cli.DetachNetworkInterface(ctx,
 		&aws_ec2_v2.DetachNetworkInterfaceInput{
 			AttachmentId: aws.String(eni.AttachmentID),
@@ -577,7 +665,7 @@ func pollENI(
 	pollInterval time.Duration,
 ) <-chan ENIStatus {
 	now := time.Now()
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newAPI(cfg)
 
 	ch := make(chan ENIStatus, 10)
 	go func() {
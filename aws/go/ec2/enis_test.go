@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -128,3 +129,33 @@ func TestENIs(t *testing.T) {
 		}
 	}
 }
+
+func TestENISyncLoad(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "enis.json")
+
+	enis := ENIs{
+		{ID: "eni-1", SubnetID: "subnet-1", AttachmentDeviceIndex: 1, Tags: map[string]string{"Name": "a"}},
+		{ID: "eni-2", SubnetID: "subnet-1", SecurityGroupIDs: []string{"sg-1"}},
+	}
+	if err := enis.Sync(p); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadENIs(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(enis, loaded) {
+		t.Fatalf("expected %+v, got %+v", enis, loaded)
+	}
+
+	if err := enis[0].Sync(p); err != nil {
+		t.Fatal(err)
+	}
+	eni, err := LoadENI(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(enis[0], eni) {
+		t.Fatalf("expected %+v, got %+v", enis[0], eni)
+	}
+}
@@ -0,0 +1,74 @@
+package ec2
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// EC2 API error codes by class.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/APIReference/errors-overview.html
+var (
+	throttledErrorCodes = map[string]struct{}{
+		"RequestLimitExceeded":      {},
+		"Throttling":                {},
+		"ThrottlingException":       {},
+		"ThrottledException":        {},
+		"RequestThrottled":          {},
+		"RequestThrottledException": {},
+		"TooManyRequestsException":  {},
+		"EC2ThrottledException":     {},
+		"PriorRequestNotComplete":   {},
+	}
+	unauthorizedErrorCodes = map[string]struct{}{
+		"AuthFailure":           {},
+		"UnauthorizedOperation": {},
+		"AccessDenied":          {},
+		"AccessDeniedException": {},
+		"ExpiredToken":          {},
+		"ExpiredTokenException": {},
+		"InvalidClientTokenId":  {},
+		"SignatureDoesNotMatch": {},
+		"OptInRequired":         {},
+	}
+)
+
+// Returns the API error code (e.g., "InvalidInstanceID.NotFound"),
+// or empty if the error is not an API error.
+func ErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+// Returns true if the request was throttled (e.g., "RequestLimitExceeded"),
+// which should be retried with backoff.
+func IsThrottled(err error) bool {
+	_, ok := throttledErrorCodes[ErrorCode(err)]
+	return ok
+}
+
+// Returns true if the resource does not exist (e.g., "InvalidAllocationID.NotFound").
+func IsNotFound(err error) bool {
+	code := ErrorCode(err)
+	return code == "NotFound" || strings.HasSuffix(code, ".NotFound")
+}
+
+// Returns true if the credentials are invalid or lack the permission (e.g., "UnauthorizedOperation"),
+// which is not fixed by retrying.
+func IsUnauthorized(err error) bool {
+	_, ok := unauthorizedErrorCodes[ErrorCode(err)]
+	return ok
+}
+
+// Returns true if the error is transient: throttled, or the server-side fault (e.g., "InternalError").
+func IsRetryable(err error) bool {
+	if IsThrottled(err) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorFault() == smithy.FaultServer
+}
@@ -0,0 +1,41 @@
+package ec2
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestErrorClassification(t *testing.T) {
+	tt := []struct {
+		err          error
+		throttled    bool
+		notFound     bool
+		unauthorized bool
+		retryable    bool
+	}{
+		{err: nil},
+		{err: errors.New("RequestLimitExceeded")},
+		{err: &smithy.GenericAPIError{Code: "RequestLimitExceeded"}, throttled: true, retryable: true},
+		{err: fmt.Errorf("operation error: %w", &smithy.GenericAPIError{Code: "InvalidAllocationID.NotFound"}), notFound: true},
+		{err: &smithy.GenericAPIError{Code: "UnauthorizedOperation"}, unauthorized: true},
+		{err: &smithy.GenericAPIError{Code: "InternalError", Fault: smithy.FaultServer}, retryable: true},
+		{err: &smithy.GenericAPIError{Code: "InvalidParameterValue", Fault: smithy.FaultClient}},
+	}
+	for i, tv := range tt {
+		if v := IsThrottled(tv.err); v != tv.throttled {
+			t.Errorf("#%d: expected throttled %v, got %v", i, tv.throttled, v)
+		}
+		if v := IsNotFound(tv.err); v != tv.notFound {
+			t.Errorf("#%d: expected not found %v, got %v", i, tv.notFound, v)
+		}
+		if v := IsUnauthorized(tv.err); v != tv.unauthorized {
+			t.Errorf("#%d: expected unauthorized %v, got %v", i, tv.unauthorized, v)
+		}
+		if v := IsRetryable(tv.err); v != tv.retryable {
+			t.Errorf("#%d: expected retryable %v, got %v", i, tv.retryable, v)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Requires the session tokens (IMDSv2) for the instance metadata service,
+// with the PUT response hop limit (1 to 64, 2 for the containers without host networking).
+// Use "WithWait" to wait until the metadata options are applied.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/configuring-instance-metadata-options.html
+func EnforceIMDSv2(ctx context.Context, cfg aws.Config, instanceID string, hopLimit int32, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	if hopLimit < 1 || hopLimit > 64 {
+		return fmt.Errorf("invalid hop limit %d (must be 1 to 64)", hopLimit)
+	}
+
+	logutil.S().Infow("enforcing IMDSv2", "instanceID", instanceID, "hopLimit", hopLimit)
+	cli := newClient(cfg)
+	out, err := cli.ModifyInstanceMetadataOptions(ctx, &aws_ec2_v2.ModifyInstanceMetadataOptionsInput{
+		InstanceId:              aws.String(instanceID),
+		HttpTokens:              aws_ec2_v2_types.HttpTokensStateRequired,
+		HttpEndpoint:            aws_ec2_v2_types.InstanceMetadataEndpointStateEnabled,
+		HttpPutResponseHopLimit: aws.Int32(hopLimit),
+	})
+	if err != nil {
+		return err
+	}
+	if out.InstanceMetadataOptions != nil && out.InstanceMetadataOptions.State == aws_ec2_v2_types.InstanceMetadataOptionsStateApplied {
+		logutil.S().Infow("successfully enforced IMDSv2", "instanceID", instanceID)
+		return nil
+	}
+	if !ret.wait {
+		logutil.S().Infow("requested to enforce IMDSv2", "instanceID", instanceID)
+		return nil
+	}
+
+	return WaitUntil(ctx, fmt.Sprintf("instance %s metadata options applied", instanceID), func(ctx context.Context) (bool, string, error) {
+		inst, err := GetInstance(ctx, cfg, instanceID)
+		if err != nil {
+			return false, "", err
+		}
+		if inst.MetadataOptions == nil {
+			return false, "", nil
+		}
+		return inst.MetadataOptions.State == aws_ec2_v2_types.InstanceMetadataOptionsStateApplied, string(inst.MetadataOptions.State), nil
+	}, opts...)
+}
+
+// Represents the instance that still allows IMDSv1.
+type IMDSAuditResult struct {
+	InstanceID    string `json:"instance_id"`
+	InstanceState string `json:"instance_state"`
+	HTTPTokens    string `json:"http_tokens"`
+	HTTPEndpoint  string `json:"http_endpoint"`
+	HopLimit      int32  `json:"hop_limit"`
+	Name          string `json:"name,omitempty"`
+}
+
+// Lists the instances by filter and instance states (e.g., "running") that still allow IMDSv1,
+// i.e., the session tokens are optional while the metadata endpoint is enabled.
+func AuditIMDS(ctx context.Context, cfg aws.Config, opts ...OpOption) ([]IMDSAuditResult, error) {
+	rs := make([]IMDSAuditResult, 0)
+	total := 0
+	err := ForEachInstance(ctx, cfg, func(inst aws_ec2_v2_types.Instance) error {
+		total++
+		if r, ok := auditIMDS(inst); ok {
+			rs = append(rs, r)
+		}
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	logutil.S().Infow("audited IMDS", "instances", total, "imdsv1Allowed", len(rs))
+	return rs, nil
+}
+
+// Returns true if the instance allows IMDSv1.
+func auditIMDS(inst aws_ec2_v2_types.Instance) (IMDSAuditResult, bool) {
+	mo := inst.MetadataOptions
+	if mo == nil {
+		return IMDSAuditResult{}, false
+	}
+	if mo.HttpEndpoint == aws_ec2_v2_types.InstanceMetadataEndpointStateDisabled {
+		return IMDSAuditResult{}, false
+	}
+	if mo.HttpTokens == aws_ec2_v2_types.HttpTokensStateRequired {
+		return IMDSAuditResult{}, false
+	}
+
+	r := IMDSAuditResult{
+		InstanceID:   aws.ToString(inst.InstanceId),
+		HTTPTokens:   string(mo.HttpTokens),
+		HTTPEndpoint: string(mo.HttpEndpoint),
+		HopLimit:     aws.ToInt32(mo.HttpPutResponseHopLimit),
+	}
+	if inst.State != nil {
+		r.InstanceState = string(inst.State.Name)
+	}
+	for _, tg := range inst.Tags {
+		if aws.ToString(tg.Key) == "Name" {
+			r.Name = aws.ToString(tg.Value)
+		}
+	}
+	return r, true
+}
@@ -0,0 +1,50 @@
+package ec2
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestAuditIMDS(t *testing.T) {
+	tt := []struct {
+		mo  *aws_ec2_v2_types.InstanceMetadataOptionsResponse
+		exp bool
+	}{
+		{mo: nil, exp: false},
+		{
+			mo: &aws_ec2_v2_types.InstanceMetadataOptionsResponse{
+				HttpTokens:   aws_ec2_v2_types.HttpTokensStateOptional,
+				HttpEndpoint: aws_ec2_v2_types.InstanceMetadataEndpointStateEnabled,
+			},
+			exp: true,
+		},
+		{
+			mo: &aws_ec2_v2_types.InstanceMetadataOptionsResponse{
+				HttpTokens:   aws_ec2_v2_types.HttpTokensStateOptional,
+				HttpEndpoint: aws_ec2_v2_types.InstanceMetadataEndpointStateDisabled,
+			},
+			exp: false,
+		},
+		{
+			mo: &aws_ec2_v2_types.InstanceMetadataOptionsResponse{
+				HttpTokens:   aws_ec2_v2_types.HttpTokensStateRequired,
+				HttpEndpoint: aws_ec2_v2_types.InstanceMetadataEndpointStateEnabled,
+			},
+			exp: false,
+		},
+	}
+	for i, tv := range tt {
+		r, ok := auditIMDS(aws_ec2_v2_types.Instance{
+			InstanceId:      aws.String("i-1"),
+			MetadataOptions: tv.mo,
+		})
+		if ok != tv.exp {
+			t.Fatalf("#%d: expected %v, got %v", i, tv.exp, ok)
+		}
+		if ok && r.InstanceID != "i-1" {
+			t.Fatalf("#%d: unexpected instance ID %q", i, r.InstanceID)
+		}
+	}
+}
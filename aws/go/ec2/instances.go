@@ -0,0 +1,140 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Returned when terminating the instance with the termination protection, without "WithForce".
+var ErrTerminationProtected = errors.New("instance termination protection enabled")
+
+// Starts the instances.
+// With "WithWait", waits until all instances are running
+// (the wait interval and backoff options are passed to the waiter).
+func StartInstances(ctx context.Context, cfg aws.Config, instanceIDs []string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("starting instances", "instanceIDs", instanceIDs)
+	cli := newClient(cfg)
+	_, err := cli.StartInstances(ctx, &aws_ec2_v2.StartInstancesInput{
+		InstanceIds: instanceIDs,
+	})
+	if err != nil {
+		return err
+	}
+	logutil.S().Infow("successfully requested to start instances", "instanceIDs", instanceIDs)
+
+	if !ret.wait {
+		return nil
+	}
+	return waitForInstancesState(ctx, cfg, instanceIDs, aws_ec2_v2_types.InstanceStateNameRunning, opts...)
+}
+
+// Stops the instances. Use "WithForce" to force stop without the graceful OS shutdown.
+// With "WithWait", waits until all instances are stopped.
+func StopInstances(ctx context.Context, cfg aws.Config, instanceIDs []string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("stopping instances", "instanceIDs", instanceIDs, "force", ret.force)
+	cli := newClient(cfg)
+	_, err := cli.StopInstances(ctx, &aws_ec2_v2.StopInstancesInput{
+		InstanceIds: instanceIDs,
+		Force:       aws.Bool(ret.force),
+	})
+	if err != nil {
+		return err
+	}
+	logutil.S().Infow("successfully requested to stop instances", "instanceIDs", instanceIDs)
+
+	if !ret.wait {
+		return nil
+	}
+	return waitForInstancesState(ctx, cfg, instanceIDs, aws_ec2_v2_types.InstanceStateNameStopped, opts...)
+}
+
+// Reboots the instances.
+// The instances stay in the running state, so there is no state to wait for.
+func RebootInstances(ctx context.Context, cfg aws.Config, instanceIDs []string) error {
+	logutil.S().Infow("rebooting instances", "instanceIDs", instanceIDs)
+	cli := newClient(cfg)
+	_, err := cli.RebootInstances(ctx, &aws_ec2_v2.RebootInstancesInput{
+		InstanceIds: instanceIDs,
+	})
+	if err != nil {
+		return err
+	}
+	logutil.S().Infow("successfully requested to reboot instances", "instanceIDs", instanceIDs)
+	return nil
+}
+
+// Terminates the instances.
+// Refuses to terminate any instance with the termination protection ("DisableApiTermination"),
+// unless "WithForce" is set, in which case the protection is disabled first.
+// With "WithWait", waits until all instances are terminated.
+func TerminateInstances(ctx context.Context, cfg aws.Config, instanceIDs []string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("terminating instances", "instanceIDs", instanceIDs, "force", ret.force)
+	cli := newClient(cfg)
+
+	protected := make([]string, 0)
+	for _, id := range instanceIDs {
+		out, err := cli.DescribeInstanceAttribute(ctx, &aws_ec2_v2.DescribeInstanceAttributeInput{
+			InstanceId: aws.String(id),
+			Attribute:  aws_ec2_v2_types.InstanceAttributeNameDisableApiTermination,
+		})
+		if err != nil {
+			return err
+		}
+		if out.DisableApiTermination != nil && aws.ToBool(out.DisableApiTermination.Value) {
+			protected = append(protected, id)
+		}
+	}
+	if len(protected) > 0 {
+		if !ret.force {
+			return fmt.Errorf("%w (instances %v)", ErrTerminationProtected, protected)
+		}
+		for _, id := range protected {
+			logutil.S().Warnw("disabling termination protection", "instanceID", id)
+			_, err := cli.ModifyInstanceAttribute(ctx, &aws_ec2_v2.ModifyInstanceAttributeInput{
+				InstanceId:            aws.String(id),
+				DisableApiTermination: &aws_ec2_v2_types.AttributeBooleanValue{Value: aws.Bool(false)},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := cli.TerminateInstances(ctx, &aws_ec2_v2.TerminateInstancesInput{
+		InstanceIds: instanceIDs,
+	})
+	if err != nil {
+		return err
+	}
+	logutil.S().Infow("successfully requested to terminate instances", "instanceIDs", instanceIDs)
+
+	if !ret.wait {
+		return nil
+	}
+	return waitForInstancesState(ctx, cfg, instanceIDs, aws_ec2_v2_types.InstanceStateNameTerminated, opts...)
+}
+
+func waitForInstancesState(ctx context.Context, cfg aws.Config, instanceIDs []string, state aws_ec2_v2_types.InstanceStateName, opts ...OpOption) error {
+	for _, id := range instanceIDs {
+		if _, err := WaitForInstanceState(ctx, cfg, id, state, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
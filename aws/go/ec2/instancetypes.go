@@ -0,0 +1,125 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Represents the instance type capabilities.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/using-eni.html#AvailableIpPerENI
+type InstanceTypeInfo struct {
+	InstanceType string `json:"instance_type"`
+	Hypervisor   string `json:"hypervisor"`
+
+	VCPUs     int32 `json:"vcpus"`
+	MemoryMiB int64 `json:"memory_mib"`
+
+	EBSBaselineBandwidthMbps int32 `json:"ebs_baseline_bandwidth_mbps"`
+	EBSMaximumBandwidthMbps  int32 `json:"ebs_maximum_bandwidth_mbps"`
+
+	ENASupport         string `json:"ena_support"`
+	NetworkPerformance string `json:"network_performance"`
+
+	MaxENIs         int32 `json:"max_enis"`
+	MaxIPv4PerENI   int32 `json:"max_ipv4_per_eni"`
+	MaxIPv6PerENI   int32 `json:"max_ipv6_per_eni"`
+	MaxNetworkCards int32 `json:"max_network_cards"`
+}
+
+// Returns the maximum number of EIPs the instance can take,
+// where each EIP is associated with a private IPv4 address on an ENI.
+func (info InstanceTypeInfo) MaxEIPs() int32 {
+	return info.MaxENIs * info.MaxIPv4PerENI
+}
+
+// Nitro instances share the attachment limit between the ENIs, EBS volumes and NVMe instance store volumes.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/volume_limits.html
+const (
+	nitroMaxAttachments = 28
+	xenMaxVolumes       = 40
+)
+
+// Returns the estimated maximum number of additional EBS volumes
+// given the number of ENIs attached (including the primary) and the root volume.
+func (info InstanceTypeInfo) MaxVolumes(attachedENIs int32) int32 {
+	if info.Hypervisor != string(aws_ec2_v2_types.InstanceTypeHypervisorNitro) {
+		return xenMaxVolumes - 1
+	}
+	n := nitroMaxAttachments - attachedENIs - 1
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+func convertInstanceTypeInfo(raw aws_ec2_v2_types.InstanceTypeInfo) InstanceTypeInfo {
+	info := InstanceTypeInfo{
+		InstanceType: string(raw.InstanceType),
+		Hypervisor:   string(raw.Hypervisor),
+	}
+	if raw.VCpuInfo != nil {
+		info.VCPUs = aws.ToInt32(raw.VCpuInfo.DefaultVCpus)
+	}
+	if raw.MemoryInfo != nil {
+		info.MemoryMiB = aws.ToInt64(raw.MemoryInfo.SizeInMiB)
+	}
+	if raw.EbsInfo != nil && raw.EbsInfo.EbsOptimizedInfo != nil {
+		info.EBSBaselineBandwidthMbps = aws.ToInt32(raw.EbsInfo.EbsOptimizedInfo.BaselineBandwidthInMbps)
+		info.EBSMaximumBandwidthMbps = aws.ToInt32(raw.EbsInfo.EbsOptimizedInfo.MaximumBandwidthInMbps)
+	}
+	if raw.NetworkInfo != nil {
+		info.ENASupport = string(raw.NetworkInfo.EnaSupport)
+		info.NetworkPerformance = aws.ToString(raw.NetworkInfo.NetworkPerformance)
+		info.MaxENIs = aws.ToInt32(raw.NetworkInfo.MaximumNetworkInterfaces)
+		info.MaxIPv4PerENI = aws.ToInt32(raw.NetworkInfo.Ipv4AddressesPerInterface)
+		info.MaxIPv6PerENI = aws.ToInt32(raw.NetworkInfo.Ipv6AddressesPerInterface)
+		info.MaxNetworkCards = aws.ToInt32(raw.NetworkInfo.MaximumNetworkCards)
+	}
+	return info
+}
+
+var (
+	instanceTypeInfoCacheMu sync.Mutex
+	// keyed by region and instance type
+	instanceTypeInfoCache = make(map[string]InstanceTypeInfo)
+)
+
+// Returns the instance type capabilities, cached in-process per region
+// since the instance type capabilities do not change.
+func GetInstanceTypeInfo(ctx context.Context, cfg aws.Config, instanceType string) (InstanceTypeInfo, error) {
+	key := cfg.Region + "/" + instanceType
+
+	instanceTypeInfoCacheMu.Lock()
+	info, ok := instanceTypeInfoCache[key]
+	instanceTypeInfoCacheMu.Unlock()
+	if ok {
+		return info, nil
+	}
+
+	logutil.S().Infow("describing instance type", "instanceType", instanceType)
+	cli := newClient(cfg)
+	out, err := cli.DescribeInstanceTypes(ctx, &aws_ec2_v2.DescribeInstanceTypesInput{
+		InstanceTypes: []aws_ec2_v2_types.InstanceType{aws_ec2_v2_types.InstanceType(instanceType)},
+	})
+	if err != nil {
+		return InstanceTypeInfo{}, err
+	}
+	if len(out.InstanceTypes) != 1 {
+		return InstanceTypeInfo{}, fmt.Errorf("expected 1 instance type, got %d", len(out.InstanceTypes))
+	}
+	info = convertInstanceTypeInfo(out.InstanceTypes[0])
+
+	instanceTypeInfoCacheMu.Lock()
+	instanceTypeInfoCache[key] = info
+	instanceTypeInfoCacheMu.Unlock()
+
+	logutil.S().Infow("described instance type", "instanceType", instanceType, "maxENIs", info.MaxENIs, "maxIPv4PerENI", info.MaxIPv4PerENI)
+	return info, nil
+}
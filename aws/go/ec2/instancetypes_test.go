@@ -0,0 +1,31 @@
+package ec2
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestConvertInstanceTypeInfo(t *testing.T) {
+	info := convertInstanceTypeInfo(aws_ec2_v2_types.InstanceTypeInfo{
+		InstanceType: aws_ec2_v2_types.InstanceTypeC6iLarge,
+		Hypervisor:   aws_ec2_v2_types.InstanceTypeHypervisorNitro,
+		VCpuInfo:     &aws_ec2_v2_types.VCpuInfo{DefaultVCpus: aws.Int32(2)},
+		MemoryInfo:   &aws_ec2_v2_types.MemoryInfo{SizeInMiB: aws.Int64(4096)},
+		NetworkInfo: &aws_ec2_v2_types.NetworkInfo{
+			MaximumNetworkInterfaces:  aws.Int32(3),
+			Ipv4AddressesPerInterface: aws.Int32(10),
+			Ipv6AddressesPerInterface: aws.Int32(10),
+		},
+	})
+	if info.VCPUs != 2 || info.MemoryMiB != 4096 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if n := info.MaxEIPs(); n != 30 {
+		t.Fatalf("expected 30 EIPs, got %d", n)
+	}
+	if n := info.MaxVolumes(2); n != 25 {
+		t.Fatalf("expected 25 volumes, got %d", n)
+	}
+}
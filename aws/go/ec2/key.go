@@ -23,7 +23,7 @@ func CreateRSAKeyPair(ctx context.Context, cfg aws.Config, keyName string, tags
 	delete(tags, "Name")
 	ts := ConvertTags("", tags)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	out, err := cli.CreateKeyPair(ctx, &aws_ec2_v2.CreateKeyPairInput{
 		KeyName: &keyName,
 
@@ -66,7 +66,7 @@ func ImportKeyPair(ctx context.Context, cfg aws.Config, pubKeyPath string, keyNa
 	delete(tags, "Name")
 	ts := ConvertTags("", tags)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	out, err := cli.ImportKeyPair(ctx, &aws_ec2_v2.ImportKeyPairInput{
 		KeyName:           &keyName,
 		PublicKeyMaterial: b,
@@ -105,7 +105,7 @@ func ImportKeyPair(ctx context.Context, cfg aws.Config, pubKeyPath string, keyNa
 func DeleteKeyPair(ctx context.Context, cfg aws.Config, keyID string) error {
 	logutil.S().Infow("deleting key pair", "keyID", keyID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	out, err := cli.DeleteKeyPair(ctx, &aws_ec2_v2.DeleteKeyPairInput{
 		KeyPairId: &keyID,
 	})
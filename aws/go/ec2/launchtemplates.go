@@ -0,0 +1,210 @@
+package ec2
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Models the launch template data.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_RequestLaunchTemplateData.html
+type LaunchTemplateData struct {
+	ImageID               string   `json:"image_id"`
+	InstanceType          string   `json:"instance_type"`
+	KeyName               string   `json:"key_name,omitempty"`
+	SecurityGroupIDs      []string `json:"security_group_ids,omitempty"`
+	IAMInstanceProfileARN string   `json:"iam_instance_profile_arn,omitempty"`
+
+	// Plain text user data, base64-encoded when rendered.
+	UserData string `json:"user_data,omitempty"`
+
+	// True to require the IMDSv2 session tokens.
+	IMDSv2Required bool `json:"imdsv2_required"`
+	// Hop limit of the IMDS PUT response (e.g., 2 for the containers), 0 for the default.
+	IMDSHopLimit int32 `json:"imds_hop_limit,omitempty"`
+	// True to expose the instance tags in the IMDS.
+	IMDSInstanceTags bool `json:"imds_instance_tags"`
+
+	BlockDeviceMappings []LaunchTemplateBlockDevice `json:"block_device_mappings,omitempty"`
+
+	// Capacity reservation to launch the instances into.
+	CapacityReservationID string `json:"capacity_reservation_id,omitempty"`
+	// Capacity reservation preference ("open", "none", "capacity-reservations-only"),
+	// ignored if the capacity reservation ID is set.
+	CapacityReservationPreference string `json:"capacity_reservation_preference,omitempty"`
+
+	// Tags for the launched instances and volumes.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+type LaunchTemplateBlockDevice struct {
+	DeviceName          string `json:"device_name"`
+	VolumeType          string `json:"volume_type"`
+	VolumeSizeInGB      int32  `json:"volume_size_in_gb"`
+	IOPS                int32  `json:"iops,omitempty"`
+	Throughput          int32  `json:"throughput,omitempty"`
+	Encrypted           bool   `json:"encrypted"`
+	DeleteOnTermination bool   `json:"delete_on_termination"`
+}
+
+// Renders the launch template data for the API request.
+func (d LaunchTemplateData) render() *aws_ec2_v2_types.RequestLaunchTemplateData {
+	req := &aws_ec2_v2_types.RequestLaunchTemplateData{
+		ImageId:      aws.String(d.ImageID),
+		InstanceType: aws_ec2_v2_types.InstanceType(d.InstanceType),
+	}
+	if d.KeyName != "" {
+		req.KeyName = aws.String(d.KeyName)
+	}
+	if len(d.SecurityGroupIDs) > 0 {
+		req.SecurityGroupIds = d.SecurityGroupIDs
+	}
+	if d.IAMInstanceProfileARN != "" {
+		req.IamInstanceProfile = &aws_ec2_v2_types.LaunchTemplateIamInstanceProfileSpecificationRequest{
+			Arn: aws.String(d.IAMInstanceProfileARN),
+		}
+	}
+	if d.UserData != "" {
+		req.UserData = aws.String(base64.StdEncoding.EncodeToString([]byte(d.UserData)))
+	}
+
+	req.MetadataOptions = &aws_ec2_v2_types.LaunchTemplateInstanceMetadataOptionsRequest{
+		HttpEndpoint: aws_ec2_v2_types.LaunchTemplateInstanceMetadataEndpointStateEnabled,
+		HttpTokens:   aws_ec2_v2_types.LaunchTemplateHttpTokensStateOptional,
+	}
+	if d.IMDSv2Required {
+		req.MetadataOptions.HttpTokens = aws_ec2_v2_types.LaunchTemplateHttpTokensStateRequired
+	}
+	if d.IMDSHopLimit > 0 {
+		req.MetadataOptions.HttpPutResponseHopLimit = aws.Int32(d.IMDSHopLimit)
+	}
+	if d.IMDSInstanceTags {
+		req.MetadataOptions.InstanceMetadataTags = aws_ec2_v2_types.LaunchTemplateInstanceMetadataTagsStateEnabled
+	}
+
+	for _, bd := range d.BlockDeviceMappings {
+		ebs := &aws_ec2_v2_types.LaunchTemplateEbsBlockDeviceRequest{
+			VolumeType:          aws_ec2_v2_types.VolumeType(bd.VolumeType),
+			VolumeSize:          aws.Int32(bd.VolumeSizeInGB),
+			Encrypted:           aws.Bool(bd.Encrypted),
+			DeleteOnTermination: aws.Bool(bd.DeleteOnTermination),
+		}
+		if bd.IOPS > 0 {
+			ebs.Iops = aws.Int32(bd.IOPS)
+		}
+		if bd.Throughput > 0 {
+			ebs.Throughput = aws.Int32(bd.Throughput)
+		}
+		req.BlockDeviceMappings = append(req.BlockDeviceMappings, aws_ec2_v2_types.LaunchTemplateBlockDeviceMappingRequest{
+			DeviceName: aws.String(bd.DeviceName),
+			Ebs:        ebs,
+		})
+	}
+
+	if d.CapacityReservationID != "" {
+		req.CapacityReservationSpecification = &aws_ec2_v2_types.LaunchTemplateCapacityReservationSpecificationRequest{
+			CapacityReservationTarget: &aws_ec2_v2_types.CapacityReservationTarget{
+				CapacityReservationId: aws.String(d.CapacityReservationID),
+			},
+		}
+	} else if d.CapacityReservationPreference != "" {
+		req.CapacityReservationSpecification = &aws_ec2_v2_types.LaunchTemplateCapacityReservationSpecificationRequest{
+			CapacityReservationPreference: aws_ec2_v2_types.CapacityReservationPreference(d.CapacityReservationPreference),
+		}
+	}
+
+	if len(d.Tags) > 0 {
+		tags := ConvertTags("", d.Tags)
+		req.TagSpecifications = []aws_ec2_v2_types.LaunchTemplateTagSpecificationRequest{
+			{ResourceType: aws_ec2_v2_types.ResourceTypeInstance, Tags: tags},
+			{ResourceType: aws_ec2_v2_types.ResourceTypeVolume, Tags: tags},
+		}
+	}
+	return req
+}
+
+// Creates a launch template, and returns its ID and the version number.
+// Use "WithDescription" to set the version description, and "WithTags" for the template tags.
+func CreateLaunchTemplate(ctx context.Context, cfg aws.Config, name string, data LaunchTemplateData, opts ...OpOption) (string, int64, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("creating a launch template", "name", name, "imageID", data.ImageID, "instanceType", data.InstanceType)
+
+	input := &aws_ec2_v2.CreateLaunchTemplateInput{
+		LaunchTemplateName: aws.String(name),
+		LaunchTemplateData: data.render(),
+		TagSpecifications: []aws_ec2_v2_types.TagSpecification{
+			{
+				ResourceType: aws_ec2_v2_types.ResourceTypeLaunchTemplate,
+				Tags:         ConvertTags(name, ret.tags),
+			},
+		},
+	}
+	if ret.desc != "" {
+		input.VersionDescription = aws.String(ret.desc)
+	}
+
+	cli := newClient(cfg)
+	out, err := cli.CreateLaunchTemplate(ctx, input)
+	if err != nil {
+		return "", 0, err
+	}
+
+	id := aws.ToString(out.LaunchTemplate.LaunchTemplateId)
+	version := aws.ToInt64(out.LaunchTemplate.LatestVersionNumber)
+	logutil.S().Infow("successfully created a launch template", "name", name, "launchTemplateID", id, "version", version)
+	return id, version, nil
+}
+
+// Creates a new version of the launch template (e.g., to roll a new AMI), and returns the version number.
+// The new version is not the default until "SetDefaultLaunchTemplateVersion" is called.
+// Use "WithDescription" to set the version description.
+func CreateLaunchTemplateVersion(ctx context.Context, cfg aws.Config, launchTemplateID string, data LaunchTemplateData, opts ...OpOption) (int64, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("creating a launch template version", "launchTemplateID", launchTemplateID, "imageID", data.ImageID, "instanceType", data.InstanceType)
+
+	input := &aws_ec2_v2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateId:   aws.String(launchTemplateID),
+		LaunchTemplateData: data.render(),
+	}
+	if ret.desc != "" {
+		input.VersionDescription = aws.String(ret.desc)
+	}
+
+	cli := newClient(cfg)
+	out, err := cli.CreateLaunchTemplateVersion(ctx, input)
+	if err != nil {
+		return 0, err
+	}
+
+	version := aws.ToInt64(out.LaunchTemplateVersion.VersionNumber)
+	logutil.S().Infow("successfully created a launch template version", "launchTemplateID", launchTemplateID, "version", version)
+	return version, nil
+}
+
+// Sets the default version of the launch template,
+// which is used by the ASGs referencing the "$Default" version.
+func SetDefaultLaunchTemplateVersion(ctx context.Context, cfg aws.Config, launchTemplateID string, version int64) error {
+	logutil.S().Infow("setting the default launch template version", "launchTemplateID", launchTemplateID, "version", version)
+
+	cli := newClient(cfg)
+	_, err := cli.ModifyLaunchTemplate(ctx, &aws_ec2_v2.ModifyLaunchTemplateInput{
+		LaunchTemplateId: aws.String(launchTemplateID),
+		DefaultVersion:   aws.String(strconv.FormatInt(version, 10)),
+	})
+	if err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully set the default launch template version", "launchTemplateID", launchTemplateID, "version", version)
+	return nil
+}
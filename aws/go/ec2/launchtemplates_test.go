@@ -0,0 +1,43 @@
+package ec2
+
+import (
+	"encoding/base64"
+	"testing"
+
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestLaunchTemplateDataRender(t *testing.T) {
+	req := LaunchTemplateData{
+		ImageID:        "ami-0",
+		InstanceType:   "c6i.large",
+		UserData:       "#!/bin/bash\necho hello\n",
+		IMDSv2Required: true,
+		IMDSHopLimit:   2,
+		BlockDeviceMappings: []LaunchTemplateBlockDevice{
+			{DeviceName: "/dev/xvda", VolumeType: "gp3", VolumeSizeInGB: 100, Throughput: 250, Encrypted: true},
+		},
+		CapacityReservationID: "cr-0",
+		Tags:                  map[string]string{"Kind": "worker"},
+	}.render()
+
+	if *req.ImageId != "ami-0" || req.InstanceType != aws_ec2_v2_types.InstanceTypeC6iLarge {
+		t.Fatalf("unexpected image or instance type %+v", req)
+	}
+	b, err := base64.StdEncoding.DecodeString(*req.UserData)
+	if err != nil || string(b) != "#!/bin/bash\necho hello\n" {
+		t.Fatalf("unexpected user data %q (%v)", b, err)
+	}
+	if req.MetadataOptions.HttpTokens != aws_ec2_v2_types.LaunchTemplateHttpTokensStateRequired || *req.MetadataOptions.HttpPutResponseHopLimit != 2 {
+		t.Fatalf("unexpected metadata options %+v", req.MetadataOptions)
+	}
+	if len(req.BlockDeviceMappings) != 1 || req.BlockDeviceMappings[0].Ebs.Iops != nil || *req.BlockDeviceMappings[0].Ebs.Throughput != 250 {
+		t.Fatalf("unexpected block device mappings %+v", req.BlockDeviceMappings)
+	}
+	if *req.CapacityReservationSpecification.CapacityReservationTarget.CapacityReservationId != "cr-0" {
+		t.Fatalf("unexpected capacity reservation specification %+v", req.CapacityReservationSpecification)
+	}
+	if len(req.TagSpecifications) != 2 {
+		t.Fatalf("unexpected tag specifications %+v", req.TagSpecifications)
+	}
+}
@@ -0,0 +1,377 @@
+package metadata
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+)
+
+const (
+	defaultEndpoint = "http://169.254.169.254"
+
+	// Overrides the default endpoint, same as the AWS SDKs
+	// (e.g., the fake server in "metadatatest" for the tests).
+	EndpointEnvKey = "AWS_EC2_METADATA_SERVICE_ENDPOINT"
+
+	defaultTokenTTL = 6 * time.Hour
+
+	// refreshes the token before it expires, to not race with the expiry in flight
+	tokenRefreshMargin = time.Minute
+)
+
+type Op struct {
+	endpoint       string
+	eventIntervals map[EventType]time.Duration
+	eventTypes     []EventType
+	httpClient     *http.Client
+	interval       time.Duration
+	tokenTTL       time.Duration
+	userDataFormat string
+	vars           map[string]string
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Sets the instance metadata service endpoint
+// (default "AWS_EC2_METADATA_SERVICE_ENDPOINT" if set, otherwise "http://169.254.169.254").
+func WithEndpoint(v string) OpOption {
+	return func(op *Op) {
+		op.endpoint = v
+	}
+}
+
+// Sets the HTTP client to call the instance metadata service with.
+func WithHTTPClient(cli *http.Client) OpOption {
+	return func(op *Op) {
+		op.httpClient = cli
+	}
+}
+
+// Sets the session token TTL (default 6 hours, the maximum allowed).
+func WithTokenTTL(v time.Duration) OpOption {
+	return func(op *Op) {
+		op.tokenTTL = v
+	}
+}
+
+// Represents the instance metadata service v2 client,
+// which caches the session token and refreshes it before the expiry.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/configuring-instance-metadata-service.html
+type Client struct {
+	op Op
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// Creates a new instance metadata service v2 client.
+func New(opts ...OpOption) *Client {
+	ret := Op{tokenTTL: defaultTokenTTL}
+	ret.applyOpts(opts)
+	if ret.httpClient == nil {
+		ret.httpClient = &http.Client{}
+	}
+	return &Client{op: ret}
+}
+
+// Returns the endpoint, resolved on each call so the environment variable
+// set after the default client is created (e.g., in the tests) takes effect.
+func (c *Client) endpoint() string {
+	ep := c.op.endpoint
+	if ep == "" {
+		ep = os.Getenv(EndpointEnvKey)
+	}
+	if ep == "" {
+		ep = defaultEndpoint
+	}
+	return strings.TrimSuffix(ep, "/")
+}
+
+// Returns the cached session token, or fetches a new one if expired.
+func (c *Client) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Add(tokenRefreshMargin).Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.endpoint()+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", strconv.Itoa(int(c.op.tokenTTL.Seconds())))
+
+	resp, err := c.op.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch token (status code %d)", resp.StatusCode)
+	}
+
+	c.token = string(b)
+	c.tokenExpiry = time.Now().Add(c.op.tokenTTL)
+	return c.token, nil
+}
+
+// Invalidates the cached session token, so the next call fetches a new one.
+func (c *Client) invalidateToken() {
+	c.mu.Lock()
+	c.token = ""
+	c.mu.Unlock()
+}
+
+// Fetches the "meta-data" path (e.g., "instance-id").
+// Returns "ErrNotFound" if the path is not present.
+func (c *Client) GetMetadata(ctx context.Context, path string) (string, error) {
+	path = strings.TrimPrefix(path, "/latest/meta-data/")
+	path = strings.TrimPrefix(path, "/")
+	return c.get(ctx, "/latest/meta-data/"+path)
+}
+
+// Fetches the "dynamic" path (e.g., "instance-identity/document").
+// Returns "ErrNotFound" if the path is not present.
+func (c *Client) GetDynamic(ctx context.Context, path string) (string, error) {
+	path = strings.TrimPrefix(path, "/latest/dynamic/")
+	path = strings.TrimPrefix(path, "/")
+	return c.get(ctx, "/latest/dynamic/"+path)
+}
+
+// Fetches the path, and retries once with a new token if the cached token is rejected
+// (e.g., the token was issued before the instance stop/start).
+func (c *Client) get(ctx context.Context, path string) (string, error) {
+	uri := c.endpoint() + path
+	logutil.S().Infow("fetching meta-data", "uri", uri)
+
+	for i := 0; ; i++ {
+		token, err := c.Token(ctx)
+		if err != nil {
+			return "", err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+
+		resp, err := c.op.httpClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return string(b), nil
+		case http.StatusNotFound:
+			return "", fmt.Errorf("failed to fetch %q: %w", uri, ErrNotFound)
+		case http.StatusUnauthorized:
+			c.invalidateToken()
+			if i == 0 {
+				continue
+			}
+		}
+		return "", fmt.Errorf("failed to fetch %q (status code %d)", uri, resp.StatusCode)
+	}
+}
+
+// Fetches the instance ID.
+func (c *Client) InstanceID(ctx context.Context) (string, error) {
+	return c.GetMetadata(ctx, "instance-id")
+}
+
+// Fetches the instance type (e.g., "c5.xlarge").
+func (c *Client) InstanceType(ctx context.Context) (string, error) {
+	return c.GetMetadata(ctx, "instance-type")
+}
+
+// Fetches the availability zone (e.g., "us-east-1a").
+func (c *Client) AvailabilityZone(ctx context.Context) (string, error) {
+	return c.GetMetadata(ctx, "placement/availability-zone")
+}
+
+// Fetches the region, falling back to the availability zone without the zone letter
+// if "placement/region" is not served.
+func (c *Client) Region(ctx context.Context) (string, error) {
+	region, err := c.GetMetadata(ctx, "placement/region")
+	if err == nil && region != "" {
+		return region, nil
+	}
+
+	az, err := c.AvailabilityZone(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(az) < 2 {
+		return "", fmt.Errorf("unexpected availability zone %q", az)
+	}
+	return az[:len(az)-1], nil
+}
+
+// Fetches the private IPv4 address.
+func (c *Client) LocalIPv4(ctx context.Context) (string, error) {
+	return c.GetMetadata(ctx, "local-ipv4")
+}
+
+// Fetches the public IPv4 address.
+// Returns "ErrNotFound" if the instance has no public IPv4 address.
+func (c *Client) PublicIPv4(ctx context.Context) (string, error) {
+	return c.GetMetadata(ctx, "public-ipv4")
+}
+
+// Fetches the MAC addresses of the network interfaces attached to the instance.
+func (c *Client) MACs(ctx context.Context) ([]string, error) {
+	s, err := c.GetMetadata(ctx, "network/interfaces/macs/")
+	if err != nil {
+		return nil, err
+	}
+	return splitListing(s), nil
+}
+
+// Fetches the name of the IAM role attached to the instance.
+// Returns "ErrNotFound" if the instance has no instance profile.
+func (c *Client) IAMRoleName(ctx context.Context) (string, error) {
+	s, err := c.GetMetadata(ctx, "iam/security-credentials/")
+	if err != nil {
+		return "", err
+	}
+	roles := splitListing(s)
+	if len(roles) == 0 {
+		return "", fmt.Errorf("no IAM role: %w", ErrNotFound)
+	}
+	return roles[0], nil
+}
+
+// Fetches and parses the instance identity document.
+// Use "InstanceIdentityDocumentSigned" to verify the document was signed by AWS.
+func (c *Client) InstanceIdentityDocument(ctx context.Context) (InstanceIdentityDocument, error) {
+	s, err := c.GetDynamic(ctx, "instance-identity/document")
+	if err != nil {
+		return InstanceIdentityDocument{}, err
+	}
+	return ParseInstanceIdentityDocument([]byte(s))
+}
+
+// Fetches the instance identity document with its RSA signature, and verifies the signature
+// with the AWS public certificate in PEM for the region.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/regions-certs.html
+func (c *Client) InstanceIdentityDocumentSigned(ctx context.Context, certPEM []byte) (InstanceIdentityDocument, error) {
+	doc, err := c.GetDynamic(ctx, "instance-identity/document")
+	if err != nil {
+		return InstanceIdentityDocument{}, err
+	}
+	sig, err := c.GetDynamic(ctx, "instance-identity/signature")
+	if err != nil {
+		return InstanceIdentityDocument{}, err
+	}
+	if err = VerifyInstanceIdentitySignature([]byte(doc), sig, certPEM); err != nil {
+		return InstanceIdentityDocument{}, err
+	}
+	return ParseInstanceIdentityDocument([]byte(doc))
+}
+
+// Represents the instance identity document.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
+type InstanceIdentityDocument struct {
+	AccountID        string    `json:"accountId"`
+	Architecture     string    `json:"architecture"`
+	AvailabilityZone string    `json:"availabilityZone"`
+	ImageID          string    `json:"imageId"`
+	InstanceID       string    `json:"instanceId"`
+	InstanceType     string    `json:"instanceType"`
+	KernelID         string    `json:"kernelId,omitempty"`
+	PendingTime      time.Time `json:"pendingTime"`
+	PrivateIP        string    `json:"privateIp"`
+	RamdiskID        string    `json:"ramdiskId,omitempty"`
+	Region           string    `json:"region"`
+	Version          string    `json:"version"`
+}
+
+// Parses the instance identity document.
+func ParseInstanceIdentityDocument(b []byte) (InstanceIdentityDocument, error) {
+	var doc InstanceIdentityDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return InstanceIdentityDocument{}, err
+	}
+	if doc.InstanceID == "" || doc.Region == "" {
+		return InstanceIdentityDocument{}, fmt.Errorf("invalid instance identity document %q", string(b))
+	}
+	return doc, nil
+}
+
+// Returned when the instance identity document signature does not match.
+var ErrInvalidSignature = errors.New("invalid instance identity document signature")
+
+// Verifies the base64-encoded RSA SHA-256 signature ("instance-identity/signature")
+// of the instance identity document, with the AWS public certificate in PEM for the region.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/verify-signature.html
+func VerifyInstanceIdentitySignature(doc []byte, sigB64 string, certPEM []byte) error {
+	blk, _ := pem.Decode(certPEM)
+	if blk == nil {
+		return errors.New("failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(blk.Bytes)
+	if err != nil {
+		return err
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unexpected certificate public key type %T", cert.PublicKey)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(sigB64), ""))
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(doc)
+	if err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+		return fmt.Errorf("%w (%v)", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+// Splits the metadata listing by lines, without the trailing slashes of the subpaths.
+func splitListing(s string) []string {
+	ss := make([]string, 0)
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSuffix(strings.TrimSpace(line), "/")
+		if line != "" {
+			ss = append(ss, line)
+		}
+	}
+	return ss
+}
@@ -0,0 +1,126 @@
+package metadata
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2/metadata/metadatatest"
+)
+
+func TestClient(t *testing.T) {
+	srv := metadatatest.NewServer()
+	defer srv.Close()
+	srv.DeleteMetadata("placement/region")
+	srv.SetMetadata("placement/availability-zone", "us-west-2a")
+	srv.SetMetadata("network/interfaces/macs/0a:00:00:00:00:01/device-number", "0")
+	srv.SetMetadata("network/interfaces/macs/0a:00:00:00:00:02/device-number", "1")
+	srv.SetMetadata("iam/security-credentials/my-role", "{}")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := New(WithEndpoint(srv.URL()))
+	id, err := cli.InstanceID(ctx)
+	if err != nil || id != metadatatest.DefaultMetadata["instance-id"] {
+		t.Fatalf("unexpected instance ID %q (%v)", id, err)
+	}
+	region, err := cli.Region(ctx)
+	if err != nil || region != "us-west-2" {
+		t.Fatalf("unexpected region %q (%v)", region, err)
+	}
+	if n := srv.TokenRequests(); n != 1 {
+		t.Fatalf("expected the cached token, got %d token requests", n)
+	}
+
+	// as if the instance was stopped and started
+	srv.ExpireTokens()
+	macs, err := cli.MACs(ctx)
+	if err != nil || len(macs) != 2 || macs[1] != "0a:00:00:00:00:02" {
+		t.Fatalf("unexpected MACs %v (%v)", macs, err)
+	}
+	if n := srv.TokenRequests(); n != 2 {
+		t.Fatalf("expected the token refresh on 401, got %d token requests", n)
+	}
+
+	role, err := cli.IAMRoleName(ctx)
+	if err != nil || role != "my-role" {
+		t.Fatalf("unexpected role %q (%v)", role, err)
+	}
+	if _, err = cli.PublicIPv4(ctx); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDefaultClientEndpoint(t *testing.T) {
+	srv := metadatatest.Start(t)
+	srv.SetMetadata("instance-id", "i-fake")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	id, err := FetchInstanceID(ctx)
+	if err != nil || id != "i-fake" {
+		t.Fatalf("unexpected instance ID %q (%v)", id, err)
+	}
+}
+
+func TestInstanceIdentityDocument(t *testing.T) {
+	doc := []byte(`{
+  "accountId" : "123456789012",
+  "architecture" : "x86_64",
+  "availabilityZone" : "us-west-2b",
+  "imageId" : "ami-5fb8c835",
+  "instanceId" : "i-1234567890abcdef0",
+  "instanceType" : "t2.micro",
+  "pendingTime" : "2016-11-19T16:32:11Z",
+  "privateIp" : "10.158.112.84",
+  "region" : "us-west-2",
+  "version" : "2017-09-30"
+}`)
+	parsed, err := ParseInstanceIdentityDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.AccountID != "123456789012" || parsed.Region != "us-west-2" || parsed.PendingTime.IsZero() {
+		t.Fatalf("unexpected document %+v", parsed)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	digest := sha256.Sum256(doc)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigB64 := base64.StdEncoding.EncodeToString(sig)
+	if err = VerifyInstanceIdentitySignature(doc, sigB64[:40]+"\n"+sigB64[40:], certPEM); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyInstanceIdentitySignature(append(doc, ' '), sigB64, certPEM); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+)
+
+// Represents the instance action.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/spot-instance-termination-notices.html#instance-action-metadata
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
+type InstanceAction struct {
+	Action string `json:"action"`
+
+	// Time in RFC339 format in UTC.
+	Time time.Time `json:"time"`
+}
+
+// Represents the rebalance recommendation, which is sent before the interruption notice
+// when the spot instance is at an elevated risk of interruption.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/rebalance-recommendations.html
+type RebalanceRecommendation struct {
+	NoticeTime time.Time `json:"noticeTime"`
+}
+
+// Fetches the spot instance action.
+// Returns "ErrNotFound" if the instance is not being interrupted.
+func (c *Client) SpotInstanceAction(ctx context.Context) (InstanceAction, error) {
+	s, err := c.GetMetadata(ctx, "spot/instance-action")
+	if err != nil {
+		return InstanceAction{}, err
+	}
+	action := InstanceAction{}
+	if err := json.Unmarshal([]byte(s), &action); err != nil {
+		return InstanceAction{}, err
+	}
+	return action, nil
+}
+
+// Fetches the rebalance recommendation.
+// Returns "ErrNotFound" if the recommendation is not present.
+func (c *Client) RebalanceRecommendation(ctx context.Context) (RebalanceRecommendation, error) {
+	s, err := c.GetMetadata(ctx, "events/recommendations/rebalance")
+	if err != nil {
+		return RebalanceRecommendation{}, err
+	}
+	rec := RebalanceRecommendation{}
+	if err := json.Unmarshal([]byte(s), &rec); err != nil {
+		return RebalanceRecommendation{}, err
+	}
+	return rec, nil
+}
+
+// Fetches the target lifecycle state of the instance in the ASG.
+// Returns "ErrNotFound" if the instance is not in any ASG.
+func (c *Client) TargetLifecycleState(ctx context.Context) (string, error) {
+	return c.GetMetadata(ctx, "autoscaling/target-lifecycle-state")
+}
+
+type EventType string
+
+const (
+	EventTypeRebalanceRecommendation EventType = "rebalance-recommendation"
+	EventTypeInterruption            EventType = "interruption"
+	EventTypeTargetLifecycleState    EventType = "target-lifecycle-state"
+)
+
+// Represents the instance event observed from the instance metadata.
+type Event struct {
+	Type EventType `json:"type"`
+	// Action of the interruption (e.g., "terminate", "stop", "hibernate").
+	Action string `json:"action,omitempty"`
+	// Target lifecycle state in the ASG (e.g., "InService", "Terminated").
+	State string `json:"state,omitempty"`
+	// Notice time of the rebalance recommendation, the time of the interruption action,
+	// or the time the lifecycle state change was observed.
+	Time time.Time `json:"time"`
+}
+
+const defaultEventInterval = 5 * time.Second
+
+// Sets the default poll interval for the events (default 5 seconds).
+func WithInterval(v time.Duration) OpOption {
+	return func(op *Op) {
+		op.interval = v
+	}
+}
+
+// Sets the poll interval for the event type, overriding "WithInterval"
+// (e.g., poll the lifecycle state less often than the spot interruption notice).
+func WithEventInterval(typ EventType, v time.Duration) OpOption {
+	return func(op *Op) {
+		if op.eventIntervals == nil {
+			op.eventIntervals = make(map[EventType]time.Duration)
+		}
+		op.eventIntervals[typ] = v
+	}
+}
+
+// Sets the event types to watch (default all).
+func WithEventTypes(types ...EventType) OpOption {
+	return func(op *Op) {
+		op.eventTypes = types
+	}
+}
+
+// Watches the instance metadata for the spot rebalance recommendations, interruption notices,
+// and ASG target lifecycle state changes with the default client.
+// See "Client.WatchEvents" for the details.
+func WatchEvents(ctx context.Context, opts ...OpOption) <-chan Event {
+	return defaultClient.WatchEvents(ctx, opts...)
+}
+
+// Watches the instance metadata for the events, polling each endpoint with its interval,
+// and sends each new event once (the same event observed again is deduplicated).
+// The endpoints not present (e.g., no interruption yet, or the instance not in any ASG) are skipped.
+// The channel is closed when the context is done.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/spot-instance-termination-notices.html
+// ref. https://docs.aws.amazon.com/autoscaling/ec2/userguide/retrieving-target-lifecycle-state-through-imds.html
+func (c *Client) WatchEvents(ctx context.Context, opts ...OpOption) <-chan Event {
+	ret := &Op{interval: defaultEventInterval}
+	ret.applyOpts(opts)
+	types := ret.eventTypes
+	if len(types) == 0 {
+		types = []EventType{EventTypeRebalanceRecommendation, EventTypeInterruption, EventTypeTargetLifecycleState}
+	}
+
+	ch := make(chan Event, 10)
+	var wg sync.WaitGroup
+	for _, typ := range types {
+		interval := ret.interval
+		if v, ok := ret.eventIntervals[typ]; ok {
+			interval = v
+		}
+		wg.Add(1)
+		go func(typ EventType, interval time.Duration) {
+			defer wg.Done()
+			c.pollEvents(ctx, typ, interval, ch)
+		}(typ, interval)
+	}
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
+
+func (c *Client) pollEvents(ctx context.Context, typ EventType, interval time.Duration, ch chan<- Event) {
+	var last Event
+	for {
+		ev, err := c.fetchEvent(ctx, typ)
+		switch {
+		case err == nil:
+			if !sameEvent(last, ev) {
+				last = ev
+				logutil.S().Warnw("received instance event", "type", ev.Type, "action", ev.Action, "state", ev.State, "time", ev.Time)
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- ev:
+				}
+			}
+		case !errors.Is(err, ErrNotFound) && ctx.Err() == nil:
+			logutil.S().Warnw("failed to fetch instance event", "type", typ, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (c *Client) fetchEvent(ctx context.Context, typ EventType) (Event, error) {
+	switch typ {
+	case EventTypeRebalanceRecommendation:
+		rec, err := c.RebalanceRecommendation(ctx)
+		if err != nil {
+			return Event{}, err
+		}
+		return Event{Type: typ, Time: rec.NoticeTime}, nil
+
+	case EventTypeInterruption:
+		action, err := c.SpotInstanceAction(ctx)
+		if err != nil {
+			return Event{}, err
+		}
+		return Event{Type: typ, Action: action.Action, Time: action.Time}, nil
+
+	case EventTypeTargetLifecycleState:
+		state, err := c.TargetLifecycleState(ctx)
+		if err != nil {
+			return Event{}, err
+		}
+		return Event{Type: typ, State: state, Time: time.Now().UTC()}, nil
+
+	default:
+		return Event{}, errors.New("unknown event type " + string(typ))
+	}
+}
+
+// Returns true if the events are the same, ignoring the observed time of the lifecycle state.
+func sameEvent(a, b Event) bool {
+	if a.Type != b.Type {
+		return false
+	}
+	if a.Type == EventTypeTargetLifecycleState {
+		return a.State == b.State
+	}
+	return a == b
+}
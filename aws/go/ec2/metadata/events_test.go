@@ -0,0 +1,88 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchEvents(t *testing.T) {
+	var polls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			w.Write([]byte("token"))
+		case "/latest/meta-data/autoscaling/target-lifecycle-state":
+			// the same state is polled several times before the change
+			if polls.Add(1) < 5 {
+				w.Write([]byte("InService"))
+			} else {
+				w.Write([]byte("Terminated"))
+			}
+		case "/latest/meta-data/spot/instance-action":
+			w.Write([]byte(`{"action": "terminate", "time": "2023-09-18T08:22:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := New(WithEndpoint(srv.URL))
+	evs := cli.WatchEvents(ctx,
+		WithInterval(10*time.Millisecond),
+		WithEventInterval(EventTypeInterruption, time.Millisecond),
+	)
+
+	var states []string
+	var interruptions int
+	for ev := range evs {
+		switch ev.Type {
+		case EventTypeTargetLifecycleState:
+			states = append(states, ev.State)
+		case EventTypeInterruption:
+			interruptions++
+			if ev.Action != "terminate" {
+				t.Fatalf("unexpected action %q", ev.Action)
+			}
+		case EventTypeRebalanceRecommendation:
+			t.Fatalf("unexpected event %+v", ev)
+		}
+		if len(states) == 2 {
+			break
+		}
+	}
+	cancel()
+	for ev := range evs {
+		if ev.Type == EventTypeInterruption {
+			interruptions++
+		}
+	}
+
+	if len(states) != 2 || states[0] != "InService" || states[1] != "Terminated" {
+		t.Fatalf("unexpected states %v", states)
+	}
+	if interruptions != 1 {
+		t.Fatalf("expected the deduplicated interruption, got %d", interruptions)
+	}
+}
+
+func TestSameEvent(t *testing.T) {
+	a := Event{Type: EventTypeTargetLifecycleState, State: "InService", Time: time.Now()}
+	b := Event{Type: EventTypeTargetLifecycleState, State: "InService", Time: time.Now().Add(time.Second)}
+	if !sameEvent(a, b) {
+		t.Fatal("expected the same lifecycle state event")
+	}
+	b.State = "Terminated"
+	if sameEvent(a, b) {
+		t.Fatal("expected the different lifecycle state event")
+	}
+	if sameEvent(Event{Type: EventTypeInterruption, Action: "stop"}, Event{Type: EventTypeInterruption, Action: "terminate"}) {
+		t.Fatal("expected the different interruption event")
+	}
+}
@@ -0,0 +1,165 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Represents the network interface attached to the instance, from the instance metadata.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
+type Interface struct {
+	MAC         string `json:"mac"`
+	DeviceIndex int32  `json:"device_index"`
+	InterfaceID string `json:"interface_id"`
+
+	SubnetID   string `json:"subnet_id"`
+	SubnetCIDR string `json:"subnet_cidr"`
+	VPCID      string `json:"vpc_id"`
+
+	SecurityGroupIDs []string `json:"security_group_ids"`
+
+	// Private IPv4 addresses on the interface, the primary first.
+	PrivateIPs []string `json:"private_ips"`
+	// Public IPv4 addresses (including the EIPs) associated with the interface.
+	PublicIPs []string `json:"public_ips,omitempty"`
+	IPv6s     []string `json:"ipv6s,omitempty"`
+}
+
+// Returns the primary private IPv4 address of the interface.
+func (iface Interface) PrimaryPrivateIP() string {
+	if len(iface.PrivateIPs) == 0 {
+		return ""
+	}
+	return iface.PrivateIPs[0]
+}
+
+// Returns true if the private IPv4 address is on the interface (e.g., the secondary private IP).
+func (iface Interface) HasPrivateIP(ip string) bool {
+	for _, v := range iface.PrivateIPs {
+		if v == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// Returned when no interface is attached with the MAC address or the device index.
+var ErrInterfaceNotFound = errors.New("network interface not found")
+
+// Lists the MAC addresses of the network interfaces attached to the host EC2 machine.
+func ListMACs(ctx context.Context) ([]string, error) {
+	return defaultClient.MACs(ctx)
+}
+
+// Fetches the network interface attached to the host EC2 machine by the MAC address.
+func GetInterfaceByMAC(ctx context.Context, mac string) (Interface, error) {
+	return defaultClient.InterfaceByMAC(ctx, mac)
+}
+
+// Lists the network interfaces attached to the host EC2 machine, sorted by the device index.
+func ListInterfaces(ctx context.Context) ([]Interface, error) {
+	return defaultClient.Interfaces(ctx)
+}
+
+// Fetches the network interface attached to the host EC2 machine by the device index
+// (0 for the primary interface).
+func GetInterfaceByDeviceIndex(ctx context.Context, idx int32) (Interface, error) {
+	return defaultClient.InterfaceByDeviceIndex(ctx, idx)
+}
+
+// Fetches the network interface by the MAC address.
+// The optional fields not present (e.g., no public IPv4 address) are left empty.
+func (c *Client) InterfaceByMAC(ctx context.Context, mac string) (Interface, error) {
+	prefix := "network/interfaces/macs/" + mac + "/"
+	get := func(key string, optional bool) (string, error) {
+		s, err := c.GetMetadata(ctx, prefix+key)
+		if err != nil && optional && errors.Is(err, ErrNotFound) {
+			return "", nil
+		}
+		return strings.TrimSpace(s), err
+	}
+
+	iface := Interface{MAC: mac}
+	idx, err := get("device-number", false)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Interface{}, fmt.Errorf("%w (mac %q)", ErrInterfaceNotFound, mac)
+		}
+		return Interface{}, err
+	}
+	n, err := strconv.ParseInt(idx, 10, 32)
+	if err != nil {
+		return Interface{}, fmt.Errorf("invalid device number %q (%w)", idx, err)
+	}
+	iface.DeviceIndex = int32(n)
+
+	for _, f := range []struct {
+		key      string
+		optional bool
+		dst      *string
+	}{
+		{key: "interface-id", dst: &iface.InterfaceID},
+		{key: "subnet-id", dst: &iface.SubnetID},
+		{key: "subnet-ipv4-cidr-block", dst: &iface.SubnetCIDR},
+		{key: "vpc-id", dst: &iface.VPCID},
+	} {
+		if *f.dst, err = get(f.key, f.optional); err != nil {
+			return Interface{}, err
+		}
+	}
+	for _, f := range []struct {
+		key      string
+		optional bool
+		dst      *[]string
+	}{
+		{key: "security-group-ids", optional: true, dst: &iface.SecurityGroupIDs},
+		{key: "local-ipv4s", dst: &iface.PrivateIPs},
+		{key: "public-ipv4s", optional: true, dst: &iface.PublicIPs},
+		{key: "ipv6s", optional: true, dst: &iface.IPv6s},
+	} {
+		s, err := get(f.key, f.optional)
+		if err != nil {
+			return Interface{}, err
+		}
+		*f.dst = splitListing(s)
+	}
+	return iface, nil
+}
+
+// Lists the network interfaces, sorted by the device index.
+func (c *Client) Interfaces(ctx context.Context) ([]Interface, error) {
+	macs, err := c.MACs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ifaces := make([]Interface, 0, len(macs))
+	for _, mac := range macs {
+		iface, err := c.InterfaceByMAC(ctx, mac)
+		if err != nil {
+			return nil, err
+		}
+		ifaces = append(ifaces, iface)
+	}
+	sort.SliceStable(ifaces, func(i, j int) bool {
+		return ifaces[i].DeviceIndex < ifaces[j].DeviceIndex
+	})
+	return ifaces, nil
+}
+
+// Fetches the network interface by the device index.
+func (c *Client) InterfaceByDeviceIndex(ctx context.Context, idx int32) (Interface, error) {
+	ifaces, err := c.Interfaces(ctx)
+	if err != nil {
+		return Interface{}, err
+	}
+	for _, iface := range ifaces {
+		if iface.DeviceIndex == idx {
+			return iface, nil
+		}
+	}
+	return Interface{}, fmt.Errorf("%w (device index %d)", ErrInterfaceNotFound, idx)
+}
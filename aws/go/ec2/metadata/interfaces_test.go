@@ -0,0 +1,65 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2/metadata/metadatatest"
+)
+
+func TestInterfaces(t *testing.T) {
+	data := map[string]string{
+		"network/interfaces/macs/0a:00:00:00:00:01/device-number":          "0",
+		"network/interfaces/macs/0a:00:00:00:00:01/interface-id":           "eni-1",
+		"network/interfaces/macs/0a:00:00:00:00:01/subnet-id":              "subnet-1",
+		"network/interfaces/macs/0a:00:00:00:00:01/subnet-ipv4-cidr-block": "10.0.0.0/24",
+		"network/interfaces/macs/0a:00:00:00:00:01/vpc-id":                 "vpc-1",
+		"network/interfaces/macs/0a:00:00:00:00:01/security-group-ids":     "sg-1\nsg-2",
+		"network/interfaces/macs/0a:00:00:00:00:01/local-ipv4s":            "10.0.0.10\n10.0.0.11",
+		"network/interfaces/macs/0a:00:00:00:00:01/public-ipv4s":           "1.2.3.4",
+
+		"network/interfaces/macs/0a:00:00:00:00:02/device-number":          "1",
+		"network/interfaces/macs/0a:00:00:00:00:02/interface-id":           "eni-2",
+		"network/interfaces/macs/0a:00:00:00:00:02/subnet-id":              "subnet-2",
+		"network/interfaces/macs/0a:00:00:00:00:02/subnet-ipv4-cidr-block": "10.0.1.0/24",
+		"network/interfaces/macs/0a:00:00:00:00:02/vpc-id":                 "vpc-1",
+		"network/interfaces/macs/0a:00:00:00:00:02/local-ipv4s":            "10.0.1.10",
+	}
+	srv := metadatatest.NewServer()
+	defer srv.Close()
+	for k, v := range data {
+		srv.SetMetadata(k, v)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cli := New(WithEndpoint(srv.URL()))
+
+	ifaces, err := cli.Interfaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ifaces) != 2 || ifaces[0].InterfaceID != "eni-1" || ifaces[1].DeviceIndex != 1 {
+		t.Fatalf("unexpected interfaces %+v", ifaces)
+	}
+	primary := ifaces[0]
+	if primary.PrimaryPrivateIP() != "10.0.0.10" || !primary.HasPrivateIP("10.0.0.11") || len(primary.SecurityGroupIDs) != 2 || primary.PublicIPs[0] != "1.2.3.4" {
+		t.Fatalf("unexpected primary interface %+v", primary)
+	}
+	if len(ifaces[1].PublicIPs) != 0 || len(ifaces[1].SecurityGroupIDs) != 0 || ifaces[1].SubnetCIDR != "10.0.1.0/24" {
+		t.Fatalf("unexpected secondary interface %+v", ifaces[1])
+	}
+
+	iface, err := cli.InterfaceByDeviceIndex(ctx, 1)
+	if err != nil || iface.MAC != "0a:00:00:00:00:02" {
+		t.Fatalf("unexpected interface %+v (%v)", iface, err)
+	}
+	if _, err = cli.InterfaceByDeviceIndex(ctx, 2); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Fatalf("expected ErrInterfaceNotFound, got %v", err)
+	}
+	if _, err = cli.InterfaceByMAC(ctx, "0a:00:00:00:00:03"); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Fatalf("expected ErrInterfaceNotFound, got %v", err)
+	}
+}
@@ -2,14 +2,8 @@ package metadata
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"strings"
+	"errors"
 	"time"
-
-	"github.com/gyuho/infra/go/logutil"
 )
 
 // Serves session token for instance metadata service v2.
@@ -18,62 +12,24 @@ import (
 // e.g., curl -X PUT "http://169.254.169.254/latest/api/token" -H "X-aws-ec2-metadata-token-ttl-seconds: 21600"
 const IMDS_V2_SESSION_TOKEN_URI = "http://169.254.169.254/latest/api/token"
 
-// Fetches the IMDS v2 token.
+// Default client shared by the package-level functions, to reuse the session token.
+var defaultClient = New()
+
+// Fetches the IMDS v2 token, cached until it expires.
 func FetchToken(ctx context.Context) (string, error) {
-	req, err := http.NewRequest(http.MethodPut, IMDS_V2_SESSION_TOKEN_URI, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
-
-	cli := &http.Client{}
-	resp, err := cli.Do(req.WithContext(ctx))
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	return string(b), nil
+	return defaultClient.Token(ctx)
 }
 
+// Returned when the metadata path is not present (HTTP 404).
+var ErrNotFound = errors.New("metadata not found")
+
 // Fetches instance metadata service v2 with the "path".
 // ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
 // ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-retrieval.html
 // ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/configuring-instance-metadata-service.html
 // e.g., curl -H "X-aws-ec2-metadata-token: $TOKEN" -v http://169.254.169.254/latest/meta-data/public-ipv4
 func FetchPath(ctx context.Context, path string) (string, error) {
-	path = strings.TrimPrefix(path, "/latest/meta-data/")
-	path = strings.TrimPrefix(path, "/")
-	uri := fmt.Sprintf("http://169.254.169.254/latest/meta-data/%s", path)
-
-	logutil.S().Infow("fetching meta-data", "uri", uri)
-
-	token, err := FetchToken(ctx)
-	if err != nil {
-		return "", err
-	}
-	req, err := http.NewRequest(http.MethodGet, uri, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("X-aws-ec2-metadata-token", token)
-
-	cli := &http.Client{}
-	resp, err := cli.Do(req.WithContext(ctx))
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	return string(b), nil
+	return defaultClient.GetMetadata(ctx, path)
 }
 
 // Fetches the instance ID on the host EC2 machine.
@@ -94,6 +50,18 @@ func FetchPublicIPV4(ctx context.Context) (string, error) {
 	return FetchPath(ctx, "public-ipv4")
 }
 
+// Fetches the private IPv4 address of the host EC2 machine.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
+func FetchLocalIPV4(ctx context.Context) (string, error) {
+	return FetchPath(ctx, "local-ipv4")
+}
+
+// Fetches the IPv6 address of the primary network interface of the host EC2 machine.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
+func FetchIPV6(ctx context.Context) (string, error) {
+	return FetchPath(ctx, "ipv6")
+}
+
 // Fetches the availability of the host EC2 machine.
 // ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
 func FetchAvailabilityZone(ctx context.Context) (string, error) {
@@ -101,24 +69,37 @@ func FetchAvailabilityZone(ctx context.Context) (string, error) {
 }
 
 // Fetches the region of the host EC2 machine.
-// TODO: fix this...
+// Falls back to the availability zone without the zone letter,
+// if the IMDS does not serve "placement/region" (which is not correct for local zones).
 // ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
 func FetchRegion(ctx context.Context) (string, error) {
-	az, err := FetchAvailabilityZone(ctx)
-	if err != nil {
-		return "", err
-	}
-	return az[:len(az)-1], nil
+	return defaultClient.Region(ctx)
 }
 
-// Represents the instance action.
-// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/spot-instance-termination-notices.html#instance-action-metadata
+// Fetches the instance type of the host EC2 machine (e.g., "c5.xlarge").
 // ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
-type InstanceAction struct {
-	Action string `json:"action"`
+func FetchInstanceType(ctx context.Context) (string, error) {
+	return defaultClient.InstanceType(ctx)
+}
 
-	// Time in RFC339 format in UTC.
-	Time time.Time `json:"time"`
+// Fetches the name of the IAM role attached to the host EC2 machine.
+// Returns "ErrNotFound" if the instance has no instance profile.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
+func FetchIAMRoleName(ctx context.Context) (string, error) {
+	return defaultClient.IAMRoleName(ctx)
+}
+
+// Fetches the instance identity document of the host EC2 machine.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instance-identity-documents.html
+func FetchInstanceIdentityDocument(ctx context.Context) (InstanceIdentityDocument, error) {
+	return defaultClient.InstanceIdentityDocument(ctx)
+}
+
+// Fetches the target lifecycle state of the instance in the ASG (e.g., "InService", "Warmed:Stopped").
+// Returns "ErrNotFound" if the instance is not in any ASG.
+// ref. https://docs.aws.amazon.com/autoscaling/ec2/userguide/retrieving-target-lifecycle-state-through-imds.html
+func FetchTargetLifecycleState(ctx context.Context) (string, error) {
+	return defaultClient.TargetLifecycleState(ctx)
 }
 
 // Fetches the spot instance action.
@@ -129,13 +110,48 @@ type InstanceAction struct {
 // ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-data-categories.html
 // ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/prepare-for-interruptions.html
 func FetchSpotInstanceAction(ctx context.Context) (InstanceAction, error) {
-	s, err := FetchPath(ctx, "spot/instance-action")
-	if err != nil {
-		return InstanceAction{}, err
-	}
-	action := InstanceAction{}
-	if err := json.Unmarshal([]byte(s), &action); err != nil {
-		return InstanceAction{}, err
-	}
-	return action, nil
+	return defaultClient.SpotInstanceAction(ctx)
+}
+
+// Fetches the rebalance recommendation.
+// Returns "ErrNotFound" if the recommendation is not present.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/rebalance-recommendations.html#monitor-rebalance-recommendations
+func FetchRebalanceRecommendation(ctx context.Context) (RebalanceRecommendation, error) {
+	return defaultClient.RebalanceRecommendation(ctx)
+}
+
+type SpotEventType string
+
+const (
+	SpotEventTypeRebalanceRecommendation SpotEventType = "rebalance-recommendation"
+	SpotEventTypeInterruption            SpotEventType = "interruption"
+)
+
+// Represents the spot rebalance recommendation or the 2-minute interruption notice.
+type SpotEvent struct {
+	Type SpotEventType `json:"type"`
+	// Action of the interruption (e.g., "terminate", "stop", "hibernate"), empty for the rebalance recommendation.
+	Action string `json:"action,omitempty"`
+	// Notice time of the rebalance recommendation, or the time of the interruption action.
+	Time time.Time `json:"time"`
+}
+
+// Watches the instance metadata for the spot rebalance recommendations and interruption notices,
+// and sends each new event once. The channel is closed when the context is done.
+// The interruption notice is sent 2 minutes before the action, so the interval should be
+// much shorter (e.g., 5 seconds). See "WatchEvents" to also watch the ASG lifecycle state.
+func WatchSpotEvents(ctx context.Context, interval time.Duration) <-chan SpotEvent {
+	evs := WatchEvents(ctx, WithInterval(interval), WithEventTypes(EventTypeRebalanceRecommendation, EventTypeInterruption))
+	ch := make(chan SpotEvent, 10)
+	go func() {
+		defer close(ch)
+		for ev := range evs {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- SpotEvent{Type: SpotEventType(ev.Type), Action: ev.Action, Time: ev.Time}:
+			}
+		}
+	}()
+	return ch
 }
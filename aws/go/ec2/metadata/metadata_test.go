@@ -14,3 +14,14 @@ func TestMetadata(t *testing.T) {
 	}
 	fmt.Println(ia)
 }
+
+func TestRebalanceRecommendation(t *testing.T) {
+	b := `{"noticeTime": "2020-10-27T08:22:00Z"}`
+	rec := RebalanceRecommendation{}
+	if err := json.Unmarshal([]byte(b), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.NoticeTime.IsZero() {
+		t.Fatal("expected non-zero notice time")
+	}
+}
@@ -0,0 +1,191 @@
+// Package metadatatest implements the fake instance metadata service (IMDSv2) server for the tests.
+package metadatatest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Default metadata served by the new server.
+var DefaultMetadata = map[string]string{
+	"instance-id":                 "i-0123456789abcdef0",
+	"instance-type":               "c5.xlarge",
+	"local-ipv4":                  "10.0.0.10",
+	"placement/availability-zone": "us-east-1a",
+	"placement/region":            "us-east-1",
+}
+
+// Represents the in-process HTTP server emulating the instance metadata service v2,
+// with the session token flow and the configurable paths.
+type Server struct {
+	srv *httptest.Server
+
+	mu            sync.Mutex
+	paths         map[string]string
+	tokens        map[string]time.Time
+	tokenRequests int
+}
+
+// Starts the new fake server, serving "DefaultMetadata".
+func NewServer() *Server {
+	s := &Server{
+		paths:  make(map[string]string),
+		tokens: make(map[string]time.Time),
+	}
+	for k, v := range DefaultMetadata {
+		s.paths["meta-data/"+k] = v
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Starts the new fake server, and sets the endpoint environment variable for the test,
+// so the package-level functions (and the commands) in "metadata" call the fake server.
+// The server is closed when the test finishes.
+func Start(t testing.TB) *Server {
+	s := NewServer()
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", s.URL())
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Returns the endpoint URL of the server (e.g., "http://127.0.0.1:12345").
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Sets the "meta-data" path (e.g., "instance-id", "spot/instance-action").
+func (s *Server) SetMetadata(path string, value string) {
+	s.set("meta-data/"+strings.TrimPrefix(path, "/"), value)
+}
+
+// Deletes the "meta-data" path, so the server returns 404 for the path.
+func (s *Server) DeleteMetadata(path string) {
+	s.mu.Lock()
+	delete(s.paths, "meta-data/"+strings.TrimPrefix(path, "/"))
+	s.mu.Unlock()
+}
+
+// Sets the "dynamic" path (e.g., "instance-identity/document").
+func (s *Server) SetDynamic(path string, value string) {
+	s.set("dynamic/"+strings.TrimPrefix(path, "/"), value)
+}
+
+// Sets the user data.
+func (s *Server) SetUserData(b []byte) {
+	s.set("user-data", string(b))
+}
+
+func (s *Server) set(path string, value string) {
+	s.mu.Lock()
+	s.paths[path] = value
+	s.mu.Unlock()
+}
+
+// Expires all the issued tokens, so the next request with the cached token gets 401
+// (e.g., as if the instance was stopped and started).
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	s.tokens = make(map[string]time.Time)
+	s.mu.Unlock()
+}
+
+// Returns the number of the token requests served.
+func (s *Server) TokenRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenRequests
+}
+
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/configuring-instance-metadata-service.html
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/latest/")
+	if path == "api/token" {
+		s.serveToken(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry, ok := s.tokens[r.Header.Get("X-aws-ec2-metadata-token")]
+	if !ok || time.Now().After(expiry) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if v, ok := s.paths[path]; ok {
+		w.Write([]byte(v))
+		return
+	}
+	if strings.HasSuffix(path, "/") {
+		if children := s.listChildren(path); len(children) > 0 {
+			w.Write([]byte(strings.Join(children, "\n")))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ttl, err := strconv.Atoi(r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+	if err != nil || ttl < 1 || ttl > 21600 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	s.tokens[token] = time.Now().Add(time.Duration(ttl) * time.Second)
+	s.tokenRequests++
+	s.mu.Unlock()
+
+	w.Header().Set("X-aws-ec2-metadata-token-ttl-seconds", strconv.Itoa(ttl))
+	w.Write([]byte(token))
+}
+
+// Lists the direct children of the directory path, with the trailing slash for the subdirectories.
+func (s *Server) listChildren(dir string) []string {
+	seen := make(map[string]struct{})
+	for p := range s.paths {
+		rest, ok := strings.CutPrefix(p, dir)
+		if !ok || rest == "" {
+			continue
+		}
+		if i := strings.Index(rest, "/"); i >= 0 {
+			rest = rest[:i+1]
+		}
+		seen[rest] = struct{}{}
+	}
+	children := make([]string, 0, len(seen))
+	for c := range seen {
+		children = append(children, c)
+	}
+	sort.Strings(children)
+	return children
+}
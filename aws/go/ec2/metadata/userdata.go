@@ -0,0 +1,204 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// User data formats for "ParseUserData".
+const (
+	UserDataFormatEnv  = "env"
+	UserDataFormatYAML = "yaml"
+)
+
+// Sets the user data format ("env" or "yaml"), instead of detecting it.
+func WithUserDataFormat(v string) OpOption {
+	return func(op *Op) {
+		op.userDataFormat = v
+	}
+}
+
+// Sets the template variables to replace in the user data before parsing,
+// with each "{key}" replaced by its value (e.g., "{instance-id}").
+func WithVars(vars map[string]string) OpOption {
+	return func(op *Op) {
+		op.vars = vars
+	}
+}
+
+// Fetches the user data of the host EC2 machine with the default client.
+// See "Client.UserData" for the details.
+func FetchUserData(ctx context.Context) ([]byte, error) {
+	return defaultClient.UserData(ctx)
+}
+
+// Fetches the user data, decompressed if gzipped.
+// Returns "ErrNotFound" if the instance has no user data.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/instancedata-add-user-data.html
+func (c *Client) UserData(ctx context.Context) ([]byte, error) {
+	s, err := c.get(ctx, "/latest/user-data")
+	if err != nil {
+		return nil, err
+	}
+	b := []byte(s)
+	if len(b) > 2 && b[0] == 0x1f && b[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return b, nil
+}
+
+// Parses the user data into the value (e.g., the pointer to the struct with the json tags,
+// or to the map), so the commands can read the bootstrap parameters from the user data.
+//
+// The format is detected unless set by "WithUserDataFormat": the shell script ("#!") or
+// the lines of only "KEY=value" assignments are parsed as "env", otherwise as "yaml"
+// (e.g., "#cloud-config"). For "env", the lines other than the assignments are skipped,
+// "export" and the quotes are trimmed, and the values are typed as in YAML (e.g., "true", "30").
+// The keys match the json tags case-insensitively (e.g., "ASG_NAME" for `json:"asg_name"`).
+// Use "WithVars" to replace the template variables before parsing.
+func ParseUserData(b []byte, v interface{}, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	s := string(b)
+	for k, val := range ret.vars {
+		s = strings.ReplaceAll(s, "{"+k+"}", val)
+	}
+
+	format := ret.userDataFormat
+	if format == "" {
+		format = detectUserDataFormat(s)
+	}
+	switch format {
+	case UserDataFormatYAML:
+		return yaml.Unmarshal([]byte(s), v)
+	case UserDataFormatEnv:
+		vals, raws, err := parseEnvUserData(s)
+		if err != nil {
+			return err
+		}
+		// retry with the raw string for the string fields with the number-like (or bool-like) values
+		for {
+			jb, err := json.Marshal(vals)
+			if err != nil {
+				return err
+			}
+			err = json.Unmarshal(jb, v)
+			var terr *json.UnmarshalTypeError
+			if !errors.As(err, &terr) || terr.Type.Kind() != reflect.String {
+				return err
+			}
+			k, ok := findKeyFold(vals, terr.Field)
+			if !ok {
+				return err
+			}
+			if _, isString := vals[k].(string); isString {
+				return err
+			}
+			vals[k] = raws[k]
+		}
+	default:
+		return fmt.Errorf("unknown user data format %q", format)
+	}
+}
+
+func detectUserDataFormat(s string) string {
+	if strings.HasPrefix(s, "#!") {
+		return UserDataFormatEnv
+	}
+	lines := 0
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, ok := parseEnvLine(line); !ok {
+			return UserDataFormatYAML
+		}
+		lines++
+	}
+	if lines == 0 {
+		return UserDataFormatYAML
+	}
+	return UserDataFormatEnv
+}
+
+// Returns the typed values and the raw values by the keys.
+func parseEnvUserData(s string) (map[string]interface{}, map[string]string, error) {
+	vals := make(map[string]interface{})
+	raws := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, raw, ok := parseEnvLine(line)
+		if !ok {
+			continue
+		}
+		raws[k] = raw
+
+		// the quoted value is always a string, otherwise typed as in YAML
+		if len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') && raw[len(raw)-1] == raw[0] {
+			vals[k] = raw[1 : len(raw)-1]
+			continue
+		}
+		var typed interface{}
+		if err := yaml.Unmarshal([]byte(raw), &typed); err != nil || typed == nil {
+			typed = raw
+		}
+		switch typed.(type) {
+		case string, bool, float64, int64:
+		default:
+			// lists and maps are kept as the raw string
+			typed = raw
+		}
+		vals[k] = typed
+	}
+	return vals, raws, scanner.Err()
+}
+
+// Finds the key case-insensitively, as "encoding/json" matches the fields.
+func findKeyFold(vals map[string]interface{}, field string) (string, bool) {
+	if _, ok := vals[field]; ok {
+		return field, true
+	}
+	for k := range vals {
+		if strings.EqualFold(k, field) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// Parses the "KEY=value" (or "export KEY=value") line.
+func parseEnvLine(line string) (string, string, bool) {
+	line = strings.TrimPrefix(line, "export ")
+	k, v, ok := strings.Cut(line, "=")
+	if !ok || k == "" {
+		return "", "", false
+	}
+	for _, r := range k {
+		if !(r == '_' || r == '-' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return "", "", false
+		}
+	}
+	return k, strings.TrimSpace(v), true
+}
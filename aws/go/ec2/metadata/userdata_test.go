@@ -0,0 +1,84 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2/metadata/metadatatest"
+)
+
+type testBootstrap struct {
+	ASGName  string `json:"asg_name"`
+	IDTag    string `json:"id_tag"`
+	Replicas int    `json:"replicas"`
+	Daemon   bool   `json:"daemon"`
+	Name     string `json:"name"`
+}
+
+func TestParseUserData(t *testing.T) {
+	tt := []struct {
+		name     string
+		userData string
+		vars     map[string]string
+		expected testBootstrap
+	}{
+		{
+			name: "shell script",
+			userData: `#!/bin/bash
+set -xeu
+export ASG_NAME="my-asg"
+ID_TAG=123
+REPLICAS=3
+DAEMON=true
+echo "done"
+`,
+			expected: testBootstrap{ASGName: "my-asg", IDTag: "123", Replicas: 3, Daemon: true},
+		},
+		{
+			name:     "env",
+			userData: "# bootstrap\nasg_name=my-asg\nreplicas=5\nname=node-{instance-id}\n",
+			vars:     map[string]string{"instance-id": "i-123"},
+			expected: testBootstrap{ASGName: "my-asg", Replicas: 5, Name: "node-i-123"},
+		},
+		{
+			name:     "yaml",
+			userData: "#cloud-config\nasg_name: my-asg\nid_tag: \"7\"\nreplicas: 2\ndaemon: true\n",
+			expected: testBootstrap{ASGName: "my-asg", IDTag: "7", Replicas: 2, Daemon: true},
+		},
+	}
+	for _, tv := range tt {
+		t.Run(tv.name, func(t *testing.T) {
+			var b testBootstrap
+			if err := ParseUserData([]byte(tv.userData), &b, WithVars(tv.vars)); err != nil {
+				t.Fatal(err)
+			}
+			if b != tv.expected {
+				t.Fatalf("expected %+v, got %+v", tv.expected, b)
+			}
+		})
+	}
+}
+
+func TestFetchUserDataGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("REPLICAS=3\n"))
+	zw.Close()
+
+	srv := metadatatest.NewServer()
+	defer srv.Close()
+	srv.SetUserData(buf.Bytes())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	b, err := New(WithEndpoint(srv.URL())).UserData(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "REPLICAS=3\n" {
+		t.Fatalf("unexpected user data %q", string(b))
+	}
+}
@@ -8,20 +8,36 @@ import (
 
 type Op struct {
 	availabilityZone      string
+	backoff               float64
+	capacityReservationID string
+	customerOwnedIPv4Pool string
 	desc                  string
 	eniIDs                []string
 	filters               map[string][]string
+	force                 bool
+	idempotencyToken      string
 	instanceStates        map[aws_ec2_v2_types.InstanceStateName]struct{}
 	interval              time.Duration
+	keepLast              int
+	maxInterval           time.Duration
 	overwrite             bool
+	partitionCount        int32
+	privateIP             string
+	progressFunc          func(WaitProgress)
+	publicIPv4Pool        string
+	securityGroupIDs      []string
+	snapshotID            string
+	subnetID              string
 	tags                  map[string]string
 	volumeAttachmentState aws_ec2_v2_types.VolumeAttachmentState
 	volumeEncrypted       bool
 	volumeIOPS            int32
+	volumeKMSKeyID        string
 	volumeSizeInGB        int32
 	volumeState           aws_ec2_v2_types.VolumeState
 	volumeThroughput      int32
 	volumeType            string
+	wait                  bool
 	retryErrFunc          func(error) bool
 }
 
@@ -39,6 +55,27 @@ func WithAvailabilityZone(az string) OpOption {
 	}
 }
 
+// Sets the multiplier of the wait interval after each poll (e.g., 2 to double).
+func WithBackoff(v float64) OpOption {
+	return func(op *Op) {
+		op.backoff = v
+	}
+}
+
+// Sets the capacity reservation to target (e.g., to verify the instance placement).
+func WithCapacityReservationID(v string) OpOption {
+	return func(op *Op) {
+		op.capacityReservationID = v
+	}
+}
+
+// Sets the customer-owned IP (CoIP) pool on Outposts to allocate the EIP from.
+func WithCustomerOwnedIPv4Pool(v string) OpOption {
+	return func(op *Op) {
+		op.customerOwnedIPv4Pool = v
+	}
+}
+
 func WithDescription(v string) OpOption {
 	return func(op *Op) {
 		op.desc = v
@@ -57,6 +94,20 @@ func WithFilters(filters map[string][]string) OpOption {
 	}
 }
 
+// Forces the destructive operation (e.g., releasing the associated EIP).
+func WithForce(b bool) OpOption {
+	return func(op *Op) {
+		op.force = b
+	}
+}
+
+// Sets the caller-supplied token to make the allocation idempotent across retries.
+func WithIdempotencyToken(v string) OpOption {
+	return func(op *Op) {
+		op.idempotencyToken = v
+	}
+}
+
 func WithInstanceState(s aws_ec2_v2_types.InstanceStateName) OpOption {
 	return func(op *Op) {
 		if op.instanceStates == nil {
@@ -72,12 +123,76 @@ func WithInterval(v time.Duration) OpOption {
 	}
 }
 
+// Keeps the newest N resources (e.g., snapshots) regardless of the retention.
+func WithKeepLast(n int) OpOption {
+	return func(op *Op) {
+		op.keepLast = n
+	}
+}
+
+// Sets the upper bound of the wait interval with the backoff.
+func WithMaxInterval(v time.Duration) OpOption {
+	return func(op *Op) {
+		op.maxInterval = v
+	}
+}
+
 func WithOverwrite(b bool) OpOption {
 	return func(op *Op) {
 		op.overwrite = b
 	}
 }
 
+// Sets the number of partitions for the partition placement group.
+func WithPartitionCount(v int32) OpOption {
+	return func(op *Op) {
+		op.partitionCount = v
+	}
+}
+
+// Sets the private IP address on the ENI to associate the EIP with
+// (e.g., a secondary private IP for multi-IP NAT setups).
+func WithPrivateIP(v string) OpOption {
+	return func(op *Op) {
+		op.privateIP = v
+	}
+}
+
+// Sets the function called after each poll while waiting.
+func WithProgressFunc(f func(WaitProgress)) OpOption {
+	return func(op *Op) {
+		op.progressFunc = f
+	}
+}
+
+// Sets the BYOIP address pool to allocate the EIP from.
+func WithPublicIPv4Pool(v string) OpOption {
+	return func(op *Op) {
+		op.publicIPv4Pool = v
+	}
+}
+
+// Sets the security groups to create the ENI with, or to filter the ENIs by.
+func WithSecurityGroupIDs(ss []string) OpOption {
+	return func(op *Op) {
+		op.securityGroupIDs = ss
+	}
+}
+
+// Sets the snapshot to create the volume from.
+func WithSnapshotID(v string) OpOption {
+	return func(op *Op) {
+		op.snapshotID = v
+	}
+}
+
+// Sets the subnet to create the ENI in, or to filter the ENIs by.
+func WithSubnetID(v string) OpOption {
+	return func(op *Op) {
+		op.subnetID = v
+	}
+}
+
 func WithTags(m map[string]string) OpOption {
 	return func(op *Op) {
 		op.tags = m
@@ -96,6 +211,14 @@ func WithVolumeEncrypted(e bool) OpOption {
 	}
 }
 
+// Sets the KMS key (ID, ARN, or alias) to encrypt the volume with,
+// instead of the account default EBS key.
+func WithVolumeKMSKeyID(v string) OpOption {
+	return func(op *Op) {
+		op.volumeKMSKeyID = v
+	}
+}
+
 func WithVolumeSizeInGB(v int32) OpOption {
 	return func(op *Op) {
 		op.volumeSizeInGB = v
@@ -126,6 +249,13 @@ func WithVolumeAttachmentState(v aws_ec2_v2_types.VolumeAttachmentState) OpOptio
 	}
 }
 
+// Waits for the operation to complete (e.g., the instance state to be reached).
+func WithWait(b bool) OpOption {
+	return func(op *Op) {
+		op.wait = b
+	}
+}
+
 func WithRetryErrFunc(f func(error) bool) OpOption {
 	return func(op *Op) {
 		op.retryErrFunc = f
@@ -0,0 +1,93 @@
+package ec2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Represents the instance in the same ASG that published its EIPs
+// (e.g., the instance tag written by the aws-ip-provisioner).
+type Peer struct {
+	InstanceID       string `json:"instance_id"`
+	AvailabilityZone string `json:"availability_zone"`
+	PrivateIP        string `json:"private_ip"`
+	EIPs             EIPs   `json:"eips"`
+}
+
+type Peers []Peer
+
+func (ps Peers) String() string {
+	b, err := json.Marshal(ps)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+// Lists the running instances in the ASG that published their EIPs with the tag key,
+// sorted by the instance ID. The instances without the tag (e.g., still provisioning)
+// or with the malformed tag value are skipped.
+func ListASGPeerEIPs(ctx context.Context, cfg aws.Config, asgName string, publishTagKey string, opts ...OpOption) (Peers, error) {
+	instances, err := ListInstancesByASG(ctx, cfg, asgName, append(opts, WithFilters(map[string][]string{
+		"instance-state-name": {string(aws_ec2_v2_types.InstanceStateNameRunning)},
+	}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make(Peers, 0, len(instances))
+	for _, inst := range instances {
+		p, ok, err := toPeer(inst, publishTagKey)
+		if err != nil {
+			logutil.S().Warnw("skipping peer with malformed publish tag", "instanceID", p.InstanceID, "error", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	logutil.S().Infow("listed peers", "asg", asgName, "instances", len(instances), "peers", len(peers))
+	return peers, nil
+}
+
+// Waits until at least the number of peers in the ASG published their EIPs,
+// and returns the peers. Use "WithInterval" for the poll interval.
+func WaitForASGPeerEIPs(ctx context.Context, cfg aws.Config, asgName string, publishTagKey string, n int, opts ...OpOption) (Peers, error) {
+	var peers Peers
+	err := WaitUntil(ctx, fmt.Sprintf("%d peers in %s", n, asgName), func(ctx context.Context) (bool, string, error) {
+		var err error
+		peers, err = ListASGPeerEIPs(ctx, cfg, asgName, publishTagKey)
+		if err != nil {
+			return false, "", err
+		}
+		return len(peers) >= n, fmt.Sprintf("%d/%d peers", len(peers), n), nil
+	}, opts...)
+	return peers, err
+}
+
+// Returns false if the instance has no publish tag.
+func toPeer(inst aws_ec2_v2_types.Instance, publishTagKey string) (Peer, bool, error) {
+	p := Peer{
+		InstanceID: aws.ToString(inst.InstanceId),
+		PrivateIP:  aws.ToString(inst.PrivateIpAddress),
+	}
+	if inst.Placement != nil {
+		p.AvailabilityZone = aws.ToString(inst.Placement.AvailabilityZone)
+	}
+
+	v, ok := convertTagsToMap(inst.Tags)[publishTagKey]
+	if !ok || v == "" {
+		return p, false, nil
+	}
+	if err := json.Unmarshal([]byte(v), &p.EIPs); err != nil {
+		return p, false, err
+	}
+	return p, true, nil
+}
@@ -0,0 +1,36 @@
+package ec2
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestToPeer(t *testing.T) {
+	eips := EIPs{{AllocationID: "eipalloc-0", PublicIP: "1.2.3.4"}}
+	inst := aws_ec2_v2_types.Instance{
+		InstanceId:       aws.String("i-0"),
+		PrivateIpAddress: aws.String("10.0.0.1"),
+		Placement:        &aws_ec2_v2_types.Placement{AvailabilityZone: aws.String("us-west-2a")},
+		Tags: []aws_ec2_v2_types.Tag{
+			{Key: aws.String("AWS_IP_PROVISIONER_EIPS"), Value: aws.String(eips.Summary().String())},
+		},
+	}
+	p, ok, err := toPeer(inst, "AWS_IP_PROVISIONER_EIPS")
+	if err != nil || !ok {
+		t.Fatalf("unexpected ok %v, error %v", ok, err)
+	}
+	if p.InstanceID != "i-0" || p.PrivateIP != "10.0.0.1" || p.AvailabilityZone != "us-west-2a" || len(p.EIPs) != 1 || p.EIPs[0].PublicIP != "1.2.3.4" {
+		t.Fatalf("unexpected peer %+v", p)
+	}
+
+	if _, ok, err = toPeer(inst, "OTHER_KEY"); err != nil || ok {
+		t.Fatalf("unexpected ok %v, error %v", ok, err)
+	}
+
+	inst.Tags[0].Value = aws.String("not-json")
+	if _, _, err = toPeer(inst, "AWS_IP_PROVISIONER_EIPS"); err == nil {
+		t.Fatal("expected error for malformed tag value")
+	}
+}
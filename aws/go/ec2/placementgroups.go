@@ -0,0 +1,141 @@
+package ec2
+
+import (
+	"context"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type PlacementGroup struct {
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Strategy       string            `json:"strategy"`
+	PartitionCount int32             `json:"partition_count,omitempty"`
+	SpreadLevel    string            `json:"spread_level,omitempty"`
+	State          string            `json:"state"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+func convertPlacementGroup(raw aws_ec2_v2_types.PlacementGroup) PlacementGroup {
+	pg := PlacementGroup{
+		ID:             aws.ToString(raw.GroupId),
+		Name:           aws.ToString(raw.GroupName),
+		Strategy:       string(raw.Strategy),
+		PartitionCount: aws.ToInt32(raw.PartitionCount),
+		SpreadLevel:    string(raw.SpreadLevel),
+		State:          string(raw.State),
+	}
+	if len(raw.Tags) > 0 {
+		pg.Tags = make(map[string]string, len(raw.Tags))
+		for _, tg := range raw.Tags {
+			pg.Tags[aws.ToString(tg.Key)] = aws.ToString(tg.Value)
+		}
+	}
+	return pg
+}
+
+// Creates a placement group with the strategy (e.g., "cluster", "spread", "partition").
+// Use "WithPartitionCount" for the partition strategy, and "WithTags" for the tags.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/placement-groups.html
+func CreatePlacementGroup(ctx context.Context, cfg aws.Config, name string, strategy aws_ec2_v2_types.PlacementStrategy, opts ...OpOption) (PlacementGroup, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("creating a placement group", "name", name, "strategy", strategy, "partitionCount", ret.partitionCount)
+
+	input := &aws_ec2_v2.CreatePlacementGroupInput{
+		GroupName: aws.String(name),
+		Strategy:  strategy,
+		TagSpecifications: []aws_ec2_v2_types.TagSpecification{
+			{
+				ResourceType: aws_ec2_v2_types.ResourceTypePlacementGroup,
+				Tags:         ConvertTags(name, ret.tags),
+			},
+		},
+	}
+	if ret.partitionCount > 0 {
+		input.PartitionCount = aws.Int32(ret.partitionCount)
+	}
+
+	cli := newClient(cfg)
+	out, err := cli.CreatePlacementGroup(ctx, input)
+	if err != nil {
+		return PlacementGroup{}, err
+	}
+
+	pg := convertPlacementGroup(*out.PlacementGroup)
+	logutil.S().Infow("successfully created a placement group", "name", name, "id", pg.ID)
+	return pg, nil
+}
+
+// Lists the placement groups by filter (e.g., "strategy", "tag:Kind").
+func ListPlacementGroups(ctx context.Context, cfg aws.Config, opts ...OpOption) ([]PlacementGroup, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("listing placement groups", "filters", ret.filters)
+	cli := newClient(cfg)
+	out, err := cli.DescribePlacementGroups(ctx, &aws_ec2_v2.DescribePlacementGroupsInput{
+		Filters: convertFilters(ret.filters),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pgs := make([]PlacementGroup, 0, len(out.PlacementGroups))
+	for _, raw := range out.PlacementGroups {
+		pgs = append(pgs, convertPlacementGroup(raw))
+	}
+	logutil.S().Infow("listed placement groups", "placementGroups", len(pgs))
+	return pgs, nil
+}
+
+// Returns false if the placement group does not exist.
+func GetPlacementGroup(ctx context.Context, cfg aws.Config, name string) (PlacementGroup, bool, error) {
+	pgs, err := ListPlacementGroups(ctx, cfg, WithFilters(map[string][]string{"group-name": {name}}))
+	if err != nil {
+		return PlacementGroup{}, false, err
+	}
+	if len(pgs) != 1 {
+		return PlacementGroup{}, false, nil
+	}
+	return pgs[0], true, nil
+}
+
+// Deletes the placement group. Returns nil if it does not exist.
+// The placement group must not have any running instance.
+func DeletePlacementGroup(ctx context.Context, cfg aws.Config, name string) error {
+	logutil.S().Infow("deleting a placement group", "name", name)
+
+	cli := newClient(cfg)
+	_, err := cli.DeletePlacementGroup(ctx, &aws_ec2_v2.DeletePlacementGroupInput{
+		GroupName: aws.String(name),
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			logutil.S().Infow("placement group does not exist", "name", name)
+			return nil
+		}
+		return err
+	}
+
+	logutil.S().Infow("successfully deleted a placement group", "name", name)
+	return nil
+}
+
+// Returns the placement group name of the instance, and its partition number for the partition strategy.
+// Returns false if the instance is not in any placement group.
+func GetInstancePlacementGroup(ctx context.Context, cfg aws.Config, instanceID string) (string, int32, bool, error) {
+	inst, err := GetInstance(ctx, cfg, instanceID)
+	if err != nil {
+		return "", 0, false, err
+	}
+	if inst.Placement == nil || aws.ToString(inst.Placement.GroupName) == "" {
+		return "", 0, false, nil
+	}
+	return *inst.Placement.GroupName, aws.ToInt32(inst.Placement.PartitionNumber), true, nil
+}
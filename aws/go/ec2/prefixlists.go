@@ -0,0 +1,286 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Represents the customer-managed prefix list.
+// ref. https://docs.aws.amazon.com/vpc/latest/userguide/managed-prefix-lists.html
+type PrefixList struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	AddressFamily string            `json:"address_family"`
+	MaxEntries    int32             `json:"max_entries"`
+	Version       int64             `json:"version"`
+	State         string            `json:"state"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+type PrefixListEntry struct {
+	CIDR        string `json:"cidr"`
+	Description string `json:"description,omitempty"`
+}
+
+func convertPrefixList(raw aws_ec2_v2_types.ManagedPrefixList) PrefixList {
+	pl := PrefixList{
+		ID:            aws.ToString(raw.PrefixListId),
+		Name:          aws.ToString(raw.PrefixListName),
+		AddressFamily: aws.ToString(raw.AddressFamily),
+		MaxEntries:    aws.ToInt32(raw.MaxEntries),
+		Version:       aws.ToInt64(raw.Version),
+		State:         string(raw.State),
+	}
+	if len(raw.Tags) > 0 {
+		pl.Tags = make(map[string]string, len(raw.Tags))
+		for _, tg := range raw.Tags {
+			pl.Tags[aws.ToString(tg.Key)] = aws.ToString(tg.Value)
+		}
+	}
+	return pl
+}
+
+// Creates a prefix list with the address family ("IPv4" or "IPv6") and the maximum number of entries.
+// Use "WithTags" for the tags.
+func CreatePrefixList(ctx context.Context, cfg aws.Config, name string, addressFamily string, maxEntries int32, entries []PrefixListEntry, opts ...OpOption) (PrefixList, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("creating a prefix list", "name", name, "addressFamily", addressFamily, "maxEntries", maxEntries, "entries", len(entries))
+
+	cli := newClient(cfg)
+	out, err := cli.CreateManagedPrefixList(ctx, &aws_ec2_v2.CreateManagedPrefixListInput{
+		PrefixListName: aws.String(name),
+		AddressFamily:  aws.String(addressFamily),
+		MaxEntries:     aws.Int32(maxEntries),
+		Entries:        toAddPrefixListEntries(entries),
+		TagSpecifications: []aws_ec2_v2_types.TagSpecification{
+			{
+				ResourceType: aws_ec2_v2_types.ResourceTypePrefixList,
+				Tags:         ConvertTags(name, ret.tags),
+			},
+		},
+	})
+	if err != nil {
+		return PrefixList{}, err
+	}
+
+	pl := convertPrefixList(*out.PrefixList)
+	logutil.S().Infow("successfully created a prefix list", "name", name, "prefixListID", pl.ID)
+	return pl, nil
+}
+
+// Lists the prefix lists by filter (e.g., "prefix-list-name", "owner-id").
+func ListPrefixLists(ctx context.Context, cfg aws.Config, opts ...OpOption) ([]PrefixList, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cli := newClient(cfg)
+	pg := aws_ec2_v2.NewDescribeManagedPrefixListsPaginator(cli, &aws_ec2_v2.DescribeManagedPrefixListsInput{
+		Filters: convertFilters(ret.filters),
+	})
+	pls := make([]PrefixList, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range out.PrefixLists {
+			pls = append(pls, convertPrefixList(raw))
+		}
+	}
+	return pls, nil
+}
+
+// Fetches the prefix list by ID.
+func GetPrefixList(ctx context.Context, cfg aws.Config, prefixListID string) (PrefixList, error) {
+	cli := newClient(cfg)
+	out, err := cli.DescribeManagedPrefixLists(ctx, &aws_ec2_v2.DescribeManagedPrefixListsInput{
+		PrefixListIds: []string{prefixListID},
+	})
+	if err != nil {
+		return PrefixList{}, err
+	}
+	if len(out.PrefixLists) != 1 {
+		return PrefixList{}, fmt.Errorf("expected 1 prefix list, got %d", len(out.PrefixLists))
+	}
+	return convertPrefixList(out.PrefixLists[0]), nil
+}
+
+// Lists the entries of the current version of the prefix list.
+func ListPrefixListEntries(ctx context.Context, cfg aws.Config, prefixListID string) ([]PrefixListEntry, error) {
+	cli := newClient(cfg)
+	pg := aws_ec2_v2.NewGetManagedPrefixListEntriesPaginator(cli, &aws_ec2_v2.GetManagedPrefixListEntriesInput{
+		PrefixListId: aws.String(prefixListID),
+	})
+	entries := make([]PrefixListEntry, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range out.Entries {
+			entries = append(entries, PrefixListEntry{
+				CIDR:        aws.ToString(e.Cidr),
+				Description: aws.ToString(e.Description),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// Adds and removes the entries of the prefix list, based off the current version
+// (fails if the prefix list was modified since).
+// Returns the new version.
+func ModifyPrefixList(ctx context.Context, cfg aws.Config, prefixListID string, currentVersion int64, add []PrefixListEntry, removeCIDRs []string) (int64, error) {
+	logutil.S().Infow("modifying a prefix list", "prefixListID", prefixListID, "currentVersion", currentVersion, "add", add, "remove", removeCIDRs)
+
+	input := &aws_ec2_v2.ModifyManagedPrefixListInput{
+		PrefixListId:   aws.String(prefixListID),
+		CurrentVersion: aws.Int64(currentVersion),
+		AddEntries:     toAddPrefixListEntries(add),
+	}
+	for _, cidr := range removeCIDRs {
+		input.RemoveEntries = append(input.RemoveEntries, aws_ec2_v2_types.RemovePrefixListEntry{Cidr: aws.String(cidr)})
+	}
+
+	cli := newClient(cfg)
+	out, err := cli.ModifyManagedPrefixList(ctx, input)
+	if err != nil {
+		return 0, err
+	}
+
+	version := aws.ToInt64(out.PrefixList.Version)
+	logutil.S().Infow("successfully requested to modify a prefix list", "prefixListID", prefixListID, "version", version)
+	return version, nil
+}
+
+const (
+	prefixListModifyAttempts      = 5
+	defaultPrefixListWaitInterval = 2 * time.Second
+)
+
+// Ensures the entries exist in the prefix list with the same descriptions, and returns true if modified.
+// The other entries are kept (e.g., registered by other instances sharing the list),
+// unless "WithOverwrite" is set, in which case the entries not in the desired set are removed.
+// Retries on the concurrent modifications by the other instances, based off the latest version.
+// The wait options (e.g., "WithInterval") are used to wait for the previous modification to complete.
+func EnsurePrefixListEntries(ctx context.Context, cfg aws.Config, prefixListID string, entries []PrefixListEntry, opts ...OpOption) (bool, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	var lastErr error
+	for attempt := 1; attempt <= prefixListModifyAttempts; attempt++ {
+		pl, err := waitPrefixListModifiable(ctx, cfg, prefixListID, opts...)
+		if err != nil {
+			return false, err
+		}
+		cur, err := ListPrefixListEntries(ctx, cfg, prefixListID)
+		if err != nil {
+			return false, err
+		}
+
+		add, remove := diffPrefixListEntries(cur, entries, ret.overwrite)
+		if len(add) == 0 && len(remove) == 0 {
+			logutil.S().Infow("prefix list entries already up-to-date", "prefixListID", prefixListID, "version", pl.Version)
+			return false, nil
+		}
+
+		_, lastErr = ModifyPrefixList(ctx, cfg, prefixListID, pl.Version, add, remove)
+		if lastErr == nil {
+			_, err = waitPrefixListModifiable(ctx, cfg, prefixListID, opts...)
+			return true, err
+		}
+		if !prefixListConflict(lastErr) {
+			return false, lastErr
+		}
+		logutil.S().Warnw("prefix list modified concurrently -- retrying with the latest version", "prefixListID", prefixListID, "attempt", attempt, "error", lastErr)
+	}
+	return false, lastErr
+}
+
+// Returns the entries to add (new CIDRs or changed descriptions) and the CIDRs to remove.
+// Adding an existing CIDR with a new description replaces the description.
+func diffPrefixListEntries(cur []PrefixListEntry, desired []PrefixListEntry, removeOthers bool) ([]PrefixListEntry, []string) {
+	curMap := make(map[string]string, len(cur))
+	for _, e := range cur {
+		curMap[e.CIDR] = e.Description
+	}
+	desiredMap := make(map[string]struct{}, len(desired))
+
+	add := make([]PrefixListEntry, 0)
+	for _, e := range desired {
+		desiredMap[e.CIDR] = struct{}{}
+		if desc, ok := curMap[e.CIDR]; ok && desc == e.Description {
+			continue
+		}
+		add = append(add, e)
+	}
+
+	remove := make([]string, 0)
+	if removeOthers {
+		for cidr := range curMap {
+			if _, ok := desiredMap[cidr]; !ok {
+				remove = append(remove, cidr)
+			}
+		}
+		sort.Strings(remove)
+	}
+	return add, remove
+}
+
+// Waits until the prefix list is not being created or modified.
+func waitPrefixListModifiable(ctx context.Context, cfg aws.Config, prefixListID string, opts ...OpOption) (PrefixList, error) {
+	var pl PrefixList
+	opts = append([]OpOption{WithInterval(defaultPrefixListWaitInterval)}, opts...)
+	err := WaitUntil(ctx, fmt.Sprintf("prefix list %s modifiable", prefixListID), func(ctx context.Context) (bool, string, error) {
+		var err error
+		pl, err = GetPrefixList(ctx, cfg, prefixListID)
+		if err != nil {
+			return false, "", err
+		}
+		switch aws_ec2_v2_types.PrefixListState(pl.State) {
+		case aws_ec2_v2_types.PrefixListStateCreateComplete,
+			aws_ec2_v2_types.PrefixListStateModifyComplete,
+			aws_ec2_v2_types.PrefixListStateRestoreComplete:
+			return true, pl.State, nil
+		case aws_ec2_v2_types.PrefixListStateCreateFailed,
+			aws_ec2_v2_types.PrefixListStateDeleteComplete,
+			aws_ec2_v2_types.PrefixListStateDeleteInProgress,
+			aws_ec2_v2_types.PrefixListStateDeleteFailed:
+			return false, pl.State, fmt.Errorf("prefix list %s in state %q: %w", prefixListID, pl.State, ErrStopWait)
+		}
+		// modify-failed can be fixed by the next modification
+		return pl.State == string(aws_ec2_v2_types.PrefixListStateModifyFailed), pl.State, nil
+	}, opts...)
+	return pl, err
+}
+
+func prefixListConflict(err error) bool {
+	code := ErrorCode(err)
+	return code == "IncorrectState" || code == "PrefixListVersionMismatch" || strings.Contains(code, "ConcurrentModification")
+}
+
+func toAddPrefixListEntries(entries []PrefixListEntry) []aws_ec2_v2_types.AddPrefixListEntry {
+	if len(entries) == 0 {
+		return nil
+	}
+	ret := make([]aws_ec2_v2_types.AddPrefixListEntry, 0, len(entries))
+	for _, e := range entries {
+		entry := aws_ec2_v2_types.AddPrefixListEntry{Cidr: aws.String(e.CIDR)}
+		if e.Description != "" {
+			entry.Description = aws.String(e.Description)
+		}
+		ret = append(ret, entry)
+	}
+	return ret
+}
@@ -0,0 +1,49 @@
+package ec2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffPrefixListEntries(t *testing.T) {
+	cur := []PrefixListEntry{
+		{CIDR: "1.1.1.1/32", Description: "a"},
+		{CIDR: "2.2.2.2/32", Description: "b"},
+		{CIDR: "3.3.3.3/32", Description: "c"},
+	}
+	desired := []PrefixListEntry{
+		{CIDR: "1.1.1.1/32", Description: "a"},
+		{CIDR: "2.2.2.2/32", Description: "changed"},
+		{CIDR: "4.4.4.4/32", Description: "d"},
+	}
+	tt := []struct {
+		removeOthers bool
+		expAdd       []PrefixListEntry
+		expRemove    []string
+	}{
+		{
+			removeOthers: false,
+			expAdd:       desired[1:],
+			expRemove:    []string{},
+		},
+		{
+			removeOthers: true,
+			expAdd:       desired[1:],
+			expRemove:    []string{"3.3.3.3/32"},
+		},
+	}
+	for i, tv := range tt {
+		add, remove := diffPrefixListEntries(cur, desired, tv.removeOthers)
+		if !reflect.DeepEqual(add, tv.expAdd) {
+			t.Fatalf("#%d: add expected %+v, got %+v", i, tv.expAdd, add)
+		}
+		if !reflect.DeepEqual(remove, tv.expRemove) {
+			t.Fatalf("#%d: remove expected %v, got %v", i, tv.expRemove, remove)
+		}
+	}
+
+	add, remove := diffPrefixListEntries(cur, cur, true)
+	if len(add) != 0 || len(remove) != 0 {
+		t.Fatalf("expected no changes, got %+v %v", add, remove)
+	}
+}
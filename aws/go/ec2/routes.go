@@ -23,7 +23,7 @@ func CreateRouteByInstanceID(ctx context.Context, cfg aws.Config, rtbID string,
 
 	logutil.S().Infow("creating a route in the route table", "routeTableID", rtbID, "destinationCIDR", destinationCIDR, "instanceID", instanceID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 
 	// this does not fail even if the destination CIDR is the same, so long as the target instance/ENI is the same
 	// (you can run this multiple times)
@@ -102,7 +102,7 @@ func CreateRouteByInstanceID(ctx context.Context, cfg aws.Config, rtbID string,
 func CreateRouteByENI(ctx context.Context, cfg aws.Config, rtbID string, destinationCIDR string, eniID string) error {
 	logutil.S().Infow("creating a route in the route table", "routeTableID", rtbID, "destinationCIDR", destinationCIDR, "eniID", eniID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	out, err := cli.CreateRoute(
 		ctx,
 		&aws_ec2_v2.CreateRouteInput{
@@ -131,7 +131,7 @@ func CreateRouteByENI(ctx context.Context, cfg aws.Config, rtbID string, destina
 func ListRouteTablesByVPC(ctx context.Context, cfg aws.Config, vpcID string) (RouteTables, error) {
 	logutil.S().Infow("listing route tables for VPC", "vpcID", vpcID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	out, err := cli.DescribeRouteTables(
 		ctx,
 		&aws_ec2_v2.DescribeRouteTablesInput{
@@ -182,11 +182,32 @@ func ListRouteTablesByVPC(ctx context.Context, cfg aws.Config, vpcID string) (Ro
 	return rtbs, nil
 }
 
+// Lists the route tables by filter (e.g., "vpc-id", "route.transit-gateway-id", "association.subnet-id").
+func ListRouteTables(ctx context.Context, cfg aws.Config, opts ...OpOption) (RouteTables, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cli := newClient(cfg)
+	pg := aws_ec2_v2.NewDescribeRouteTablesPaginator(cli, &aws_ec2_v2.DescribeRouteTablesInput{
+		Filters: convertFilters(ret.filters),
+	})
+	rtbs := make(RouteTables, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rtbs = append(rtbs, toRouteTables(out.RouteTables...)...)
+	}
+	logutil.S().Infow("listed route tables", "filters", ret.filters, "routeTables", len(rtbs))
+	return rtbs, nil
+}
+
 // Get routes and route table for the give route table ID.
 func GetRouteTable(ctx context.Context, cfg aws.Config, rtbID string) (RouteTable, error) {
 	logutil.S().Infow("listing routes in the route table", "routeTableID", rtbID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	out, err := cli.DescribeRouteTables(
 		ctx,
 		&aws_ec2_v2.DescribeRouteTablesInput{
@@ -229,7 +250,7 @@ func DeleteBlackholeRoutes(ctx context.Context, cfg aws.Config, rtbID string) er
 func DeleteRouteByDestinationCIDR(ctx context.Context, cfg aws.Config, rtbID string, destinationCIDR string) error {
 	logutil.S().Infow("deleting a route in the route table", "routeTableID", rtbID, "destinationCIDR", destinationCIDR)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 	_, err := cli.DeleteRoute(
 		ctx,
 		&aws_ec2_v2.DeleteRouteInput{
@@ -0,0 +1,226 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type TagSelectorOp string
+
+const (
+	TagSelectorOpEquals       TagSelectorOp = "="
+	TagSelectorOpNotEquals    TagSelectorOp = "!="
+	TagSelectorOpIn           TagSelectorOp = "in"
+	TagSelectorOpNotIn        TagSelectorOp = "notin"
+	TagSelectorOpExists       TagSelectorOp = "exists"
+	TagSelectorOpDoesNotExist TagSelectorOp = "!"
+)
+
+// Requirement on a single tag key.
+type TagRequirement struct {
+	Key    string
+	Op     TagSelectorOp
+	Values []string
+}
+
+func (r TagRequirement) matches(tags map[string]string) bool {
+	v, ok := tags[r.Key]
+	switch r.Op {
+	case TagSelectorOpEquals, TagSelectorOpIn:
+		return ok && contains(r.Values, v)
+	case TagSelectorOpNotEquals, TagSelectorOpNotIn:
+		return !ok || !contains(r.Values, v)
+	case TagSelectorOpExists:
+		return ok
+	case TagSelectorOpDoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+// Tag selector, where all requirements must match (logical AND).
+type TagSelector []TagRequirement
+
+// Parses the comma-separated tag selector expression.
+// e.g., "Kind=worker,Env in (prod,staging),!Draining,Team,Tier notin (dev)"
+//
+// Supported forms are "key=value" (or "=="), "key!=value", "key in (v1,v2)",
+// "key notin (v1,v2)", "key" (exists), and "!key" (does not exist).
+func ParseTagSelector(s string) (TagSelector, error) {
+	terms, err := splitSelectorTerms(s)
+	if err != nil {
+		return nil, err
+	}
+
+	sel := make(TagSelector, 0, len(terms))
+	for _, term := range terms {
+		r, err := parseTagRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// Splits the expression by the commas outside of the parentheses.
+func splitSelectorTerms(s string) ([]string, error) {
+	terms := make([]string, 0)
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+			if depth > 1 {
+				return nil, fmt.Errorf("nested parentheses in selector %q", s)
+			}
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses in selector %q", s)
+			}
+		case ',':
+			if depth == 0 {
+				terms = append(terms, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses in selector %q", s)
+	}
+	terms = append(terms, strings.TrimSpace(s[start:]))
+
+	for _, t := range terms {
+		if t == "" {
+			return nil, fmt.Errorf("empty term in selector %q", s)
+		}
+	}
+	return terms, nil
+}
+
+func parseTagRequirement(term string) (TagRequirement, error) {
+	if idx := strings.Index(term, "("); idx >= 0 {
+		if !strings.HasSuffix(term, ")") {
+			return TagRequirement{}, fmt.Errorf("invalid set term %q", term)
+		}
+		fields := strings.Fields(term[:idx])
+		if len(fields) != 2 {
+			return TagRequirement{}, fmt.Errorf("invalid set term %q (expected 'key in (v1,v2)')", term)
+		}
+		op := TagSelectorOp(strings.ToLower(fields[1]))
+		if op != TagSelectorOpIn && op != TagSelectorOpNotIn {
+			return TagRequirement{}, fmt.Errorf("unknown set operator %q in %q", fields[1], term)
+		}
+		values := make([]string, 0)
+		for _, v := range strings.Split(term[idx+1:len(term)-1], ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				return TagRequirement{}, fmt.Errorf("empty value in %q", term)
+			}
+			values = append(values, v)
+		}
+		return TagRequirement{Key: fields[0], Op: op, Values: values}, nil
+	}
+
+	for _, sep := range []string{"!=", "==", "="} {
+		k, v, found := strings.Cut(term, sep)
+		if !found {
+			continue
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		if k == "" {
+			return TagRequirement{}, fmt.Errorf("empty key in %q", term)
+		}
+		op := TagSelectorOpEquals
+		if sep == "!=" {
+			op = TagSelectorOpNotEquals
+		}
+		return TagRequirement{Key: k, Op: op, Values: []string{v}}, nil
+	}
+
+	if k, found := strings.CutPrefix(term, "!"); found {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			return TagRequirement{}, fmt.Errorf("empty key in %q", term)
+		}
+		return TagRequirement{Key: k, Op: TagSelectorOpDoesNotExist}, nil
+	}
+	if strings.ContainsAny(term, " \t") {
+		return TagRequirement{}, fmt.Errorf("invalid term %q", term)
+	}
+	return TagRequirement{Key: term, Op: TagSelectorOpExists}, nil
+}
+
+// Returns the server-side filters for the equality and set requirements.
+// The negative requirements cannot be expressed in the EC2 filters,
+// so the results must be checked with "Matches".
+func (sel TagSelector) Filters() map[string][]string {
+	filters := make(map[string][]string)
+	for _, r := range sel {
+		if r.Op == TagSelectorOpEquals || r.Op == TagSelectorOpIn {
+			filters["tag:"+r.Key] = r.Values
+		}
+	}
+	return filters
+}
+
+// Returns true if the tags match all requirements.
+func (sel TagSelector) Matches(tags map[string]string) bool {
+	for _, r := range sel {
+		if !r.matches(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// Finds the instances matching the tag selector expression (see "ParseTagSelector").
+// Use "WithInstanceState" to only return the instances in the states (e.g., running).
+func FindInstancesByTagSelector(ctx context.Context, cfg aws.Config, selector string, opts ...OpOption) ([]aws_ec2_v2_types.Instance, error) {
+	sel, err := ParseTagSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Op{}
+	ret.applyOpts(opts)
+	filters := sel.Filters()
+	for k, vs := range ret.filters {
+		filters[k] = vs
+	}
+
+	logutil.S().Infow("finding instances by tag selector", "selector", selector, "filters", filters)
+	instances := make([]aws_ec2_v2_types.Instance, 0)
+	err = ForEachInstance(ctx, cfg, func(inst aws_ec2_v2_types.Instance) error {
+		tags := make(map[string]string, len(inst.Tags))
+		for _, tg := range inst.Tags {
+			tags[aws.ToString(tg.Key)] = aws.ToString(tg.Value)
+		}
+		if sel.Matches(tags) {
+			instances = append(instances, inst)
+		}
+		return nil
+	}, append(opts, WithFilters(filters))...)
+	if err != nil {
+		return nil, err
+	}
+
+	logutil.S().Infow("found instances by tag selector", "selector", selector, "instances", len(instances))
+	return instances, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package ec2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTagSelector(t *testing.T) {
+	tt := []struct {
+		selector string
+		expected TagSelector
+		err      bool
+	}{
+		{
+			selector: "Kind=worker,Env in (prod,staging)",
+			expected: TagSelector{
+				{Key: "Kind", Op: TagSelectorOpEquals, Values: []string{"worker"}},
+				{Key: "Env", Op: TagSelectorOpIn, Values: []string{"prod", "staging"}},
+			},
+		},
+		{
+			selector: " Kind == worker , Tier notin (dev, test), Team, !Draining, Zone!=a ",
+			expected: TagSelector{
+				{Key: "Kind", Op: TagSelectorOpEquals, Values: []string{"worker"}},
+				{Key: "Tier", Op: TagSelectorOpNotIn, Values: []string{"dev", "test"}},
+				{Key: "Team", Op: TagSelectorOpExists},
+				{Key: "Draining", Op: TagSelectorOpDoesNotExist},
+				{Key: "Zone", Op: TagSelectorOpNotEquals, Values: []string{"a"}},
+			},
+		},
+		{selector: "", err: true},
+		{selector: "Kind=worker,", err: true},
+		{selector: "Env in (prod", err: true},
+		{selector: "Env within (prod)", err: true},
+		{selector: "Env in (prod,)", err: true},
+		{selector: "=worker", err: true},
+		{selector: "Kind worker", err: true},
+	}
+	for i, tv := range tt {
+		sel, err := ParseTagSelector(tv.selector)
+		if tv.err != (err != nil) {
+			t.Fatalf("#%d: expected error %v, got %v", i, tv.err, err)
+		}
+		if !tv.err && !reflect.DeepEqual(tv.expected, sel) {
+			t.Fatalf("#%d: expected %+v, got %+v", i, tv.expected, sel)
+		}
+	}
+}
+
+func TestTagSelectorMatches(t *testing.T) {
+	sel, err := ParseTagSelector("Kind=worker,Env in (prod,staging),!Draining,Tier notin (dev)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFilters := map[string][]string{
+		"tag:Kind": {"worker"},
+		"tag:Env":  {"prod", "staging"},
+	}
+	if !reflect.DeepEqual(expectedFilters, sel.Filters()) {
+		t.Fatalf("unexpected filters %v", sel.Filters())
+	}
+
+	tt := []struct {
+		tags    map[string]string
+		matches bool
+	}{
+		{tags: map[string]string{"Kind": "worker", "Env": "prod"}, matches: true},
+		{tags: map[string]string{"Kind": "worker", "Env": "staging", "Tier": "web"}, matches: true},
+		{tags: map[string]string{"Kind": "worker", "Env": "dev"}, matches: false},
+		{tags: map[string]string{"Kind": "worker", "Env": "prod", "Draining": "true"}, matches: false},
+		{tags: map[string]string{"Kind": "worker", "Env": "prod", "Tier": "dev"}, matches: false},
+		{tags: map[string]string{"Env": "prod"}, matches: false},
+	}
+	for i, tv := range tt {
+		if m := sel.Matches(tv.tags); m != tv.matches {
+			t.Errorf("#%d: expected %v, got %v", i, tv.matches, m)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// SGRule defines a security group ingress or egress rule.
+// Exactly one of CIDR (IPv4 or IPv6) and SourceSGID must be set.
+// If Description is set, the rule is identified by its description,
+// so the rule with the same description but different ports or source is replaced.
+type SGRule struct {
+	ID          string `json:"id,omitempty"`
+	Egress      bool   `json:"egress"`
+	Protocol    string `json:"protocol"`
+	FromPort    int32  `json:"from_port"`
+	ToPort      int32  `json:"to_port"`
+	CIDR        string `json:"cidr,omitempty"`
+	SourceSGID  string `json:"source_sg_id,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (r SGRule) validate() error {
+	if r.Protocol == "" {
+		return errors.New("empty protocol")
+	}
+	if (r.CIDR == "") == (r.SourceSGID == "") {
+		return fmt.Errorf("exactly one of CIDR and source security group must be set (cidr %q, source %q)", r.CIDR, r.SourceSGID)
+	}
+	return nil
+}
+
+// Returns true if the rules allow the same traffic, ignoring the ID and description.
+func (r SGRule) sameSpec(other SGRule) bool {
+	return r.Egress == other.Egress &&
+		r.Protocol == other.Protocol &&
+		r.FromPort == other.FromPort &&
+		r.ToPort == other.ToPort &&
+		r.CIDR == other.CIDR &&
+		r.SourceSGID == other.SourceSGID
+}
+
+func (r SGRule) toIPPermission() aws_ec2_v2_types.IpPermission {
+	perm := aws_ec2_v2_types.IpPermission{
+		IpProtocol: aws.String(r.Protocol),
+		FromPort:   aws.Int32(r.FromPort),
+		ToPort:     aws.Int32(r.ToPort),
+	}
+	var desc *string
+	if r.Description != "" {
+		desc = aws.String(r.Description)
+	}
+	switch {
+	case r.SourceSGID != "":
+		perm.UserIdGroupPairs = []aws_ec2_v2_types.UserIdGroupPair{{GroupId: aws.String(r.SourceSGID), Description: desc}}
+	case strings.Contains(r.CIDR, ":"):
+		perm.Ipv6Ranges = []aws_ec2_v2_types.Ipv6Range{{CidrIpv6: aws.String(r.CIDR), Description: desc}}
+	default:
+		perm.IpRanges = []aws_ec2_v2_types.IpRange{{CidrIp: aws.String(r.CIDR), Description: desc}}
+	}
+	return perm
+}
+
+func convertSGRule(raw aws_ec2_v2_types.SecurityGroupRule) SGRule {
+	r := SGRule{
+		ID:          aws.ToString(raw.SecurityGroupRuleId),
+		Egress:      aws.ToBool(raw.IsEgress),
+		Protocol:    aws.ToString(raw.IpProtocol),
+		FromPort:    aws.ToInt32(raw.FromPort),
+		ToPort:      aws.ToInt32(raw.ToPort),
+		Description: aws.ToString(raw.Description),
+	}
+	switch {
+	case raw.CidrIpv4 != nil:
+		r.CIDR = *raw.CidrIpv4
+	case raw.CidrIpv6 != nil:
+		r.CIDR = *raw.CidrIpv6
+	case raw.ReferencedGroupInfo != nil:
+		r.SourceSGID = aws.ToString(raw.ReferencedGroupInfo.GroupId)
+	}
+	return r
+}
+
+// Creates a security group in the VPC, and returns the security group ID.
+// Use "WithDescription" to set the description (defaults to the name).
+func CreateSG(ctx context.Context, cfg aws.Config, name string, vpcID string, opts ...OpOption) (string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+	if ret.desc == "" {
+		ret.desc = name
+	}
+
+	tags := ConvertTags(name, ret.tags)
+	logutil.S().Infow("creating a security group", "name", name, "vpcID", vpcID, "tags", tags)
+
+	cli := newClient(cfg)
+	out, err := cli.CreateSecurityGroup(ctx, &aws_ec2_v2.CreateSecurityGroupInput{
+		GroupName:   aws.String(name),
+		Description: aws.String(ret.desc),
+		VpcId:       aws.String(vpcID),
+		TagSpecifications: []aws_ec2_v2_types.TagSpecification{
+			{
+				ResourceType: aws_ec2_v2_types.ResourceTypeSecurityGroup,
+				Tags:         tags,
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sgID := *out.GroupId
+	logutil.S().Infow("successfully created a security group", "name", name, "sgID", sgID)
+	return sgID, nil
+}
+
+// Lists the ingress and egress rules of the security group.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_DescribeSecurityGroupRules.html
+func ListSGRules(ctx context.Context, cfg aws.Config, sgID string) ([]SGRule, error) {
+	cli := newClient(cfg)
+	pg := aws_ec2_v2.NewDescribeSecurityGroupRulesPaginator(cli, &aws_ec2_v2.DescribeSecurityGroupRulesInput{
+		Filters: convertFilters(map[string][]string{"group-id": {sgID}}),
+	})
+
+	rules := make([]SGRule, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range out.SecurityGroupRules {
+			rules = append(rules, convertSGRule(raw))
+		}
+	}
+	return rules, nil
+}
+
+// Ensures the rule exists in the security group, and returns true if the rule was created or replaced.
+// The existing rule is matched by the description if set, otherwise by the ports and source.
+// A rule with the same description but a different spec is revoked and re-authorized.
+func EnsureSecurityGroupRule(ctx context.Context, cfg aws.Config, sgID string, rule SGRule) (bool, error) {
+	if err := rule.validate(); err != nil {
+		return false, err
+	}
+
+	logutil.S().Infow("ensuring security group rule", "sgID", sgID, "rule", rule)
+	rules, err := ListSGRules(ctx, cfg, sgID)
+	if err != nil {
+		return false, err
+	}
+
+	stale := make([]SGRule, 0)
+	for _, cur := range rules {
+		if rule.Description != "" && cur.Egress == rule.Egress && cur.Description == rule.Description {
+			if cur.sameSpec(rule) {
+				logutil.S().Infow("security group rule already exists", "sgID", sgID, "ruleID", cur.ID)
+				return false, nil
+			}
+			stale = append(stale, cur)
+			continue
+		}
+		if rule.Description == "" && cur.sameSpec(rule) {
+			logutil.S().Infow("security group rule already exists", "sgID", sgID, "ruleID", cur.ID)
+			return false, nil
+		}
+	}
+
+	for _, cur := range stale {
+		logutil.S().Infow("replacing stale security group rule with the same description", "sgID", sgID, "rule", cur)
+		if err := revokeSGRuleIDs(ctx, cfg, sgID, cur.Egress, []string{cur.ID}); err != nil {
+			return false, err
+		}
+	}
+
+	cli := newClient(cfg)
+	perms := []aws_ec2_v2_types.IpPermission{rule.toIPPermission()}
+	if rule.Egress {
+		_, err = cli.AuthorizeSecurityGroupEgress(ctx, &aws_ec2_v2.AuthorizeSecurityGroupEgressInput{
+			GroupId:       aws.String(sgID),
+			IpPermissions: perms,
+		})
+	} else {
+		_, err = cli.AuthorizeSecurityGroupIngress(ctx, &aws_ec2_v2.AuthorizeSecurityGroupIngressInput{
+			GroupId:       aws.String(sgID),
+			IpPermissions: perms,
+		})
+	}
+	if err != nil {
+		// concurrent agents may have authorized the same rule
+		if sgRuleDuplicate(err) {
+			logutil.S().Infow("security group rule already exists", "sgID", sgID, "error", err)
+			return false, nil
+		}
+		return false, err
+	}
+
+	logutil.S().Infow("successfully authorized security group rule", "sgID", sgID, "rule", rule)
+	return true, nil
+}
+
+// Revokes the rules matching the description if set, otherwise by the ports and source.
+// Returns false if no matching rule exists.
+func RevokeSecurityGroupRule(ctx context.Context, cfg aws.Config, sgID string, rule SGRule) (bool, error) {
+	logutil.S().Infow("revoking security group rule", "sgID", sgID, "rule", rule)
+	rules, err := ListSGRules(ctx, cfg, sgID)
+	if err != nil {
+		return false, err
+	}
+
+	ids := make([]string, 0)
+	for _, cur := range rules {
+		if cur.Egress != rule.Egress {
+			continue
+		}
+		if (rule.Description != "" && cur.Description == rule.Description) ||
+			(rule.Description == "" && cur.sameSpec(rule)) {
+			ids = append(ids, cur.ID)
+		}
+	}
+	if len(ids) == 0 {
+		logutil.S().Infow("no matching security group rule found", "sgID", sgID)
+		return false, nil
+	}
+
+	if err := revokeSGRuleIDs(ctx, cfg, sgID, rule.Egress, ids); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func revokeSGRuleIDs(ctx context.Context, cfg aws.Config, sgID string, egress bool, ids []string) error {
+	cli := newClient(cfg)
+
+	var err error
+	if egress {
+		_, err = cli.RevokeSecurityGroupEgress(ctx, &aws_ec2_v2.RevokeSecurityGroupEgressInput{
+			GroupId:              aws.String(sgID),
+			SecurityGroupRuleIds: ids,
+		})
+	} else {
+		_, err = cli.RevokeSecurityGroupIngress(ctx, &aws_ec2_v2.RevokeSecurityGroupIngressInput{
+			GroupId:              aws.String(sgID),
+			SecurityGroupRuleIds: ids,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully revoked security group rules", "sgID", sgID, "ruleIDs", ids)
+	return nil
+}
+
+func sgRuleDuplicate(err error) bool {
+	return ErrorCode(err) == "InvalidPermission.Duplicate"
+}
@@ -0,0 +1,55 @@
+package ec2
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestSGRuleValidate(t *testing.T) {
+	tt := []struct {
+		rule  SGRule
+		valid bool
+	}{
+		{rule: SGRule{Protocol: "tcp", FromPort: 22, ToPort: 22, CIDR: "10.0.0.0/16"}, valid: true},
+		{rule: SGRule{Protocol: "tcp", FromPort: 22, ToPort: 22, SourceSGID: "sg-1"}, valid: true},
+		{rule: SGRule{Protocol: "tcp", FromPort: 22, ToPort: 22}, valid: false},
+		{rule: SGRule{Protocol: "tcp", FromPort: 22, ToPort: 22, CIDR: "10.0.0.0/16", SourceSGID: "sg-1"}, valid: false},
+		{rule: SGRule{FromPort: 22, ToPort: 22, CIDR: "10.0.0.0/16"}, valid: false},
+	}
+	for i, tv := range tt {
+		err := tv.rule.validate()
+		if tv.valid != (err == nil) {
+			t.Errorf("#%d: expected valid %v, got error %v", i, tv.valid, err)
+		}
+	}
+}
+
+func TestSGRuleIPPermission(t *testing.T) {
+	perm := SGRule{Protocol: "tcp", FromPort: 443, ToPort: 443, CIDR: "::/0", Description: "https"}.toIPPermission()
+	if len(perm.Ipv6Ranges) != 1 || len(perm.IpRanges) != 0 || *perm.Ipv6Ranges[0].Description != "https" {
+		t.Fatalf("unexpected IPv6 permission %+v", perm)
+	}
+
+	perm = SGRule{Protocol: "-1", SourceSGID: "sg-1"}.toIPPermission()
+	if len(perm.UserIdGroupPairs) != 1 || perm.UserIdGroupPairs[0].Description != nil {
+		t.Fatalf("unexpected security group permission %+v", perm)
+	}
+}
+
+func TestConvertSGRule(t *testing.T) {
+	r := convertSGRule(aws_ec2_v2_types.SecurityGroupRule{
+		SecurityGroupRuleId: aws.String("sgr-1"),
+		IsEgress:            aws.Bool(false),
+		IpProtocol:          aws.String("tcp"),
+		FromPort:            aws.Int32(22),
+		ToPort:              aws.Int32(22),
+		CidrIpv4:            aws.String("10.0.0.0/16"),
+		Description:         aws.String("ssh"),
+	})
+	expected := SGRule{Protocol: "tcp", FromPort: 22, ToPort: 22, CIDR: "10.0.0.0/16"}
+	if !r.sameSpec(expected) || r.ID != "sgr-1" || r.Description != "ssh" {
+		t.Fatalf("unexpected rule %+v", r)
+	}
+}
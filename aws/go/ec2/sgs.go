@@ -66,7 +66,7 @@ func ListSGsByVPC(ctx context.Context, cfg aws.Config, vpcID string) (SGs, error
 
 // List security groups.
 func ListSGs(ctx context.Context, cfg aws.Config, filters ...aws_ec2_v2_types.Filter) (SGs, error) {
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 
 	ss := make([]aws_ec2_v2_types.SecurityGroup, 0, 10)
 	var nextToken *string = nil
@@ -109,7 +109,7 @@ func ListSGs(ctx context.Context, cfg aws.Config, filters ...aws_ec2_v2_types.Fi
 }
 
 func GetSG(ctx context.Context, cfg aws.Config, sgID string) (SG, error) {
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 
 	out, err := cli.DescribeSecurityGroups(ctx,
 		&aws_ec2_v2.DescribeSecurityGroupsInput{
@@ -0,0 +1,213 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+type Snapshot struct {
+	ID          string            `json:"id"`
+	VolumeID    string            `json:"volume_id"`
+	State       string            `json:"state"`
+	SizeInGB    int32             `json:"size_in_gb"`
+	Description string            `json:"description,omitempty"`
+	StartTime   time.Time         `json:"start_time"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+func convertSnapshot(raw aws_ec2_v2_types.Snapshot) Snapshot {
+	return Snapshot{
+		ID:          aws.ToString(raw.SnapshotId),
+		VolumeID:    aws.ToString(raw.VolumeId),
+		State:       string(raw.State),
+		SizeInGB:    aws.ToInt32(raw.VolumeSize),
+		Description: aws.ToString(raw.Description),
+		StartTime:   aws.ToTime(raw.StartTime),
+		Tags:        convertTagsToMap(raw.Tags),
+	}
+}
+
+// Creates a snapshot of the volume, and returns the snapshot ID.
+// Use "WithDescription" and "WithTags" for the snapshot description and tags,
+// and "WithWait" to wait until the snapshot is completed.
+func CreateSnapshot(ctx context.Context, cfg aws.Config, volumeID string, opts ...OpOption) (string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("creating a snapshot", "volumeID", volumeID, "tags", ret.tags)
+	input := &aws_ec2_v2.CreateSnapshotInput{
+		VolumeId: aws.String(volumeID),
+	}
+	if len(ret.tags) > 0 {
+		input.TagSpecifications = []aws_ec2_v2_types.TagSpecification{
+			{
+				ResourceType: aws_ec2_v2_types.ResourceTypeSnapshot,
+				Tags:         ConvertTags("", ret.tags),
+			},
+		}
+	}
+	if ret.desc != "" {
+		input.Description = aws.String(ret.desc)
+	}
+
+	cli := newClient(cfg)
+	out, err := cli.CreateSnapshot(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	snapshotID := aws.ToString(out.SnapshotId)
+	logutil.S().Infow("successfully requested to create a snapshot", "volumeID", volumeID, "snapshotID", snapshotID)
+
+	if !ret.wait {
+		return snapshotID, nil
+	}
+	err = WaitUntil(ctx, fmt.Sprintf("snapshot %s completed", snapshotID), func(ctx context.Context) (bool, string, error) {
+		dout, err := cli.DescribeSnapshots(ctx, &aws_ec2_v2.DescribeSnapshotsInput{
+			SnapshotIds: []string{snapshotID},
+		})
+		if err != nil {
+			return false, "", err
+		}
+		if len(dout.Snapshots) != 1 {
+			return false, "", nil
+		}
+		snap := dout.Snapshots[0]
+		switch snap.State {
+		case aws_ec2_v2_types.SnapshotStateCompleted:
+			return true, string(snap.State), nil
+		case aws_ec2_v2_types.SnapshotStateError:
+			return false, string(snap.State), fmt.Errorf("snapshot %s failed (%s): %w", snapshotID, aws.ToString(snap.StateMessage), ErrStopWait)
+		}
+		return false, fmt.Sprintf("%s %s", snap.State, aws.ToString(snap.Progress)), nil
+	}, opts...)
+	return snapshotID, err
+}
+
+// Lists the snapshots owned by the account by filter (e.g., "volume-id", "tag:Kind"),
+// sorted by the start time, the newest first.
+func ListSnapshots(ctx context.Context, cfg aws.Config, opts ...OpOption) ([]Snapshot, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cli := newClient(cfg)
+	pg := aws_ec2_v2.NewDescribeSnapshotsPaginator(cli, &aws_ec2_v2.DescribeSnapshotsInput{
+		OwnerIds: []string{"self"},
+		Filters:  convertFilters(ret.filters),
+	})
+	snaps := make([]Snapshot, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range out.Snapshots {
+			snaps = append(snaps, convertSnapshot(raw))
+		}
+	}
+	sortSnapshots(snaps)
+
+	logutil.S().Infow("listed snapshots", "filters", ret.filters, "snapshots", len(snaps))
+	return snaps, nil
+}
+
+func sortSnapshots(snaps []Snapshot) {
+	sort.SliceStable(snaps, func(i, j int) bool {
+		if snaps[i].StartTime.Equal(snaps[j].StartTime) {
+			return snaps[i].ID < snaps[j].ID
+		}
+		return snaps[i].StartTime.After(snaps[j].StartTime)
+	})
+}
+
+// Deletes the completed snapshots matching the tag selector expression (see "ParseTagSelector")
+// that were started before the TTL, and returns the deleted snapshot IDs.
+// Use "WithKeepLast" to always keep the newest N matching snapshots regardless of the TTL
+// (e.g., keep last 7, or keep the "Schedule=daily" snapshots for 30 days with two calls).
+// The snapshots still in use by the AMIs are skipped.
+func DeleteSnapshotsOlderThan(ctx context.Context, cfg aws.Config, tagSelector string, ttl time.Duration, opts ...OpOption) ([]string, error) {
+	sel, err := ParseTagSelector(tagSelector)
+	if err != nil {
+		return nil, err
+	}
+	if len(sel) == 0 {
+		return nil, errors.New("empty tag selector would match all snapshots")
+	}
+
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	filters := sel.Filters()
+	for k, vs := range ret.filters {
+		filters[k] = vs
+	}
+	snaps, err := ListSnapshots(ctx, cfg, WithFilters(filters))
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]Snapshot, 0, len(snaps))
+	for _, s := range snaps {
+		if sel.Matches(s.Tags) {
+			matched = append(matched, s)
+		}
+	}
+
+	expired := selectExpiredSnapshots(matched, time.Now(), ttl, ret.keepLast)
+	logutil.S().Infow("deleting expired snapshots", "selector", tagSelector, "ttl", ttl, "keepLast", ret.keepLast, "matched", len(matched), "expired", len(expired))
+
+	cli := newClient(cfg)
+	deleted := make([]string, 0, len(expired))
+	for _, s := range expired {
+		_, err := cli.DeleteSnapshot(ctx, &aws_ec2_v2.DeleteSnapshotInput{
+			SnapshotId: aws.String(s.ID),
+		})
+		if err != nil {
+			if IsNotFound(err) {
+				deleted = append(deleted, s.ID)
+				continue
+			}
+			if ErrorCode(err) == "InvalidSnapshot.InUse" {
+				logutil.S().Warnw("snapshot in use -- skipping", "snapshotID", s.ID, "error", err)
+				continue
+			}
+			return deleted, err
+		}
+		logutil.S().Infow("deleted snapshot", "snapshotID", s.ID, "startTime", s.StartTime)
+		deleted = append(deleted, s.ID)
+	}
+
+	logutil.S().Infow("successfully deleted expired snapshots", "selector", tagSelector, "deleted", len(deleted))
+	return deleted, nil
+}
+
+// Returns the completed snapshots started before "now - ttl",
+// excluding the newest "keepLast" completed snapshots.
+func selectExpiredSnapshots(snaps []Snapshot, now time.Time, ttl time.Duration, keepLast int) []Snapshot {
+	completed := make([]Snapshot, 0, len(snaps))
+	for _, s := range snaps {
+		if s.State == string(aws_ec2_v2_types.SnapshotStateCompleted) {
+			completed = append(completed, s)
+		}
+	}
+	sortSnapshots(completed)
+
+	cutoff := now.Add(-ttl)
+	expired := make([]Snapshot, 0)
+	for i, s := range completed {
+		if i < keepLast {
+			continue
+		}
+		if s.StartTime.Before(cutoff) {
+			expired = append(expired, s)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,38 @@
+package ec2
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSelectExpiredSnapshots(t *testing.T) {
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	snaps := []Snapshot{
+		{ID: "snap-1", State: "completed", StartTime: now.Add(-40 * day)},
+		{ID: "snap-2", State: "completed", StartTime: now.Add(-35 * day)},
+		{ID: "snap-3", State: "completed", StartTime: now.Add(-31 * day)},
+		{ID: "snap-4", State: "pending", StartTime: now.Add(-50 * day)},
+		{ID: "snap-5", State: "completed", StartTime: now.Add(-1 * day)},
+	}
+
+	tt := []struct {
+		keepLast int
+		exp      []string
+	}{
+		{keepLast: 0, exp: []string{"snap-3", "snap-2", "snap-1"}},
+		{keepLast: 2, exp: []string{"snap-2", "snap-1"}},
+		{keepLast: 10, exp: []string{}},
+	}
+	for i, tv := range tt {
+		expired := selectExpiredSnapshots(snaps, now, 30*day, tv.keepLast)
+		ids := make([]string, 0, len(expired))
+		for _, s := range expired {
+			ids = append(ids, s.ID)
+		}
+		if !reflect.DeepEqual(ids, tv.exp) {
+			t.Fatalf("#%d: expected %v, got %v", i, tv.exp, ids)
+		}
+	}
+}
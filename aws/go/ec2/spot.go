@@ -0,0 +1,73 @@
+package ec2
+
+import (
+	"context"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+)
+
+// Spot request status codes that indicate the instance is being (or has been) interrupted.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/spot-request-status.html#spot-instance-request-status-understand
+var spotInterruptionCodes = map[string]struct{}{
+	"marked-for-stop":                             {},
+	"marked-for-termination":                      {},
+	"marked-for-hibernation":                      {},
+	"instance-stopped-by-price":                   {},
+	"instance-stopped-no-capacity":                {},
+	"instance-stopped-capacity-oversubscribed":    {},
+	"instance-terminated-by-price":                {},
+	"instance-terminated-no-capacity":             {},
+	"instance-terminated-capacity-oversubscribed": {},
+	"instance-terminated-launch-group-constraint": {},
+	"instance-hibernated-by-price":                {},
+	"instance-hibernated-no-capacity":             {},
+}
+
+// Represents the spot request status of the instance.
+type SpotInterruption struct {
+	SpotInstanceRequestID string    `json:"spot_instance_request_id"`
+	State                 string    `json:"state"`
+	StatusCode            string    `json:"status_code"`
+	StatusMessage         string    `json:"status_message"`
+	UpdateTime            time.Time `json:"update_time"`
+	// True if the status code indicates the interruption.
+	Interrupted bool `json:"interrupted"`
+}
+
+// Describes the spot request status of the instance, to check for the interruption
+// from outside the instance (see "metadata.WatchSpotEvents" for the instance-local watcher).
+// Returns false if the instance is not a spot instance.
+func DescribeSpotInterruption(ctx context.Context, cfg aws.Config, instanceID string) (SpotInterruption, bool, error) {
+	logutil.S().Infow("describing spot interruption", "instanceID", instanceID)
+
+	cli := newClient(cfg)
+	out, err := cli.DescribeSpotInstanceRequests(ctx, &aws_ec2_v2.DescribeSpotInstanceRequestsInput{
+		Filters: convertFilters(map[string][]string{"instance-id": {instanceID}}),
+	})
+	if err != nil {
+		return SpotInterruption{}, false, err
+	}
+	if len(out.SpotInstanceRequests) == 0 {
+		logutil.S().Infow("no spot instance request found", "instanceID", instanceID)
+		return SpotInterruption{}, false, nil
+	}
+
+	req := out.SpotInstanceRequests[0]
+	si := SpotInterruption{
+		SpotInstanceRequestID: aws.ToString(req.SpotInstanceRequestId),
+		State:                 string(req.State),
+	}
+	if req.Status != nil {
+		si.StatusCode = aws.ToString(req.Status.Code)
+		si.StatusMessage = aws.ToString(req.Status.Message)
+		si.UpdateTime = aws.ToTime(req.Status.UpdateTime)
+	}
+	_, si.Interrupted = spotInterruptionCodes[si.StatusCode]
+
+	logutil.S().Infow("described spot interruption", "instanceID", instanceID, "statusCode", si.StatusCode, "interrupted", si.Interrupted)
+	return si, true, nil
+}
@@ -2,7 +2,11 @@ package ec2
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
@@ -34,20 +38,205 @@ func ConvertTags(name string, m map[string]string) []aws_ec2_v2_types.Tag {
 	return tags
 }
 
-// Creates tags to the resource.
-func CreateTags(ctx context.Context, cfg aws.Config, resourceIDs []string, tags map[string]string) error {
-	logutil.S().Infow("creating tags", "resourceIDs", resourceIDs, "tags", len(tags))
+// AWS tag constraints.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/Using_Tags.html#tag-restrictions
+const (
+	MaxTagsPerResource = 50
+	MaxTagKeyLength    = 128
+	MaxTagValueLength  = 256
+)
 
-	ts := ConvertTags("", tags)
-	cli := aws_ec2_v2.NewFromConfig(cfg)
-	_, err := cli.CreateTags(ctx, &aws_ec2_v2.CreateTagsInput{
-		Resources: resourceIDs,
-		Tags:      ts,
-	})
+// Validates the tags against the AWS tag constraints (count, length, reserved prefix),
+// before calling the API.
+func ValidateTags(m map[string]string) error {
+	if len(m) > MaxTagsPerResource {
+		return fmt.Errorf("too many tags %d (max %d)", len(m), MaxTagsPerResource)
+	}
+	for k, v := range m {
+		if k == "" {
+			return fmt.Errorf("empty tag key")
+		}
+		if len([]rune(k)) > MaxTagKeyLength {
+			return fmt.Errorf("tag key %q too long (max %d)", k, MaxTagKeyLength)
+		}
+		if len([]rune(v)) > MaxTagValueLength {
+			return fmt.Errorf("tag value for %q too long (max %d)", k, MaxTagValueLength)
+		}
+		if strings.HasPrefix(strings.ToLower(k), "aws:") {
+			return fmt.Errorf("tag key %q uses the reserved prefix 'aws:'", k)
+		}
+	}
+	return nil
+}
+
+// EC2 CreateTags/DeleteTags API limits per call.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_CreateTags.html
+const (
+	maxTagResourcesPerCall = 1000
+	maxTagsPerCall         = MaxTagsPerResource
+
+	tagCallAttempts = 3
+)
+
+// Creates tags to the resources.
+// The resources and tags are chunked to stay under the API limits,
+// and each failed chunk is retried, so the other chunks are still tagged on partial failures.
+func CreateTags(ctx context.Context, cfg aws.Config, resourceIDs []string, tags map[string]string, opts ...OpOption) error {
+	logutil.S().Infow("creating tags", "resourceIDs", len(resourceIDs), "tags", len(tags))
+
+	cli := newAPI(cfg)
+	err := batchTags(ctx, resourceIDs, ConvertTags("", tags), func(ctx context.Context, ids []string, ts []aws_ec2_v2_types.Tag) error {
+		_, err := cli.CreateTags(ctx, &aws_ec2_v2.CreateTagsInput{
+			Resources: ids,
+			Tags:      ts,
+		})
+		return err
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully created tags", "resourceIDs", len(resourceIDs))
+	return nil
+}
+
+// Deletes the tags from the resources, regardless of the tag values.
+// Chunked and retried in the same way as "CreateTags".
+func DeleteTags(ctx context.Context, cfg aws.Config, resourceIDs []string, tagKeys []string, opts ...OpOption) error {
+	logutil.S().Infow("deleting tags", "resourceIDs", len(resourceIDs), "tagKeys", tagKeys)
+
+	ts := make([]aws_ec2_v2_types.Tag, 0, len(tagKeys))
+	for _, k := range tagKeys {
+		ts = append(ts, aws_ec2_v2_types.Tag{Key: aws.String(k)})
+	}
+	cli := newAPI(cfg)
+	err := batchTags(ctx, resourceIDs, ts, func(ctx context.Context, ids []string, ts []aws_ec2_v2_types.Tag) error {
+		_, err := cli.DeleteTags(ctx, &aws_ec2_v2.DeleteTagsInput{
+			Resources: ids,
+			Tags:      ts,
+		})
+		return err
+	}, opts...)
 	if err != nil {
 		return err
 	}
 
-	logutil.S().Infow("successfully created tags", "resourceIDs", resourceIDs)
+	logutil.S().Infow("successfully deleted tags", "resourceIDs", len(resourceIDs))
 	return nil
 }
+
+// Calls the function for each chunk of resources and tags, retrying the failed chunks.
+// Retries every error unless "WithRetryErrFunc" is set.
+// Returns the joined errors of the chunks that failed after all attempts.
+func batchTags(ctx context.Context, resourceIDs []string, tags []aws_ec2_v2_types.Tag, f func(context.Context, []string, []aws_ec2_v2_types.Tag) error, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	var errs []error
+	for _, ids := range chunkStrings(resourceIDs, maxTagResourcesPerCall) {
+		for _, ts := range chunkTags(tags, maxTagsPerCall) {
+			var err error
+			for attempt := 1; attempt <= tagCallAttempts; attempt++ {
+				if err = f(ctx, ids, ts); err == nil {
+					break
+				}
+				if ret.retryErrFunc != nil && !ret.retryErrFunc(err) {
+					break
+				}
+				if attempt == tagCallAttempts {
+					break
+				}
+				logutil.S().Warnw("failed to update tags -- retrying", "resourceIDs", len(ids), "tags", len(ts), "attempt", attempt, "error", err)
+				select {
+				case <-ctx.Done():
+					return errors.Join(append(errs, ctx.Err())...)
+				case <-time.After(time.Duration(attempt) * time.Second):
+				}
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to update %d tags on %d resources (first %q): %w", len(ts), len(ids), ids[0], err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func chunkStrings(ss []string, n int) [][]string {
+	chunks := make([][]string, 0, (len(ss)+n-1)/n)
+	for len(ss) > n {
+		chunks = append(chunks, ss[:n])
+		ss = ss[n:]
+	}
+	if len(ss) > 0 {
+		chunks = append(chunks, ss)
+	}
+	return chunks
+}
+
+func chunkTags(tags []aws_ec2_v2_types.Tag, n int) [][]aws_ec2_v2_types.Tag {
+	chunks := make([][]aws_ec2_v2_types.Tag, 0, (len(tags)+n-1)/n)
+	for len(tags) > n {
+		chunks = append(chunks, tags[:n])
+		tags = tags[n:]
+	}
+	if len(tags) > 0 {
+		chunks = append(chunks, tags)
+	}
+	return chunks
+}
+
+// Fetches the tag value of the resource, using the server-side filtering
+// rather than describing the whole resource.
+// Returns false if the tag is not found.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/APIReference/API_DescribeTags.html
+func GetTagValue(ctx context.Context, cfg aws.Config, resourceID string, tagKey string) (string, bool, error) {
+	cli := newAPI(cfg)
+	out, err := cli.DescribeTags(ctx, &aws_ec2_v2.DescribeTagsInput{
+		Filters: []aws_ec2_v2_types.Filter{
+			{
+				Name:   aws.String("resource-id"),
+				Values: []string{resourceID},
+			},
+			{
+				Name:   aws.String("key"),
+				Values: []string{tagKey},
+			},
+		},
+	})
+	if err != nil {
+		return "", false, err
+	}
+	for _, tg := range out.Tags {
+		if tg.Key != nil && *tg.Key == tagKey && tg.Value != nil {
+			return *tg.Value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+const maxTagPollInterval = time.Minute
+
+// Waits until the resource has the tag key, and returns the value.
+// Polls with the interval set by "WithInterval" (default 10 seconds),
+// backing off exponentially with jitter up to a minute to reduce API calls
+// when many instances are booting at once.
+func WaitTagValue(ctx context.Context, cfg aws.Config, resourceID string, tagKey string, opts ...OpOption) (string, error) {
+	v := ""
+	opts = append([]OpOption{WithBackoff(2), WithMaxInterval(maxTagPollInterval)}, opts...)
+	err := WaitUntil(ctx, fmt.Sprintf("tag %q on %s", tagKey, resourceID), func(ctx context.Context) (bool, string, error) {
+		var found bool
+		var err error
+		v, found, err = GetTagValue(ctx, cfg, resourceID, tagKey)
+		if err != nil {
+			return false, "", err
+		}
+		if !found || v == "" {
+			return false, "tag not found", nil
+		}
+		return true, "found tag value " + v, nil
+	}, opts...)
+	if err != nil {
+		return "", err
+	}
+	return v, nil
+}
@@ -1,7 +1,11 @@
 package ec2
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -68,3 +72,73 @@ func Test_toTags(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateTags(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := 0; i <= MaxTagsPerResource; i++ {
+		tooMany[fmt.Sprintf("key%d", i)] = "v"
+	}
+
+	tt := []struct {
+		name    string
+		m       map[string]string
+		wantErr bool
+	}{
+		{name: "empty", m: map[string]string{}},
+		{name: "valid", m: map[string]string{"Team": "infra", "Env": "prod"}},
+		{name: "empty value", m: map[string]string{"Team": ""}},
+		{name: "empty key", m: map[string]string{"": "infra"}, wantErr: true},
+		{name: "reserved prefix", m: map[string]string{"aws:autoscaling:groupName": "asg"}, wantErr: true},
+		{name: "reserved prefix upper case", m: map[string]string{"AWS:Team": "infra"}, wantErr: true},
+		{name: "key too long", m: map[string]string{strings.Repeat("k", MaxTagKeyLength+1): "v"}, wantErr: true},
+		{name: "value too long", m: map[string]string{"k": strings.Repeat("v", MaxTagValueLength+1)}, wantErr: true},
+		{name: "too many", m: tooMany, wantErr: true},
+	}
+	for _, tv := range tt {
+		t.Run(tv.name, func(t *testing.T) {
+			err := ValidateTags(tv.m)
+			if (err != nil) != tv.wantErr {
+				t.Fatalf("expected error %v, got %v", tv.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestBatchTags(t *testing.T) {
+	ids := make([]string, 2500)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("i-%d", i)
+	}
+	m := make(map[string]string, 60)
+	for i := 0; i < 60; i++ {
+		m[fmt.Sprintf("key-%02d", i)] = "value"
+	}
+
+	calls, failures := 0, 0
+	err := batchTags(context.Background(), ids, ConvertTags("", m), func(ctx context.Context, ids []string, ts []aws_ec2_v2_types.Tag) error {
+		calls++
+		if len(ids) > maxTagResourcesPerCall || len(ts) > maxTagsPerCall {
+			t.Fatalf("chunk too large: %d resources, %d tags", len(ids), len(ts))
+		}
+		// fail the first call once to test the retry
+		if calls == 1 {
+			failures++
+			return errors.New("throttled")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 resource chunks x 2 tag chunks + 1 retry
+	if calls != 7 || failures != 1 {
+		t.Fatalf("unexpected calls %d, failures %d", calls, failures)
+	}
+
+	err = batchTags(context.Background(), ids[:1], ConvertTags("", m), func(ctx context.Context, ids []string, ts []aws_ec2_v2_types.Tag) error {
+		return errors.New("denied")
+	}, WithRetryErrFunc(func(error) bool { return false }))
+	if err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("expected the denied error, got %v", err)
+	}
+}
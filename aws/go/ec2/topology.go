@@ -0,0 +1,146 @@
+package ec2
+
+import (
+	"context"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Represents the VPC peering connection.
+// ref. https://docs.aws.amazon.com/vpc/latest/peering/what-is-vpc-peering.html
+type VPCPeeringConnection struct {
+	ID        string            `json:"id"`
+	Status    string            `json:"status"`
+	Requester VPCPeer           `json:"requester"`
+	Accepter  VPCPeer           `json:"accepter"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// Represents one side of the VPC peering connection.
+type VPCPeer struct {
+	VPCID   string   `json:"vpc_id"`
+	OwnerID string   `json:"owner_id"`
+	Region  string   `json:"region"`
+	CIDRs   []string `json:"cidrs,omitempty"`
+}
+
+func convertVPCPeer(info *aws_ec2_v2_types.VpcPeeringConnectionVpcInfo) VPCPeer {
+	if info == nil {
+		return VPCPeer{}
+	}
+	p := VPCPeer{
+		VPCID:   aws.ToString(info.VpcId),
+		OwnerID: aws.ToString(info.OwnerId),
+		Region:  aws.ToString(info.Region),
+	}
+	for _, c := range info.CidrBlockSet {
+		p.CIDRs = append(p.CIDRs, aws.ToString(c.CidrBlock))
+	}
+	if len(p.CIDRs) == 0 && info.CidrBlock != nil {
+		p.CIDRs = []string{*info.CidrBlock}
+	}
+	for _, c := range info.Ipv6CidrBlockSet {
+		p.CIDRs = append(p.CIDRs, aws.ToString(c.Ipv6CidrBlock))
+	}
+	return p
+}
+
+// Lists the VPC peering connections by filter (e.g., "requester-vpc-info.vpc-id", "status-code").
+func ListVPCPeeringConnections(ctx context.Context, cfg aws.Config, opts ...OpOption) ([]VPCPeeringConnection, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cli := newClient(cfg)
+	pg := aws_ec2_v2.NewDescribeVpcPeeringConnectionsPaginator(cli, &aws_ec2_v2.DescribeVpcPeeringConnectionsInput{
+		Filters: convertFilters(ret.filters),
+	})
+	pcxs := make([]VPCPeeringConnection, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range out.VpcPeeringConnections {
+			pcx := VPCPeeringConnection{
+				ID:        aws.ToString(raw.VpcPeeringConnectionId),
+				Requester: convertVPCPeer(raw.RequesterVpcInfo),
+				Accepter:  convertVPCPeer(raw.AccepterVpcInfo),
+				Tags:      convertTagsToMap(raw.Tags),
+			}
+			if raw.Status != nil {
+				pcx.Status = string(raw.Status.Code)
+			}
+			pcxs = append(pcxs, pcx)
+		}
+	}
+	logutil.S().Infow("listed VPC peering connections", "filters", ret.filters, "vpcPeeringConnections", len(pcxs))
+	return pcxs, nil
+}
+
+// Represents the transit gateway attachment (e.g., VPC, VPN, peering).
+// ref. https://docs.aws.amazon.com/vpc/latest/tgw/tgw-attachments.html
+type TransitGatewayAttachment struct {
+	ID               string            `json:"id"`
+	TransitGatewayID string            `json:"transit_gateway_id"`
+	ResourceType     string            `json:"resource_type"`
+	ResourceID       string            `json:"resource_id"`
+	ResourceOwnerID  string            `json:"resource_owner_id"`
+	State            string            `json:"state"`
+	RouteTableID     string            `json:"route_table_id,omitempty"`
+	AssociationState string            `json:"association_state,omitempty"`
+	CreatedAt        *time.Time        `json:"created_at,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+}
+
+// Lists the transit gateway attachments by filter (e.g., "transit-gateway-id", "resource-type", "resource-id").
+func ListTransitGatewayAttachments(ctx context.Context, cfg aws.Config, opts ...OpOption) ([]TransitGatewayAttachment, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cli := newClient(cfg)
+	pg := aws_ec2_v2.NewDescribeTransitGatewayAttachmentsPaginator(cli, &aws_ec2_v2.DescribeTransitGatewayAttachmentsInput{
+		Filters: convertFilters(ret.filters),
+	})
+	atts := make([]TransitGatewayAttachment, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, raw := range out.TransitGatewayAttachments {
+			att := TransitGatewayAttachment{
+				ID:               aws.ToString(raw.TransitGatewayAttachmentId),
+				TransitGatewayID: aws.ToString(raw.TransitGatewayId),
+				ResourceType:     string(raw.ResourceType),
+				ResourceID:       aws.ToString(raw.ResourceId),
+				ResourceOwnerID:  aws.ToString(raw.ResourceOwnerId),
+				State:            string(raw.State),
+				CreatedAt:        raw.CreationTime,
+				Tags:             convertTagsToMap(raw.Tags),
+			}
+			if raw.Association != nil {
+				att.RouteTableID = aws.ToString(raw.Association.TransitGatewayRouteTableId)
+				att.AssociationState = string(raw.Association.State)
+			}
+			atts = append(atts, att)
+		}
+	}
+	logutil.S().Infow("listed transit gateway attachments", "filters", ret.filters, "attachments", len(atts))
+	return atts, nil
+}
+
+func convertTagsToMap(tags []aws_ec2_v2_types.Tag) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(tags))
+	for _, tg := range tags {
+		m[aws.ToString(tg.Key)] = aws.ToString(tg.Value)
+	}
+	return m
+}
@@ -0,0 +1,38 @@
+package ec2
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestConvertVPCPeer(t *testing.T) {
+	p := convertVPCPeer(&aws_ec2_v2_types.VpcPeeringConnectionVpcInfo{
+		VpcId:     aws.String("vpc-1"),
+		OwnerId:   aws.String("123"),
+		Region:    aws.String("us-west-2"),
+		CidrBlock: aws.String("10.0.0.0/16"),
+		CidrBlockSet: []aws_ec2_v2_types.CidrBlock{
+			{CidrBlock: aws.String("10.0.0.0/16")},
+			{CidrBlock: aws.String("10.1.0.0/16")},
+		},
+		Ipv6CidrBlockSet: []aws_ec2_v2_types.Ipv6CidrBlock{
+			{Ipv6CidrBlock: aws.String("2600:1f14::/56")},
+		},
+	})
+	exp := VPCPeer{
+		VPCID:   "vpc-1",
+		OwnerID: "123",
+		Region:  "us-west-2",
+		CIDRs:   []string{"10.0.0.0/16", "10.1.0.0/16", "2600:1f14::/56"},
+	}
+	if !reflect.DeepEqual(p, exp) {
+		t.Fatalf("expected %+v, got %+v", exp, p)
+	}
+
+	if p := convertVPCPeer(nil); !reflect.DeepEqual(p, VPCPeer{}) {
+		t.Fatalf("expected empty peer, got %+v", p)
+	}
+}
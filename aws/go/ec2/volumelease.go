@@ -0,0 +1,130 @@
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Represents the volume lease tag value "[holder]_[unix timestamp]"
+// (e.g., i-12345678_1662596730 means i-12345678 acquired the lease at the unix timestamp 1662596730).
+type VolumeLease struct {
+	Holder   string
+	LeasedAt time.Time
+}
+
+func (l VolumeLease) String() string {
+	return fmt.Sprintf("%s_%d", l.Holder, l.LeasedAt.Unix())
+}
+
+// Returns true if the lease is expired with the TTL.
+func (l VolumeLease) Expired(now time.Time, ttl time.Duration) bool {
+	return now.Sub(l.LeasedAt) > ttl
+}
+
+func ParseVolumeLease(v string) (VolumeLease, error) {
+	idx := strings.LastIndex(v, "_")
+	if idx <= 0 {
+		return VolumeLease{}, fmt.Errorf("unexpected lease value %q", v)
+	}
+	unix, err := strconv.ParseInt(v[idx+1:], 10, 64)
+	if err != nil {
+		return VolumeLease{}, fmt.Errorf("failed to parse lease value %q (%w)", v, err)
+	}
+	return VolumeLease{Holder: v[:idx], LeasedAt: time.Unix(unix, 0).UTC()}, nil
+}
+
+// Returns true if the holder can take the volume lease, that is, not leased,
+// leased by the same holder (e.g., restarted), or leased by the other holder but expired.
+func VolumeLeaseTakeable(vol aws_ec2_v2_types.Volume, leaseTagKey string, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	v, ok := convertTagsToMap(vol.Tags)[leaseTagKey]
+	if !ok {
+		return true, nil
+	}
+	lease, err := ParseVolumeLease(v)
+	if err != nil {
+		return false, err
+	}
+	if lease.Holder == holder {
+		return true, nil
+	}
+	return lease.Expired(now, ttl), nil
+}
+
+const (
+	defaultVolumeClaimSettle   = 5 * time.Second
+	defaultVolumeClaimVerifies = 2
+)
+
+// Claims the available volume for the holder (e.g., instance ID) by the lease tag,
+// so that the instances competing for the same pool of tagged volumes never attach the same volume.
+// EC2 tags have no conditional writes, so the claim is last-writer-wins:
+// writes the lease, waits for the concurrent writes to settle ("WithInterval", default 5 seconds),
+// and verifies the lease is still ours by reading it back (twice, to tolerate the stale reads).
+// Returns false if the volume is leased by the other holder, or the other holder won the claim.
+func ClaimVolume(ctx context.Context, cfg aws.Config, volumeID string, leaseTagKey string, holder string, ttl time.Duration, opts ...OpOption) (bool, error) {
+	ret := &Op{interval: defaultVolumeClaimSettle}
+	ret.applyOpts(opts)
+
+	vol, err := describeVolume(ctx, cfg, volumeID)
+	if err != nil {
+		return false, err
+	}
+	if vol.State != aws_ec2_v2_types.VolumeStateAvailable {
+		logutil.S().Infow("volume not available to claim", "volumeID", volumeID, "state", vol.State)
+		return false, nil
+	}
+	ok, err := VolumeLeaseTakeable(vol, leaseTagKey, holder, time.Now(), ttl)
+	if err != nil || !ok {
+		logutil.S().Infow("volume leased by the other holder", "volumeID", volumeID, "error", err)
+		return false, err
+	}
+
+	lease := VolumeLease{Holder: holder, LeasedAt: time.Now().UTC()}.String()
+	logutil.S().Infow("claiming volume", "volumeID", volumeID, "lease", lease)
+	if err = CreateTags(ctx, cfg, []string{volumeID}, map[string]string{leaseTagKey: lease}); err != nil {
+		return false, err
+	}
+
+	for i := 0; i < defaultVolumeClaimVerifies; i++ {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(ret.interval):
+		}
+
+		vol, err = describeVolume(ctx, cfg, volumeID)
+		if err != nil {
+			return false, err
+		}
+		cur := convertTagsToMap(vol.Tags)[leaseTagKey]
+		if cur != lease {
+			logutil.S().Warnw("lost the volume claim to the other holder", "volumeID", volumeID, "lease", lease, "currentLease", cur)
+			return false, nil
+		}
+		if vol.State != aws_ec2_v2_types.VolumeStateAvailable {
+			logutil.S().Warnw("volume no longer available after claim", "volumeID", volumeID, "state", vol.State)
+			return false, nil
+		}
+	}
+	logutil.S().Infow("successfully claimed volume", "volumeID", volumeID, "lease", lease)
+	return true, nil
+}
+
+func describeVolume(ctx context.Context, cfg aws.Config, volumeID string) (aws_ec2_v2_types.Volume, error) {
+	vols, err := DescribeVolumes(ctx, cfg, map[string]string{"volume-id": volumeID})
+	if err != nil {
+		return aws_ec2_v2_types.Volume{}, err
+	}
+	if len(vols) != 1 {
+		return aws_ec2_v2_types.Volume{}, fmt.Errorf("expected 1 volume, got %d", len(vols))
+	}
+	return vols[0], nil
+}
@@ -0,0 +1,60 @@
+package ec2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+func TestParseVolumeLease(t *testing.T) {
+	lease, err := ParseVolumeLease("i-12345678_1662596730")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Holder != "i-12345678" || lease.LeasedAt.Unix() != 1662596730 {
+		t.Fatalf("unexpected lease %+v", lease)
+	}
+	if lease.String() != "i-12345678_1662596730" {
+		t.Fatalf("unexpected lease string %q", lease.String())
+	}
+
+	for _, v := range []string{"", "i-12345678", "_1662596730", "i-12345678_abc"} {
+		if _, err := ParseVolumeLease(v); err == nil {
+			t.Fatalf("expected error for %q", v)
+		}
+	}
+}
+
+func TestVolumeLeaseTakeable(t *testing.T) {
+	now := time.Unix(1662596730, 0)
+	ttl := 10 * time.Minute
+	volWithLease := func(v string) aws_ec2_v2_types.Volume {
+		return aws_ec2_v2_types.Volume{Tags: []aws_ec2_v2_types.Tag{{Key: aws.String("LeaseHold"), Value: aws.String(v)}}}
+	}
+
+	tt := []struct {
+		name     string
+		vol      aws_ec2_v2_types.Volume
+		expected bool
+		err      bool
+	}{
+		{name: "no lease", vol: aws_ec2_v2_types.Volume{}, expected: true},
+		{name: "same holder", vol: volWithLease(VolumeLease{Holder: "i-0", LeasedAt: now}.String()), expected: true},
+		{name: "other holder", vol: volWithLease(VolumeLease{Holder: "i-1", LeasedAt: now.Add(-time.Minute)}.String()), expected: false},
+		{name: "other holder expired", vol: volWithLease(VolumeLease{Holder: "i-1", LeasedAt: now.Add(-time.Hour)}.String()), expected: true},
+		{name: "invalid lease", vol: volWithLease("invalid"), err: true},
+	}
+	for _, tv := range tt {
+		t.Run(tv.name, func(t *testing.T) {
+			ok, err := VolumeLeaseTakeable(tv.vol, "LeaseHold", "i-0", now, ttl)
+			if tv.err != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tv.err, err)
+			}
+			if ok != tv.expected {
+				t.Fatalf("expected %v, got %v", tv.expected, ok)
+			}
+		})
+	}
+}
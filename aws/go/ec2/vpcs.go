@@ -29,7 +29,7 @@ type Subnets []Subnet
 func GetSubnet(ctx context.Context, cfg aws.Config, subnetID string) (Subnet, error) {
 	logutil.S().Infow("getting subnet", "subnetID", subnetID)
 
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 
 	out, err := cli.DescribeSubnets(ctx,
 		&aws_ec2_v2.DescribeSubnetsInput{
@@ -118,7 +118,7 @@ func (vss VPCs) String() string {
 
 // List VPCs.
 func ListVPCs(ctx context.Context, cfg aws.Config) (VPCs, error) {
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 
 	raw := make([]aws_ec2_v2_types.Vpc, 0, 10)
 	var nextToken *string = nil
@@ -161,7 +161,7 @@ func ListVPCs(ctx context.Context, cfg aws.Config) (VPCs, error) {
 }
 
 func GetVPC(ctx context.Context, cfg aws.Config, vpcID string) (VPC, error) {
-	cli := aws_ec2_v2.NewFromConfig(cfg)
+	cli := newClient(cfg)
 
 	out, err := cli.DescribeVpcs(ctx,
 		&aws_ec2_v2.DescribeVpcsInput{
@@ -0,0 +1,223 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ec2_v2 "github.com/aws/aws-sdk-go-v2/service/ec2"
+	aws_ec2_v2_types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+const (
+	defaultWaitInterval = 10 * time.Second
+	defaultWaitBackoff  = 1.0
+)
+
+// Reports the progress of each poll to the function set by "WithProgressFunc".
+type WaitProgress struct {
+	Attempt int
+	Elapsed time.Duration
+	// Describes the current state (e.g., "pending").
+	Status string
+	// Non-nil if the poll failed, which is retried until the context is done.
+	Error error
+}
+
+// Polls the condition once, and returns true once the waited-for state is reached.
+// The returned status is reported to the progress function.
+// Returning an error stops the wait only if it wraps "ErrStopWait".
+type WaitCondition func(ctx context.Context) (done bool, status string, err error)
+
+// Wrapped by the condition error to stop the wait immediately, instead of retrying.
+var ErrStopWait = errors.New("stop wait")
+
+// Polls the condition until it is done, the context is done, or the condition returns "ErrStopWait".
+// The first poll is done immediately, and the next polls wait for the interval set by "WithInterval"
+// (default 10 seconds), multiplied by "WithBackoff" after each poll, up to "WithMaxInterval".
+// A random jitter of up to half the interval is applied, to spread the API calls from many waiters.
+func WaitUntil(ctx context.Context, desc string, cond WaitCondition, opts ...OpOption) error {
+	ret := &Op{interval: defaultWaitInterval, backoff: defaultWaitBackoff}
+	ret.applyOpts(opts)
+	if ret.interval <= 0 {
+		ret.interval = defaultWaitInterval
+	}
+	if ret.backoff < 1 {
+		ret.backoff = defaultWaitBackoff
+	}
+
+	logutil.S().Infow("waiting", "desc", desc, "interval", ret.interval, "backoff", ret.backoff, "maxInterval", ret.maxInterval)
+	start := time.Now()
+	interval := ret.interval
+	for attempt := 1; ; attempt++ {
+		done, status, err := cond(ctx)
+		if ret.progressFunc != nil {
+			ret.progressFunc(WaitProgress{Attempt: attempt, Elapsed: time.Since(start), Status: status, Error: err})
+		}
+		if err != nil {
+			if errors.Is(err, ErrStopWait) {
+				return err
+			}
+			logutil.S().Warnw("wait condition failed -- retrying", "desc", desc, "attempt", attempt, "error", err)
+		}
+		if done && err == nil {
+			logutil.S().Infow("wait done", "desc", desc, "status", status, "attempts", attempt, "took", time.Since(start))
+			return nil
+		}
+
+		wait := interval/2 + time.Duration(rand.Int63n(int64(interval/2)+1))
+		logutil.S().Infow("wait condition not met yet", "desc", desc, "status", status, "attempt", attempt, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w (last status %q)", desc, ctx.Err(), status)
+		case <-time.After(wait):
+		}
+
+		interval = time.Duration(float64(interval) * ret.backoff)
+		if ret.maxInterval > 0 && interval > ret.maxInterval {
+			interval = ret.maxInterval
+		}
+	}
+}
+
+// Waits until the instance reaches the state.
+// Stops waiting if the instance is terminated while waiting for another state.
+func WaitForInstanceState(ctx context.Context, cfg aws.Config, instanceID string, state aws_ec2_v2_types.InstanceStateName, opts ...OpOption) (aws_ec2_v2_types.Instance, error) {
+	var inst aws_ec2_v2_types.Instance
+	err := WaitUntil(ctx, fmt.Sprintf("instance %s %s", instanceID, state), func(ctx context.Context) (bool, string, error) {
+		var err error
+		inst, err = GetInstance(ctx, cfg, instanceID)
+		if err != nil {
+			return false, "", err
+		}
+		cur := aws_ec2_v2_types.InstanceStateName("")
+		if inst.State != nil {
+			cur = inst.State.Name
+		}
+		if cur != state && cur == aws_ec2_v2_types.InstanceStateNameTerminated {
+			return false, string(cur), fmt.Errorf("instance %s terminated: %w", instanceID, ErrStopWait)
+		}
+		return cur == state, string(cur), nil
+	}, opts...)
+	return inst, err
+}
+
+// Waits until the EIP is associated.
+// If the instance ID is not empty, waits until the EIP is associated with the instance.
+func WaitForAddressAssociated(ctx context.Context, cfg aws.Config, allocationID string, instanceID string, opts ...OpOption) (aws_ec2_v2_types.Address, error) {
+	var addr aws_ec2_v2_types.Address
+	err := WaitUntil(ctx, fmt.Sprintf("EIP %s associated", allocationID), func(ctx context.Context) (bool, string, error) {
+		addrs, err := ListEIPs(ctx, cfg, WithFilters(map[string][]string{"allocation-id": {allocationID}}))
+		if err != nil {
+			return false, "", err
+		}
+		if len(addrs) == 0 {
+			return false, "", fmt.Errorf("EIP %s not found: %w", allocationID, ErrStopWait)
+		}
+		addr = addrs[0]
+		if addr.AssociationId == nil {
+			return false, "disassociated", nil
+		}
+		cur := aws.ToString(addr.InstanceId)
+		if instanceID != "" && cur != instanceID {
+			return false, "associated with " + cur, nil
+		}
+		return true, "associated with " + cur, nil
+	}, opts...)
+	return addr, err
+}
+
+// Waits until the volume is attached to the instance.
+func WaitForVolumeAttached(ctx context.Context, cfg aws.Config, volumeID string, instanceID string, opts ...OpOption) (aws_ec2_v2_types.Volume, error) {
+	cli := newClient(cfg)
+
+	var vol aws_ec2_v2_types.Volume
+	err := WaitUntil(ctx, fmt.Sprintf("volume %s attached to %s", volumeID, instanceID), func(ctx context.Context) (bool, string, error) {
+		out, err := cli.DescribeVolumes(ctx, &aws_ec2_v2.DescribeVolumesInput{
+			VolumeIds: []string{volumeID},
+		})
+		if err != nil {
+			return false, "", err
+		}
+		if len(out.Volumes) != 1 {
+			return false, "", fmt.Errorf("expected 1 volume, got %d", len(out.Volumes))
+		}
+		vol = out.Volumes[0]
+		if vol.State == aws_ec2_v2_types.VolumeStateDeleting || vol.State == aws_ec2_v2_types.VolumeStateDeleted {
+			return false, string(vol.State), fmt.Errorf("volume %s %s: %w", volumeID, vol.State, ErrStopWait)
+		}
+		for _, att := range vol.Attachments {
+			if aws.ToString(att.InstanceId) != instanceID {
+				continue
+			}
+			return att.State == aws_ec2_v2_types.VolumeAttachmentStateAttached, string(att.State), nil
+		}
+		return false, string(vol.State), nil
+	}, opts...)
+	return vol, err
+}
+
+// Waits until the volume is detached and available.
+func WaitForVolumeDetached(ctx context.Context, cfg aws.Config, volumeID string, opts ...OpOption) (aws_ec2_v2_types.Volume, error) {
+	cli := newClient(cfg)
+
+	var vol aws_ec2_v2_types.Volume
+	err := WaitUntil(ctx, fmt.Sprintf("volume %s detached", volumeID), func(ctx context.Context) (bool, string, error) {
+		out, err := cli.DescribeVolumes(ctx, &aws_ec2_v2.DescribeVolumesInput{
+			VolumeIds: []string{volumeID},
+		})
+		if err != nil {
+			return false, "", err
+		}
+		if len(out.Volumes) != 1 {
+			return false, "", fmt.Errorf("expected 1 volume, got %d", len(out.Volumes))
+		}
+		vol = out.Volumes[0]
+		if vol.State == aws_ec2_v2_types.VolumeStateDeleting || vol.State == aws_ec2_v2_types.VolumeStateDeleted {
+			return false, string(vol.State), fmt.Errorf("volume %s %s: %w", volumeID, vol.State, ErrStopWait)
+		}
+		return vol.State == aws_ec2_v2_types.VolumeStateAvailable, string(vol.State), nil
+	}, opts...)
+	return vol, err
+}
+
+// Waits until the latest modification of the volume is "optimizing" or "completed",
+// when the modified size and performance are usable.
+// ref. https://docs.aws.amazon.com/ebs/latest/userguide/monitoring-volume-modifications.html
+func WaitForVolumeModification(ctx context.Context, cfg aws.Config, volumeID string, opts ...OpOption) (aws_ec2_v2_types.VolumeModification, error) {
+	cli := newClient(cfg)
+
+	var mod aws_ec2_v2_types.VolumeModification
+	err := WaitUntil(ctx, fmt.Sprintf("volume %s modification", volumeID), func(ctx context.Context) (bool, string, error) {
+		out, err := cli.DescribeVolumesModifications(ctx, &aws_ec2_v2.DescribeVolumesModificationsInput{
+			VolumeIds: []string{volumeID},
+		})
+		if err != nil {
+			return false, "", err
+		}
+		if len(out.VolumesModifications) == 0 {
+			return false, "", nil
+		}
+		mod = out.VolumesModifications[0]
+		for _, m := range out.VolumesModifications[1:] {
+			if aws.ToTime(m.StartTime).After(aws.ToTime(mod.StartTime)) {
+				mod = m
+			}
+		}
+		status := fmt.Sprintf("%s %d%%", mod.ModificationState, aws.ToInt64(mod.Progress))
+		switch mod.ModificationState {
+		case aws_ec2_v2_types.VolumeModificationStateOptimizing,
+			aws_ec2_v2_types.VolumeModificationStateCompleted:
+			return true, status, nil
+		case aws_ec2_v2_types.VolumeModificationStateFailed:
+			return false, status, fmt.Errorf("volume %s modification failed (%s): %w", volumeID, aws.ToString(mod.StatusMessage), ErrStopWait)
+		}
+		return false, status, nil
+	}, opts...)
+	return mod, err
+}
@@ -0,0 +1,54 @@
+package ec2
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitUntil(t *testing.T) {
+	progress := make([]WaitProgress, 0)
+	n := 0
+	err := WaitUntil(context.Background(), "test", func(ctx context.Context) (bool, string, error) {
+		n++
+		if n == 2 {
+			return false, "failing", errors.New("transient")
+		}
+		return n == 3, "pending", nil
+	},
+		WithInterval(10*time.Millisecond),
+		WithBackoff(2),
+		WithMaxInterval(20*time.Millisecond),
+		WithProgressFunc(func(p WaitProgress) { progress = append(progress, p) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 3 {
+		t.Fatalf("expected 3 progress reports, got %d", len(progress))
+	}
+	if progress[1].Error == nil || progress[2].Attempt != 3 {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+}
+
+func TestWaitUntilStop(t *testing.T) {
+	err := WaitUntil(context.Background(), "test", func(ctx context.Context) (bool, string, error) {
+		return false, "", ErrStopWait
+	}, WithInterval(time.Millisecond))
+	if !errors.Is(err, ErrStopWait) {
+		t.Fatalf("expected ErrStopWait, got %v", err)
+	}
+}
+
+func TestWaitUntilTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := WaitUntil(ctx, "test", func(ctx context.Context) (bool, string, error) {
+		return false, "pending", nil
+	}, WithInterval(10*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
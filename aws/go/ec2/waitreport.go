@@ -0,0 +1,91 @@
+package ec2
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Wait phase names for the boot-latency instrumentation.
+const (
+	WaitPhaseASGTag      = "asg-tag"
+	WaitPhaseCredentials = "credentials"
+	WaitPhaseEIP         = "eip"
+)
+
+// Records how long a boot-time dependency took to become usable
+// (e.g., tag propagation, IAM credentials, EIP allocation and association).
+type WaitPhase struct {
+	Name        string    `json:"name"`
+	StartedAt   time.Time `json:"started_at"`
+	TookSeconds float64   `json:"took_seconds"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Reports the wait phases of the instance, in the order of observation.
+type WaitReport struct {
+	InstanceID string      `json:"instance_id"`
+	Phases     []WaitPhase `json:"phases"`
+}
+
+// Records the phase that started at "start" and completed now, with the error if any.
+func (r *WaitReport) Observe(name string, start time.Time, err error) WaitPhase {
+	ph := WaitPhase{
+		Name:        name,
+		StartedAt:   start.UTC(),
+		TookSeconds: time.Since(start).Seconds(),
+	}
+	if err != nil {
+		ph.Error = err.Error()
+	}
+	r.Phases = append(r.Phases, ph)
+	return ph
+}
+
+// Returns the phase by name, or false if not observed.
+func (r WaitReport) Find(name string) (WaitPhase, bool) {
+	for _, ph := range r.Phases {
+		if ph.Name == name {
+			return ph, true
+		}
+	}
+	return WaitPhase{}, false
+}
+
+func (r WaitReport) Sync(p string) error {
+	parentDir := filepath.Dir(p)
+	if parentDir != "" && parentDir != "/" {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r WaitReport) String() string {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+func LoadWaitReport(p string) (WaitReport, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return WaitReport{}, err
+	}
+	var r WaitReport
+	if err := json.Unmarshal(b, &r); err != nil {
+		return WaitReport{}, err
+	}
+	return r, nil
+}
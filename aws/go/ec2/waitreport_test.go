@@ -0,0 +1,39 @@
+package ec2
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWaitReportSyncLoad(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "wait-report.json")
+
+	r := WaitReport{InstanceID: "i-12345678"}
+	r.Observe(WaitPhaseASGTag, time.Now().Add(-3*time.Second), nil)
+	r.Observe(WaitPhaseEIP, time.Now(), errors.New("AuthFailure"))
+	if err := r.Sync(p); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadWaitReport(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, loaded) {
+		t.Fatalf("expected %v, got %v", r, loaded)
+	}
+
+	ph, ok := loaded.Find(WaitPhaseASGTag)
+	if !ok || ph.TookSeconds < 3 || ph.Error != "" {
+		t.Fatalf("unexpected phase %+v (found %v)", ph, ok)
+	}
+	ph, ok = loaded.Find(WaitPhaseEIP)
+	if !ok || ph.Error != "AuthFailure" {
+		t.Fatalf("unexpected phase %+v (found %v)", ph, ok)
+	}
+	if _, ok = loaded.Find(WaitPhaseCredentials); ok {
+		t.Fatal("unexpected credentials phase")
+	}
+}
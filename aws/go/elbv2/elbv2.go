@@ -0,0 +1,278 @@
+// Package elbv2 implements ELBv2 (ALB/NLB) utils.
+package elbv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_elbv2_v2 "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	aws_elbv2_v2_types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+type Op struct {
+	interval time.Duration
+	port     int32
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Sets the poll interval.
+func WithInterval(v time.Duration) OpOption {
+	return func(op *Op) {
+		op.interval = v
+	}
+}
+
+// Sets the target port, to override the target group port
+// (e.g., the same instance registered with multiple ports).
+func WithPort(v int32) OpOption {
+	return func(op *Op) {
+		op.port = v
+	}
+}
+
+// Represents the target group.
+type TargetGroup struct {
+	ARN        string            `json:"arn"`
+	Name       string            `json:"name"`
+	Protocol   string            `json:"protocol"`
+	Port       int32             `json:"port"`
+	TargetType string            `json:"target_type"`
+	VPCID      string            `json:"vpc_id"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+// Returned when no target group matches the tags.
+var ErrTargetGroupNotFound = errors.New("target group not found")
+
+// Fetches the target group by ARN.
+func GetTargetGroup(ctx context.Context, cfg aws.Config, targetGroupARN string) (TargetGroup, error) {
+	cli := aws_elbv2_v2.NewFromConfig(cfg)
+	out, err := cli.DescribeTargetGroups(ctx, &aws_elbv2_v2.DescribeTargetGroupsInput{
+		TargetGroupArns: []string{targetGroupARN},
+	})
+	if err != nil {
+		return TargetGroup{}, err
+	}
+	if len(out.TargetGroups) != 1 {
+		return TargetGroup{}, fmt.Errorf("expected 1 target group, got %d", len(out.TargetGroups))
+	}
+	return convertTargetGroup(out.TargetGroups[0]), nil
+}
+
+// Finds the target group whose tags match all the tags.
+// Returns "ErrTargetGroupNotFound" if none found, or an error if more than one found.
+func FindTargetGroupByTags(ctx context.Context, cfg aws.Config, tags map[string]string) (TargetGroup, error) {
+	logutil.S().Infow("finding target group by tags", "tags", tags)
+
+	cli := aws_elbv2_v2.NewFromConfig(cfg)
+	pg := aws_elbv2_v2.NewDescribeTargetGroupsPaginator(cli, &aws_elbv2_v2.DescribeTargetGroupsInput{})
+	tgs := make(map[string]TargetGroup)
+	arns := make([]string, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return TargetGroup{}, err
+		}
+		for _, raw := range out.TargetGroups {
+			tg := convertTargetGroup(raw)
+			tgs[tg.ARN] = tg
+			arns = append(arns, tg.ARN)
+		}
+	}
+
+	matched := make([]TargetGroup, 0, 1)
+	// ref. https://docs.aws.amazon.com/elasticloadbalancing/latest/APIReference/API_DescribeTags.html
+	for len(arns) > 0 {
+		n := min(len(arns), 20)
+		out, err := cli.DescribeTags(ctx, &aws_elbv2_v2.DescribeTagsInput{
+			ResourceArns: arns[:n],
+		})
+		if err != nil {
+			return TargetGroup{}, err
+		}
+		arns = arns[n:]
+
+		for _, desc := range out.TagDescriptions {
+			m := convertTags(desc.Tags)
+			if !matchTags(m, tags) {
+				continue
+			}
+			tg := tgs[aws.ToString(desc.ResourceArn)]
+			tg.Tags = m
+			matched = append(matched, tg)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return TargetGroup{}, ErrTargetGroupNotFound
+	case 1:
+		logutil.S().Infow("found target group", "arn", matched[0].ARN, "name", matched[0].Name)
+		return matched[0], nil
+	default:
+		return TargetGroup{}, fmt.Errorf("expected 1 target group, found %d for tags %v", len(matched), tags)
+	}
+}
+
+// Registers the targets (e.g., instance IDs) to the target group.
+// Use "WithPort" to override the target group port.
+func RegisterTargets(ctx context.Context, cfg aws.Config, targetGroupARN string, targetIDs []string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("registering targets", "targetGroupARN", targetGroupARN, "targetIDs", targetIDs, "port", ret.port)
+	cli := aws_elbv2_v2.NewFromConfig(cfg)
+	_, err := cli.RegisterTargets(ctx, &aws_elbv2_v2.RegisterTargetsInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+		Targets:        toTargetDescriptions(targetIDs, ret.port),
+	})
+	if err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully registered targets", "targetGroupARN", targetGroupARN, "targetIDs", targetIDs)
+	return nil
+}
+
+// Deregisters the targets from the target group.
+// Use "WithPort" if the targets were registered with the port.
+func DeregisterTargets(ctx context.Context, cfg aws.Config, targetGroupARN string, targetIDs []string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("deregistering targets", "targetGroupARN", targetGroupARN, "targetIDs", targetIDs, "port", ret.port)
+	cli := aws_elbv2_v2.NewFromConfig(cfg)
+	_, err := cli.DeregisterTargets(ctx, &aws_elbv2_v2.DeregisterTargetsInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+		Targets:        toTargetDescriptions(targetIDs, ret.port),
+	})
+	if err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully deregistered targets", "targetGroupARN", targetGroupARN, "targetIDs", targetIDs)
+	return nil
+}
+
+// Represents the health of the target in the target group.
+// ref. https://docs.aws.amazon.com/elasticloadbalancing/latest/APIReference/API_TargetHealth.html
+type TargetHealth struct {
+	TargetID    string `json:"target_id"`
+	Port        int32  `json:"port"`
+	State       string `json:"state"`
+	Reason      string `json:"reason,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Describes the health of the targets in the target group.
+// If the target IDs are empty, describes all the registered targets.
+func DescribeTargetHealth(ctx context.Context, cfg aws.Config, targetGroupARN string, targetIDs []string, opts ...OpOption) ([]TargetHealth, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cli := aws_elbv2_v2.NewFromConfig(cfg)
+	input := &aws_elbv2_v2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+	}
+	if len(targetIDs) > 0 {
+		input.Targets = toTargetDescriptions(targetIDs, ret.port)
+	}
+	out, err := cli.DescribeTargetHealth(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	hs := make([]TargetHealth, 0, len(out.TargetHealthDescriptions))
+	for _, desc := range out.TargetHealthDescriptions {
+		h := TargetHealth{}
+		if desc.Target != nil {
+			h.TargetID = aws.ToString(desc.Target.Id)
+			h.Port = aws.ToInt32(desc.Target.Port)
+		}
+		if desc.TargetHealth != nil {
+			h.State = string(desc.TargetHealth.State)
+			h.Reason = string(desc.TargetHealth.Reason)
+			h.Description = aws.ToString(desc.TargetHealth.Description)
+		}
+		hs = append(hs, h)
+	}
+	return hs, nil
+}
+
+// Waits until the target is registered and in service (healthy), up to the max wait duration.
+func WaitForTargetInService(ctx context.Context, cfg aws.Config, targetGroupARN string, targetID string, maxWait time.Duration, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("waiting for target in service", "targetGroupARN", targetGroupARN, "targetID", targetID, "maxWait", maxWait)
+	cli := aws_elbv2_v2.NewFromConfig(cfg)
+	return aws_elbv2_v2.NewTargetInServiceWaiter(cli).Wait(ctx, &aws_elbv2_v2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+		Targets:        toTargetDescriptions([]string{targetID}, ret.port),
+	}, maxWait)
+}
+
+// Waits until the target is deregistered (after the connection draining), up to the max wait duration.
+func WaitForTargetDeregistered(ctx context.Context, cfg aws.Config, targetGroupARN string, targetID string, maxWait time.Duration, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("waiting for target deregistered", "targetGroupARN", targetGroupARN, "targetID", targetID, "maxWait", maxWait)
+	cli := aws_elbv2_v2.NewFromConfig(cfg)
+	return aws_elbv2_v2.NewTargetDeregisteredWaiter(cli).Wait(ctx, &aws_elbv2_v2.DescribeTargetHealthInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+		Targets:        toTargetDescriptions([]string{targetID}, ret.port),
+	}, maxWait)
+}
+
+func convertTargetGroup(raw aws_elbv2_v2_types.TargetGroup) TargetGroup {
+	return TargetGroup{
+		ARN:        aws.ToString(raw.TargetGroupArn),
+		Name:       aws.ToString(raw.TargetGroupName),
+		Protocol:   string(raw.Protocol),
+		Port:       aws.ToInt32(raw.Port),
+		TargetType: string(raw.TargetType),
+		VPCID:      aws.ToString(raw.VpcId),
+	}
+}
+
+func convertTags(tags []aws_elbv2_v2_types.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tg := range tags {
+		m[aws.ToString(tg.Key)] = aws.ToString(tg.Value)
+	}
+	return m
+}
+
+// Returns true if the tags have all the selector tags.
+func matchTags(tags map[string]string, selector map[string]string) bool {
+	for k, v := range selector {
+		if cur, ok := tags[k]; !ok || cur != v {
+			return false
+		}
+	}
+	return true
+}
+
+func toTargetDescriptions(targetIDs []string, port int32) []aws_elbv2_v2_types.TargetDescription {
+	ts := make([]aws_elbv2_v2_types.TargetDescription, 0, len(targetIDs))
+	for _, id := range targetIDs {
+		t := aws_elbv2_v2_types.TargetDescription{Id: aws.String(id)}
+		if port > 0 {
+			t.Port = aws.Int32(port)
+		}
+		ts = append(ts, t)
+	}
+	return ts
+}
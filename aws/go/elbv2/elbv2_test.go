@@ -0,0 +1,37 @@
+package elbv2
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestMatchTags(t *testing.T) {
+	tags := map[string]string{"Name": "tg-0", "Kind": "nlb"}
+	tt := []struct {
+		selector map[string]string
+		expected bool
+	}{
+		{selector: nil, expected: true},
+		{selector: map[string]string{"Kind": "nlb"}, expected: true},
+		{selector: map[string]string{"Kind": "nlb", "Name": "tg-0"}, expected: true},
+		{selector: map[string]string{"Kind": "alb"}, expected: false},
+		{selector: map[string]string{"Id": ""}, expected: false},
+	}
+	for i, tv := range tt {
+		if ok := matchTags(tags, tv.selector); ok != tv.expected {
+			t.Fatalf("#%d: expected %v, got %v", i, tv.expected, ok)
+		}
+	}
+}
+
+func TestToTargetDescriptions(t *testing.T) {
+	ts := toTargetDescriptions([]string{"i-0", "i-1"}, 0)
+	if len(ts) != 2 || aws.ToString(ts[1].Id) != "i-1" || ts[0].Port != nil {
+		t.Fatalf("unexpected targets %+v", ts)
+	}
+	ts = toTargetDescriptions([]string{"i-0"}, 8080)
+	if aws.ToInt32(ts[0].Port) != 8080 {
+		t.Fatalf("unexpected targets %+v", ts)
+	}
+}
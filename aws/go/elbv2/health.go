@@ -0,0 +1,132 @@
+package elbv2
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_elbv2_v2_types "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+)
+
+// Represents the target health state transition observed by "WatchTargetHealth".
+type TargetHealthTransition struct {
+	TargetID string `json:"target_id"`
+	Port     int32  `json:"port"`
+	// Previous state, empty for the first observation.
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	Reason      string    `json:"reason,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Time        time.Time `json:"time"`
+
+	// Non-nil if the target health failed to be described,
+	// and the watcher keeps polling.
+	Error error `json:"-"`
+}
+
+const defaultHealthWatchInterval = 5 * time.Second
+
+// Watches the health of the targets in the target group, and sends each state transition once
+// (including the first observed state). The channel is closed when the context is done.
+// Use "WithInterval" for the poll interval (default 5 seconds), and "WithPort" for the target port.
+func WatchTargetHealth(ctx context.Context, cfg aws.Config, targetGroupARN string, targetIDs []string, opts ...OpOption) <-chan TargetHealthTransition {
+	ret := &Op{interval: defaultHealthWatchInterval}
+	ret.applyOpts(opts)
+
+	ch := make(chan TargetHealthTransition, 10)
+	go func() {
+		defer close(ch)
+
+		prev := make(map[string]TargetHealth)
+		for {
+			hs, err := DescribeTargetHealth(ctx, cfg, targetGroupARN, targetIDs, opts...)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logutil.S().Warnw("failed to describe target health", "targetGroupARN", targetGroupARN, "error", err)
+				if !sendTransition(ctx, ch, TargetHealthTransition{Time: time.Now(), Error: err}) {
+					return
+				}
+			} else {
+				for _, tr := range diffTargetHealth(prev, hs, time.Now()) {
+					logutil.S().Infow("target health changed", "targetID", tr.TargetID, "port", tr.Port, "from", tr.From, "to", tr.To, "reason", tr.Reason)
+					if !sendTransition(ctx, ch, tr) {
+						return
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ret.interval):
+			}
+		}
+	}()
+	return ch
+}
+
+// Waits until the target is healthy in the target group, and returns the last health.
+// Fails fast if the target is not registered (e.g., deregistered by the other process).
+// Use "WithInterval" for the poll interval, and "WithPort" for the target port.
+func WaitForTargetHealthy(ctx context.Context, cfg aws.Config, targetGroupARN string, targetID string, opts ...OpOption) (TargetHealth, error) {
+	logutil.S().Infow("waiting for target healthy", "targetGroupARN", targetGroupARN, "targetID", targetID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var last TargetHealth
+	for tr := range WatchTargetHealth(ctx, cfg, targetGroupARN, []string{targetID}, opts...) {
+		if tr.Error != nil {
+			continue
+		}
+		last = TargetHealth{TargetID: tr.TargetID, Port: tr.Port, State: tr.To, Reason: tr.Reason, Description: tr.Description}
+		switch aws_elbv2_v2_types.TargetHealthStateEnum(tr.To) {
+		case aws_elbv2_v2_types.TargetHealthStateEnumHealthy:
+			logutil.S().Infow("target healthy", "targetGroupARN", targetGroupARN, "targetID", targetID)
+			return last, nil
+		case aws_elbv2_v2_types.TargetHealthStateEnumUnused:
+			if tr.Reason == string(aws_elbv2_v2_types.TargetHealthReasonEnumNotRegistered) {
+				return last, fmt.Errorf("target %s not registered in %s", targetID, targetGroupARN)
+			}
+		}
+	}
+	return last, fmt.Errorf("target %s not healthy in time (last state %q, reason %q): %w", targetID, last.State, last.Reason, ctx.Err())
+}
+
+// Returns the transitions from the previous health, and updates the previous health.
+func diffTargetHealth(prev map[string]TargetHealth, cur []TargetHealth, now time.Time) []TargetHealthTransition {
+	trs := make([]TargetHealthTransition, 0)
+	for _, h := range cur {
+		key := fmt.Sprintf("%s:%d", h.TargetID, h.Port)
+		p, ok := prev[key]
+		if ok && p.State == h.State && p.Reason == h.Reason {
+			continue
+		}
+		prev[key] = h
+		trs = append(trs, TargetHealthTransition{
+			TargetID:    h.TargetID,
+			Port:        h.Port,
+			From:        p.State,
+			To:          h.State,
+			Reason:      h.Reason,
+			Description: h.Description,
+			Time:        now,
+		})
+	}
+	return trs
+}
+
+func sendTransition(ctx context.Context, ch chan<- TargetHealthTransition, tr TargetHealthTransition) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case ch <- tr:
+		return true
+	}
+}
@@ -0,0 +1,43 @@
+package elbv2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffTargetHealth(t *testing.T) {
+	now := time.Now()
+	prev := make(map[string]TargetHealth)
+
+	trs := diffTargetHealth(prev, []TargetHealth{
+		{TargetID: "i-0", Port: 80, State: "initial", Reason: "Elb.RegistrationInProgress"},
+		{TargetID: "i-1", Port: 80, State: "healthy"},
+	}, now)
+	if len(trs) != 2 || trs[0].From != "" || trs[0].To != "initial" || trs[1].To != "healthy" {
+		t.Fatalf("unexpected transitions %+v", trs)
+	}
+
+	// no change
+	trs = diffTargetHealth(prev, []TargetHealth{
+		{TargetID: "i-0", Port: 80, State: "initial", Reason: "Elb.RegistrationInProgress"},
+		{TargetID: "i-1", Port: 80, State: "healthy"},
+	}, now)
+	if len(trs) != 0 {
+		t.Fatalf("unexpected transitions %+v", trs)
+	}
+
+	trs = diffTargetHealth(prev, []TargetHealth{
+		{TargetID: "i-0", Port: 80, State: "healthy"},
+		{TargetID: "i-1", Port: 80, State: "healthy"},
+		{TargetID: "i-1", Port: 8080, State: "unhealthy", Reason: "Target.FailedHealthChecks"},
+	}, now)
+	if len(trs) != 2 {
+		t.Fatalf("unexpected transitions %+v", trs)
+	}
+	if trs[0].TargetID != "i-0" || trs[0].From != "initial" || trs[0].To != "healthy" {
+		t.Fatalf("unexpected transition %+v", trs[0])
+	}
+	if trs[1].Port != 8080 || trs[1].From != "" || trs[1].To != "unhealthy" {
+		t.Fatalf("unexpected transition %+v", trs[1])
+	}
+}
@@ -0,0 +1,68 @@
+package aws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_http_v2 "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Returns the HTTP client for the AWS API calls that trusts the CA bundle
+// (e.g., the TLS-inspecting proxy CA) in addition to the system roots,
+// and sends the requests via the HTTPS proxy.
+// If the proxy is empty, "HTTPS_PROXY" is used. "NO_PROXY" is always honored.
+func newHTTPClient(caBundle string, httpsProxy string) (*aws_http_v2.BuildableClient, error) {
+	var roots *x509.CertPool
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %v", err)
+		}
+		roots, err = x509.SystemCertPool()
+		if err != nil {
+			logutil.S().Warnw("failed to load system cert pool, only trusting the CA bundle", "error", err)
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %q", caBundle)
+		}
+	}
+
+	proxyCfg := httpproxy.FromEnvironment()
+	if httpsProxy != "" {
+		if _, err := url.Parse(httpsProxy); err != nil {
+			return nil, fmt.Errorf("invalid HTTPS proxy %v", err)
+		}
+		proxyCfg.HTTPSProxy = httpsProxy
+	}
+	proxyFunc := proxyCfg.ProxyFunc()
+
+	logutil.S().Infow("creating http client", "caBundle", caBundle, "httpsProxy", redactProxy(proxyCfg.HTTPSProxy), "noProxy", proxyCfg.NoProxy)
+	return aws_http_v2.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+		if roots != nil {
+			if tr.TLSClientConfig == nil {
+				tr.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+			}
+			tr.TLSClientConfig.RootCAs = roots
+		}
+	}), nil
+}
+
+// Removes the password from the proxy URL for logging.
+func redactProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,207 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_middleware_v2 "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	aws_retry_v2 "github.com/aws/aws-sdk-go-v2/aws/retry"
+	smithy_middleware "github.com/aws/smithy-go/middleware"
+)
+
+// Represents the AWS API call recorded by the instrumentation middleware,
+// after all of its attempts complete.
+type APICall struct {
+	Service   string
+	Operation string
+	Region    string
+	RequestID string
+	Duration  time.Duration
+	// Number of the retried attempts (0 if the first attempt was the last).
+	Retries int
+	// Number of the attempts throttled by the service (e.g., "RequestLimitExceeded").
+	Throttles int
+	Err       error
+}
+
+// Called with each AWS API call made with the config.
+// Must be safe to call concurrently.
+type APICallHook func(APICall)
+
+var defaultThrottles = aws_retry_v2.IsErrorThrottles(aws_retry_v2.DefaultThrottles)
+
+// Adds the middleware to all the clients created from the config, to log the retried
+// (or throttled) API calls, and every API call if "logAll" is true, and to call the hooks.
+func instrumentAPICalls(awsCfg *aws_v2.Config, logAll bool, hooks []APICallHook) {
+	awsCfg.APIOptions = append(awsCfg.APIOptions, func(stack *smithy_middleware.Stack) error {
+		return stack.Initialize.Add(
+			smithy_middleware.InitializeMiddlewareFunc("APICallInstrument", func(ctx context.Context, in smithy_middleware.InitializeInput, next smithy_middleware.InitializeHandler) (smithy_middleware.InitializeOutput, smithy_middleware.Metadata, error) {
+				start := time.Now()
+				out, md, err := next.HandleInitialize(ctx, in)
+
+				call := newAPICall(ctx, md, err)
+				call.Duration = time.Since(start)
+				logAPICall(call, logAll)
+				for _, hook := range hooks {
+					hook(call)
+				}
+				return out, md, err
+			}),
+			// after the service metadata is registered
+			smithy_middleware.After,
+		)
+	})
+}
+
+func newAPICall(ctx context.Context, md smithy_middleware.Metadata, err error) APICall {
+	call := APICall{
+		Service:   aws_middleware_v2.GetServiceID(ctx),
+		Operation: aws_middleware_v2.GetOperationName(ctx),
+		Region:    aws_middleware_v2.GetRegion(ctx),
+		Err:       err,
+	}
+	if id, ok := aws_middleware_v2.GetRequestIDMetadata(md); ok {
+		call.RequestID = id
+	} else {
+		var rerr interface{ ServiceRequestID() string }
+		if errors.As(err, &rerr) {
+			call.RequestID = rerr.ServiceRequestID()
+		}
+	}
+	if results, ok := aws_retry_v2.GetAttemptResults(md); ok {
+		call.Retries, call.Throttles = countAttempts(results.Results)
+	}
+	return call
+}
+
+// Returns the number of the retried and the throttled attempts.
+func countAttempts(results []aws_retry_v2.AttemptResult) (retries int, throttles int) {
+	for _, r := range results {
+		if r.Retried {
+			retries++
+		}
+		if r.Err != nil && defaultThrottles.IsErrorThrottle(r.Err) == aws_v2.TrueTernary {
+			throttles++
+		}
+	}
+	return retries, throttles
+}
+
+func logAPICall(call APICall, logAll bool) {
+	fields := []interface{}{
+		"service", call.Service,
+		"operation", call.Operation,
+		"region", call.Region,
+		"requestID", call.RequestID,
+		"took", call.Duration,
+		"retries", call.Retries,
+		"throttles", call.Throttles,
+	}
+	if call.Err != nil {
+		fields = append(fields, "error", call.Err)
+	}
+	switch {
+	case call.Retries > 0 || call.Throttles > 0:
+		logutil.S().Warnw("retried aws api call", fields...)
+	case logAll:
+		logutil.S().Infow("aws api call", fields...)
+	}
+}
+
+// Aggregates the AWS API calls by the service and operation,
+// to expose in the Prometheus text format.
+// ref. https://prometheus.io/docs/instrumenting/exposition_formats/
+type APICallMetrics struct {
+	mu  sync.Mutex
+	ops map[apiOperation]*apiOperationMetrics
+}
+
+type apiOperation struct {
+	service   string
+	operation string
+}
+
+type apiOperationMetrics struct {
+	calls           int64
+	errors          int64
+	retries         int64
+	throttles       int64
+	durationSeconds float64
+}
+
+func NewAPICallMetrics() *APICallMetrics {
+	return &APICallMetrics{ops: make(map[apiOperation]*apiOperationMetrics)}
+}
+
+// Records the API call. Use as the "APICallHook".
+func (m *APICallMetrics) Observe(call APICall) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := apiOperation{service: call.Service, operation: call.Operation}
+	om, ok := m.ops[k]
+	if !ok {
+		om = &apiOperationMetrics{}
+		m.ops[k] = om
+	}
+	om.calls++
+	if call.Err != nil {
+		om.errors++
+	}
+	om.retries += int64(call.Retries)
+	om.throttles += int64(call.Throttles)
+	om.durationSeconds += call.Duration.Seconds()
+}
+
+// Writes the metrics in the Prometheus text format, sorted by the service and operation.
+func (m *APICallMetrics) WriteText(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]apiOperation, 0, len(m.ops))
+	for k := range m.ops {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].service != keys[j].service {
+			return keys[i].service < keys[j].service
+		}
+		return keys[i].operation < keys[j].operation
+	})
+
+	for _, mt := range []struct {
+		name string
+		typ  string
+		help string
+		v    func(*apiOperationMetrics) float64
+	}{
+		{"aws_api_calls_total", "counter", "Total number of AWS API calls.", func(om *apiOperationMetrics) float64 { return float64(om.calls) }},
+		{"aws_api_call_errors_total", "counter", "Total number of failed AWS API calls.", func(om *apiOperationMetrics) float64 { return float64(om.errors) }},
+		{"aws_api_call_retries_total", "counter", "Total number of retried AWS API call attempts.", func(om *apiOperationMetrics) float64 { return float64(om.retries) }},
+		{"aws_api_call_throttles_total", "counter", "Total number of throttled AWS API call attempts.", func(om *apiOperationMetrics) float64 { return float64(om.throttles) }},
+		{"aws_api_call_duration_seconds_total", "counter", "Total duration of AWS API calls including the retries.", func(om *apiOperationMetrics) float64 { return om.durationSeconds }},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n", mt.name, mt.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", mt.name, mt.typ)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s{service=%q,operation=%q} %v\n", mt.name, k.service, k.operation, mt.v(m.ops[k]))
+		}
+	}
+}
+
+func (m *APICallMetrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	buf := bytes.NewBuffer(nil)
+	m.WriteText(buf)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,95 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_retry_v2 "github.com/aws/aws-sdk-go-v2/aws/retry"
+	credentials_v2 "github.com/aws/aws-sdk-go-v2/credentials"
+	aws_sts_v2 "github.com/aws/aws-sdk-go-v2/service/sts"
+	smithy "github.com/aws/smithy-go"
+)
+
+func TestInstrumentAPICalls(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("x-amzn-RequestId", "req-1")
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>Throttling</Code><Message>Rate exceeded</Message></Error><RequestId>req-0</RequestId></ErrorResponse>`))
+			return
+		}
+		w.Write([]byte(`<GetCallerIdentityResponse><GetCallerIdentityResult><Account>123456789012</Account><Arn>arn:aws:iam::123456789012:user/test</Arn><UserId>AIDA</UserId></GetCallerIdentityResult><ResponseMetadata><RequestId>req-1</RequestId></ResponseMetadata></GetCallerIdentityResponse>`))
+	}))
+	defer srv.Close()
+
+	awsCfg := aws_v2.Config{
+		Region:      "us-west-2",
+		Credentials: credentials_v2.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		Retryer: func() aws_v2.Retryer {
+			return aws_retry_v2.NewStandard(func(o *aws_retry_v2.StandardOptions) {
+				o.Backoff = aws_retry_v2.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+			})
+		},
+		BaseEndpoint: aws_v2.String(srv.URL),
+	}
+	calls := make(chan APICall, 1)
+	instrumentAPICalls(&awsCfg, true, []APICallHook{func(call APICall) { calls <- call }})
+
+	if _, err := aws_sts_v2.NewFromConfig(awsCfg).GetCallerIdentity(context.Background(), &aws_sts_v2.GetCallerIdentityInput{}); err != nil {
+		t.Fatal(err)
+	}
+	call := <-calls
+	if call.Service != "STS" || call.Operation != "GetCallerIdentity" || call.Region != "us-west-2" || call.RequestID != "req-1" {
+		t.Fatalf("unexpected call %+v", call)
+	}
+	if call.Retries != 1 || call.Throttles != 1 || call.Err != nil {
+		t.Fatalf("expected 1 throttled retry, got %+v", call)
+	}
+}
+
+func TestCountAttempts(t *testing.T) {
+	throttled := &smithy.GenericAPIError{Code: "RequestLimitExceeded", Message: "Request limit exceeded."}
+	retries, throttles := countAttempts([]aws_retry_v2.AttemptResult{
+		{Err: throttled, Retryable: true, Retried: true},
+		{Err: errors.New("connection reset"), Retryable: true, Retried: true},
+		{},
+	})
+	if retries != 2 || throttles != 1 {
+		t.Fatalf("unexpected retries %d, throttles %d", retries, throttles)
+	}
+}
+
+func TestAPICallMetrics(t *testing.T) {
+	m := NewAPICallMetrics()
+	m.Observe(APICall{Service: "EC2", Operation: "DescribeAddresses", Duration: time.Second, Retries: 2, Throttles: 1})
+	m.Observe(APICall{Service: "EC2", Operation: "DescribeAddresses", Duration: time.Second, Err: errors.New("failed")})
+	m.Observe(APICall{Service: "EC2", Operation: "AssociateAddress", Duration: time.Second})
+
+	buf := bytes.NewBuffer(nil)
+	m.WriteText(buf)
+	out := buf.String()
+	for _, line := range []string{
+		`aws_api_calls_total{service="EC2",operation="AssociateAddress"} 1`,
+		`aws_api_calls_total{service="EC2",operation="DescribeAddresses"} 2`,
+		`aws_api_call_errors_total{service="EC2",operation="DescribeAddresses"} 1`,
+		`aws_api_call_retries_total{service="EC2",operation="DescribeAddresses"} 2`,
+		`aws_api_call_throttles_total{service="EC2",operation="DescribeAddresses"} 1`,
+		`aws_api_call_duration_seconds_total{service="EC2",operation="DescribeAddresses"} 2`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("expected %q in\n%s", line, out)
+		}
+	}
+	if strings.Index(out, `operation="AssociateAddress"`) > strings.Index(out, `operation="DescribeAddresses"`) {
+		t.Fatalf("expected sorted operations\n%s", out)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 
 	"github.com/gyuho/infra/go/logutil"
 
@@ -48,11 +49,6 @@ func SealAES256(
 		"sizeBeforeEncryption", humanize.Bytes(uint64(len(plaintext))),
 	)
 
-	nonce := make([]byte, NONCE_LEN)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
-	}
-
 	cli := aws_kms_v2.NewFromConfig(cfg)
 	dek, err := cli.GenerateDataKey(ctx, &aws_kms_v2.GenerateDataKeyInput{
 		KeyId:   &keyID,
@@ -61,48 +57,11 @@ func SealAES256(
 	if err != nil {
 		return nil, err
 	}
-	if len(dek.Plaintext) != DEK_AES_256_LENGTH {
-		return nil, fmt.Errorf("DEK.plaintext for AES_256 must be %d bytes, got %d", DEK_AES_256_LENGTH, len(dek.Plaintext))
-	}
 
-	block, err := aes.NewCipher(dek.Plaintext)
-	if err != nil {
-		return nil, err
-	}
-	aesgcm, err := cipher.NewGCM(block)
+	ciphertext, err := sealWithDEK(dek.Plaintext, dek.CiphertextBlob, plaintext, aadTag)
 	if err != nil {
 		return nil, err
 	}
-
-	// align bytes in the order of
-	// - Nonce bytes "length"
-	// - DEK.ciphertext "length"
-	// - Nonce bytes
-	// - DEK.ciphertext
-	// - data ciphertext
-	dst := new(bytes.Buffer)
-
-	// Nonce bytes "length"
-	if err := binary.Write(dst, binary.LittleEndian, uint16(NONCE_LEN)); err != nil {
-		return nil, err
-	}
-
-	// DEK.ciphertext "length"
-	if err := binary.Write(dst, binary.LittleEndian, uint16(len(dek.CiphertextBlob))); err != nil {
-		return nil, err
-	}
-
-	// Nonce bytes
-	if _, err := dst.Write(nonce); err != nil {
-		return nil, err
-	}
-
-	// DEK.ciphertext
-	if _, err := dst.Write(dek.CiphertextBlob); err != nil {
-		return nil, err
-	}
-
-	ciphertext := aesgcm.Seal(dst.Bytes(), nonce, plaintext, aadTag)
 	logutil.S().Infow("AES_256 envelope-encrypted data", "sizeAfterEncryption", humanize.Bytes(uint64(len(ciphertext))))
 
 	return ciphertext, nil
@@ -127,84 +86,140 @@ func UnsealAES256(
 		"sizeBeforeDecryption", humanize.Bytes(uint64(len(ciphertext))),
 	)
 
-	// bytes are packed in the order of
-	// - Nonce bytes "length"
-	// - DEK.ciphertext "length"
-	// - Nonce bytes
-	// - DEK.ciphertext
-	// - data ciphertext
-	cur := bytes.NewReader(ciphertext)
-
-	// Nonce bytes "length"
-	nonceLenBytes := make([]byte, 2)
-	if err := binary.Read(cur, binary.LittleEndian, nonceLenBytes); err != nil {
+	sd, err := unpack(ciphertext)
+	if err != nil {
 		return nil, err
 	}
-	nonceLen := int(binary.LittleEndian.Uint16(nonceLenBytes))
-	if nonceLen != NONCE_LEN {
-		return nil, fmt.Errorf("nonce length must be %d bytes, got %d", NONCE_LEN, nonceLen)
-	}
 
-	// DEK.ciphertext "length"
-	dekCiphertextLenBytes := make([]byte, 2)
-	if err := binary.Read(cur, binary.LittleEndian, dekCiphertextLenBytes); err != nil {
+	cli := aws_kms_v2.NewFromConfig(cfg)
+	dek, err := cli.Decrypt(ctx, &aws_kms_v2.DecryptInput{
+		CiphertextBlob:      sd.dekCiphertext,
+		EncryptionAlgorithm: aws_kms_v2_types.EncryptionAlgorithmSpecSymmetricDefault,
+		KeyId:               &keyID,
+	})
+	if err != nil {
 		return nil, err
 	}
-	dekCiphertextLen := int(binary.LittleEndian.Uint16(dekCiphertextLenBytes))
-	if dekCiphertextLen > len(ciphertext) {
-		return nil, fmt.Errorf("DEK.ciphertext length must be less than ciphertext %d bytes, got %d", len(ciphertext), dekCiphertextLen)
-	}
 
-	// Nonce bytes
-	nonce := make([]byte, NONCE_LEN)
-	n, err := cur.Read(nonce)
+	decrypted, err := openWithDEK(dek.Plaintext, sd, aadTag)
 	if err != nil {
 		return nil, err
 	}
-	if n != NONCE_LEN {
-		return nil, fmt.Errorf("read nonce bytes must be %d bytes, got %d", NONCE_LEN, n)
-	}
+	logutil.S().Infow("AES_256 envelope-decrypted data", "sizeAfterDecryption", humanize.Bytes(uint64(len(decrypted))))
 
-	// DEK.ciphertext
-	dekCiphertext := make([]byte, dekCiphertextLen)
-	n, err = cur.Read(dekCiphertext)
+	return decrypted, nil
+}
+
+// Represents the unpacked envelope-encrypted data.
+type sealed struct {
+	nonce         []byte
+	dekCiphertext []byte
+	ciphertext    []byte
+}
+
+// Encrypts the data with the plaintext DEK locally, and packs it with the encrypted DEK.
+func sealWithDEK(dekPlaintext []byte, dekCiphertext []byte, plaintext []byte, aadTag []byte) ([]byte, error) {
+	if len(dekPlaintext) != DEK_AES_256_LENGTH {
+		return nil, fmt.Errorf("DEK.plaintext for AES_256 must be %d bytes, got %d", DEK_AES_256_LENGTH, len(dekPlaintext))
+	}
+	aesgcm, err := newGCM(dekPlaintext)
 	if err != nil {
 		return nil, err
 	}
-	if n != dekCiphertextLen {
-		return nil, fmt.Errorf("read cipher bytes must be %d bytes, got %d", dekCiphertextLen, n)
-	}
 
-	cli := aws_kms_v2.NewFromConfig(cfg)
-	dek, err := cli.Decrypt(ctx, &aws_kms_v2.DecryptInput{
-		CiphertextBlob:      dekCiphertext,
-		EncryptionAlgorithm: aws_kms_v2_types.EncryptionAlgorithmSpecSymmetricDefault,
-		KeyId:               &keyID,
-	})
-	if err != nil {
+	nonce := make([]byte, NONCE_LEN)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, err
 	}
 
-	block, err := aes.NewCipher(dek.Plaintext)
-	if err != nil {
+	// align bytes in the order of
+	// - Nonce bytes "length"
+	// - DEK.ciphertext "length"
+	// - Nonce bytes
+	// - DEK.ciphertext
+	// - data ciphertext
+	dst := new(bytes.Buffer)
+	if err := writeHeader(dst, nonce, dekCiphertext); err != nil {
 		return nil, err
 	}
-	aesgcm, err := cipher.NewGCM(block)
+	return aesgcm.Seal(dst.Bytes(), nonce, plaintext, aadTag), nil
+}
+
+// Decrypts the data with the plaintext DEK locally.
+func openWithDEK(dekPlaintext []byte, sd sealed, aadTag []byte) ([]byte, error) {
+	aesgcm, err := newGCM(dekPlaintext)
 	if err != nil {
 		return nil, err
 	}
+	return aesgcm.Open(nil, sd.nonce, sd.ciphertext, aadTag)
+}
 
-	// data ciphertext
-	cipher, err := io.ReadAll(cur)
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
+	return cipher.NewGCM(block)
+}
 
-	decrypted, err := aesgcm.Open(nil, nonce, cipher, aadTag)
-	if err != nil {
+func writeHeader(dst *bytes.Buffer, nonce []byte, dekCiphertext []byte) error {
+	if len(dekCiphertext) > math.MaxUint16 {
+		return fmt.Errorf("DEK.ciphertext too large %d bytes", len(dekCiphertext))
+	}
+	// Nonce bytes "length"
+	if err := binary.Write(dst, binary.LittleEndian, uint16(len(nonce))); err != nil {
+		return err
+	}
+	// DEK.ciphertext "length"
+	if err := binary.Write(dst, binary.LittleEndian, uint16(len(dekCiphertext))); err != nil {
+		return err
+	}
+	// Nonce bytes
+	if _, err := dst.Write(nonce); err != nil {
+		return err
+	}
+	// DEK.ciphertext
+	_, err := dst.Write(dekCiphertext)
+	return err
+}
+
+// Packs the data with the (new) encrypted DEK, in the same layout.
+func (sd sealed) pack() ([]byte, error) {
+	dst := new(bytes.Buffer)
+	if err := writeHeader(dst, sd.nonce, sd.dekCiphertext); err != nil {
 		return nil, err
 	}
-	logutil.S().Infow("AES_256 envelope-decrypted data", "sizeAfterDecryption", humanize.Bytes(uint64(len(decrypted))))
+	if _, err := dst.Write(sd.ciphertext); err != nil {
+		return nil, err
+	}
+	return dst.Bytes(), nil
+}
 
-	return decrypted, nil
+// Unpacks the bytes in the order of:
+// [ Nonce bytes "length" ][ DEK.ciphertext "length" ][ Nonce bytes ][ DEK.ciphertext ][ data ciphertext ]
+func unpack(b []byte) (sealed, error) {
+	if len(b) < 4 {
+		return sealed{}, fmt.Errorf("ciphertext too short %d bytes", len(b))
+	}
+
+	// Nonce bytes "length"
+	nonceLen := int(binary.LittleEndian.Uint16(b[0:2]))
+	if nonceLen != NONCE_LEN {
+		return sealed{}, fmt.Errorf("nonce length must be %d bytes, got %d", NONCE_LEN, nonceLen)
+	}
+
+	// DEK.ciphertext "length"
+	dekCiphertextLen := int(binary.LittleEndian.Uint16(b[2:4]))
+	if 4+nonceLen+dekCiphertextLen > len(b) {
+		return sealed{}, fmt.Errorf("DEK.ciphertext length must be less than ciphertext %d bytes, got %d", len(b), dekCiphertextLen)
+	}
+
+	cur := 4
+	sd := sealed{}
+	sd.nonce = b[cur : cur+nonceLen]
+	cur += nonceLen
+	sd.dekCiphertext = b[cur : cur+dekCiphertextLen]
+	cur += dekCiphertextLen
+	sd.ciphertext = b[cur:]
+	return sd, nil
 }
@@ -14,6 +14,55 @@ import (
 	"github.com/gyuho/infra/go/randutil"
 )
 
+func TestSealWithDEK(t *testing.T) {
+	dek := randutil.BytesAlphabetsLowerCaseNumeric(DEK_AES_256_LENGTH)
+	dekCiphertext := randutil.BytesAlphabetsLowerCaseNumeric(184)
+	plaintext := randutil.BytesAlphabetsLowerCaseNumeric(1024)
+	aadTag := []byte("node-0")
+
+	b, err := sealWithDEK(dek, dekCiphertext, plaintext, aadTag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := unpack(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sd.dekCiphertext, dekCiphertext) || len(sd.nonce) != NONCE_LEN {
+		t.Fatalf("unexpected unpacked %+v", sd)
+	}
+	decrypted, err := openWithDEK(dek, sd, aadTag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, decrypted) {
+		t.Fatalf("plaintext and decrypted are not equal: %x != %x", plaintext, decrypted)
+	}
+	if _, err = openWithDEK(dek, sd, []byte("node-1")); err == nil {
+		t.Fatal("expected error for wrong AAD tag")
+	}
+
+	// re-wrapped data key keeps the data ciphertext
+	sd.dekCiphertext = randutil.BytesAlphabetsLowerCaseNumeric(200)
+	repacked, err := sd.pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd2, err := unpack(repacked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sd2.dekCiphertext, sd.dekCiphertext) || !bytes.Equal(sd2.ciphertext, sd.ciphertext) {
+		t.Fatalf("unexpected repacked %+v", sd2)
+	}
+
+	for _, bad := range [][]byte{nil, {12, 0}, b[:20]} {
+		if _, err = unpack(bad); err == nil {
+			t.Fatalf("expected error for %x", bad)
+		}
+	}
+}
+
 func TestEnvelope(t *testing.T) {
 	if os.Getenv("RUN_AWS_TESTS") != "1" {
 		t.Skip()
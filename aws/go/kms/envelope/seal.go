@@ -0,0 +1,158 @@
+package envelope
+
+import (
+	"context"
+
+	"github.com/gyuho/infra/aws/go/kms"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_kms_v2 "github.com/aws/aws-sdk-go-v2/service/kms"
+	aws_kms_v2_types "github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/dustin/go-humanize"
+)
+
+type Op struct {
+	aadTag            []byte
+	encryptionContext map[string]string
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Sets the additional authenticated data (AAD) tag for the local AES-GCM encryption.
+func WithAADTag(b []byte) OpOption {
+	return func(op *Op) {
+		op.aadTag = b
+	}
+}
+
+// Sets the KMS encryption context to bind the data key to
+// (e.g., {"node": "my-asg-0"}), which must match on decrypt.
+// The context is logged in CloudTrail, so must not include any secret.
+// ref. https://docs.aws.amazon.com/kms/latest/developerguide/encrypt_context.html
+func WithEncryptionContext(m map[string]string) OpOption {
+	return func(op *Op) {
+		op.encryptionContext = m
+	}
+}
+
+// Envelope-encrypts the data (e.g., node secrets, backup manifests) with the new data key
+// from the KMS key (the key ID, ARN, alias name, or alias ARN), in the same layout as "SealAES256".
+// Returns the ciphertext and the ARN of the key that wraps the data key.
+func Seal(ctx context.Context, cfg aws.Config, keyID string, plaintext []byte, opts ...OpOption) ([]byte, string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cli := aws_kms_v2.NewFromConfig(cfg)
+	dek, err := cli.GenerateDataKey(ctx, &aws_kms_v2.GenerateDataKeyInput{
+		KeyId:             aws.String(keyID),
+		KeySpec:           aws_kms_v2_types.DataKeySpecAes256,
+		EncryptionContext: ret.encryptionContext,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	keyARN := aws.ToString(dek.KeyId)
+
+	ciphertext, err := sealWithDEK(dek.Plaintext, dek.CiphertextBlob, plaintext, ret.aadTag)
+	clear(dek.Plaintext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	logutil.S().Infow("envelope-encrypted data",
+		"keyID", keyID,
+		"keyARN", keyARN,
+		"sizeBeforeEncryption", humanize.Bytes(uint64(len(plaintext))),
+		"sizeAfterEncryption", humanize.Bytes(uint64(len(ciphertext))),
+	)
+	return ciphertext, keyARN, nil
+}
+
+// Envelope-decrypts the data encrypted by "Seal" (or "SealAES256").
+// The key ID is not required, since the encrypted data key identifies its KMS key:
+// the data still decrypts after the key rotation or after the alias is re-pointed.
+// Returns the plaintext and the ARN of the key that wrapped the data key,
+// to compare with the current key (see "IsStale").
+func Unseal(ctx context.Context, cfg aws.Config, ciphertext []byte, opts ...OpOption) ([]byte, string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	sd, err := unpack(ciphertext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cli := aws_kms_v2.NewFromConfig(cfg)
+	dek, err := cli.Decrypt(ctx, &aws_kms_v2.DecryptInput{
+		CiphertextBlob:      sd.dekCiphertext,
+		EncryptionAlgorithm: aws_kms_v2_types.EncryptionAlgorithmSpecSymmetricDefault,
+		EncryptionContext:   ret.encryptionContext,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	keyARN := aws.ToString(dek.KeyId)
+
+	plaintext, err := openWithDEK(dek.Plaintext, sd, ret.aadTag)
+	clear(dek.Plaintext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	logutil.S().Infow("envelope-decrypted data", "keyARN", keyARN, "sizeAfterDecryption", humanize.Bytes(uint64(len(plaintext))))
+	return plaintext, keyARN, nil
+}
+
+// Returns true if the data key was wrapped by a key other than the current one
+// the key ID resolves to (e.g., the alias re-pointed to the new key),
+// which requires "ReEncrypt" before the old key is disabled or deleted.
+// The automatic rotation keeps the key ARN, so it never makes the data stale.
+func IsStale(ctx context.Context, cfg aws.Config, wrappedKeyARN string, keyID string) (bool, error) {
+	k, err := kms.ResolveKey(ctx, cfg, keyID)
+	if err != nil {
+		return false, err
+	}
+	return k.ARN != wrappedKeyARN, nil
+}
+
+// Re-wraps the data key with the KMS key (e.g., the new key the alias points to),
+// without decrypting the data locally: KMS decrypts and re-encrypts the data key
+// on the server side, and only the data key part of the ciphertext changes.
+// Returns the new ciphertext and the ARN of the new key.
+func ReEncrypt(ctx context.Context, cfg aws.Config, ciphertext []byte, keyID string, opts ...OpOption) ([]byte, string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	sd, err := unpack(ciphertext)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cli := aws_kms_v2.NewFromConfig(cfg)
+	out, err := cli.ReEncrypt(ctx, &aws_kms_v2.ReEncryptInput{
+		CiphertextBlob:               sd.dekCiphertext,
+		DestinationKeyId:             aws.String(keyID),
+		SourceEncryptionContext:      ret.encryptionContext,
+		DestinationEncryptionContext: ret.encryptionContext,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	sd.dekCiphertext = out.CiphertextBlob
+
+	b, err := sd.pack()
+	if err != nil {
+		return nil, "", err
+	}
+
+	keyARN := aws.ToString(out.KeyId)
+	logutil.S().Infow("re-encrypted data key", "sourceKeyARN", aws.ToString(out.SourceKeyId), "keyARN", keyARN)
+	return b, keyARN, nil
+}
@@ -0,0 +1,122 @@
+package kms
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_kms_v2 "github.com/aws/aws-sdk-go-v2/service/kms"
+	aws_kms_v2_types "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Represents the resolved KMS key with its rotation status.
+type Key struct {
+	// The key ID and ARN that the alias (or ID, or ARN) resolves to.
+	ID  string `json:"id"`
+	ARN string `json:"arn"`
+
+	// The alias name used to resolve the key (e.g., "alias/backups"), if any.
+	Alias string `json:"alias,omitempty"`
+
+	State      string `json:"state"`
+	Manager    string `json:"manager"`
+	KeySpec    string `json:"key_spec"`
+	KeyUsage   string `json:"key_usage"`
+	RotationOn bool   `json:"rotation_on"`
+
+	// Only set for the customer managed keys with the automatic rotation.
+	RotationPeriodDays int32     `json:"rotation_period_days,omitempty"`
+	NextRotation       time.Time `json:"next_rotation,omitempty"`
+}
+
+// Returned when the key is not enabled (e.g., disabled or pending deletion).
+var ErrKeyNotEnabled = errors.New("key not enabled")
+
+// Returns true if the key ID is the alias name or the alias ARN.
+func IsAlias(keyID string) bool {
+	if strings.HasPrefix(keyID, "alias/") {
+		return true
+	}
+	// e.g., "arn:aws:kms:us-west-2:123456789012:alias/backups"
+	return strings.HasPrefix(keyID, "arn:") && strings.Contains(keyID, ":alias/")
+}
+
+// Resolves the key ID, key ARN, alias name, or alias ARN to the key,
+// and fetches its rotation status. Returns "ErrKeyNotEnabled" if the key is not enabled,
+// so the callers fail early before encrypting with the unusable key.
+//
+// The automatic rotation keeps the key ID and retains the old key material,
+// so the data encrypted before the rotation still decrypts without any change.
+// Re-pointing the alias to the new key requires re-encrypting the data keys
+// (see "envelope.ReEncrypt").
+// ref. https://docs.aws.amazon.com/kms/latest/developerguide/rotate-keys.html
+func ResolveKey(ctx context.Context, cfg aws.Config, keyID string) (Key, error) {
+	md, err := Describe(ctx, cfg, keyID)
+	if err != nil {
+		return Key{}, err
+	}
+
+	k := Key{
+		ID:       aws.ToString(md.KeyId),
+		ARN:      aws.ToString(md.Arn),
+		State:    string(md.KeyState),
+		Manager:  string(md.KeyManager),
+		KeySpec:  string(md.KeySpec),
+		KeyUsage: string(md.KeyUsage),
+	}
+	if IsAlias(keyID) {
+		k.Alias = keyID[strings.Index(keyID, "alias/"):]
+	}
+	if md.KeyState != aws_kms_v2_types.KeyStateEnabled {
+		return k, ErrKeyNotEnabled
+	}
+
+	switch {
+	case md.KeyManager == aws_kms_v2_types.KeyManagerTypeAws:
+		// AWS managed keys are rotated every year, and the rotation status is not readable
+		k.RotationOn = true
+		k.RotationPeriodDays = 365
+
+	case md.KeySpec == aws_kms_v2_types.KeySpecSymmetricDefault && md.Origin == aws_kms_v2_types.OriginTypeAwsKms:
+		cli := aws_kms_v2.NewFromConfig(cfg)
+		out, err := cli.GetKeyRotationStatus(ctx, &aws_kms_v2.GetKeyRotationStatusInput{
+			KeyId: aws.String(k.ID),
+		})
+		if err != nil {
+			return k, err
+		}
+		k.RotationOn = out.KeyRotationEnabled
+		k.RotationPeriodDays = aws.ToInt32(out.RotationPeriodInDays)
+		k.NextRotation = aws.ToTime(out.NextRotationDate)
+
+	default:
+		// the automatic rotation is not supported for the asymmetric, HMAC, or imported keys
+	}
+
+	logutil.S().Infow("resolved key", "keyID", keyID, "arn", k.ARN, "rotationOn", k.RotationOn, "nextRotation", k.NextRotation)
+	return k, nil
+}
+
+// Enables the automatic rotation of the customer managed key.
+// If the period is 0, the default 365 days is used (must be 90 to 2560 days).
+func EnableKeyRotation(ctx context.Context, cfg aws.Config, keyID string, periodDays int32) error {
+	logutil.S().Infow("enabling key rotation", "keyID", keyID, "periodDays", periodDays)
+
+	input := &aws_kms_v2.EnableKeyRotationInput{
+		KeyId: aws.String(keyID),
+	}
+	if periodDays > 0 {
+		input.RotationPeriodInDays = aws.Int32(periodDays)
+	}
+	cli := aws_kms_v2.NewFromConfig(cfg)
+	if _, err := cli.EnableKeyRotation(ctx, input); err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully enabled key rotation", "keyID", keyID)
+	return nil
+}
@@ -0,0 +1,20 @@
+package kms
+
+import "testing"
+
+func TestIsAlias(t *testing.T) {
+	tt := []struct {
+		keyID string
+		alias bool
+	}{
+		{"alias/backups", true},
+		{"arn:aws:kms:us-west-2:123456789012:alias/backups", true},
+		{"1234abcd-12ab-34cd-56ef-1234567890ab", false},
+		{"arn:aws:kms:us-west-2:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab", false},
+	}
+	for i, tv := range tt {
+		if v := IsAlias(tv.keyID); v != tv.alias {
+			t.Errorf("#%d: %q expected alias %v, got %v", i, tv.keyID, tv.alias, v)
+		}
+	}
+}
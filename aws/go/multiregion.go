@@ -0,0 +1,153 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Represents the AWS configs for multiple regions, sharing the same credentials.
+type MultiRegion struct {
+	regions []string
+	configs map[string]aws_v2.Config
+}
+
+// Creates the configs for the regions with the default credentials.
+// See "NewMultiRegionFromConfig" to assume a role.
+func NewMultiRegion(regions []string) (*MultiRegion, error) {
+	return NewMultiRegionFromConfig(&Config{}, regions)
+}
+
+// Creates the configs for the regions, with the config loaded once (e.g., with "RoleARN")
+// and copied for each region, so the credentials are retrieved (and refreshed) once.
+// The region of the config is ignored.
+func NewMultiRegionFromConfig(cfg *Config, regions []string) (*MultiRegion, error) {
+	if cfg == nil {
+		return nil, errors.New("got empty config")
+	}
+	regions = dedupRegions(regions)
+	if len(regions) == 0 {
+		return nil, errors.New("no region")
+	}
+
+	base := *cfg
+	base.Region = regions[0]
+	awsCfg, err := New(&base)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MultiRegion{
+		regions: regions,
+		configs: make(map[string]aws_v2.Config, len(regions)),
+	}
+	for _, r := range regions {
+		c := awsCfg.Copy()
+		c.Region = r
+		m.configs[r] = c
+	}
+	return m, nil
+}
+
+// Returns the regions, sorted.
+func (m *MultiRegion) Regions() []string {
+	return append([]string(nil), m.regions...)
+}
+
+// Returns the config for the region.
+func (m *MultiRegion) Config(region string) (aws_v2.Config, bool) {
+	c, ok := m.configs[region]
+	return c, ok
+}
+
+// Represents the error of the operation in the region.
+type RegionError struct {
+	Region string
+	Err    error
+}
+
+func (e *RegionError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Region, e.Err)
+}
+
+func (e *RegionError) Unwrap() error {
+	return e.Err
+}
+
+// Runs the operation in all the regions concurrently, with at most "parallelism" regions
+// at a time (0 for all at once). The operation keeps running in the other regions on failure,
+// and the failures are returned joined as "RegionError"s, sorted by the region.
+// The operation must be safe to call concurrently (e.g., collect the results with a mutex).
+func (m *MultiRegion) Run(ctx context.Context, parallelism int, fn func(ctx context.Context, region string, cfg aws_v2.Config) error) error {
+	if parallelism <= 0 || parallelism > len(m.regions) {
+		parallelism = len(m.regions)
+	}
+	logutil.S().Infow("running in regions", "regions", len(m.regions), "parallelism", parallelism)
+
+	sema := make(chan struct{}, parallelism)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []*RegionError
+	)
+	for _, r := range m.regions {
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			errs = append(errs, &RegionError{Region: r, Err: ctx.Err()})
+			mu.Unlock()
+			continue
+		case sema <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(r string) {
+			defer func() {
+				<-sema
+				wg.Done()
+			}()
+			if err := fn(ctx, r, m.configs[r]); err != nil {
+				logutil.S().Warnw("failed in region", "region", r, "error", err)
+				mu.Lock()
+				errs = append(errs, &RegionError{Region: r, Err: err})
+				mu.Unlock()
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Region < errs[j].Region
+	})
+	joined := make([]error, 0, len(errs))
+	for _, e := range errs {
+		joined = append(joined, e)
+	}
+	return errors.Join(joined...)
+}
+
+func dedupRegions(regions []string) []string {
+	seen := make(map[string]struct{}, len(regions))
+	deduped := make([]string, 0, len(regions))
+	for _, r := range regions {
+		if r == "" {
+			continue
+		}
+		if _, ok := seen[r]; ok {
+			continue
+		}
+		seen[r] = struct{}{}
+		deduped = append(deduped, r)
+	}
+	sort.Strings(deduped)
+	return deduped
+}
@@ -0,0 +1,63 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestMultiRegionRun(t *testing.T) {
+	m := &MultiRegion{
+		regions: dedupRegions([]string{"us-west-2", "us-east-1", "eu-west-1", "us-east-1", ""}),
+		configs: make(map[string]aws_v2.Config),
+	}
+	for _, r := range m.regions {
+		m.configs[r] = aws_v2.Config{Region: r}
+	}
+	if len(m.Regions()) != 3 || m.Regions()[0] != "eu-west-1" {
+		t.Fatalf("unexpected regions %v", m.Regions())
+	}
+
+	var cur, peak atomic.Int32
+	var mu sync.Mutex
+	seen := make(map[string]string)
+	errFailed := errors.New("failed")
+	err := m.Run(context.Background(), 2, func(ctx context.Context, region string, cfg aws_v2.Config) error {
+		n := cur.Add(1)
+		defer cur.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		seen[region] = cfg.Region
+		mu.Unlock()
+		if region != "us-east-1" {
+			return errFailed
+		}
+		return nil
+	})
+	if p := peak.Load(); p > 2 {
+		t.Fatalf("expected parallelism <= 2, got %d", p)
+	}
+	if len(seen) != 3 || seen["us-west-2"] != "us-west-2" {
+		t.Fatalf("unexpected regions run %v", seen)
+	}
+
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("expected the joined error, got %v", err)
+	}
+	var rerr *RegionError
+	if !errors.As(err, &rerr) || rerr.Region != "eu-west-1" {
+		t.Fatalf("expected the first region error for eu-west-1, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Package notify implements the lifecycle event notifications to SNS or SQS,
+// for the downstream automation (e.g., update the inventory once the EIP is associated).
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/sns"
+	"github.com/gyuho/infra/aws/go/sqs"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Lifecycle event types.
+const (
+	EventEIPAssociated   = "eip-associated"
+	EventVolumeAttached  = "volume-attached"
+	EventBackupCompleted = "backup-completed"
+)
+
+var ErrInvalidTarget = errors.New("invalid notification target (expected SNS topic ARN or SQS queue URL)")
+
+// Represents the lifecycle event, published as JSON.
+type Event struct {
+	Type       string            `json:"type"`
+	Source     string            `json:"source"`
+	InstanceID string            `json:"instance_id"`
+	ASGName    string            `json:"asg_name,omitempty"`
+	Region     string            `json:"region"`
+	Time       time.Time         `json:"time"`
+	Details    map[string]string `json:"details,omitempty"`
+}
+
+// Validates the target is the SNS topic ARN or the SQS queue URL.
+func ValidateTarget(target string) error {
+	if isSNSTopic(target) || isSQSQueue(target) {
+		return nil
+	}
+	return fmt.Errorf("%w %q", ErrInvalidTarget, target)
+}
+
+func isSNSTopic(target string) bool {
+	return strings.HasPrefix(target, "arn:") && strings.Contains(target, ":sns:")
+}
+
+func isSQSQueue(target string) bool {
+	return strings.HasPrefix(target, "https://")
+}
+
+// Publishes the event to the target, the SNS topic ARN (e.g., "arn:aws:sns:us-west-2:123456789012:events")
+// or the SQS queue URL (e.g., "https://sqs.us-west-2.amazonaws.com/123456789012/events").
+// The event type and source are set as the message attributes (e.g., for the SNS subscription filter policies).
+// For the FIFO targets, the events are grouped by the instance ID.
+func Publish(ctx context.Context, cfg aws.Config, target string, ev Event) error {
+	if err := ValidateTarget(target); err != nil {
+		return err
+	}
+	if ev.Region == "" {
+		ev.Region = cfg.Region
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	attrs := map[string]string{"type": ev.Type, "source": ev.Source}
+
+	fifo := strings.HasSuffix(target, ".fifo")
+	dedupID := fmt.Sprintf("%s-%s-%d", ev.Type, ev.InstanceID, ev.Time.UnixNano())
+	if isSNSTopic(target) {
+		opts := []sns.OpOption{sns.WithAttributes(attrs), sns.WithSubject(fmt.Sprintf("%s %s", ev.Type, ev.InstanceID))}
+		if fifo {
+			opts = append(opts, sns.WithMessageGroupID(ev.InstanceID), sns.WithDeduplicationID(dedupID))
+		}
+		_, err = sns.Publish(ctx, cfg, target, string(b), opts...)
+		return err
+	}
+
+	opts := []sqs.OpOption{sqs.WithAttributes(attrs)}
+	if fifo {
+		opts = append(opts, sqs.WithMessageGroupID(ev.InstanceID), sqs.WithDeduplicationID(dedupID))
+	}
+	_, err = sqs.Send(ctx, cfg, target, string(b), opts...)
+	return err
+}
@@ -0,0 +1,24 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateTarget(t *testing.T) {
+	for target, valid := range map[string]bool{
+		"arn:aws:sns:us-west-2:123456789012:events":                 true,
+		"arn:aws-us-gov:sns:us-gov-west-1:123456789012:events.fifo": true,
+		"https://sqs.us-west-2.amazonaws.com/123456789012/events":   true,
+		"arn:aws:sqs:us-west-2:123456789012:events":                 false,
+		"events": false,
+	} {
+		err := ValidateTarget(target)
+		if valid && err != nil {
+			t.Fatalf("%q unexpected error %v", target, err)
+		}
+		if !valid && !errors.Is(err, ErrInvalidTarget) {
+			t.Fatalf("%q expected %v, got %v", target, ErrInvalidTarget, err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package route53
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_route53_v2 "github.com/aws/aws-sdk-go-v2/service/route53"
+	aws_route53_v2_types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Represents the health check of the endpoint (e.g., the EIP of the instance).
+// ref. https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/health-checks-types.html
+type HealthCheck struct {
+	ID               string            `json:"id"`
+	Version          int64             `json:"version"`
+	Type             string            `json:"type"`
+	IPAddress        string            `json:"ip_address"`
+	Port             int32             `json:"port"`
+	ResourcePath     string            `json:"resource_path,omitempty"`
+	FailureThreshold int32             `json:"failure_threshold"`
+	RequestInterval  int32             `json:"request_interval"`
+	Tags             map[string]string `json:"tags,omitempty"`
+}
+
+// Returned when no health check matches the tags.
+var ErrHealthCheckNotFound = errors.New("health check not found")
+
+// Creates the health check for the IP address and port (e.g., the EIP of the instance).
+// Use "WithHealthCheckType", "WithResourcePath", "WithFailureThreshold", and "WithRequestInterval"
+// to configure the check, and "WithTags" to tag the health check (e.g., to find it with "FindHealthCheckByTags").
+func CreateHealthCheck(ctx context.Context, cfg aws.Config, ip string, port int32, opts ...OpOption) (HealthCheck, error) {
+	ret := &Op{healthCheckType: "TCP", failureThreshold: 3, requestInterval: 30}
+	ret.applyOpts(opts)
+
+	hc, err := buildHealthCheckConfig(ip, port, ret)
+	if err != nil {
+		return HealthCheck{}, err
+	}
+
+	logutil.S().Infow("creating health check", "ip", ip, "port", port, "type", ret.healthCheckType, "resourcePath", ret.resourcePath)
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	out, err := cli.CreateHealthCheck(ctx, &aws_route53_v2.CreateHealthCheckInput{
+		// unique per request, to not return the existing health check of the previous request
+		CallerReference:   aws.String(fmt.Sprintf("%d-%d", port, time.Now().UnixNano())),
+		HealthCheckConfig: &hc,
+	})
+	if err != nil {
+		return HealthCheck{}, err
+	}
+	h := convertHealthCheck(*out.HealthCheck)
+
+	if len(ret.tags) > 0 {
+		if err = tagHealthCheck(ctx, cfg, h.ID, ret.tags); err != nil {
+			return h, err
+		}
+		h.Tags = ret.tags
+	}
+
+	logutil.S().Infow("successfully created health check", "id", h.ID)
+	return h, nil
+}
+
+// Fetches the health check by ID.
+func GetHealthCheck(ctx context.Context, cfg aws.Config, id string) (HealthCheck, error) {
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	out, err := cli.GetHealthCheck(ctx, &aws_route53_v2.GetHealthCheckInput{
+		HealthCheckId: aws.String(id),
+	})
+	if err != nil {
+		return HealthCheck{}, err
+	}
+	return convertHealthCheck(*out.HealthCheck), nil
+}
+
+// Finds the health check whose tags match all the tags.
+// Returns "ErrHealthCheckNotFound" if none found, or an error if more than one found.
+func FindHealthCheckByTags(ctx context.Context, cfg aws.Config, tags map[string]string) (HealthCheck, error) {
+	logutil.S().Infow("finding health check by tags", "tags", tags)
+
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	pg := aws_route53_v2.NewListHealthChecksPaginator(cli, &aws_route53_v2.ListHealthChecksInput{})
+	hcs := make(map[string]HealthCheck)
+	ids := make([]string, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return HealthCheck{}, err
+		}
+		for _, raw := range out.HealthChecks {
+			h := convertHealthCheck(raw)
+			hcs[h.ID] = h
+			ids = append(ids, h.ID)
+		}
+	}
+
+	matched := make([]HealthCheck, 0, 1)
+	// ref. https://docs.aws.amazon.com/Route53/latest/APIReference/API_ListTagsForResources.html
+	for len(ids) > 0 {
+		n := min(len(ids), 10)
+		out, err := cli.ListTagsForResources(ctx, &aws_route53_v2.ListTagsForResourcesInput{
+			ResourceType: aws_route53_v2_types.TagResourceTypeHealthcheck,
+			ResourceIds:  ids[:n],
+		})
+		if err != nil {
+			return HealthCheck{}, err
+		}
+		ids = ids[n:]
+
+		for _, rts := range out.ResourceTagSets {
+			m := make(map[string]string, len(rts.Tags))
+			for _, tg := range rts.Tags {
+				m[aws.ToString(tg.Key)] = aws.ToString(tg.Value)
+			}
+			if !matchTags(m, tags) {
+				continue
+			}
+			h := hcs[aws.ToString(rts.ResourceId)]
+			h.Tags = m
+			matched = append(matched, h)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return HealthCheck{}, ErrHealthCheckNotFound
+	case 1:
+		logutil.S().Infow("found health check", "id", matched[0].ID, "ip", matched[0].IPAddress)
+		return matched[0], nil
+	default:
+		return HealthCheck{}, fmt.Errorf("expected 1 health check, found %d for tags %v", len(matched), tags)
+	}
+}
+
+// Updates the IP address and port of the health check (e.g., the EIP re-associated to another instance).
+// Use "WithResourcePath" and "WithFailureThreshold" to update the check.
+// The type and the request interval cannot be updated.
+func UpdateHealthCheck(ctx context.Context, cfg aws.Config, id string, ip string, port int32, opts ...OpOption) (HealthCheck, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cur, err := GetHealthCheck(ctx, cfg, id)
+	if err != nil {
+		return HealthCheck{}, err
+	}
+
+	logutil.S().Infow("updating health check", "id", id, "version", cur.Version, "ip", ip, "port", port)
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	input := &aws_route53_v2.UpdateHealthCheckInput{
+		HealthCheckId: aws.String(id),
+		// fails with "HealthCheckVersionMismatch" if updated by another request in the meantime
+		HealthCheckVersion: aws.Int64(cur.Version),
+		IPAddress:          aws.String(ip),
+		Port:               aws.Int32(port),
+	}
+	if ret.resourcePath != "" {
+		input.ResourcePath = aws.String(ret.resourcePath)
+	}
+	if ret.failureThreshold > 0 {
+		input.FailureThreshold = aws.Int32(ret.failureThreshold)
+	}
+	out, err := cli.UpdateHealthCheck(ctx, input)
+	if err != nil {
+		return HealthCheck{}, err
+	}
+
+	logutil.S().Infow("successfully updated health check", "id", id)
+	return convertHealthCheck(*out.HealthCheck), nil
+}
+
+// Deletes the health check. No-op if not found.
+// The records associated with the health check must be deleted (or updated) first.
+func DeleteHealthCheck(ctx context.Context, cfg aws.Config, id string) error {
+	logutil.S().Infow("deleting health check", "id", id)
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	_, err := cli.DeleteHealthCheck(ctx, &aws_route53_v2.DeleteHealthCheckInput{
+		HealthCheckId: aws.String(id),
+	})
+	if err != nil {
+		var notFound *aws_route53_v2_types.NoSuchHealthCheck
+		if errors.As(err, &notFound) {
+			logutil.S().Infow("health check not found, skipping delete", "id", id)
+			return nil
+		}
+		return err
+	}
+
+	logutil.S().Infow("successfully deleted health check", "id", id)
+	return nil
+}
+
+func tagHealthCheck(ctx context.Context, cfg aws.Config, id string, tags map[string]string) error {
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	input := &aws_route53_v2.ChangeTagsForResourceInput{
+		ResourceId:   aws.String(id),
+		ResourceType: aws_route53_v2_types.TagResourceTypeHealthcheck,
+	}
+	for k, v := range tags {
+		input.AddTags = append(input.AddTags, aws_route53_v2_types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	_, err := cli.ChangeTagsForResource(ctx, input)
+	return err
+}
+
+func buildHealthCheckConfig(ip string, port int32, op *Op) (aws_route53_v2_types.HealthCheckConfig, error) {
+	if ip == "" {
+		return aws_route53_v2_types.HealthCheckConfig{}, errors.New("empty health check IP address")
+	}
+	if port <= 0 || port > 65535 {
+		return aws_route53_v2_types.HealthCheckConfig{}, fmt.Errorf("invalid health check port %d", port)
+	}
+	if op.requestInterval != 10 && op.requestInterval != 30 {
+		return aws_route53_v2_types.HealthCheckConfig{}, fmt.Errorf("invalid health check request interval %d (10 or 30)", op.requestInterval)
+	}
+
+	hc := aws_route53_v2_types.HealthCheckConfig{
+		Type:             aws_route53_v2_types.HealthCheckType(op.healthCheckType),
+		IPAddress:        aws.String(ip),
+		Port:             aws.Int32(port),
+		FailureThreshold: aws.Int32(op.failureThreshold),
+		RequestInterval:  aws.Int32(op.requestInterval),
+	}
+	switch hc.Type {
+	case aws_route53_v2_types.HealthCheckTypeTcp:
+		if op.resourcePath != "" {
+			return aws_route53_v2_types.HealthCheckConfig{}, errors.New("resource path is not supported for the TCP health check")
+		}
+	case aws_route53_v2_types.HealthCheckTypeHttp, aws_route53_v2_types.HealthCheckTypeHttps:
+		path := op.resourcePath
+		if path == "" {
+			path = "/"
+		}
+		hc.ResourcePath = aws.String(path)
+	default:
+		return aws_route53_v2_types.HealthCheckConfig{}, fmt.Errorf("unsupported health check type %q", op.healthCheckType)
+	}
+	return hc, nil
+}
+
+func convertHealthCheck(raw aws_route53_v2_types.HealthCheck) HealthCheck {
+	h := HealthCheck{
+		ID:      aws.ToString(raw.Id),
+		Version: aws.ToInt64(raw.HealthCheckVersion),
+	}
+	if c := raw.HealthCheckConfig; c != nil {
+		h.Type = string(c.Type)
+		h.IPAddress = aws.ToString(c.IPAddress)
+		h.Port = aws.ToInt32(c.Port)
+		h.ResourcePath = aws.ToString(c.ResourcePath)
+		h.FailureThreshold = aws.ToInt32(c.FailureThreshold)
+		h.RequestInterval = aws.ToInt32(c.RequestInterval)
+	}
+	return h
+}
@@ -0,0 +1,42 @@
+package route53
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestBuildHealthCheckConfig(t *testing.T) {
+	hc, err := buildHealthCheckConfig("1.2.3.4", 443, &Op{healthCheckType: "TCP", failureThreshold: 3, requestInterval: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(hc.IPAddress) != "1.2.3.4" || aws.ToInt32(hc.Port) != 443 || hc.ResourcePath != nil {
+		t.Fatalf("unexpected health check config %+v", hc)
+	}
+
+	hc, err = buildHealthCheckConfig("1.2.3.4", 80, &Op{healthCheckType: "HTTP", failureThreshold: 3, requestInterval: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(hc.ResourcePath) != "/" || aws.ToInt32(hc.RequestInterval) != 10 {
+		t.Fatalf("unexpected health check config %+v", hc)
+	}
+
+	tt := []struct {
+		ip   string
+		port int32
+		op   *Op
+	}{
+		{ip: "", port: 443, op: &Op{healthCheckType: "TCP", requestInterval: 30}},
+		{ip: "1.2.3.4", port: 0, op: &Op{healthCheckType: "TCP", requestInterval: 30}},
+		{ip: "1.2.3.4", port: 443, op: &Op{healthCheckType: "TCP", requestInterval: 20}},
+		{ip: "1.2.3.4", port: 443, op: &Op{healthCheckType: "TCP", requestInterval: 30, resourcePath: "/health"}},
+		{ip: "1.2.3.4", port: 443, op: &Op{healthCheckType: "CALCULATED", requestInterval: 30}},
+	}
+	for i, tv := range tt {
+		if _, err := buildHealthCheckConfig(tv.ip, tv.port, tv.op); err == nil {
+			t.Fatalf("#%d: expected error", i)
+		}
+	}
+}
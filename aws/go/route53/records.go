@@ -0,0 +1,353 @@
+package route53
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_route53_v2 "github.com/aws/aws-sdk-go-v2/service/route53"
+	aws_route53_v2_types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// Represents the resource record set (non-alias).
+type Record struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	TTL    int64    `json:"ttl"`
+	Values []string `json:"values"`
+
+	// Set for the weighted, latency, or failover routing policy.
+	SetIdentifier string `json:"set_identifier,omitempty"`
+	Weight        *int64 `json:"weight,omitempty"`
+	Region        string `json:"region,omitempty"`
+	Failover      string `json:"failover,omitempty"`
+
+	HealthCheckID string `json:"health_check_id,omitempty"`
+}
+
+// ref. https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/DNSLimitations.html#limits-api-requests-changeresourcerecordsets
+const (
+	// Maximum number of "ResourceRecord" elements in a single change batch.
+	maxBatchRecords = 1000
+	// Maximum number of characters of the values in a single change batch.
+	maxBatchValueChars = 32000
+
+	defaultChangeInterval = 5 * time.Second
+)
+
+// Lists all the records in the hosted zone.
+// The alias records are skipped, since they have no values.
+func ListRecords(ctx context.Context, cfg aws.Config, zoneID string) ([]Record, error) {
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	pg := aws_route53_v2.NewListResourceRecordSetsPaginator(cli, &aws_route53_v2.ListResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+	})
+	rs := make([]Record, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, rrs := range out.ResourceRecordSets {
+			if rrs.AliasTarget != nil {
+				continue
+			}
+			rs = append(rs, convertRecordSet(rrs))
+		}
+	}
+	return rs, nil
+}
+
+// Creates or updates the records, splitting the changes into multiple batches
+// if they exceed the change batch limits. Use "WithWait" to wait for each batch
+// to be propagated (INSYNC) before submitting the next one.
+// Returns the change IDs of the submitted batches.
+func UpsertRecords(ctx context.Context, cfg aws.Config, zoneID string, records []Record, opts ...OpOption) ([]string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	changes := make([]aws_route53_v2_types.Change, 0, len(records))
+	for _, r := range records {
+		rrs, err := r.recordSet()
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, aws_route53_v2_types.Change{Action: aws_route53_v2_types.ChangeActionUpsert, ResourceRecordSet: &rrs})
+	}
+	logutil.S().Infow("upserting records", "zoneID", zoneID, "records", len(records))
+	return changeRecords(ctx, cfg, zoneID, changes, ret)
+}
+
+// Deletes the records. If the record values are empty, the current record
+// of the name, type, and set identifier is looked up first, since the deletion
+// requires the exact record set, including the values and TTL.
+// Records not found are skipped. Returns the change IDs of the submitted batches.
+func DeleteRecords(ctx context.Context, cfg aws.Config, zoneID string, records []Record, opts ...OpOption) ([]string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	changes := make([]aws_route53_v2_types.Change, 0, len(records))
+	for _, r := range records {
+		r.Name = fqdn(r.Name)
+		if len(r.Values) == 0 {
+			rrs, found, err := getRecord(ctx, cfg, zoneID, r.Name, r.Type, r.SetIdentifier)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				logutil.S().Infow("record not found, skipping delete", "zoneID", zoneID, "name", r.Name, "type", r.Type, "setIdentifier", r.SetIdentifier)
+				continue
+			}
+			changes = append(changes, aws_route53_v2_types.Change{Action: aws_route53_v2_types.ChangeActionDelete, ResourceRecordSet: &rrs})
+			continue
+		}
+		rrs, err := r.recordSet()
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, aws_route53_v2_types.Change{Action: aws_route53_v2_types.ChangeActionDelete, ResourceRecordSet: &rrs})
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	logutil.S().Infow("deleting records", "zoneID", zoneID, "records", len(changes))
+	return changeRecords(ctx, cfg, zoneID, changes, ret)
+}
+
+// Creates or updates the record (e.g., "A" or "AAAA") with the values.
+// Use "WithTTL" for the TTL, "WithWeight", "WithLatency", or "WithFailover" for the routing policy,
+// "WithHealthCheckID" for the health check, and "WithWait" to wait for the change to be propagated.
+// Returns the change ID.
+func UpsertRecord(ctx context.Context, cfg aws.Config, zoneID string, name string, recordType string, values []string, opts ...OpOption) (string, error) {
+	ret := &Op{ttl: 300}
+	ret.applyOpts(opts)
+
+	ids, err := UpsertRecords(ctx, cfg, zoneID, []Record{newRecord(name, recordType, values, ret)}, opts...)
+	if len(ids) == 0 {
+		return "", err
+	}
+	return ids[0], err
+}
+
+// Deletes the record of the name and type (and the set identifier of "WithWeight", "WithLatency", or "WithFailover").
+// No-op if not found. Returns the change ID, or empty if not found.
+func DeleteRecord(ctx context.Context, cfg aws.Config, zoneID string, name string, recordType string, opts ...OpOption) (string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	ids, err := DeleteRecords(ctx, cfg, zoneID, []Record{newRecord(name, recordType, nil, ret)}, opts...)
+	if len(ids) == 0 {
+		return "", err
+	}
+	return ids[0], err
+}
+
+// Polls the change status until it is propagated to all Route 53 servers (INSYNC).
+// Use "WithInterval" for the poll interval.
+func WaitForChange(ctx context.Context, cfg aws.Config, changeID string, opts ...OpOption) error {
+	ret := &Op{interval: defaultChangeInterval}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("waiting for record change to propagate", "changeID", changeID, "interval", ret.interval)
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	interval := time.Duration(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+			// first poll is no-wait, in case the change is already in sync
+			interval = ret.interval
+		}
+
+		out, err := cli.GetChange(ctx, &aws_route53_v2.GetChangeInput{
+			Id: aws.String(changeID),
+		})
+		if err != nil {
+			return err
+		}
+		if out.ChangeInfo.Status == aws_route53_v2_types.ChangeStatusInsync {
+			logutil.S().Infow("record change propagated", "changeID", changeID)
+			return nil
+		}
+		logutil.S().Infow("record change not propagated yet", "changeID", changeID, "status", out.ChangeInfo.Status)
+	}
+}
+
+func getRecord(ctx context.Context, cfg aws.Config, zoneID string, name string, recordType string, setIdentifier string) (aws_route53_v2_types.ResourceRecordSet, bool, error) {
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	input := &aws_route53_v2.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(zoneID),
+		StartRecordName: aws.String(name),
+		StartRecordType: aws_route53_v2_types.RRType(recordType),
+	}
+	if setIdentifier != "" {
+		input.StartRecordIdentifier = aws.String(setIdentifier)
+	}
+	out, err := cli.ListResourceRecordSets(ctx, input)
+	if err != nil {
+		return aws_route53_v2_types.ResourceRecordSet{}, false, err
+	}
+	for _, rrs := range out.ResourceRecordSets {
+		// the names are returned with the escaped characters and the trailing dot
+		if !strings.EqualFold(aws.ToString(rrs.Name), name) || string(rrs.Type) != recordType {
+			continue
+		}
+		if aws.ToString(rrs.SetIdentifier) != setIdentifier {
+			continue
+		}
+		return rrs, true, nil
+	}
+	return aws_route53_v2_types.ResourceRecordSet{}, false, nil
+}
+
+// Submits the changes in batches, and waits for each batch if "WithWait" is set.
+func changeRecords(ctx context.Context, cfg aws.Config, zoneID string, changes []aws_route53_v2_types.Change, op *Op) ([]string, error) {
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	batches := splitChanges(changes)
+	ids := make([]string, 0, len(batches))
+	for i, batch := range batches {
+		out, err := cli.ChangeResourceRecordSets(ctx, &aws_route53_v2.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(zoneID),
+			ChangeBatch: &aws_route53_v2_types.ChangeBatch{
+				Changes: batch,
+			},
+		})
+		if err != nil {
+			return ids, err
+		}
+		changeID := aws.ToString(out.ChangeInfo.Id)
+		ids = append(ids, changeID)
+		logutil.S().Infow("successfully requested record changes", "batch", i+1, "batches", len(batches), "changes", len(batch), "changeID", changeID, "status", out.ChangeInfo.Status)
+
+		if op.wait > 0 {
+			wctx, wcancel := context.WithTimeout(ctx, op.wait)
+			err = WaitForChange(wctx, cfg, changeID, WithInterval(op.interval))
+			wcancel()
+			if err != nil {
+				return ids, err
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Splits the changes so that each batch stays within the "ResourceRecord" element
+// and value character limits, where an UPSERT counts twice.
+// A single change exceeding the limits is sent in its own batch, for the API to reject.
+func splitChanges(changes []aws_route53_v2_types.Change) [][]aws_route53_v2_types.Change {
+	batches := make([][]aws_route53_v2_types.Change, 0, 1)
+	cur := make([]aws_route53_v2_types.Change, 0)
+	records, chars := 0, 0
+	for _, c := range changes {
+		n, m := len(c.ResourceRecordSet.ResourceRecords), 0
+		for _, r := range c.ResourceRecordSet.ResourceRecords {
+			m += len(aws.ToString(r.Value))
+		}
+		if c.Action == aws_route53_v2_types.ChangeActionUpsert {
+			n, m = 2*n, 2*m
+		}
+		if len(cur) > 0 && (records+n > maxBatchRecords || chars+m > maxBatchValueChars) {
+			batches = append(batches, cur)
+			cur, records, chars = make([]aws_route53_v2_types.Change, 0), 0, 0
+		}
+		cur = append(cur, c)
+		records, chars = records+n, chars+m
+	}
+	if len(cur) > 0 {
+		batches = append(batches, cur)
+	}
+	return batches
+}
+
+func newRecord(name string, recordType string, values []string, op *Op) Record {
+	return Record{
+		Name:          name,
+		Type:          recordType,
+		TTL:           op.ttl,
+		Values:        values,
+		SetIdentifier: op.setIdentifier,
+		Weight:        op.weight,
+		Region:        op.region,
+		Failover:      op.failover,
+		HealthCheckID: op.healthCheckID,
+	}
+}
+
+func (r Record) recordSet() (aws_route53_v2_types.ResourceRecordSet, error) {
+	switch aws_route53_v2_types.RRType(r.Type) {
+	case aws_route53_v2_types.RRTypeA, aws_route53_v2_types.RRTypeAaaa, aws_route53_v2_types.RRTypeCname, aws_route53_v2_types.RRTypeTxt:
+	default:
+		return aws_route53_v2_types.ResourceRecordSet{}, fmt.Errorf("unsupported record type %q", r.Type)
+	}
+	if len(r.Values) == 0 {
+		return aws_route53_v2_types.ResourceRecordSet{}, errors.New("empty record values")
+	}
+	policies := 0
+	if r.Weight != nil {
+		policies++
+	}
+	if r.Region != "" {
+		policies++
+	}
+	switch aws_route53_v2_types.ResourceRecordSetFailover(r.Failover) {
+	case "":
+	case aws_route53_v2_types.ResourceRecordSetFailoverPrimary, aws_route53_v2_types.ResourceRecordSetFailoverSecondary:
+		policies++
+	default:
+		return aws_route53_v2_types.ResourceRecordSet{}, fmt.Errorf("unsupported failover %q", r.Failover)
+	}
+	if policies > 1 {
+		return aws_route53_v2_types.ResourceRecordSet{}, errors.New("weighted, latency, and failover routing policies are mutually exclusive")
+	}
+	if policies > 0 && r.SetIdentifier == "" {
+		return aws_route53_v2_types.ResourceRecordSet{}, errors.New("empty set identifier for the routing policy")
+	}
+
+	rrs := aws_route53_v2_types.ResourceRecordSet{
+		Name: aws.String(fqdn(r.Name)),
+		Type: aws_route53_v2_types.RRType(r.Type),
+		TTL:  aws.Int64(r.TTL),
+	}
+	for _, v := range r.Values {
+		rrs.ResourceRecords = append(rrs.ResourceRecords, aws_route53_v2_types.ResourceRecord{Value: aws.String(v)})
+	}
+	if r.SetIdentifier != "" {
+		rrs.SetIdentifier = aws.String(r.SetIdentifier)
+	}
+	if r.Weight != nil {
+		rrs.Weight = r.Weight
+	}
+	if r.Region != "" {
+		rrs.Region = aws_route53_v2_types.ResourceRecordSetRegion(r.Region)
+	}
+	if r.Failover != "" {
+		rrs.Failover = aws_route53_v2_types.ResourceRecordSetFailover(r.Failover)
+	}
+	if r.HealthCheckID != "" {
+		rrs.HealthCheckId = aws.String(r.HealthCheckID)
+	}
+	return rrs, nil
+}
+
+func convertRecordSet(rrs aws_route53_v2_types.ResourceRecordSet) Record {
+	r := Record{
+		Name:          aws.ToString(rrs.Name),
+		Type:          string(rrs.Type),
+		TTL:           aws.ToInt64(rrs.TTL),
+		SetIdentifier: aws.ToString(rrs.SetIdentifier),
+		Weight:        rrs.Weight,
+		Region:        string(rrs.Region),
+		Failover:      string(rrs.Failover),
+		HealthCheckID: aws.ToString(rrs.HealthCheckId),
+	}
+	for _, v := range rrs.ResourceRecords {
+		r.Values = append(r.Values, aws.ToString(v.Value))
+	}
+	return r
+}
@@ -0,0 +1,116 @@
+package route53
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_route53_v2_types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+func TestRecordSet(t *testing.T) {
+	rrs, err := newRecord("i-0.example.com", "A", []string{"1.2.3.4"}, &Op{ttl: 60}).recordSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(rrs.Name) != "i-0.example.com." || aws.ToInt64(rrs.TTL) != 60 || rrs.SetIdentifier != nil || rrs.Weight != nil {
+		t.Fatalf("unexpected record set %+v", rrs)
+	}
+	if r := convertRecordSet(rrs); r.Name != "i-0.example.com." || r.TTL != 60 || len(r.Values) != 1 || r.Values[0] != "1.2.3.4" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+
+	op := &Op{ttl: 60}
+	WithWeight("i-0", 10)(op)
+	rrs, err = newRecord("api.example.com", "AAAA", []string{"2001:db8::1"}, op).recordSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(rrs.SetIdentifier) != "i-0" || aws.ToInt64(rrs.Weight) != 10 {
+		t.Fatalf("unexpected record set %+v", rrs)
+	}
+
+	op = &Op{ttl: 60}
+	WithLatency("i-0", "us-west-2")(op)
+	rrs, err = newRecord("api.example.com", "A", []string{"1.2.3.4"}, op).recordSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rrs.Region != aws_route53_v2_types.ResourceRecordSetRegionUsWest2 {
+		t.Fatalf("unexpected record set %+v", rrs)
+	}
+
+	op = &Op{ttl: 60}
+	WithFailover("i-0", "PRIMARY")(op)
+	WithHealthCheckID("hc-0")(op)
+	rrs, err = newRecord("api.example.com", "A", []string{"1.2.3.4"}, op).recordSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rrs.Failover != aws_route53_v2_types.ResourceRecordSetFailoverPrimary || aws.ToString(rrs.HealthCheckId) != "hc-0" {
+		t.Fatalf("unexpected record set %+v", rrs)
+	}
+	if r := convertRecordSet(rrs); r.Failover != "PRIMARY" || r.HealthCheckID != "hc-0" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+	WithFailover("i-0", "TERTIARY")(op)
+	if _, err = newRecord("api.example.com", "A", []string{"1.2.3.4"}, op).recordSet(); err == nil {
+		t.Fatal("expected error for unsupported failover")
+	}
+
+	op = &Op{ttl: 60}
+	WithLatency("i-0", "us-west-2")(op)
+	WithWeight("i-0", 10)(op)
+	if _, err = newRecord("api.example.com", "A", []string{"1.2.3.4"}, op).recordSet(); err == nil {
+		t.Fatal("expected error for both weighted and latency")
+	}
+	if _, err = newRecord("api.example.com", "MX", []string{"1.2.3.4"}, &Op{}).recordSet(); err == nil {
+		t.Fatal("expected error for unsupported type")
+	}
+	if _, err = newRecord("api.example.com", "A", nil, &Op{}).recordSet(); err == nil {
+		t.Fatal("expected error for empty values")
+	}
+}
+
+func TestSplitChanges(t *testing.T) {
+	change := func(action aws_route53_v2_types.ChangeAction, values int, valueLen int) aws_route53_v2_types.Change {
+		rrs := &aws_route53_v2_types.ResourceRecordSet{}
+		for i := 0; i < values; i++ {
+			rrs.ResourceRecords = append(rrs.ResourceRecords, aws_route53_v2_types.ResourceRecord{Value: aws.String(strings.Repeat("a", valueLen))})
+		}
+		return aws_route53_v2_types.Change{Action: action, ResourceRecordSet: rrs}
+	}
+	repeat := func(c aws_route53_v2_types.Change, n int) []aws_route53_v2_types.Change {
+		cs := make([]aws_route53_v2_types.Change, n)
+		for i := range cs {
+			cs[i] = c
+		}
+		return cs
+	}
+
+	tt := []struct {
+		changes  []aws_route53_v2_types.Change
+		expected []int
+	}{
+		{changes: nil, expected: []int{}},
+		{changes: repeat(change(aws_route53_v2_types.ChangeActionDelete, 1, 1), 1000), expected: []int{1000}},
+		{changes: repeat(change(aws_route53_v2_types.ChangeActionDelete, 1, 1), 1001), expected: []int{1000, 1}},
+		// upsert counts twice
+		{changes: repeat(change(aws_route53_v2_types.ChangeActionUpsert, 1, 1), 501), expected: []int{500, 1}},
+		// value characters limit
+		{changes: repeat(change(aws_route53_v2_types.ChangeActionDelete, 1, 255), 200), expected: []int{125, 75}},
+		// oversized change in its own batch
+		{changes: []aws_route53_v2_types.Change{change(aws_route53_v2_types.ChangeActionDelete, 1, 1), change(aws_route53_v2_types.ChangeActionDelete, 1001, 1)}, expected: []int{1, 1}},
+	}
+	for i, tv := range tt {
+		batches := splitChanges(tv.changes)
+		if len(batches) != len(tv.expected) {
+			t.Fatalf("#%d: expected %d batches, got %d", i, len(tv.expected), len(batches))
+		}
+		for j, b := range batches {
+			if len(b) != tv.expected[j] {
+				t.Fatalf("#%d: batch %d expected %d changes, got %d", i, j, tv.expected[j], len(b))
+			}
+		}
+	}
+}
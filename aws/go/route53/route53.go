@@ -0,0 +1,252 @@
+// Package route53 implements Route 53 utils.
+package route53
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_route53_v2 "github.com/aws/aws-sdk-go-v2/service/route53"
+	aws_route53_v2_types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+type Op struct {
+	failover         string
+	failureThreshold int32
+	healthCheckID    string
+	healthCheckType  string
+	interval         time.Duration
+	region           string
+	requestInterval  int32
+	resourcePath     string
+	setIdentifier    string
+	tags             map[string]string
+	ttl              int64
+	wait             time.Duration
+	weight           *int64
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Sets the failover routing policy with the role of the record ("PRIMARY" or "SECONDARY"),
+// and the identifier to differentiate the records with the same name and type.
+// Use "WithHealthCheckID" to fail over when the primary health check fails.
+// ref. https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/routing-policy-failover.html
+func WithFailover(setIdentifier string, failover string) OpOption {
+	return func(op *Op) {
+		op.setIdentifier = setIdentifier
+		op.failover = failover
+	}
+}
+
+// Sets the number of consecutive health check failures (or successes)
+// to change the health status (default 3).
+func WithFailureThreshold(v int32) OpOption {
+	return func(op *Op) {
+		op.failureThreshold = v
+	}
+}
+
+// Sets the health check to associate with the record.
+func WithHealthCheckID(v string) OpOption {
+	return func(op *Op) {
+		op.healthCheckID = v
+	}
+}
+
+// Sets the health check type ("TCP", "HTTP", or "HTTPS", default "TCP").
+func WithHealthCheckType(v string) OpOption {
+	return func(op *Op) {
+		op.healthCheckType = v
+	}
+}
+
+// Sets the poll interval for the change status (default 5 seconds).
+func WithInterval(v time.Duration) OpOption {
+	return func(op *Op) {
+		op.interval = v
+	}
+}
+
+// Sets the latency routing policy with the region of the record (e.g., "us-west-2"),
+// and the identifier to differentiate the records with the same name and type.
+// ref. https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/routing-policy-latency.html
+func WithLatency(setIdentifier string, region string) OpOption {
+	return func(op *Op) {
+		op.setIdentifier = setIdentifier
+		op.region = region
+	}
+}
+
+// Sets the health check request interval in seconds (10 or 30, default 30).
+// Cannot be changed after the health check is created.
+func WithRequestInterval(v int32) OpOption {
+	return func(op *Op) {
+		op.requestInterval = v
+	}
+}
+
+// Sets the path for the HTTP or HTTPS health check (default "/").
+func WithResourcePath(v string) OpOption {
+	return func(op *Op) {
+		op.resourcePath = v
+	}
+}
+
+// Sets the tags of the health check.
+func WithTags(v map[string]string) OpOption {
+	return func(op *Op) {
+		op.tags = v
+	}
+}
+
+// Sets the record TTL in seconds (default 300).
+func WithTTL(v int64) OpOption {
+	return func(op *Op) {
+		op.ttl = v
+	}
+}
+
+// Sets the maximum duration to wait for the change to be propagated (INSYNC), 0 to not wait.
+func WithWait(v time.Duration) OpOption {
+	return func(op *Op) {
+		op.wait = v
+	}
+}
+
+// Sets the weighted routing policy with the weight (0 to 255),
+// and the identifier to differentiate the records with the same name and type.
+// ref. https://docs.aws.amazon.com/Route53/latest/DeveloperGuide/routing-policy-weighted.html
+func WithWeight(setIdentifier string, weight int64) OpOption {
+	return func(op *Op) {
+		op.setIdentifier = setIdentifier
+		op.weight = &weight
+	}
+}
+
+// Represents the hosted zone.
+type HostedZone struct {
+	// Hosted zone ID without the "/hostedzone/" prefix.
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Private bool              `json:"private"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
+
+// Returned when no hosted zone matches the tags.
+var ErrHostedZoneNotFound = errors.New("hosted zone not found")
+
+// Fetches the hosted zone by ID.
+func GetHostedZone(ctx context.Context, cfg aws.Config, zoneID string) (HostedZone, error) {
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	out, err := cli.GetHostedZone(ctx, &aws_route53_v2.GetHostedZoneInput{
+		Id: aws.String(zoneID),
+	})
+	if err != nil {
+		return HostedZone{}, err
+	}
+	return convertHostedZone(*out.HostedZone), nil
+}
+
+// Finds the hosted zone whose tags match all the tags.
+// Returns "ErrHostedZoneNotFound" if none found, or an error if more than one found.
+func FindHostedZoneByTags(ctx context.Context, cfg aws.Config, tags map[string]string) (HostedZone, error) {
+	logutil.S().Infow("finding hosted zone by tags", "tags", tags)
+
+	cli := aws_route53_v2.NewFromConfig(cfg)
+	pg := aws_route53_v2.NewListHostedZonesPaginator(cli, &aws_route53_v2.ListHostedZonesInput{})
+	zones := make(map[string]HostedZone)
+	ids := make([]string, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return HostedZone{}, err
+		}
+		for _, raw := range out.HostedZones {
+			z := convertHostedZone(raw)
+			zones[z.ID] = z
+			ids = append(ids, z.ID)
+		}
+	}
+
+	matched := make([]HostedZone, 0, 1)
+	// ref. https://docs.aws.amazon.com/Route53/latest/APIReference/API_ListTagsForResources.html
+	for len(ids) > 0 {
+		n := min(len(ids), 10)
+		out, err := cli.ListTagsForResources(ctx, &aws_route53_v2.ListTagsForResourcesInput{
+			ResourceType: aws_route53_v2_types.TagResourceTypeHostedzone,
+			ResourceIds:  ids[:n],
+		})
+		if err != nil {
+			return HostedZone{}, err
+		}
+		ids = ids[n:]
+
+		for _, rts := range out.ResourceTagSets {
+			m := make(map[string]string, len(rts.Tags))
+			for _, tg := range rts.Tags {
+				m[aws.ToString(tg.Key)] = aws.ToString(tg.Value)
+			}
+			if !matchTags(m, tags) {
+				continue
+			}
+			z := zones[aws.ToString(rts.ResourceId)]
+			z.Tags = m
+			matched = append(matched, z)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return HostedZone{}, ErrHostedZoneNotFound
+	case 1:
+		logutil.S().Infow("found hosted zone", "id", matched[0].ID, "name", matched[0].Name)
+		return matched[0], nil
+	default:
+		return HostedZone{}, fmt.Errorf("expected 1 hosted zone, found %d for tags %v", len(matched), tags)
+	}
+}
+
+func convertHostedZone(raw aws_route53_v2_types.HostedZone) HostedZone {
+	z := HostedZone{
+		ID:   strings.TrimPrefix(aws.ToString(raw.Id), "/hostedzone/"),
+		Name: aws.ToString(raw.Name),
+	}
+	if raw.Config != nil {
+		z.Private = raw.Config.PrivateZone
+	}
+	return z
+}
+
+// Returns the fully qualified domain name with the trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// Returns the record name of the host in the zone (e.g., "i-1234.example.com.").
+func RecordName(host string, zoneName string) string {
+	return fqdn(strings.TrimSuffix(host, ".") + "." + strings.TrimPrefix(fqdn(zoneName), "."))
+}
+
+// Returns true if the tags have all the selector tags.
+func matchTags(tags map[string]string, selector map[string]string) bool {
+	for k, v := range selector {
+		if cur, ok := tags[k]; !ok || cur != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,22 @@
+package route53
+
+import (
+	"testing"
+)
+
+func TestRecordName(t *testing.T) {
+	tt := []struct {
+		host     string
+		zoneName string
+		expected string
+	}{
+		{host: "i-0", zoneName: "example.com.", expected: "i-0.example.com."},
+		{host: "i-0", zoneName: "example.com", expected: "i-0.example.com."},
+		{host: "i-0.", zoneName: "example.com", expected: "i-0.example.com."},
+	}
+	for i, tv := range tt {
+		if name := RecordName(tv.host, tv.zoneName); name != tv.expected {
+			t.Fatalf("#%d: expected %q, got %q", i, tv.expected, name)
+		}
+	}
+}
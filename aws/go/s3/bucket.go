@@ -0,0 +1,258 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_s3_v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	aws_s3_v2_types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Represents the bucket lifecycle rule, identified by its ID.
+// The zero days are not set.
+type LifecycleRule struct {
+	ID     string
+	Prefix string
+
+	ExpirationDays                     int32
+	NoncurrentVersionExpirationDays    int32
+	AbortIncompleteMultipartUploadDays int32
+
+	TransitionDays         int32
+	TransitionStorageClass aws_s3_v2_types.TransitionStorageClass
+}
+
+// Creates the bucket if it does not exist, and applies the settings to the bucket
+// (e.g., the backup bucket provisioned by the backup tooling itself).
+// Safe to call repeatedly: only the settings in the options are updated, and the others are kept.
+//
+//   - "WithBlockPublicAccess" (or "WithBucketBlock*") for the public access block
+//   - "WithSSEKMS" (or "WithServerSideEncryption" for SSE-S3) for the default encryption
+//   - "WithVersioning" for the versioning
+//   - "WithLifecycleRule" for the lifecycle rules, replacing the existing rules of the same IDs
+//   - "WithBucketPolicy" and "WithDenyInsecureTransport" for the bucket policy
+func EnsureBucket(ctx context.Context, cfg aws.Config, bucketName string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	exists, err := BucketExists(ctx, cfg, bucketName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err = CreateBucket(ctx, cfg, bucketName, WithSkipBucketPolicy(true)); err != nil {
+			return err
+		}
+	}
+
+	cli := aws_s3_v2.NewFromConfig(cfg)
+	if pab := buildPublicAccessBlock(ret); pab != nil {
+		logutil.S().Infow("applying public access block", "bucket", bucketName)
+		_, err = cli.PutPublicAccessBlock(ctx, &aws_s3_v2.PutPublicAccessBlockInput{
+			Bucket:                         aws.String(bucketName),
+			PublicAccessBlockConfiguration: pab,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if enc := buildEncryption(ret); enc != nil {
+		logutil.S().Infow("applying default encryption", "bucket", bucketName, "sseKMS", ret.sseKMS, "kmsKeyID", ret.kmsKeyID)
+		_, err = cli.PutBucketEncryption(ctx, &aws_s3_v2.PutBucketEncryptionInput{
+			Bucket:                            aws.String(bucketName),
+			ServerSideEncryptionConfiguration: enc,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if ret.versioning != nil {
+		status := aws_s3_v2_types.BucketVersioningStatusSuspended
+		if *ret.versioning {
+			status = aws_s3_v2_types.BucketVersioningStatusEnabled
+		}
+		logutil.S().Infow("applying versioning", "bucket", bucketName, "status", status)
+		_, err = cli.PutBucketVersioning(ctx, &aws_s3_v2.PutBucketVersioningInput{
+			Bucket:                  aws.String(bucketName),
+			VersioningConfiguration: &aws_s3_v2_types.VersioningConfiguration{Status: status},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(ret.lifecycleRules) > 0 {
+		var existing []aws_s3_v2_types.LifecycleRule
+		out, err := cli.GetBucketLifecycleConfiguration(ctx, &aws_s3_v2.GetBucketLifecycleConfigurationInput{
+			Bucket: aws.String(bucketName),
+		})
+		switch {
+		case err == nil:
+			existing = out.Rules
+		case !isErrorCode(err, "NoSuchLifecycleConfiguration"):
+			return err
+		}
+		rules := mergeLifecycleRules(existing, ret.lifecycleRules)
+		logutil.S().Infow("applying lifecycle rules", "bucket", bucketName, "rules", len(rules))
+		_, err = cli.PutBucketLifecycleConfiguration(ctx, &aws_s3_v2.PutBucketLifecycleConfigurationInput{
+			Bucket:                 aws.String(bucketName),
+			LifecycleConfiguration: &aws_s3_v2_types.BucketLifecycleConfiguration{Rules: rules},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	policy, err := buildBucketPolicy(bucketName, ret)
+	if err != nil {
+		return err
+	}
+	if policy != "" {
+		logutil.S().Infow("applying bucket policy", "bucket", bucketName, "denyInsecureTransport", ret.denyInsecureTransport)
+		_, err = cli.PutBucketPolicy(ctx, &aws_s3_v2.PutBucketPolicyInput{
+			Bucket: aws.String(bucketName),
+			Policy: aws.String(policy),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	logutil.S().Infow("successfully ensured bucket", "bucket", bucketName)
+	return nil
+}
+
+func buildPublicAccessBlock(ret *Op) *aws_s3_v2_types.PublicAccessBlockConfiguration {
+	if ret.bucketBlockPublicACLs == nil && ret.bucketBlockPublicPolicy == nil && ret.bucketIgnorePublicACLs == nil && ret.bucketRestrictPublicBuckets == nil {
+		return nil
+	}
+	return &aws_s3_v2_types.PublicAccessBlockConfiguration{
+		BlockPublicAcls:       aws.Bool(aws.ToBool(ret.bucketBlockPublicACLs)),
+		BlockPublicPolicy:     aws.Bool(aws.ToBool(ret.bucketBlockPublicPolicy)),
+		IgnorePublicAcls:      aws.Bool(aws.ToBool(ret.bucketIgnorePublicACLs)),
+		RestrictPublicBuckets: aws.Bool(aws.ToBool(ret.bucketRestrictPublicBuckets)),
+	}
+}
+
+func buildEncryption(ret *Op) *aws_s3_v2_types.ServerSideEncryptionConfiguration {
+	var def *aws_s3_v2_types.ServerSideEncryptionByDefault
+	bucketKey := false
+	switch {
+	case ret.sseKMS:
+		def = &aws_s3_v2_types.ServerSideEncryptionByDefault{SSEAlgorithm: aws_s3_v2_types.ServerSideEncryptionAwsKms}
+		if ret.kmsKeyID != "" {
+			def.KMSMasterKeyID = aws.String(ret.kmsKeyID)
+		}
+		// reduces the KMS requests (and cost) with the bucket-level key
+		bucketKey = true
+	case ret.serverSideEncryption:
+		def = &aws_s3_v2_types.ServerSideEncryptionByDefault{SSEAlgorithm: aws_s3_v2_types.ServerSideEncryptionAes256}
+	default:
+		return nil
+	}
+	return &aws_s3_v2_types.ServerSideEncryptionConfiguration{
+		Rules: []aws_s3_v2_types.ServerSideEncryptionRule{
+			{
+				ApplyServerSideEncryptionByDefault: def,
+				BucketKeyEnabled:                   aws.Bool(bucketKey),
+			},
+		},
+	}
+}
+
+// Returns the existing rules with the other IDs, followed by the desired rules.
+func mergeLifecycleRules(existing []aws_s3_v2_types.LifecycleRule, desired []LifecycleRule) []aws_s3_v2_types.LifecycleRule {
+	ids := make(map[string]struct{}, len(desired))
+	for _, r := range desired {
+		ids[r.ID] = struct{}{}
+	}
+	rules := make([]aws_s3_v2_types.LifecycleRule, 0, len(existing)+len(desired))
+	for _, r := range existing {
+		if _, ok := ids[aws.ToString(r.ID)]; !ok {
+			rules = append(rules, r)
+		}
+	}
+	for _, r := range desired {
+		rules = append(rules, r.toRule())
+	}
+	return rules
+}
+
+func (r LifecycleRule) toRule() aws_s3_v2_types.LifecycleRule {
+	rule := aws_s3_v2_types.LifecycleRule{
+		ID:     aws.String(r.ID),
+		Status: aws_s3_v2_types.ExpirationStatusEnabled,
+		Filter: &aws_s3_v2_types.LifecycleRuleFilter{Prefix: aws.String(r.Prefix)},
+	}
+	if r.ExpirationDays > 0 {
+		rule.Expiration = &aws_s3_v2_types.LifecycleExpiration{Days: aws.Int32(r.ExpirationDays)}
+	}
+	if r.NoncurrentVersionExpirationDays > 0 {
+		rule.NoncurrentVersionExpiration = &aws_s3_v2_types.NoncurrentVersionExpiration{NoncurrentDays: aws.Int32(r.NoncurrentVersionExpirationDays)}
+	}
+	if r.AbortIncompleteMultipartUploadDays > 0 {
+		rule.AbortIncompleteMultipartUpload = &aws_s3_v2_types.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int32(r.AbortIncompleteMultipartUploadDays)}
+	}
+	if r.TransitionDays > 0 {
+		rule.Transitions = []aws_s3_v2_types.Transition{{Days: aws.Int32(r.TransitionDays), StorageClass: r.TransitionStorageClass}}
+	}
+	return rule
+}
+
+// Returns the bucket policy with the "WithBucketPolicy" statements and the deny statement
+// for "WithDenyInsecureTransport", or empty if neither is set.
+func buildBucketPolicy(bucketName string, ret *Op) (string, error) {
+	if !ret.denyInsecureTransport {
+		return ret.bucketPolicy, nil
+	}
+
+	policy := map[string]interface{}{"Version": "2012-10-17"}
+	var statements []interface{}
+	if ret.bucketPolicy != "" {
+		if err := json.Unmarshal([]byte(ret.bucketPolicy), &policy); err != nil {
+			return "", fmt.Errorf("failed to parse bucket policy %v", err)
+		}
+		if v, ok := policy["Statement"]; ok {
+			// single statement object is also valid
+			switch st := v.(type) {
+			case []interface{}:
+				statements = st
+			default:
+				statements = []interface{}{st}
+			}
+		}
+	}
+	statements = append(statements, map[string]interface{}{
+		"Sid":       "DenyInsecureTransport",
+		"Effect":    "Deny",
+		"Principal": "*",
+		"Action":    "s3:*",
+		"Resource": []string{
+			"arn:aws:s3:::" + bucketName,
+			"arn:aws:s3:::" + bucketName + "/*",
+		},
+		"Condition": map[string]interface{}{
+			"Bool": map[string]string{"aws:SecureTransport": "false"},
+		},
+	})
+	policy["Statement"] = statements
+
+	b, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func isErrorCode(err error, code string) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == code
+}
@@ -0,0 +1,80 @@
+package s3
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_s3_v2_types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestBuildEncryption(t *testing.T) {
+	if enc := buildEncryption(&Op{}); enc != nil {
+		t.Fatalf("expected no encryption, got %+v", enc)
+	}
+
+	op := &Op{}
+	WithSSEKMS("arn:aws:kms:us-west-2:123456789012:key/abc")(op)
+	enc := buildEncryption(op)
+	def := enc.Rules[0].ApplyServerSideEncryptionByDefault
+	if def.SSEAlgorithm != aws_s3_v2_types.ServerSideEncryptionAwsKms || aws.ToString(def.KMSMasterKeyID) != "arn:aws:kms:us-west-2:123456789012:key/abc" || !aws.ToBool(enc.Rules[0].BucketKeyEnabled) {
+		t.Fatalf("unexpected encryption %+v", def)
+	}
+}
+
+func TestBuildPublicAccessBlock(t *testing.T) {
+	if pab := buildPublicAccessBlock(&Op{}); pab != nil {
+		t.Fatalf("expected no public access block, got %+v", pab)
+	}
+	op := &Op{}
+	WithBlockPublicAccess()(op)
+	pab := buildPublicAccessBlock(op)
+	if !aws.ToBool(pab.BlockPublicAcls) || !aws.ToBool(pab.BlockPublicPolicy) || !aws.ToBool(pab.IgnorePublicAcls) || !aws.ToBool(pab.RestrictPublicBuckets) {
+		t.Fatalf("unexpected public access block %+v", pab)
+	}
+}
+
+func TestMergeLifecycleRules(t *testing.T) {
+	existing := []aws_s3_v2_types.LifecycleRule{
+		{ID: aws.String("other")},
+		{ID: aws.String("backups"), Expiration: &aws_s3_v2_types.LifecycleExpiration{Days: aws.Int32(7)}},
+	}
+	rules := mergeLifecycleRules(existing, []LifecycleRule{
+		{ID: "backups", Prefix: "backups/", ExpirationDays: 30, AbortIncompleteMultipartUploadDays: 1},
+	})
+	if len(rules) != 2 || aws.ToString(rules[0].ID) != "other" {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+	r := rules[1]
+	if aws.ToInt32(r.Expiration.Days) != 30 || aws.ToInt32(r.AbortIncompleteMultipartUpload.DaysAfterInitiation) != 1 || r.NoncurrentVersionExpiration != nil || aws.ToString(r.Filter.Prefix) != "backups/" {
+		t.Fatalf("unexpected rule %+v", r)
+	}
+}
+
+func TestBuildBucketPolicy(t *testing.T) {
+	op := &Op{}
+	WithBucketPolicy(`{"Version":"2012-10-17","Statement":{"Sid":"Read","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::b/*"}}`)(op)
+	WithDenyInsecureTransport()(op)
+
+	s, err := buildBucketPolicy("b", op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var policy struct {
+		Version   string
+		Statement []struct {
+			Sid    string
+			Effect string
+		}
+	}
+	if err = json.Unmarshal([]byte(s), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if policy.Version != "2012-10-17" || len(policy.Statement) != 2 || policy.Statement[0].Sid != "Read" || policy.Statement[1].Effect != "Deny" {
+		t.Fatalf("unexpected policy %s", s)
+	}
+
+	if s, err = buildBucketPolicy("b", &Op{}); err != nil || s != "" {
+		t.Fatalf("expected no policy, got %q (%v)", s, err)
+	}
+}
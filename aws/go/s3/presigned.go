@@ -9,6 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	aws_s3_v2_types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // Presigner encapsulates the Amazon Simple Storage Service (Amazon S3) presign actions
@@ -102,3 +103,125 @@ func CreatePreSignedURLForDelete(ctx context.Context, cfg aws.Config, bucket str
 	}
 	return req.URL, nil
 }
+
+const (
+	defaultPreSignDuration = 15 * time.Minute
+
+	// the maximum expiry of the SigV4 presigned request
+	// ref. https://docs.aws.amazon.com/AmazonS3/latest/userguide/using-presigned-url.html
+	maxPreSignDuration = 7 * 24 * time.Hour
+)
+
+// Represents the presigned request with the headers
+// that the client must send along (e.g., "Content-Type" for the upload).
+type PresignedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Header  http.Header `json:"header,omitempty"`
+	Expires time.Time   `json:"expires"`
+}
+
+// Presigns the request to download the object, so the node agents can hand out
+// the temporary download links (e.g., logs, backups) without sharing the credentials.
+// Use "WithPreSignDuration" for the expiry (default 15 minutes), and
+// "WithContentType" and "WithContentDisposition" to override the response headers.
+// Note that the URL expires earlier when signed with the temporary credentials
+// (e.g., instance role), once the credentials expire.
+func PresignGet(ctx context.Context, cfg aws.Config, bucket string, key string, opts ...OpOption) (PresignedRequest, error) {
+	ret := &Op{preSignDuration: defaultPreSignDuration}
+	ret.applyOpts(opts)
+	if err := validatePreSignDuration(ret.preSignDuration); err != nil {
+		return PresignedRequest{}, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if ret.contentType != "" {
+		input.ResponseContentType = aws.String(ret.contentType)
+	}
+	if ret.contentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(ret.contentDisposition)
+	}
+
+	now := time.Now()
+	req, err := NewPresigner(cfg).PresignClient.PresignGetObject(ctx, input, s3.WithPresignExpires(ret.preSignDuration))
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+	return toPresignedRequest(req, now.Add(ret.preSignDuration)), nil
+}
+
+// Presigns the request to upload the object.
+// Use "WithPreSignDuration" for the expiry (default 15 minutes).
+// The SSE-KMS headers ("WithSSEKMS") are signed, and the content headers
+// ("WithContentType", "WithContentDisposition") are stored with the object,
+// so the client must send the returned headers as is.
+func PresignPut(ctx context.Context, cfg aws.Config, bucket string, key string, opts ...OpOption) (PresignedRequest, error) {
+	ret := &Op{preSignDuration: defaultPreSignDuration}
+	ret.applyOpts(opts)
+	if err := validatePreSignDuration(ret.preSignDuration); err != nil {
+		return PresignedRequest{}, err
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if ret.contentType != "" {
+		input.ContentType = aws.String(ret.contentType)
+	}
+	if ret.contentDisposition != "" {
+		input.ContentDisposition = aws.String(ret.contentDisposition)
+	}
+	if ret.sseKMS {
+		input.ServerSideEncryption = aws_s3_v2_types.ServerSideEncryptionAwsKms
+		if ret.kmsKeyID != "" {
+			input.SSEKMSKeyId = aws.String(ret.kmsKeyID)
+		}
+	}
+
+	now := time.Now()
+	req, err := NewPresigner(cfg).PresignClient.PresignPutObject(ctx, input, s3.WithPresignExpires(ret.preSignDuration))
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+	preq := toPresignedRequest(req, now.Add(ret.preSignDuration))
+
+	// not signed, but required for the object to have the content headers
+	if ret.contentType != "" || ret.contentDisposition != "" {
+		if preq.Header == nil {
+			preq.Header = make(http.Header)
+		}
+		if ret.contentType != "" {
+			preq.Header.Set("Content-Type", ret.contentType)
+		}
+		if ret.contentDisposition != "" {
+			preq.Header.Set("Content-Disposition", ret.contentDisposition)
+		}
+	}
+	return preq, nil
+}
+
+func validatePreSignDuration(d time.Duration) error {
+	if d <= 0 || d > maxPreSignDuration {
+		return fmt.Errorf("invalid presign duration %v (must be >0 and <=%v)", d, maxPreSignDuration)
+	}
+	return nil
+}
+
+func toPresignedRequest(req *v4.PresignedHTTPRequest, expires time.Time) PresignedRequest {
+	hdr := req.SignedHeader.Clone()
+	// set by the HTTP client
+	hdr.Del("Host")
+	if len(hdr) == 0 {
+		hdr = nil
+	}
+	return PresignedRequest{
+		Method:  req.Method,
+		URL:     req.URL,
+		Header:  hdr,
+		Expires: expires,
+	}
+}
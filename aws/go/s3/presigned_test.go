@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,9 +15,61 @@ import (
 	"github.com/gyuho/infra/go/httputil"
 	"github.com/gyuho/infra/go/randutil"
 
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	credentials_v2 "github.com/aws/aws-sdk-go-v2/credentials"
 	aws_s3_v2_types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+func TestPresignGetPut(t *testing.T) {
+	cfg := aws_v2.Config{
+		Region:      "us-west-2",
+		Credentials: credentials_v2.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+	}
+
+	get, err := PresignGet(context.Background(), cfg, "bucket", "logs/node.log",
+		WithPreSignDuration(time.Hour),
+		WithContentType("text/plain"),
+		WithContentDisposition(`attachment; filename="node.log"`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(get.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if get.Method != http.MethodGet || q.Get("X-Amz-Expires") != "3600" || q.Get("response-content-type") != "text/plain" || q.Get("response-content-disposition") != `attachment; filename="node.log"` {
+		t.Fatalf("unexpected presigned get %+v", get)
+	}
+	if time.Until(get.Expires) > time.Hour || time.Until(get.Expires) < 59*time.Minute {
+		t.Fatalf("unexpected expires %v", get.Expires)
+	}
+
+	put, err := PresignPut(context.Background(), cfg, "bucket", "backups/data.tar.zst",
+		WithContentType("application/zstd"),
+		WithSSEKMS("alias/backups"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err = url.Parse(put.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := u.Query().Get("X-Amz-SignedHeaders")
+	if put.Method != http.MethodPut || u.Query().Get("X-Amz-Expires") != "900" || !strings.Contains(signed, "x-amz-server-side-encryption") {
+		t.Fatalf("unexpected presigned put %+v", put)
+	}
+	if put.Header.Get("Content-Type") != "application/zstd" || put.Header.Get("X-Amz-Server-Side-Encryption") != "aws:kms" || put.Header.Get("Host") != "" {
+		t.Fatalf("unexpected presigned put header %v", put.Header)
+	}
+
+	if _, err = PresignGet(context.Background(), cfg, "bucket", "key", WithPreSignDuration(8*24*time.Hour)); err == nil {
+		t.Fatal("expected error for too long presign duration")
+	}
+}
+
 func TestS3PrivatePreSigned(t *testing.T) {
 	if os.Getenv("RUN_AWS_S3_TESTS") != "1" {
 		t.Skip()
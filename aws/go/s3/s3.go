@@ -558,9 +558,25 @@ type Op struct {
 
 	metadata map[string]string
 
-	preSignDuration time.Duration
+	// for the presigned requests
+	preSignDuration    time.Duration
+	contentDisposition string
+	contentType        string
 
 	skipBucketPolicy bool
+
+	// for "EnsureBucket"
+	denyInsecureTransport bool
+	lifecycleRules        []LifecycleRule
+	versioning            *bool
+
+	// for the uploads and downloads
+	concurrency      int
+	kmsKeyID         string
+	partSize         int64
+	progressFunc     func(Progress)
+	retryMaxAttempts int
+	sseKMS           bool
 }
 
 type OpOption func(*Op)
@@ -661,14 +677,102 @@ func WithMetadata(m map[string]string) OpOption {
 	}
 }
 
+// Sets the expiry of the presigned request (default 15 minutes, up to 7 days).
 func WithPreSignDuration(d time.Duration) OpOption {
 	return func(op *Op) {
 		op.preSignDuration = d
 	}
 }
 
+// Sets the content type of the presigned request:
+// the response header for "PresignGet", and the required request header for "PresignPut".
+func WithContentType(v string) OpOption {
+	return func(op *Op) {
+		op.contentType = v
+	}
+}
+
+// Sets the content disposition of the presigned request
+// (e.g., "attachment; filename=\"node.log\"" for the browser download).
+func WithContentDisposition(v string) OpOption {
+	return func(op *Op) {
+		op.contentDisposition = v
+	}
+}
+
 func WithSkipBucketPolicy(b bool) OpOption {
 	return func(op *Op) {
 		op.skipBucketPolicy = b
 	}
 }
+
+// Sets the number of the parts to upload or download concurrently (default 5).
+func WithConcurrency(v int) OpOption {
+	return func(op *Op) {
+		op.concurrency = v
+	}
+}
+
+// Sets the part size in bytes for the multipart uploads and the ranged downloads
+// (default and minimum 5 MiB).
+func WithPartSize(v int64) OpOption {
+	return func(op *Op) {
+		op.partSize = v
+	}
+}
+
+// Sets the function to report the transferred bytes of each object.
+func WithProgressFunc(f func(Progress)) OpOption {
+	return func(op *Op) {
+		op.progressFunc = f
+	}
+}
+
+// Sets the maximum attempts for each request including the retries
+// (0 to use the client default).
+func WithRetryMaxAttempts(v int) OpOption {
+	return func(op *Op) {
+		op.retryMaxAttempts = v
+	}
+}
+
+// Encrypts the uploaded objects with the KMS key (SSE-KMS),
+// or sets the bucket default encryption with "EnsureBucket".
+// If the key ID is empty, the AWS managed key ("aws/s3") is used.
+func WithSSEKMS(keyID string) OpOption {
+	return func(op *Op) {
+		op.sseKMS = true
+		op.kmsKeyID = keyID
+	}
+}
+
+// Blocks all the public access to the bucket with "EnsureBucket".
+func WithBlockPublicAccess() OpOption {
+	return func(op *Op) {
+		op.bucketBlockPublicACLs = aws.Bool(true)
+		op.bucketBlockPublicPolicy = aws.Bool(true)
+		op.bucketIgnorePublicACLs = aws.Bool(true)
+		op.bucketRestrictPublicBuckets = aws.Bool(true)
+	}
+}
+
+// Adds the bucket policy statement to deny the requests without TLS with "EnsureBucket".
+func WithDenyInsecureTransport() OpOption {
+	return func(op *Op) {
+		op.denyInsecureTransport = true
+	}
+}
+
+// Adds the lifecycle rule with "EnsureBucket".
+func WithLifecycleRule(r LifecycleRule) OpOption {
+	return func(op *Op) {
+		op.lifecycleRules = append(op.lifecycleRules, r)
+	}
+}
+
+// Enables (or suspends) the bucket versioning with "EnsureBucket".
+func WithVersioning(b bool) OpOption {
+	return func(op *Op) {
+		op.versioning = &b
+	}
+}
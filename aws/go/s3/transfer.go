@@ -0,0 +1,382 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_s3_manager_v2 "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	aws_s3_v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	aws_s3_v2_types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/dustin/go-humanize"
+)
+
+// User metadata key of the SHA256 checksum of the whole object, set by "UploadFile"
+// and validated by "DownloadFile" (S3 only keeps the per-part checksums for the multipart uploads).
+const MetadataKeySHA256 = "sha256"
+
+// Returned when the downloaded file does not match the uploaded checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Represents the transfer progress of the object.
+type Progress struct {
+	Key         string
+	Transferred int64
+	Total       int64
+}
+
+// Uploads the file to the bucket, with the multipart upload for the file larger than the part size.
+// Each part is validated by S3 with its SHA256 checksum, and the checksum of the whole file
+// is stored in the object metadata (see "MetadataKeySHA256").
+// Use "WithSSEKMS" to encrypt with the KMS key, "WithPartSize" and "WithConcurrency" to tune
+// the multipart upload, and "WithProgressFunc" to report the uploaded bytes.
+func UploadFile(ctx context.Context, cfg aws.Config, localFilePath string, bucketName string, s3Key string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	checksum, err := fileSHA256(localFilePath)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(localFilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	logutil.S().Infow("uploading file",
+		"localFilePath", localFilePath,
+		"bucket", bucketName,
+		"s3Key", s3Key,
+		"size", humanize.Bytes(uint64(fi.Size())),
+		"sha256", checksum,
+	)
+
+	metadata := make(map[string]string, len(ret.metadata)+1)
+	for k, v := range ret.metadata {
+		metadata[k] = v
+	}
+	metadata[MetadataKeySHA256] = checksum
+
+	input := &aws_s3_v2.PutObjectInput{
+		Bucket:            aws.String(bucketName),
+		Key:               aws.String(s3Key),
+		Body:              &progressReader{f: f, tracker: newProgressTracker(s3Key, fi.Size(), ret)},
+		ChecksumAlgorithm: aws_s3_v2_types.ChecksumAlgorithmSha256,
+		Metadata:          metadata,
+	}
+	switch {
+	case ret.sseKMS:
+		input.ServerSideEncryption = aws_s3_v2_types.ServerSideEncryptionAwsKms
+		if ret.kmsKeyID != "" {
+			input.SSEKMSKeyId = aws.String(ret.kmsKeyID)
+		}
+	case ret.serverSideEncryption:
+		input.ServerSideEncryption = aws_s3_v2_types.ServerSideEncryptionAes256
+	}
+	if ret.objectACL != nil {
+		input.ACL = *ret.objectACL
+	}
+
+	uploader := aws_s3_manager_v2.NewUploader(newClient(cfg, ret), func(u *aws_s3_manager_v2.Uploader) {
+		if ret.partSize > 0 {
+			u.PartSize = ret.partSize
+		}
+		if ret.concurrency > 0 {
+			u.Concurrency = ret.concurrency
+		}
+	})
+	if _, err = uploader.Upload(ctx, input); err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully uploaded file", "localFilePath", localFilePath, "bucket", bucketName, "s3Key", s3Key)
+	return nil
+}
+
+// Downloads the object to the file with the concurrent ranged requests, and validates
+// the SHA256 checksum in the object metadata if any (e.g., uploaded by "UploadFile").
+// The file is written to the temporary file first, and renamed after the validation,
+// so the existing file is not left partially written on failure.
+func DownloadFile(ctx context.Context, cfg aws.Config, bucketName string, s3Key string, localFilePath string, opts ...OpOption) error {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cli := newClient(cfg, ret)
+	head, err := cli.HeadObject(ctx, &aws_s3_v2.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		return err
+	}
+	size := aws.ToInt64(head.ContentLength)
+	checksum := head.Metadata[MetadataKeySHA256]
+	logutil.S().Infow("downloading file",
+		"bucket", bucketName,
+		"s3Key", s3Key,
+		"localFilePath", localFilePath,
+		"size", humanize.Bytes(uint64(size)),
+		"sha256", checksum,
+	)
+
+	if err = os.MkdirAll(filepath.Dir(localFilePath), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(localFilePath), filepath.Base(localFilePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	downloader := aws_s3_manager_v2.NewDownloader(cli, func(d *aws_s3_manager_v2.Downloader) {
+		if ret.partSize > 0 {
+			d.PartSize = ret.partSize
+		}
+		if ret.concurrency > 0 {
+			d.Concurrency = ret.concurrency
+		}
+	})
+	w := &progressWriterAt{f: f, tracker: newProgressTracker(s3Key, size, ret)}
+	_, err = downloader.Download(ctx, w, &aws_s3_v2.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(s3Key),
+		// in case the object is overwritten during the ranged downloads
+		IfMatch: head.ETag,
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if checksum != "" {
+		got, err := fileSHA256(f.Name())
+		if err != nil {
+			return err
+		}
+		if got != checksum {
+			return fmt.Errorf("%w for %s/%s (expected sha256 %s, got %s)", ErrChecksumMismatch, bucketName, s3Key, checksum, got)
+		}
+	} else {
+		logutil.S().Warnw("no checksum in object metadata, skipping validation", "bucket", bucketName, "s3Key", s3Key)
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), localFilePath); err != nil {
+		return err
+	}
+
+	logutil.S().Infow("successfully downloaded file", "bucket", bucketName, "s3Key", s3Key, "localFilePath", localFilePath)
+	return nil
+}
+
+// Uploads the regular files in the directory recursively, with the relative paths
+// under the prefix (e.g., "dir/a/b.txt" to "prefix/a/b.txt"). Returns the uploaded keys.
+// See "UploadFile" for the options.
+func UploadDir(ctx context.Context, cfg aws.Config, localDir string, bucketName string, pfx string, opts ...OpOption) ([]string, error) {
+	logutil.S().Infow("uploading directory", "localDir", localDir, "bucket", bucketName, "prefix", pfx)
+
+	keys := make([]string, 0)
+	err := filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		s3Key := path.Join(pfx, filepath.ToSlash(rel))
+		if err = UploadFile(ctx, cfg, p, bucketName, s3Key, opts...); err != nil {
+			return err
+		}
+		keys = append(keys, s3Key)
+		return nil
+	})
+	if err != nil {
+		return keys, err
+	}
+
+	logutil.S().Infow("successfully uploaded directory", "localDir", localDir, "bucket", bucketName, "prefix", pfx, "files", len(keys))
+	return keys, nil
+}
+
+// Downloads the objects under the prefix to the directory, with the key paths relative
+// to the prefix (e.g., "prefix/a/b.txt" to "dir/a/b.txt"). Returns the downloaded file paths.
+// The keys escaping the directory (e.g., "prefix/../x") are rejected.
+// See "DownloadFile" for the options.
+func DownloadPrefix(ctx context.Context, cfg aws.Config, bucketName string, pfx string, localDir string, opts ...OpOption) ([]string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	logutil.S().Infow("downloading prefix", "bucket", bucketName, "prefix", pfx, "localDir", localDir)
+
+	pg := aws_s3_v2.NewListObjectsV2Paginator(newClient(cfg, ret), &aws_s3_v2.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(pfx),
+	})
+	files := make([]string, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return files, err
+		}
+		for _, obj := range out.Contents {
+			s3Key := aws.ToString(obj.Key)
+			if strings.HasSuffix(s3Key, "/") { // directory marker
+				continue
+			}
+			p, err := localPathForKey(localDir, pfx, s3Key)
+			if err != nil {
+				return files, err
+			}
+			if err = DownloadFile(ctx, cfg, bucketName, s3Key, p, opts...); err != nil {
+				return files, err
+			}
+			files = append(files, p)
+		}
+	}
+
+	logutil.S().Infow("successfully downloaded prefix", "bucket", bucketName, "prefix", pfx, "localDir", localDir, "files", len(files))
+	return files, nil
+}
+
+// Returns the local file path for the key relative to the prefix.
+func localPathForKey(localDir string, pfx string, s3Key string) (string, error) {
+	rel := strings.TrimPrefix(strings.TrimPrefix(s3Key, pfx), "/")
+	if rel == "" {
+		rel = path.Base(s3Key)
+	}
+	p := filepath.Join(localDir, filepath.FromSlash(rel))
+	if p != filepath.Clean(localDir) && !strings.HasPrefix(p, filepath.Clean(localDir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("key %q escapes the directory %q", s3Key, localDir)
+	}
+	return p, nil
+}
+
+func newClient(cfg aws.Config, ret *Op) *aws_s3_v2.Client {
+	return aws_s3_v2.NewFromConfig(cfg, func(o *aws_s3_v2.Options) {
+		if ret.retryMaxAttempts > 0 {
+			o.RetryMaxAttempts = ret.retryMaxAttempts
+		}
+	})
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Tracks the transferred bytes of the object, counting each byte once even if the part
+// is read more than once (e.g., for the request signing or the retries).
+// The parts are transferred sequentially from their start offsets.
+type progressTracker struct {
+	mu       sync.Mutex
+	key      string
+	total    int64
+	partSize int64
+	done     int64
+	ends     map[int64]int64
+	fn       func(Progress)
+}
+
+func newProgressTracker(key string, total int64, ret *Op) *progressTracker {
+	partSize := ret.partSize
+	if partSize <= 0 {
+		partSize = aws_s3_manager_v2.DefaultUploadPartSize
+	}
+	return &progressTracker{
+		key:      key,
+		total:    total,
+		partSize: partSize,
+		ends:     make(map[int64]int64),
+		fn:       ret.progressFunc,
+	}
+}
+
+func (t *progressTracker) add(off int64, n int) {
+	if t.fn == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	part := off / t.partSize
+	end := off + int64(n)
+	start := max(off, t.ends[part])
+	if end <= start {
+		return
+	}
+	t.ends[part] = end
+	t.done += end - start
+	t.fn(Progress{Key: t.key, Transferred: t.done, Total: t.total})
+}
+
+// Wraps the file for the uploader, which reads the parts via "ReadAt"
+// (or via "Read" for the single part upload).
+type progressReader struct {
+	f       *os.File
+	off     int64
+	tracker *progressTracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	r.tracker.add(r.off, n)
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *progressReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.f.ReadAt(p, off)
+	r.tracker.add(off, n)
+	return n, err
+}
+
+func (r *progressReader) Seek(offset int64, whence int) (int64, error) {
+	off, err := r.f.Seek(offset, whence)
+	if err == nil {
+		r.off = off
+	}
+	return off, err
+}
+
+type progressWriterAt struct {
+	f       *os.File
+	tracker *progressTracker
+}
+
+func (w *progressWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.f.WriteAt(p, off)
+	w.tracker.add(off, n)
+	return n, err
+}
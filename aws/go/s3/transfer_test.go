@@ -0,0 +1,284 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	credentials_v2 "github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+type fakeObject struct {
+	data     []byte
+	metadata map[string]string
+	sse      string
+}
+
+// Implements the subset of the S3 API used by the uploader and downloader, path-style.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]*fakeObject
+	uploads map[string]map[int][]byte
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, aws.Config) {
+	fs := &fakeS3{objects: make(map[string]*fakeObject), uploads: make(map[string]map[int][]byte)}
+	srv := httptest.NewServer(fs)
+	t.Cleanup(srv.Close)
+	return fs, aws.Config{
+		Region:       "us-west-2",
+		Credentials:  credentials_v2.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		BaseEndpoint: aws.String(srv.URL),
+	}
+}
+
+func (fs *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	q := req.URL.Query()
+	body, _ := io.ReadAll(req.Body)
+	if strings.Contains(req.Header.Get("Content-Encoding"), "aws-chunked") {
+		body = decodeAWSChunked(body)
+	}
+
+	switch {
+	case req.Method == http.MethodGet && key == "" && q.Get("list-type") == "2":
+		type content struct {
+			Key  string
+			Size int64
+		}
+		out := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Name     string
+			Prefix   string
+			KeyCount int
+			Contents []content
+		}{Name: bucket, Prefix: q.Get("prefix")}
+		keys := make([]string, 0)
+		for k := range fs.objects {
+			if strings.HasPrefix(k, bucket+"/"+q.Get("prefix")) {
+				keys = append(keys, strings.TrimPrefix(k, bucket+"/"))
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			out.Contents = append(out.Contents, content{Key: k, Size: int64(len(fs.objects[bucket+"/"+k].data))})
+		}
+		out.KeyCount = len(out.Contents)
+		xml.NewEncoder(w).Encode(out)
+
+	case req.Method == http.MethodPost && q.Has("uploads"):
+		id := strconv.Itoa(len(fs.uploads) + 1)
+		fs.uploads[id] = make(map[int][]byte)
+		fs.objects["pending/"+id] = &fakeObject{metadata: metadataFromHeader(req.Header), sse: req.Header.Get("x-amz-server-side-encryption")}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", bucket, key, id)
+
+	case req.Method == http.MethodPut && q.Has("uploadId"):
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		fs.uploads[q.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, n))
+
+	case req.Method == http.MethodPost && q.Has("uploadId"):
+		id := q.Get("uploadId")
+		parts := fs.uploads[id]
+		obj := fs.objects["pending/"+id]
+		for i := 1; i <= len(parts); i++ {
+			obj.data = append(obj.data, parts[i]...)
+		}
+		delete(fs.objects, "pending/"+id)
+		fs.objects[bucket+"/"+key] = obj
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>\"etag\"</ETag></CompleteMultipartUploadResult>", bucket, key)
+
+	case req.Method == http.MethodPut:
+		fs.objects[bucket+"/"+key] = &fakeObject{data: body, metadata: metadataFromHeader(req.Header), sse: req.Header.Get("x-amz-server-side-encryption")}
+		w.Header().Set("ETag", `"etag"`)
+
+	case req.Method == http.MethodHead || req.Method == http.MethodGet:
+		obj, ok := fs.objects[bucket+"/"+key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range obj.metadata {
+			w.Header().Set("x-amz-meta-"+k, v)
+		}
+		w.Header().Set("ETag", `"etag"`)
+		data := obj.data
+		if rg := req.Header.Get("Range"); rg != "" {
+			var start, end int
+			fmt.Sscanf(rg, "bytes=%d-%d", &start, &end)
+			end = min(end, len(data)-1)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+			data = data[start : end+1]
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		}
+		if req.Method == http.MethodGet {
+			w.Write(data)
+		}
+
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func metadataFromHeader(h http.Header) map[string]string {
+	m := make(map[string]string)
+	for k, v := range h {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-amz-meta-") {
+			m[strings.TrimPrefix(lk, "x-amz-meta-")] = v[0]
+		}
+	}
+	return m
+}
+
+// Decodes the "aws-chunked" body ("<hex size>\r\n<data>\r\n" chunks, then the trailers).
+func decodeAWSChunked(b []byte) []byte {
+	var out []byte
+	for len(b) > 0 {
+		line, rest, ok := bytes.Cut(b, []byte("\r\n"))
+		if !ok {
+			break
+		}
+		size, err := strconv.ParseInt(string(bytes.SplitN(line, []byte(";"), 2)[0]), 16, 64)
+		if err != nil || size == 0 {
+			break
+		}
+		out = append(out, rest[:size]...)
+		b = rest[size+2:]
+	}
+	return out
+}
+
+func TestUploadDownloadFile(t *testing.T) {
+	fs, cfg := newFakeS3(t)
+	dir := t.TempDir()
+
+	for _, size := range []int{1024, 11 * 1024 * 1024} {
+		src := filepath.Join(dir, "src")
+		data := make([]byte, size)
+		rand.Read(data)
+		if err := os.WriteFile(src, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var last Progress
+		err := UploadFile(context.Background(), cfg, src, "bucket", "backups/data", WithSSEKMS("alias/backup"), WithProgressFunc(func(p Progress) { last = p }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last.Transferred != int64(size) || last.Total != int64(size) || last.Key != "backups/data" {
+			t.Fatalf("unexpected upload progress %+v for size %d", last, size)
+		}
+		fs.mu.Lock()
+		sse := fs.objects["bucket/backups/data"].sse
+		fs.mu.Unlock()
+		if sse != "aws:kms" {
+			t.Fatalf("expected SSE-KMS, got %q", sse)
+		}
+
+		dst := filepath.Join(dir, "restored", "dst")
+		last = Progress{}
+		if err = DownloadFile(context.Background(), cfg, "bucket", "backups/data", dst, WithProgressFunc(func(p Progress) { last = p })); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("unexpected downloaded data for size %d", size)
+		}
+		if last.Transferred != int64(size) {
+			t.Fatalf("unexpected download progress %+v for size %d", last, size)
+		}
+	}
+}
+
+func TestDownloadFileChecksumMismatch(t *testing.T) {
+	fs, cfg := newFakeS3(t)
+	dir := t.TempDir()
+
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := UploadFile(context.Background(), cfg, src, "bucket", "key"); err != nil {
+		t.Fatal(err)
+	}
+	fs.mu.Lock()
+	fs.objects["bucket/key"].data = []byte("hellO")
+	fs.mu.Unlock()
+
+	dst := filepath.Join(dir, "dst")
+	if err := DownloadFile(context.Background(), cfg, "bucket", "key", dst); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected %v, got %v", ErrChecksumMismatch, err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected no file on checksum mismatch, got %v", err)
+	}
+}
+
+func TestUploadDirDownloadPrefix(t *testing.T) {
+	_, cfg := newFakeS3(t)
+
+	src := t.TempDir()
+	for p, data := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/deep/c.txt": "c"} {
+		fp := filepath.Join(src, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, err := UploadDir(context.Background(), cfg, src, "bucket", "node-0/2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys, ",") != "node-0/2024/a.txt,node-0/2024/sub/b.txt,node-0/2024/sub/deep/c.txt" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	dst := t.TempDir()
+	files, err := DownloadPrefix(context.Background(), cfg, "bucket", "node-0/2024", dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("unexpected files %v", files)
+	}
+	b, err := os.ReadFile(filepath.Join(dst, "sub", "deep", "c.txt"))
+	if err != nil || string(b) != "c" {
+		t.Fatalf("unexpected file %q (%v)", b, err)
+	}
+}
+
+func TestLocalPathForKey(t *testing.T) {
+	p, err := localPathForKey("/data", "backups/", "backups/a/b.txt")
+	if err != nil || p != filepath.Join("/data", "a", "b.txt") {
+		t.Fatalf("unexpected path %q (%v)", p, err)
+	}
+	if _, err = localPathForKey("/data", "backups/", "backups/../../etc/passwd"); err == nil {
+		t.Fatal("expected error for the key escaping the directory")
+	}
+}
@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// Caches the secret values for the TTL, to not call the API for every read
+// (e.g., the same secret referenced from multiple templates).
+// On the refresh failure, the expired value is returned (and the error logged),
+// so the transient API errors do not fail the readers.
+type Cache struct {
+	cfg aws.Config
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+}
+
+type cacheKey struct {
+	secretID     string
+	versionID    string
+	versionStage string
+}
+
+type cacheEntry struct {
+	secret  Secret
+	fetched time.Time
+}
+
+// Creates the secret cache with the TTL (0 to fetch on every read, and only serve on failure).
+func NewCache(cfg aws.Config, ttl time.Duration) *Cache {
+	return &Cache{
+		cfg:     cfg,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[cacheKey]cacheEntry),
+	}
+}
+
+// Returns the cached secret value, or fetches it if expired.
+func (c *Cache) Get(ctx context.Context, secretID string, opts ...OpOption) (Secret, error) {
+	return c.get(ctx, secretID, func(ctx context.Context) (Secret, error) {
+		return GetSecretValue(ctx, c.cfg, secretID, opts...)
+	}, opts...)
+}
+
+func (c *Cache) get(ctx context.Context, secretID string, fetch func(context.Context) (Secret, error), opts ...OpOption) (Secret, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+	k := cacheKey{secretID: secretID, versionID: ret.versionID, versionStage: ret.versionStage}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ent, ok := c.entries[k]
+	if ok && c.now().Sub(ent.fetched) < c.ttl {
+		return ent.secret, nil
+	}
+
+	s, err := fetch(ctx)
+	if err != nil {
+		if ok {
+			logutil.S().Warnw("failed to refresh secret -- serving cached value", "secretID", secretID, "fetched", ent.fetched, "error", err)
+			return ent.secret, nil
+		}
+		return Secret{}, err
+	}
+	c.entries[k] = cacheEntry{secret: s, fetched: c.now()}
+	return s, nil
+}
+
+// Drops the cached values of the secret, to fetch on the next read.
+func (c *Cache) Invalidate(secretID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if k.secretID == secretID {
+			delete(c.entries, k)
+		}
+	}
+}
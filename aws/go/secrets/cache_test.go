@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := NewCache(aws.Config{}, time.Minute)
+	c.now = func() time.Time { return now }
+
+	calls := 0
+	var fetchErr error
+	fetch := func(context.Context) (Secret, error) {
+		calls++
+		if fetchErr != nil {
+			return Secret{}, fetchErr
+		}
+		return Secret{Name: "db", String: "v" + string(rune('0'+calls))}, nil
+	}
+
+	s, err := c.get(context.Background(), "db", fetch)
+	if err != nil || s.String != "v1" {
+		t.Fatalf("unexpected secret %+v (%v)", s, err)
+	}
+	if s, _ = c.get(context.Background(), "db", fetch); s.String != "v1" || calls != 1 {
+		t.Fatalf("expected cached secret, got %+v (calls %d)", s, calls)
+	}
+
+	// different stages are cached separately
+	if s, _ = c.get(context.Background(), "db", fetch, WithVersionStage(VersionStagePrevious)); s.String != "v2" {
+		t.Fatalf("unexpected secret %+v", s)
+	}
+
+	// expired, and failed refresh serves the cached value
+	now = now.Add(2 * time.Minute)
+	fetchErr = errors.New("throttled")
+	if s, err = c.get(context.Background(), "db", fetch); err != nil || s.String != "v1" {
+		t.Fatalf("expected stale secret, got %+v (%v)", s, err)
+	}
+
+	c.Invalidate("db")
+	if _, err = c.get(context.Background(), "db", fetch); !errors.Is(err, fetchErr) {
+		t.Fatalf("expected error after invalidate, got %v", err)
+	}
+}
+
+func TestSecretJSONValue(t *testing.T) {
+	s := Secret{Name: "db", String: `{"username":"admin","port":5432}`}
+	if v, err := s.JSONValue("username"); err != nil || v != "admin" {
+		t.Fatalf("unexpected value %q (%v)", v, err)
+	}
+	if v, err := s.JSONValue("port"); err != nil || v != "5432" {
+		t.Fatalf("unexpected value %q (%v)", v, err)
+	}
+	if _, err := s.JSONValue("password"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	b := Secret{Binary: []byte{0, 1}}
+	if got := b.Bytes(); len(got) != 2 {
+		t.Fatalf("unexpected bytes %x", got)
+	}
+}
@@ -0,0 +1,128 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_secretsmanager_v2 "github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Secret version stages.
+// ref. https://docs.aws.amazon.com/secretsmanager/latest/userguide/whats-in-a-secret.html#term_version
+const (
+	VersionStageCurrent  = "AWSCURRENT"
+	VersionStagePrevious = "AWSPREVIOUS"
+	VersionStagePending  = "AWSPENDING"
+)
+
+type Op struct {
+	versionID    string
+	versionStage string
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Sets the version ID of the secret to fetch.
+func WithVersionID(v string) OpOption {
+	return func(op *Op) {
+		op.versionID = v
+	}
+}
+
+// Sets the version stage of the secret to fetch (e.g., "AWSPREVIOUS").
+// If empty, the "AWSCURRENT" version is fetched.
+func WithVersionStage(v string) OpOption {
+	return func(op *Op) {
+		op.versionStage = v
+	}
+}
+
+// Represents the secret value of a version.
+// Only one of "String" and "Binary" is set.
+type Secret struct {
+	Name          string    `json:"name"`
+	ARN           string    `json:"arn"`
+	VersionID     string    `json:"version_id"`
+	VersionStages []string  `json:"version_stages"`
+	Created       time.Time `json:"created"`
+
+	String string `json:"-"`
+	Binary []byte `json:"-"`
+}
+
+// Returns the secret value in bytes, either the string or the binary.
+func (s Secret) Bytes() []byte {
+	if s.Binary != nil {
+		return s.Binary
+	}
+	return []byte(s.String)
+}
+
+// Returned when the JSON secret does not have the key.
+var ErrKeyNotFound = errors.New("key not found in secret")
+
+// Returns the value of the key in the JSON secret string (e.g., {"username":"a","password":"b"}).
+// The non-string values are returned in JSON.
+func (s Secret) JSONValue(key string) (string, error) {
+	m := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(s.Bytes(), &m); err != nil {
+		return "", fmt.Errorf("failed to parse secret %q as JSON (%w)", s.Name, err)
+	}
+	raw, ok := m[key]
+	if !ok {
+		return "", fmt.Errorf("%w %q (%q)", ErrKeyNotFound, s.Name, key)
+	}
+	var v string
+	if err := json.Unmarshal(raw, &v); err == nil {
+		return v, nil
+	}
+	return string(raw), nil
+}
+
+// Fetches the secret value by its name or ARN.
+// Use "WithVersionStage" or "WithVersionID" to fetch the other version
+// (e.g., "AWSPENDING" during the rotation).
+func GetSecretValue(ctx context.Context, cfg aws.Config, secretID string, opts ...OpOption) (Secret, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	input := &aws_secretsmanager_v2.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	}
+	if ret.versionID != "" {
+		input.VersionId = aws.String(ret.versionID)
+	}
+	if ret.versionStage != "" {
+		input.VersionStage = aws.String(ret.versionStage)
+	}
+
+	cli := aws_secretsmanager_v2.NewFromConfig(cfg)
+	out, err := cli.GetSecretValue(ctx, input)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	s := Secret{
+		Name:          aws.ToString(out.Name),
+		ARN:           aws.ToString(out.ARN),
+		VersionID:     aws.ToString(out.VersionId),
+		VersionStages: out.VersionStages,
+		Created:       aws.ToTime(out.CreatedDate),
+		String:        aws.ToString(out.SecretString),
+		Binary:        out.SecretBinary,
+	}
+	logutil.S().Infow("fetched secret", "secretID", secretID, "versionID", s.VersionID, "versionStages", s.VersionStages)
+	return s, nil
+}
@@ -0,0 +1,101 @@
+// Package sns implements SNS utils.
+package sns
+
+import (
+	"context"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_sns_v2 "github.com/aws/aws-sdk-go-v2/service/sns"
+	aws_sns_v2_types "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+type Op struct {
+	attributes      map[string]string
+	subject         string
+	messageGroupID  string
+	deduplicationID string
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Sets the string message attributes (e.g., for the subscription filter policies).
+func WithAttributes(m map[string]string) OpOption {
+	return func(op *Op) {
+		op.attributes = m
+	}
+}
+
+// Sets the subject for the email subscriptions.
+func WithSubject(s string) OpOption {
+	return func(op *Op) {
+		op.subject = s
+	}
+}
+
+// Sets the message group ID (required for the FIFO topics).
+func WithMessageGroupID(id string) OpOption {
+	return func(op *Op) {
+		op.messageGroupID = id
+	}
+}
+
+// Sets the message deduplication ID for the FIFO topics
+// (required unless the content-based deduplication is enabled).
+func WithDeduplicationID(id string) OpOption {
+	return func(op *Op) {
+		op.deduplicationID = id
+	}
+}
+
+// Publishes the message to the topic, and returns the message ID.
+// ref. https://docs.aws.amazon.com/sns/latest/api/API_Publish.html
+func Publish(ctx context.Context, cfg aws.Config, topicARN string, message string, opts ...OpOption) (string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	input := &aws_sns_v2.PublishInput{
+		TopicArn:          aws.String(topicARN),
+		Message:           aws.String(message),
+		MessageAttributes: toMessageAttributes(ret.attributes),
+	}
+	if ret.subject != "" {
+		input.Subject = aws.String(ret.subject)
+	}
+	if ret.messageGroupID != "" {
+		input.MessageGroupId = aws.String(ret.messageGroupID)
+	}
+	if ret.deduplicationID != "" {
+		input.MessageDeduplicationId = aws.String(ret.deduplicationID)
+	}
+
+	cli := aws_sns_v2.NewFromConfig(cfg)
+	out, err := cli.Publish(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	id := aws.ToString(out.MessageId)
+	logutil.S().Infow("published message", "topicARN", topicARN, "messageID", id)
+	return id, nil
+}
+
+func toMessageAttributes(m map[string]string) map[string]aws_sns_v2_types.MessageAttributeValue {
+	if len(m) == 0 {
+		return nil
+	}
+	attrs := make(map[string]aws_sns_v2_types.MessageAttributeValue, len(m))
+	for k, v := range m {
+		attrs[k] = aws_sns_v2_types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(v),
+		}
+	}
+	return attrs
+}
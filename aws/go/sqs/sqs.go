@@ -0,0 +1,198 @@
+// Package sqs implements SQS utils.
+package sqs
+
+import (
+	"context"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_sqs_v2 "github.com/aws/aws-sdk-go-v2/service/sqs"
+	aws_sqs_v2_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+type Op struct {
+	attributes        map[string]string
+	delay             time.Duration
+	messageGroupID    string
+	deduplicationID   string
+	maxMessages       int32
+	waitTime          time.Duration
+	visibilityTimeout time.Duration
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Sets the string message attributes.
+func WithAttributes(m map[string]string) OpOption {
+	return func(op *Op) {
+		op.attributes = m
+	}
+}
+
+// Sets the delay before the sent message becomes visible (up to 15 minutes, not for the FIFO queues).
+func WithDelay(d time.Duration) OpOption {
+	return func(op *Op) {
+		op.delay = d
+	}
+}
+
+// Sets the message group ID (required for the FIFO queues).
+func WithMessageGroupID(id string) OpOption {
+	return func(op *Op) {
+		op.messageGroupID = id
+	}
+}
+
+// Sets the message deduplication ID for the FIFO queues
+// (required unless the content-based deduplication is enabled).
+func WithDeduplicationID(id string) OpOption {
+	return func(op *Op) {
+		op.deduplicationID = id
+	}
+}
+
+// Sets the maximum number of the messages to receive (1 to 10, default 10).
+func WithMaxMessages(n int32) OpOption {
+	return func(op *Op) {
+		op.maxMessages = n
+	}
+}
+
+// Sets the long polling wait time to receive (up to 20 seconds, default 20 seconds).
+func WithWaitTime(d time.Duration) OpOption {
+	return func(op *Op) {
+		op.waitTime = d
+	}
+}
+
+// Sets the visibility timeout of the received messages (default to the queue's).
+func WithVisibilityTimeout(d time.Duration) OpOption {
+	return func(op *Op) {
+		op.visibilityTimeout = d
+	}
+}
+
+// Represents the received message.
+type Message struct {
+	ID            string
+	ReceiptHandle string
+	Body          string
+	Attributes    map[string]string
+}
+
+// Returns the queue URL of the queue name.
+func GetQueueURL(ctx context.Context, cfg aws.Config, name string) (string, error) {
+	cli := aws_sqs_v2.NewFromConfig(cfg)
+	out, err := cli.GetQueueUrl(ctx, &aws_sqs_v2.GetQueueUrlInput{QueueName: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.QueueUrl), nil
+}
+
+// Sends the message to the queue, and returns the message ID.
+// ref. https://docs.aws.amazon.com/AWSSimpleQueueService/latest/APIReference/API_SendMessage.html
+func Send(ctx context.Context, cfg aws.Config, queueURL string, body string, opts ...OpOption) (string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	input := &aws_sqs_v2.SendMessageInput{
+		QueueUrl:          aws.String(queueURL),
+		MessageBody:       aws.String(body),
+		MessageAttributes: toMessageAttributes(ret.attributes),
+	}
+	if ret.delay > 0 {
+		input.DelaySeconds = int32(ret.delay / time.Second)
+	}
+	if ret.messageGroupID != "" {
+		input.MessageGroupId = aws.String(ret.messageGroupID)
+	}
+	if ret.deduplicationID != "" {
+		input.MessageDeduplicationId = aws.String(ret.deduplicationID)
+	}
+
+	cli := aws_sqs_v2.NewFromConfig(cfg)
+	out, err := cli.SendMessage(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	id := aws.ToString(out.MessageId)
+	logutil.S().Infow("sent message", "queueURL", queueURL, "messageID", id)
+	return id, nil
+}
+
+// Receives the messages from the queue with the long polling (default 20 seconds).
+// Returns the empty list if no message is available in the wait time.
+// The received messages must be deleted with "Delete" once processed,
+// otherwise, they are received again after the visibility timeout.
+// ref. https://docs.aws.amazon.com/AWSSimpleQueueService/latest/APIReference/API_ReceiveMessage.html
+func Receive(ctx context.Context, cfg aws.Config, queueURL string, opts ...OpOption) ([]Message, error) {
+	ret := &Op{maxMessages: 10, waitTime: 20 * time.Second}
+	ret.applyOpts(opts)
+
+	input := &aws_sqs_v2.ReceiveMessageInput{
+		QueueUrl:              aws.String(queueURL),
+		MaxNumberOfMessages:   ret.maxMessages,
+		WaitTimeSeconds:       int32(ret.waitTime / time.Second),
+		MessageAttributeNames: []string{"All"},
+	}
+	if ret.visibilityTimeout > 0 {
+		input.VisibilityTimeout = int32(ret.visibilityTimeout / time.Second)
+	}
+
+	cli := aws_sqs_v2.NewFromConfig(cfg)
+	out, err := cli.ReceiveMessage(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make([]Message, 0, len(out.Messages))
+	for _, m := range out.Messages {
+		msg := Message{
+			ID:            aws.ToString(m.MessageId),
+			ReceiptHandle: aws.ToString(m.ReceiptHandle),
+			Body:          aws.ToString(m.Body),
+		}
+		if len(m.MessageAttributes) > 0 {
+			msg.Attributes = make(map[string]string, len(m.MessageAttributes))
+			for k, v := range m.MessageAttributes {
+				msg.Attributes[k] = aws.ToString(v.StringValue)
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	logutil.S().Debugw("received messages", "queueURL", queueURL, "messages", len(msgs))
+	return msgs, nil
+}
+
+// Deletes the received message from the queue.
+func Delete(ctx context.Context, cfg aws.Config, queueURL string, receiptHandle string) error {
+	cli := aws_sqs_v2.NewFromConfig(cfg)
+	_, err := cli.DeleteMessage(ctx, &aws_sqs_v2.DeleteMessageInput{
+		QueueUrl:      aws.String(queueURL),
+		ReceiptHandle: aws.String(receiptHandle),
+	})
+	return err
+}
+
+func toMessageAttributes(m map[string]string) map[string]aws_sqs_v2_types.MessageAttributeValue {
+	if len(m) == 0 {
+		return nil
+	}
+	attrs := make(map[string]aws_sqs_v2_types.MessageAttributeValue, len(m))
+	for k, v := range m {
+		attrs[k] = aws_sqs_v2_types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(v),
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,17 @@
+package sqs
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestToMessageAttributes(t *testing.T) {
+	if attrs := toMessageAttributes(nil); attrs != nil {
+		t.Fatalf("unexpected attributes %v", attrs)
+	}
+	attrs := toMessageAttributes(map[string]string{"type": "eip-associated"})
+	if len(attrs) != 1 || aws.ToString(attrs["type"].DataType) != "String" || aws.ToString(attrs["type"].StringValue) != "eip-associated" {
+		t.Fatalf("unexpected attributes %v", attrs)
+	}
+}
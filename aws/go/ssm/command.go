@@ -0,0 +1,265 @@
+package ssm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gyuho/infra/aws/go/ec2"
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ssm_v2 "github.com/aws/aws-sdk-go-v2/service/ssm"
+	aws_ssm_v2_types "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Instance tag key set by the Auto Scaling Group, to target all the instances in the ASG.
+const TagKeyASGName = "aws:autoscaling:groupName"
+
+const defaultCommandInterval = 5 * time.Second
+
+// Represents the command invocation on an instance, with its outputs.
+type Invocation struct {
+	CommandID    string `json:"command_id"`
+	InstanceID   string `json:"instance_id"`
+	Status       string `json:"status"`
+	StatusDetail string `json:"status_detail,omitempty"`
+	ResponseCode int32  `json:"response_code"`
+
+	// Inline outputs truncated to 24,000 characters.
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+
+	// Full outputs in S3 with "WithOutputS3".
+	StdoutURL string `json:"stdout_url,omitempty"`
+	StderrURL string `json:"stderr_url,omitempty"`
+}
+
+// Returned when the command did not succeed on any instance.
+var ErrCommandFailed = errors.New("command failed")
+
+// Sends the shell commands with "AWS-RunShellScript" to the instances selected by
+// "WithInstanceIDs" or "WithTargetTag" (e.g., all the instances in the ASG),
+// and returns the command ID. Use "WithMaxConcurrency" and "WithMaxErrors"
+// to roll the command through the fleet (e.g., restart the service one node at a time).
+// ref. https://docs.aws.amazon.com/systems-manager/latest/APIReference/API_SendCommand.html
+func SendCommand(ctx context.Context, cfg aws.Config, cmds []string, opts ...OpOption) (string, error) {
+	ret := &Op{executionTimeout: time.Hour}
+	ret.applyOpts(opts)
+
+	input, err := buildSendCommandInput(cmds, ret)
+	if err != nil {
+		return "", err
+	}
+
+	logutil.S().Infow("sending command", "instanceIDs", ret.instanceIDs, "targetTags", ret.targetTags, "comment", ret.comment, "maxConcurrency", ret.maxConcurrency)
+	cli := aws_ssm_v2.NewFromConfig(cfg)
+	out, err := cli.SendCommand(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	if out.Command == nil {
+		return "", errors.New("command nil")
+	}
+
+	cmdID := aws.ToString(out.Command.CommandId)
+	logutil.S().Infow("command sent", "cmdID", cmdID, "targets", out.Command.TargetCount)
+	return cmdID, nil
+}
+
+func buildSendCommandInput(cmds []string, ret *Op) (*aws_ssm_v2.SendCommandInput, error) {
+	if len(cmds) == 0 {
+		return nil, errors.New("no command")
+	}
+	if len(ret.instanceIDs) == 0 && len(ret.targetTags) == 0 {
+		return nil, errors.New("no instance ID or target tag")
+	}
+	if len(ret.instanceIDs) > 0 && len(ret.targetTags) > 0 {
+		return nil, errors.New("cannot target both instance IDs and tags")
+	}
+
+	input := &aws_ssm_v2.SendCommandInput{
+		DocumentName: &docName,
+		Parameters: map[string][]string{
+			"commands":         cmds,
+			"executionTimeout": {strconv.Itoa(int(ret.executionTimeout.Seconds()))},
+		},
+		InstanceIds: ret.instanceIDs,
+	}
+
+	keys := make([]string, 0, len(ret.targetTags))
+	for k := range ret.targetTags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		input.Targets = append(input.Targets, aws_ssm_v2_types.Target{
+			Key:    aws.String("tag:" + k),
+			Values: ret.targetTags[k],
+		})
+	}
+
+	if ret.comment != "" {
+		// up to 100 characters
+		c := ret.comment
+		if len(c) > 100 {
+			c = c[:100]
+		}
+		input.Comment = aws.String(c)
+	}
+	if ret.maxConcurrency != "" {
+		input.MaxConcurrency = aws.String(ret.maxConcurrency)
+	}
+	if ret.maxErrors != "" {
+		input.MaxErrors = aws.String(ret.maxErrors)
+	}
+	if ret.outputS3Bucket != "" {
+		input.OutputS3BucketName = aws.String(ret.outputS3Bucket)
+		if ret.outputS3Prefix != "" {
+			input.OutputS3KeyPrefix = aws.String(ret.outputS3Prefix)
+		}
+	}
+	return input, nil
+}
+
+// Waits for the command invocation on the instance to finish, and returns its outputs.
+// Returns "ErrCommandFailed" with the invocation if it did not succeed.
+// Use "WithInterval" for the poll interval (default 5 seconds).
+func WaitForCommandInvocation(ctx context.Context, cfg aws.Config, cmdID string, instanceID string, opts ...OpOption) (Invocation, error) {
+	ret := &Op{interval: defaultCommandInterval}
+	ret.applyOpts(opts)
+
+	var inv Invocation
+	err := ec2.WaitUntil(ctx, fmt.Sprintf("command %s on %s", cmdID, instanceID), func(ctx context.Context) (bool, string, error) {
+		var err error
+		inv, err = GetCommandInvocation(ctx, cfg, cmdID, instanceID)
+		if err != nil {
+			var nf *aws_ssm_v2_types.InvocationDoesNotExist
+			if errors.As(err, &nf) {
+				// not yet delivered right after "SendCommand"
+				return false, "invocation not found yet", nil
+			}
+			return false, "", err
+		}
+		return isInvocationDone(inv.Status), inv.Status, nil
+	}, ec2.WithInterval(ret.interval))
+	if err != nil {
+		return inv, err
+	}
+	if inv.Status != string(aws_ssm_v2_types.CommandInvocationStatusSuccess) {
+		return inv, fmt.Errorf("%w on %s (status %q, response code %d)", ErrCommandFailed, instanceID, inv.Status, inv.ResponseCode)
+	}
+	return inv, nil
+}
+
+// Waits for the command to finish on all the target instances (e.g., selected by the tags),
+// and returns the invocations sorted by the instance ID.
+// Returns "ErrCommandFailed" with the invocations if any did not succeed.
+// Use "WithInterval" for the poll interval (default 5 seconds).
+func WaitForCommand(ctx context.Context, cfg aws.Config, cmdID string, opts ...OpOption) ([]Invocation, error) {
+	ret := &Op{interval: defaultCommandInterval}
+	ret.applyOpts(opts)
+
+	cli := aws_ssm_v2.NewFromConfig(cfg)
+	err := ec2.WaitUntil(ctx, fmt.Sprintf("command %s", cmdID), func(ctx context.Context) (bool, string, error) {
+		out, err := cli.ListCommands(ctx, &aws_ssm_v2.ListCommandsInput{
+			CommandId: aws.String(cmdID),
+		})
+		if err != nil {
+			return false, "", err
+		}
+		if len(out.Commands) == 0 {
+			return false, "command not found yet", nil
+		}
+		c := out.Commands[0]
+		status := fmt.Sprintf("%s (%d/%d completed, %d errors)", c.Status, c.CompletedCount, c.TargetCount, c.ErrorCount)
+		return isCommandDone(c.Status), status, nil
+	}, ec2.WithInterval(ret.interval))
+	if err != nil {
+		return nil, err
+	}
+
+	instanceIDs := make([]string, 0)
+	pg := aws_ssm_v2.NewListCommandInvocationsPaginator(cli, &aws_ssm_v2.ListCommandInvocationsInput{
+		CommandId: aws.String(cmdID),
+	})
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, inv := range out.CommandInvocations {
+			instanceIDs = append(instanceIDs, aws.ToString(inv.InstanceId))
+		}
+	}
+	sort.Strings(instanceIDs)
+
+	invs := make([]Invocation, 0, len(instanceIDs))
+	failed := make([]string, 0)
+	for _, id := range instanceIDs {
+		inv, err := GetCommandInvocation(ctx, cfg, cmdID, id)
+		if err != nil {
+			return nil, err
+		}
+		if inv.Status != string(aws_ssm_v2_types.CommandInvocationStatusSuccess) {
+			failed = append(failed, id)
+		}
+		invs = append(invs, inv)
+	}
+
+	logutil.S().Infow("command finished", "cmdID", cmdID, "invocations", len(invs), "failed", failed)
+	if len(failed) > 0 {
+		return invs, fmt.Errorf("%w on %d of %d instances %v", ErrCommandFailed, len(failed), len(invs), failed)
+	}
+	return invs, nil
+}
+
+// Fetches the command invocation on the instance.
+func GetCommandInvocation(ctx context.Context, cfg aws.Config, cmdID string, instanceID string) (Invocation, error) {
+	cli := aws_ssm_v2.NewFromConfig(cfg)
+	out, err := cli.GetCommandInvocation(ctx, &aws_ssm_v2.GetCommandInvocationInput{
+		CommandId:  aws.String(cmdID),
+		InstanceId: aws.String(instanceID),
+	})
+	if err != nil {
+		return Invocation{}, err
+	}
+	return Invocation{
+		CommandID:    cmdID,
+		InstanceID:   instanceID,
+		Status:       string(out.Status),
+		StatusDetail: aws.ToString(out.StatusDetails),
+		ResponseCode: out.ResponseCode,
+		Stdout:       aws.ToString(out.StandardOutputContent),
+		Stderr:       aws.ToString(out.StandardErrorContent),
+		StdoutURL:    aws.ToString(out.StandardOutputUrl),
+		StderrURL:    aws.ToString(out.StandardErrorUrl),
+	}, nil
+}
+
+func isInvocationDone(status string) bool {
+	switch aws_ssm_v2_types.CommandInvocationStatus(status) {
+	case aws_ssm_v2_types.CommandInvocationStatusSuccess,
+		aws_ssm_v2_types.CommandInvocationStatusCancelled,
+		aws_ssm_v2_types.CommandInvocationStatusTimedOut,
+		aws_ssm_v2_types.CommandInvocationStatusFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+func isCommandDone(status aws_ssm_v2_types.CommandStatus) bool {
+	switch status {
+	case aws_ssm_v2_types.CommandStatusSuccess,
+		aws_ssm_v2_types.CommandStatusCancelled,
+		aws_ssm_v2_types.CommandStatusFailed,
+		aws_ssm_v2_types.CommandStatusTimedOut:
+		return true
+	default:
+		return false
+	}
+}
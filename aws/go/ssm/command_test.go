@@ -0,0 +1,37 @@
+package ssm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestBuildSendCommandInput(t *testing.T) {
+	ret := &Op{executionTimeout: time.Hour}
+	ret.applyOpts([]OpOption{
+		WithTargetTag(TagKeyASGName, "my-asg"),
+		WithTargetTag("Role", "a", "b"),
+		WithMaxConcurrency("1"),
+		WithMaxErrors("0"),
+		WithOutputS3("logs", "ssm/"),
+		WithExecutionTimeout(10 * time.Minute),
+	})
+	input, err := buildSendCommandInput([]string{"systemctl restart my-app"}, ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(input.Targets) != 2 || aws.ToString(input.Targets[0].Key) != "tag:Role" || aws.ToString(input.Targets[1].Key) != "tag:aws:autoscaling:groupName" {
+		t.Fatalf("unexpected targets %+v", input.Targets)
+	}
+	if input.Parameters["executionTimeout"][0] != "600" || aws.ToString(input.MaxConcurrency) != "1" || aws.ToString(input.OutputS3BucketName) != "logs" {
+		t.Fatalf("unexpected input %+v", input)
+	}
+
+	if _, err = buildSendCommandInput([]string{"ls"}, &Op{}); err == nil {
+		t.Fatal("expected error without targets")
+	}
+	if _, err = buildSendCommandInput([]string{"ls"}, &Op{instanceIDs: []string{"i-1"}, targetTags: map[string][]string{"a": {"b"}}}); err == nil {
+		t.Fatal("expected error with both instance IDs and tags")
+	}
+}
@@ -0,0 +1,115 @@
+package ssm
+
+import (
+	"context"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ssm_v2 "github.com/aws/aws-sdk-go-v2/service/ssm"
+	aws_ssm_v2_types "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Represents the parameter in the Parameter Store, with the decrypted value.
+type Parameter struct {
+	Name         string    `json:"name"`
+	Type         string    `json:"type"`
+	Value        string    `json:"-"`
+	Version      int64     `json:"version"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Writes a string parameter to the Parameter Store, overwriting the existing value.
+// Use "WithSecureString" to encrypt the value with the KMS key.
+// Returns the new version of the parameter.
+// ref. https://docs.aws.amazon.com/systems-manager/latest/APIReference/API_PutParameter.html
+func PutParameter(ctx context.Context, cfg aws.Config, name string, value string, opts ...OpOption) (int64, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	input := &aws_ssm_v2.PutParameterInput{
+		Name:      &name,
+		Value:     &value,
+		Type:      aws_ssm_v2_types.ParameterTypeString,
+		Overwrite: aws.Bool(true),
+	}
+	if ret.secure {
+		input.Type = aws_ssm_v2_types.ParameterTypeSecureString
+		if ret.kmsKeyID != "" {
+			input.KeyId = aws.String(ret.kmsKeyID)
+		}
+	}
+	if ret.description != "" {
+		input.Description = aws.String(ret.description)
+	}
+
+	logutil.S().Infow("putting parameter", "name", name, "type", input.Type)
+	cli := aws_ssm_v2.NewFromConfig(cfg)
+	out, err := cli.PutParameter(ctx, input)
+	if err != nil {
+		return 0, err
+	}
+
+	logutil.S().Infow("put parameter", "name", name, "version", out.Version)
+	return out.Version, nil
+}
+
+// Lists the parameters under the path (e.g., "/my-app/prod"), with the "SecureString" values decrypted.
+// Use "WithRecursive" to only list the parameters directly under the path.
+// ref. https://docs.aws.amazon.com/systems-manager/latest/APIReference/API_GetParametersByPath.html
+func GetParametersByPath(ctx context.Context, cfg aws.Config, path string, opts ...OpOption) ([]Parameter, error) {
+	ret := &Op{recursive: true}
+	ret.applyOpts(opts)
+
+	cli := aws_ssm_v2.NewFromConfig(cfg)
+	pg := aws_ssm_v2.NewGetParametersByPathPaginator(cli, &aws_ssm_v2.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(ret.recursive),
+		WithDecryption: aws.Bool(true),
+	})
+	params := make([]Parameter, 0)
+	for pg.HasMorePages() {
+		out, err := pg.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range out.Parameters {
+			params = append(params, Parameter{
+				Name:         aws.ToString(p.Name),
+				Type:         string(p.Type),
+				Value:        aws.ToString(p.Value),
+				Version:      p.Version,
+				LastModified: aws.ToTime(p.LastModifiedDate),
+			})
+		}
+	}
+
+	logutil.S().Infow("listed parameters", "path", path, "recursive", ret.recursive, "parameters", len(params))
+	return params, nil
+}
+
+// Deletes the parameters, 10 at a time.
+// The parameters that do not exist are ignored.
+func DeleteParameters(ctx context.Context, cfg aws.Config, names []string) error {
+	logutil.S().Infow("deleting parameters", "names", names)
+	cli := aws_ssm_v2.NewFromConfig(cfg)
+
+	// ref. https://docs.aws.amazon.com/systems-manager/latest/APIReference/API_DeleteParameters.html
+	for ns := names; len(ns) > 0; {
+		n := min(len(ns), 10)
+		out, err := cli.DeleteParameters(ctx, &aws_ssm_v2.DeleteParametersInput{
+			Names: ns[:n],
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.InvalidParameters) > 0 {
+			logutil.S().Warnw("skipped deleting non-existent parameters", "names", out.InvalidParameters)
+		}
+		ns = ns[n:]
+	}
+
+	logutil.S().Infow("deleted parameters", "parameters", len(names))
+	return nil
+}
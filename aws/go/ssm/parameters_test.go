@@ -0,0 +1,34 @@
+package ssm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	aws "github.com/gyuho/infra/aws/go"
+	"github.com/gyuho/infra/go/randutil"
+)
+
+func TestPutParameter(t *testing.T) {
+	if os.Getenv("RUN_AWS_TESTS") != "1" {
+		t.Skip()
+	}
+
+	cfg, err := aws.New(&aws.Config{
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := "/test/" + randutil.StringAlphabetsLowerCase(10)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	version, err := PutParameter(ctx, cfg, name, `{"public_ip":"1.2.3.4"}`)
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("version:", version)
+}
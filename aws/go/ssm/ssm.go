@@ -4,6 +4,7 @@ package ssm
 import (
 	"context"
 	"errors"
+	"os"
 	"time"
 
 	"github.com/gyuho/infra/go/logutil"
@@ -15,6 +16,137 @@ import (
 
 var docName string = "AWS-RunShellScript"
 
+type Op struct {
+	delete      bool
+	description string
+	fileMode    os.FileMode
+	kmsKeyID    string
+	recursive   bool
+	secure      bool
+
+	// for "SendCommand"
+	comment          string
+	executionTimeout time.Duration
+	instanceIDs      []string
+	interval         time.Duration
+	maxConcurrency   string
+	maxErrors        string
+	outputS3Bucket   string
+	outputS3Prefix   string
+	targetTags       map[string][]string
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Set true to delete the parameters (or the files) missing from the sync source.
+func WithDelete(b bool) OpOption {
+	return func(op *Op) {
+		op.delete = b
+	}
+}
+
+// Sets the description of the parameter.
+func WithDescription(v string) OpOption {
+	return func(op *Op) {
+		op.description = v
+	}
+}
+
+// Sets the file mode of the files synced from the parameters
+// (default 0644, and 0600 for the "SecureString" parameters).
+func WithFileMode(m os.FileMode) OpOption {
+	return func(op *Op) {
+		op.fileMode = m
+	}
+}
+
+// Set false to only list the parameters directly under the path (default true).
+func WithRecursive(b bool) OpOption {
+	return func(op *Op) {
+		op.recursive = b
+	}
+}
+
+// Sets the comment of the command (e.g., "restart my-app").
+func WithComment(v string) OpOption {
+	return func(op *Op) {
+		op.comment = v
+	}
+}
+
+// Sets the time for the command to complete before it fails (default 1 hour).
+func WithExecutionTimeout(d time.Duration) OpOption {
+	return func(op *Op) {
+		op.executionTimeout = d
+	}
+}
+
+// Sets the instance IDs to send the command to.
+func WithInstanceIDs(ids ...string) OpOption {
+	return func(op *Op) {
+		op.instanceIDs = append(op.instanceIDs, ids...)
+	}
+}
+
+// Sets the poll interval to wait for the command (default 5 seconds).
+func WithInterval(d time.Duration) OpOption {
+	return func(op *Op) {
+		op.interval = d
+	}
+}
+
+// Sets the maximum number (e.g., "1") or percentage (e.g., "25%") of the instances
+// to run the command at the same time, to roll through the fleet.
+func WithMaxConcurrency(v string) OpOption {
+	return func(op *Op) {
+		op.maxConcurrency = v
+	}
+}
+
+// Sets the maximum number (e.g., "0") or percentage of the errors
+// before the command stops being sent to the remaining instances.
+func WithMaxErrors(v string) OpOption {
+	return func(op *Op) {
+		op.maxErrors = v
+	}
+}
+
+// Sets the S3 bucket and key prefix to write the full command outputs to.
+// Otherwise, the outputs are only returned inline, truncated to 24,000 characters.
+func WithOutputS3(bucket string, prefix string) OpOption {
+	return func(op *Op) {
+		op.outputS3Bucket = bucket
+		op.outputS3Prefix = prefix
+	}
+}
+
+// Sets the instance tag to select the instances to send the command to
+// (e.g., "aws:autoscaling:groupName" for all the instances in the ASG).
+// Multiple values of the same key match any, and multiple keys must all match.
+func WithTargetTag(key string, values ...string) OpOption {
+	return func(op *Op) {
+		if op.targetTags == nil {
+			op.targetTags = make(map[string][]string)
+		}
+		op.targetTags[key] = append(op.targetTags[key], values...)
+	}
+}
+
+// Writes the parameter as "SecureString" encrypted with the KMS key.
+// If the key ID is empty, the AWS managed key ("aws/ssm") is used.
+func WithSecureString(kmsKeyID string) OpOption {
+	return func(op *Op) {
+		op.secure = true
+		op.kmsKeyID = kmsKeyID
+	}
+}
+
 // Runs a non-interactive command on the remote machine, and returns the command ID.
 // e.g.,
 // aws ssm start-session --target ${EC2_INSTANCE_ID} --document-name 'AWS-StartNonInteractiveCommand' --parameters command="sudo iptables -t nat -L"
@@ -0,0 +1,232 @@
+package ssm
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	aws_ssm_v2_types "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Represents the result of the sync, the parameter names (or the file paths).
+type SyncResult struct {
+	Updated   []string `json:"updated"`
+	Deleted   []string `json:"deleted"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// Syncs the files in the local directory to the parameter hierarchy,
+// where the relative file path becomes the parameter name under the path
+// (e.g., "dir/db/url" to "/my-app/prod/db/url"). Only the changed values are written.
+// Use "WithSecureString" to write the "SecureString" parameters,
+// and "WithDelete" to delete the parameters without the local file.
+func SyncDirToPath(ctx context.Context, cfg aws.Config, dir string, paramPath string, opts ...OpOption) (SyncResult, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+	paramPath = cleanParamPath(paramPath)
+
+	local := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		local[paramName(paramPath, rel)] = string(b)
+		return nil
+	})
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	remote, err := GetParametersByPath(ctx, cfg, paramPath)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	paramType := string(aws_ssm_v2_types.ParameterTypeString)
+	if ret.secure {
+		paramType = string(aws_ssm_v2_types.ParameterTypeSecureString)
+	}
+	puts, dels, unchanged := diffParameters(local, remote, paramType, ret.delete)
+
+	res := SyncResult{Unchanged: unchanged}
+	for _, name := range puts {
+		if _, err = PutParameter(ctx, cfg, name, local[name], opts...); err != nil {
+			return res, err
+		}
+		res.Updated = append(res.Updated, name)
+	}
+	if len(dels) > 0 {
+		if err = DeleteParameters(ctx, cfg, dels); err != nil {
+			return res, err
+		}
+		res.Deleted = dels
+	}
+
+	logutil.S().Infow("synced directory to parameters", "dir", dir, "path", paramPath, "updated", len(res.Updated), "deleted", len(res.Deleted), "unchanged", res.Unchanged)
+	return res, nil
+}
+
+// Syncs the parameter hierarchy to the files in the local directory, the reverse of "SyncDirToPath".
+// Only the changed files are written (atomically), with the "SecureString" values in 0600
+// unless "WithFileMode" is set. Use "WithDelete" to delete the files without the parameter.
+func SyncPathToDir(ctx context.Context, cfg aws.Config, paramPath string, dir string, opts ...OpOption) (SyncResult, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+	paramPath = cleanParamPath(paramPath)
+
+	params, err := GetParametersByPath(ctx, cfg, paramPath)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	res := SyncResult{}
+	want := make(map[string]struct{}, len(params))
+	for _, p := range params {
+		rel, err := relParamPath(paramPath, p.Name)
+		if err != nil {
+			return res, err
+		}
+		fp := filepath.Join(dir, rel)
+		want[fp] = struct{}{}
+
+		mode := ret.fileMode
+		if mode == 0 {
+			mode = 0644
+			if p.Type == string(aws_ssm_v2_types.ParameterTypeSecureString) {
+				mode = 0600
+			}
+		}
+		if cur, err := os.ReadFile(fp); err == nil && string(cur) == p.Value {
+			if fi, err := os.Stat(fp); err == nil && fi.Mode().Perm() == mode {
+				res.Unchanged++
+				continue
+			}
+		}
+		if err = writeFileAtomic(fp, []byte(p.Value), mode); err != nil {
+			return res, err
+		}
+		res.Updated = append(res.Updated, fp)
+	}
+
+	if ret.delete {
+		err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if _, ok := want[p]; ok {
+				return nil
+			}
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+			res.Deleted = append(res.Deleted, p)
+			return nil
+		})
+		if err != nil {
+			return res, err
+		}
+	}
+
+	logutil.S().Infow("synced parameters to directory", "path", paramPath, "dir", dir, "updated", len(res.Updated), "deleted", len(res.Deleted), "unchanged", res.Unchanged)
+	return res, nil
+}
+
+// Returns the parameter names to put and to delete, and the number of the unchanged.
+func diffParameters(local map[string]string, remote []Parameter, paramType string, del bool) ([]string, []string, int) {
+	cur := make(map[string]Parameter, len(remote))
+	for _, p := range remote {
+		cur[p.Name] = p
+	}
+
+	puts, unchanged := make([]string, 0), 0
+	for name, v := range local {
+		if p, ok := cur[name]; ok && p.Value == v && p.Type == paramType {
+			unchanged++
+			continue
+		}
+		puts = append(puts, name)
+	}
+	sort.Strings(puts)
+
+	dels := make([]string, 0)
+	if del {
+		for name := range cur {
+			if _, ok := local[name]; !ok {
+				dels = append(dels, name)
+			}
+		}
+		sort.Strings(dels)
+	}
+	return puts, dels, unchanged
+}
+
+func cleanParamPath(p string) string {
+	return "/" + strings.Trim(p, "/")
+}
+
+func paramName(paramPath string, rel string) string {
+	return path.Join(paramPath, filepath.ToSlash(rel))
+}
+
+// Returns the relative file path of the parameter under the path,
+// rejecting the names that escape the directory (e.g., "/my-app/../etc").
+func relParamPath(paramPath string, name string) (string, error) {
+	pfx := strings.TrimSuffix(paramPath, "/") + "/"
+	if !strings.HasPrefix(name, pfx) {
+		return "", fmt.Errorf("parameter %q not under %q", name, paramPath)
+	}
+	rel := strings.TrimPrefix(name, pfx)
+	for _, seg := range strings.Split(rel, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return "", fmt.Errorf("invalid parameter name %q", name)
+		}
+	}
+	return filepath.FromSlash(rel), nil
+}
+
+func writeFileAtomic(p string, b []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err = f.Chmod(mode); err == nil {
+		_, err = f.Write(b)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
@@ -0,0 +1,49 @@
+package ssm
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffParameters(t *testing.T) {
+	local := map[string]string{
+		"/app/a":   "1",
+		"/app/b":   "2",
+		"/app/c/d": "3",
+	}
+	remote := []Parameter{
+		{Name: "/app/a", Type: "String", Value: "1"},
+		{Name: "/app/b", Type: "String", Value: "old"},
+		{Name: "/app/c/d", Type: "SecureString", Value: "3"},
+		{Name: "/app/e", Type: "String", Value: "5"},
+	}
+
+	puts, dels, unchanged := diffParameters(local, remote, "String", false)
+	if !reflect.DeepEqual(puts, []string{"/app/b", "/app/c/d"}) || len(dels) != 0 || unchanged != 1 {
+		t.Fatalf("unexpected diff %v %v %d", puts, dels, unchanged)
+	}
+
+	_, dels, _ = diffParameters(local, remote, "String", true)
+	if !reflect.DeepEqual(dels, []string{"/app/e"}) {
+		t.Fatalf("unexpected deletes %v", dels)
+	}
+}
+
+func TestParamPaths(t *testing.T) {
+	p := cleanParamPath("app/prod/")
+	if p != "/app/prod" {
+		t.Fatalf("unexpected path %q", p)
+	}
+	if name := paramName(p, filepath.Join("db", "url")); name != "/app/prod/db/url" {
+		t.Fatalf("unexpected name %q", name)
+	}
+	if rel, err := relParamPath(p, "/app/prod/db/url"); err != nil || rel != filepath.Join("db", "url") {
+		t.Fatalf("unexpected rel %q (%v)", rel, err)
+	}
+	for _, name := range []string{"/app/prod/../../etc/passwd", "/app/other/x", "/app/prod//x"} {
+		if _, err := relParamPath(p, name); err == nil {
+			t.Fatalf("expected error for %q", name)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package sts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	aws_v2 "github.com/aws/aws-sdk-go-v2/aws"
+	aws_sts_v2 "github.com/aws/aws-sdk-go-v2/service/sts"
+	aws_sts_v2_types "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// Represents the temporary credentials to vend to the child processes (e.g., hook scripts).
+type Credentials struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+// Gets the temporary credentials of the IAM user via STS GetSessionToken.
+// Only works with the long-term IAM user credentials, not with the role credentials
+// (use "AssumeRoleCredentials" or "RetrieveCredentials" instead).
+// Leave the duration zero to use the STS default (12 hours).
+func GetSessionCredentials(ctx context.Context, cfg aws_v2.Config, duration time.Duration) (Credentials, error) {
+	logutil.S().Infow("getting session credentials", "duration", duration)
+	input := &aws_sts_v2.GetSessionTokenInput{}
+	if duration > 0 {
+		input.DurationSeconds = aws_v2.Int32(int32(duration.Seconds()))
+	}
+	out, err := aws_sts_v2.NewFromConfig(cfg).GetSessionToken(ctx, input)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return convertCredentials(out.Credentials)
+}
+
+// Assumes the role with the credentials of the config, and returns its temporary credentials
+// (e.g., the scoped-down role for the hook scripts).
+// Leave the duration zero to use the STS default (1 hour).
+func AssumeRoleCredentials(ctx context.Context, cfg aws_v2.Config, roleARN string, sessionName string, duration time.Duration) (Credentials, error) {
+	logutil.S().Infow("assuming role for credentials", "arn", roleARN, "sessionName", sessionName, "duration", duration)
+	input := &aws_sts_v2.AssumeRoleInput{
+		RoleArn:         aws_v2.String(roleARN),
+		RoleSessionName: aws_v2.String(sessionName),
+	}
+	if duration > 0 {
+		input.DurationSeconds = aws_v2.Int32(int32(duration.Seconds()))
+	}
+	out, err := aws_sts_v2.NewFromConfig(cfg).AssumeRole(ctx, input)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return convertCredentials(out.Credentials)
+}
+
+// Retrieves the current credentials of the config (e.g., the role assumed by the provisioner),
+// so the child processes use the same identity without another STS call.
+func RetrieveCredentials(ctx context.Context, cfg aws_v2.Config) (Credentials, error) {
+	if cfg.Credentials == nil {
+		return Credentials{}, errors.New("no credentials provider")
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	c := Credentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+	}
+	if creds.CanExpire {
+		c.Expiration = creds.Expires
+	}
+	return c, nil
+}
+
+func convertCredentials(raw *aws_sts_v2_types.Credentials) (Credentials, error) {
+	if raw == nil {
+		return Credentials{}, errors.New("no credentials in the response")
+	}
+	return Credentials{
+		AccessKeyID:     aws_v2.ToString(raw.AccessKeyId),
+		SecretAccessKey: aws_v2.ToString(raw.SecretAccessKey),
+		SessionToken:    aws_v2.ToString(raw.SessionToken),
+		Expiration:      aws_v2.ToTime(raw.Expiration),
+	}, nil
+}
+
+// Returns the credentials as the environment variables for the child process
+// (e.g., "exec.Cmd.Env = append(os.Environ(), creds.EnvVars()...)").
+// The expiration is set in "AWS_CREDENTIAL_EXPIRATION" (RFC3339) if any.
+func (c Credentials) EnvVars() []string {
+	env := []string{
+		"AWS_ACCESS_KEY_ID=" + c.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY=" + c.SecretAccessKey,
+	}
+	if c.SessionToken != "" {
+		env = append(env, "AWS_SESSION_TOKEN="+c.SessionToken)
+	}
+	if !c.Expiration.IsZero() {
+		env = append(env, "AWS_CREDENTIAL_EXPIRATION="+c.Expiration.UTC().Format(time.RFC3339))
+	}
+	return env
+}
+
+// Writes the credentials as the profile in the AWS shared credentials file
+// (e.g., "AWS_SHARED_CREDENTIALS_FILE" and "AWS_PROFILE" for the child process).
+// The other profiles in the file are kept, and the file is written atomically with 0600.
+// ref. https://docs.aws.amazon.com/sdkref/latest/guide/file-format.html
+func WriteSharedCredentials(path string, profile string, c Credentials) error {
+	if profile == "" {
+		return errors.New("empty profile")
+	}
+
+	var lines []string
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		lines = removeProfile(strings.Split(string(b), "\n"), profile)
+	case !os.IsNotExist(err):
+		return err
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 0 {
+		lines = append(lines, "")
+	}
+	lines = append(lines,
+		"["+profile+"]",
+		"aws_access_key_id = "+c.AccessKeyID,
+		"aws_secret_access_key = "+c.SecretAccessKey,
+	)
+	if c.SessionToken != "" {
+		lines = append(lines, "aws_session_token = "+c.SessionToken)
+	}
+	lines = append(lines, "")
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString(strings.Join(lines, "\n")); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(f.Name(), 0600); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write shared credentials %v", err)
+	}
+
+	logutil.S().Infow("wrote shared credentials", "path", path, "profile", profile, "expiration", c.Expiration)
+	return nil
+}
+
+// Removes the profile section (from its header to the next header).
+func removeProfile(lines []string, profile string) []string {
+	kept := make([]string, 0, len(lines))
+	skip := false
+	for _, line := range lines {
+		l := strings.TrimSpace(line)
+		if strings.HasPrefix(l, "[") && strings.HasSuffix(l, "]") {
+			skip = strings.TrimSpace(l[1:len(l)-1]) == profile
+		}
+		if !skip {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
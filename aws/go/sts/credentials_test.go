@@ -0,0 +1,69 @@
+package sts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	config_v2 "github.com/aws/aws-sdk-go-v2/config"
+)
+
+func TestEnvVars(t *testing.T) {
+	c := Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		SessionToken:    "TOKEN",
+		Expiration:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	env := strings.Join(c.EnvVars(), ",")
+	if env != "AWS_ACCESS_KEY_ID=AKID,AWS_SECRET_ACCESS_KEY=SECRET,AWS_SESSION_TOKEN=TOKEN,AWS_CREDENTIAL_EXPIRATION=2024-01-02T03:04:05Z" {
+		t.Fatalf("unexpected env vars %q", env)
+	}
+}
+
+func TestWriteSharedCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	path := filepath.Join(t.TempDir(), "aws", "credentials")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("[default]\naws_access_key_id = DEFAULT\naws_secret_access_key = DEFAULT\n\n[hook]\naws_access_key_id = OLD\naws_secret_access_key = OLD\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteSharedCredentials(path, "hook", Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "TOKEN"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "OLD") || !strings.Contains(string(b), "aws_access_key_id = DEFAULT") {
+		t.Fatalf("unexpected credentials file\n%s", b)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected file mode %v (%v)", fi.Mode(), err)
+	}
+
+	cfg, err := config_v2.LoadDefaultConfig(context.Background(),
+		config_v2.WithRegion("us-east-1"),
+		config_v2.WithSharedConfigFiles([]string{}),
+		config_v2.WithSharedCredentialsFiles([]string{path}),
+		config_v2.WithSharedConfigProfile("hook"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "AKID" || creds.SecretAccessKey != "SECRET" || creds.SessionToken != "TOKEN" {
+		t.Fatalf("unexpected credentials %+v", creds)
+	}
+}
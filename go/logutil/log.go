@@ -1,6 +1,7 @@
 package logutil
 
 import (
+	"os"
 	"sync"
 
 	"go.uber.org/zap"
@@ -29,6 +30,21 @@ func SetZapLogger(lg *zap.Logger) {
 	zap.ReplaceGlobals(lg)
 }
 
+// Tees the current logger to the core (e.g., the remote log sink),
+// so the logs are written to both.
+func AddCore(c zapcore.Core) {
+	SetZapLogger(L().WithOptions(zap.WrapCore(func(cur zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(cur, c)
+	})))
+}
+
+// Flushes the buffered logs (e.g., the remote log sink added by "AddCore"),
+// and exits with the code, since the deferred calls do not run on "os.Exit".
+func Exit(code int) {
+	_ = L().Sync()
+	os.Exit(code)
+}
+
 func L() *zap.Logger {
 	loggerMu.RLock()
 	defer loggerMu.RUnlock()
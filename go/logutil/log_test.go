@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestSetZapLogger(t *testing.T) {
@@ -40,3 +42,20 @@ func TestL(t *testing.T) {
 
 	S().Infow("done")
 }
+
+func TestAddCore(t *testing.T) {
+	lg, err := GetDefaultZapLoggerConfig().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetZapLogger(lg)
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	AddCore(core)
+
+	S().Infow("hello", "a", "b")
+	S().Debugw("ignored")
+	if logs.Len() != 1 || logs.All()[0].Message != "hello" || logs.All()[0].ContextMap()["a"] != "b" {
+		t.Fatalf("unexpected logs %+v", logs.All())
+	}
+}
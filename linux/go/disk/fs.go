@@ -0,0 +1,295 @@
+package disk
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"k8s.io/utils/exec"
+)
+
+type Op struct {
+	label        string
+	extraArgs    []string
+	mountOptions string
+	retries      int
+	interval     time.Duration
+}
+
+type OpOption func(*Op)
+
+func (op *Op) applyOpts(opts []OpOption) {
+	for _, opt := range opts {
+		opt(op)
+	}
+}
+
+// Sets the filesystem label (e.g., "data").
+func WithLabel(v string) OpOption {
+	return func(op *Op) {
+		op.label = v
+	}
+}
+
+// Sets the extra arguments to the mkfs command (e.g., "-E lazy_itable_init=1" for ext4).
+func WithExtraArgs(args ...string) OpOption {
+	return func(op *Op) {
+		op.extraArgs = args
+	}
+}
+
+// Sets the mount options (e.g., "defaults,nofail,noatime").
+func WithMountOptions(v string) OpOption {
+	return func(op *Op) {
+		op.mountOptions = v
+	}
+}
+
+// Sets the number of retries and the interval between the retries (e.g., for the mount).
+func WithRetries(n int, interval time.Duration) OpOption {
+	return func(op *Op) {
+		op.retries = n
+		op.interval = interval
+	}
+}
+
+func devicePath(device string) string {
+	if strings.HasPrefix(device, "/dev/") {
+		return device
+	}
+	return "/dev/" + device
+}
+
+// Returns the filesystem type on the block device (e.g., "ext4", "xfs"),
+// or empty if the device has no filesystem.
+//
+// e.g.,
+// sudo blkid -o value -s TYPE /dev/nvme1n1
+func ProbeFilesystem(ctx context.Context, device string) (string, error) {
+	cmdPath, err := exec.New().LookPath("blkid")
+	if err != nil {
+		return "", fmt.Errorf("blkid not found (%w)", err)
+	}
+
+	out, err := exec.New().CommandContext(ctx, cmdPath, "-o", "value", "-s", "TYPE", devicePath(device)).CombinedOutput()
+	if err != nil {
+		// blkid exits with 2 if the device has no recognized filesystem
+		var exitErr exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitStatus() == 2 {
+			return "", nil
+		}
+		return "", fmt.Errorf("blkid failed %q (%w)", string(out), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// The udev symlinks by the filesystem UUID, which do not change across reboots
+// unlike the NVMe device names (e.g., /dev/nvme1n1).
+const diskByUUIDDir = "/dev/disk/by-uuid"
+
+// Returns the stable path of the block device by its filesystem UUID
+// (e.g., "/dev/disk/by-uuid/2f6b5c0e-..."), to persist in fstab or the systemd mount unit.
+// Returns an error if the device has no filesystem.
+//
+// e.g.,
+// sudo blkid -o value -s UUID /dev/nvme1n1
+func FilesystemUUIDPath(ctx context.Context, device string) (string, error) {
+	cmdPath, err := exec.New().LookPath("blkid")
+	if err != nil {
+		return "", fmt.Errorf("blkid not found (%w)", err)
+	}
+
+	out, err := exec.New().CommandContext(ctx, cmdPath, "-o", "value", "-s", "UUID", devicePath(device)).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("blkid failed %q (%w)", string(out), err)
+	}
+	uuid := strings.TrimSpace(string(out))
+	if uuid == "" {
+		return "", fmt.Errorf("no filesystem UUID on %q", device)
+	}
+	return diskByUUIDDir + "/" + uuid, nil
+}
+
+// Creates the filesystem on the block device, only if the device has no filesystem,
+// and returns true if created. Returns an error if the device has a different filesystem.
+// Supports "ext4" and "xfs", with "WithLabel" and "WithExtraArgs".
+func Format(ctx context.Context, fsName string, device string, opts ...OpOption) (bool, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	cur, err := ProbeFilesystem(ctx, device)
+	if err != nil {
+		return false, err
+	}
+	if cur == fsName {
+		logutil.S().Infow("filesystem already exists", "fsName", fsName, "device", device)
+		return false, nil
+	}
+	if cur != "" {
+		return false, fmt.Errorf("device %s already has a %q filesystem (expected %q)", device, cur, fsName)
+	}
+
+	args := []string{}
+	switch fsName {
+	case "ext4":
+		cmdPath, err := exec.New().LookPath("mkfs.ext4")
+		if err != nil {
+			return false, fmt.Errorf("mkfs.ext4 not found (%w)", err)
+		}
+		args = append(args, cmdPath, "-F")
+		if ret.label != "" {
+			args = append(args, "-L", ret.label)
+		}
+	case "xfs":
+		cmdPath, err := exec.New().LookPath("mkfs.xfs")
+		if err != nil {
+			return false, fmt.Errorf("mkfs.xfs not found (%w)", err)
+		}
+		args = append(args, cmdPath)
+		if ret.label != "" {
+			args = append(args, "-L", ret.label)
+		}
+	default:
+		return false, fmt.Errorf("unsupported filesystem %q", fsName)
+	}
+	args = append(args, ret.extraArgs...)
+	args = append(args, devicePath(device))
+
+	logutil.S().Infow("making a file system", "fsName", fsName, "device", device, "command", strings.Join(args, " "))
+	out, err := exec.New().CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("mkfs failed %q (%w)", string(out), err)
+	}
+	return true, nil
+}
+
+const procMountsPath = "/proc/mounts"
+
+// Returns true if the block device is mounted on the directory.
+func IsMounted(device string, mountDir string) (bool, error) {
+	f, err := os.Open(procMountsPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return isMounted(f, devicePath(device), mountDir)
+}
+
+func isMounted(f *os.File, devicePath string, mountDir string) (bool, error) {
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		// empty device path matches any device mounted on the directory
+		if (devicePath == "" || fields[0] == devicePath) && fields[1] == mountDir {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// Mounts the block device to the directory with the options (see "WithMountOptions"),
+// retrying on failure (see "WithRetries"), e.g., when the device node is not ready right after the attach.
+// No-op if already mounted.
+func MountWithRetries(ctx context.Context, fsName string, device string, mountDir string, opts ...OpOption) error {
+	ret := &Op{retries: 5, interval: 3 * time.Second}
+	ret.applyOpts(opts)
+
+	cmdPath, err := exec.New().LookPath("mount")
+	if err != nil {
+		return fmt.Errorf("mount not found (%w)", err)
+	}
+	if err := os.MkdirAll(mountDir, 0755); err != nil {
+		return err
+	}
+
+	args := []string{cmdPath, "-t", fsName}
+	if ret.mountOptions != "" {
+		args = append(args, "-o", ret.mountOptions)
+	}
+	args = append(args, devicePath(device), mountDir)
+
+	for i := 0; ; i++ {
+		mounted, err := IsMounted(device, mountDir)
+		if err == nil && mounted {
+			logutil.S().Infow("already mounted", "device", device, "mountDir", mountDir)
+			return nil
+		}
+
+		logutil.S().Infow("mounting the file system", "command", strings.Join(args, " "), "attempt", i+1)
+		out, err := exec.New().CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if i >= ret.retries {
+			return fmt.Errorf("mount failed after %d attempts %q (%w)", i+1, string(out), err)
+		}
+		logutil.S().Warnw("failed to mount -- retrying", "output", string(out), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ret.interval):
+		}
+	}
+}
+
+// Returns true if any filesystem is mounted on the directory.
+func IsMountPoint(mountDir string) (bool, error) {
+	f, err := os.Open(procMountsPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return isMounted(f, "", mountDir)
+}
+
+// Unmounts the filesystem on the directory after flushing the writes,
+// retrying on failure (see "WithRetries"), e.g., when the mount is still busy.
+// No-op if not mounted.
+func Unmount(ctx context.Context, mountDir string, opts ...OpOption) error {
+	ret := &Op{retries: 5, interval: 3 * time.Second}
+	ret.applyOpts(opts)
+
+	cmdPath, err := exec.New().LookPath("umount")
+	if err != nil {
+		return fmt.Errorf("umount not found (%w)", err)
+	}
+
+	for i := 0; ; i++ {
+		mounted, err := IsMountPoint(mountDir)
+		if err != nil {
+			return err
+		}
+		if !mounted {
+			logutil.S().Infow("not mounted", "mountDir", mountDir)
+			return nil
+		}
+
+		syscall.Sync()
+		logutil.S().Infow("unmounting the file system", "mountDir", mountDir, "attempt", i+1)
+		out, err := exec.New().CommandContext(ctx, cmdPath, mountDir).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if i >= ret.retries {
+			return fmt.Errorf("umount failed after %d attempts %q (%w)", i+1, string(out), err)
+		}
+		logutil.S().Warnw("failed to unmount -- retrying", "output", string(out), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ret.interval):
+		}
+	}
+}
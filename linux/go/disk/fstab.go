@@ -0,0 +1,162 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gyuho/infra/go/logutil"
+)
+
+// Represents the "/etc/fstab" entry.
+type FstabEntry struct {
+	// Block device path (e.g., "/dev/disk/by-uuid/..." that does not change across reboots), or "UUID=..." / "LABEL=...".
+	Device     string
+	MountDir   string
+	FSName     string
+	Options    string
+	Dump       int
+	PassNumber int
+}
+
+func (e FstabEntry) String() string {
+	opts := e.Options
+	if opts == "" {
+		opts = "defaults,nofail"
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%d", e.Device, e.MountDir, e.FSName, opts, e.Dump, e.PassNumber)
+}
+
+// Ensures the fstab file has the entry for the mount directory, and returns true if updated.
+// The existing entry for the same mount directory is replaced, so re-running with the new options
+// (or the new device) does not append the duplicate entries.
+// The file is written atomically via a temporary file in the same directory.
+func EnsureFstabEntry(fstabPath string, entry FstabEntry) (bool, error) {
+	b, err := os.ReadFile(fstabPath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	updated, changed := updateFstab(string(b), entry)
+	if !changed {
+		logutil.S().Infow("fstab already up-to-date", "fstabPath", fstabPath, "entry", entry.String())
+		return false, nil
+	}
+
+	logutil.S().Infow("updating fstab", "fstabPath", fstabPath, "entry", entry.String())
+	return true, writeFileAtomic(fstabPath, []byte(updated), 0644)
+}
+
+// Returns the updated fstab contents, and false if unchanged.
+func updateFstab(contents string, entry FstabEntry) (string, bool) {
+	want := entry.String()
+
+	lines := strings.Split(strings.TrimRight(contents, "\n"), "\n")
+	if contents == "" {
+		lines = nil
+	}
+	found := false
+	out := make([]string, 0, len(lines)+1)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") && fields[1] == entry.MountDir {
+			if found {
+				// drop the duplicate entries for the same mount directory
+				continue
+			}
+			found = true
+			if strings.Join(fields, " ") == strings.Join(strings.Fields(want), " ") {
+				out = append(out, line)
+			} else {
+				out = append(out, want)
+			}
+			continue
+		}
+		out = append(out, line)
+	}
+	if !found {
+		out = append(out, want)
+	}
+
+	updated := strings.Join(out, "\n") + "\n"
+	return updated, updated != contents
+}
+
+// Returns the systemd mount unit name for the mount directory (e.g., "/data/db" to "data-db.mount").
+// ref. https://www.freedesktop.org/software/systemd/man/latest/systemd.mount.html
+func SystemdMountUnitName(mountDir string) string {
+	p := strings.Trim(filepath.Clean(mountDir), "/")
+	if p == "" {
+		return "-.mount"
+	}
+	var sb strings.Builder
+	for i, c := range []byte(p) {
+		switch {
+		case c == '/':
+			sb.WriteByte('-')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.' && i > 0, c == ':':
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		}
+	}
+	return sb.String() + ".mount"
+}
+
+// Ensures the systemd mount unit for the entry in the unit directory (e.g., "/etc/systemd/system"),
+// and returns the unit path and true if updated.
+// The caller should run "systemctl daemon-reload" and "systemctl enable --now <unit>" if updated.
+func EnsureSystemdMountUnit(unitDir string, entry FstabEntry) (string, bool, error) {
+	opts := entry.Options
+	if opts == "" {
+		opts = "defaults,nofail"
+	}
+	unit := fmt.Sprintf(`[Unit]
+Description=Mount %s
+
+[Mount]
+What=%s
+Where=%s
+Type=%s
+Options=%s
+
+[Install]
+WantedBy=multi-user.target
+`, entry.MountDir, entry.Device, entry.MountDir, entry.FSName, opts)
+
+	p := filepath.Join(unitDir, SystemdMountUnitName(entry.MountDir))
+	b, err := os.ReadFile(p)
+	if err == nil && string(b) == unit {
+		logutil.S().Infow("systemd mount unit already up-to-date", "path", p)
+		return p, false, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return p, false, err
+	}
+
+	logutil.S().Infow("writing systemd mount unit", "path", p)
+	return p, true, writeFileAtomic(p, []byte(unit), 0644)
+}
+
+func writeFileAtomic(p string, b []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, p)
+}
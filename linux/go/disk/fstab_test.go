@@ -0,0 +1,56 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureFstabEntry(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "fstab")
+	if err := os.WriteFile(p, []byte("# comment\nUUID=abc\t/\text4\tdefaults\t0\t1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := FstabEntry{Device: "/dev/nvme1n1", MountDir: "/data", FSName: "ext4", PassNumber: 2}
+	changed, err := EnsureFstabEntry(p, entry)
+	if err != nil || !changed {
+		t.Fatalf("expected changed, got %v (%v)", changed, err)
+	}
+	changed, err = EnsureFstabEntry(p, entry)
+	if err != nil || changed {
+		t.Fatalf("expected unchanged, got %v (%v)", changed, err)
+	}
+
+	entry.Options = "defaults,nofail,noatime"
+	changed, err = EnsureFstabEntry(p, entry)
+	if err != nil || !changed {
+		t.Fatalf("expected changed, got %v (%v)", changed, err)
+	}
+
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "# comment\nUUID=abc\t/\text4\tdefaults\t0\t1\n/dev/nvme1n1\t/data\text4\tdefaults,nofail,noatime\t0\t2\n"
+	if string(b) != exp {
+		t.Fatalf("expected %q, got %q", exp, string(b))
+	}
+}
+
+func TestSystemdMountUnitName(t *testing.T) {
+	tt := []struct {
+		dir string
+		exp string
+	}{
+		{"/data", "data.mount"},
+		{"/data/db/", "data-db.mount"},
+		{"/mnt/my-disk", `mnt-my\x2ddisk.mount`},
+		{"/", "-.mount"},
+	}
+	for i, tv := range tt {
+		if v := SystemdMountUnitName(tv.dir); v != tv.exp {
+			t.Fatalf("#%d: expected %q, got %q", i, tv.exp, v)
+		}
+	}
+}
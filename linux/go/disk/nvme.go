@@ -0,0 +1,55 @@
+package disk
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gyuho/infra/go/logutil"
+)
+
+// The udev rules on the Amazon Linux and Ubuntu AMIs create the by-id symlinks
+// with the EBS volume ID (without the dash) as the NVMe serial number.
+// e.g., /dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_vol0123456789abcdef0 -> ../../nvme1n1
+var diskByIDDir = "/dev/disk/by-id"
+
+const ebsNVMePrefix = "nvme-Amazon_Elastic_Block_Store_"
+
+// Resolves the OS-level block device of the attached EBS volume, since the Nitro instances
+// expose the EBS volumes as NVMe devices (e.g., /dev/nvme1n1) whose names do not follow
+// the EBS device name (e.g., /dev/xvdb) and can change across reboots.
+// Falls back to the EBS device name (e.g., Xen instances) if the by-id symlink is not found.
+// Use "WithRetries" to wait for the device to show up after the attachment.
+// ref. https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/nvme-ebs-volumes.html
+func ResolveEBSDevice(ctx context.Context, volumeID string, ebsDevice string, opts ...OpOption) (string, error) {
+	ret := &Op{}
+	ret.applyOpts(opts)
+
+	link := filepath.Join(diskByIDDir, ebsNVMePrefix+strings.Replace(volumeID, "-", "", 1))
+	for attempt := 0; ; attempt++ {
+		if dev, err := filepath.EvalSymlinks(link); err == nil {
+			logutil.S().Infow("resolved EBS volume to NVMe device", "volumeID", volumeID, "device", dev)
+			return dev, nil
+		}
+		if ebsDevice != "" {
+			if _, err := os.Stat(ebsDevice); err == nil {
+				logutil.S().Infow("resolved EBS volume to EBS device", "volumeID", volumeID, "device", ebsDevice)
+				return ebsDevice, nil
+			}
+		}
+		if attempt >= ret.retries {
+			break
+		}
+
+		logutil.S().Infow("EBS volume device not found yet -- retrying", "volumeID", volumeID, "attempt", attempt)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(ret.interval):
+		}
+	}
+	return "", fmt.Errorf("no block device found for the EBS volume %q (ebs device %q)", volumeID, ebsDevice)
+}
@@ -0,0 +1,44 @@
+package disk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveEBSDevice(t *testing.T) {
+	dir := t.TempDir()
+	orig := diskByIDDir
+	diskByIDDir = filepath.Join(dir, "by-id")
+	defer func() { diskByIDDir = orig }()
+	if err := os.MkdirAll(diskByIDDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	nvme := filepath.Join(dir, "nvme1n1")
+	xvdc := filepath.Join(dir, "xvdc")
+	for _, p := range []string{nvme, xvdc} {
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(nvme, filepath.Join(diskByIDDir, "nvme-Amazon_Elastic_Block_Store_vol0123")); err != nil {
+		t.Fatal(err)
+	}
+
+	dev, err := ResolveEBSDevice(context.Background(), "vol-0123", filepath.Join(dir, "xvdb"))
+	if err != nil || dev != nvme {
+		t.Fatalf("expected %q, got %q (%v)", nvme, dev, err)
+	}
+
+	// falls back to the EBS device name without the NVMe symlink
+	dev, err = ResolveEBSDevice(context.Background(), "vol-4567", xvdc)
+	if err != nil || dev != xvdc {
+		t.Fatalf("expected %q, got %q (%v)", xvdc, dev, err)
+	}
+
+	if _, err = ResolveEBSDevice(context.Background(), "vol-89ab", filepath.Join(dir, "xvdd")); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,81 @@
+package disk
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/gyuho/infra/go/logutil"
+
+	"k8s.io/utils/exec"
+)
+
+// Returns the size of the block device in bytes.
+//
+// e.g.,
+// sudo blockdev --getsize64 /dev/nvme1n1
+func BlockDeviceSize(ctx context.Context, device string) (uint64, error) {
+	cmdPath, err := exec.New().LookPath("blockdev")
+	if err != nil {
+		return 0, fmt.Errorf("blockdev not found (%w)", err)
+	}
+	out, err := exec.New().CommandContext(ctx, cmdPath, "--getsize64", devicePath(device)).CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("blockdev failed %q (%w)", string(out), err)
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(out)), 10, 64)
+}
+
+// Returns the total size of the mounted filesystem in bytes.
+func FilesystemSize(mountDir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(mountDir, &st); err != nil {
+		return 0, err
+	}
+	return st.Blocks * uint64(st.Bsize), nil
+}
+
+// The filesystem metadata (e.g., ext4 inode tables and journal) is not counted in the filesystem size,
+// so the filesystem is considered to fill the device within this ratio.
+const growThresholdRatio = 0.95
+
+// Returns true if the block device is larger than the filesystem
+// (e.g., after the EBS volume was modified), beyond the filesystem metadata overhead.
+func NeedsGrow(deviceSize uint64, fsSize uint64) bool {
+	return float64(fsSize) < float64(deviceSize)*growThresholdRatio
+}
+
+// Grows the mounted filesystem online to fill the block device.
+// Only the filesystem created on the whole device is supported (no partition table).
+//
+// e.g.,
+// sudo resize2fs /dev/nvme1n1
+// sudo xfs_growfs -d /data
+func GrowFilesystem(ctx context.Context, fsName string, device string, mountDir string) ([]byte, error) {
+	var args []string
+	switch fsName {
+	case "ext4":
+		cmdPath, err := exec.New().LookPath("resize2fs")
+		if err != nil {
+			return nil, fmt.Errorf("resize2fs not found (%w)", err)
+		}
+		args = []string{cmdPath, devicePath(device)}
+	case "xfs":
+		cmdPath, err := exec.New().LookPath("xfs_growfs")
+		if err != nil {
+			return nil, fmt.Errorf("xfs_growfs not found (%w)", err)
+		}
+		args = []string{cmdPath, "-d", mountDir}
+	default:
+		return nil, fmt.Errorf("unsupported filesystem %q", fsName)
+	}
+
+	logutil.S().Infow("growing the file system", "fsName", fsName, "device", device, "mountDir", mountDir, "command", strings.Join(args, " "))
+	out, err := exec.New().CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("grow failed %q (%w)", string(out), err)
+	}
+	return out, nil
+}
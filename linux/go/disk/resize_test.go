@@ -0,0 +1,21 @@
+package disk
+
+import "testing"
+
+func TestNeedsGrow(t *testing.T) {
+	gib := uint64(1 << 30)
+	tt := []struct {
+		deviceSize uint64
+		fsSize     uint64
+		exp        bool
+	}{
+		{deviceSize: 300 * gib, fsSize: 295 * gib, exp: false},
+		{deviceSize: 400 * gib, fsSize: 295 * gib, exp: true},
+		{deviceSize: 300 * gib, fsSize: 300 * gib, exp: false},
+	}
+	for i, tv := range tt {
+		if v := NeedsGrow(tv.deviceSize, tv.fsSize); v != tv.exp {
+			t.Fatalf("#%d: expected %v, got %v", i, tv.exp, v)
+		}
+	}
+}